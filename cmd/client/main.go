@@ -3,6 +3,8 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
@@ -15,6 +17,8 @@ import (
 const (
 	DefaultHost = "localhost"
 	DefaultPort = "8080"
+	// ProtocolVersion is the newest version of the server's protocol the client speaks
+	ProtocolVersion = 1
 )
 
 type QueryResponse struct {
@@ -22,9 +26,25 @@ type QueryResponse struct {
 	Rows     []map[string]interface{} `json:"rows,omitempty"`
 	Columns  []string                 `json:"columns,omitempty"`
 	Affected int                      `json:"affected,omitempty"`
+	RIDs     []RIDResponse            `json:"rids,omitempty"`
+	Message  string                   `json:"message,omitempty"`
 	Error    string                   `json:"error,omitempty"`
+	// ElapsedMs and BlocksAccessed are what the statement cost the server
+	ElapsedMs      float64 `json:"elapsed_ms,omitempty"`
+	BlocksAccessed int     `json:"blocks_accessed,omitempty"`
+	// Version is the protocol version the server agreed on, in the answer to VERSION
+	Version int `json:"version,omitempty"`
 }
 
+// RIDResponse identifies a record by its block number and slot within the block.
+type RIDResponse struct {
+	Block int `json:"block"`
+	Slot  int `json:"slot"`
+}
+
+// stdin reads the statements typed in, and the CSV text of imports, which follows its statement
+var stdin = bufio.NewReader(os.Stdin)
+
 type Client struct {
 	conn   net.Conn
 	reader *bufio.Reader
@@ -45,6 +65,36 @@ func NewClient(host, port string) (*Client, error) {
 	}, nil
 }
 
+// NegotiateVersion tells the server the newest protocol version the client speaks, and
+// returns the version the connection uses from then on.
+func (c *Client) NegotiateVersion() (int, error) {
+	response, _, err := c.ExecuteQuery(fmt.Sprintf("VERSION %d", ProtocolVersion))
+	if err != nil {
+		return 0, err
+	}
+	if response.Error != "" {
+		return 0, errors.New(response.Error)
+	}
+	return response.Version, nil
+}
+
+// Authenticate sends the AUTH line a server with authentication on expects before any statement.
+func (c *Client) Authenticate(user, password string) error {
+	responseLine, err := c.send(fmt.Sprintf("AUTH %s %s", user, password))
+	if err != nil {
+		return err
+	}
+
+	var response QueryResponse
+	if err := json.Unmarshal([]byte(responseLine), &response); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+	return nil
+}
+
 func (c *Client) Close() error {
 	return c.conn.Close()
 }
@@ -52,106 +102,347 @@ func (c *Client) Close() error {
 func (c *Client) ExecuteQuery(query string) (*QueryResponse, time.Duration, error) {
 	start := time.Now()
 
-	if _, err := c.writer.WriteString(query + "\n"); err != nil {
-		return nil, 0, fmt.Errorf("failed to send query: %w", err)
+	responseLine, err := c.send(query)
+	if err != nil {
+		return nil, 0, err
 	}
-	if err := c.writer.Flush(); err != nil {
-		return nil, 0, fmt.Errorf("failed to flush query: %w", err)
+
+	var response QueryResponse
+	if err := json.Unmarshal([]byte(responseLine), &response); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	responseLine, err := c.reader.ReadString('\n')
+	duration := time.Since(start)
+	return &response, duration, nil
+}
+
+// ExecuteBatch sends the statements in a single message and returns their responses in order.
+// The server stops at the first failing statement, so there may be fewer responses than statements.
+func (c *Client) ExecuteBatch(statements []string) ([]QueryResponse, time.Duration, error) {
+	start := time.Now()
+
+	responseLine, err := c.send(strings.Join(statements, "; "))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// A message with a single statement is answered with a single response
+	var responses []QueryResponse
+	if strings.HasPrefix(responseLine, "[") {
+		err = json.Unmarshal([]byte(responseLine), &responses)
+	} else {
+		var response QueryResponse
+		err = json.Unmarshal([]byte(responseLine), &response)
+		responses = []QueryResponse{response}
+	}
 	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	duration := time.Since(start)
+	return responses, duration, nil
+}
+
+// ReadRows reads the rows of a streamed query, which the server sends after a "stream"
+// response, and calls fn with the values of each in column order. It returns the response
+// that ends the stream: "end", or "error" if the query failed part way.
+func (c *Client) ReadRows(fn func(values []interface{})) (*QueryResponse, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("server closed connection")
+			}
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		// Rows are JSON arrays, so the object ending the stream can't be taken for one
+		if strings.HasPrefix(line, "{") {
+			var response QueryResponse
+			if err := json.Unmarshal([]byte(line), &response); err != nil {
+				return nil, fmt.Errorf("failed to parse response: %w", err)
+			}
+			return &response, nil
+		}
+		var values []interface{}
+		if err := json.Unmarshal([]byte(line), &values); err != nil {
+			return nil, fmt.Errorf("failed to parse row: %w", err)
+		}
+		fn(values)
+	}
+}
+
+// ReadCSV copies the CSV text of an export, which the server sends after a "csv" response,
+// to w. It returns the response that ends the text: "end", or "error" if the export failed
+// part way.
+func (c *Client) ReadCSV(w io.Writer) (*QueryResponse, error) {
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("server closed connection")
+			}
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		// Quotes in CSV text are doubled or enclose a field, so no line of it starts like this
+		if strings.HasPrefix(line, `{"type":`) {
+			var response QueryResponse
+			if err := json.Unmarshal([]byte(line), &response); err != nil {
+				return nil, fmt.Errorf("failed to parse response: %w", err)
+			}
+			return &response, nil
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SendCSV answers an "import" response with the CSV text read from r, up to its end or a line
+// holding only \., and returns the response to the import.
+func (c *Client) SendCSV(r *bufio.Reader) (*QueryResponse, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read CSV data: %w", err)
+		}
+		if strings.TrimRight(line, "\r\n") == `\.` || line == "" {
+			break
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if _, err := c.writer.WriteString(line); err != nil {
+			return nil, fmt.Errorf("failed to send CSV data: %w", err)
+		}
 		if err == io.EOF {
-			return nil, 0, fmt.Errorf("server closed connection")
+			break
 		}
-		return nil, 0, fmt.Errorf("failed to read response: %w", err)
 	}
 
+	responseLine, err := c.send(`\.`)
+	if err != nil {
+		return nil, err
+	}
 	var response QueryResponse
-	if err := json.Unmarshal([]byte(strings.TrimSpace(responseLine)), &response); err != nil {
-		return nil, 0, fmt.Errorf("failed to parse response: %w", err)
+	if err := json.Unmarshal([]byte(responseLine), &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	return &response, nil
+}
 
-	duration := time.Since(start)
-	return &response, duration, nil
+// send writes a message to the server and returns its response line.
+func (c *Client) send(message string) (string, error) {
+	if _, err := c.writer.WriteString(message + "\n"); err != nil {
+		return "", fmt.Errorf("failed to send query: %w", err)
+	}
+	if err := c.writer.Flush(); err != nil {
+		return "", fmt.Errorf("failed to flush query: %w", err)
+	}
+
+	responseLine, err := c.reader.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", fmt.Errorf("server closed connection")
+		}
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return strings.TrimSpace(responseLine), nil
 }
 
 func printQueryResults(response *QueryResponse, duration time.Duration) {
 	if response.Error != "" {
 		fmt.Printf("❌ Error: %s\n", response.Error)
-		fmt.Printf("⏱️  Time: %v\n\n", duration)
+		printTime(response, duration)
 		return
 	}
 
 	if response.Type == "query" {
 		if len(response.Rows) == 0 {
 			fmt.Println("(0 rows)")
-			fmt.Printf("⏱️  Time: %v\n\n", duration)
+			printTime(response, duration)
 			return
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprint(w, strings.Join(response.Columns, "\t"))
-		fmt.Fprint(w, "\n")
-		fmt.Fprint(w, strings.Repeat("-\t", len(response.Columns)))
-		fmt.Fprint(w, "\n")
+		// Rows without columns (SELECT FROM t) are only counted
+		if len(response.Columns) > 0 {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprint(w, strings.Join(response.Columns, "\t"))
+			fmt.Fprint(w, "\n")
+			fmt.Fprint(w, strings.Repeat("-\t", len(response.Columns)))
+			fmt.Fprint(w, "\n")
 
-		for _, row := range response.Rows {
-			values := make([]string, len(response.Columns))
-			for i, col := range response.Columns {
-				val := row[col]
-				switch v := val.(type) {
-				case float64:
-					if v == float64(int64(v)) {
-						values[i] = fmt.Sprintf("%d", int64(v))
-					} else {
-						values[i] = fmt.Sprintf("%g", v)
-					}
-				case string:
-					values[i] = v
-				case int:
-					values[i] = fmt.Sprintf("%d", v)
-				default:
-					values[i] = fmt.Sprintf("%v", v)
+			for _, row := range response.Rows {
+				values := make([]string, len(response.Columns))
+				for i, col := range response.Columns {
+					values[i] = formatValue(row[col])
 				}
+				fmt.Fprint(w, strings.Join(values, "\t"))
+				fmt.Fprint(w, "\n")
 			}
-			fmt.Fprint(w, strings.Join(values, "\t"))
-			fmt.Fprint(w, "\n")
+			w.Flush()
+			fmt.Println()
 		}
-		w.Flush()
-		fmt.Printf("\n(%d row(s))\n", len(response.Rows))
-		fmt.Printf("⏱️  Time: %v\n\n", duration)
+		fmt.Printf("(%d row(s))\n", len(response.Rows))
+		printTime(response, duration)
 	} else if response.Type == "update" {
 		fmt.Printf("✓ %d row(s) affected\n", response.Affected)
-		fmt.Printf("⏱️  Time: %v\n\n", duration)
+		for _, rid := range response.RIDs {
+			fmt.Printf("  rid: block %d, slot %d\n", rid.Block, rid.Slot)
+		}
+		printTime(response, duration)
+	} else if response.Type == "transaction" || response.Type == "setting" || response.Type == "cursor" {
+		fmt.Printf("✓ %s\n", response.Message)
+		printTime(response, duration)
+	}
+}
+
+// printTime prints the time a statement took, as seen by the client, followed by what it
+// cost the server when the server measured it.
+func printTime(response *QueryResponse, duration time.Duration) {
+	if response.ElapsedMs > 0 {
+		fmt.Printf("⏱️  Time: %v (server: %.3fms, %d block(s) accessed)\n\n", duration, response.ElapsedMs, response.BlocksAccessed)
+		return
+	}
+	fmt.Printf("⏱️  Time: %v\n\n", duration)
+}
+
+// formatValue renders a value of a row as it is printed.
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return fmt.Sprintf("%d", int64(v))
+		}
+		return fmt.Sprintf("%g", v)
+	case string:
+		return v
+	case int:
+		return fmt.Sprintf("%d", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// streamFlushRows is the number of streamed rows printed at a time. Columns are aligned
+// within each group of rows only, since the rows after them aren't known yet.
+const streamFlushRows = 100
+
+// printStream prints the rows of a streamed query as they arrive, and returns the response
+// that ended the stream.
+func printStream(client *Client, header *QueryResponse, duration time.Duration) (*QueryResponse, error) {
+	start := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// Rows without columns are only counted, as in printQueryResults
+	printRows := len(header.Columns) > 0
+	if printRows {
+		fmt.Fprint(w, strings.Join(header.Columns, "\t"))
+		fmt.Fprint(w, "\n")
+		fmt.Fprint(w, strings.Repeat("-\t", len(header.Columns)))
+		fmt.Fprint(w, "\n")
+	}
+
+	count := 0
+	response, err := client.ReadRows(func(values []interface{}) {
+		count++
+		if !printRows {
+			return
+		}
+		formatted := make([]string, len(values))
+		for i, val := range values {
+			formatted[i] = formatValue(val)
+		}
+		fmt.Fprint(w, strings.Join(formatted, "\t"))
+		fmt.Fprint(w, "\n")
+		if count%streamFlushRows == 0 {
+			w.Flush()
+		}
+	})
+	w.Flush()
+	duration += time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != "" {
+		printQueryResults(response, duration)
+		return response, nil
+	}
+	if printRows {
+		fmt.Println()
 	}
+	fmt.Printf("(%d row(s))\n", count)
+	fmt.Printf("⏱️  Time: %v\n\n", duration)
+	return response, nil
 }
 
 // processQuery processes a query string: executes it and prints results.
-// Returns true if the client should exit (QUIT/EXIT command).
-func processQuery(query string, client *Client) bool {
+// Returns true if the client should exit (QUIT/EXIT command), and the error
+// of the query if it failed.
+func processQuery(query string, client *Client) (bool, error) {
 	query = strings.TrimSpace(query)
 	if query == "" {
-		return false
+		return false, nil
 	}
 
 	upperQuery := strings.ToUpper(query)
 	if upperQuery == "QUIT" || upperQuery == "EXIT" {
 		fmt.Println("Goodbye!")
-		return true
+		return true, nil
 	}
 
-	response, duration, err := client.ExecuteQuery(query)
+	// The input may hold several statements, which the server runs as a batch
+	responses, duration, err := client.ExecuteBatch([]string{query})
 	if err != nil {
 		fmt.Printf("❌ Error: %v\n\n", err)
-		return false
+		return false, err
 	}
 
-	printQueryResults(response, duration)
-	return false
+	for i := range responses {
+		if responses[i].Type == "stream" {
+			// A streamed query is answered alone, so this is the only response
+			end, streamErr := printStream(client, &responses[i], duration)
+			if streamErr != nil {
+				fmt.Printf("❌ Error: %v\n\n", streamErr)
+				return false, streamErr
+			}
+			responses[i] = *end
+		} else if responses[i].Type == "csv" {
+			// An export is answered alone, so this is the only response
+			end, csvErr := client.ReadCSV(os.Stdout)
+			if csvErr != nil {
+				fmt.Printf("❌ Error: %v\n\n", csvErr)
+				return false, csvErr
+			}
+			responses[i] = *end
+			if end.Error != "" {
+				printQueryResults(end, duration)
+			}
+		} else if responses[i].Type == "import" {
+			fmt.Printf("Enter a CSV header naming some of %s, then the rows. End with \\.\n", strings.Join(responses[i].Columns, ", "))
+			result, importErr := client.SendCSV(stdin)
+			if importErr != nil {
+				fmt.Printf("❌ Error: %v\n\n", importErr)
+				return false, importErr
+			}
+			responses[i] = *result
+			printQueryResults(result, duration)
+		} else {
+			printQueryResults(&responses[i], duration)
+		}
+		if responses[i].Error != "" {
+			err = errors.New(responses[i].Error)
+		}
+	}
+	return false, err
 }
 
 func main() {
+	scriptPath := flag.String("f", "", "execute the statements of a SQL file and exit")
+	continueOnError := flag.Bool("continue-on-error", false, "with -f, keep going after a statement fails")
+	stream := flag.Bool("stream", false, "print the rows of queries as the server sends them, instead of after the last one")
+	flag.Parse()
+
 	host := os.Getenv("CRANEDB_HOST")
 	if host == "" {
 		host = DefaultHost
@@ -169,12 +460,46 @@ func main() {
 	}
 	defer client.Close()
 
+	if _, err := client.NegotiateVersion(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error negotiating the protocol version: %v\n", err)
+		client.Close()
+		os.Exit(1)
+	}
+
+	if user := os.Getenv("CRANEDB_USER"); user != "" {
+		if err := client.Authenticate(user, os.Getenv("CRANEDB_PASSWORD")); err != nil {
+			fmt.Fprintf(os.Stderr, "Error authenticating: %v\n", err)
+			client.Close()
+			os.Exit(1)
+		}
+	}
+
+	if *stream {
+		response, _, err := client.ExecuteQuery("SET stream_rows ON")
+		if err == nil && response.Error != "" {
+			err = errors.New(response.Error)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error enabling streaming: %v\n", err)
+			client.Close()
+			os.Exit(1)
+		}
+	}
+
+	if *scriptPath != "" {
+		if err := runScript(*scriptPath, client, *continueOnError); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			client.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Println("🐦 CraneDB Client")
 	fmt.Printf("Connected to %s:%s\n", host, port)
 	fmt.Println("Type 'QUIT' or 'EXIT' to exit, or enter SQL queries")
 	fmt.Println()
 
-	scanner := bufio.NewScanner(os.Stdin)
 	var queryBuilder strings.Builder
 
 	for {
@@ -184,11 +509,15 @@ func main() {
 			fmt.Print("      -> ")
 		}
 
-		if !scanner.Scan() {
+		text, err := stdin.ReadString('\n')
+		if err != nil && text == "" {
+			if err != io.EOF {
+				fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+			}
 			break
 		}
 
-		line := strings.TrimSpace(scanner.Text())
+		line := strings.TrimSpace(text)
 
 		if line == "" {
 			continue
@@ -198,7 +527,7 @@ func main() {
 			queryBuilder.WriteString(" " + strings.TrimSuffix(line, ";"))
 			query := queryBuilder.String()
 			queryBuilder.Reset()
-			if processQuery(query, client) {
+			if exit, _ := processQuery(query, client); exit {
 				break
 			}
 		} else {
@@ -208,8 +537,4 @@ func main() {
 			queryBuilder.WriteString(line)
 		}
 	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
-	}
 }
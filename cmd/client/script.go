@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// scriptStatement is a statement of a SQL script with the line it starts on.
+type scriptStatement struct {
+	sql  string
+	line int
+}
+
+// splitScript splits a SQL script into its statements, which are separated by ';'.
+// "--" comments run to the end of the line and are removed, as are /* block comments */.
+// Neither ';' nor a comment counts inside a quoted string or identifier, where a quote is
+// escaped by doubling it.
+func splitScript(script string) []scriptStatement {
+	statements := []scriptStatement{}
+	var current strings.Builder
+	line, start := 1, 0
+	inComment, inBlockComment := false, false
+	// quote is the quote of the string or identifier being read, or 0 outside of them
+	var quote rune
+
+	finish := func() {
+		sql := strings.TrimSpace(current.String())
+		if sql != "" {
+			statements = append(statements, scriptStatement{sql: sql, line: start})
+		}
+		current.Reset()
+		start = 0
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case ch == '\n':
+			inComment = false
+			line++
+		case inComment:
+			continue
+		case inBlockComment:
+			if ch == '*' && i+1 < len(runes) && runes[i+1] == '/' {
+				inBlockComment = false
+				i++
+			}
+			continue
+		case quote != 0:
+			if ch == quote {
+				if i+1 < len(runes) && runes[i+1] == quote {
+					current.WriteString(string(quote) + string(quote))
+					i++
+					continue
+				}
+				quote = 0
+			}
+		case ch == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			inComment = true
+			continue
+		case ch == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			// The comment still separates the tokens around it
+			inBlockComment = true
+			i++
+			current.WriteRune(' ')
+			continue
+		case ch == ';':
+			finish()
+			continue
+		case ch == '\'' || ch == '"':
+			quote = ch
+		}
+
+		if start == 0 && ch != '\n' && strings.TrimSpace(string(ch)) != "" {
+			start = line
+		}
+		current.WriteRune(ch)
+	}
+	finish()
+	return statements
+}
+
+// runScript executes the statements of a SQL file one after another and prints their results.
+// A failing statement is reported with its line number. Unless continueOnError is set, the
+// script stops there. It returns an error if any statement failed.
+func runScript(path string, client *Client, continueOnError bool) error {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, stmt := range splitScript(string(script)) {
+		exit, err := processQuery(stmt.sql, client)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: statement failed: %v\n", path, stmt.line, err)
+			failed++
+			if !continueOnError {
+				return fmt.Errorf("stopped at line %d of %s", stmt.line, path)
+			}
+		}
+		if exit {
+			break
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d statement(s) of %s failed", failed, path)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitScript(t *testing.T) {
+	script := `-- Create the table
+CREATE TABLE users (id INT, name VARCHAR(20));
+
+INSERT INTO users (id, name) VALUES (1, 'a;b'); -- trailing comment
+INSERT INTO users (id, name)
+  VALUES (2, 'it''s -- not a comment');
+SELECT id FROM users WHERE id > -1
+`
+	assert.Equal(t, []scriptStatement{
+		{sql: "CREATE TABLE users (id INT, name VARCHAR(20))", line: 2},
+		{sql: "INSERT INTO users (id, name) VALUES (1, 'a;b')", line: 4},
+		{sql: "INSERT INTO users (id, name)\n  VALUES (2, 'it''s -- not a comment')", line: 5},
+		{sql: "SELECT id FROM users WHERE id > -1", line: 7},
+	}, splitScript(script))
+
+	assert.Empty(t, splitScript("-- only a comment\n;\n"))
+
+	// Block comments may span lines and hold quotes and semicolons
+	assert.Equal(t, []scriptStatement{
+		{sql: "SELECT id   FROM users", line: 2},
+		{sql: "DELETE FROM users", line: 4},
+	}, splitScript("/* don't;\nrun */ SELECT id /* ; */ FROM users;\n/* done */\nDELETE FROM users"))
+}
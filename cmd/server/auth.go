@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultAuthTimeout is how long a new connection has to authenticate before it is closed
+const DefaultAuthTimeout = 10 * time.Second
+
+// loadUsers reads a credentials file holding one "user:password" entry per line.
+// Empty lines and lines starting with # are ignored.
+func loadUsers(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	users := map[string]string{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, password, ok := strings.Cut(line, ":")
+		if !ok || user == "" || password == "" || strings.ContainsAny(user, " \t") {
+			return nil, fmt.Errorf("invalid credentials on line %d: expected user:password", i+1)
+		}
+		users[user] = password
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("credentials file %s holds no users", path)
+	}
+	return users, nil
+}
+
+// checkCredentials returns true if the password is the one of the user
+func (s *Server) checkCredentials(user, password string) bool {
+	expected, ok := s.users[user]
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// authenticate reads the AUTH line a connection must start with when the server has users,
+// and answers it. PING and VERSION may come before it, and are answered as they come. It
+// returns the authenticated user, or false if the connection sent anything else, wrong
+// credentials, or no AUTH line within the auth timeout.
+func (s *Server) authenticate(session *Session, conn net.Conn, scanner *bufio.Scanner, writer *bufio.Writer) (string, bool) {
+	conn.SetReadDeadline(time.Now().Add(s.authTimeout))
+	var line string
+	for {
+		if !scanner.Scan() {
+			writeResponse(writer, QueryResponse{Type: "error", Error: "authentication timed out"})
+			return "", false
+		}
+		line = scanner.Text()
+		response, ok := controlCommand(session, line)
+		if !ok {
+			break
+		}
+		writeResponse(writer, response)
+	}
+
+	// The password is the rest of the line, so it may hold spaces
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(fields) < 3 || !strings.EqualFold(fields[0], "AUTH") {
+		writeResponse(writer, QueryResponse{Type: "error", Error: "authentication required: send AUTH user password"})
+		return "", false
+	}
+	user, password := fields[1], fields[2]
+	if !s.checkCredentials(user, password) {
+		writeResponse(writer, QueryResponse{Type: "error", Error: "authentication failed"})
+		return "", false
+	}
+
+	// Shutdown may have set a deadline to wake the connection; it sets shuttingDown first,
+	// so checking it after clearing the deadline can't miss it
+	conn.SetReadDeadline(time.Time{})
+	if s.isShuttingDown() {
+		return "", false
+	}
+	writeResponse(writer, QueryResponse{Type: "auth", Message: "Authenticated as " + user})
+	return user, true
+}
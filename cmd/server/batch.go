@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+)
+
+// splitStatements splits a message into its ";"-separated statements.
+// Semicolons inside single-quoted strings or double-quoted identifiers don't end a statement.
+// Comments are removed: "--" comments run to the end of the line, and /* block
+// comments */ to their closing "*/". Empty statements are dropped.
+func splitStatements(message string) []string {
+	statements := []string{}
+	var current strings.Builder
+	var quote rune
+	inComment, inBlockComment := false, false
+
+	runes := []rune(message)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		next := rune(0)
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		switch {
+		case inComment:
+			if ch != '\n' {
+				continue
+			}
+			inComment = false
+		case inBlockComment:
+			if ch == '*' && next == '/' {
+				inBlockComment = false
+				i++
+			}
+			continue
+		case quote != 0:
+			// A doubled quote closes and reopens the string, which leaves it open
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '-' && next == '-':
+			inComment = true
+			continue
+		case ch == '/' && next == '*':
+			// The comment still separates the tokens around it
+			inBlockComment = true
+			i++
+			current.WriteRune(' ')
+			continue
+		case ch == ';':
+			if statement := strings.TrimSpace(current.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			current.Reset()
+			continue
+		}
+		current.WriteRune(ch)
+	}
+
+	if statement := strings.TrimSpace(current.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+	return statements
+}
+
+// executeBatch runs the statements in order and returns one response per statement.
+// Each statement runs exactly as if it had been sent on its own line, so statements
+// after a BEGIN share the session's transaction. Execution stops at the first
+// statement that fails; its error response is the last one returned.
+func (s *Server) executeBatch(session *Session, statements []string) []QueryResponse {
+	responses := make([]QueryResponse, 0, len(statements))
+	for _, statement := range statements {
+		response := s.executeQuery(session, statement)
+		responses = append(responses, response)
+		if response.Error != "" {
+			break
+		}
+	}
+	return responses
+}
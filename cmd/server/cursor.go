@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/yashagw/cranedb/internal/parse"
+	"github.com/yashagw/cranedb/internal/plan"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+const (
+	declareUsage = "usage: DECLARE <cursor> CURSOR FOR <query>"
+	fetchUsage   = "usage: FETCH <count> FROM <cursor>"
+	closeUsage   = "usage: CLOSE CURSOR <cursor>"
+)
+
+// A cursor is a query of a session whose scan stays open between statements, so that its
+// rows can be fetched a few at a time. It has a transaction of its own, at repeatable read,
+// which keeps the shared locks of the blocks it has read until the cursor is closed: the
+// rows already fetched can't change or move, and no row is skipped or fetched twice.
+type cursor struct {
+	tx      *transaction.Transaction
+	plan    plan.Plan
+	scan    scan.Scan
+	columns []string
+	// done is set once the scan has run out of rows, after which it must not be read again
+	done bool
+}
+
+// close closes the cursor's scan and ends its transaction. Only rows were read in it, so
+// it is committed unless rollback is set, after an error.
+func (c *cursor) close(rollback bool) error {
+	c.scan.Close()
+	if rollback {
+		return c.tx.Rollback()
+	}
+	return c.tx.Commit()
+}
+
+// cursorCommand returns the first word of a DECLARE, FETCH or CLOSE statement in lowercase,
+// or "" for any other statement.
+func cursorCommand(sql string) string {
+	fields := strings.Fields(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(sql), ";")))
+	if len(fields) > 0 && (fields[0] == "declare" || fields[0] == "fetch" || fields[0] == "close") {
+		return fields[0]
+	}
+	return ""
+}
+
+// runCursorStatement runs a DECLARE, FETCH or CLOSE statement for the session.
+func (s *Server) runCursorStatement(session *Session, command string, sql string) QueryResponse {
+	switch command {
+	case "declare":
+		name, query, ok := parseDeclare(sql)
+		if !ok {
+			return QueryResponse{Type: "error", Error: declareUsage}
+		}
+		return s.declareCursor(session, name, query)
+	case "fetch":
+		count, name, ok := parseFetch(sql)
+		if !ok {
+			return QueryResponse{Type: "error", Error: fetchUsage}
+		}
+		return s.fetchCursor(session, name, count)
+	default:
+		name, ok := parseCloseCursor(sql)
+		if !ok {
+			return QueryResponse{Type: "error", Error: closeUsage}
+		}
+		return s.closeCursor(session, name)
+	}
+}
+
+// parseDeclare reads a DECLARE <cursor> CURSOR FOR <query> statement. Like a table name, the
+// cursor's name is read in lowercase unless it is quoted.
+func parseDeclare(sql string) (name string, query string, ok bool) {
+	rest := strings.TrimSpace(sql)
+	words := make([]string, 4)
+	for i := range words {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return "", "", false
+		}
+		words[i], rest = rest[:end], strings.TrimSpace(rest[end:])
+	}
+	if !strings.EqualFold(words[2], "cursor") || !strings.EqualFold(words[3], "for") || !isQuery(rest) {
+		return "", "", false
+	}
+	name, ok = tableArgument(words[1], 0)
+	return name, rest, ok
+}
+
+// parseFetch reads a FETCH <count> FROM <cursor> statement.
+func parseFetch(sql string) (count int, name string, ok bool) {
+	lexer := parse.NewLexer(sql)
+	lexer.EatId()
+	count, err := lexer.EatIntConstant()
+	if err != nil || count < 0 {
+		return 0, "", false
+	}
+	if err := lexer.EatKeyword("from"); err != nil {
+		return 0, "", false
+	}
+	name, err = lexer.EatId()
+	if err != nil {
+		return 0, "", false
+	}
+	if lexer.MatchDelim(';') {
+		lexer.EatDelim(';')
+	}
+	return count, name, lexer.AtEnd()
+}
+
+// parseCloseCursor reads a CLOSE CURSOR <cursor> statement.
+func parseCloseCursor(sql string) (string, bool) {
+	lexer := parse.NewLexer(sql)
+	lexer.EatId()
+	word, err := lexer.EatId()
+	if err != nil || word != "cursor" {
+		return "", false
+	}
+	return tableArgument(sql, 2)
+}
+
+// declareCursor opens a query as a cursor of the session, positioned before its first row.
+func (s *Server) declareCursor(session *Session, name string, sql string) QueryResponse {
+	if session.InTransaction() {
+		// The cursor's transaction would wait for the locks of the session's own
+		return QueryResponse{Type: "error", Error: "a cursor can't be declared inside a transaction"}
+	}
+	if _, exists := session.cursors[name]; exists {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("cursor %s already exists", name)}
+	}
+
+	tx := transaction.NewTransactionWithIsolation(s.fileManager, s.logManager, s.bufferManager, s.lockTable, transaction.RepeatableRead)
+	stopTimeout := startTimeout(tx, session.queryTimeout)
+	queryPlan, queryScan, err := s.openQuery(session, tx, sql)
+	stopTimeout()
+	if err != nil {
+		if err := tx.Rollback(); err != nil {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+		return QueryResponse{Type: "error", Error: err.Error()}
+	}
+	session.cursors[name] = &cursor{
+		tx:      tx,
+		plan:    queryPlan,
+		scan:    queryScan,
+		columns: queryPlan.Schema().Fields(),
+	}
+	log.Printf("Cursor %s declared: %s", name, previewQuery(sql))
+	return QueryResponse{Type: "cursor", Message: "DECLARE CURSOR " + name}
+}
+
+// fetchCursor returns the next rows of a cursor of the session, up to count of them. Once the
+// cursor's rows run out, it returns no rows. A cursor whose read fails is closed.
+func (s *Server) fetchCursor(session *Session, name string, count int) QueryResponse {
+	c, exists := session.cursors[name]
+	if !exists {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("cursor %s does not exist", name)}
+	}
+
+	rows, err := s.fetchRows(session, c, count)
+	if err != nil {
+		delete(session.cursors, name)
+		if err := c.close(true); err != nil {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+		return QueryResponse{Type: "error", Error: err.Error() + " (cursor closed)"}
+	}
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: c.columns,
+	}
+}
+
+// fetchRows reads up to count rows of the cursor.
+func (s *Server) fetchRows(session *Session, c *cursor, count int) ([]map[string]interface{}, error) {
+	defer startTimeout(c.tx, session.queryTimeout)()
+
+	rows := []map[string]interface{}{}
+	for !c.done && len(rows) < count {
+		hasNext, err := c.scan.Next()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read next record: %w", err)
+		}
+		if !hasNext {
+			c.done = true
+			break
+		}
+		if err := s.checkRowCount(len(rows) + 1); err != nil {
+			return nil, err
+		}
+		values, err := readRow(c.scan, c.plan.Schema(), c.columns)
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for i, col := range c.columns {
+			row[col] = values[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// closeCursor closes a cursor of the session, releasing its locks.
+func (s *Server) closeCursor(session *Session, name string) QueryResponse {
+	c, exists := session.cursors[name]
+	if !exists {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("cursor %s does not exist", name)}
+	}
+	delete(session.cursors, name)
+	if err := c.close(false); err != nil {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("Failed to commit transaction: %v", err)}
+	}
+	return QueryResponse{Type: "cursor", Message: "CLOSE CURSOR " + name}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// exportUsage is the error of an EXPORT statement that can't be read
+const exportUsage = "usage: EXPORT <table|query> TO CSV"
+
+// parseExport reads an EXPORT <table|query> TO CSV statement, and returns the table or query
+// to export. ok is false if the statement isn't an EXPORT; source is empty if it is one
+// without a table or query to export.
+func parseExport(sql string) (source string, ok bool) {
+	rest := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	fields := strings.Fields(rest)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "export") {
+		return "", false
+	}
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+
+	// The source ends with the last two words, which must be TO CSV
+	for _, word := range []string{"csv", "to"} {
+		if len(rest) < len(word) || !strings.EqualFold(rest[len(rest)-len(word):], word) {
+			return "", true
+		}
+		rest = rest[:len(rest)-len(word)]
+		if rest != "" && !unicode.IsSpace(rune(rest[len(rest)-1])) {
+			return "", true
+		}
+		rest = strings.TrimSpace(rest)
+	}
+	return rest, true
+}
+
+// exportQuery returns the query that reads the rows of an export's source: the source itself
+// if it is a query, or a query of every field of the table it names.
+func (s *Server) exportQuery(tx *transaction.Transaction, source string) (string, error) {
+	if isQuery(source) {
+		return source, nil
+	}
+	tableName, ok := tableArgument(source, 0)
+	if !ok {
+		return "", errors.New(exportUsage)
+	}
+	layout, err := s.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return "", err
+	}
+	fields := layout.GetSchema().Fields()
+	if len(fields) == 0 {
+		return "", fmt.Errorf("table %s has no fields to export", tableName)
+	}
+	quoted := make([]string, len(fields))
+	for i, field := range fields {
+		quoted[i] = query.QuoteIdentifier(field)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), query.QuoteIdentifier(tableName)), nil
+}
+
+// exportCSV runs an EXPORT statement for the session and sends the rows as CSV while they are
+// read, like a streamed query. It answers with:
+//   - a "csv" response holding the columns,
+//   - the CSV text: a header row with the columns, then one record per row,
+//   - an "end" response, or an "error" response if the export failed part way.
+//
+// Every quote in the CSV text either encloses a field or is doubled, so no line of it can
+// start with {"type": like the response that ends it.
+func (s *Server) exportCSV(session *Session, sql string, writer *bufio.Writer) QueryResponse {
+	queryPreview := previewQuery(sql)
+	log.Printf("Exporting: %s", queryPreview)
+
+	source, _ := parseExport(sql)
+	if source == "" {
+		return QueryResponse{Type: "error", Error: exportUsage}
+	}
+	return s.runInTransaction(session, queryPreview, func(tx *transaction.Transaction) (QueryResponse, error) {
+		return s.exportRows(session, tx, source, writer)
+	})
+}
+
+// exportRows writes the csv response and the rows of the export's source as CSV.
+func (s *Server) exportRows(session *Session, tx *transaction.Transaction, source string, writer *bufio.Writer) (QueryResponse, error) {
+	defer startTimeout(tx, session.queryTimeout)()
+
+	sql, err := s.exportQuery(tx, source)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	queryPlan, queryScan, err := s.openQuery(session, tx, sql)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	defer queryScan.Close()
+
+	columns := queryPlan.Schema().Fields()
+	writeResponse(writer, QueryResponse{Type: "csv", Columns: columns})
+	// Records are only ever left whole in the CSV writer, so flushing it on the way out
+	// ends the CSV text before the end or error response, whichever follows
+	csvWriter := csv.NewWriter(writer)
+	defer csvWriter.Flush()
+	csvWriter.Write(columns)
+	record := make([]string, len(columns))
+	for count := 1; ; count++ {
+		hasNext, err := queryScan.Next()
+		if err != nil {
+			err = fmt.Errorf("Failed to read next record: %w", err)
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		if !hasNext {
+			break
+		}
+		if err := s.checkRowCount(count); err != nil {
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		values, err := readRow(queryScan, queryPlan.Schema(), columns)
+		if err != nil {
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		for i, value := range values {
+			if n, ok := value.(int); ok {
+				record[i] = strconv.Itoa(n)
+			} else {
+				record[i] = value.(string)
+			}
+		}
+		if err := csvWriter.Write(record); err != nil {
+			// The client is gone, so there is no one to send the rest to
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+	}
+	return QueryResponse{Type: "end"}, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/yashagw/cranedb/internal/parse"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+const (
+	// importUsage is the error of an IMPORT statement that can't be read
+	importUsage = "usage: IMPORT INTO <table> FROM CSV"
+	// endOfCSV is the line that ends the CSV text a client sends for an import
+	endOfCSV = `\.`
+)
+
+// parseImport reads an IMPORT INTO <table> FROM CSV statement, and returns the table to import
+// into. ok is false if the statement isn't an IMPORT; tableName is empty if it is one that
+// can't be read.
+func parseImport(sql string) (tableName string, ok bool) {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "import") {
+		return "", false
+	}
+
+	lexer := parse.NewLexer(sql)
+	lexer.EatId()
+	if err := lexer.EatKeyword("into"); err != nil {
+		return "", true
+	}
+	tableName, err := lexer.EatId()
+	if err != nil {
+		return "", true
+	}
+	if err := lexer.EatKeyword("from"); err != nil {
+		return "", true
+	}
+	if format, err := lexer.EatId(); err != nil || format != "csv" {
+		return "", true
+	}
+	if lexer.MatchDelim(';') {
+		lexer.EatDelim(';')
+	}
+	if !lexer.AtEnd() {
+		return "", true
+	}
+	return tableName, true
+}
+
+// csvData reads the CSV text a client sends for an import, line by line up to the line
+// holding only endOfCSV. A quoted field can't hold that line.
+type csvData struct {
+	scanner *bufio.Scanner
+	pending []byte
+	done    bool
+	err     error
+}
+
+// Read reads the CSV text, returning io.EOF at its end, or an error if the connection
+// closed before it.
+func (d *csvData) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.done {
+			if d.err != nil {
+				return 0, d.err
+			}
+			return 0, io.EOF
+		}
+		if !d.scanner.Scan() {
+			d.done = true
+			d.err = errors.New("connection closed before the end of the CSV data")
+			if err := d.scanner.Err(); err != nil {
+				d.err = fmt.Errorf("failed to read CSV data: %w", err)
+			}
+			continue
+		}
+		if d.scanner.Text() == endOfCSV {
+			d.done = true
+			continue
+		}
+		d.pending = append([]byte(d.scanner.Text()), '\n')
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+// drain skips the rest of the CSV text, so that an import that failed part way reads its
+// response's statement from the line after it.
+func (d *csvData) drain() {
+	for !d.done {
+		if !d.scanner.Scan() || d.scanner.Text() == endOfCSV {
+			d.done = true
+		}
+	}
+	d.pending = nil
+}
+
+// importCSV runs an IMPORT statement for the session, loading the CSV text the client sends
+// into a table with the bulk loader, like COPY. The exchange is:
+//   - the server answers with an "import" response holding the columns of the table,
+//   - the client sends the CSV text: a header row naming the fields it holds values for,
+//     then one record per row, then a line holding only \.
+//   - the server answers with an "update" response holding the number of rows imported,
+//     or an "error" response.
+//
+// A statement that fails before the "import" response, such as one naming a missing table,
+// is answered with only its error, and the client sends no CSV text.
+func (s *Server) importCSV(session *Session, sql string, scanner *bufio.Scanner, writer *bufio.Writer) QueryResponse {
+	queryPreview := previewQuery(sql)
+	log.Printf("Importing: %s", queryPreview)
+
+	tableName, _ := parseImport(sql)
+	if tableName == "" {
+		return QueryResponse{Type: "error", Error: importUsage}
+	}
+	return s.runInTransaction(session, queryPreview, func(tx *transaction.Transaction) (QueryResponse, error) {
+		return s.importRows(session, tx, tableName, scanner, writer)
+	})
+}
+
+// importRows writes the import response and loads the CSV text that follows into the table.
+func (s *Server) importRows(session *Session, tx *transaction.Transaction, tableName string, scanner *bufio.Scanner, writer *bufio.Writer) (QueryResponse, error) {
+	defer startTimeout(tx, session.queryTimeout)()
+
+	layout, err := s.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	writeResponse(writer, QueryResponse{Type: "import", Columns: layout.GetSchema().Fields()})
+
+	data := &csvData{scanner: scanner}
+	defer data.drain()
+	reader := csv.NewReader(data)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return QueryResponse{Type: "update"}, nil
+	}
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	count, err := s.updatePlanner.LoadCSV(tableName, header, reader, tx)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	return QueryResponse{Type: "update", Affected: count}, nil
+}
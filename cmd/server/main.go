@@ -2,20 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
 	dblog "github.com/yashagw/cranedb/internal/log"
 	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/parse"
 	"github.com/yashagw/cranedb/internal/plan"
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
@@ -24,6 +36,18 @@ const (
 	DefaultDBDir      = "./cranedb_data"
 	DefaultBlockSize  = 400
 	DefaultBufferSize = 20
+	ShutdownTimeout   = 30 * time.Second
+	// QueryCacheSize is how many parsed queries the server keeps for queries run again
+	QueryCacheSize = 256
+	// DefaultLogSegmentSize is the size in bytes of each file the log of a new database is
+	// split into
+	DefaultLogSegmentSize = 1 << 20
+
+	// DeadlockRetries is how many times a statement that lost a deadlock, by giving up a lock
+	// wait, is run again, waiting DeadlockRetryBackoff before the first retry and twice as
+	// long before each next one
+	DeadlockRetries      = 3
+	DeadlockRetryBackoff = 50 * time.Millisecond
 )
 
 type Server struct {
@@ -33,6 +57,23 @@ type Server struct {
 	lockTable       *transaction.LockTable
 	metadataManager *metadata.Manager
 	planner         *plan.Planner
+	queryPlanner    *plan.BasicQueryPlanner
+	updatePlanner   *plan.BasicUpdatePlanner
+	queryCache      *plan.QueryCache
+	// maxRows bounds the rows a query may return or hold in memory, or is 0 for no limit
+	maxRows int
+	// queryTimeout is the query timeout sessions start with, or 0 to never cancel statements
+	queryTimeout time.Duration
+	// users maps each user to its password, or is nil to accept connections without AUTH
+	users map[string]string
+	// authTimeout is how long a connection has to authenticate when users is set
+	authTimeout time.Duration
+
+	mu           sync.Mutex
+	listener     net.Listener
+	conns        map[net.Conn]struct{}
+	connWG       sync.WaitGroup
+	shuttingDown bool
 }
 
 type QueryResponse struct {
@@ -40,10 +81,61 @@ type QueryResponse struct {
 	Rows     []map[string]interface{} `json:"rows,omitempty"`
 	Columns  []string                 `json:"columns,omitempty"`
 	Affected int                      `json:"affected,omitempty"`
+	RIDs     []RIDResponse            `json:"rids,omitempty"`
+	Message  string                   `json:"message,omitempty"`
 	Error    string                   `json:"error,omitempty"`
+	// ElapsedMs is the time the server took to run the statement, in milliseconds
+	ElapsedMs float64 `json:"elapsed_ms,omitempty"`
+	// BlocksAccessed is the number of blocks the statement read or wrote, whether they were
+	// in the buffer pool or not
+	BlocksAccessed int `json:"blocks_accessed,omitempty"`
+	// Version is the protocol version the connection uses, in the answer to VERSION
+	Version int `json:"version,omitempty"`
+}
+
+// MarshalJSON writes the columns and rows of a query result even when there are none, so that a
+// result of rows without columns (SELECT FROM t) still has both. The columns of a streamed result,
+// an export or an import are always written too.
+func (r QueryResponse) MarshalJSON() ([]byte, error) {
+	// response has the fields of QueryResponse but not this method, so marshalling it doesn't recurse
+	type response QueryResponse
+	columns := r.Columns
+	if columns == nil {
+		columns = []string{}
+	}
+	switch r.Type {
+	case "query":
+		rows := r.Rows
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		return json.Marshal(struct {
+			response
+			Rows    []map[string]interface{} `json:"rows"`
+			Columns []string                 `json:"columns"`
+		}{response(r), rows, columns})
+	case "stream", "csv", "import":
+		return json.Marshal(struct {
+			response
+			Columns []string `json:"columns"`
+		}{response(r), columns})
+	}
+	return json.Marshal(response(r))
+}
+
+// RIDResponse identifies a record by its block number and slot within the block.
+type RIDResponse struct {
+	Block int `json:"block"`
+	Slot  int `json:"slot"`
 }
 
 func NewServer(dbDir string) (*Server, error) {
+	return newServer(dbDir, DefaultLogSegmentSize)
+}
+
+// newServer opens the database in dbDir, creating it if it doesn't exist. The log of a new
+// database is split into files of logSegmentSize bytes, or kept in one file if it is 0.
+func newServer(dbDir string, logSegmentSize int) (*Server, error) {
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
@@ -53,7 +145,11 @@ func NewServer(dbDir string) (*Server, error) {
 		return nil, fmt.Errorf("failed to create file manager: %w", err)
 	}
 
-	lm, err := dblog.NewManager(fm, "cranedb.log")
+	if err := metadata.CheckFormat(fm); err != nil {
+		return nil, err
+	}
+
+	lm, err := dblog.NewSegmentedManager(fm, "cranedb.log", logSegmentSize/DefaultBlockSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log manager: %w", err)
 	}
@@ -76,6 +172,9 @@ func NewServer(dbDir string) (*Server, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform recovery: %w", err)
 	}
+	if err := fm.RemoveTempFiles(); err != nil {
+		return nil, err
+	}
 
 	md := metadata.NewManager(isNew, tx)
 	if err := tx.Commit(); err != nil {
@@ -85,6 +184,8 @@ func NewServer(dbDir string) (*Server, error) {
 	queryPlanner := plan.NewBasicQueryPlanner(md)
 	updatePlanner := plan.NewBasicUpdatePlanner(md)
 	planner := plan.NewPlanner(queryPlanner, updatePlanner)
+	queryCache := plan.NewQueryCache(QueryCacheSize)
+	planner.SetQueryCache(queryCache)
 
 	return &Server{
 		fileManager:     fm,
@@ -93,13 +194,168 @@ func NewServer(dbDir string) (*Server, error) {
 		lockTable:       lockTable,
 		metadataManager: md,
 		planner:         planner,
+		queryPlanner:    queryPlanner,
+		updatePlanner:   updatePlanner,
+		queryCache:      queryCache,
+		authTimeout:     DefaultAuthTimeout,
+		conns:           make(map[net.Conn]struct{}),
 	}, nil
 }
 
+// setMaxRows makes queries that would return more than maxRows rows, or hold more than
+// maxRows groups or rows to sort in memory, fail with "result too large". 0 removes the limit.
+func (s *Server) setMaxRows(maxRows int) {
+	s.maxRows = maxRows
+	s.queryPlanner.SetMaxRows(maxRows)
+}
+
+// setMaxLockWait makes statements give up waiting for a lock, with transaction.ErrLockAbort,
+// after maxLockWait rather than transaction.MAX_WAITING_TIME.
+func (s *Server) setMaxLockWait(maxLockWait time.Duration) {
+	s.lockTable.SetMaxWaitingTime(maxLockWait)
+}
+
+// checkRowCount returns query.ErrResultTooLarge once a query has read more rows than the limit
+func (s *Server) checkRowCount(count int) error {
+	if s.maxRows > 0 && count > s.maxRows {
+		return fmt.Errorf("%w: more than %d rows", query.ErrResultTooLarge, s.maxRows)
+	}
+	return nil
+}
+
+// Serve accepts connections on the listener and handles each one in its own goroutine.
+// It returns once the listener has been closed.
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		listener.Close()
+		return net.ErrClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			log.Printf("Error accepting connection: %v", err)
+			continue
+		}
+
+		if !s.trackConnection(conn) {
+			conn.Close()
+			continue
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// trackConnection registers a new connection so Shutdown can wait for it.
+// It returns false if the server is shutting down.
+func (s *Server) trackConnection(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.shuttingDown {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.connWG.Add(1)
+	return true
+}
+
+// untrackConnection removes a connection registered by trackConnection.
+func (s *Server) untrackConnection(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.connWG.Done()
+}
+
+// isShuttingDown returns true once Shutdown has been called.
+func (s *Server) isShuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shuttingDown
+}
+
+// Shutdown stops accepting connections, lets each connection finish the statement
+// it is running, and closes it, rolling back any transaction it left open.
+// Once every connection is closed, it saves the table statistics, flushes all
+// buffers and the log, writes a checkpoint so the next start has no recovery work
+// to do, and closes the files.
+// If ctx ends first, Shutdown returns its error and leaves the files as they are;
+// recovery on the next start then undoes any unfinished transactions.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	// Wake connections waiting for their next statement; a statement in
+	// progress still runs to completion and sends its response.
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.connWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Save the table statistics so the next start doesn't rescan the tables
+	tx := transaction.NewTransaction(s.fileManager, s.logManager, s.bufferManager, s.lockTable)
+	if err := s.metadataManager.SaveStats(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stats: %w", err)
+	}
+
+	if err := s.bufferManager.FlushAllBuffers(); err != nil {
+		return fmt.Errorf("failed to flush buffers: %w", err)
+	}
+	// No transaction is active any more and no buffer is dirty, so a checkpoint
+	// tells recovery that everything before it is finished.
+	if err := transaction.Checkpoint(s.logManager, s.bufferManager); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := s.logManager.Close(); err != nil {
+		return fmt.Errorf("failed to flush log: %w", err)
+	}
+	s.fileManager.Close()
+	return nil
+}
+
 func (s *Server) handleConnection(conn net.Conn) {
 	remoteAddr := conn.RemoteAddr().String()
 	log.Printf("New connection from %s", remoteAddr)
+	session := NewSession()
+	session.queryTimeout = s.queryTimeout
+	defer s.untrackConnection(conn)
 	defer func() {
+		if err := session.closeCursors(); err != nil {
+			log.Printf("Error closing cursors for %s: %v", remoteAddr, err)
+		}
+		// A transaction left open by the client is rolled back on disconnect
+		if session.InTransaction() {
+			if err := session.tx.Rollback(); err != nil {
+				log.Printf("Error rolling back transaction for %s: %v", remoteAddr, err)
+			}
+			session.tx = nil
+		}
 		conn.Close()
 		log.Printf("Connection closed from %s", remoteAddr)
 	}()
@@ -107,13 +363,26 @@ func (s *Server) handleConnection(conn net.Conn) {
 	scanner := bufio.NewScanner(conn)
 	writer := bufio.NewWriter(conn)
 
+	if s.users != nil {
+		user, ok := s.authenticate(session, conn, scanner, writer)
+		if !ok {
+			log.Printf("Authentication failed for %s", remoteAddr)
+			return
+		}
+		log.Printf("%s authenticated as %s", remoteAddr, user)
+	}
+
 	for {
 		if !scanner.Scan() {
-			if err := scanner.Err(); err != nil && err != io.EOF {
+			if err := scanner.Err(); err != nil && err != io.EOF && !s.isShuttingDown() {
 				log.Printf("Error reading from client %s: %v", remoteAddr, err)
 			}
 			break
 		}
+		// Don't start new statements once shutdown has begun
+		if s.isShuttingDown() {
+			break
+		}
 
 		query := strings.TrimSpace(scanner.Text())
 		if query == "" {
@@ -125,31 +394,134 @@ func (s *Server) handleConnection(conn net.Conn) {
 			writer.Flush()
 			break
 		}
+		if response, ok := controlCommand(session, query); ok {
+			writeResponse(writer, response)
+			continue
+		}
 
-		response := s.executeQuery(query)
-
-		jsonData, err := json.Marshal(response)
-		if err != nil {
-			errorResp := QueryResponse{
-				Type:  "error",
-				Error: fmt.Sprintf("Failed to serialize response: %v", err),
-			}
-			jsonData, _ = json.Marshal(errorResp)
+		// A message holding several statements is a batch, answered with an array of responses
+		var response interface{}
+		if statements := splitStatements(query); len(statements) > 1 {
+			response = s.executeBatch(session, statements)
+		} else if session.streamRows && isQuery(query) {
+			// The rows are sent as they are read, and the response ends the stream
+			response = s.streamQuery(session, query, writer)
+		} else if _, ok := parseExport(query); ok {
+			// The CSV text is sent as the rows are read, and the response ends it
+			response = s.exportCSV(session, query, writer)
+		} else if _, ok := parseImport(query); ok {
+			// The client sends the CSV text after the import response
+			response = s.importCSV(session, query, scanner, writer)
+		} else {
+			response = s.executeQuery(session, query)
 		}
 
-		writer.Write(jsonData)
-		writer.WriteString("\n")
-		writer.Flush()
+		writeResponse(writer, response)
 	}
 }
 
-func (s *Server) executeQuery(sql string) QueryResponse {
-	queryPreview := sql
-	if len(queryPreview) > 100 {
-		queryPreview = queryPreview[:100] + "..."
+// writeResponse sends a response to the client as a line of JSON.
+func writeResponse(writer *bufio.Writer, response interface{}) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		errorResp := QueryResponse{
+			Type:  "error",
+			Error: fmt.Sprintf("Failed to serialize response: %v", err),
+		}
+		jsonData, _ = json.Marshal(errorResp)
 	}
+
+	writer.Write(jsonData)
+	writer.WriteString("\n")
+	writer.Flush()
+}
+
+// executeQuery runs a single statement for the session.
+// BEGIN, COMMIT and ROLLBACK control the session's explicit transaction, SET and
+// SHOW change and read the session's settings, and DECLARE, FETCH and CLOSE work with its
+// cursors. Any other statement runs inside the open transaction if there is one,
+// otherwise in a fresh transaction that is committed on success, and that is run again a few
+// times if it loses a deadlock. Deadlocks aren't detected: a statement loses one when a lock
+// wait times out with transaction.ErrLockAbort, whether or not it was in a deadlock. The
+// response to such a statement tells how long it took and how many blocks it accessed.
+func (s *Server) executeQuery(session *Session, sql string) QueryResponse {
+	queryPreview := previewQuery(sql)
 	log.Printf("Executing query: %s", queryPreview)
-	tx := transaction.NewTransaction(s.fileManager, s.logManager, s.bufferManager, s.lockTable)
+
+	command := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	switch strings.Join(strings.Fields(command), " ") {
+	case "begin":
+		return s.begin(session)
+	case "commit":
+		return s.commit(session)
+	case "rollback":
+		return s.rollback(session)
+	}
+	if name, value, ok := parseSet(sql); ok {
+		return s.set(session, name, value)
+	}
+	if name, ok := isShowSettings(sql); ok {
+		return s.showSettings(session, name)
+	}
+	if command := cursorCommand(sql); command != "" {
+		return s.runCursorStatement(session, command, sql)
+	}
+
+	// A statement run in a transaction of its own that gave up a lock wait lost a
+	// deadlock and was rolled back, so it can be run again from the start. One run in
+	// an explicit transaction can't: the statements before it were rolled back too.
+	retry := !session.InTransaction()
+	backoff := DeadlockRetryBackoff
+	start := time.Now()
+	blocks := 0
+	for attempt := 0; ; attempt++ {
+		var err error
+		response := s.runInTransaction(session, queryPreview, func(tx *transaction.Transaction) (QueryResponse, error) {
+			var response QueryResponse
+			before := tx.BlocksAccessed()
+			response, err = s.runStatement(session, tx, sql)
+			blocks += tx.BlocksAccessed() - before
+			return response, err
+		})
+		if !retry || attempt == DeadlockRetries || !errors.Is(err, transaction.ErrLockAbort) {
+			// The cost of a statement that was retried includes its attempts that lost
+			response.ElapsedMs = float64(time.Since(start).Microseconds()) / 1000
+			response.BlocksAccessed = blocks
+			return response
+		}
+		log.Printf("Retrying query after a lock abort: %s", queryPreview)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// previewQuery shortens a statement for the log.
+func previewQuery(sql string) string {
+	if len(sql) > 100 {
+		return sql[:100] + "..."
+	}
+	return sql
+}
+
+// runInTransaction runs a statement inside the session's open transaction if there is one,
+// otherwise in a fresh transaction that is committed once run returns without an error.
+func (s *Server) runInTransaction(session *Session, queryPreview string, run func(tx *transaction.Transaction) (QueryResponse, error)) QueryResponse {
+	if session.InTransaction() {
+		response, err := run(session.tx)
+		// A lock abort means we may be waiting in a deadlock, so give up the
+		// whole transaction and release its locks. A statement that timed out
+		// gives up the transaction as well, since it may have made partial changes.
+		if errors.Is(err, transaction.ErrLockAbort) || errors.Is(err, transaction.ErrCanceled) {
+			if err := session.tx.Rollback(); err != nil {
+				log.Printf("Error rolling back transaction: %v", err)
+			}
+			session.tx = nil
+			response.Error += " (transaction rolled back)"
+		}
+		return response
+	}
+
+	tx := session.newTransaction(s)
 	committed := false
 	defer func() {
 		if !committed {
@@ -162,115 +534,424 @@ func (s *Server) executeQuery(sql string) QueryResponse {
 		}
 	}()
 
-	// Check if it's a SELECT query by looking at the first keyword
-	// This avoids parsing the SQL twice (once here, once in planner methods)
-	trimmedSQL := strings.TrimSpace(strings.ToLower(sql))
-	isQuery := strings.HasPrefix(trimmedSQL, "select")
+	response, err := run(tx)
+	if err != nil {
+		return response
+	}
 
-	if isQuery {
-		queryPlan, err := s.planner.CreatePlan(sql, tx)
-		if err != nil {
-			return QueryResponse{
-				Type:  "error",
-				Error: err.Error(),
-			}
+	if err := tx.Commit(); err != nil {
+		return QueryResponse{
+			Type:  "error",
+			Error: fmt.Sprintf("Failed to commit transaction: %v", err),
 		}
+	}
+	committed = true
 
-		queryScan, err := queryPlan.Open()
-		if err != nil {
-			return QueryResponse{
-				Type:  "error",
-				Error: fmt.Sprintf("Failed to open query plan: %v", err),
-			}
+	return response
+}
+
+// begin opens an explicit transaction for the session.
+func (s *Server) begin(session *Session) QueryResponse {
+	if session.InTransaction() {
+		return QueryResponse{
+			Type:  "error",
+			Error: "transaction already in progress",
 		}
-		defer queryScan.Close()
-		err = queryScan.BeforeFirst()
-		if err != nil {
-			return QueryResponse{
-				Type:  "error",
-				Error: fmt.Sprintf("Failed to position scan: %v", err),
-			}
+	}
+	session.tx = session.newTransaction(s)
+	return QueryResponse{
+		Type:    "transaction",
+		Message: "BEGIN",
+	}
+}
+
+// commit commits the session's explicit transaction.
+func (s *Server) commit(session *Session) QueryResponse {
+	if !session.InTransaction() {
+		return QueryResponse{
+			Type:  "error",
+			Error: "no transaction in progress",
 		}
+	}
+	tx := session.tx
+	session.tx = nil
+	if err := tx.Commit(); err != nil {
+		return QueryResponse{
+			Type:  "error",
+			Error: fmt.Sprintf("Failed to commit transaction: %v", err),
+		}
+	}
+	return QueryResponse{
+		Type:    "transaction",
+		Message: "COMMIT",
+	}
+}
 
-		schema := queryPlan.Schema()
-		columns := append([]string{}, schema.Fields()...)
+// rollback rolls back the session's explicit transaction.
+func (s *Server) rollback(session *Session) QueryResponse {
+	if !session.InTransaction() {
+		return QueryResponse{
+			Type:  "error",
+			Error: "no transaction in progress",
+		}
+	}
+	tx := session.tx
+	session.tx = nil
+	if err := tx.Rollback(); err != nil {
+		return QueryResponse{
+			Type:  "error",
+			Error: fmt.Sprintf("Failed to rollback transaction: %v", err),
+		}
+	}
+	return QueryResponse{
+		Type:    "transaction",
+		Message: "ROLLBACK",
+	}
+}
+
+// runStatement executes a query or update statement within the given transaction.
+// It does not commit or roll back the transaction. On failure it returns both the
+// error response for the client and the underlying error.
+// A statement running longer than the query timeout fails with transaction.ErrCanceled.
+func (s *Server) runStatement(session *Session, tx *transaction.Transaction, sql string) (QueryResponse, error) {
+	defer startTimeout(tx, session.queryTimeout)()
+
+	words := strings.Fields(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(sql), ";")))
+	if len(words) == 2 && words[0] == "show" && words[1] == "tables" {
+		return s.showTables(tx)
+	}
+	if len(words) > 0 && words[0] == "describe" {
+		tableName, ok := tableArgument(sql, 1)
+		if !ok {
+			err := errors.New("usage: DESCRIBE <table>")
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		return s.describeTable(tx, tableName)
+	}
+	if len(words) > 0 && (words[0] == "export" || words[0] == "import") {
+		// Only a statement sent alone can exchange CSV text with the client
+		err := fmt.Errorf("%s must be sent on its own, not in a batch", strings.ToUpper(words[0]))
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	if len(words) >= 2 && words[0] == "dump" && words[1] == "block" {
+		tableName, blockNum, ok := dumpBlockArguments(sql)
+		if !ok {
+			err := errors.New("usage: DUMP BLOCK <table> <block number>")
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		return s.dumpBlock(tx, tableName, blockNum)
+	}
+	if len(words) == 2 && words[0] == "show" && words[1] == "txstats" {
+		return s.showTxStats()
+	}
+	if len(words) >= 2 && words[0] == "show" && words[1] == "stats" {
+		tableName, ok := tableArgument(sql, 2)
+		if !ok {
+			err := errors.New("usage: SHOW STATS <table>")
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		return s.showStats(tx, tableName)
+	}
+
+	if isQuery(sql) {
+		queryPlan, queryScan, err := s.openQuery(session, tx, sql)
+		if err != nil {
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		defer queryScan.Close()
 
+		columns := queryPlan.Schema().Fields()
 		rows := []map[string]interface{}{}
 		for {
 			hasNext, err := queryScan.Next()
 			if err != nil {
-				queryScan.Close()
-				return QueryResponse{
-					Type:  "error",
-					Error: fmt.Sprintf("Failed to read next record: %v", err),
-				}
+				err = fmt.Errorf("Failed to read next record: %w", err)
+				return QueryResponse{Type: "error", Error: err.Error()}, err
 			}
 			if !hasNext {
 				break
 			}
+			if err := s.checkRowCount(len(rows) + 1); err != nil {
+				return QueryResponse{Type: "error", Error: err.Error()}, err
+			}
+			values, err := readRow(queryScan, queryPlan.Schema(), columns)
+			if err != nil {
+				return QueryResponse{Type: "error", Error: err.Error()}, err
+			}
 			row := make(map[string]interface{})
-			for _, col := range columns {
-				if schema.Type(col) == "int" {
-					val, err := queryScan.GetInt(col)
-					if err != nil {
-						queryScan.Close()
-						return QueryResponse{
-							Type:  "error",
-							Error: fmt.Sprintf("Failed to get int value for column %s: %v", col, err),
-						}
-					}
-					row[col] = val
-				} else {
-					val, err := queryScan.GetString(col)
-					if err != nil {
-						queryScan.Close()
-						return QueryResponse{
-							Type:  "error",
-							Error: fmt.Sprintf("Failed to get string value for column %s: %v", col, err),
-						}
-					}
-					row[col] = val
-				}
+			for i, col := range columns {
+				row[col] = values[i]
 			}
 			rows = append(rows, row)
 		}
 
-		if err := tx.Commit(); err != nil {
-			return QueryResponse{
-				Type:  "error",
-				Error: fmt.Sprintf("Failed to commit transaction: %v", err),
-			}
-		}
-		committed = true
-
 		return QueryResponse{
 			Type:    "query",
 			Rows:    rows,
 			Columns: columns,
-		}
+		}, nil
 	}
 
-	count, err := s.planner.ExecuteUpdate(sql, tx)
+	count, rids, err := s.planner.ExecuteUpdateWithRIDs(sql, tx)
 	if err != nil {
 		log.Printf("Error executing update: %v", err)
 		return QueryResponse{
 			Type:  "error",
 			Error: err.Error(),
+		}, err
+	}
+
+	response := QueryResponse{
+		Type:     "update",
+		Affected: count,
+	}
+	if session.returnRIDs {
+		for _, rid := range rids {
+			response.RIDs = append(response.RIDs, RIDResponse{Block: rid.Block(), Slot: rid.Slot()})
 		}
 	}
+	return response, nil
+}
 
-	if err := tx.Commit(); err != nil {
+// startTimeout makes statements of the transaction fail with transaction.ErrCanceled once
+// they run longer than timeout, unless it is 0. The returned function stops the timeout.
+func startTimeout(tx *transaction.Transaction, timeout time.Duration) func() {
+	if timeout <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	tx.SetContext(ctx)
+	return func() {
+		tx.SetContext(nil)
+		cancel()
+	}
+}
+
+// isQuery checks if the statement is a SELECT by looking at its first keyword.
+// This avoids parsing the SQL twice (once here, once in planner methods).
+func isQuery(sql string) bool {
+	return strings.HasPrefix(strings.TrimSpace(strings.ToLower(sql)), "select")
+}
+
+// openQuery plans a query and opens a scan over its records, positioned before the first.
+// Aggregates over a table use as many workers as the session's parallel setting.
+func (s *Server) openQuery(session *Session, tx *transaction.Transaction, sql string) (plan.Plan, scan.Scan, error) {
+	planner := s.planner
+	if session.parallel > 1 {
+		planner = plan.NewPlanner(s.queryPlanner.WithWorkers(session.parallel), s.updatePlanner)
+		planner.SetQueryCache(s.queryCache)
+	}
+	queryPlan, err := planner.CreatePlan(sql, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	queryScan, err := queryPlan.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to open query plan: %w", err)
+	}
+	if err := queryScan.BeforeFirst(); err != nil {
+		queryScan.Close()
+		return nil, nil, fmt.Errorf("Failed to position scan: %w", err)
+	}
+	return queryPlan, queryScan, nil
+}
+
+// readRow returns the values of the columns of the scan's current record, in order.
+func readRow(queryScan scan.Scan, schema *record.Schema, columns []string) ([]interface{}, error) {
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		if schema.Type(col) == "int" || schema.Type(col) == "bigint" {
+			val, err := queryScan.GetInt(col)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get int value for column %s: %w", col, err)
+			}
+			values[i] = val
+		} else {
+			val, err := queryScan.GetString(col)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get string value for column %s: %w", col, err)
+			}
+			values[i] = val
+		}
+	}
+	return values, nil
+}
+
+// tableArgument returns the table name that follows the given number of command words
+// and ends the statement. Like in other statements, a quoted name keeps its case.
+func tableArgument(sql string, commandWords int) (string, bool) {
+	lexer := parse.NewLexer(sql)
+	for range commandWords {
+		lexer.EatId()
+	}
+	tableName, err := lexer.EatId()
+	if err != nil {
+		return "", false
+	}
+	if lexer.MatchDelim(';') {
+		lexer.EatDelim(';')
+	}
+	return tableName, lexer.AtEnd()
+}
+
+// showTables lists the user tables. The system catalog tables are not included.
+func (s *Server) showTables(tx *transaction.Transaction) (QueryResponse, error) {
+	tables, err := s.metadataManager.ListTables(tx)
+	if err != nil {
 		return QueryResponse{
 			Type:  "error",
-			Error: fmt.Sprintf("Failed to commit transaction: %v", err),
+			Error: fmt.Sprintf("Failed to list tables: %v", err),
+		}, err
+	}
+
+	rows := []map[string]interface{}{}
+	for _, tableName := range tables {
+		rows = append(rows, map[string]interface{}{"table_name": tableName})
+	}
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: []string{"table_name"},
+	}, nil
+}
+
+// describeTable lists the fields of a table as recorded in the field catalog.
+func (s *Server) describeTable(tx *transaction.Transaction, tableName string) (QueryResponse, error) {
+	layout, err := s.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return QueryResponse{
+			Type:  "error",
+			Error: err.Error(),
+		}, err
+	}
+
+	schema := layout.GetSchema()
+	rows := []map[string]interface{}{}
+	for _, fieldName := range schema.Fields() {
+		rows = append(rows, map[string]interface{}{
+			"field_name": fieldName,
+			"type":       schema.Type(fieldName),
+			"length":     schema.Length(fieldName),
+			"offset":     layout.GetOffset(fieldName),
+		})
+	}
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: []string{"field_name", "type", "length", "offset"},
+	}, nil
+}
+
+// showStats lists the statistics the planner uses for a table: its block and record
+// counts, the distinct values of each field, and the index on each indexed field.
+func (s *Server) showStats(tx *transaction.Transaction, tableName string) (QueryResponse, error) {
+	stats, err := s.metadataManager.TableStats(tableName, tx)
+	if err != nil {
+		return QueryResponse{
+			Type:  "error",
+			Error: err.Error(),
+		}, err
+	}
+
+	rows := []map[string]interface{}{
+		{"statistic": "blocks", "field": "", "value": stats.BlocksAccessed},
+		{"statistic": "records", "field": "", "value": stats.RecordsOutput},
+	}
+	for _, fieldName := range stats.Fields {
+		rows = append(rows, map[string]interface{}{
+			"statistic": "distinct_values",
+			"field":     fieldName,
+			"value":     stats.DistinctValues[fieldName],
+		})
+	}
+	for _, fieldName := range stats.Fields {
+		if indexName, ok := stats.Indexes[fieldName]; ok {
+			rows = append(rows, map[string]interface{}{
+				"statistic": "index",
+				"field":     fieldName,
+				"value":     indexName,
+			})
 		}
 	}
-	committed = true
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: []string{"statistic", "field", "value"},
+	}, nil
+}
 
+// showTxStats returns one row with the transaction counters of the server since it
+// started. The transaction running the statement is counted as active.
+func (s *Server) showTxStats() (QueryResponse, error) {
+	stats := transaction.GetStats()
 	return QueryResponse{
-		Type:     "update",
-		Affected: count,
+		Type: "query",
+		Rows: []map[string]interface{}{{
+			"started":     stats.Started,
+			"committed":   stats.Committed,
+			"rolled_back": stats.RolledBack,
+			"lock_aborts": stats.LockAborts,
+			"active":      stats.Active(),
+		}},
+		Columns: []string{"started", "committed", "rolled_back", "lock_aborts", "active"},
+	}, nil
+}
+
+// dumpBlockArguments returns the table and block number of a DUMP BLOCK statement.
+func dumpBlockArguments(sql string) (string, int, bool) {
+	lexer := parse.NewLexer(sql)
+	lexer.EatId()
+	lexer.EatId()
+	tableName, err := lexer.EatId()
+	if err != nil {
+		return "", 0, false
+	}
+	blockNum, err := lexer.EatIntConstant()
+	if err != nil {
+		return "", 0, false
+	}
+	if lexer.MatchDelim(';') {
+		lexer.EatDelim(';')
 	}
+	return tableName, blockNum, lexer.AtEnd()
+}
+
+// dumpBlock lists the slots of a block of a table, each with its status and the record it
+// holds, written as field=value pairs. It is meant for looking into how full blocks are.
+func (s *Server) dumpBlock(tx *transaction.Transaction, tableName string, blockNum int) (QueryResponse, error) {
+	layout, err := s.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	slots, err := table.DumpBlock(tx, layout, tableName, blockNum)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+
+	fields := layout.GetSchema().Fields()
+	rows := []map[string]interface{}{}
+	for _, slot := range slots {
+		values := []string{}
+		if slot.Values != nil {
+			for _, fieldName := range fields {
+				val := slot.Values[fieldName]
+				if str, ok := val.(string); ok {
+					val = "'" + strings.ReplaceAll(str, "'", "''") + "'"
+				}
+				values = append(values, fmt.Sprintf("%s=%v", fieldName, val))
+			}
+		}
+		rows = append(rows, map[string]interface{}{
+			"slot":   slot.Slot,
+			"status": slot.Status.String(),
+			"record": strings.Join(values, ", "),
+		})
+	}
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: []string{"slot", "status", "record"},
+	}, nil
 }
 
 func main() {
@@ -284,10 +965,47 @@ func main() {
 		dbDir = DefaultDBDir
 	}
 
-	server, err := NewServer(dbDir)
+	// Checksums can only be turned on for a new database; an existing one keeps its setting
+	if os.Getenv("BLOCK_CHECKSUMS") == "on" {
+		if err := file.EnableChecksums(dbDir); err != nil {
+			log.Fatalf("Failed to enable block checksums: %v", err)
+		}
+	}
+
+	logSegmentSize := DefaultLogSegmentSize
+	if size := os.Getenv("LOG_SEGMENT_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 0 || (n > 0 && n < DefaultBlockSize) {
+			log.Fatalf("Invalid LOG_SEGMENT_SIZE %q: expected 0 or a number of bytes of at least %d", size, DefaultBlockSize)
+		}
+		logSegmentSize = n
+	}
+
+	server, err := newServer(dbDir, logSegmentSize)
 	if err != nil {
 		log.Fatalf("Failed to initialize server: %v", err)
 	}
+	if maxRows := os.Getenv("MAX_RESULT_ROWS"); maxRows != "" {
+		n, err := strconv.Atoi(maxRows)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid MAX_RESULT_ROWS %q: expected a number of rows", maxRows)
+		}
+		server.setMaxRows(n)
+	}
+	if timeout := os.Getenv("QUERY_TIMEOUT"); timeout != "" {
+		server.queryTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid QUERY_TIMEOUT %q: %v", timeout, err)
+		}
+	}
+
+	// With a credentials file, every connection must authenticate before running statements
+	if authFile := os.Getenv("AUTH_FILE"); authFile != "" {
+		server.users, err = loadUsers(authFile)
+		if err != nil {
+			log.Fatalf("Invalid AUTH_FILE: %v", err)
+		}
+	}
 
 	listener, err := net.Listen("tcp", ":"+port)
 	if err != nil {
@@ -296,14 +1014,38 @@ func main() {
 
 	log.Printf("CraneDB server listening on port %s", port)
 	log.Printf("Database directory: %s", dbDir)
+	if server.fileManager.Checksums() {
+		log.Printf("Block checksums: on")
+	}
+	if server.queryTimeout > 0 {
+		log.Printf("Query timeout: %s", server.queryTimeout)
+	}
+	if server.maxRows > 0 {
+		log.Printf("Max result rows: %d", server.maxRows)
+	}
+	if server.users != nil {
+		log.Printf("Authentication: on (%d users)", len(server.users))
+	}
 
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			log.Printf("Error accepting connection: %v", err)
-			continue
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Printf("Shutting down, waiting for running statements to finish...")
+		ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown did not complete cleanly: %v", err)
+			return
 		}
+		log.Printf("Shutdown complete")
+	}()
 
-		go server.handleConnection(conn)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Server stopped: %v", err)
 	}
+	<-shutdownDone
 }
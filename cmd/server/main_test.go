@@ -0,0 +1,1344 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/file"
+	dblog "github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// testClient is a minimal line-protocol client used to drive the server in tests.
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// startTestServer starts a server on a random local port backed by a temporary directory.
+func startTestServer(t *testing.T) string {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	return serveTestServer(t, server)
+}
+
+// serveTestServer serves the server on a random local port and returns its address.
+func serveTestServer(t *testing.T, server *Server) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	return listener.Addr().String()
+}
+
+func dialTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return &testClient{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// exec sends a statement and waits for its response.
+func (c *testClient) exec(sql string) (QueryResponse, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", sql); err != nil {
+		return QueryResponse{}, err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return QueryResponse{}, err
+	}
+	var response QueryResponse
+	err = json.Unmarshal([]byte(strings.TrimSpace(line)), &response)
+	return response, err
+}
+
+// execBatch sends several statements in one message and waits for the array of responses.
+func (c *testClient) execBatch(statements ...string) ([]QueryResponse, error) {
+	if _, err := fmt.Fprintf(c.conn, "%s\n", strings.Join(statements, "; ")); err != nil {
+		return nil, err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var responses []QueryResponse
+	err = json.Unmarshal([]byte(strings.TrimSpace(line)), &responses)
+	return responses, err
+}
+
+// mustExec sends a statement and fails the test if it returns an error response.
+func (c *testClient) mustExec(t *testing.T, sql string) QueryResponse {
+	response, err := c.exec(sql)
+	require.NoError(t, err)
+	require.Empty(t, response.Error, "statement %q failed", sql)
+	return response
+}
+
+// execAsync runs a statement in the background and delivers its response on the returned channel.
+func (c *testClient) execAsync(sql string) <-chan QueryResponse {
+	done := make(chan QueryResponse, 1)
+	go func() {
+		response, err := c.exec(sql)
+		if err != nil {
+			response = QueryResponse{Type: "error", Error: err.Error()}
+		}
+		done <- response
+	}()
+	return done
+}
+
+func setupAccounts(t *testing.T, c *testClient) {
+	c.mustExec(t, "CREATE TABLE accounts (id INT, balance INT)")
+	c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (1, 100)")
+	c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (2, 200)")
+}
+
+func balanceOf(t *testing.T, response QueryResponse) int {
+	require.Empty(t, response.Error)
+	require.Len(t, response.Rows, 1)
+	return int(response.Rows[0]["balance"].(float64))
+}
+
+func TestServer_ExplicitTransactionCommit(t *testing.T) {
+	addr := startTestServer(t)
+	c1 := dialTestClient(t, addr)
+	c2 := dialTestClient(t, addr)
+	setupAccounts(t, c1)
+
+	resp := c1.mustExec(t, "BEGIN")
+	assert.Equal(t, "transaction", resp.Type)
+	c1.mustExec(t, "UPDATE accounts SET balance = 150 WHERE id = 1")
+	c1.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (3, 300)")
+	resp = c1.mustExec(t, "COMMIT")
+	assert.Equal(t, "COMMIT", resp.Message)
+
+	assert.Equal(t, 150, balanceOf(t, c2.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+	assert.Equal(t, 300, balanceOf(t, c2.mustExec(t, "SELECT balance FROM accounts WHERE id = 3")))
+}
+
+func TestServer_TransactionCommandErrors(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	resp, err := c.exec("COMMIT")
+	require.NoError(t, err)
+	assert.Equal(t, "error", resp.Type)
+
+	resp, err = c.exec("ROLLBACK")
+	require.NoError(t, err)
+	assert.Equal(t, "error", resp.Type)
+
+	c.mustExec(t, "BEGIN")
+	resp, err = c.exec("BEGIN")
+	require.NoError(t, err)
+	assert.Equal(t, "error", resp.Type)
+	c.mustExec(t, "ROLLBACK")
+}
+
+func TestServer_SyntaxErrorPosition(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	resp, err := c.exec("INSERT INTO accounts (id, balance VALUES (1, 100)")
+	require.NoError(t, err)
+	assert.Equal(t, "error", resp.Type)
+	assert.Equal(t, "bad syntax: expected ')' at position 35, got 'values'", resp.Error)
+}
+
+func TestServer_WriterBlocksConcurrentReader(t *testing.T) {
+	addr := startTestServer(t)
+	writer := dialTestClient(t, addr)
+	reader := dialTestClient(t, addr)
+	setupAccounts(t, writer)
+
+	writer.mustExec(t, "BEGIN")
+	writer.mustExec(t, "UPDATE accounts SET balance = 500 WHERE id = 1")
+
+	// The writer holds an exclusive lock, so the reader must wait for it
+	readDone := reader.execAsync("SELECT balance FROM accounts WHERE id = 1")
+	select {
+	case resp := <-readDone:
+		t.Fatalf("reader was not blocked by uncommitted write, got %+v", resp)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	writer.mustExec(t, "COMMIT")
+
+	select {
+	case resp := <-readDone:
+		assert.Equal(t, 500, balanceOf(t, resp))
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader did not resume after writer committed")
+	}
+}
+
+func TestServer_RollbackIsInvisibleToBlockedReader(t *testing.T) {
+	addr := startTestServer(t)
+	writer := dialTestClient(t, addr)
+	reader := dialTestClient(t, addr)
+	setupAccounts(t, writer)
+
+	writer.mustExec(t, "BEGIN")
+	writer.mustExec(t, "UPDATE accounts SET balance = 999 WHERE id = 2")
+
+	readDone := reader.execAsync("SELECT balance FROM accounts WHERE id = 2")
+	time.Sleep(100 * time.Millisecond)
+	writer.mustExec(t, "ROLLBACK")
+
+	select {
+	case resp := <-readDone:
+		assert.Equal(t, 200, balanceOf(t, resp))
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader did not resume after writer rolled back")
+	}
+}
+
+func TestServer_DeadlockedStatementIsRetried(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	// The deadlock lasts until a lock wait gives up, so waits are kept short
+	const maxLockWait = 500 * time.Millisecond
+	server.setMaxLockWait(maxLockWait)
+	addr := serveTestServer(t, server)
+	c1 := dialTestClient(t, addr)
+	c2 := dialTestClient(t, addr)
+	setupAccounts(t, c1)
+	lockAborts := func() float64 {
+		resp := c1.mustExec(t, "SHOW TXSTATS")
+		return resp.Rows[0]["lock_aborts"].(float64)
+	}
+	before := lockAborts()
+
+	// c1 reads the block and c2's update waits for c1's shared lock to write it. c1's own
+	// update then waits for c2's shared lock: a deadlock, which c2, having waited longer,
+	// loses first. c2's update is rolled back and run again once c1 commits.
+	c1.mustExec(t, "BEGIN")
+	c1.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")
+	updateDone := c2.execAsync("UPDATE accounts SET balance = 250 WHERE id = 2")
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case resp := <-c1.execAsync("UPDATE accounts SET balance = 50 WHERE id = 1"):
+		require.Empty(t, resp.Error)
+	case <-time.After(maxLockWait + 5*time.Second):
+		t.Fatal("deadlock was not broken")
+	}
+	c1.mustExec(t, "COMMIT")
+
+	select {
+	case resp := <-updateDone:
+		require.Empty(t, resp.Error)
+		assert.Equal(t, 1, resp.Affected)
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlocked statement was not retried")
+	}
+	assert.Equal(t, 50, balanceOf(t, c1.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+	assert.Equal(t, 250, balanceOf(t, c1.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")))
+	assert.Equal(t, float64(1), lockAborts()-before)
+}
+
+func TestServer_DisconnectRollsBackOpenTransaction(t *testing.T) {
+	addr := startTestServer(t)
+	writer := dialTestClient(t, addr)
+	reader := dialTestClient(t, addr)
+	setupAccounts(t, writer)
+
+	writer.mustExec(t, "BEGIN")
+	writer.mustExec(t, "UPDATE accounts SET balance = 0 WHERE id = 1")
+	writer.conn.Close()
+
+	select {
+	case resp := <-reader.execAsync("SELECT balance FROM accounts WHERE id = 1"):
+		assert.Equal(t, 100, balanceOf(t, resp))
+	case <-time.After(5 * time.Second):
+		t.Fatal("locks of disconnected client were not released")
+	}
+}
+
+func TestServer_ConcurrentReadersShareLocks(t *testing.T) {
+	addr := startTestServer(t)
+	c1 := dialTestClient(t, addr)
+	c2 := dialTestClient(t, addr)
+	setupAccounts(t, c1)
+
+	c1.mustExec(t, "BEGIN")
+	c2.mustExec(t, "BEGIN")
+	assert.Equal(t, 100, balanceOf(t, c1.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+
+	// A second reader must not wait on the first reader's shared locks
+	select {
+	case resp := <-c2.execAsync("SELECT balance FROM accounts WHERE id = 1"):
+		assert.Equal(t, 100, balanceOf(t, resp))
+	case <-time.After(2 * time.Second):
+		t.Fatal("shared lock blocked a concurrent reader")
+	}
+
+	c1.mustExec(t, "COMMIT")
+	c2.mustExec(t, "COMMIT")
+}
+
+func TestServer_ConcurrentSessions(t *testing.T) {
+	addr := startTestServer(t)
+	const numClients = 4
+	const rowsPerClient = 10
+
+	clients := make([]*testClient, numClients)
+	for i := range clients {
+		clients[i] = dialTestClient(t, addr)
+		clients[i].mustExec(t, fmt.Sprintf("CREATE TABLE t%d (id INT, val VARCHAR(10))", i))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numClients*rowsPerClient)
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *testClient) {
+			defer wg.Done()
+			for j := 0; j < rowsPerClient; j++ {
+				resp, err := c.exec(fmt.Sprintf("INSERT INTO t%d (id, val) VALUES (%d, 'v%d')", i, j, j))
+				if err == nil && resp.Error != "" {
+					err = fmt.Errorf("%s", resp.Error)
+				}
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("insert failed: %v", err)
+	}
+
+	for i, c := range clients {
+		resp := c.mustExec(t, fmt.Sprintf("SELECT id, val FROM t%d", i))
+		assert.Len(t, resp.Rows, rowsPerClient)
+	}
+}
+
+func TestServer_ReturnRIDs(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+
+	// RIDs are not returned by default
+	resp := c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (3, 300)")
+	assert.Equal(t, 1, resp.Affected)
+	assert.Empty(t, resp.RIDs)
+
+	resp = c.mustExec(t, "SET RETURN_RIDS ON")
+	assert.Equal(t, "setting", resp.Type)
+
+	resp = c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (4, 400)")
+	assert.Equal(t, 1, resp.Affected)
+	require.Len(t, resp.RIDs, 1)
+	// The first block holds the earlier records, so the new one follows them
+	assert.Equal(t, RIDResponse{Block: 0, Slot: 3}, resp.RIDs[0])
+
+	resp = c.mustExec(t, "UPDATE accounts SET balance = 0 WHERE balance > 150")
+	assert.Equal(t, 3, resp.Affected)
+	assert.Len(t, resp.RIDs, 3)
+
+	// Statements that don't insert or modify records return no RIDs
+	resp = c.mustExec(t, "DELETE FROM accounts WHERE id = 1")
+	assert.Equal(t, 1, resp.Affected)
+	assert.Empty(t, resp.RIDs)
+
+	c.mustExec(t, "SET RETURN_RIDS OFF")
+	resp = c.mustExec(t, "UPDATE accounts SET balance = 1 WHERE id = 2")
+	assert.Equal(t, 1, resp.Affected)
+	assert.Empty(t, resp.RIDs)
+}
+
+func TestServer_ReadCommittedAllowsNonRepeatableRead(t *testing.T) {
+	addr := startTestServer(t)
+	reader := dialTestClient(t, addr)
+	writer := dialTestClient(t, addr)
+	setupAccounts(t, writer)
+
+	resp := reader.mustExec(t, "SET ISOLATION READ COMMITTED")
+	assert.Equal(t, "setting", resp.Type)
+
+	reader.mustExec(t, "BEGIN")
+	assert.Equal(t, 100, balanceOf(t, reader.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+
+	// The reader released its shared locks, so the writer is not blocked
+	select {
+	case resp := <-writer.execAsync("UPDATE accounts SET balance = 150 WHERE id = 1"):
+		require.Empty(t, resp.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer was blocked by a READ COMMITTED reader")
+	}
+
+	assert.Equal(t, 150, balanceOf(t, reader.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+	reader.mustExec(t, "COMMIT")
+
+	// Back at the default level the reader's shared locks block the writer until it commits
+	reader.mustExec(t, "SET ISOLATION REPEATABLE READ")
+	reader.mustExec(t, "BEGIN")
+	assert.Equal(t, 150, balanceOf(t, reader.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+
+	writeDone := writer.execAsync("UPDATE accounts SET balance = 175 WHERE id = 1")
+	select {
+	case resp := <-writeDone:
+		t.Fatalf("writer was not blocked by a REPEATABLE READ reader, got %+v", resp)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	assert.Equal(t, 150, balanceOf(t, reader.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+	reader.mustExec(t, "COMMIT")
+
+	select {
+	case resp := <-writeDone:
+		require.Empty(t, resp.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer did not resume after reader committed")
+	}
+}
+
+func TestServer_RepeatableReadPreventsPhantoms(t *testing.T) {
+	addr := startTestServer(t)
+	reader := dialTestClient(t, addr)
+	writer := dialTestClient(t, addr)
+	writer.mustExec(t, "CREATE TABLE people (id INT, age INT)")
+	writer.mustExec(t, "CREATE INDEX people_age_idx ON people (age) USING BTREE")
+	for i, age := range []int{10, 22, 35, 40} {
+		writer.mustExec(t, fmt.Sprintf("INSERT INTO people (id, age) VALUES (%d, %d)", i+1, age))
+	}
+	const rangeQuery = "SELECT id FROM people WHERE age BETWEEN 20 AND 30"
+	countOf := func(resp QueryResponse) int {
+		require.Empty(t, resp.Error)
+		require.Len(t, resp.Rows, 1)
+		for _, val := range resp.Rows[0] {
+			return int(val.(float64))
+		}
+		return 0
+	}
+
+	// An insert into the range read by a REPEATABLE READ transaction waits until it commits,
+	// so repeating the read finds no new record
+	reader.mustExec(t, "BEGIN")
+	assert.Len(t, reader.mustExec(t, rangeQuery).Rows, 1)
+	writeDone := writer.execAsync("INSERT INTO people (id, age) VALUES (5, 25)")
+	select {
+	case resp := <-writeDone:
+		t.Fatalf("insert into the range was not blocked, got %+v", resp)
+	case <-time.After(300 * time.Millisecond):
+	}
+	assert.Len(t, reader.mustExec(t, rangeQuery).Rows, 1)
+	reader.mustExec(t, "COMMIT")
+	select {
+	case resp := <-writeDone:
+		require.Empty(t, resp.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("insert did not resume after reader committed")
+	}
+
+	// So does one into a table whose records were counted from its statistics
+	reader.mustExec(t, "BEGIN")
+	assert.Equal(t, 5, countOf(reader.mustExec(t, "SELECT COUNT(*) FROM people")))
+	writeDone = writer.execAsync("INSERT INTO people (id, age) VALUES (6, 50)")
+	select {
+	case resp := <-writeDone:
+		t.Fatalf("insert into the counted table was not blocked, got %+v", resp)
+	case <-time.After(300 * time.Millisecond):
+	}
+	assert.Equal(t, 5, countOf(reader.mustExec(t, "SELECT COUNT(*) FROM people")))
+	reader.mustExec(t, "COMMIT")
+	select {
+	case resp := <-writeDone:
+		require.Empty(t, resp.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("insert did not resume after reader committed")
+	}
+
+	// At READ COMMITTED the insert goes through and the repeated read sees the phantom
+	reader.mustExec(t, "SET ISOLATION READ COMMITTED")
+	reader.mustExec(t, "BEGIN")
+	assert.Len(t, reader.mustExec(t, rangeQuery).Rows, 2)
+	select {
+	case resp := <-writer.execAsync("INSERT INTO people (id, age) VALUES (7, 28)"):
+		require.Empty(t, resp.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("insert was blocked by a READ COMMITTED reader")
+	}
+	assert.Len(t, reader.mustExec(t, rangeQuery).Rows, 3)
+	reader.mustExec(t, "COMMIT")
+}
+
+func TestServer_ShutdownIsClean(t *testing.T) {
+	dbDir := t.TempDir()
+	server, err := NewServer(dbDir)
+	require.NoError(t, err)
+	addr := serveTestServer(t, server)
+
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+	c.mustExec(t, "BEGIN")
+	c.mustExec(t, "UPDATE accounts SET balance = 0 WHERE id = 1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, server.Shutdown(ctx))
+
+	// The connection is closed and no new ones are accepted
+	_, err = c.exec("SELECT balance FROM accounts WHERE id = 1")
+	assert.Error(t, err)
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err)
+
+	// The log ends with a checkpoint, so recovery has nothing to undo
+	fm, err := file.NewManager(dbDir, DefaultBlockSize)
+	require.NoError(t, err)
+	lm, err := dblog.NewManager(fm, "cranedb.log")
+	require.NoError(t, err)
+	iterator, err := lm.Iterator()
+	require.NoError(t, err)
+	require.True(t, iterator.HasNext())
+	assert.Equal(t, transaction.LogRecordCheckpoint, transaction.CreateLogRecord(iterator.Next()).Op())
+	fm.Close()
+
+	// After a restart the committed data is intact and the open transaction was rolled back
+	restarted, err := NewServer(dbDir)
+	require.NoError(t, err)
+	c = dialTestClient(t, serveTestServer(t, restarted))
+	assert.Equal(t, 100, balanceOf(t, c.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")))
+	assert.Equal(t, 200, balanceOf(t, c.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")))
+}
+
+func TestServer_ShutdownWaitsForRunningStatement(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	addr := serveTestServer(t, server)
+
+	writer := dialTestClient(t, addr)
+	reader := dialTestClient(t, addr)
+	setupAccounts(t, writer)
+
+	// The reader's statement is in progress, waiting on the writer's lock
+	writer.mustExec(t, "BEGIN")
+	writer.mustExec(t, "UPDATE accounts SET balance = 500 WHERE id = 1")
+	readDone := reader.execAsync("SELECT balance FROM accounts WHERE id = 1")
+	time.Sleep(100 * time.Millisecond)
+
+	shutdownDone := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownDone <- server.Shutdown(ctx)
+	}()
+
+	// Closing the idle writer rolls back its transaction, which lets the reader finish
+	select {
+	case resp := <-readDone:
+		assert.Equal(t, 100, balanceOf(t, resp))
+	case <-time.After(5 * time.Second):
+		t.Fatal("running statement did not complete during shutdown")
+	}
+	require.NoError(t, <-shutdownDone)
+}
+
+func TestServer_QueryTimeout(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	server.queryTimeout = 500 * time.Millisecond
+	addr := serveTestServer(t, server)
+	c := dialTestClient(t, addr)
+
+	var csv strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csv, "%d\n", i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "values.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	c.mustExec(t, "CREATE TABLE lefts (a INT)")
+	c.mustExec(t, "CREATE TABLE rights (b INT)")
+	c.mustExec(t, fmt.Sprintf("COPY lefts FROM '%s'", csvPath))
+	c.mustExec(t, fmt.Sprintf("COPY rights FROM '%s'", csvPath))
+
+	// The product has a million rows, far more than can be read before the timeout
+	c.mustExec(t, "BEGIN")
+	c.mustExec(t, "INSERT INTO lefts (a) VALUES (-5)")
+	start := time.Now()
+	resp, err := c.exec("SELECT a, b FROM lefts, rights WHERE a = b + 5000")
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Contains(t, resp.Error, "statement canceled")
+	assert.Contains(t, resp.Error, "(transaction rolled back)")
+
+	// The timeout ended the transaction, undoing its insert
+	resp, err = c.exec("COMMIT")
+	require.NoError(t, err)
+	assert.Equal(t, "no transaction in progress", resp.Error)
+	resp = c.mustExec(t, "SELECT a FROM lefts WHERE a = -5")
+	assert.Empty(t, resp.Rows)
+}
+
+func TestServer_MaxResultRows(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	server.setMaxRows(500)
+	addr := serveTestServer(t, server)
+	c := dialTestClient(t, addr)
+
+	var csv strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&csv, "%d\n", i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "values.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	c.mustExec(t, "CREATE TABLE lefts (a INT)")
+	c.mustExec(t, "CREATE TABLE rights (b INT)")
+	c.mustExec(t, fmt.Sprintf("COPY lefts FROM '%s'", csvPath))
+	c.mustExec(t, fmt.Sprintf("COPY rights FROM '%s'", csvPath))
+
+	// The product has 40000 rows, far more than the cap
+	resp, err := c.exec("SELECT a, b FROM lefts, rights")
+	require.NoError(t, err)
+	assert.Equal(t, "result too large: more than 500 rows", resp.Error)
+
+	// Grouping it would hold 40000 groups, even though only a few are returned
+	resp, err = c.exec("SELECT a, b, COUNT(*) FROM lefts, rights GROUP BY a, b HAVING a = 1 AND b = 1")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "result too large: more than 500 groups")
+
+	c.mustExec(t, "SET stream_rows ON")
+	resp = c.mustExec(t, "SELECT a, b FROM lefts, rights")
+	require.Equal(t, "stream", resp.Type)
+	for i := 0; i < 500; i++ {
+		_, err := c.reader.ReadString('\n')
+		require.NoError(t, err)
+	}
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(line), &resp))
+	assert.Equal(t, "result too large: more than 500 rows", resp.Error)
+	c.mustExec(t, "SET stream_rows OFF")
+
+	// Results within the cap are unaffected
+	resp = c.mustExec(t, "SELECT a, b FROM lefts, rights WHERE a = b")
+	assert.Len(t, resp.Rows, 200)
+	resp = c.mustExec(t, "SELECT a, COUNT(*) FROM lefts, rights WHERE a < 5 GROUP BY a")
+	assert.Len(t, resp.Rows, 5)
+}
+
+func TestServer_StreamRows(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	var csv strings.Builder
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&csv, "%d\n", i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "values.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	c.mustExec(t, "CREATE TABLE lefts (a INT)")
+	c.mustExec(t, "CREATE TABLE rights (b INT)")
+	c.mustExec(t, fmt.Sprintf("COPY lefts FROM '%s'", csvPath))
+	c.mustExec(t, fmt.Sprintf("COPY rights FROM '%s'", csvPath))
+	c.mustExec(t, "SET stream_rows ON")
+
+	// A failing query is answered with only its error
+	resp, err := c.exec("SELECT a FROM missing")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	resp = c.mustExec(t, "SELECT a, b FROM lefts, rights")
+	assert.Equal(t, "stream", resp.Type)
+	assert.Equal(t, []string{"a", "b"}, resp.Columns)
+	readRow := func() []interface{} {
+		line, err := c.reader.ReadString('\n')
+		require.NoError(t, err)
+		var values []interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &values), "unexpected line %q", line)
+		return values
+	}
+	assert.Equal(t, []interface{}{float64(0), float64(0)}, readRow())
+
+	// While the client isn't reading, the server waits with the scan open instead of
+	// collecting the other 89999 rows
+	time.Sleep(200 * time.Millisecond)
+	runtime.GC()
+	var during runtime.MemStats
+	runtime.ReadMemStats(&during)
+	growth := int64(during.HeapAlloc) - int64(before.HeapAlloc)
+	assert.Less(t, growth, int64(4<<20), "server heap grew by %d bytes while streaming", growth)
+
+	for i := 1; i < 300*300; i++ {
+		readRow()
+	}
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+	var end QueryResponse
+	require.NoError(t, json.Unmarshal([]byte(line), &end))
+	assert.Equal(t, QueryResponse{Type: "end"}, end)
+
+	// The query was committed, so the connection carries on with other statements
+	c.mustExec(t, "SET stream_rows OFF")
+	resp = c.mustExec(t, "SELECT a FROM lefts WHERE a = 7")
+	assert.Equal(t, []map[string]interface{}{{"a": float64(7)}}, resp.Rows)
+}
+
+func TestServer_Cursor(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	writer := dialTestClient(t, addr)
+
+	const numRows = 500
+	var csv strings.Builder
+	for i := 0; i < numRows; i++ {
+		fmt.Fprintf(&csv, "%d,name%d\n", i, i)
+	}
+	csvPath := filepath.Join(t.TempDir(), "values.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	c.mustExec(t, "CREATE TABLE items (id INT, name VARCHAR(20))")
+	c.mustExec(t, fmt.Sprintf("COPY items FROM '%s'", csvPath))
+
+	resp := c.mustExec(t, "DECLARE pages CURSOR FOR SELECT id, name FROM items")
+	assert.Equal(t, "cursor", resp.Type)
+	resp, err := c.exec("DECLARE pages CURSOR FOR SELECT id FROM items")
+	require.NoError(t, err)
+	assert.Equal(t, "cursor pages already exists", resp.Error)
+
+	// Every row comes in exactly one page, and a writer can't change a row already fetched
+	// until the cursor is closed
+	seen := map[int]bool{}
+	var deleteDone <-chan QueryResponse
+	for page := 0; ; page++ {
+		resp := c.mustExec(t, "FETCH 64 FROM pages")
+		assert.Equal(t, []string{"id", "name"}, resp.Columns)
+		if len(resp.Rows) == 0 {
+			break
+		}
+		assert.LessOrEqual(t, len(resp.Rows), 64)
+		for _, row := range resp.Rows {
+			id := int(row["id"].(float64))
+			assert.False(t, seen[id], "row %d fetched twice", id)
+			assert.Equal(t, fmt.Sprintf("name%d", id), row["name"])
+			seen[id] = true
+		}
+		if page == 0 {
+			deleteDone = writer.execAsync("DELETE FROM items WHERE id = 0")
+		}
+	}
+	assert.Len(t, seen, numRows)
+	assert.Empty(t, c.mustExec(t, "FETCH 64 FROM pages").Rows)
+
+	select {
+	case resp := <-deleteDone:
+		t.Fatalf("writer was not blocked by the open cursor, got %+v", resp)
+	case <-time.After(300 * time.Millisecond):
+	}
+	resp = c.mustExec(t, "CLOSE CURSOR pages")
+	assert.Equal(t, "CLOSE CURSOR pages", resp.Message)
+	select {
+	case resp := <-deleteDone:
+		assert.Equal(t, 1, resp.Affected)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer did not resume after the cursor was closed")
+	}
+
+	// A closed cursor is gone, and cursors need a transaction of their own
+	resp, err = c.exec("FETCH 10 FROM pages")
+	require.NoError(t, err)
+	assert.Equal(t, "cursor pages does not exist", resp.Error)
+	c.mustExec(t, "BEGIN")
+	resp, err = c.exec("DECLARE inner CURSOR FOR SELECT id FROM items")
+	require.NoError(t, err)
+	assert.Equal(t, "a cursor can't be declared inside a transaction", resp.Error)
+	c.mustExec(t, "ROLLBACK")
+	resp, err = c.exec("FETCH pages")
+	require.NoError(t, err)
+	assert.Equal(t, fetchUsage, resp.Error)
+}
+
+func TestServer_ExportCSV(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	records := [][]string{
+		{"1", "plain"},
+		{"2", "with, comma"},
+		{"3", `with "quotes"`},
+		{"4", "with\nnewline"},
+		{"5", `{"type":"end"}`},
+		{"-6", `"leading quote, and both",\n"`},
+	}
+	var data strings.Builder
+	w := csv.NewWriter(&data)
+	require.NoError(t, w.WriteAll(records))
+	csvPath := filepath.Join(t.TempDir(), "notes.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(data.String()), 0644))
+	c.mustExec(t, "CREATE TABLE notes (id INT, body VARCHAR(40))")
+	c.mustExec(t, fmt.Sprintf("COPY notes FROM '%s'", csvPath))
+
+	// export sends the statement and returns the CSV text up to the response ending it
+	export := func(sql string) (string, QueryResponse) {
+		resp := c.mustExec(t, sql)
+		require.Equal(t, "csv", resp.Type)
+		var text strings.Builder
+		for {
+			line, err := c.reader.ReadString('\n')
+			require.NoError(t, err)
+			if strings.HasPrefix(line, `{"type":`) {
+				var end QueryResponse
+				require.NoError(t, json.Unmarshal([]byte(line), &end))
+				return text.String(), end
+			}
+			text.WriteString(line)
+		}
+	}
+
+	text, end := export("EXPORT notes TO CSV")
+	assert.Equal(t, QueryResponse{Type: "end"}, end)
+	exported, err := csv.NewReader(strings.NewReader(text)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, append([][]string{{"id", "body"}}, records...), exported)
+
+	text, end = export("export SELECT body FROM notes WHERE id > 4 to csv;")
+	assert.Equal(t, QueryResponse{Type: "end"}, end)
+	exported, err = csv.NewReader(strings.NewReader(text)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"body"}, {`{"type":"end"}`}}, exported)
+
+	// Statements that can't be exported are answered with only their error
+	resp, err := c.exec("EXPORT missing TO CSV")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+	resp, err = c.exec("EXPORT notes TO JSON")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: EXPORT <table|query> TO CSV", resp.Error)
+	responses, err := c.execBatch("SELECT id FROM notes", "EXPORT notes TO CSV")
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Contains(t, responses[1].Error, "must be sent on its own")
+
+	// The connection carries on with other statements
+	resp = c.mustExec(t, "SELECT id FROM notes WHERE id = 2")
+	assert.Equal(t, []map[string]interface{}{{"id": float64(2)}}, resp.Rows)
+}
+
+func TestServer_ImportCSV(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	c.mustExec(t, "CREATE TABLE notes (id INT, body VARCHAR(40))")
+	c.mustExec(t, "CREATE INDEX notes_id ON notes (id)")
+
+	// importCSV sends the statement and, once the server asks for it, the CSV text
+	importCSV := func(sql string, text string) QueryResponse {
+		resp := c.mustExec(t, sql)
+		require.Equal(t, "import", resp.Type)
+		assert.Equal(t, []string{"id", "body"}, resp.Columns)
+		resp, err := c.exec(text + "\\.")
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := importCSV("IMPORT INTO notes FROM CSV", "body,id\n"+
+		"plain,1\n"+
+		"\"with, comma\",2\n"+
+		"\"with \"\"quotes\"\", and a comma\",3\n"+
+		"\"with\nnewline\",4\n")
+	require.Empty(t, resp.Error)
+	assert.Equal(t, QueryResponse{Type: "update", Affected: 4}, resp)
+
+	resp = c.mustExec(t, "SELECT id, body FROM notes")
+	assert.ElementsMatch(t, []map[string]interface{}{
+		{"id": float64(1), "body": "plain"},
+		{"id": float64(2), "body": "with, comma"},
+		{"id": float64(3), "body": `with "quotes", and a comma`},
+		{"id": float64(4), "body": "with\nnewline"},
+	}, resp.Rows)
+	// The index was updated with the imported rows
+	resp = c.mustExec(t, "SELECT body FROM notes WHERE id = 3")
+	assert.Equal(t, []map[string]interface{}{{"body": `with "quotes", and a comma`}}, resp.Rows)
+
+	// A value of the wrong type fails the whole import with its line, and the rest of the
+	// CSV text is skipped
+	resp = importCSV("import into notes from csv;", "id,body\n5,five\n\"6\nsix\",x\nseven,7\n8,eight\n")
+	assert.Equal(t, "line 3: field id expects an int, got '6\nsix'", resp.Error)
+	resp = importCSV("IMPORT INTO notes FROM CSV", "id,missing\n5,five\n")
+	assert.Equal(t, "field missing not found in table notes", resp.Error)
+	resp = c.mustExec(t, "SELECT id FROM notes WHERE id > 4")
+	assert.Empty(t, resp.Rows)
+
+	// Statements that can't import are answered with only their error, and no CSV text is read
+	resp, err := c.exec("IMPORT INTO missing FROM CSV")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+	resp, err = c.exec("IMPORT INTO notes FROM JSON")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: IMPORT INTO <table> FROM CSV", resp.Error)
+
+	resp = c.mustExec(t, "SELECT id FROM notes WHERE id = 2")
+	assert.Equal(t, []map[string]interface{}{{"id": float64(2)}}, resp.Rows)
+}
+
+func TestServer_NoColumns(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+
+	// readLine sends a statement and returns its raw response line, without the statement's
+	// cost, which changes from run to run
+	readLine := func(sql string) string {
+		_, err := fmt.Fprintf(c.conn, "%s\n", sql)
+		require.NoError(t, err)
+		line, err := c.reader.ReadString('\n')
+		require.NoError(t, err)
+		var response any
+		require.NoError(t, json.Unmarshal([]byte(line), &response))
+		responses, ok := response.([]any)
+		if !ok {
+			responses = []any{response}
+		}
+		for _, r := range responses {
+			delete(r.(map[string]any), "elapsed_ms")
+			delete(r.(map[string]any), "blocks_accessed")
+		}
+		stripped, err := json.Marshal(response)
+		require.NoError(t, err)
+		return string(stripped)
+	}
+
+	// One row per record, but no columns
+	assert.JSONEq(t, `{"type":"query","columns":[],"rows":[{},{}]}`, readLine("SELECT FROM accounts"))
+	assert.JSONEq(t, `{"type":"query","columns":[],"rows":[]}`, readLine("SELECT FROM accounts WHERE id = 3"))
+	assert.JSONEq(t, `[{"type":"query","columns":[],"rows":[{}]},{"type":"query","columns":["id"],"rows":[{"id":2}]}]`,
+		readLine("SELECT FROM accounts WHERE id = 1; SELECT id FROM accounts WHERE id = 2"))
+
+	c.mustExec(t, "SET stream_rows ON")
+	assert.JSONEq(t, `{"type":"stream","columns":[]}`, readLine("SELECT FROM accounts"))
+	for i := 0; i < 2; i++ {
+		line, err := c.reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "[]", strings.TrimSpace(line))
+	}
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"end"}`, line)
+}
+
+func TestServer_StatementCost(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+	c.mustExec(t, "CREATE TABLE big (id INT, name VARCHAR(20))")
+	for i := 0; i < 200; i++ {
+		c.mustExec(t, fmt.Sprintf("INSERT INTO big (id, name) VALUES (%d, 'name%d')", i, i))
+	}
+
+	small := c.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")
+	assert.Greater(t, small.ElapsedMs, 0.0)
+	assert.Greater(t, small.BlocksAccessed, 0)
+	large := c.mustExec(t, "SELECT name FROM big")
+	assert.Greater(t, large.ElapsedMs, 0.0)
+	assert.Greater(t, large.BlocksAccessed, small.BlocksAccessed)
+
+	update := c.mustExec(t, "UPDATE accounts SET balance = 50 WHERE id = 2")
+	assert.Greater(t, update.ElapsedMs, 0.0)
+	assert.Greater(t, update.BlocksAccessed, 0)
+
+	// A statement that fails is measured too, while transaction commands aren't
+	failed, err := c.exec("SELECT missing FROM accounts")
+	require.NoError(t, err)
+	require.NotEmpty(t, failed.Error)
+	assert.GreaterOrEqual(t, failed.ElapsedMs, 0.0)
+	begin := c.mustExec(t, "BEGIN")
+	assert.Zero(t, begin.ElapsedMs)
+	inTx := c.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")
+	assert.Greater(t, inTx.BlocksAccessed, 0)
+	c.mustExec(t, "COMMIT")
+}
+
+func TestServer_ShowTablesAndDescribe(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	resp := c.mustExec(t, "SHOW TABLES")
+	assert.Equal(t, []string{"table_name"}, resp.Columns)
+	assert.Empty(t, resp.Rows, "catalog tables should be hidden")
+
+	setupAccounts(t, c)
+	c.mustExec(t, "CREATE TABLE people (id INT, name VARCHAR(20))")
+
+	resp = c.mustExec(t, "show tables;")
+	require.Len(t, resp.Rows, 2)
+	assert.Equal(t, "accounts", resp.Rows[0]["table_name"])
+	assert.Equal(t, "people", resp.Rows[1]["table_name"])
+
+	resp = c.mustExec(t, "DESCRIBE people")
+	assert.Equal(t, []string{"field_name", "type", "length", "offset"}, resp.Columns)
+	require.Len(t, resp.Rows, 2)
+	assert.Equal(t, map[string]interface{}{"field_name": "id", "type": "int", "length": float64(4), "offset": float64(4)}, resp.Rows[0])
+	assert.Equal(t, map[string]interface{}{"field_name": "name", "type": "string", "length": float64(20), "offset": float64(8)}, resp.Rows[1])
+
+	resp, err := c.exec("DESCRIBE missing")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+
+	// Catalog tables can still be described by name
+	resp = c.mustExec(t, "DESCRIBE table_catelog")
+	assert.Len(t, resp.Rows, 2)
+
+	// A quoted table name keeps its case
+	c.mustExec(t, `CREATE TABLE "Order Items" ("Qty" INT)`)
+	resp = c.mustExec(t, `DESCRIBE "Order Items";`)
+	require.Len(t, resp.Rows, 1)
+	assert.Equal(t, "Qty", resp.Rows[0]["field_name"])
+	resp, err = c.exec(`DESCRIBE "Order Items" extra`)
+	require.NoError(t, err)
+	assert.Equal(t, "usage: DESCRIBE <table>", resp.Error)
+}
+
+func TestServer_ShowStats(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	setupAccounts(t, c)
+	c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (3, 200)")
+	c.mustExec(t, "CREATE INDEX accounts_id ON accounts (id)")
+
+	// The record count follows the inserts, but the distinct value counts are those the
+	// planner has, from the scan of the table made while it was still empty
+	resp := c.mustExec(t, "SHOW STATS accounts")
+	assert.Equal(t, []string{"statistic", "field", "value"}, resp.Columns)
+	assert.Equal(t, []map[string]interface{}{
+		{"statistic": "blocks", "field": "", "value": float64(1)},
+		{"statistic": "records", "field": "", "value": float64(3)},
+		{"statistic": "distinct_values", "field": "id", "value": float64(0)},
+		{"statistic": "distinct_values", "field": "balance", "value": float64(0)},
+		{"statistic": "index", "field": "id", "value": "accounts_id"},
+	}, resp.Rows)
+
+	resp, err := c.exec("SHOW STATS missing")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+
+	resp, err = c.exec("SHOW STATS")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: SHOW STATS <table>", resp.Error)
+}
+
+func TestServer_DumpBlock(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+
+	c.mustExec(t, "CREATE TABLE people (id INT, name VARCHAR(10))")
+	c.mustExec(t, "INSERT INTO people (id, name) VALUES (1, 'ann')")
+	c.mustExec(t, "INSERT INTO people (id, name) VALUES (2, 'o''neil')")
+	c.mustExec(t, "INSERT INTO people (id, name) VALUES (3, 'bob')")
+	c.mustExec(t, "DELETE FROM people WHERE id = 1")
+
+	resp := c.mustExec(t, "DUMP BLOCK people 0")
+	assert.Equal(t, []string{"slot", "status", "record"}, resp.Columns)
+	require.Greater(t, len(resp.Rows), 3)
+	assert.Equal(t, []map[string]interface{}{
+		{"slot": float64(0), "status": "empty", "record": ""},
+		{"slot": float64(1), "status": "in use", "record": "id=2, name='o''neil'"},
+		{"slot": float64(2), "status": "in use", "record": "id=3, name='bob'"},
+		{"slot": float64(3), "status": "empty", "record": ""},
+	}, resp.Rows[:4])
+
+	resp, err := c.exec("DUMP BLOCK people 1")
+	require.NoError(t, err)
+	assert.Equal(t, "block 1 out of range: table people has 1 block(s)", resp.Error)
+	resp, err = c.exec("DUMP BLOCK missing 0")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "not found")
+	resp, err = c.exec("DUMP BLOCK people")
+	require.NoError(t, err)
+	assert.Equal(t, "usage: DUMP BLOCK <table> <block number>", resp.Error)
+}
+
+func TestServer_Settings(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	server.queryTimeout = time.Minute
+	addr := serveTestServer(t, server)
+	c := dialTestClient(t, addr)
+
+	show := func(name string) string {
+		resp := c.mustExec(t, "SHOW "+name)
+		assert.Equal(t, []string{"setting", "value"}, resp.Columns)
+		require.Len(t, resp.Rows, 1)
+		assert.Equal(t, strings.ToLower(name), resp.Rows[0]["setting"])
+		return resp.Rows[0]["value"].(string)
+	}
+
+	// Sessions start with the defaults, and the server's query timeout
+	assert.Equal(t, "OFF", show("stream_rows"))
+	assert.Equal(t, "REPEATABLE READ", show("isolation"))
+	assert.Equal(t, "1m0s", show("QUERY_TIMEOUT"))
+
+	resp := c.mustExec(t, "SET stream_rows = on")
+	assert.Equal(t, "setting", resp.Type)
+	assert.Equal(t, "ON", show("stream_rows"))
+	c.mustExec(t, "set isolation = read committed;")
+	assert.Equal(t, "READ COMMITTED", show("isolation"))
+	c.mustExec(t, "SET query_timeout = '250ms'")
+	assert.Equal(t, "250ms", show("query_timeout"))
+	c.mustExec(t, "SET return_rids ON")
+	assert.Equal(t, "1", show("parallel"))
+	c.mustExec(t, "SET parallel = 4")
+
+	resp = c.mustExec(t, "SHOW ALL")
+	assert.Equal(t, []map[string]interface{}{
+		{"setting": "isolation", "value": "READ COMMITTED"},
+		{"setting": "parallel", "value": "4"},
+		{"setting": "query_timeout", "value": "250ms"},
+		{"setting": "return_rids", "value": "ON"},
+		{"setting": "stream_rows", "value": "ON"},
+	}, resp.Rows)
+
+	// Settings belong to the connection
+	other := dialTestClient(t, addr)
+	resp = other.mustExec(t, "SHOW stream_rows")
+	assert.Equal(t, "OFF", resp.Rows[0]["value"])
+
+	for sql, expected := range map[string]string{
+		"SET verbose = on":           "unknown setting: verbose",
+		"SET stream_rows = maybe":    `invalid value "maybe" for stream_rows: expected ON or OFF`,
+		"SET query_timeout = -1s":    `invalid value "-1s" for query_timeout: expected a duration such as 500ms or 1m30s`,
+		"SET isolation serializable": `invalid value "serializable" for isolation: expected READ COMMITTED or REPEATABLE READ`,
+		"SET stream_rows":            "usage: SET <setting> = <value>",
+		"SET parallel = 0":           `invalid value "0" for parallel: expected a number from 1 to 8`,
+	} {
+		resp, err := c.exec(sql)
+		require.NoError(t, err)
+		assert.Equal(t, expected, resp.Error, sql)
+	}
+	assert.Equal(t, "ON", show("stream_rows"))
+}
+
+func TestServer_ShowTxStats(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+
+	counters := func() map[string]float64 {
+		resp := c.mustExec(t, "SHOW TXSTATS")
+		assert.Equal(t, []string{"started", "committed", "rolled_back", "lock_aborts", "active"}, resp.Columns)
+		require.Len(t, resp.Rows, 1)
+		result := map[string]float64{}
+		for _, col := range resp.Columns {
+			result[col] = resp.Rows[0][col].(float64)
+		}
+		return result
+	}
+
+	before := counters()
+	assert.GreaterOrEqual(t, before["active"], float64(1), "The statement's own transaction is active")
+
+	c.mustExec(t, "INSERT INTO accounts (id, balance) VALUES (3, 300)")
+	resp, err := c.exec("INSERT INTO missing (id) VALUES (1)")
+	require.NoError(t, err)
+	require.Equal(t, "error", resp.Type)
+	c.mustExec(t, "BEGIN")
+	c.mustExec(t, "UPDATE accounts SET balance = 0 WHERE id = 3")
+	c.mustExec(t, "ROLLBACK")
+
+	// The first SHOW TXSTATS and the insert committed, the failed insert and the explicit
+	// transaction rolled back, and the second SHOW TXSTATS is running
+	after := counters()
+	assert.Equal(t, float64(4), after["started"]-before["started"])
+	assert.Equal(t, float64(2), after["committed"]-before["committed"])
+	assert.Equal(t, float64(2), after["rolled_back"]-before["rolled_back"])
+	assert.Equal(t, before["active"], after["active"])
+}
+
+func TestServer_Authentication(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "users")
+	require.NoError(t, os.WriteFile(authFile, []byte("# test users\nalice:s3cret pass\nbob:hunter2\n"), 0600))
+	users, err := loadUsers(authFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": "s3cret pass", "bob": "hunter2"}, users)
+
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	server.users = users
+	server.authTimeout = 200 * time.Millisecond
+	addr := serveTestServer(t, server)
+
+	// The password is the rest of the line
+	c := dialTestClient(t, addr)
+	resp := c.mustExec(t, "AUTH alice s3cret pass")
+	assert.Equal(t, "auth", resp.Type)
+	setupAccounts(t, c)
+	resp = c.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")
+	assert.Equal(t, 200, balanceOf(t, resp))
+
+	// A statement before AUTH is refused and the connection closed
+	c = dialTestClient(t, addr)
+	resp, err = c.exec("SELECT balance FROM accounts WHERE id = 2")
+	require.NoError(t, err)
+	assert.Contains(t, resp.Error, "authentication required")
+	_, err = c.exec("SELECT balance FROM accounts WHERE id = 2")
+	assert.Error(t, err)
+
+	c = dialTestClient(t, addr)
+	resp, err = c.exec("AUTH bob wrong")
+	require.NoError(t, err)
+	assert.Equal(t, "authentication failed", resp.Error)
+	_, err = c.exec("AUTH bob hunter2")
+	assert.Error(t, err)
+
+	// A connection that doesn't authenticate within the timeout is closed
+	c = dialTestClient(t, addr)
+	line, err := c.reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, "authentication timed out")
+	_, err = c.reader.ReadString('\n')
+	assert.Error(t, err)
+
+	// An authenticated connection has no deadline of its own
+	c = dialTestClient(t, addr)
+	c.mustExec(t, "AUTH bob hunter2")
+	time.Sleep(2 * server.authTimeout)
+	resp = c.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")
+	assert.Equal(t, 100, balanceOf(t, resp))
+}
+
+func TestServer_PingAndVersion(t *testing.T) {
+	server, err := NewServer(t.TempDir())
+	require.NoError(t, err)
+	server.users = map[string]string{"alice": "s3cret"}
+	addr := serveTestServer(t, server)
+
+	c := dialTestClient(t, addr)
+	c.mustExec(t, "AUTH alice s3cret")
+	setupAccounts(t, c)
+	c.mustExec(t, "BEGIN")
+	c.mustExec(t, "UPDATE accounts SET balance = 0 WHERE id = 1")
+
+	// PING is answered before AUTH, and takes no lock, so the open transaction can't hold it up
+	other := dialTestClient(t, addr)
+	start := time.Now()
+	resp := other.mustExec(t, "PING")
+	assert.Equal(t, "pong", resp.Type)
+	assert.Equal(t, "PONG", resp.Message)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// A client newer than the server is answered with the server's version, and one too old
+	// or without a valid version is refused
+	resp = other.mustExec(t, "VERSION 7")
+	assert.Equal(t, "version", resp.Type)
+	assert.Equal(t, ProtocolVersion, resp.Version)
+	for _, command := range []string{"VERSION 0", "VERSION two", "VERSION 1 2"} {
+		resp, err = other.exec(command)
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.Error, command)
+	}
+	resp = other.mustExec(t, "version")
+	assert.Equal(t, ProtocolVersion, resp.Version)
+
+	// The connection still has to authenticate before any statement
+	other.mustExec(t, "AUTH alice s3cret")
+	other.mustExec(t, "ping;")
+	c.mustExec(t, "COMMIT")
+	resp = other.mustExec(t, "SELECT balance FROM accounts WHERE id = 1")
+	assert.Equal(t, 0, balanceOf(t, resp))
+}
+
+func TestLoadUsers_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"missing_colon":  "alice\n",
+		"empty_password": "alice:\n",
+		"no_users":       "# nobody\n",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		_, err := loadUsers(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"SELECT a FROM t", []string{"SELECT a FROM t"}},
+		{"SELECT a FROM t;", []string{"SELECT a FROM t"}},
+		{"BEGIN; UPDATE t SET a = 1; COMMIT", []string{"BEGIN", "UPDATE t SET a = 1", "COMMIT"}},
+		{" ; ;SELECT a FROM t;; ", []string{"SELECT a FROM t"}},
+		{"INSERT INTO t (s) VALUES ('a;b'); SELECT s FROM t", []string{"INSERT INTO t (s) VALUES ('a;b')", "SELECT s FROM t"}},
+		{"INSERT INTO t (s) VALUES ('it''s;'); COMMIT", []string{"INSERT INTO t (s) VALUES ('it''s;')", "COMMIT"}},
+		{`SELECT "say "";"" x" FROM t; COMMIT`, []string{`SELECT "say "";"" x" FROM t`, "COMMIT"}},
+		{"", []string{}},
+		{"SELECT a FROM t -- don't; stop", []string{"SELECT a FROM t"}},
+		{"/* first; */ SELECT a/*;*/FROM t; -- only a comment", []string{"SELECT a FROM t"}},
+		{"SELECT s FROM t WHERE s = '--;/*'; COMMIT", []string{"SELECT s FROM t WHERE s = '--;/*'", "COMMIT"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, splitStatements(tt.input), "input %q", tt.input)
+	}
+}
+
+func TestServer_Batch(t *testing.T) {
+	addr := startTestServer(t)
+	c := dialTestClient(t, addr)
+	setupAccounts(t, c)
+
+	responses, err := c.execBatch(
+		"INSERT INTO accounts (id, balance) VALUES (3, 300)",
+		"UPDATE accounts SET balance = 0 WHERE id = 1",
+		"SELECT balance FROM accounts WHERE id = 1",
+	)
+	require.NoError(t, err)
+	require.Len(t, responses, 3)
+	assert.Equal(t, 1, responses[0].Affected)
+	assert.Equal(t, 1, responses[1].Affected)
+	assert.Equal(t, 0, balanceOf(t, responses[2]))
+
+	// Statements after BEGIN share one transaction, which a later batch can roll back
+	responses, err = c.execBatch("BEGIN", "UPDATE accounts SET balance = 5 WHERE id = 2")
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Equal(t, "BEGIN", responses[0].Message)
+	c.mustExec(t, "ROLLBACK")
+	assert.Equal(t, 200, balanceOf(t, c.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")))
+
+	// Execution stops at the first failing statement
+	responses, err = c.execBatch(
+		"UPDATE accounts SET balance = 7 WHERE id = 2",
+		"SELECT nope FROM missing",
+		"UPDATE accounts SET balance = 8 WHERE id = 2",
+	)
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	assert.Empty(t, responses[0].Error)
+	assert.NotEmpty(t, responses[1].Error)
+	assert.Equal(t, 7, balanceOf(t, c.mustExec(t, "SELECT balance FROM accounts WHERE id = 2")))
+
+	// A single statement still gets a single response
+	resp := c.mustExec(t, "SELECT balance FROM accounts WHERE id = 3;")
+	assert.Equal(t, 300, balanceOf(t, resp))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProtocolVersion is the newest version of the protocol the server speaks. A client sends
+	// VERSION with the newest one it speaks, and the connection uses the older of the two.
+	ProtocolVersion = 1
+	// MinProtocolVersion is the oldest version of the protocol the server still speaks
+	MinProtocolVersion = 1
+)
+
+// controlCommand answers a line that is a PING or a VERSION command, whether the connection
+// has authenticated yet or not, and returns false for any other line. Neither command opens
+// a transaction, so they are cheap enough for liveness checks.
+func controlCommand(session *Session, line string) (QueryResponse, bool) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+	if len(fields) == 0 {
+		return QueryResponse{}, false
+	}
+	switch {
+	case len(fields) == 1 && strings.EqualFold(fields[0], "PING"):
+		return QueryResponse{Type: "pong", Message: "PONG"}, true
+	case strings.EqualFold(fields[0], "VERSION"):
+		return negotiateVersion(session, fields[1:]), true
+	}
+	return QueryResponse{}, false
+}
+
+// negotiateVersion answers a VERSION command. Without an argument it returns the version the
+// session uses. With the newest version the client speaks, the session switches to the older
+// of it and ProtocolVersion, which fails if the client's is older than MinProtocolVersion.
+func negotiateVersion(session *Session, args []string) QueryResponse {
+	if len(args) > 1 {
+		return QueryResponse{Type: "error", Error: "expected VERSION or VERSION n"}
+	}
+	if len(args) == 1 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 1 {
+			return QueryResponse{Type: "error", Error: fmt.Sprintf("invalid protocol version %q", args[0])}
+		}
+		if version < MinProtocolVersion {
+			return QueryResponse{
+				Type:  "error",
+				Error: fmt.Sprintf("protocol version %d is no longer supported, the oldest is %d", version, MinProtocolVersion),
+			}
+		}
+		session.protocolVersion = min(version, ProtocolVersion)
+	}
+	return QueryResponse{
+		Type:    "version",
+		Message: fmt.Sprintf("Using protocol version %d", session.protocolVersion),
+		Version: session.protocolVersion,
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// Session holds the per-connection state of a client.
+// A session starts in autocommit mode, where every statement runs in its own
+// transaction. After BEGIN, all statements share a single transaction until
+// COMMIT or ROLLBACK ends it.
+type Session struct {
+	tx *transaction.Transaction
+	// returnRIDs reports the RIDs of inserted and modified records in update responses.
+	returnRIDs bool
+	// streamRows sends the rows of a query one by one as they are read, instead of in one response.
+	streamRows bool
+	// isolation is the isolation level of transactions started by the session.
+	isolation transaction.IsolationLevel
+	// queryTimeout cancels a statement of the session that runs longer, or is 0 to never
+	// cancel statements.
+	queryTimeout time.Duration
+	// parallel is the number of goroutines that aggregate a single table, or 1 to do it serially.
+	parallel int
+	// cursors holds the session's open cursors by name.
+	cursors map[string]*cursor
+	// protocolVersion is the version of the protocol agreed on with VERSION.
+	protocolVersion int
+}
+
+// NewSession creates a new session in autocommit mode
+func NewSession() *Session {
+	return &Session{parallel: 1, cursors: map[string]*cursor{}, protocolVersion: ProtocolVersion}
+}
+
+// newTransaction starts a transaction at the session's isolation level
+func (s *Session) newTransaction(server *Server) *transaction.Transaction {
+	return transaction.NewTransactionWithIsolation(server.fileManager, server.logManager, server.bufferManager, server.lockTable, s.isolation)
+}
+
+// InTransaction returns true if the session has an explicit transaction open
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// closeCursors closes every open cursor of the session.
+func (s *Session) closeCursors() error {
+	var errs []error
+	for name, c := range s.cursors {
+		delete(s.cursors, name)
+		errs = append(errs, c.close(false))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// A setting is a value of a session that SET changes and SHOW reads, e.g.
+// SET stream_rows = ON and SHOW stream_rows.
+type setting struct {
+	// set checks a value given to SET and applies it to the session
+	set func(session *Session, value string) error
+	// get returns the session's value, written the way SET takes it
+	get func(session *Session) string
+}
+
+// settings holds every setting by its name.
+var settings = map[string]setting{
+	"return_rids":   boolSetting(func(session *Session) *bool { return &session.returnRIDs }),
+	"stream_rows":   boolSetting(func(session *Session) *bool { return &session.streamRows }),
+	"isolation":     isolationSetting(),
+	"query_timeout": durationSetting(func(session *Session) *time.Duration { return &session.queryTimeout }),
+	"parallel":      intSetting(1, MaxParallel, func(session *Session) *int { return &session.parallel }),
+}
+
+// MaxParallel bounds the parallel setting. Each worker keeps a buffer pinned, so that
+// the workers of a query leave most of the buffer pool to other transactions.
+const MaxParallel = 8
+
+// intSetting is a setting holding a number from min to max
+func intSetting(min, max int, field func(session *Session) *int) setting {
+	return setting{
+		set: func(session *Session, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < min || n > max {
+				return fmt.Errorf("expected a number from %d to %d", min, max)
+			}
+			*field(session) = n
+			return nil
+		},
+		get: func(session *Session) string {
+			return strconv.Itoa(*field(session))
+		},
+	}
+}
+
+// boolSetting is a setting that is either ON or OFF
+func boolSetting(field func(session *Session) *bool) setting {
+	return setting{
+		set: func(session *Session, value string) error {
+			switch strings.ToLower(value) {
+			case "on", "true":
+				*field(session) = true
+			case "off", "false":
+				*field(session) = false
+			default:
+				return fmt.Errorf("expected ON or OFF")
+			}
+			return nil
+		},
+		get: func(session *Session) string {
+			if *field(session) {
+				return "ON"
+			}
+			return "OFF"
+		},
+	}
+}
+
+// durationSetting is a setting holding a duration such as 500ms or 1m30s, where 0 means none
+func durationSetting(field func(session *Session) *time.Duration) setting {
+	return setting{
+		set: func(session *Session, value string) error {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return fmt.Errorf("expected a duration such as 500ms or 1m30s")
+			}
+			*field(session) = d
+			return nil
+		},
+		get: func(session *Session) string {
+			return field(session).String()
+		},
+	}
+}
+
+// isolationSetting is the isolation level of the transactions the session starts. Changing it
+// doesn't affect a transaction that is already open.
+func isolationSetting() setting {
+	return setting{
+		set: func(session *Session, value string) error {
+			switch strings.ToLower(value) {
+			case "read committed":
+				session.isolation = transaction.ReadCommitted
+			case "repeatable read":
+				session.isolation = transaction.RepeatableRead
+			default:
+				return fmt.Errorf("expected READ COMMITTED or REPEATABLE READ")
+			}
+			return nil
+		},
+		get: func(session *Session) string {
+			return session.isolation.String()
+		},
+	}
+}
+
+// parseSet splits a SET statement into the name of the setting and its value. The value
+// may follow an "=", or just a space: SET isolation READ COMMITTED. A quoted value has its
+// quotes removed. ok is false if the statement isn't a SET statement.
+func parseSet(sql string) (name string, value string, ok bool) {
+	fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(sql), ";"))
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "set") {
+		return "", "", false
+	}
+	rest := strings.Join(fields[1:], " ")
+	name, value, found := strings.Cut(rest, "=")
+	if !found {
+		name, value, _ = strings.Cut(rest, " ")
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		value = value[1 : len(value)-1]
+	}
+	return name, value, true
+}
+
+// set changes a setting of the session.
+func (s *Server) set(session *Session, name string, value string) QueryResponse {
+	if name == "" || value == "" {
+		return QueryResponse{Type: "error", Error: "usage: SET <setting> = <value>"}
+	}
+	setting, ok := settings[name]
+	if !ok {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("unknown setting: %s", name)}
+	}
+	if err := setting.set(session, value); err != nil {
+		return QueryResponse{Type: "error", Error: fmt.Sprintf("invalid value %q for %s: %v", value, name, err)}
+	}
+	return QueryResponse{Type: "setting", Message: "SET"}
+}
+
+// showSettings returns the value of a setting of the session, or of every setting when
+// name is "all", one row each.
+func (s *Server) showSettings(session *Session, name string) QueryResponse {
+	names := []string{name}
+	if name == "all" {
+		names = names[:0]
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	rows := []map[string]interface{}{}
+	for _, name := range names {
+		rows = append(rows, map[string]interface{}{
+			"setting": name,
+			"value":   settings[name].get(session),
+		})
+	}
+	return QueryResponse{
+		Type:    "query",
+		Rows:    rows,
+		Columns: []string{"setting", "value"},
+	}
+}
+
+// isShowSettings checks if the statement is SHOW ALL or SHOW followed by the name of a
+// setting, and returns that name in lowercase.
+func isShowSettings(sql string) (string, bool) {
+	words := strings.Fields(strings.ToLower(strings.TrimSuffix(strings.TrimSpace(sql), ";")))
+	if len(words) != 2 || words[0] != "show" {
+		return "", false
+	}
+	if _, ok := settings[words[1]]; !ok && words[1] != "all" {
+		return "", false
+	}
+	return words[1], true
+}
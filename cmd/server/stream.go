@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// streamQuery runs a query for the session and sends its rows to the client while they are
+// read, so that a large result never has to be held in memory. It answers with:
+//   - a "stream" response holding the columns,
+//   - one line per row: a JSON array of its values in column order,
+//   - an "end" response, or an "error" response if the query failed part way.
+//
+// A query that fails before its first row is answered with only the error response.
+// The scan stays open until the last row is sent, and a query outside of an explicit
+// transaction is committed only then.
+func (s *Server) streamQuery(session *Session, sql string, writer *bufio.Writer) QueryResponse {
+	queryPreview := previewQuery(sql)
+	log.Printf("Streaming query: %s", queryPreview)
+
+	return s.runInTransaction(session, queryPreview, func(tx *transaction.Transaction) (QueryResponse, error) {
+		return s.streamRows(session, tx, sql, writer)
+	})
+}
+
+// streamRows writes the stream response and the rows of a query. The rows are buffered by
+// the writer, which sends them whenever it fills up; a client that reads slowly blocks
+// the query instead of making the server hold its rows.
+func (s *Server) streamRows(session *Session, tx *transaction.Transaction, sql string, writer *bufio.Writer) (QueryResponse, error) {
+	defer startTimeout(tx, session.queryTimeout)()
+
+	queryPlan, queryScan, err := s.openQuery(session, tx, sql)
+	if err != nil {
+		return QueryResponse{Type: "error", Error: err.Error()}, err
+	}
+	defer queryScan.Close()
+
+	columns := queryPlan.Schema().Fields()
+	writeResponse(writer, QueryResponse{Type: "stream", Columns: columns})
+	for count := 1; ; count++ {
+		hasNext, err := queryScan.Next()
+		if err != nil {
+			err = fmt.Errorf("Failed to read next record: %w", err)
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		if !hasNext {
+			break
+		}
+		if err := s.checkRowCount(count); err != nil {
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		values, err := readRow(queryScan, queryPlan.Schema(), columns)
+		if err != nil {
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		line, err := json.Marshal(values)
+		if err != nil {
+			err = fmt.Errorf("Failed to serialize row: %w", err)
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+		writer.Write(line)
+		if err := writer.WriteByte('\n'); err != nil {
+			// The client is gone, so there is no one to send the rest to
+			return QueryResponse{Type: "error", Error: err.Error()}, err
+		}
+	}
+	return QueryResponse{Type: "end"}, nil
+}
@@ -0,0 +1,243 @@
+// Package cranedb lets Go programs use CraneDB as an embedded database, without
+// running the server. Each call runs in its own transaction, which is committed
+// when the call succeeds and rolled back when it fails.
+//
+//	db, err := cranedb.Open("./data")
+//	if err != nil { ... }
+//	defer db.Close()
+//
+//	_, err = db.Exec("INSERT INTO users (id, name) VALUES (1, 'Alice')")
+//	rows, err := db.Query("SELECT id, name FROM users")
+//	defer rows.Close()
+//	for rows.Next() {
+//		var id int
+//		var name string
+//		err = rows.Scan(&id, &name)
+//	}
+//	err = rows.Err()
+package cranedb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	dblog "github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/plan"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+const (
+	// BlockSize is the size of the blocks of a database opened by this package
+	BlockSize = 400
+	// BufferSize is the number of buffers of a database opened by this package
+	BufferSize = 20
+	// LogFileName is the name of the log file in the database directory
+	LogFileName = "cranedb.log"
+)
+
+// ErrClosed is returned when a closed DB is used
+var ErrClosed = errors.New("database is closed")
+
+// DB is an open database. It is safe for concurrent use; concurrent calls run in
+// separate transactions, which lock the records they use like the server's sessions do.
+type DB struct {
+	fileManager     *file.Manager
+	logManager      *dblog.Manager
+	bufferManager   *buffer.Manager
+	lockTable       *transaction.LockTable
+	metadataManager *metadata.Manager
+	planner         *plan.Planner
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Open opens the database in the given directory, creating it if it doesn't exist.
+// Any transactions left unfinished by an earlier crash are rolled back.
+func Open(dir string) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+	fm, err := file.NewManager(dir, BlockSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file manager: %w", err)
+	}
+
+	isNew := true
+	if _, err := os.Stat(filepath.Join(dir, "tables.tbl")); err == nil {
+		isNew = false
+	}
+	return open(fm, isNew)
+}
+
+// OpenInMemory opens a new database that is kept in memory and lost once it is closed
+func OpenInMemory() (*DB, error) {
+	return open(file.NewMemoryManager(BlockSize), true)
+}
+
+func open(fm *file.Manager, isNew bool) (*DB, error) {
+	if err := metadata.CheckFormat(fm); err != nil {
+		return nil, err
+	}
+	lm, err := dblog.NewManager(fm, LogFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log manager: %w", err)
+	}
+	bm, err := buffer.NewManager(fm, lm, BufferSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create buffer manager: %w", err)
+	}
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	if err := tx.DoRecovery(); err != nil {
+		return nil, fmt.Errorf("failed to perform recovery: %w", err)
+	}
+	if err := fm.RemoveTempFiles(); err != nil {
+		return nil, err
+	}
+	md := metadata.NewManager(isNew, tx)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit initial transaction: %w", err)
+	}
+
+	return &DB{
+		fileManager:     fm,
+		logManager:      lm,
+		bufferManager:   bm,
+		lockTable:       lockTable,
+		metadataManager: md,
+		planner:         plan.NewPlanner(plan.NewBasicQueryPlanner(md), plan.NewBasicUpdatePlanner(md)),
+	}, nil
+}
+
+// Exec runs an update statement, such as CREATE, INSERT, UPDATE, DELETE or COPY,
+// and returns the number of records it affected.
+func (db *DB) Exec(sql string) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrClosed
+	}
+
+	tx := db.newTransaction()
+	count, err := db.exec(sql, tx)
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return 0, fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return count, nil
+}
+
+// Query runs a SELECT statement and returns its rows. The statement's transaction
+// stays open until the rows are closed, so Close must always be called.
+func (db *DB) Query(sql string) (*Rows, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	tx := db.newTransaction()
+	rows, err := db.query(sql, tx, true)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Checkpoint records the running transactions and the changes not yet on disk in the
+// log, without waiting for the transactions or writing the changes, so that recovery
+// after a crash only needs the log from the oldest of them on.
+func (db *DB) Checkpoint() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrClosed
+	}
+	return transaction.Checkpoint(db.logManager, db.bufferManager)
+}
+
+// exec runs an update statement within tx, without ending it.
+// The caller holds the read lock.
+func (db *DB) exec(sql string, tx *transaction.Transaction) (int, error) {
+	return db.planner.ExecuteUpdate(sql, tx)
+}
+
+// query runs a SELECT statement within tx. If endTx is set, closing the rows ends tx.
+// The caller holds the read lock.
+func (db *DB) query(sql string, tx *transaction.Transaction, endTx bool) (*Rows, error) {
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(sql)), "select") {
+		return nil, errors.New("only SELECT statements can be queried, use Exec for updates")
+	}
+
+	queryPlan, err := db.planner.CreatePlan(sql, tx)
+	if err != nil {
+		return nil, err
+	}
+	s, err := queryPlan.Open()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.BeforeFirst(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return newRows(tx, s, queryPlan.Schema(), endTx), nil
+}
+
+// Close saves the table statistics, flushes all changes to disk and closes the
+// database's files. Rows still open must be closed first.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	// Save the table statistics so the next Open doesn't rescan the tables
+	tx := db.newTransaction()
+	if err := db.metadataManager.SaveStats(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit stats: %w", err)
+	}
+
+	if err := db.bufferManager.FlushAllBuffers(); err != nil {
+		return fmt.Errorf("failed to flush buffers: %w", err)
+	}
+	// No transaction is active any more and no buffer is dirty, so a checkpoint
+	// tells recovery that everything before it is finished.
+	if err := transaction.Checkpoint(db.logManager, db.bufferManager); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := db.logManager.Close(); err != nil {
+		return fmt.Errorf("failed to flush log: %w", err)
+	}
+	db.fileManager.Close()
+	return nil
+}
+
+func (db *DB) newTransaction() *transaction.Transaction {
+	return db.newTransactionWithIsolation(transaction.RepeatableRead)
+}
+
+func (db *DB) newTransactionWithIsolation(isolation transaction.IsolationLevel) *transaction.Transaction {
+	return transaction.NewTransactionWithIsolation(db.fileManager, db.logManager, db.bufferManager, db.lockTable, isolation)
+}
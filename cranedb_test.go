@@ -0,0 +1,174 @@
+package cranedb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/metadata"
+)
+
+// queryAll returns the rows of a query as "id:name" strings
+func queryAll(t *testing.T, db *DB, sql string) []string {
+	rows, err := db.Query(sql)
+	require.NoError(t, err)
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var id int
+		var name string
+		require.NoError(t, rows.Scan(&id, &name))
+		result = append(result, fmt.Sprintf("%d:%s", id, name))
+	}
+	require.NoError(t, rows.Err())
+	return result
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT, name VARCHAR(20))",
+		"INSERT INTO users (id, name) VALUES (1, 'Alice')",
+		"INSERT INTO users (id, name) VALUES (2, 'Bob')",
+		"INSERT INTO users (id, name) VALUES (3, 'Carol')",
+	} {
+		_, err := db.Exec(sql)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"1:Alice", "2:Bob", "3:Carol"}, queryAll(t, db, "SELECT id, name FROM users"))
+
+	count, err := db.Exec("UPDATE users SET name = 'Bobby' WHERE id = 2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = db.Exec("DELETE FROM users WHERE id = 3")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// A failing statement changes nothing; this one fails on the second record, by dividing by zero
+	_, err = db.Exec("UPDATE users SET id = 10 / (2 - id)")
+	assert.Error(t, err)
+	_, err = db.Exec("INSERT INTO missing (id, name) VALUES (4, 'Dave')")
+	assert.Error(t, err)
+	_, err = db.Query("DELETE FROM users")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"1:Alice", "2:Bobby"}, queryAll(t, db, "SELECT id, name FROM users"))
+
+	t.Run("Rows", func(t *testing.T) {
+		rows, err := db.Query("SELECT name, id FROM users WHERE id = 1")
+		require.NoError(t, err)
+		defer rows.Close()
+		assert.Equal(t, []string{"name", "id"}, rows.Columns())
+		assert.Equal(t, "int", rows.ColumnType("id"))
+
+		var id int
+		assert.Error(t, rows.Scan(new(string), &id), "Scan before Next fails")
+		require.True(t, rows.Next())
+		var name any
+		assert.Error(t, rows.Scan(&name), "Scan needs a destination for every column")
+		assert.Error(t, rows.Scan(&id, &name), "Scan checks the destination types")
+		require.NoError(t, rows.Scan(&name, &id))
+		assert.Equal(t, "Alice", name)
+		assert.Equal(t, 1, id)
+		assert.False(t, rows.Next())
+		assert.False(t, rows.Next())
+		assert.NoError(t, rows.Err())
+	})
+
+	// The data is still there after reopening
+	require.NoError(t, db.Close())
+	_, err = db.Exec("DELETE FROM users")
+	assert.ErrorIs(t, err, ErrClosed)
+	_, err = db.Query("SELECT id, name FROM users")
+	assert.ErrorIs(t, err, ErrClosed)
+
+	db, err = Open(dir)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, []string{"1:Alice", "2:Bobby"}, queryAll(t, db, "SELECT id, name FROM users"))
+}
+
+func TestDB_InMemory(t *testing.T) {
+	db, err := OpenInMemory()
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE users (id INT, name VARCHAR(20))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO users (id, name) VALUES (1, 'Alice')")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1:Alice"}, queryAll(t, db, "SELECT id, name FROM users"))
+
+	// A checkpoint doesn't wait for the open query's transaction
+	rows, err := db.Query("SELECT id, name FROM users")
+	require.NoError(t, err)
+	require.NoError(t, db.Checkpoint())
+	require.NoError(t, rows.Close())
+}
+
+func TestDB_Format(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE users (id INT, name VARCHAR(20))")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// A database without a format file predates it, and its record pages have no header
+	formatFile := filepath.Join(dir, metadata.FormatFileName)
+	version, err := os.ReadFile(formatFile)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(formatFile))
+	_, err = Open(dir)
+	assert.ErrorIs(t, err, metadata.ErrUnsupportedFormat)
+
+	// Nor does this build read the index records of version 2, which hold values rather
+	// than their keys
+	fm, err := file.NewManager(dir, BlockSize)
+	require.NoError(t, err)
+	page := file.NewPage(BlockSize)
+	page.SetInt(0, 2)
+	require.NoError(t, fm.Write(file.NewBlockID(metadata.FormatFileName, 0), page))
+	fm.Close()
+	_, err = Open(dir)
+	assert.ErrorIs(t, err, metadata.ErrUnsupportedFormat)
+
+	require.NoError(t, os.WriteFile(formatFile, version, 0644))
+	db, err = Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+}
+
+func TestDB_RecordLargerThanBlock(t *testing.T) {
+	db, err := OpenInMemory()
+	require.NoError(t, err)
+	defer db.Close()
+
+	columns := func(n int) string {
+		names := make([]string, n)
+		for i := range names {
+			names[i] = fmt.Sprintf("c%d INT", i)
+		}
+		return strings.Join(names, ", ")
+	}
+	// A slot of 99 ints takes up the whole block, leaving no room for the page's header
+	_, err = db.Exec("CREATE TABLE wide (" + columns(99) + ")")
+	assert.ErrorContains(t, err, "doesn't fit in a block")
+
+	_, err = db.Exec("CREATE TABLE wide (" + columns(98) + ")")
+	require.NoError(t, err)
+	count, err := db.Exec("INSERT INTO wide (c0) VALUES (1)")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -1,22 +1,34 @@
 package buffer
 
 import (
+	"sync"
+
 	"github.com/yashagw/cranedb/internal/file"
 	"github.com/yashagw/cranedb/internal/log"
 )
 
 // Buffer represents a buffer in the buffer pool.
 type Buffer struct {
-	fileManager *file.Manager
+	fileManager file.BlockStore
 	logManager  *log.Manager
 	contents    *file.Page
 	blk         *file.BlockID
 	pins        int
 	txNum       int
 	lsn         int
+	// recLSN is the LSN of the first logged change to the block since it was last
+	// written to disk, or -1 if there is none
+	recLSN int
+	// mu guards txNum, lsn and recLSN, which are set by the modifying transaction
+	// while other transactions may be inspecting them in FlushAll.
+	mu sync.Mutex
+	// latch guards the bytes of the page while they are read, changed or written to disk.
+	// Unlike the locks of transactions, it is only held for a single access to the page,
+	// and is taken before mu.
+	latch sync.RWMutex
 }
 
-func NewBuffer(fm *file.Manager, lm *log.Manager) *Buffer {
+func NewBuffer(fm file.BlockStore, lm *log.Manager) *Buffer {
 	return &Buffer{
 		fileManager: fm,
 		logManager:  lm,
@@ -25,6 +37,7 @@ func NewBuffer(fm *file.Manager, lm *log.Manager) *Buffer {
 		pins:        0,
 		txNum:       -1,
 		lsn:         -1,
+		recLSN:      -1,
 	}
 }
 
@@ -32,6 +45,28 @@ func (b *Buffer) Contents() *file.Page {
 	return b.contents
 }
 
+// Latch waits until no one else is accessing the page, and keeps others from accessing it
+// until Unlatch is called. It is held while the page is changed.
+func (b *Buffer) Latch() {
+	b.latch.Lock()
+}
+
+// Unlatch releases the latch taken by Latch
+func (b *Buffer) Unlatch() {
+	b.latch.Unlock()
+}
+
+// LatchShared waits until no one is changing the page, and keeps others from changing it
+// until UnlatchShared is called. It is held while the page is read.
+func (b *Buffer) LatchShared() {
+	b.latch.RLock()
+}
+
+// UnlatchShared releases the latch taken by LatchShared
+func (b *Buffer) UnlatchShared() {
+	b.latch.RUnlock()
+}
+
 func (b *Buffer) Block() *file.BlockID {
 	return b.blk
 }
@@ -41,16 +76,27 @@ func (b *Buffer) IsPinned() bool {
 }
 
 // SetModified marks this buffer as modified by the specified transaction.
-// If lsn is non-negative, it also sets the log sequence number.
+// If lsn is non-negative, it also sets the log sequence number, which becomes
+// the PageLSN of the block, and the recLSN of the block if it had no logged change yet.
 func (b *Buffer) SetModified(txnum int, lsn int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	b.txNum = txnum
 	if lsn >= 0 {
 		b.lsn = lsn
+		b.contents.SetLSN(lsn)
+		if b.recLSN < 0 {
+			b.recLSN = lsn
+		}
 	}
 }
 
 // ModifyingTx returns the transaction number that modified this buffer.
 func (b *Buffer) ModifyingTx() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	return b.txNum
 }
 
@@ -60,7 +106,9 @@ func (b *Buffer) loadBlock(blk *file.BlockID) error {
 	if err != nil {
 		return err
 	}
-	b.blk = blk
+	// Until the block is read, the buffer holds no block, so that its old
+	// contents are never mistaken for the block's
+	b.blk = nil
 
 	numBlocks, err := b.fileManager.GetTotalBlocks(blk.Filename())
 	if err != nil {
@@ -82,11 +130,17 @@ func (b *Buffer) loadBlock(blk *file.BlockID) error {
 		return err
 	}
 
+	b.blk = blk
 	b.pins = 0
 	return nil
 }
 
 func (b *Buffer) flush() error {
+	b.LatchShared()
+	defer b.UnlatchShared()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	if b.txNum >= 0 {
 		err := b.logManager.Flush(b.lsn)
 		if err != nil {
@@ -97,11 +151,23 @@ func (b *Buffer) flush() error {
 			return err
 		}
 		b.txNum = -1
+		b.recLSN = -1
 	}
 
 	return nil
 }
 
+// discard unassigns the buffer from its block, dropping any changes to it
+func (b *Buffer) discard() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.blk = nil
+	b.txNum = -1
+	b.lsn = -1
+	b.recLSN = -1
+}
+
 func (b *Buffer) pin() {
 	b.pins++
 }
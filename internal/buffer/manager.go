@@ -2,6 +2,7 @@ package buffer
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 
 // Manager manages a pool of buffers.
 type Manager struct {
+	fileManager  file.BlockStore
 	bufferpool   []*Buffer
 	numAvailable int
 	maxTime      time.Duration
@@ -18,7 +20,7 @@ type Manager struct {
 	cond         *sync.Cond
 }
 
-func NewManager(fileManager *file.Manager, logManager *log.Manager, numOfBuffer int) (*Manager, error) {
+func NewManager(fileManager file.BlockStore, logManager *log.Manager, numOfBuffer int) (*Manager, error) {
 	if numOfBuffer <= 0 {
 		return nil, errors.New("number of buffers must be positive")
 	}
@@ -29,6 +31,7 @@ func NewManager(fileManager *file.Manager, logManager *log.Manager, numOfBuffer
 	}
 
 	bm := &Manager{
+		fileManager:  fileManager,
 		bufferpool:   bufferpool,
 		numAvailable: numOfBuffer,
 		maxTime:      10 * time.Second,
@@ -58,6 +61,70 @@ func (bm *Manager) FlushAll(txnum int) error {
 	return nil
 }
 
+// FlushAllBuffers writes every modified buffer to disk, whichever transaction modified it.
+func (bm *Manager) FlushAllBuffers() error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	for _, buff := range bm.bufferpool {
+		err := buff.flush()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DirtyPage is an entry of the dirty page table: a block whose buffer holds logged changes
+// that aren't on disk yet, along with the LSN of the first of them.
+type DirtyPage struct {
+	Block  *file.BlockID
+	RecLSN int
+}
+
+// DirtyPageTable returns the blocks whose buffers hold logged changes that aren't on disk yet.
+// Recovery after a crash only needs to repeat the logged changes from the lowest recLSN on.
+func (bm *Manager) DirtyPageTable() []DirtyPage {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	pages := []DirtyPage{}
+	for _, buff := range bm.bufferpool {
+		buff.mu.Lock()
+		if buff.blk != nil && buff.recLSN >= 0 {
+			pages = append(pages, DirtyPage{Block: buff.blk, RecLSN: buff.recLSN})
+		}
+		buff.mu.Unlock()
+	}
+	return pages
+}
+
+// Truncate shrinks the file to its first numBlocks blocks. The buffers holding any of
+// the dropped blocks are emptied without writing them, so that nothing is read from or
+// written to the file past its new end. It fails, changing nothing, if any of those
+// buffers is pinned.
+func (bm *Manager) Truncate(filename string, numBlocks int) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+
+	var dropped []*Buffer
+	for _, buff := range bm.bufferpool {
+		block := buff.Block()
+		if block == nil || block.Filename() != filename || block.Number() < numBlocks {
+			continue
+		}
+		if buff.IsPinned() {
+			return fmt.Errorf("block %s is pinned", block.String())
+		}
+		dropped = append(dropped, buff)
+	}
+	for _, buff := range dropped {
+		buff.discard()
+	}
+	// The mutex stays locked, so no buffer can load a dropped block before it is gone
+	return bm.fileManager.Truncate(filename, numBlocks)
+}
+
 func (bm *Manager) Unpin(buff *Buffer) {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
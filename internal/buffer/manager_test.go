@@ -1,7 +1,9 @@
 package buffer
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -64,6 +66,89 @@ func TestManager_BasicOperations(t *testing.T) {
 	err = bm.FlushAll(123)
 	require.NoError(t, err, "FlushAll should succeed")
 
+	// The LSN of the modification is stored with the block
+	page := file.NewPage(blockSize)
+	require.NoError(t, fm.Read(blk1, page))
+	assert.Equal(t, 456, page.LSN(), "Flushed block should keep its PageLSN")
+
 	// Clean up
 	bm.Unpin(buff2)
 }
+
+func TestManager_CorruptBlock(t *testing.T) {
+	dbDir := t.TempDir()
+	blockSize := 400
+	require.NoError(t, file.EnableChecksums(dbDir))
+
+	fm, err := file.NewManager(dbDir, blockSize)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := NewManager(fm, lm, 3)
+	require.NoError(t, err)
+
+	blk, err := fm.Append("testfile")
+	require.NoError(t, err)
+	page := file.NewPage(blockSize)
+	page.SetInt(0, 42)
+	require.NoError(t, fm.Write(blk, page))
+
+	// Corrupt the block on disk
+	f, err := os.OpenFile(filepath.Join(dbDir, "testfile"), os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff}, 20)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Pinning fails every time rather than handing out the buffer the read failed into
+	for i := 0; i < 2; i++ {
+		_, err = bm.Pin(blk)
+		var corrupt *file.CorruptBlockError
+		assert.True(t, errors.As(err, &corrupt))
+	}
+	assert.Equal(t, 3, bm.Available())
+}
+
+// TestManager_StoreErrors checks that a failed read or write of the block store fails the pin,
+// and that a change the write failed for is kept until it can be written
+func TestManager_StoreErrors(t *testing.T) {
+	blockSize := 400
+	store := file.NewFaultyStore(file.NewMemoryManager(blockSize))
+	defer store.Close()
+	errDisk := errors.New("disk error")
+	lm, err := log.NewManager(store, "testlog")
+	require.NoError(t, err)
+	bm, err := NewManager(store, lm, 1)
+	require.NoError(t, err)
+
+	blk1 := file.NewBlockID("testfile", 0)
+	blk2 := file.NewBlockID("testfile", 1)
+
+	store.Fail(file.StoreRead, errDisk, 1)
+	_, err = bm.Pin(blk1)
+	assert.ErrorIs(t, err, errDisk)
+	assert.Equal(t, 1, bm.Available())
+
+	buff, err := bm.Pin(blk1)
+	require.NoError(t, err)
+	buff.Contents().SetInt(0, 42)
+	buff.SetModified(1, 0)
+	bm.Unpin(buff)
+
+	// The only buffer can't be reused for another block while its change can't be written
+	store.Fail(file.StoreWrite, errDisk, -1)
+	_, err = bm.Pin(blk2)
+	assert.ErrorIs(t, err, errDisk)
+	assert.Equal(t, 1, bm.Available())
+	assert.Equal(t, blk1, buff.Block())
+
+	store.Heal(file.StoreWrite)
+	buff, err = bm.Pin(blk2)
+	require.NoError(t, err)
+	bm.Unpin(buff)
+	page := file.NewPage(blockSize)
+	require.NoError(t, store.Read(blk1, page))
+	assert.Equal(t, 42, page.GetInt(0))
+}
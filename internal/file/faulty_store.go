@@ -0,0 +1,99 @@
+package file
+
+import "sync"
+
+var (
+	_ BlockStore = (*FaultyStore)(nil)
+)
+
+// StoreOp is an operation of a BlockStore a FaultyStore can be set to fail.
+type StoreOp int
+
+const (
+	StoreRead StoreOp = iota
+	StoreWrite
+	StoreAppend
+	StoreTruncate
+)
+
+// FaultyStore is a BlockStore that passes its operations on to another one, except those it
+// is set to fail, like a disk that has errors. It is meant for tests of how the layers above
+// the store handle its errors.
+type FaultyStore struct {
+	BlockStore
+	// faults holds the error and the number of remaining failures of each failing operation,
+	// a negative number for an operation that fails until it is healed
+	faults map[StoreOp]fault
+	mu     sync.Mutex
+}
+
+type fault struct {
+	err       error
+	remaining int
+}
+
+// NewFaultyStore creates a store that fails nothing until it is told to.
+func NewFaultyStore(store BlockStore) *FaultyStore {
+	return &FaultyStore{
+		BlockStore: store,
+		faults:     make(map[StoreOp]fault),
+	}
+}
+
+// Fail makes the next count calls of the operation fail with err, without reaching the
+// underlying store. A negative count makes every call fail until Heal is called.
+func (s *FaultyStore) Fail(op StoreOp, err error, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[op] = fault{err: err, remaining: count}
+}
+
+// Heal stops the operation from failing.
+func (s *FaultyStore) Heal(op StoreOp) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.faults, op)
+}
+
+// fail returns the error a call of the operation fails with, or nil if it doesn't fail.
+func (s *FaultyStore) fail(op StoreOp) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.faults[op]
+	if !ok || f.remaining == 0 {
+		return nil
+	}
+	if f.remaining > 0 {
+		f.remaining--
+		s.faults[op] = f
+	}
+	return f.err
+}
+
+func (s *FaultyStore) Read(blk *BlockID, p *Page) error {
+	if err := s.fail(StoreRead); err != nil {
+		return err
+	}
+	return s.BlockStore.Read(blk, p)
+}
+
+func (s *FaultyStore) Write(blk *BlockID, p *Page) error {
+	if err := s.fail(StoreWrite); err != nil {
+		return err
+	}
+	return s.BlockStore.Write(blk, p)
+}
+
+func (s *FaultyStore) Append(filename string) (*BlockID, error) {
+	if err := s.fail(StoreAppend); err != nil {
+		return nil, err
+	}
+	return s.BlockStore.Append(filename)
+}
+
+func (s *FaultyStore) Truncate(filename string, numBlocks int) error {
+	if err := s.fail(StoreTruncate); err != nil {
+		return err
+	}
+	return s.BlockStore.Truncate(filename, numBlocks)
+}
@@ -0,0 +1,49 @@
+package file
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultyStore(t *testing.T) {
+	blockSize := 400
+	store := NewFaultyStore(NewMemoryManager(blockSize))
+	defer store.Close()
+	errDisk := errors.New("disk error")
+
+	blk, err := store.Append("test.db")
+	require.NoError(t, err)
+	page := NewPage(blockSize)
+	page.SetInt(0, 7)
+
+	// A count of failures runs out
+	store.Fail(StoreWrite, errDisk, 2)
+	for range 2 {
+		assert.ErrorIs(t, store.Write(blk, page), errDisk)
+	}
+	require.NoError(t, store.Write(blk, page))
+
+	// A negative count fails until healed, and only that operation
+	store.Fail(StoreRead, errDisk, -1)
+	for range 3 {
+		assert.ErrorIs(t, store.Read(blk, NewPage(blockSize)), errDisk)
+	}
+	_, err = store.Append("test.db")
+	require.NoError(t, err)
+	store.Heal(StoreRead)
+	readPage := NewPage(blockSize)
+	require.NoError(t, store.Read(blk, readPage))
+	assert.Equal(t, 7, readPage.GetInt(0))
+
+	store.Fail(StoreTruncate, errDisk, 1)
+	assert.ErrorIs(t, store.Truncate("test.db", 1), errDisk)
+	store.Fail(StoreAppend, errDisk, 1)
+	_, err = store.Append("test.db")
+	assert.ErrorIs(t, err, errDisk)
+	total, err := store.GetTotalBlocks("test.db")
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+}
@@ -1,29 +1,129 @@
 package file
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
+// TempFilePrefix starts the names of files that only hold data for the duration of a query.
+// The "-" keeps them apart from table files, since it can't appear in a table name.
+const TempFilePrefix = "temp-"
+
+// ChecksumsFileName is the name of the file whose presence in a database directory
+// means that every block of the database is stored with a checksum.
+const ChecksumsFileName = "block_checksums"
+
+// checksumSize is the size of the header that holds a block's checksum on disk
+const checksumSize = 4
+
+// pageLSNSize is the size of the header that holds a block's PageLSN on disk
+const pageLSNSize = 4
+
+// A write that fails with a transient error, such as an interrupted system call, is tried
+// again up to writeRetries times, waiting writeRetryBackoff before the first retry and twice
+// as long before each next one.
+const (
+	writeRetries      = 3
+	writeRetryBackoff = 10 * time.Millisecond
+)
+
+// CorruptBlockError is returned when a block read from disk doesn't match its checksum.
+type CorruptBlockError struct {
+	Block *BlockID
+}
+
+func (e *CorruptBlockError) Error() string {
+	return "corrupt block " + e.Block.String() + ": checksum mismatch"
+}
+
+// blockFile is a file holding the blocks of a Manager, on disk or in memory
+type blockFile interface {
+	io.ReaderAt
+	io.WriterAt
+	// Size returns the size of the file in bytes
+	Size() (int64, error)
+	// Truncate changes the size of the file, like os.File.Truncate
+	Truncate(size int64) error
+	Close() error
+}
+
+// diskFile is a blockFile stored on disk
+type diskFile struct {
+	*os.File
+}
+
+func (f diskFile) Size() (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return fi.Size(), nil
+}
+
+var (
+	_ BlockStore = (*Manager)(nil)
+)
+
+// BlockStore stores files as numbered blocks of a fixed size. The log, the buffer pool and
+// transactions read and write blocks through it, so they work the same over any storage
+// that implements it. Manager is the implementation for a database directory or for memory.
+type BlockStore interface {
+	// Read reads the contents and the LSN of an existing block into the page
+	Read(blk *BlockID, p *Page) error
+	// Write writes the contents and the LSN of the page to the block
+	Write(blk *BlockID, p *Page) error
+	// Append adds a block of zeros to the end of the file and returns it
+	Append(filename string) (*BlockID, error)
+	// Truncate drops the blocks of the file from numBlocks on
+	Truncate(filename string, numBlocks int) error
+	// GetTotalBlocks returns the number of blocks of the file, 0 if it doesn't exist
+	GetTotalBlocks(filename string) (int, error)
+	// BlockSize returns the size of every block, which is the size of a Page
+	BlockSize() int
+	// Close releases the files of the store
+	Close()
+}
+
 // Manager manages disk files as fixed-size blocks.
 // Each block is the same size as a Page.
 // Page is the in-memory representation of a block
 // - Read: BlockID → load block from disk → store in Page
 // - Modify: change data in Page
 // - Write: Page → write back to disk at BlockID location
+//
+// Each block is stored on disk behind a header holding its PageLSN, the LSN of the last
+// logged change to it, which recovery compares with the LSNs of log records to tell whether
+// their change reached the disk. If the database uses checksums, the header also holds the
+// checksum of the rest of the block. The header isn't part of the Page contents, so the
+// layout of the page contents (including any header a page keeps itself) is the same either way.
+//
+// A Manager created by NewMemoryManager keeps its files in memory instead.
 type Manager struct {
 	blockSize   int
 	dbDir       string
-	openedFiles map[string]*os.File
-	mu          sync.Mutex
+	openedFiles map[string]blockFile
+	// inMemory is set if the files are kept in memory, in which case dbDir is empty
+	inMemory  bool
+	checksums bool
+	// diskBlock holds a block as it is stored on disk, behind its header
+	diskBlock []byte
+	// blocksRead counts the blocks read from each file
+	blocksRead map[string]int
+	mu         sync.Mutex
 }
 
-// NewManager creates a new file manager for the specified directory
+// NewManager creates a new file manager for the specified directory.
+// Block checksums are used if the database was set up with EnableChecksums.
 func NewManager(dbDir string, blockSize int) (*Manager, error) {
 	_, err := os.Stat(dbDir)
 	if os.IsNotExist(err) {
@@ -33,11 +133,44 @@ func NewManager(dbDir string, blockSize int) (*Manager, error) {
 		}
 	}
 
-	return &Manager{
+	checksums := false
+	if _, err := os.Stat(filepath.Join(dbDir, ChecksumsFileName)); err == nil {
+		checksums = true
+	}
+
+	fm := &Manager{
 		blockSize:   blockSize,
 		dbDir:       dbDir,
-		openedFiles: make(map[string]*os.File),
-	}, nil
+		openedFiles: make(map[string]blockFile),
+		checksums:   checksums,
+		blocksRead:  make(map[string]int),
+	}
+	fm.diskBlock = make([]byte, fm.diskBlockSize())
+	return fm, nil
+}
+
+// EnableChecksums sets up a new database directory so that its blocks are stored with
+// checksums, which are verified whenever a block is read. Since this changes how blocks
+// are stored, it fails for a directory that already holds a database without them.
+func EnableChecksums(dbDir string) error {
+	entries, err := os.ReadDir(dbDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read database directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == ChecksumsFileName {
+			return nil
+		}
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("database in %s was created without block checksums", dbDir)
+	}
+
+	err = os.MkdirAll(dbDir, 0755)
+	if err != nil {
+		return errors.New("failed to create database directory: " + err.Error())
+	}
+	return os.WriteFile(filepath.Join(dbDir, ChecksumsFileName), nil, 0666)
 }
 
 // BlockSize returns the block size
@@ -45,7 +178,25 @@ func (fm *Manager) BlockSize() int {
 	return fm.blockSize
 }
 
-// Read reads the contents of the specified block into the provided page.
+// Checksums reports whether blocks are stored with checksums
+func (fm *Manager) Checksums() bool {
+	return fm.checksums
+}
+
+// headerSize returns the number of bytes of the header stored before each block on disk
+func (fm *Manager) headerSize() int {
+	if fm.checksums {
+		return checksumSize + pageLSNSize
+	}
+	return pageLSNSize
+}
+
+// diskBlockSize returns the number of bytes a block takes up on disk
+func (fm *Manager) diskBlockSize() int {
+	return fm.headerSize() + fm.blockSize
+}
+
+// Read reads the contents and the LSN of the specified block into the provided page.
 // Can only read blocks that exist (0 to numBlocks-1).
 func (fm *Manager) Read(blk *BlockID, p *Page) error {
 	fm.mu.Lock()
@@ -60,7 +211,7 @@ func (fm *Manager) Read(blk *BlockID, p *Page) error {
 		return errors.New("failed to get file: " + err.Error())
 	}
 
-	numBlocks, err := fm.GetTotalBlocks(blk.Filename())
+	numBlocks, err := fm.totalBlocks(blk.Filename())
 	if err != nil {
 		return errors.New("failed to get number of blocks: " + err.Error())
 	}
@@ -70,15 +221,61 @@ func (fm *Manager) Read(blk *BlockID, p *Page) error {
 		return errors.New("cannot read block: file only has " + strconv.Itoa(numBlocks) + " blocks")
 	}
 
-	_, err = f.ReadAt(p.Bytes(), int64(blk.Number()*fm.blockSize))
+	fm.blocksRead[blk.Filename()]++
+	n, err := f.ReadAt(fm.diskBlock, int64(blk.Number()*fm.diskBlockSize()))
 	if err != nil && !errors.Is(err, io.EOF) {
 		return errors.New("failed to read file: " + err.Error())
 	}
-
+	// Whatever lies past the end of the file reads as zeros
+	clear(fm.diskBlock[n:])
+
+	data := fm.diskBlock
+	if fm.checksums {
+		data = fm.diskBlock[checksumSize:]
+		if !validChecksum(fm.diskBlock[:checksumSize], data) {
+			return &CorruptBlockError{Block: blk}
+		}
+	}
+	p.SetLSN(int(int32(binary.BigEndian.Uint32(data[:pageLSNSize]))))
+	copy(p.Bytes(), data[pageLSNSize:])
 	return nil
 }
 
-// Write writes the contents of the provided page to the specified block.
+// BlocksRead returns the number of blocks read from the file so far. Blocks found in
+// the buffer pool aren't read, so this counts the block accesses that reach the file.
+func (fm *Manager) BlocksRead(filename string) int {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	return fm.blocksRead[filename]
+}
+
+// validChecksum checks the checksum header of a block read from disk against the rest of it.
+// A block that is all zeros, as a file region that was never written reads, is also valid.
+func validChecksum(header []byte, contents []byte) bool {
+	checksum := binary.BigEndian.Uint32(header)
+	if checksum == crc32.ChecksumIEEE(contents) {
+		return true
+	}
+	return checksum == 0 && !slices.ContainsFunc(contents, func(b byte) bool { return b != 0 })
+}
+
+// writeBlock writes the contents of a block to disk, behind its PageLSN and, if checksums
+// are used, its checksum. It assumes that the mutex is already locked.
+func (fm *Manager) writeBlock(f blockFile, blk *BlockID, contents []byte, lsn int) error {
+	data := fm.diskBlock
+	if fm.checksums {
+		data = fm.diskBlock[checksumSize:]
+	}
+	binary.BigEndian.PutUint32(data[:pageLSNSize], uint32(lsn))
+	copy(data[pageLSNSize:], contents)
+	if fm.checksums {
+		binary.BigEndian.PutUint32(fm.diskBlock[:checksumSize], crc32.ChecksumIEEE(data))
+	}
+	_, err := f.WriteAt(fm.diskBlock, int64(blk.Number()*fm.diskBlockSize()))
+	return err
+}
+
+// Write writes the contents and the LSN of the provided page to the specified block.
 func (fm *Manager) Write(blk *BlockID, p *Page) error {
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
@@ -89,17 +286,31 @@ func (fm *Manager) Write(blk *BlockID, p *Page) error {
 
 	f, err := fm.getFile(blk.Filename())
 	if err != nil {
-		return errors.New("failed to get file: " + err.Error())
+		return fmt.Errorf("failed to get file: %w", err)
 	}
 
-	_, err = f.WriteAt(p.Bytes(), int64(blk.Number()*fm.blockSize))
+	backoff := writeRetryBackoff
+	for retry := 0; ; retry++ {
+		err = fm.writeBlock(f, blk, p.Bytes(), p.LSN())
+		if err == nil || retry == writeRetries || !transient(err) {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
 	if err != nil {
-		return errors.New("failed to write file: " + err.Error())
+		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return nil
 }
 
+// transient reports whether an I/O error may not happen again if the operation is retried.
+func transient(err error) bool {
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
 // Append adds a new block to the end of the specified file and returns its BlockID.
 // The new block is initialized with zeros.
 func (fm *Manager) Append(filename string) (*BlockID, error) {
@@ -107,7 +318,7 @@ func (fm *Manager) Append(filename string) (*BlockID, error) {
 	defer fm.mu.Unlock()
 
 	// Get the next block number
-	numBlocks, err := fm.GetTotalBlocks(filename)
+	numBlocks, err := fm.totalBlocks(filename)
 	if err != nil {
 		return nil, errors.New("failed to get number of blocks: " + err.Error())
 	}
@@ -122,7 +333,7 @@ func (fm *Manager) Append(filename string) (*BlockID, error) {
 		return nil, errors.New("failed to get file: " + err.Error())
 	}
 
-	_, err = f.WriteAt(emptyBytes, int64(blk.Number()*fm.blockSize))
+	err = fm.writeBlock(f, blk, emptyBytes, 0)
 	if err != nil {
 		return nil, errors.New("cannot append block: " + blk.String() + ": " + err.Error())
 	}
@@ -130,7 +341,67 @@ func (fm *Manager) Append(filename string) (*BlockID, error) {
 	return blk, nil
 }
 
-// Close closes all opened files
+// Truncate shrinks the specified file to its first numBlocks blocks, dropping the rest.
+// A file that has no more than numBlocks blocks is left alone.
+func (fm *Manager) Truncate(filename string, numBlocks int) error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	total, err := fm.totalBlocks(filename)
+	if err != nil {
+		return err
+	}
+	if numBlocks >= total {
+		return nil
+	}
+
+	f, err := fm.getFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(numBlocks) * int64(fm.diskBlockSize())); err != nil {
+		return fmt.Errorf("failed to truncate file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// RemoveTempFiles deletes the temporary files left over from an earlier run.
+// It must only be called before any query runs, once recovery is done with the log.
+func (fm *Manager) RemoveTempFiles() error {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	if fm.inMemory {
+		for name := range fm.openedFiles {
+			if strings.HasPrefix(name, TempFilePrefix) {
+				delete(fm.openedFiles, name)
+			}
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(fm.dbDir)
+	if err != nil {
+		return fmt.Errorf("failed to read database directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, TempFilePrefix) {
+			continue
+		}
+		if f, ok := fm.openedFiles[name]; ok {
+			f.Close()
+			delete(fm.openedFiles, name)
+		}
+		err := os.Remove(filepath.Join(fm.dbDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to remove temp file %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Close closes all opened files. The files of an in-memory manager are discarded.
 func (fm *Manager) Close() {
 	fm.mu.Lock()
 	defer fm.mu.Unlock()
@@ -147,29 +418,43 @@ func (fm *Manager) Close() {
 // GetTotalBlocks returns the number of blocks in the specified file
 // Blocks are 0-indexed, so a file with blocks 0,1,2,3,4 has count 5.
 func (fm *Manager) GetTotalBlocks(filename string) (int, error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+
+	return fm.totalBlocks(filename)
+}
+
+// totalBlocks returns the number of blocks in the specified file.
+// It assumes that the mutex is already locked.
+func (fm *Manager) totalBlocks(filename string) (int, error) {
 	f, err := fm.getFile(filename)
 	if err != nil {
 		return 0, err
 	}
 
-	fi, err := f.Stat()
+	size, err := f.Size()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get file info: %w", err)
+		return 0, err
 	}
 
-	return int(fi.Size() / int64(fm.blockSize)), nil
+	return int(size / int64(fm.diskBlockSize())), nil
 }
 
 // getFile returns the file with the specified filename, creating it if it does not exist
-func (fm *Manager) getFile(filename string) (*os.File, error) {
+func (fm *Manager) getFile(filename string) (blockFile, error) {
 	f, ok := fm.openedFiles[filename]
 	if ok {
 		return f, nil
 	}
 
-	f, err := os.OpenFile(filepath.Join(fm.dbDir, filename), os.O_RDWR|os.O_CREATE|os.O_SYNC, 0666)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+	if fm.inMemory {
+		f = &memoryFile{}
+	} else {
+		osFile, err := os.OpenFile(filepath.Join(fm.dbDir, filename), os.O_RDWR|os.O_CREATE|os.O_SYNC, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		f = diskFile{osFile}
 	}
 	fm.openedFiles[filename] = f
 
@@ -1,10 +1,14 @@
 package file
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestManager(t *testing.T) {
@@ -52,6 +56,16 @@ func TestManager(t *testing.T) {
 	err = fm.Read(blk1, readPage)
 	assert.NoError(t, err)
 	assert.Equal(t, data2, readPage.GetString(0), "Block 1 data should be the same")
+
+	// Test 4: 8 byte integers keep values beyond 32 bits, negative ones included
+	page.SetLong(100, 1<<40+7)
+	page.SetLong(108, -5000000000)
+	err = fm.Write(blk1, page)
+	assert.NoError(t, err)
+	err = fm.Read(blk1, readPage)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<40+7), readPage.GetLong(100))
+	assert.Equal(t, int64(-5000000000), readPage.GetLong(108))
 }
 
 func TestTotalBlocks(t *testing.T) {
@@ -93,4 +107,193 @@ func TestTotalBlocks(t *testing.T) {
 	numBlocks, err = fm.GetTotalBlocks(filename3)
 	assert.NoError(t, err)
 	assert.Equal(t, 0, numBlocks, "New file should have 0 blocks")
+
+	// Test 4: Truncate drops the last blocks, and appending reuses their numbers
+	require.NoError(t, fm.Truncate(filename1, 2))
+	numBlocks, err = fm.GetTotalBlocks(filename1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, numBlocks, "Truncated file should have 2 blocks")
+	require.NoError(t, fm.Truncate(filename1, 4), "Truncating to a larger size leaves the file alone")
+	blk, err := fm.Append(filename1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, blk.Number())
+}
+
+func TestRemoveTempFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	fm, err := NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	defer fm.Close()
+
+	_, err = fm.Append("users.tbl")
+	assert.NoError(t, err)
+	_, err = fm.Append(TempFilePrefix + "1.tbl")
+	assert.NoError(t, err)
+
+	err = fm.RemoveTempFiles()
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tempDir, "users.tbl"))
+	assert.NoError(t, err, "Table files should be kept")
+	_, err = os.Stat(filepath.Join(tempDir, TempFilePrefix+"1.tbl"))
+	assert.True(t, os.IsNotExist(err), "Temp files should be removed")
+
+	// A removed temp file starts out empty when used again
+	size, err := fm.GetTotalBlocks(TempFilePrefix + "1.tbl")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+}
+
+func TestChecksums(t *testing.T) {
+	tempDir := t.TempDir()
+	blockSize := 400
+
+	require.NoError(t, EnableChecksums(tempDir))
+	// Enabling them again is allowed
+	require.NoError(t, EnableChecksums(tempDir))
+
+	fm, err := NewManager(tempDir, blockSize)
+	require.NoError(t, err)
+	defer fm.Close()
+	assert.True(t, fm.Checksums())
+
+	filename := "test.db"
+	blk0, err := fm.Append(filename)
+	require.NoError(t, err)
+	blk1, err := fm.Append(filename)
+	require.NoError(t, err)
+
+	// Appended blocks read back as empty pages
+	readPage := NewPage(blockSize)
+	require.NoError(t, fm.Read(blk0, readPage))
+	assert.Equal(t, make([]byte, blockSize), readPage.Bytes())
+
+	page := NewPage(blockSize)
+	page.SetString(0, "Hello, World!")
+	require.NoError(t, fm.Write(blk1, page))
+	require.NoError(t, fm.Read(blk1, readPage))
+	assert.Equal(t, "Hello, World!", readPage.GetString(0))
+
+	// A block written past the end leaves a hole, which reads as an empty block
+	require.NoError(t, fm.Write(NewBlockID(filename, 3), page))
+	numBlocks, err := fm.GetTotalBlocks(filename)
+	require.NoError(t, err)
+	assert.Equal(t, 4, numBlocks)
+	require.NoError(t, fm.Read(NewBlockID(filename, 2), readPage))
+	assert.Equal(t, make([]byte, blockSize), readPage.Bytes())
+
+	// Flip a byte of block 1's contents on disk
+	f, err := os.OpenFile(filepath.Join(tempDir, filename), os.O_RDWR, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0xff}, int64(blockSize+checksumSize+pageLSNSize+10))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	readPage = NewPage(blockSize)
+	err = fm.Read(blk1, readPage)
+	var corrupt *CorruptBlockError
+	require.True(t, errors.As(err, &corrupt))
+	assert.Equal(t, blk1.String(), corrupt.Block.String())
+	assert.Equal(t, make([]byte, blockSize), readPage.Bytes(), "A corrupt block isn't copied into the page")
+	assert.NoError(t, fm.Read(blk0, readPage), "Other blocks can still be read")
+
+	// A database created without checksums keeps storing blocks without them
+	plainDir := t.TempDir()
+	plain, err := NewManager(plainDir, blockSize)
+	require.NoError(t, err)
+	defer plain.Close()
+	assert.False(t, plain.Checksums())
+	_, err = plain.Append(filename)
+	require.NoError(t, err)
+	assert.Error(t, EnableChecksums(plainDir))
+}
+
+func TestPageLSN(t *testing.T) {
+	blockSize := 400
+	for _, checksums := range []bool{false, true} {
+		tempDir := t.TempDir()
+		if checksums {
+			require.NoError(t, EnableChecksums(tempDir))
+		}
+		fm, err := NewManager(tempDir, blockSize)
+		require.NoError(t, err)
+
+		filename := "test.db"
+		blk0, err := fm.Append(filename)
+		require.NoError(t, err)
+		blk1, err := fm.Append(filename)
+		require.NoError(t, err)
+
+		page := NewPage(blockSize)
+		page.SetInt(0, 7)
+		page.SetLSN(1234)
+		require.NoError(t, fm.Write(blk1, page))
+
+		// The LSN is stored with the block, outside its contents
+		readPage := NewPage(blockSize)
+		require.NoError(t, fm.Read(blk1, readPage))
+		assert.Equal(t, 1234, readPage.LSN())
+		assert.Equal(t, 7, readPage.GetInt(0))
+		assert.Equal(t, 0, readPage.GetInt(blockSize-4))
+
+		// An appended block has no logged change yet
+		require.NoError(t, fm.Read(blk0, readPage))
+		assert.Equal(t, 0, readPage.LSN())
+		fm.Close()
+	}
+}
+
+// flakyFile is a blockFile whose next writes fail with err
+type flakyFile struct {
+	blockFile
+	err      error
+	failures int
+	writes   int
+}
+
+func (f *flakyFile) WriteAt(p []byte, off int64) (int, error) {
+	f.writes++
+	if f.failures > 0 {
+		f.failures--
+		return 0, &os.PathError{Op: "write", Path: "test.db", Err: f.err}
+	}
+	return f.blockFile.WriteAt(p, off)
+}
+
+func TestWriteRetries(t *testing.T) {
+	blockSize := 400
+	fm := NewMemoryManager(blockSize)
+	defer fm.Close()
+	blk, err := fm.Append("test.db")
+	require.NoError(t, err)
+	flaky := &flakyFile{blockFile: fm.openedFiles["test.db"]}
+	fm.openedFiles["test.db"] = flaky
+
+	page := NewPage(blockSize)
+	readPage := NewPage(blockSize)
+
+	// A transient error is retried until the write goes through
+	flaky.err, flaky.failures = syscall.EINTR, 2
+	page.SetInt(0, 1)
+	require.NoError(t, fm.Write(blk, page))
+	assert.Equal(t, 3, flaky.writes)
+	require.NoError(t, fm.Read(blk, readPage))
+	assert.Equal(t, 1, readPage.GetInt(0))
+
+	// but not forever
+	flaky.writes, flaky.failures = 0, writeRetries+1
+	page.SetInt(0, 2)
+	err = fm.Write(blk, page)
+	assert.ErrorIs(t, err, syscall.EINTR)
+	assert.Equal(t, writeRetries+1, flaky.writes)
+
+	// A permanent error fails the write at once, leaving the block as it was
+	flaky.err, flaky.writes, flaky.failures = syscall.ENOSPC, 0, 1
+	page.SetInt(0, 3)
+	err = fm.Write(blk, page)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	assert.Equal(t, 1, flaky.writes)
+	require.NoError(t, fm.Read(blk, readPage))
+	assert.Equal(t, 1, readPage.GetInt(0))
 }
@@ -0,0 +1,64 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryManager(t *testing.T) {
+	blockSize := 400
+	fm := NewMemoryManager(blockSize)
+	defer fm.Close()
+	assert.True(t, fm.InMemory())
+
+	// Appending and writing blocks keeps them apart
+	blk0, err := fm.Append("test.db")
+	require.NoError(t, err)
+	assert.Equal(t, 0, blk0.Number())
+	blk1, err := fm.Append("test.db")
+	require.NoError(t, err)
+	assert.Equal(t, 1, blk1.Number())
+
+	page := NewPage(blockSize)
+	page.SetString(0, "first")
+	require.NoError(t, fm.Write(blk0, page))
+	page.SetString(0, "second")
+	require.NoError(t, fm.Write(blk1, page))
+
+	readPage := NewPage(blockSize)
+	require.NoError(t, fm.Read(blk0, readPage))
+	assert.Equal(t, "first", readPage.GetString(0))
+	require.NoError(t, fm.Read(blk1, readPage))
+	assert.Equal(t, "second", readPage.GetString(0))
+	assert.Error(t, fm.Read(NewBlockID("test.db", 2), readPage), "Reading past the end fails")
+	assert.Equal(t, 2, fm.BlocksRead("test.db"), "Failed reads aren't counted")
+
+	// Writing past the end grows the file
+	require.NoError(t, fm.Write(NewBlockID("other.db", 4), page))
+	numBlocks, err := fm.GetTotalBlocks("other.db")
+	require.NoError(t, err)
+	assert.Equal(t, 5, numBlocks)
+	require.NoError(t, fm.Read(NewBlockID("other.db", 2), readPage))
+	assert.Equal(t, make([]byte, blockSize), readPage.Bytes(), "Skipped blocks read as zeros")
+
+	// A truncated block comes back as zeros when it is appended again
+	require.NoError(t, fm.Truncate("other.db", 4))
+	blk4, err := fm.Append("other.db")
+	require.NoError(t, err)
+	assert.Equal(t, 4, blk4.Number())
+	require.NoError(t, fm.Read(blk4, readPage))
+	assert.Equal(t, make([]byte, blockSize), readPage.Bytes())
+
+	// Only temp files are removed
+	_, err = fm.Append(TempFilePrefix + "1.tbl")
+	require.NoError(t, err)
+	require.NoError(t, fm.RemoveTempFiles())
+	numBlocks, err = fm.GetTotalBlocks(TempFilePrefix + "1.tbl")
+	require.NoError(t, err)
+	assert.Equal(t, 0, numBlocks)
+	numBlocks, err = fm.GetTotalBlocks("test.db")
+	require.NoError(t, err)
+	assert.Equal(t, 2, numBlocks)
+}
@@ -7,6 +7,9 @@ import (
 // Page represents a block of data in memory
 type Page struct {
 	bytes []byte
+	// lsn is the PageLSN of the block: the LSN of the last logged change to it.
+	// It is stored with the block but isn't part of its bytes.
+	lsn int
 }
 
 // NewPage creates a new page with the specified block size
@@ -28,9 +31,19 @@ func (p *Page) Bytes() []byte {
 	return p.bytes
 }
 
+// LSN returns the PageLSN of the page
+func (p *Page) LSN() int {
+	return p.lsn
+}
+
+// SetLSN sets the PageLSN of the page
+func (p *Page) SetLSN(lsn int) {
+	p.lsn = lsn
+}
+
 // GetInt reads an integer from the specified offset
 func (p *Page) GetInt(offset int) int {
-	return int(binary.BigEndian.Uint32(p.bytes[offset : offset+4]))
+	return int(int32(binary.BigEndian.Uint32(p.bytes[offset : offset+4])))
 }
 
 // SetInt writes an integer at the specified offset
@@ -38,6 +51,16 @@ func (p *Page) SetInt(offset int, val int) {
 	binary.BigEndian.PutUint32(p.bytes[offset:offset+4], uint32(val))
 }
 
+// GetLong reads an 8 byte integer from the specified offset
+func (p *Page) GetLong(offset int) int64 {
+	return int64(binary.BigEndian.Uint64(p.bytes[offset : offset+8]))
+}
+
+// SetLong writes an 8 byte integer at the specified offset
+func (p *Page) SetLong(offset int, val int64) {
+	binary.BigEndian.PutUint64(p.bytes[offset:offset+8], uint64(val))
+}
+
 // GetBytesArray reads a byte array from the specified offset.
 // The format is:
 //   - First 4 bytes: length of the array
@@ -0,0 +1,489 @@
+package index
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+var (
+	_ RangeIndex = (*BTreeIndex)(nil)
+)
+
+// dirEntry is a record of a B-tree directory block: the block of a child, and the key of the
+// smallest value under it.
+type dirEntry struct {
+	dataKey string
+	block   int
+}
+
+// BTreeIndex is an index kept as a B-tree. Its records are sorted by value in a chain of leaf
+// blocks, each pointing to the next, and the blocks of a directory file lead a search to the
+// leaf where a value's records start. Block 0 of the directory is the root.
+//
+// A directory entry points to a child holding values that aren't below the entry's value
+// and aren't above the next entry's, so records with the same value can span leaves. The
+// value of the first entry of a directory block is never looked at: its child holds
+// everything below the second entry's value.
+type BTreeIndex struct {
+	transaction *transaction.Transaction
+	leafLayout  *record.Layout
+	dirLayout   *record.Layout
+	leafFile    string
+	dirFile     string
+	// valueType is the type of the indexed field, whose values the keys are decoded into
+	valueType string
+
+	searchRange keyRange
+	leaf        *btreePage
+	slot        int
+}
+
+// NewBTreeIndex opens the B-tree index with the given name, creating its files if it has
+// none. The layout is that of the index's values: block, id and dataval. The leaf records
+// hold the key encoding of the values instead (see KeyLayout).
+func NewBTreeIndex(transaction *transaction.Transaction, indexName string, layout *record.Layout) (*BTreeIndex, error) {
+	leafLayout := KeyLayout(layout)
+	dirSchema := record.NewSchema()
+	dirSchema.AddIntField("block")
+	dirSchema.Copy(leafLayout.GetSchema(), "dataval")
+
+	bi := &BTreeIndex{
+		transaction: transaction,
+		leafLayout:  leafLayout,
+		dirLayout:   record.NewLayoutFromSchema(dirSchema),
+		leafFile:    indexName + "-leaf.idx",
+		dirFile:     indexName + "-dir.idx",
+		valueType:   layout.GetSchema().Type("dataval"),
+	}
+	// Splitting a block leaves room for a record in both halves only if it holds at least 3
+	// Its pages keep the keys in the slots, so they can't be keys that overflow
+	if (transaction.BlockSize()-btreeHeaderSize)/leafLayout.GetSlotSize() < 3 || leafLayout.Overflows("dataval") {
+		return nil, fmt.Errorf("values of index %s are too long for a B-tree", indexName)
+	}
+
+	size, err := transaction.Size(bi.leafFile)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		if err := bi.create(); err != nil {
+			return nil, err
+		}
+	}
+	return bi, nil
+}
+
+// create makes an empty tree: a root pointing to a single empty leaf.
+func (bi *BTreeIndex) create() error {
+	leaf, err := appendBTreePage(bi.transaction, bi.leafFile, bi.leafLayout, -1)
+	if err != nil {
+		return err
+	}
+	leafBlock := leaf.block.Number()
+	leaf.close()
+
+	root, err := appendBTreePage(bi.transaction, bi.dirFile, bi.dirLayout, 0)
+	if err != nil {
+		return err
+	}
+	defer root.close()
+	return root.insert(0, map[string]any{"block": leafBlock})
+}
+
+// BeforeFirst positions the index before the first record with the search key.
+func (bi *BTreeIndex) BeforeFirst(searchKey any) error {
+	if searchKey == nil {
+		return fmt.Errorf("search key not set")
+	}
+	return bi.BeforeRange(Range{Low: searchKey, LowInclusive: true, High: searchKey, HighInclusive: true})
+}
+
+// BeforeRange positions the index before the first record in the range, at the start of the
+// leaf where values not below the range start.
+func (bi *BTreeIndex) BeforeRange(r Range) error {
+	bi.Close()
+	searchRange, err := r.keys()
+	if err != nil {
+		return err
+	}
+	bi.searchRange = searchRange
+
+	block := 0
+	for {
+		dir, err := newBTreePage(bi.transaction, file.NewBlockID(bi.dirFile, block), bi.dirLayout)
+		if err != nil {
+			return err
+		}
+		level, err := dir.flag()
+		if err == nil {
+			block, err = bi.findChild(dir, searchRange.low, false)
+		}
+		dir.close()
+		if err != nil {
+			return err
+		}
+		if level == 0 {
+			break
+		}
+	}
+
+	leaf, err := newBTreePage(bi.transaction, file.NewBlockID(bi.leafFile, block), bi.leafLayout)
+	if err != nil {
+		return err
+	}
+	bi.leaf = leaf
+	bi.slot = -1
+	return nil
+}
+
+// findChild returns the child of the directory block to go down to for the key.
+func (bi *BTreeIndex) findChild(dir *btreePage, key string, orEqual bool) (int, error) {
+	slot, err := findEntry(dir, key, orEqual)
+	if err != nil {
+		return 0, err
+	}
+	return dir.getInt(slot, "block")
+}
+
+// findEntry returns the slot of the entry of the directory block to go down to for the key:
+// the last one whose key is below it, or isn't above it if orEqual is set. The key of nil,
+// which is below every other, goes to the first entry.
+func findEntry(dir *btreePage, key string, orEqual bool) (int, error) {
+	below, err := dir.countBelow(1, key, orEqual)
+	if err != nil {
+		return 0, err
+	}
+	return below - 1, nil
+}
+
+// Next moves to the next record in the range, following the chain of leaves. It reads on
+// to the first record past the range, so the leaf holding it stays share locked like the
+// others, and a record inserted anywhere in the range has to wait for the lock.
+func (bi *BTreeIndex) Next() (bool, error) {
+	if bi.leaf == nil {
+		return false, fmt.Errorf("index not positioned; call BeforeFirst first")
+	}
+	for {
+		bi.slot++
+		n, err := bi.leaf.numRecs()
+		if err != nil {
+			return false, err
+		}
+		if bi.slot >= n {
+			next, err := bi.leaf.flag()
+			if err != nil {
+				return false, err
+			}
+			if next < 0 {
+				bi.slot = n
+				return false, nil
+			}
+			bi.leaf.close()
+			bi.leaf, err = newBTreePage(bi.transaction, file.NewBlockID(bi.leafFile, next), bi.leafLayout)
+			if err != nil {
+				bi.leaf = nil
+				return false, err
+			}
+			bi.slot = -1
+			continue
+		}
+
+		dataKey, err := bi.leaf.dataKey(bi.slot)
+		if err != nil {
+			return false, err
+		}
+		if !bi.searchRange.aboveLow(dataKey) {
+			continue
+		}
+		return bi.searchRange.belowHigh(dataKey), nil
+	}
+}
+
+// MaxValue returns the value of the last record of the tree, found by going down the last
+// child of each directory block. Deleted records can leave leaves empty, so when a child
+// holds no records, the one before it is looked at instead.
+func (bi *BTreeIndex) MaxValue() (any, bool, error) {
+	return bi.maxValueUnder(0)
+}
+
+// maxValueUnder returns the highest value under the directory block.
+func (bi *BTreeIndex) maxValueUnder(block int) (any, bool, error) {
+	dir, err := newBTreePage(bi.transaction, file.NewBlockID(bi.dirFile, block), bi.dirLayout)
+	if err != nil {
+		return nil, false, err
+	}
+	level, err := dir.flag()
+	if err != nil {
+		dir.close()
+		return nil, false, err
+	}
+	n, err := dir.numRecs()
+	if err != nil {
+		dir.close()
+		return nil, false, err
+	}
+	children := make([]int, n)
+	for i := range children {
+		children[i], err = dir.getInt(i, "block")
+		if err != nil {
+			dir.close()
+			return nil, false, err
+		}
+	}
+	dir.close()
+
+	for i := n - 1; i >= 0; i-- {
+		if level > 0 {
+			value, found, err := bi.maxValueUnder(children[i])
+			if err != nil || found {
+				return value, found, err
+			}
+			continue
+		}
+		leaf, err := newBTreePage(bi.transaction, file.NewBlockID(bi.leafFile, children[i]), bi.leafLayout)
+		if err != nil {
+			return nil, false, err
+		}
+		numRecs, err := leaf.numRecs()
+		if err == nil && numRecs > 0 {
+			key, err := leaf.dataKey(numRecs - 1)
+			leaf.close()
+			if err != nil {
+				return nil, false, err
+			}
+			value, err := decodeKey(bi.valueType, key)
+			return value, err == nil, err
+		}
+		leaf.close()
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, nil
+}
+
+func (bi *BTreeIndex) GetDataRid() (*record.RID, error) {
+	if bi.leaf == nil {
+		return nil, fmt.Errorf("index not positioned; call BeforeFirst first")
+	}
+	blockNum, err := bi.leaf.getInt(bi.slot, "block")
+	if err != nil {
+		return nil, err
+	}
+	slot, err := bi.leaf.getInt(bi.slot, "id")
+	if err != nil {
+		return nil, err
+	}
+	return record.NewRID(blockNum, slot), nil
+}
+
+func (bi *BTreeIndex) GetDataVal() (any, error) {
+	if bi.leaf == nil {
+		return nil, fmt.Errorf("index not positioned; call BeforeFirst first")
+	}
+	key, err := bi.leaf.dataKey(bi.slot)
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(bi.valueType, key)
+}
+
+// Insert adds a record after the records with the same value. If the root splits, its
+// entries move to a new block, and the root gets a level more, pointing to both halves.
+func (bi *BTreeIndex) Insert(dataVal any, dataRid *record.RID) error {
+	bi.Close()
+	dataKey, err := encodeKey(dataVal)
+	if err != nil {
+		return err
+	}
+	entry, err := bi.insertInDir(0, dataKey, dataRid)
+	if err != nil || entry == nil {
+		return err
+	}
+
+	root, err := newBTreePage(bi.transaction, file.NewBlockID(bi.dirFile, 0), bi.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer root.close()
+	level, err := root.flag()
+	if err != nil {
+		return err
+	}
+	firstKey, err := root.dataKey(0)
+	if err != nil {
+		return err
+	}
+	block, err := root.split(0, level)
+	if err != nil {
+		return err
+	}
+	if err := root.setFlag(level + 1); err != nil {
+		return err
+	}
+	if err := root.insert(0, map[string]any{"block": block.Number(), "dataval": firstKey}); err != nil {
+		return err
+	}
+	return root.insert(1, map[string]any{"block": entry.block, "dataval": entry.dataKey})
+}
+
+// insertInDir inserts a record with the key under the directory block, and returns the entry
+// for a new block if the directory block split, or nil.
+func (bi *BTreeIndex) insertInDir(block int, dataKey string, dataRid *record.RID) (*dirEntry, error) {
+	dir, err := newBTreePage(bi.transaction, file.NewBlockID(bi.dirFile, block), bi.dirLayout)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.close()
+
+	level, err := dir.flag()
+	if err != nil {
+		return nil, err
+	}
+	slot, err := findEntry(dir, dataKey, true)
+	if err != nil {
+		return nil, err
+	}
+	child, err := dir.getInt(slot, "block")
+	if err != nil {
+		return nil, err
+	}
+	var entry *dirEntry
+	if level == 0 {
+		entry, err = bi.insertInLeaf(child, dataKey, dataRid)
+	} else {
+		entry, err = bi.insertInDir(child, dataKey, dataRid)
+	}
+	if err != nil || entry == nil {
+		return nil, err
+	}
+
+	// The new block's entry goes right after the entry of the block it split from
+	return insertRecord(dir, slot+1, map[string]any{"block": entry.block, "dataval": entry.dataKey}, level)
+}
+
+// insertInLeaf inserts a record with the key into the leaf, and returns the entry for a new
+// leaf if the leaf split, or nil. The new leaf takes its place in the chain after the one
+// that split.
+func (bi *BTreeIndex) insertInLeaf(block int, dataKey string, dataRid *record.RID) (*dirEntry, error) {
+	leaf, err := newBTreePage(bi.transaction, file.NewBlockID(bi.leafFile, block), bi.leafLayout)
+	if err != nil {
+		return nil, err
+	}
+	defer leaf.close()
+
+	slot, err := leaf.countBelow(0, dataKey, true)
+	if err != nil {
+		return nil, err
+	}
+	next, err := leaf.flag()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := insertRecord(leaf, slot, map[string]any{"block": dataRid.Block(), "id": dataRid.Slot(), "dataval": dataKey}, next)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry, leaf.setFlag(entry.block)
+}
+
+// insertRecord inserts a record into the page at the slot, and splits the page in half if
+// that leaves no room for another record, giving the new block the flag. It returns the entry
+// for the new block, or nil if the page didn't split.
+func insertRecord(page *btreePage, slot int, values map[string]any, flag int) (*dirEntry, error) {
+	if err := page.insert(slot, values); err != nil {
+		return nil, err
+	}
+	n, err := page.numRecs()
+	if err != nil {
+		return nil, err
+	}
+	if n < page.capacity() {
+		return nil, nil
+	}
+	splitSlot := n / 2
+	splitKey, err := page.dataKey(splitSlot)
+	if err != nil {
+		return nil, err
+	}
+	block, err := page.split(splitSlot, flag)
+	if err != nil {
+		return nil, err
+	}
+	return &dirEntry{dataKey: splitKey, block: block.Number()}, nil
+}
+
+// Delete removes the record with the value and record identifier. Blocks that are left
+// empty stay in the tree.
+func (bi *BTreeIndex) Delete(dataVal any, dataRid *record.RID) error {
+	if err := bi.BeforeFirst(dataVal); err != nil {
+		return err
+	}
+	for {
+		hasNext, err := bi.Next()
+		if err != nil || !hasNext {
+			return err
+		}
+		currentRid, err := bi.GetDataRid()
+		if err != nil {
+			return err
+		}
+		if currentRid.Block() == dataRid.Block() && currentRid.Slot() == dataRid.Slot() {
+			// The records after it move up a slot, so the next one is where it was
+			err = bi.leaf.delete(bi.slot)
+			bi.slot--
+			return err
+		}
+	}
+}
+
+// Clear empties the tree, leaving the root pointing to the first leaf alone. The other
+// blocks of both files are left unused.
+func (bi *BTreeIndex) Clear() error {
+	bi.Close()
+	leaf, err := newBTreePage(bi.transaction, file.NewBlockID(bi.leafFile, 0), bi.leafLayout)
+	if err != nil {
+		return err
+	}
+	defer leaf.close()
+	if err := leaf.setFlag(-1); err != nil {
+		return err
+	}
+	if err := leaf.setNumRecs(0); err != nil {
+		return err
+	}
+
+	root, err := newBTreePage(bi.transaction, file.NewBlockID(bi.dirFile, 0), bi.dirLayout)
+	if err != nil {
+		return err
+	}
+	defer root.close()
+	if err := root.setFlag(0); err != nil {
+		return err
+	}
+	if err := root.setNumRecs(1); err != nil {
+		return err
+	}
+	return root.setValue(0, "block", 0)
+}
+
+func (bi *BTreeIndex) Close() error {
+	if bi.leaf != nil {
+		bi.leaf.close()
+		bi.leaf = nil
+	}
+	return nil
+}
+
+// BTreeSearchCost returns the cost of searching a B-tree index whose leaves take up the
+// number of blocks: a block for each level of the directory, and the first leaf.
+func BTreeSearchCost(numBlocks int, recordsPerBlock int) int {
+	if numBlocks <= 1 || recordsPerBlock <= 1 {
+		return 1
+	}
+	return 1 + int(math.Log(float64(numBlocks))/math.Log(float64(recordsPerBlock)))
+}
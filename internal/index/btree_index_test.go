@@ -0,0 +1,232 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+func setupBTreeIndexTest(t *testing.T, layout *record.Layout) (*BTreeIndex, func()) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+
+	fileManager, err := file.NewManager(tempDir, 400)
+	require.NoError(t, err)
+
+	logManager, err := log.NewManager(fileManager, "btree_index_test.log")
+	require.NoError(t, err)
+
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+
+	lockTable := transaction.NewLockTable()
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+
+	btreeIndex, err := NewBTreeIndex(tx, "test_btree_index", layout)
+	require.NoError(t, err)
+
+	cleanup := func() {
+		if err := btreeIndex.Close(); err != nil {
+			t.Errorf("failed to close btree index: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Errorf("failed to commit transaction: %v", err)
+		}
+		fileManager.Close()
+	}
+
+	return btreeIndex, cleanup
+}
+
+// readRange returns the values and record identifiers of the records of the index in the range
+func readRange(t *testing.T, idx *BTreeIndex, r Range) ([]any, []string) {
+	t.Helper()
+	require.NoError(t, idx.BeforeRange(r))
+	values := []any{}
+	rids := []string{}
+	for {
+		hasNext, err := idx.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			return values, rids
+		}
+		val, err := idx.GetDataVal()
+		require.NoError(t, err)
+		rid, err := idx.GetDataRid()
+		require.NoError(t, err)
+		values = append(values, val)
+		rids = append(rids, ridKey(rid))
+	}
+}
+
+// TestBTreeIndex_SearchAfterSplits fills a tree with enough duplicated keys, inserted in a
+// random order, to split leaves and directory blocks, and searches it for single keys and ranges.
+func TestBTreeIndex_SearchAfterSplits(t *testing.T) {
+	btreeIndex, cleanup := setupBTreeIndexTest(t, intIndexLayout())
+	defer cleanup()
+
+	// Every key from 0 to 299 five times, each with its own record identifier
+	const numKeys = 300
+	ridsByKey := map[int][]string{}
+	order := rand.New(rand.NewSource(1)).Perm(numKeys * 5)
+	for _, i := range order {
+		key, rid := i%numKeys, record.NewRID(i, i%7)
+		require.NoError(t, btreeIndex.Insert(key, rid))
+		ridsByKey[key] = append(ridsByKey[key], ridKey(rid))
+	}
+
+	// The directory has more than one level
+	root, err := newBTreePage(btreeIndex.transaction, file.NewBlockID(btreeIndex.dirFile, 0), btreeIndex.dirLayout)
+	require.NoError(t, err)
+	level, err := root.flag()
+	root.close()
+	require.NoError(t, err)
+	assert.Greater(t, level, 0)
+
+	for _, key := range []int{0, 1, 42, 150, 298, 299} {
+		values, rids := readRange(t, btreeIndex, Range{Low: key, LowInclusive: true, High: key, HighInclusive: true})
+		assert.ElementsMatch(t, ridsByKey[key], rids, "key %d", key)
+		assert.Equal(t, []any{key, key, key, key, key}, values)
+	}
+	_, rids := readRange(t, btreeIndex, Range{Low: numKeys, LowInclusive: true, High: numKeys, HighInclusive: true})
+	assert.Empty(t, rids)
+
+	// A range with an exclusive lower bound and an inclusive upper one comes out in order
+	values, _ := readRange(t, btreeIndex, Range{Low: 10, High: 12, HighInclusive: true})
+	assert.Equal(t, []any{11, 11, 11, 11, 11, 12, 12, 12, 12, 12}, values)
+
+	// An open range reads the whole tree in order
+	values, _ = readRange(t, btreeIndex, Range{})
+	require.Len(t, values, numKeys*5)
+	assert.True(t, sort.SliceIsSorted(values, func(i, j int) bool { return values[i].(int) < values[j].(int) }))
+	values, _ = readRange(t, btreeIndex, Range{Low: 297})
+	assert.Len(t, values, 10)
+}
+
+func TestBTreeIndex_Delete(t *testing.T) {
+	btreeIndex, cleanup := setupBTreeIndexTest(t, intIndexLayout())
+	defer cleanup()
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, btreeIndex.Insert(i%20, record.NewRID(i, 0)))
+	}
+	// Delete every record of key 7 but one, and a record of a key that doesn't exist
+	for i := 7; i < 200; i += 20 {
+		if i == 107 {
+			continue
+		}
+		require.NoError(t, btreeIndex.Delete(7, record.NewRID(i, 0)))
+	}
+	require.NoError(t, btreeIndex.Delete(50, record.NewRID(50, 0)))
+
+	_, rids := readRange(t, btreeIndex, Range{Low: 7, LowInclusive: true, High: 7, HighInclusive: true})
+	assert.Equal(t, []string{ridKey(record.NewRID(107, 0))}, rids)
+	values, _ := readRange(t, btreeIndex, Range{})
+	assert.Len(t, values, 191)
+}
+
+func TestBTreeIndex_StringKeys(t *testing.T) {
+	btreeIndex, cleanup := setupBTreeIndexTest(t, stringIndexLayout(20))
+	defer cleanup()
+
+	for i := 0; i < 60; i++ {
+		require.NoError(t, btreeIndex.Insert(fmt.Sprintf("name%02d", 59-i), record.NewRID(i, 0)))
+	}
+
+	values, _ := readRange(t, btreeIndex, Range{Low: "name10", LowInclusive: true, High: "name13"})
+	assert.Equal(t, []any{"name10", "name11", "name12"}, values)
+
+	require.NoError(t, btreeIndex.BeforeFirst("name30"))
+	hasNext, err := btreeIndex.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	rid, err := btreeIndex.GetDataRid()
+	require.NoError(t, err)
+	assert.Equal(t, ridKey(record.NewRID(29, 0)), ridKey(rid))
+	hasNext, err = btreeIndex.Next()
+	require.NoError(t, err)
+	assert.False(t, hasNext)
+}
+
+func TestBTreeIndex_BigIntKeys(t *testing.T) {
+	schema := record.NewSchema()
+	schema.AddIntField("block")
+	schema.AddIntField("id")
+	schema.AddBigIntField("dataval")
+	btreeIndex, cleanup := setupBTreeIndexTest(t, record.NewLayoutFromSchema(schema))
+	defer cleanup()
+
+	// Keys of a bigint field may come as int or int64
+	require.NoError(t, btreeIndex.Insert(int64(5000000000), record.NewRID(1, 1)))
+	require.NoError(t, btreeIndex.Insert(-3, record.NewRID(2, 2)))
+	require.NoError(t, btreeIndex.Insert(int64(5000000001), record.NewRID(3, 3)))
+
+	// Negative keys sort before the others
+	values, _ := readRange(t, btreeIndex, Range{})
+	assert.Equal(t, []any{int64(-3), int64(5000000000), int64(5000000001)}, values)
+	values, _ = readRange(t, btreeIndex, Range{Low: 0, High: 5000000000, HighInclusive: true})
+	assert.Equal(t, []any{int64(5000000000)}, values)
+	values, _ = readRange(t, btreeIndex, Range{High: int64(5000000000)})
+	assert.Equal(t, []any{int64(-3)}, values)
+}
+
+func TestBTreeIndex_MaxValue(t *testing.T) {
+	btreeIndex, cleanup := setupBTreeIndexTest(t, intIndexLayout())
+	defer cleanup()
+
+	_, found, err := btreeIndex.MaxValue()
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	const numKeys = 300
+	for _, key := range rand.New(rand.NewSource(2)).Perm(numKeys) {
+		require.NoError(t, btreeIndex.Insert(key, record.NewRID(key, 0)))
+	}
+	value, found, err := btreeIndex.MaxValue()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, numKeys-1, value)
+
+	// Deleting the highest keys leaves the last leaves empty
+	for key := 100; key < numKeys; key++ {
+		require.NoError(t, btreeIndex.Delete(key, record.NewRID(key, 0)))
+	}
+	value, found, err = btreeIndex.MaxValue()
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, 99, value)
+
+	for key := 0; key < 100; key++ {
+		require.NoError(t, btreeIndex.Delete(key, record.NewRID(key, 0)))
+	}
+	_, found, err = btreeIndex.MaxValue()
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestBTreeIndex_Clear(t *testing.T) {
+	btreeIndex, cleanup := setupBTreeIndexTest(t, intIndexLayout())
+	defer cleanup()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, btreeIndex.Insert(i, record.NewRID(i, i)))
+	}
+	require.NoError(t, btreeIndex.Clear())
+	values, _ := readRange(t, btreeIndex, Range{})
+	assert.Empty(t, values)
+
+	// The index can be filled again once cleared
+	require.NoError(t, btreeIndex.Insert(3, record.NewRID(7, 7)))
+	_, rids := readRange(t, btreeIndex, Range{Low: 3, LowInclusive: true, High: 3, HighInclusive: true})
+	assert.Equal(t, []string{ridKey(record.NewRID(7, 7))}, rids)
+}
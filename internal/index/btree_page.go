@@ -0,0 +1,238 @@
+package index
+
+import (
+	"strings"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+const (
+	// btreeFlagOffset is where a B-tree block keeps its flag: the next leaf's block number in a
+	// leaf (-1 for the last leaf), and the level of a directory block (0 if its children are leaves)
+	btreeFlagOffset = 0
+	// btreeNumRecsOffset is where a B-tree block keeps its number of records
+	btreeNumRecsOffset = 4
+	// btreeHeaderSize is the size of the header, after which the records start
+	btreeHeaderSize = 8
+)
+
+// btreePage is a block of a B-tree file: a leaf holding index entries, or a directory block
+// holding the entries that point to its children. Its records are kept sorted by dataval,
+// the key encoding of their values, with no gaps, in slots of the layout's size after the header.
+type btreePage struct {
+	transaction *transaction.Transaction
+	block       *file.BlockID
+	layout      *record.Layout
+}
+
+// newBTreePage pins the block and returns it as a B-tree page.
+func newBTreePage(transaction *transaction.Transaction, block *file.BlockID, layout *record.Layout) (*btreePage, error) {
+	_, err := transaction.Pin(block)
+	if err != nil {
+		return nil, err
+	}
+	return &btreePage{
+		transaction: transaction,
+		block:       block,
+		layout:      layout,
+	}, nil
+}
+
+// appendBTreePage appends an empty page with the given flag to the file.
+func appendBTreePage(transaction *transaction.Transaction, filename string, layout *record.Layout, flag int) (*btreePage, error) {
+	block, err := transaction.Append(filename)
+	if err != nil {
+		return nil, err
+	}
+	page, err := newBTreePage(transaction, block, layout)
+	if err != nil {
+		return nil, err
+	}
+	// Nothing points to a new block until the page that does is changed, and that change is
+	// logged, so the header needs no undo of its own
+	err = page.transaction.SetInt(block, btreeFlagOffset, flag, false)
+	if err == nil {
+		err = page.transaction.SetInt(block, btreeNumRecsOffset, 0, false)
+	}
+	if err != nil {
+		page.close()
+		return nil, err
+	}
+	return page, nil
+}
+
+// close unpins the block.
+func (bp *btreePage) close() {
+	if bp.block != nil {
+		bp.transaction.Unpin(bp.block)
+		bp.block = nil
+	}
+}
+
+func (bp *btreePage) flag() (int, error) {
+	return bp.transaction.GetInt(bp.block, btreeFlagOffset)
+}
+
+func (bp *btreePage) setFlag(flag int) error {
+	return bp.transaction.SetInt(bp.block, btreeFlagOffset, flag, true)
+}
+
+func (bp *btreePage) numRecs() (int, error) {
+	return bp.transaction.GetInt(bp.block, btreeNumRecsOffset)
+}
+
+func (bp *btreePage) setNumRecs(n int) error {
+	return bp.transaction.SetInt(bp.block, btreeNumRecsOffset, n, true)
+}
+
+// capacity returns the number of records that fit in the block.
+func (bp *btreePage) capacity() int {
+	return (bp.transaction.BlockSize() - btreeHeaderSize) / bp.layout.GetSlotSize()
+}
+
+// getInt returns an int field of the record in the slot.
+func (bp *btreePage) getInt(slot int, fieldName string) (int, error) {
+	return bp.transaction.GetInt(bp.block, bp.fieldOffset(slot, fieldName))
+}
+
+// getValue returns a field of the record in the slot: an int, an int64 for a bigint
+// field, or a string.
+func (bp *btreePage) getValue(slot int, fieldName string) (any, error) {
+	offset := bp.fieldOffset(slot, fieldName)
+	switch bp.layout.GetSchema().Type(fieldName) {
+	case "int":
+		return bp.transaction.GetInt(bp.block, offset)
+	case "bigint":
+		return bp.transaction.GetLong(bp.block, offset)
+	default:
+		return bp.transaction.GetString(bp.block, offset)
+	}
+}
+
+// setValue sets a field of the record in the slot. A bigint field also takes an int.
+func (bp *btreePage) setValue(slot int, fieldName string, value any) error {
+	offset := bp.fieldOffset(slot, fieldName)
+	switch bp.layout.GetSchema().Type(fieldName) {
+	case "int":
+		return bp.transaction.SetInt(bp.block, offset, value.(int), true)
+	case "bigint":
+		if v, ok := value.(int64); ok {
+			return bp.transaction.SetLong(bp.block, offset, v, true)
+		}
+		return bp.transaction.SetLong(bp.block, offset, int64(value.(int)), true)
+	default:
+		return bp.transaction.SetString(bp.block, offset, value.(string), true)
+	}
+}
+
+// dataKey returns the key the record in the slot is sorted by: the key encoding of its value.
+func (bp *btreePage) dataKey(slot int) (string, error) {
+	return bp.transaction.GetString(bp.block, bp.fieldOffset(slot, "dataval"))
+}
+
+// countBelow returns the slot of the first record from the given slot on whose key isn't
+// below the key, or is above it if orEqual is set. The records before the given slot
+// aren't looked at.
+func (bp *btreePage) countBelow(from int, key string, orEqual bool) (int, error) {
+	high, err := bp.numRecs()
+	if err != nil {
+		return 0, err
+	}
+	low := min(from, high)
+	for low < high {
+		mid := (low + high) / 2
+		dataKey, err := bp.dataKey(mid)
+		if err != nil {
+			return 0, err
+		}
+		c := strings.Compare(dataKey, key)
+		if c < 0 || (orEqual && c == 0) {
+			low = mid + 1
+		} else {
+			high = mid
+		}
+	}
+	return low, nil
+}
+
+// insert makes room for a record at the slot, moving the records from it on up by one, and
+// sets its fields.
+func (bp *btreePage) insert(slot int, values map[string]any) error {
+	n, err := bp.numRecs()
+	if err != nil {
+		return err
+	}
+	for i := n; i > slot; i-- {
+		if err := bp.copyRecord(i-1, bp, i); err != nil {
+			return err
+		}
+	}
+	for fieldName, value := range values {
+		if err := bp.setValue(slot, fieldName, value); err != nil {
+			return err
+		}
+	}
+	return bp.setNumRecs(n + 1)
+}
+
+// delete removes the record in the slot, moving the records after it down by one.
+func (bp *btreePage) delete(slot int) error {
+	n, err := bp.numRecs()
+	if err != nil {
+		return err
+	}
+	for i := slot + 1; i < n; i++ {
+		if err := bp.copyRecord(i, bp, i-1); err != nil {
+			return err
+		}
+	}
+	return bp.setNumRecs(n - 1)
+}
+
+// split moves the records from the slot on into a new block of the same file with the
+// given flag, and returns that block.
+func (bp *btreePage) split(slot int, flag int) (*file.BlockID, error) {
+	newPage, err := appendBTreePage(bp.transaction, bp.block.Filename(), bp.layout, flag)
+	if err != nil {
+		return nil, err
+	}
+	defer newPage.close()
+
+	n, err := bp.numRecs()
+	if err != nil {
+		return nil, err
+	}
+	for i := slot; i < n; i++ {
+		if err := bp.copyRecord(i, newPage, i-slot); err != nil {
+			return nil, err
+		}
+	}
+	if err := newPage.setNumRecs(n - slot); err != nil {
+		return nil, err
+	}
+	if err := bp.setNumRecs(slot); err != nil {
+		return nil, err
+	}
+	return newPage.block, nil
+}
+
+// copyRecord copies the record in the slot to a slot of the other page, which has the same layout.
+func (bp *btreePage) copyRecord(slot int, other *btreePage, otherSlot int) error {
+	for _, fieldName := range bp.layout.GetSchema().Fields() {
+		value, err := bp.getValue(slot, fieldName)
+		if err != nil {
+			return err
+		}
+		if err := other.setValue(otherSlot, fieldName, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldOffset returns the offset in the block of a field of the record in the slot.
+func (bp *btreePage) fieldOffset(slot int, fieldName string) int {
+	return btreeHeaderSize + slot*bp.layout.GetSlotSize() + bp.layout.GetOffset(fieldName)
+}
@@ -21,30 +21,44 @@ type HashIndex struct {
 	transaction *transaction.Transaction
 	indexName   string
 	indexLayout *record.Layout
+	// valueType is the type of the indexed field, whose values the keys are decoded into
+	valueType string
 
-	searchKey any
+	// searchKey is the key encoding of the value searched for
+	searchKey string
 	tableScan *table.TableScan
 }
 
+// NewHashIndex returns the hash index with the given name. The layout is that of the index's
+// values: block, id and dataval. The records of its buckets hold the key encoding of the
+// values instead (see KeyLayout).
 func NewHashIndex(transaction *transaction.Transaction, indexName string, layout *record.Layout) (*HashIndex, error) {
 	return &HashIndex{
 		indexName:   indexName,
 		transaction: transaction,
-		indexLayout: layout,
+		indexLayout: KeyLayout(layout),
+		valueType:   layout.GetSchema().Type("dataval"),
 	}, nil
 }
 
 func (hi *HashIndex) BeforeFirst(searchKey any) error {
 	hi.Close()
-	hi.searchKey = searchKey
+	if searchKey == nil {
+		return fmt.Errorf("search key not set")
+	}
+	key, err := encodeKey(searchKey)
+	if err != nil {
+		return err
+	}
+	hi.searchKey = key
 
-	hashValue, err := utils.HashValue(searchKey)
+	// The bucket is picked from the key, so an int and a bigint of the same value hash alike
+	hashValue, err := utils.HashValue(key)
 	if err != nil {
 		return err
 	}
 	bucket := hashValue % NumBuckets
-	indexTableName := fmt.Sprintf("%s-%d", hi.indexName, bucket)
-	tableScan, err := table.NewTableScan(hi.transaction, hi.indexLayout, indexTableName)
+	tableScan, err := table.NewTableScan(hi.transaction, hi.indexLayout, hi.bucketTable(int(bucket)))
 	if err != nil {
 		return err
 	}
@@ -64,10 +78,6 @@ func (hi *HashIndex) Next() (bool, error) {
 	if hi.tableScan == nil {
 		return false, fmt.Errorf("table scan not initialized; call BeforeFirst first")
 	}
-	if hi.searchKey == nil {
-		return false, fmt.Errorf("search key not set; call BeforeFirst with a key")
-	}
-
 	for {
 		hasNext, err := hi.tableScan.Next()
 		if err != nil {
@@ -77,11 +87,11 @@ func (hi *HashIndex) Next() (bool, error) {
 			return false, nil
 		}
 
-		dataval, err := hi.tableScan.GetValue("dataval")
+		dataKey, err := hi.tableScan.GetString("dataval")
 		if err != nil {
 			return false, err
 		}
-		if dataval == hi.searchKey {
+		if dataKey == hi.searchKey {
 			return true, nil
 		}
 	}
@@ -104,6 +114,17 @@ func (hi *HashIndex) GetDataRid() (*record.RID, error) {
 	return record.NewRID(blockNum, slot), nil
 }
 
+func (hi *HashIndex) GetDataVal() (any, error) {
+	if hi.tableScan == nil {
+		return nil, fmt.Errorf("table scan not initialized; call BeforeFirst first")
+	}
+	key, err := hi.tableScan.GetString("dataval")
+	if err != nil {
+		return nil, err
+	}
+	return decodeKey(hi.valueType, key)
+}
+
 func (hi *HashIndex) Insert(dataVal any, dataRid *record.RID) error {
 	if err := hi.BeforeFirst(dataVal); err != nil {
 		return err
@@ -123,7 +144,7 @@ func (hi *HashIndex) Insert(dataVal any, dataRid *record.RID) error {
 		return err
 	}
 
-	return hi.tableScan.SetValue("dataval", dataVal)
+	return hi.tableScan.SetString("dataval", hi.searchKey)
 }
 
 func (hi *HashIndex) Delete(dataVal any, dataRid *record.RID) error {
@@ -150,6 +171,46 @@ func (hi *HashIndex) Delete(dataVal any, dataRid *record.RID) error {
 	}
 }
 
+// Clear deletes every entry of the index, from all of its buckets.
+func (hi *HashIndex) Clear() error {
+	hi.Close()
+	for bucket := 0; bucket < NumBuckets; bucket++ {
+		// A bucket that never had an entry has no file, and opening a scan would create one
+		size, err := hi.transaction.Size(hi.bucketTable(bucket) + ".tbl")
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			continue
+		}
+
+		tableScan, err := table.NewTableScan(hi.transaction, hi.indexLayout, hi.bucketTable(bucket))
+		if err != nil {
+			return err
+		}
+		for {
+			hasNext, err := tableScan.Next()
+			if err == nil && hasNext {
+				err = tableScan.Delete()
+			}
+			if err != nil {
+				tableScan.Close()
+				return err
+			}
+			if !hasNext {
+				break
+			}
+		}
+		tableScan.Close()
+	}
+	return nil
+}
+
+// bucketTable returns the name of the table holding the entries of the bucket
+func (hi *HashIndex) bucketTable(bucket int) string {
+	return fmt.Sprintf("%s-%d", hi.indexName, bucket)
+}
+
 // HashSearchCost returns the cost of searching an index file having
 // the specified number of blocks.
 // the method assumes that all buckets are about the same size,
@@ -184,3 +184,65 @@ func TestHashIndex_StringKeys(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, ridKey(otherRID), ridKey(foundRID))
 }
+
+func TestHashIndex_BigIntKeys(t *testing.T) {
+	schema := record.NewSchema()
+	schema.AddIntField("block")
+	schema.AddIntField("id")
+	schema.AddBigIntField("dataval")
+	hashIndex, cleanup := setupHashIndexTest(t, record.NewLayoutFromSchema(schema))
+	defer cleanup()
+
+	rid1 := record.NewRID(1, 1)
+	rid2 := record.NewRID(2, 2)
+	// Keys of a bigint field may come as int or int64
+	require.NoError(t, hashIndex.Insert(int64(5000000000), rid1))
+	require.NoError(t, hashIndex.Insert(5000000000, rid2))
+	require.NoError(t, hashIndex.Insert(int64(5000000001), record.NewRID(3, 3)))
+
+	for _, searchKey := range []any{5000000000, int64(5000000000)} {
+		require.NoError(t, hashIndex.BeforeFirst(searchKey))
+		var collected []string
+		for {
+			hasNext, err := hashIndex.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			rid, err := hashIndex.GetDataRid()
+			require.NoError(t, err)
+			collected = append(collected, ridKey(rid))
+			val, err := hashIndex.GetDataVal()
+			require.NoError(t, err)
+			assert.Equal(t, int64(5000000000), val)
+		}
+		assert.ElementsMatch(t, []string{ridKey(rid1), ridKey(rid2)}, collected)
+	}
+}
+
+func TestHashIndex_Clear(t *testing.T) {
+	hashIndex, cleanup := setupHashIndexTest(t, intIndexLayout())
+	defer cleanup()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, hashIndex.Insert(i%5, record.NewRID(i, i)))
+	}
+	require.NoError(t, hashIndex.Clear())
+
+	for key := 0; key < 5; key++ {
+		require.NoError(t, hashIndex.BeforeFirst(key))
+		hasNext, err := hashIndex.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext, "key %d still has entries", key)
+	}
+
+	// The index can be filled again once cleared
+	require.NoError(t, hashIndex.Insert(3, record.NewRID(7, 7)))
+	require.NoError(t, hashIndex.BeforeFirst(3))
+	hasNext, err := hashIndex.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	rid, err := hashIndex.GetDataRid()
+	require.NoError(t, err)
+	assert.Equal(t, ridKey(record.NewRID(7, 7)), ridKey(rid))
+}
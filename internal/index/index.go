@@ -1,9 +1,17 @@
 package index
 
 import (
+	"strings"
+
 	"github.com/yashagw/cranedb/internal/record"
 )
 
+// The kinds of index, as they are named in CREATE INDEX ... USING and in the index catalog.
+const (
+	HashType  = "hash"
+	BTreeType = "btree"
+)
+
 // Index is the interface for index operations.
 // This interface is in a separate package to avoid import cycles.
 type Index interface {
@@ -14,10 +22,113 @@ type Index interface {
 	Next() (bool, error)
 	// GetDataRid returns the record identifier (RID) of the current record.
 	GetDataRid() (*record.RID, error)
+	// GetDataVal returns the indexed value of the current record, read from the index
+	// record without touching the data record.
+	GetDataVal() (any, error)
 	// Insert inserts a new record into the index with the given data value and record identifier.
 	Insert(dataVal any, dataRid *record.RID) error
 	// Delete deletes a record from the index with the given data value and record identifier.
+	// The index is left where Next moves on to the record after the deleted one, so the
+	// records found for a search key can be deleted while they are read.
 	Delete(dataVal any, dataRid *record.RID) error
+	// Clear deletes every record from the index.
+	Clear() error
 	// Close closes the index.
 	Close() error
 }
+
+// RangeIndex is an index that keeps its records sorted by value, so that it can also be
+// searched for a range of values.
+type RangeIndex interface {
+	Index
+	// BeforeRange positions the index before the first record whose value is in the range.
+	// Next then moves through the records in the range, in order of value.
+	BeforeRange(r Range) error
+	// MaxValue returns the highest value of the index's records, and false if it has none.
+	// The lowest is that of the first record of an open range.
+	MaxValue() (any, bool, error)
+}
+
+// Range is a range of index values. A nil bound leaves the range open on that side.
+type Range struct {
+	Low           any
+	LowInclusive  bool
+	High          any
+	HighInclusive bool
+}
+
+// keyRange is a Range with its bounds in their key encoding, as the records of an index hold
+// their values. An open low bound is the key of nil, no bytes, which no key is below.
+type keyRange struct {
+	low           string
+	lowInclusive  bool
+	high          string
+	highInclusive bool
+	openHigh      bool
+}
+
+// keys returns the range with its bounds in their key encoding.
+func (r Range) keys() (keyRange, error) {
+	low, err := encodeKey(r.Low)
+	if err != nil {
+		return keyRange{}, err
+	}
+	high, err := encodeKey(r.High)
+	if err != nil {
+		return keyRange{}, err
+	}
+	return keyRange{
+		low:           low,
+		lowInclusive:  r.LowInclusive,
+		high:          high,
+		highInclusive: r.HighInclusive,
+		openHigh:      r.High == nil,
+	}, nil
+}
+
+// aboveLow checks if the key isn't below the range.
+func (r keyRange) aboveLow(key string) bool {
+	c := strings.Compare(key, r.low)
+	return c > 0 || (c == 0 && r.lowInclusive)
+}
+
+// belowHigh checks if the key isn't above the range.
+func (r keyRange) belowHigh(key string) bool {
+	if r.openHigh {
+		return true
+	}
+	c := strings.Compare(key, r.high)
+	return c < 0 || (c == 0 && r.highInclusive)
+}
+
+// encodeKey returns the key encoding of an index value (see record.EncodeKey), as the
+// dataval field of the index's records holds it.
+func encodeKey(value any) (string, error) {
+	key, err := record.EncodeKey(value)
+	if err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
+// KeyLayout returns the layout the records of an index are kept in, given the layout of its
+// values: block, id and dataval. In place of the value, dataval holds its key encoding in a
+// string field, so that the records are ordered and matched by comparing bytes.
+func KeyLayout(layout *record.Layout) *record.Layout {
+	schema := layout.GetSchema()
+	keySchema := record.NewSchema()
+	for _, fieldName := range schema.Fields() {
+		if fieldName == "dataval" {
+			keySchema.AddStringField(fieldName, record.KeyLength(schema.Type(fieldName), schema.Length(fieldName)))
+			continue
+		}
+		keySchema.Copy(schema, fieldName)
+	}
+	return record.NewLayoutFromSchema(keySchema)
+}
+
+// decodeKey returns the value whose key encoding is held by the dataval field of an index's
+// record, as a value of the field of the given type.
+func decodeKey(fieldType string, key string) (any, error) {
+	return record.DecodeKey(fieldType, []byte(key))
+}
@@ -0,0 +1,80 @@
+package log
+
+import "github.com/yashagw/cranedb/internal/file"
+
+// ForwardIterator iterates over the log records after a given LSN, from oldest to newest.
+// ITERATION STRATEGY:
+// - Records only hold their own length, so a block can only be walked from newest to oldest
+// - On entering a block, walk it once and remember the positions of its records
+// - Return the records at those positions oldest first, then move to the next block
+// Only one block and its record positions are held at a time, however long the log is.
+type ForwardIterator struct {
+	fm       file.BlockStore
+	segments segments
+	// blkNum is the number of the current block, counted from the start of the log
+	blkNum    int
+	lastBlock int
+	page      *file.Page
+	// positions holds the positions of the records of the current block that remain
+	// to be returned, newest first
+	positions []int
+	// after is the LSN the returned records come after
+	after int
+	// lsn is the LSN of the record last returned by Next
+	lsn int
+}
+
+// newForwardIterator creates an iterator over the records of the log with an LSN greater
+// than after, up to the end of the block with the given number.
+func newForwardIterator(fm file.BlockStore, segs segments, lastBlock int, after int) *ForwardIterator {
+	// A record's block holds the LSNs from the block's start, excluded, to its end
+	startBlock := min(max(after/fm.BlockSize(), segs.firstBlock()), lastBlock)
+	it := &ForwardIterator{
+		fm:        fm,
+		segments:  segs,
+		blkNum:    startBlock,
+		lastBlock: lastBlock,
+		page:      file.NewPage(fm.BlockSize()),
+		after:     after,
+	}
+	it.moveToBlock(startBlock)
+	return it
+}
+
+// HasNext returns true if there are more log records to read.
+func (it *ForwardIterator) HasNext() bool {
+	for len(it.positions) == 0 && it.blkNum < it.lastBlock {
+		it.blkNum++
+		it.moveToBlock(it.blkNum)
+	}
+	return len(it.positions) > 0
+}
+
+// Next returns the next log record.
+func (it *ForwardIterator) Next() []byte {
+	if !it.HasNext() {
+		return nil
+	}
+	pos := it.positions[len(it.positions)-1]
+	it.positions = it.positions[:len(it.positions)-1]
+	it.lsn = recordLSN(it.fm.BlockSize(), it.blkNum, pos)
+	return it.page.GetBytesArray(pos)
+}
+
+// LSN returns the LSN of the record last returned by Next.
+func (it *ForwardIterator) LSN() int {
+	return it.lsn
+}
+
+// moveToBlock reads the specified block and finds the positions of its records after the start LSN.
+func (it *ForwardIterator) moveToBlock(blkNum int) {
+	it.fm.Read(it.segments.block(blkNum), it.page)
+	it.positions = it.positions[:0]
+	for pos := it.page.GetInt(0); pos < it.fm.BlockSize(); pos += 4 + len(it.page.GetBytesArray(pos)) {
+		if recordLSN(it.fm.BlockSize(), blkNum, pos) <= it.after {
+			// The rest of the block is older still
+			break
+		}
+		it.positions = append(it.positions, pos)
+	}
+}
@@ -6,51 +6,62 @@ import "github.com/yashagw/cranedb/internal/file"
 // ITERATION STRATEGY:
 // - Start at the current block's boundary (newest record in that block)
 // - Read records moving toward blockSize (newest to oldest within block)
-// - When block is exhausted, move to previous block and repeat
+// - When block is exhausted, move to previous block and repeat, down to the oldest one kept
 type LogIterator struct {
-	fm         *file.Manager
-	blk        *file.BlockID
+	fm       file.BlockStore
+	segments segments
+	// blkNum is the number of the current block, counted from the start of the log
+	blkNum     int
 	page       *file.Page
 	currentpos int
 	boundary   int
+	// lsn is the LSN of the record last returned by Next
+	lsn int
 }
 
-// NewLogIterator creates a new iterator for the log file, starting at the given block.
-func NewLogIterator(fm *file.Manager, blk *file.BlockID) *LogIterator {
+// newLogIterator creates a new iterator for the log, starting at the block with the given number.
+func newLogIterator(fm file.BlockStore, segs segments, blkNum int) *LogIterator {
 	it := &LogIterator{
-		fm:   fm,
-		blk:  blk,
-		page: file.NewPage(fm.BlockSize()),
+		fm:       fm,
+		segments: segs,
+		blkNum:   blkNum,
+		page:     file.NewPage(fm.BlockSize()),
 	}
-	it.moveToBlock(blk)
+	it.moveToBlock(blkNum)
 	return it
 }
 
 // HasNext returns true if there are more log records to read.
 func (it *LogIterator) HasNext() bool {
-	return it.currentpos < it.fm.BlockSize() || it.blk.Number() > 0
+	return it.currentpos < it.fm.BlockSize() || it.blkNum > it.segments.firstBlock()
 }
 
 // Next returns the next log record.
 func (it *LogIterator) Next() []byte {
 	// If we've read all records in current block, move to previous block
 	if it.currentpos >= it.fm.BlockSize() {
-		if it.blk.Number() == 0 {
+		if it.blkNum <= it.segments.firstBlock() {
 			return nil
 		}
-		it.blk = file.NewBlockID(it.blk.Filename(), it.blk.Number()-1)
-		it.moveToBlock(it.blk)
+		it.blkNum--
+		it.moveToBlock(it.blkNum)
 	}
 
 	// Read current record and advance position
 	rec := it.page.GetBytesArray(it.currentpos)
+	it.lsn = recordLSN(it.fm.BlockSize(), it.blkNum, it.currentpos)
 	it.currentpos += 4 + len(rec) // Move past this record (4 bytes length + data)
 	return rec
 }
 
+// LSN returns the LSN of the record last returned by Next.
+func (it *LogIterator) LSN() int {
+	return it.lsn
+}
+
 // moveToBlock moves the iterator to the specified block and reads its contents.
-func (it *LogIterator) moveToBlock(blk *file.BlockID) {
-	it.fm.Read(blk, it.page)
+func (it *LogIterator) moveToBlock(blkNum int) {
+	it.fm.Read(it.segments.block(blkNum), it.page)
 	it.boundary = it.page.GetInt(0)
 	// Start at the boundary (newest record)
 	it.currentpos = it.boundary
@@ -1,7 +1,7 @@
 package log
 
 import (
-	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/yashagw/cranedb/internal/file"
@@ -9,11 +9,17 @@ import (
 
 // Manager manages the log file for the database.
 // It provides methods to append log records and iterate over them.
+//
+// The LSN of a record is its position in the log: the number of bytes of all the blocks
+// before its block, plus the number of bytes from the end of its block to the start of
+// the record. Since records fill each block from its end, LSNs grow with every record,
+// and a record keeps its LSN when the log is reopened.
 type Manager struct {
-	fileManager  *file.Manager
-	logFilename  string
-	logPage      *file.Page
-	currentBlk   *file.BlockID
+	fileManager file.BlockStore
+	segments    segments
+	logPage     *file.Page
+	// currentBlk is the number of the current block, counted from the start of the log
+	currentBlk   int
 	latestLSN    int
 	lastSavedLSN int
 	mu           sync.Mutex
@@ -27,48 +33,102 @@ type Manager struct {
 // Block initialization:
 //   - New blocks have boundary set to blockSize (indicating completely empty)
 //   - Existing blocks are read to get their current state (boundary + existing records)
-func NewManager(fm *file.Manager, logFilename string) (*Manager, error) {
+func NewManager(fm file.BlockStore, logFilename string) (*Manager, error) {
+	return NewSegmentedManager(fm, logFilename, 0)
+}
+
+// NewSegmentedManager creates a log manager like NewManager, whose log moves on to a new
+// segment file every segmentBlocks blocks if it is new. An existing log keeps the segment
+// size it was created with, or stays in a single file if it was created without one.
+func NewSegmentedManager(fm file.BlockStore, logFilename string, segmentBlocks int) (*Manager, error) {
 	logPage := file.NewPage(fm.BlockSize())
 
-	totalBlocks, err := fm.GetTotalBlocks(logFilename)
+	segs, err := openSegments(fm, logFilename, segmentBlocks)
 	if err != nil {
-		return nil, errors.New("not able to get total blocks in log file: " + err.Error())
+		return nil, err
+	}
+	currentBlk, err := lastBlock(fm, segs)
+	if err != nil {
+		return nil, err
 	}
 
-	var currentBlk *file.BlockID
-
-	if totalBlocks == 0 {
+	if currentBlk < 0 {
 		// Create and initialize new block
 		// Set boundary to blockSize, this indicates the block is completely empty
-		currentBlk, err = fm.Append(logFilename)
+		blk, err := fm.Append(segs.fileName(segs.first))
 		if err != nil {
-			return nil, errors.New("not able to append first block to log file: " + err.Error())
+			return nil, fmt.Errorf("not able to append first block to log file: %w", err)
 		}
+		currentBlk = segs.firstBlock() + blk.Number()
 		logPage.SetInt(0, fm.BlockSize())
-		err = fm.Write(currentBlk, logPage)
+		err = fm.Write(blk, logPage)
 		if err != nil {
-			return nil, errors.New("not able to write first block to log file: " + err.Error())
+			return nil, fmt.Errorf("not able to write first block to log file: %w", err)
 		}
 	} else {
-		// Use the last block (blocks are zero-indexed, so the last block is totalBlocks - 1)
-		// This makes the last existing block the current log block for appending new records.
-		currentBlk = file.NewBlockID(logFilename, totalBlocks-1)
-		err = fm.Read(currentBlk, logPage)
+		// The last existing block becomes the current log block for appending new records.
+		err = fm.Read(segs.block(currentBlk), logPage)
 		if err != nil {
-			return nil, errors.New("not able to read last block from log file: " + err.Error())
+			return nil, fmt.Errorf("not able to read last block from log file: %w", err)
 		}
 	}
 
+	// Everything in the log so far is on disk
+	lsn := recordLSN(fm.BlockSize(), currentBlk, logPage.GetInt(0))
 	return &Manager{
 		fileManager:  fm,
-		logFilename:  logFilename,
+		segments:     segs,
 		logPage:      logPage,
 		currentBlk:   currentBlk,
-		latestLSN:    0,
-		lastSavedLSN: 0,
+		latestLSN:    lsn,
+		lastSavedLSN: lsn,
 	}, nil
 }
 
+// lastBlock returns the number of the last block of the log, counted from its start, or -1
+// if the log has no blocks. The last block is in the last segment that has any.
+func lastBlock(fm file.BlockStore, segs segments) (int, error) {
+	segment := segs.first
+	totalBlocks, err := fm.GetTotalBlocks(segs.fileName(segment))
+	if err != nil {
+		return 0, fmt.Errorf("not able to get total blocks in log file: %w", err)
+	}
+	for segs.blocks > 0 && totalBlocks == segs.blocks {
+		next, err := fm.GetTotalBlocks(segs.fileName(segment + 1))
+		if err != nil {
+			return 0, fmt.Errorf("not able to get total blocks in log file: %w", err)
+		}
+		if next == 0 {
+			break
+		}
+		segment++
+		totalBlocks = next
+	}
+	if totalBlocks == 0 {
+		return -1, nil
+	}
+	return segment*segs.blocks + totalBlocks - 1, nil
+}
+
+// recordLSN returns the LSN of the record at the given position of a log block.
+// The LSN of an empty block's boundary is the LSN of the last record before the block.
+func recordLSN(blockSize int, blockNum int, pos int) int {
+	return blockNum*blockSize + blockSize - pos
+}
+
+// LatestLSN returns the LSN of the most recently appended record
+func (lm *Manager) LatestLSN() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.latestLSN
+}
+
+// MaxRecordSize returns the size of the longest record that fits in a log block
+func (lm *Manager) MaxRecordSize() int {
+	// Besides the record, a block holds its boundary and the record's length
+	return lm.fileManager.BlockSize() - 8
+}
+
 // Close flushes the log and closes any open resources.
 func (lm *Manager) Close() error {
 	lm.mu.Lock()
@@ -96,24 +156,72 @@ func (lm *Manager) Iterator() (*LogIterator, error) {
 
 	err := lm.flush()
 	if err != nil {
-		return nil, errors.New("not able to flush log page to disk: " + err.Error())
+		return nil, fmt.Errorf("not able to flush log page to disk: %w", err)
+	}
+	return newLogIterator(lm.fileManager, lm.segments, lm.currentBlk), nil
+}
+
+// ForwardIterator returns an iterator over the log records with an LSN greater than
+// the given one, from oldest to most recent.
+func (lm *Manager) ForwardIterator(after int) (*ForwardIterator, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	err := lm.flush()
+	if err != nil {
+		return nil, fmt.Errorf("not able to flush log page to disk: %w", err)
+	}
+	return newForwardIterator(lm.fileManager, lm.segments, lm.currentBlk, after), nil
+}
+
+// RemoveSegments drops the segments of the log that hold no record after the given LSN,
+// which recovery no longer needs, and returns how many it dropped. The current segment is
+// kept. A log kept in a single file is left as it is.
+func (lm *Manager) RemoveSegments(lsn int) (int, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if lm.segments.blocks == 0 {
+		return 0, nil
+	}
+	// Segment n ends with the LSNs of its last block, which go up to the start of segment n+1
+	first := min(lsn/(lm.segments.blocks*lm.fileManager.BlockSize()), lm.segments.segment(lm.currentBlk))
+	if first <= lm.segments.first {
+		return 0, nil
+	}
+
+	// The new first segment is saved before the old ones are emptied, so that a crash in
+	// between leaves them unused rather than read as part of the log
+	old := lm.segments.first
+	segs := lm.segments
+	segs.first = first
+	err := segs.save(lm.fileManager)
+	if err != nil {
+		return 0, err
+	}
+	lm.segments = segs
+	for segment := old; segment < first; segment++ {
+		err = lm.fileManager.Truncate(segs.fileName(segment), 0)
+		if err != nil {
+			return 0, fmt.Errorf("not able to remove log segment %d: %w", segment, err)
+		}
 	}
-	return NewLogIterator(lm.fileManager, lm.currentBlk), nil
+	return first - old, nil
 }
 
 // flush is an internal method that writes the current log page to disk.
 // It assumes that the mutex is already locked.
 func (lm *Manager) flush() error {
-	err := lm.fileManager.Write(lm.currentBlk, lm.logPage)
+	err := lm.fileManager.Write(lm.segments.block(lm.currentBlk), lm.logPage)
 	if err != nil {
-		return errors.New("not able to write log page to disk: " + err.Error())
+		return fmt.Errorf("not able to write log page to disk: %w", err)
 	}
 	lm.lastSavedLSN = lm.latestLSN
 	return nil
 }
 
 // Append adds a new log record to the log file.
-// It returns the LSN assigned to this record.
+// It returns the LSN assigned to this record. A record must fit in an empty block.
 //
 // Block Layout:
 //
@@ -145,6 +253,9 @@ func (lm *Manager) Append(logrec []byte) (int, error) {
 
 	boundary := lm.logPage.GetInt(0)
 	bytesneeded := len(logrec) + 4
+	if len(logrec) > lm.MaxRecordSize() {
+		return 0, fmt.Errorf("log record of %d bytes doesn't fit in a log block", len(logrec))
+	}
 
 	// The record should fit entirely within [4, boundary] in the current block.
 	// If not, we should create a new block and use that.
@@ -165,16 +276,18 @@ func (lm *Manager) Append(logrec []byte) (int, error) {
 			return 0, err
 		}
 
-		// Create and initialize new block
+		// Create and initialize new block, the first of a new segment if the current
+		// one is full
 		// Set boundary to blockSize, this indicates the block is completely empty
-		lm.currentBlk, err = lm.fileManager.Append(lm.logFilename)
+		blk, err := lm.fileManager.Append(lm.segments.block(lm.currentBlk + 1).Filename())
 		if err != nil {
-			return 0, errors.New("not able to append block to log file: " + err.Error())
+			return 0, fmt.Errorf("not able to append block to log file: %w", err)
 		}
+		lm.currentBlk++
 		lm.logPage.SetInt(0, lm.fileManager.BlockSize())
-		err = lm.fileManager.Write(lm.currentBlk, lm.logPage)
+		err = lm.fileManager.Write(blk, lm.logPage)
 		if err != nil {
-			return 0, errors.New("not able to write block to log file: " + err.Error())
+			return 0, fmt.Errorf("not able to write block to log file: %w", err)
 		}
 
 		boundary = lm.logPage.GetInt(0)
@@ -187,7 +300,7 @@ func (lm *Manager) Append(logrec []byte) (int, error) {
 
 	// Write the boundary to mark the start of used space
 	lm.logPage.SetInt(0, recpos)
-	lm.latestLSN++
+	lm.latestLSN = recordLSN(lm.fileManager.BlockSize(), lm.currentBlk, recpos)
 
 	return lm.latestLSN, nil
 }
@@ -1,10 +1,13 @@
 package log
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/yashagw/cranedb/internal/file"
 )
 
@@ -60,21 +63,21 @@ func TestLog(t *testing.T) {
 			data:             []byte("test record"),
 			expectedLogSize:  1,
 			expectedboundary: 17, // 32 (boundary before the write) - 15 (4 bytes for length and 11 bytes for data)
-			expectedLSN:      1,
+			expectedLSN:      15, // 32 (block size) - 17 (position of the record)
 		},
 		{
 			name:             "test logging second record to be flushed to the same first block",
 			data:             []byte("record 2"),
 			expectedLogSize:  1,
 			expectedboundary: 5, // 17 (boundary before the write) - 12 (4 bytes for length and 8 bytes for data)
-			expectedLSN:      2,
+			expectedLSN:      27,
 		},
 		{
 			name:             "test logging third record to be flushed to the new second block",
 			data:             []byte("record 3"),
 			expectedLogSize:  2,
 			expectedboundary: 20, // 32 (new block - boundary before the write) - 12 (4 bytes for length and 8 bytes for data)
-			expectedLSN:      3,
+			expectedLSN:      44, // 32 (the first block) + 32 - 20
 		},
 	}
 
@@ -120,8 +123,10 @@ func TestIterator(t *testing.T) {
 		[]byte("record twelve"),
 		[]byte("record thirteen"),
 	}
-	for _, record := range records {
-		lm.Append(record)
+	lsns := make([]int, len(records))
+	for i, record := range records {
+		lsns[i], err = lm.Append(record)
+		assert.NoError(t, err)
 	}
 
 	iter, err := lm.Iterator()
@@ -131,6 +136,215 @@ func TestIterator(t *testing.T) {
 		assert.True(t, iter.HasNext())
 		rec := iter.Next()
 		assert.Equal(t, string(rec), string(records[i]))
+		assert.Equal(t, lsns[i], iter.LSN())
 	}
 	assert.False(t, iter.HasNext())
 }
+
+// TestStoreErrors checks that failures of the block store are returned by the log, which
+// keeps working with every record it accepted once the store works again
+func TestStoreErrors(t *testing.T) {
+	store := file.NewFaultyStore(file.NewMemoryManager(32))
+	defer store.Close()
+	errDisk := errors.New("disk error")
+
+	lm, err := NewManager(store, "test.log")
+	require.NoError(t, err)
+
+	// Each block holds a single record of 16 bytes, so every Append after the first
+	// flushes the current block and appends a new one
+	records := []string{"record number 01", "record number 02", "record number 03"}
+	_, err = lm.Append([]byte(records[0]))
+	require.NoError(t, err)
+
+	store.Fail(file.StoreAppend, errDisk, 1)
+	_, err = lm.Append([]byte(records[1]))
+	assert.ErrorIs(t, err, errDisk)
+	_, err = lm.Append([]byte(records[1]))
+	require.NoError(t, err)
+
+	store.Fail(file.StoreWrite, errDisk, -1)
+	_, err = lm.Append([]byte(records[2]))
+	assert.ErrorIs(t, err, errDisk)
+	assert.ErrorIs(t, lm.Flush(lm.latestLSN), errDisk)
+	_, err = lm.Iterator()
+	assert.ErrorIs(t, err, errDisk)
+	store.Heal(file.StoreWrite)
+	lsn, err := lm.Append([]byte(records[2]))
+	require.NoError(t, err)
+	require.NoError(t, lm.Flush(lsn))
+
+	iter, err := lm.Iterator()
+	require.NoError(t, err)
+	for i := len(records) - 1; i >= 0; i-- {
+		require.True(t, iter.HasNext())
+		assert.Equal(t, records[i], string(iter.Next()))
+	}
+	assert.False(t, iter.HasNext())
+}
+
+func TestLSNsSurviveReopening(t *testing.T) {
+	fm := file.NewMemoryManager(32)
+	defer fm.Close()
+
+	lm, err := NewManager(fm, "test.log")
+	assert.NoError(t, err)
+	first, err := lm.Append([]byte("record one"))
+	assert.NoError(t, err)
+	second, err := lm.Append([]byte("record two"))
+	assert.NoError(t, err)
+	assert.Greater(t, second, first)
+	assert.NoError(t, lm.Close())
+
+	// The reopened log continues after its last record
+	lm, err = NewManager(fm, "test.log")
+	assert.NoError(t, err)
+	assert.Equal(t, second, lm.LatestLSN())
+	third, err := lm.Append([]byte("record three"))
+	assert.NoError(t, err)
+	assert.Greater(t, third, second)
+
+	iter, err := lm.Iterator()
+	assert.NoError(t, err)
+	for _, lsn := range []int{third, second, first} {
+		assert.True(t, iter.HasNext())
+		iter.Next()
+		assert.Equal(t, lsn, iter.LSN())
+	}
+
+	// A record that can't fit in a block is refused
+	_, err = lm.Append(make([]byte, 32))
+	assert.Error(t, err)
+}
+
+func TestForwardIterator(t *testing.T) {
+	fm := file.NewMemoryManager(64)
+	defer fm.Close()
+
+	lm, err := NewManager(fm, "test.log")
+	assert.NoError(t, err)
+
+	// Records of different lengths spread over many blocks
+	records := [][]byte{}
+	lsns := []int{}
+	for i := range 200 {
+		record := []byte(strings.Repeat("x", i%20))
+		lsn, err := lm.Append(record)
+		assert.NoError(t, err)
+		records = append(records, record)
+		lsns = append(lsns, lsn)
+	}
+	numBlocks, err := fm.GetTotalBlocks("test.log")
+	assert.NoError(t, err)
+	assert.Greater(t, numBlocks, 40)
+
+	// Every block is read once, oldest record first
+	readBefore := fm.BlocksRead("test.log")
+	iter, err := lm.ForwardIterator(0)
+	assert.NoError(t, err)
+	for i := range records {
+		assert.True(t, iter.HasNext())
+		assert.Equal(t, records[i], iter.Next())
+		assert.Equal(t, lsns[i], iter.LSN())
+	}
+	assert.False(t, iter.HasNext())
+	assert.Equal(t, numBlocks, fm.BlocksRead("test.log")-readBefore)
+
+	// Starting after a record, in the middle of the log
+	for _, start := range []int{57, 58, 199} {
+		iter, err = lm.ForwardIterator(lsns[start])
+		assert.NoError(t, err)
+		for i := start + 1; i < len(records); i++ {
+			assert.True(t, iter.HasNext())
+			assert.Equal(t, records[i], iter.Next())
+			assert.Equal(t, lsns[i], iter.LSN())
+		}
+		assert.False(t, iter.HasNext())
+	}
+}
+
+func TestSegments(t *testing.T) {
+	fm := file.NewMemoryManager(64)
+	defer fm.Close()
+
+	lm, err := NewSegmentedManager(fm, "test.log", 4)
+	assert.NoError(t, err)
+
+	// Records spread over several segments of 4 blocks each
+	records := [][]byte{}
+	lsns := []int{}
+	for i := range 100 {
+		record := []byte(strings.Repeat("y", i%20))
+		lsn, err := lm.Append(record)
+		assert.NoError(t, err)
+		records = append(records, record)
+		lsns = append(lsns, lsn)
+	}
+	assert.NoError(t, lm.Close())
+	for _, fileName := range []string{"test.log", "test.log.1", "test.log.2"} {
+		numBlocks, err := fm.GetTotalBlocks(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, numBlocks, fileName)
+	}
+
+	// The reopened log keeps its segments, whatever segment size it is opened with
+	lm, err = NewManager(fm, "test.log")
+	assert.NoError(t, err)
+	assert.Equal(t, lsns[len(lsns)-1], lm.LatestLSN())
+
+	// Both iterators cross the segment boundaries
+	iter, err := lm.Iterator()
+	assert.NoError(t, err)
+	for i := len(records) - 1; i >= 0; i-- {
+		assert.True(t, iter.HasNext())
+		assert.Equal(t, records[i], iter.Next())
+		assert.Equal(t, lsns[i], iter.LSN())
+	}
+	assert.False(t, iter.HasNext())
+	forward, err := lm.ForwardIterator(0)
+	assert.NoError(t, err)
+	for i := range records {
+		assert.True(t, forward.HasNext())
+		assert.Equal(t, records[i], forward.Next())
+		assert.Equal(t, lsns[i], forward.LSN())
+	}
+	assert.False(t, forward.HasNext())
+
+	// The segments with no record after the LSN are emptied, and the iterators stop at
+	// the first segment kept
+	start := 60
+	removed, err := lm.RemoveSegments(lsns[start])
+	assert.NoError(t, err)
+	assert.Greater(t, removed, 0)
+	numBlocks, err := fm.GetTotalBlocks("test.log")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, numBlocks)
+	lm, err = NewManager(fm, "test.log")
+	assert.NoError(t, err)
+	iter, err = lm.Iterator()
+	assert.NoError(t, err)
+	oldest := len(records)
+	for iter.HasNext() {
+		oldest--
+		assert.Equal(t, records[oldest], iter.Next())
+		assert.Equal(t, lsns[oldest], iter.LSN())
+	}
+	assert.LessOrEqual(t, oldest, start)
+	assert.Greater(t, oldest, 0)
+	forward, err = lm.ForwardIterator(0)
+	assert.NoError(t, err)
+	assert.True(t, forward.HasNext())
+	assert.Equal(t, records[oldest], forward.Next())
+
+	// The current segment is never removed, and a log in a single file has none to remove
+	_, err = lm.RemoveSegments(lm.LatestLSN() + 1000)
+	assert.NoError(t, err)
+	lsn, err := lm.Append([]byte("after"))
+	assert.NoError(t, err)
+	assert.Greater(t, lsn, lsns[len(lsns)-1])
+	single, err := NewManager(fm, "single.log")
+	assert.NoError(t, err)
+	removed, err = single.RemoveSegments(single.LatestLSN())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
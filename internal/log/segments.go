@@ -0,0 +1,105 @@
+package log
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/file"
+)
+
+// A log can be split into segments, files holding the same number of its blocks each, so
+// that the segments recovery no longer needs can be dropped. The blocks are numbered from
+// the start of the log across its segments, so LSNs don't depend on how the log is split.
+// Segment 0 is the log file itself and segment n the log file with a ".n" suffix.
+//
+// The segment size and the oldest segment kept are stored in block 0 of the log file with a
+// ".seg" suffix, which is empty for a log kept in a single file.
+//
+// Segments file format: [blocks(4)] [first(4)]
+type segments struct {
+	logFilename string
+	// blocks is the number of blocks of each segment, or 0 for a log in a single file
+	blocks int
+	// first is the oldest segment kept; the ones before it were dropped
+	first int
+}
+
+// segmentsFileName returns the name of the file holding the segment size of the log
+func segmentsFileName(logFilename string) string {
+	return logFilename + ".seg"
+}
+
+// openSegments reads how the log is split into segments. A new log is split into segments
+// of segmentBlocks blocks, or kept in a single file if segmentBlocks is 0; an existing log
+// keeps the segments it was created with.
+func openSegments(fm file.BlockStore, logFilename string, segmentBlocks int) (segments, error) {
+	s := segments{logFilename: logFilename}
+	blk := file.NewBlockID(segmentsFileName(logFilename), 0)
+	size, err := fm.GetTotalBlocks(blk.Filename())
+	if err != nil {
+		return s, fmt.Errorf("not able to get total blocks in log segments file: %w", err)
+	}
+	if size > 0 {
+		page := file.NewPage(fm.BlockSize())
+		err = fm.Read(blk, page)
+		if err != nil {
+			return s, fmt.Errorf("not able to read log segments file: %w", err)
+		}
+		s.blocks = page.GetInt(0)
+		s.first = page.GetInt(4)
+		return s, nil
+	}
+	if segmentBlocks <= 0 {
+		return s, nil
+	}
+
+	logBlocks, err := fm.GetTotalBlocks(logFilename)
+	if err != nil {
+		return s, fmt.Errorf("not able to get total blocks in log file: %w", err)
+	}
+	if logBlocks > 0 {
+		return s, nil
+	}
+	s.blocks = segmentBlocks
+	return s, s.save(fm)
+}
+
+// save writes the segment size and the oldest segment kept to the segments file
+func (s segments) save(fm file.BlockStore) error {
+	page := file.NewPage(fm.BlockSize())
+	page.SetInt(0, s.blocks)
+	page.SetInt(4, s.first)
+	err := fm.Write(file.NewBlockID(segmentsFileName(s.logFilename), 0), page)
+	if err != nil {
+		return fmt.Errorf("not able to write log segments file: %w", err)
+	}
+	return nil
+}
+
+// fileName returns the name of the file of the segment
+func (s segments) fileName(segment int) string {
+	if segment == 0 {
+		return s.logFilename
+	}
+	return fmt.Sprintf("%s.%d", s.logFilename, segment)
+}
+
+// segment returns the segment holding the block with the given number
+func (s segments) segment(blockNum int) int {
+	if s.blocks == 0 {
+		return 0
+	}
+	return blockNum / s.blocks
+}
+
+// block returns the block of its segment's file the block with the given number is
+func (s segments) block(blockNum int) *file.BlockID {
+	if s.blocks == 0 {
+		return file.NewBlockID(s.logFilename, blockNum)
+	}
+	return file.NewBlockID(s.fileName(blockNum/s.blocks), blockNum%s.blocks)
+}
+
+// firstBlock returns the number of the oldest block kept
+func (s segments) firstBlock() int {
+	return s.first * s.blocks
+}
@@ -0,0 +1,66 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/file"
+)
+
+const (
+	// FormatFileName is the name of the file holding the version of the format the files of
+	// the database are written in
+	FormatFileName = "format"
+	// FormatVersion is the version of the format this build reads and writes. Version 2 gave
+	// every record page a header counting its slots in use, and version 3 keeps the key
+	// encoding of index values in index records; a database without a format file was
+	// written in version 1.
+	FormatVersion = 3
+)
+
+// ErrUnsupportedFormat is returned when a database is opened whose files are written in a
+// format other than FormatVersion
+var ErrUnsupportedFormat = errors.New("unsupported database format")
+
+// CheckFormat checks that the files of the database are written in FormatVersion, or marks
+// them as such if the database is new. It is called before the database is first read,
+// since a record page of another version would be misread rather than fail.
+//
+// Format file format: [version(4)]
+func CheckFormat(fm file.BlockStore) error {
+	blk := file.NewBlockID(FormatFileName, 0)
+	size, err := fm.GetTotalBlocks(blk.Filename())
+	if err != nil {
+		return fmt.Errorf("not able to get total blocks in format file: %w", err)
+	}
+	page := file.NewPage(fm.BlockSize())
+	if size > 0 {
+		err = fm.Read(blk, page)
+		if err != nil {
+			return fmt.Errorf("not able to read format file: %w", err)
+		}
+		return checkVersion(page.GetInt(0))
+	}
+
+	tables, err := fm.GetTotalBlocks(TableCatalogName + ".tbl")
+	if err != nil {
+		return fmt.Errorf("not able to get total blocks in table catalog: %w", err)
+	}
+	if tables > 0 {
+		return checkVersion(1)
+	}
+	page.SetInt(0, FormatVersion)
+	err = fm.Write(blk, page)
+	if err != nil {
+		return fmt.Errorf("not able to write format file: %w", err)
+	}
+	return nil
+}
+
+func checkVersion(version int) error {
+	if version != FormatVersion {
+		return fmt.Errorf("%w: the database is written in version %d, this build reads version %d",
+			ErrUnsupportedFormat, version, FormatVersion)
+	}
+	return nil
+}
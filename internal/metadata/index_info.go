@@ -9,6 +9,7 @@ import (
 // IndexInfo contains info necessary to estimate index costs and open the index
 type IndexInfo struct {
 	indexName   string
+	indexType   string
 	fieldName   string
 	tableSchema *record.Schema
 	transaction *transaction.Transaction
@@ -16,11 +17,13 @@ type IndexInfo struct {
 	statInfo    *StatInfo
 }
 
-// NewIndexInfo creates an IndexInfo object for the specified index.
-func NewIndexInfo(indexName string, fieldName string, tableSchema *record.Schema,
+// NewIndexInfo creates an IndexInfo object for the specified index, which is of one of the
+// kinds of the index package: index.HashType or index.BTreeType.
+func NewIndexInfo(indexName string, indexType string, fieldName string, tableSchema *record.Schema,
 	transaction *transaction.Transaction, statInfo *StatInfo) *IndexInfo {
 	ii := &IndexInfo{
 		indexName:   indexName,
+		indexType:   indexType,
 		fieldName:   fieldName,
 		transaction: transaction,
 		tableSchema: tableSchema,
@@ -30,24 +33,36 @@ func NewIndexInfo(indexName string, fieldName string, tableSchema *record.Schema
 	return ii
 }
 
-func (ii *IndexInfo) Open() (*index.HashIndex, error) {
-	index, err := index.NewHashIndex(ii.transaction, ii.indexName, ii.indexLayout)
+// Open opens the index with the implementation of its kind. A B-tree index can also be
+// searched for ranges, as an index.RangeIndex.
+func (ii *IndexInfo) Open() (index.Index, error) {
+	if ii.indexType == index.BTreeType {
+		idx, err := index.NewBTreeIndex(ii.transaction, ii.indexName, ii.indexLayout)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	idx, err := index.NewHashIndex(ii.transaction, ii.indexName, ii.indexLayout)
 	if err != nil {
 		return nil, err
 	}
-	return index, nil
+	return idx, nil
 }
 
 // BlocksAccessed gives estimates no of blocks to search for a single key
 func (ii *IndexInfo) BlocksAccessed() int {
-	recordsPerBlock := ii.transaction.BlockSize() / ii.indexLayout.GetSlotSize()
+	recordsPerBlock := max(index.KeyLayout(ii.indexLayout).SlotsPerBlock(ii.transaction.BlockSize()), 1)
 	numBlocks := ii.statInfo.RecordsOutput() / recordsPerBlock
+	if ii.indexType == index.BTreeType {
+		return index.BTreeSearchCost(numBlocks, recordsPerBlock)
+	}
 	return index.HashSearchCost(numBlocks)
 }
 
 // RecordsOutput gives estimates no of records for index key
 func (ii *IndexInfo) RecordsOutput() int {
-	return ii.statInfo.RecordsOutput() / ii.statInfo.DistinctValues(ii.fieldName)
+	return ii.statInfo.RecordsOutput() / max(ii.statInfo.DistinctValues(ii.fieldName), 1)
 }
 
 // DistinctValues gives distinct values for the field
@@ -59,7 +74,8 @@ func (ii *IndexInfo) DistinctValues(fieldName string) int {
 	return ii.statInfo.DistinctValues(fieldName)
 }
 
-// CreateIndexLayout builds the layout for index records: block, id, dataval
+// CreateIndexLayout builds the layout for index values: block, id, dataval. The index keeps
+// its records in index.KeyLayout of it.
 func (ii *IndexInfo) CreateIndexLayout() *record.Layout {
 	sch := record.NewSchema()
 	sch.AddIntField("block")
@@ -67,6 +83,8 @@ func (ii *IndexInfo) CreateIndexLayout() *record.Layout {
 
 	if ii.tableSchema.Type(ii.fieldName) == "int" {
 		sch.AddIntField("dataval")
+	} else if ii.tableSchema.Type(ii.fieldName) == "bigint" {
+		sch.AddBigIntField("dataval")
 	} else {
 		fldLen := ii.tableSchema.Length(ii.fieldName)
 		sch.AddStringField("dataval", fldLen)
@@ -79,6 +97,11 @@ func (ii *IndexInfo) IndexName() string {
 	return ii.indexName
 }
 
+// IndexType returns the kind of the index: index.HashType or index.BTreeType.
+func (ii *IndexInfo) IndexType() string {
+	return ii.indexType
+}
+
 func (ii *IndexInfo) FieldName() string {
 	return ii.fieldName
 }
@@ -1,6 +1,9 @@
 package metadata
 
 import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/table"
 	"github.com/yashagw/cranedb/internal/transaction"
@@ -9,6 +12,7 @@ import (
 const (
 	IndexCatalogName = "idx_catelog"
 	MaxIndexName     = 50
+	MaxIndexType     = 10
 )
 
 type IndexManager struct {
@@ -27,18 +31,28 @@ func NewIndexManager(isNew bool, tableManager *TableManager, statsManager *Stats
 		schema.AddStringField("indexname", MaxIndexName)
 		schema.AddStringField("tablename", MaxStringSize)
 		schema.AddStringField("fieldname", MaxStringSize)
+		schema.AddStringField("indextype", MaxIndexType)
 		tableManager.CreateTable(IndexCatalogName, schema, tx)
 	}
 
 	return im
 }
 
-// CreateIndex inserts a new index metadata row into the index catalog
-func (im *IndexManager) CreateIndex(indexName string, tableName string, fieldName string, tx *transaction.Transaction) error {
+// CreateIndex inserts a new index metadata row into the index catalog. The index type is
+// index.HashType or index.BTreeType.
+func (im *IndexManager) CreateIndex(indexName string, tableName string, fieldName string, indexType string, tx *transaction.Transaction) error {
+	if indexType != index.HashType && indexType != index.BTreeType {
+		return fmt.Errorf("unknown index type: %s", indexType)
+	}
 	layout, err := im.tableManager.GetLayout(IndexCatalogName, tx)
 	if err != nil {
 		return err
 	}
+	// The catalog of a database created before index types were recorded only has hash indexes
+	hasType := layout.GetSchema().HasField("indextype")
+	if !hasType && indexType != index.HashType {
+		return fmt.Errorf("the index catalog of this database can only hold hash indexes")
+	}
 
 	ts, err := table.NewTableScan(tx, layout, IndexCatalogName)
 	if err != nil {
@@ -62,7 +76,9 @@ func (im *IndexManager) CreateIndex(indexName string, tableName string, fieldNam
 	if err != nil {
 		return err
 	}
-
+	if hasType {
+		return ts.SetString("indextype", indexType)
+	}
 	return nil
 }
 
@@ -105,19 +121,164 @@ func (im *IndexManager) GetIndexInfo(tableName string, tx *transaction.Transacti
 		if err != nil {
 			return nil, err
 		}
-
-		tblLayout, err := im.tableManager.GetLayout(tableName, tx)
+		idxType, err := indexType(ts, layout)
 		if err != nil {
 			return nil, err
 		}
-		si, err := im.statsManager.GetStatInfo(tableName, tblLayout, tx)
+
+		ii, err := im.indexInfo(idxName, idxType, tableName, fldName, tx)
 		if err != nil {
 			return nil, err
 		}
-		ii := NewIndexInfo(idxName, fldName, tblLayout.GetSchema(), tx, si)
-
 		result[fldName] = ii
 	}
 
 	return result, nil
 }
+
+// RebuildIndex empties the index and fills it again from its table, with an entry for the
+// indexed field of every record. It returns the number of entries.
+func (im *IndexManager) RebuildIndex(indexName string, tx *transaction.Transaction) (int, error) {
+	tableName, fieldName, idxType, err := im.findIndex(indexName, tx)
+	if err != nil {
+		return 0, err
+	}
+	ii, err := im.indexInfo(indexName, idxType, tableName, fieldName, tx)
+	if err != nil {
+		return 0, err
+	}
+	return im.rebuild(ii, tableName, tx)
+}
+
+// RebuildTableIndexes rebuilds every index of the table like RebuildIndex, and returns the
+// number of entries of all of them.
+func (im *IndexManager) RebuildTableIndexes(tableName string, tx *transaction.Transaction) (int, error) {
+	// Fails if the table doesn't exist, rather than finding no indexes
+	if _, err := im.tableManager.GetLayout(tableName, tx); err != nil {
+		return 0, err
+	}
+	indexes, err := im.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, ii := range indexes {
+		count, err := im.rebuild(ii, tableName, tx)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// findIndex returns the table, field and type of the index from the index catalog
+func (im *IndexManager) findIndex(indexName string, tx *transaction.Transaction) (string, string, string, error) {
+	layout, err := im.tableManager.GetLayout(IndexCatalogName, tx)
+	if err != nil {
+		return "", "", "", err
+	}
+	ts, err := table.NewTableScan(tx, layout, IndexCatalogName)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer ts.Close()
+
+	for {
+		hasNext, err := ts.Next()
+		if err != nil {
+			return "", "", "", err
+		}
+		if !hasNext {
+			return "", "", "", fmt.Errorf("index %s not found", indexName)
+		}
+		idxName, err := ts.GetString("indexname")
+		if err != nil {
+			return "", "", "", err
+		}
+		if idxName != indexName {
+			continue
+		}
+		tableName, err := ts.GetString("tablename")
+		if err != nil {
+			return "", "", "", err
+		}
+		fieldName, err := ts.GetString("fieldname")
+		if err != nil {
+			return "", "", "", err
+		}
+		idxType, err := indexType(ts, layout)
+		if err != nil {
+			return "", "", "", err
+		}
+		return tableName, fieldName, idxType, nil
+	}
+}
+
+// indexType returns the type of the index of the catalog row the scan is on. Catalogs of
+// databases created before index types were recorded have no indextype field, and their
+// indexes are all hash indexes.
+func indexType(ts *table.TableScan, layout *record.Layout) (string, error) {
+	if !layout.GetSchema().HasField("indextype") {
+		return index.HashType, nil
+	}
+	return ts.GetString("indextype")
+}
+
+// indexInfo returns the IndexInfo of an index of the table
+func (im *IndexManager) indexInfo(indexName string, indexType string, tableName string, fieldName string, tx *transaction.Transaction) (*IndexInfo, error) {
+	tblLayout, err := im.tableManager.GetLayout(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	si, err := im.statsManager.GetStatInfo(tableName, tblLayout, tx)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexInfo(indexName, indexType, fieldName, tblLayout.GetSchema(), tx, si), nil
+}
+
+// rebuild clears the index, then inserts an entry for every record of its table
+func (im *IndexManager) rebuild(ii *IndexInfo, tableName string, tx *transaction.Transaction) (int, error) {
+	layout, err := im.tableManager.GetLayout(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	idx, err := ii.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer idx.Close()
+	if err := idx.Clear(); err != nil {
+		return 0, err
+	}
+
+	ts, err := table.NewTableScan(tx, layout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer ts.Close()
+
+	count := 0
+	for {
+		hasNext, err := ts.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !hasNext {
+			return count, nil
+		}
+		val, err := ts.GetValue(ii.FieldName())
+		if err != nil {
+			return 0, err
+		}
+		rid, err := ts.GetRID()
+		if err != nil {
+			return 0, err
+		}
+		if err := idx.Insert(val, rid); err != nil {
+			return 0, err
+		}
+		count++
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/log"
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/transaction"
@@ -49,7 +50,7 @@ func TestIndexManager_BasicOperations(t *testing.T) {
 
 	// Test 3: Create an index
 	tx3 := transaction.NewTransaction(fm, lm, bm, lockTable)
-	err = im.CreateIndex("users_id_idx", "users", "id", tx3)
+	err = im.CreateIndex("users_id_idx", "users", "id", index.HashType, tx3)
 	require.NoError(t, err, "Should create index successfully")
 	tx3.Commit()
 
@@ -66,3 +67,53 @@ func TestIndexManager_BasicOperations(t *testing.T) {
 	assert.NotNil(t, indexInfo["id"].tableSchema)
 	assert.NotNil(t, indexInfo["id"].indexLayout)
 }
+
+func TestIndexManager_IndexTypes(t *testing.T) {
+	dbDir := t.TempDir()
+
+	fm, err := file.NewManager(dbDir, 400)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	tm := NewTableManager(true, tx)
+	sm := NewStatsManager(tm, tx)
+	im := NewIndexManager(true, tm, sm, tx)
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddIntField("age")
+	require.NoError(t, tm.CreateTable("users", schema, tx))
+
+	require.NoError(t, im.CreateIndex("users_id_idx", "users", "id", index.HashType, tx))
+	require.NoError(t, im.CreateIndex("users_age_idx", "users", "age", index.BTreeType, tx))
+	assert.ErrorContains(t, im.CreateIndex("users_bad_idx", "users", "age", "gist", tx), "unknown index type")
+	require.NoError(t, tx.Commit())
+
+	// The type is read back from the catalog, and the index is opened with its implementation
+	tx = transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	indexInfo, err := im.GetIndexInfo("users", tx)
+	require.NoError(t, err)
+	require.Len(t, indexInfo, 2)
+	assert.Equal(t, index.HashType, indexInfo["id"].IndexType())
+	assert.Equal(t, index.BTreeType, indexInfo["age"].IndexType())
+
+	hashIdx, err := indexInfo["id"].Open()
+	require.NoError(t, err)
+	defer hashIdx.Close()
+	assert.IsType(t, &index.HashIndex{}, hashIdx)
+	btreeIdx, err := indexInfo["age"].Open()
+	require.NoError(t, err)
+	defer btreeIdx.Close()
+	assert.IsType(t, &index.BTreeIndex{}, btreeIdx)
+
+	// Rebuilding finds the type too
+	_, err = im.RebuildIndex("users_age_idx", tx)
+	require.NoError(t, err)
+}
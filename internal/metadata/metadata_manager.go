@@ -1,10 +1,21 @@
 package metadata
 
 import (
+	"log"
+	"slices"
+
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
+// catalogTables are the system tables that hold the database's metadata.
+var catalogTables = []string{TableCatalogName, FieldCatalogName, ViewCatalogName, IndexCatalogName, StatsCatalogName}
+
+// IsCatalogTable reports whether the table is one of the system catalog tables.
+func IsCatalogTable(tableName string) bool {
+	return slices.Contains(catalogTables, tableName)
+}
+
 type Manager struct {
 	tableManager *TableManager
 	viewManager  *ViewManager
@@ -15,8 +26,12 @@ type Manager struct {
 func NewManager(isNew bool, tx *transaction.Transaction) *Manager {
 	tableManager := NewTableManager(isNew, tx)
 	viewManager := NewViewManager(isNew, tableManager, tx)
-	indexManager := NewIndexManager(isNew, tableManager, NewStatsManager(tableManager, tx), tx)
 	statsManager := NewStatsManager(tableManager, tx)
+	indexManager := NewIndexManager(isNew, tableManager, statsManager, tx)
+	if err := statsManager.LoadStats(tx); err != nil {
+		// The statistics are recalculated when first needed
+		log.Printf("[STATS] failed to load saved stats: %v", err)
+	}
 
 	return &Manager{
 		tableManager: tableManager,
@@ -30,12 +45,49 @@ func (m *Manager) CreateTable(tableName string, schema *record.Schema, tx *trans
 	return m.tableManager.CreateTable(tableName, schema, tx)
 }
 
+// CreateTableWithLayout creates a table whose records are laid out as given, e.g. with packed strings
+func (m *Manager) CreateTableWithLayout(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	return m.tableManager.CreateTableWithLayout(tableName, layout, tx)
+}
+
+// SetTableLayout replaces the layout of a table whose records have been rewritten into it,
+// and drops its statistics, which were gathered from the old records.
+func (m *Manager) SetTableLayout(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	err := m.tableManager.SetLayout(tableName, layout, tx)
+	if err != nil {
+		return err
+	}
+	m.statsManager.TableRewritten(tableName, tx)
+	return nil
+}
+
 func (m *Manager) CreateView(viewName string, viewDef string, tx *transaction.Transaction) error {
 	return m.viewManager.CreateView(viewName, viewDef, tx)
 }
 
-func (m *Manager) CreateIndex(indexName string, tableName string, fieldName string, tx *transaction.Transaction) error {
-	return m.indexManager.CreateIndex(indexName, tableName, fieldName, tx)
+func (m *Manager) CreateIndex(indexName string, tableName string, fieldName string, indexType string, tx *transaction.Transaction) error {
+	return m.indexManager.CreateIndex(indexName, tableName, fieldName, indexType, tx)
+}
+
+// RebuildIndex empties the index and fills it again from the records of its table,
+// returning the number of entries.
+func (m *Manager) RebuildIndex(indexName string, tx *transaction.Transaction) (int, error) {
+	return m.indexManager.RebuildIndex(indexName, tx)
+}
+
+// RebuildTableIndexes rebuilds every index of the table, returning their number of entries.
+func (m *Manager) RebuildTableIndexes(tableName string, tx *transaction.Transaction) (int, error) {
+	return m.indexManager.RebuildTableIndexes(tableName, tx)
+}
+
+// ListTables returns the names of the user tables, in creation order.
+// The system catalog tables are left out.
+func (m *Manager) ListTables(tx *transaction.Transaction) ([]string, error) {
+	tables, err := m.tableManager.ListTables(tx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(tables, IsCatalogTable), nil
 }
 
 func (m *Manager) GetTableLayout(tableName string, tx *transaction.Transaction) (*record.Layout, error) {
@@ -53,3 +105,76 @@ func (m *Manager) GetIndexInfo(tableName string, tx *transaction.Transaction) (m
 func (m *Manager) GetStatInfo(tableName string, layout *record.Layout, tx *transaction.Transaction) (*StatInfo, error) {
 	return m.statsManager.GetStatInfo(tableName, layout, tx)
 }
+
+// RecordInserted updates the statistics of the table after a record is inserted at rid.
+func (m *Manager) RecordInserted(tableName string, rid *record.RID, tx *transaction.Transaction) {
+	m.statsManager.RecordInserted(tableName, rid, tx)
+}
+
+// RecordsInserted updates the statistics of the table after records are inserted at rids.
+func (m *Manager) RecordsInserted(tableName string, rids []*record.RID, tx *transaction.Transaction) {
+	m.statsManager.RecordsInserted(tableName, rids, tx)
+}
+
+// RecordsDeleted updates the statistics of the table after records are deleted.
+func (m *Manager) RecordsDeleted(tableName string, count int, tx *transaction.Transaction) {
+	m.statsManager.RecordsDeleted(tableName, count, tx)
+}
+
+// RecordsModified updates the statistics of the table after records are modified.
+func (m *Manager) RecordsModified(tableName string, count int, tx *transaction.Transaction) {
+	m.statsManager.RecordsModified(tableName, count, tx)
+}
+
+// IsStatInfoFresh checks if the statistics still describe the table exactly.
+func (m *Manager) IsStatInfoFresh(tableName string, si *StatInfo) bool {
+	return m.statsManager.IsFresh(tableName, si)
+}
+
+// SaveStats saves the table statistics so that the next start doesn't need to recalculate them.
+func (m *Manager) SaveStats(tx *transaction.Transaction) error {
+	return m.statsManager.SaveStats(tx)
+}
+
+// TableStats holds the statistics the planner uses for a table, along with its indexes.
+type TableStats struct {
+	BlocksAccessed int
+	RecordsOutput  int
+	// Fields lists the table's fields in schema order
+	Fields []string
+	// DistinctValues holds the number of distinct values of each field
+	DistinctValues map[string]int
+	// Indexes maps each indexed field to the name of its index
+	Indexes map[string]string
+}
+
+// TableStats returns the statistics of the table and the indexes on it.
+func (m *Manager) TableStats(tableName string, tx *transaction.Transaction) (*TableStats, error) {
+	layout, err := m.tableManager.GetLayout(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	si, err := m.statsManager.GetStatInfo(tableName, layout, tx)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := m.indexManager.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &TableStats{
+		BlocksAccessed: si.BlocksAccessed(),
+		RecordsOutput:  si.RecordsOutput(),
+		Fields:         layout.GetSchema().Fields(),
+		DistinctValues: map[string]int{},
+		Indexes:        map[string]string{},
+	}
+	for _, fieldName := range stats.Fields {
+		stats.DistinctValues[fieldName] = si.DistinctValues(fieldName)
+	}
+	for fieldName, ii := range indexes {
+		stats.Indexes[fieldName] = ii.IndexName()
+	}
+	return stats, nil
+}
@@ -8,8 +8,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/log"
 	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/table"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
@@ -95,7 +97,7 @@ func TestMetadataManager_BasicOperations(t *testing.T) {
 
 	// Test 7: Create an index through MetadataManager
 	tx7 := transaction.NewTransaction(fm, lm, bm, lockTable)
-	err = mm.CreateIndex("users_id_idx", "users", "id", tx7)
+	err = mm.CreateIndex("users_id_idx", "users", "id", index.HashType, tx7)
 	require.NoError(t, err, "Should create index successfully")
 	tx7.Commit()
 
@@ -131,4 +133,133 @@ func TestMetadataManager_BasicOperations(t *testing.T) {
 	require.NoError(t, err, "Should not return error for non-existent view")
 	assert.Equal(t, "", viewDef, "Should return empty string for non-existent view")
 	tx11.Commit()
+
+	// Test 12: List tables leaves out the system catalog tables
+	tx12 := transaction.NewTransaction(fm, lm, bm, lockTable)
+	tables, err := mm.ListTables(tx12)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users"}, tables)
+	allTables, err := mm.tableManager.ListTables(tx12)
+	require.NoError(t, err)
+	assert.Contains(t, allTables, TableCatalogName)
+	assert.True(t, IsCatalogTable(IndexCatalogName))
+	assert.False(t, IsCatalogTable("users"))
+	tx12.Commit()
+}
+
+func TestMetadataManager_StatsPersistAcrossRestarts(t *testing.T) {
+	dbDir := "testdata_stats_restart"
+	defer os.RemoveAll(dbDir)
+
+	fm, err := file.NewManager(dbDir, 400)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	// insertRows adds records to the table without going through the planner,
+	// so the stats manager doesn't know the table changed
+	insertRows := func(tx *transaction.Transaction, layout *record.Layout, ids ...int) {
+		ts, err := table.NewTableScan(tx, layout, "scores")
+		require.NoError(t, err)
+		defer ts.Close()
+		for _, id := range ids {
+			require.NoError(t, ts.Insert())
+			require.NoError(t, ts.SetInt("id", id))
+			require.NoError(t, ts.SetInt("score", id%3))
+		}
+	}
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	md := NewManager(true, tx)
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddIntField("score")
+	require.NoError(t, md.CreateTable("scores", schema, tx))
+	layout, err := md.GetTableLayout("scores", tx)
+	require.NoError(t, err)
+	insertRows(tx, layout, 1, 2, 3, 4, 5, 6)
+
+	si, err := md.GetStatInfo("scores", layout, tx)
+	require.NoError(t, err)
+	require.Equal(t, 6, si.RecordsOutput())
+	require.NoError(t, md.SaveStats(tx))
+	require.NoError(t, tx.Commit())
+
+	// Restart: the saved stats are used without scanning the table, so a record
+	// added behind the stats manager's back isn't counted
+	tx = transaction.NewTransaction(fm, lm, bm, lockTable)
+	insertRows(tx, layout, 7)
+	md = NewManager(false, tx)
+	si, err = md.GetStatInfo("scores", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, si.RecordsOutput())
+	assert.Equal(t, 6, si.DistinctValues("id"))
+	assert.Equal(t, 3, si.DistinctValues("score"))
+	assert.True(t, md.IsStatInfoFresh("scores", si))
+
+	tables, err := md.ListTables(tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"scores"}, tables, "The stats catalog should be hidden")
+	require.NoError(t, tx.Commit())
+
+	// Restarting without saving the stats again rescans the table
+	tx = transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	md = NewManager(false, tx)
+	si, err = md.GetStatInfo("scores", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 7, si.RecordsOutput())
+	assert.Equal(t, 7, si.DistinctValues("id"))
+}
+
+func TestMetadataManager_TableStats(t *testing.T) {
+	dbDir := "testdata_table_stats"
+	defer os.RemoveAll(dbDir)
+
+	fm, err := file.NewManager(dbDir, 400)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	md := NewManager(true, tx)
+
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddIntField("score")
+	require.NoError(t, md.CreateTable("scores", schema, tx))
+	require.NoError(t, md.CreateIndex("scores_id", "scores", "id", index.HashType, tx))
+	layout, err := md.GetTableLayout("scores", tx)
+	require.NoError(t, err)
+
+	ts, err := table.NewTableScan(tx, layout, "scores")
+	require.NoError(t, err)
+	for id := 1; id <= 50; id++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("id", id))
+		require.NoError(t, ts.SetInt("score", id%5))
+	}
+	ts.Close()
+
+	stats, err := md.TableStats("scores", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 50, stats.RecordsOutput)
+	assert.Equal(t, 2, stats.BlocksAccessed)
+	assert.Equal(t, []string{"id", "score"}, stats.Fields)
+	assert.Equal(t, map[string]int{"id": 50, "score": 5}, stats.DistinctValues)
+	assert.Equal(t, map[string]string{"id": "scores_id"}, stats.Indexes)
+
+	_, err = md.TableStats("missing", tx)
+	assert.Error(t, err)
 }
@@ -5,6 +5,11 @@ type StatInfo struct {
 	numBlocks    int
 	numRecs      int
 	distinctVals map[string]int
+
+	// version is the table's modification count when the statistics were calculated
+	version int
+	// changes is the number of records inserted, deleted or modified since then
+	changes int
 }
 
 // NewStatInfo creates a new StatInfo instance
@@ -26,7 +31,8 @@ func (s *StatInfo) RecordsOutput() int {
 	return s.numRecs
 }
 
-// DistinctValues returns the actual count of distinct values for a given field
+// DistinctValues returns the exact count of distinct values for a given field at the time
+// the statistics were calculated, or 0 if the table has no such field
 func (s *StatInfo) DistinctValues(fieldName string) int {
 	if _, exists := s.distinctVals[fieldName]; exists {
 		return s.distinctVals[fieldName]
@@ -1,7 +1,9 @@
 package metadata
 
 import (
+	"fmt"
 	"log"
+	"slices"
 	"sync"
 
 	"github.com/yashagw/cranedb/internal/record"
@@ -9,12 +11,26 @@ import (
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
+const (
+	StatsCatalogName = "stat_catelog"
+)
+
+// statsRefreshMinChanges is the number of records that must be inserted, deleted or
+// modified before a table's statistics are recalculated, or the number of records the
+// table had, if that is larger. Record and block counts are kept up to date as records
+// change, but distinct value counts can only be recalculated by scanning the table.
+const statsRefreshMinChanges = 100
+
 // StatsManager manages statistical information for all tables
 type StatsManager struct {
 	tblMgr     *TableManager
 	tableStats map[string]*StatInfo
-	numCalls   int
-	mutex      sync.RWMutex
+	versions   map[string]int
+	// writers counts, per table, the transactions that changed its records and haven't ended yet
+	writers map[string]int
+	// txTables holds the tables changed by each of those transactions
+	txTables map[*transaction.Transaction]map[string]bool
+	mutex    sync.RWMutex
 }
 
 // NewStatsManager creates a new StatsManager instance
@@ -22,7 +38,9 @@ func NewStatsManager(tblMgr *TableManager, tx *transaction.Transaction) *StatsMa
 	return &StatsManager{
 		tblMgr:     tblMgr,
 		tableStats: make(map[string]*StatInfo),
-		numCalls:   0,
+		versions:   make(map[string]int),
+		writers:    make(map[string]int),
+		txTables:   make(map[*transaction.Transaction]map[string]bool),
 	}
 }
 
@@ -30,44 +48,326 @@ func NewStatsManager(tblMgr *TableManager, tx *transaction.Transaction) *StatsMa
 func (sm *StatsManager) GetStatInfo(tblName string, layout *record.Layout, tx *transaction.Transaction) (*StatInfo, error) {
 	log.Printf("[STATS] GetStatInfo: table %s", tblName)
 
-	// Check cache with read lock first
 	sm.mutex.RLock()
 	si, exists := sm.tableStats[tblName]
 	sm.mutex.RUnlock()
 
-	// Increment call count and check if refresh is needed (but don't block on refresh)
-	sm.mutex.Lock()
-	sm.numCalls++
-	shouldRefresh := sm.numCalls > 100 && sm.numCalls%100 == 0
-	sm.mutex.Unlock()
-
-	// If refresh is needed
-	// Force recalculation of this table's stats
-	if shouldRefresh {
-		sm.mutex.Lock()
-		sm.tableStats = make(map[string]*StatInfo)
-		sm.mutex.Unlock()
+	if exists && si.changes >= max(si.numRecs, statsRefreshMinChanges) {
 		exists = false
 	}
 
-	// Need to calculate stats - acquire write lock to prevent concurrent calculations
+	// Need to calculate stats. The scan runs without holding the mutex since it
+	// may block on another transaction's locks, and that transaction may itself
+	// need the stats manager before it can commit.
 	if !exists {
-		sm.mutex.Lock()
-
 		log.Printf("[STATS] GetStatInfo: Recalculating stats for %s", tblName)
+		// Take the version before scanning, so a modification made during the scan
+		// leaves the new stats stale
+		sm.mutex.RLock()
+		version := sm.versions[tblName]
+		sm.mutex.RUnlock()
+
 		calculated, err := sm.calcTableStats(tblName, layout, tx)
 		if err != nil {
 			return nil, err
 		}
-		sm.tableStats[tblName] = calculated
-		si = calculated
+		calculated.version = version
 
+		sm.mutex.Lock()
+		sm.tableStats[tblName] = calculated
 		sm.mutex.Unlock()
+		si = calculated
 	}
 
 	return si, nil
 }
 
+// RecordInserted updates the cached statistics of the table for a record inserted at rid.
+func (sm *StatsManager) RecordInserted(tblName string, rid *record.RID, tx *transaction.Transaction) {
+	sm.recordsChanged(tblName, 1, 1, rid.Block()+1, tx)
+}
+
+// RecordsInserted updates the cached statistics of the table for records inserted at rids.
+func (sm *StatsManager) RecordsInserted(tblName string, rids []*record.RID, tx *transaction.Transaction) {
+	numBlocks := 0
+	for _, rid := range rids {
+		numBlocks = max(numBlocks, rid.Block()+1)
+	}
+	sm.recordsChanged(tblName, len(rids), len(rids), numBlocks, tx)
+}
+
+// RecordsDeleted updates the cached statistics of the table for deleted records.
+func (sm *StatsManager) RecordsDeleted(tblName string, count int, tx *transaction.Transaction) {
+	sm.recordsChanged(tblName, -count, count, 0, tx)
+}
+
+// RecordsModified notes that records of the table were modified, which changes its
+// distinct value counts but not the number of records.
+func (sm *StatsManager) RecordsModified(tblName string, count int, tx *transaction.Transaction) {
+	sm.recordsChanged(tblName, 0, count, 0, tx)
+}
+
+// TableRewritten notes that every record of the table was written again, e.g. in another
+// layout, so that its statistics are recalculated when next needed.
+func (sm *StatsManager) TableRewritten(tblName string, tx *transaction.Transaction) {
+	sm.recordsChanged(tblName, 0, 0, 0, tx)
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	delete(sm.tableStats, tblName)
+}
+
+// recordsChanged adds delta records to the cached statistics of the table, without
+// scanning it. The statistics are replaced rather than changed, since plans may be
+// reading them. Until the transaction ends, the statistics are no longer fresh;
+// if its changes are rolled back, they are dropped to be recalculated.
+func (sm *StatsManager) recordsChanged(tblName string, delta int, changed int, numBlocks int, tx *transaction.Transaction) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	tables, exists := sm.txTables[tx]
+	if !exists {
+		tables = make(map[string]bool)
+		sm.txTables[tx] = tables
+		tx.OnEnd(func(allCommitted bool) {
+			sm.transactionEnded(tx, allCommitted)
+		})
+	}
+	if !tables[tblName] {
+		tables[tblName] = true
+		sm.writers[tblName]++
+	}
+
+	// Statistics already handed out no longer match the table
+	wasCurrent := false
+	si, cached := sm.tableStats[tblName]
+	if cached {
+		wasCurrent = si.version == sm.versions[tblName]
+	}
+	sm.versions[tblName]++
+	if !cached {
+		return
+	}
+
+	updated := *si
+	updated.numRecs = max(si.numRecs+delta, 0)
+	updated.numBlocks = max(si.numBlocks, numBlocks)
+	updated.changes += changed
+	if wasCurrent {
+		updated.version = sm.versions[tblName]
+	}
+	sm.tableStats[tblName] = &updated
+}
+
+// transactionEnded is called when a transaction that changed records ends.
+func (sm *StatsManager) transactionEnded(tx *transaction.Transaction, allCommitted bool) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	for tblName := range sm.txTables[tx] {
+		sm.writers[tblName]--
+		if sm.writers[tblName] == 0 {
+			delete(sm.writers, tblName)
+		}
+		if !allCommitted {
+			// The counts include changes that were undone
+			delete(sm.tableStats, tblName)
+			sm.versions[tblName]++
+		}
+	}
+	delete(sm.txTables, tx)
+}
+
+// LoadStats caches the statistics saved in the stats catalog by SaveStats, creating the
+// catalog if the database doesn't have one yet. The saved statistics are removed once
+// loaded, so that a database that stops without saving them again doesn't reload
+// statistics made stale by later modifications.
+func (sm *StatsManager) LoadStats(tx *transaction.Transaction) error {
+	layout, err := sm.catalogLayout(tx)
+	if err != nil {
+		return err
+	}
+
+	ts, err := table.NewTableScan(tx, layout, StatsCatalogName)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+
+	loaded := make(map[string]*StatInfo)
+	for {
+		hasNext, err := ts.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		tblName, err := ts.GetString("tablename")
+		if err != nil {
+			return err
+		}
+		fieldName, err := ts.GetString("fieldname")
+		if err != nil {
+			return err
+		}
+		numBlocks, err := ts.GetInt("numblocks")
+		if err != nil {
+			return err
+		}
+		numRecs, err := ts.GetInt("numrecs")
+		if err != nil {
+			return err
+		}
+		distinct, err := ts.GetInt("distinctvals")
+		if err != nil {
+			return err
+		}
+
+		si, exists := loaded[tblName]
+		if !exists {
+			si = NewStatInfo(numBlocks, numRecs, make(map[string]int))
+			loaded[tblName] = si
+		}
+		si.distinctVals[fieldName] = distinct
+
+		if err := ts.Delete(); err != nil {
+			return err
+		}
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	for tblName, si := range loaded {
+		si.version = sm.versions[tblName]
+		sm.tableStats[tblName] = si
+	}
+	log.Printf("[STATS] LoadStats: loaded stats for %d tables", len(loaded))
+	return nil
+}
+
+// SaveStats writes the cached statistics that still describe their tables exactly to
+// the stats catalog, for LoadStats to pick up when the database is next started.
+// It should run when no other transaction can modify the tables.
+func (sm *StatsManager) SaveStats(tx *transaction.Transaction) error {
+	layout, err := sm.catalogLayout(tx)
+	if err != nil {
+		return err
+	}
+
+	ts, err := table.NewTableScan(tx, layout, StatsCatalogName)
+	if err != nil {
+		return err
+	}
+	defer ts.Close()
+
+	// Replace whatever was saved before
+	for {
+		hasNext, err := ts.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		if err := ts.Delete(); err != nil {
+			return err
+		}
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	for tblName, si := range sm.tableStats {
+		if IsCatalogTable(tblName) || !sm.isFresh(tblName, si) {
+			continue
+		}
+		for fieldName, distinct := range si.distinctVals {
+			if err := ts.Insert(); err != nil {
+				return err
+			}
+			if err := ts.SetString("tablename", tblName); err != nil {
+				return err
+			}
+			if err := ts.SetString("fieldname", fieldName); err != nil {
+				return err
+			}
+			if err := ts.SetInt("numblocks", si.numBlocks); err != nil {
+				return err
+			}
+			if err := ts.SetInt("numrecs", si.numRecs); err != nil {
+				return err
+			}
+			if err := ts.SetInt("distinctvals", distinct); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// catalogLayout returns the layout of the stats catalog, creating the catalog if it doesn't exist.
+func (sm *StatsManager) catalogLayout(tx *transaction.Transaction) (*record.Layout, error) {
+	tables, err := sm.tblMgr.ListTables(tx)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(tables, StatsCatalogName) {
+		schema := record.NewSchema()
+		schema.AddStringField("tablename", MaxStringSize)
+		schema.AddStringField("fieldname", MaxStringSize)
+		schema.AddIntField("numblocks")
+		schema.AddIntField("numrecs")
+		schema.AddIntField("distinctvals")
+		if err := sm.tblMgr.CreateTable(StatsCatalogName, schema, tx); err != nil {
+			return nil, err
+		}
+	}
+	return sm.tblMgr.GetLayout(StatsCatalogName, tx)
+}
+
+// IsFresh checks if the statistics count exactly the committed records of the table:
+// they are the latest statistics of the table, and no transaction has changed its
+// records without ending yet.
+func (sm *StatsManager) IsFresh(tblName string, si *StatInfo) bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.isFresh(tblName, si)
+}
+
+func (sm *StatsManager) isFresh(tblName string, si *StatInfo) bool {
+	return si.version == sm.versions[tblName] && sm.writers[tblName] == 0
+}
+
+// CountDistinct scans the table and returns the exact number of distinct values of a field,
+// without using or changing the cached statistics.
+func (sm *StatsManager) CountDistinct(tblName string, fieldName string, layout *record.Layout, tx *transaction.Transaction) (int, error) {
+	if !layout.GetSchema().HasField(fieldName) {
+		return 0, fmt.Errorf("field %s not found in table %s", fieldName, tblName)
+	}
+
+	ts, err := table.NewTableScan(tx, layout, tblName)
+	if err != nil {
+		return 0, err
+	}
+	defer ts.Close()
+
+	values := make(map[any]struct{})
+	for {
+		hasNext, err := ts.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !hasNext {
+			break
+		}
+		val, err := ts.GetValue(fieldName)
+		if err != nil {
+			return 0, err
+		}
+		values[val] = struct{}{}
+	}
+	return len(values), nil
+}
+
 // calcTableStats calculates statistics for a specific table by scanning all records
 func (sm *StatsManager) calcTableStats(tblName string, layout *record.Layout, tx *transaction.Transaction) (*StatInfo, error) {
 	numRecs := 0
@@ -104,7 +404,7 @@ func (sm *StatsManager) calcTableStats(tblName string, layout *record.Layout, tx
 			numBlocks = rid.Block() + 1
 		}
 
-		// Track Distinct Values for each field
+		// Track Distinct Values for each field. Every value is kept, so the counts are exact.
 		for _, field := range layout.GetSchema().Fields() {
 			val, err := ts.GetValue(field)
 			if err != nil {
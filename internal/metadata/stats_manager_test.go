@@ -42,7 +42,6 @@ func TestStatsManager_BasicOperations(t *testing.T) {
 	require.NotNil(t, sm)
 	assert.NotNil(t, sm.tblMgr)
 	assert.NotNil(t, sm.tableStats)
-	assert.Equal(t, 0, sm.numCalls)
 	tx2.Commit()
 
 	// Test 2: Create StatInfo with basic data
@@ -106,10 +105,9 @@ func TestStatsManager_BasicOperations(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, si4)
 
-	// Simulate cache clearing (what happens when numCalls > 100 and numCalls % 100 == 0)
+	// Simulate cache clearing (what happens when enough records changed)
 	sm4.mutex.Lock()
 	sm4.tableStats = make(map[string]*StatInfo)
-	sm4.numCalls = 0
 	sm4.mutex.Unlock()
 
 	// Verify cache was cleared - getting stats again should recalculate
@@ -204,3 +202,137 @@ func TestStatsManager_DistinctValues(t *testing.T) {
 	assert.Equal(t, distinctIds, distinctIds2, "Cached result should match")
 	tx4.Commit()
 }
+
+func TestStatsManager_Freshness(t *testing.T) {
+	dbDir := "testdata_fresh"
+	blockSize := 400
+
+	fm, err := file.NewManager(dbDir, blockSize)
+	assert.NoError(t, err)
+	defer fm.Close()
+	defer os.RemoveAll(dbDir)
+
+	lm, err := log.NewManager(fm, "testlog")
+	assert.NoError(t, err)
+	defer lm.Close()
+
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	tm := NewTableManager(true, tx)
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	err = tm.CreateTable("fresh_test", schema, tx)
+	require.NoError(t, err)
+	layout, err := tm.GetLayout("fresh_test", tx)
+	require.NoError(t, err)
+
+	sm := NewStatsManager(tm, tx)
+	si, err := sm.GetStatInfo("fresh_test", layout, tx)
+	require.NoError(t, err)
+	assert.True(t, sm.IsFresh("fresh_test", si), "Newly calculated stats should be fresh")
+
+	// Changing another table keeps the stats fresh
+	tx2 := transaction.NewTransaction(fm, lm, bm, lockTable)
+	sm.RecordsModified("other_table", 1, tx2)
+	assert.True(t, sm.IsFresh("fresh_test", si))
+
+	// Changing the table makes the stats handed out before stale, and the updated
+	// stats only become fresh once the changes are committed
+	rid := record.NewRID(0, 0)
+	sm.RecordInserted("fresh_test", rid, tx2)
+	assert.False(t, sm.IsFresh("fresh_test", si), "Stats should be stale after the table is modified")
+	si2, err := sm.GetStatInfo("fresh_test", layout, tx2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, si2.RecordsOutput())
+	assert.Equal(t, 1, si2.BlocksAccessed())
+	assert.False(t, sm.IsFresh("fresh_test", si2), "Stats should be stale while the change is uncommitted")
+	require.NoError(t, tx2.Commit())
+	assert.True(t, sm.IsFresh("fresh_test", si2))
+	assert.False(t, sm.IsFresh("fresh_test", si))
+
+	// Rolled back changes drop the cached stats, which are recalculated from the table
+	tx3 := transaction.NewTransaction(fm, lm, bm, lockTable)
+	sm.RecordsDeleted("fresh_test", 1, tx3)
+	require.NoError(t, tx3.Rollback())
+	assert.False(t, sm.IsFresh("fresh_test", si2))
+	si3, err := sm.GetStatInfo("fresh_test", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, si3.RecordsOutput(), "The table never had a record inserted")
+	assert.True(t, sm.IsFresh("fresh_test", si3))
+}
+
+func TestStatsManager_ExactDistinctCounts(t *testing.T) {
+	dbDir := "testdata_exact_distinct"
+	blockSize := 400
+
+	fm, err := file.NewManager(dbDir, blockSize)
+	assert.NoError(t, err)
+	defer fm.Close()
+	defer os.RemoveAll(dbDir)
+
+	lm, err := log.NewManager(fm, "testlog")
+	assert.NoError(t, err)
+	defer lm.Close()
+
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	tm := NewTableManager(true, tx)
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddIntField("bucket")
+	schema.AddStringField("grade", 5)
+	schema.AddIntField("flag")
+	err = tm.CreateTable("exact_test", schema, tx)
+	require.NoError(t, err)
+	layout, err := tm.GetLayout("exact_test", tx)
+	require.NoError(t, err)
+
+	sm := NewStatsManager(tm, tx)
+
+	// An empty table has no distinct values
+	si, err := sm.GetStatInfo("exact_test", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, si.DistinctValues("id"))
+
+	// 300 records spread over many blocks: 300 ids, 17 buckets, 3 grades and a single flag
+	ts, err := table.NewTableScan(tx, layout, "exact_test")
+	require.NoError(t, err)
+	grades := []string{"A", "B", "C"}
+	for i := 0; i < 300; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("id", i))
+		require.NoError(t, ts.SetInt("bucket", i%17))
+		require.NoError(t, ts.SetString("grade", grades[i%len(grades)]))
+		require.NoError(t, ts.SetInt("flag", 1))
+	}
+	ts.Close()
+
+	expected := map[string]int{"id": 300, "bucket": 17, "grade": 3, "flag": 1}
+
+	sm.mutex.Lock()
+	sm.tableStats = make(map[string]*StatInfo)
+	sm.mutex.Unlock()
+	si, err = sm.GetStatInfo("exact_test", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 300, si.RecordsOutput())
+	assert.Greater(t, si.BlocksAccessed(), 1)
+	for field, count := range expected {
+		assert.Equal(t, count, si.DistinctValues(field), "distinct values of %s", field)
+
+		distinct, err := sm.CountDistinct("exact_test", field, layout, tx)
+		require.NoError(t, err)
+		assert.Equal(t, count, distinct, "CountDistinct of %s", field)
+	}
+	assert.Equal(t, 0, si.DistinctValues("missing"))
+
+	_, err = sm.CountDistinct("exact_test", "missing", layout, tx)
+	assert.Error(t, err)
+}
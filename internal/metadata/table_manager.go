@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/table"
@@ -48,8 +49,16 @@ func NewTableManager(isNew bool, tx *transaction.Transaction) *TableManager {
 
 // CreateTable creates a new table in the database by inserting a record into the tableCatelog and fieldCatelog
 func (t *TableManager) CreateTable(tableName string, schema *record.Schema, tx *transaction.Transaction) error {
-	layout := record.NewLayoutFromSchema(schema)
+	return t.CreateTableWithLayout(tableName, record.NewLayoutFromSchema(schema), tx)
+}
 
+// CreateTableWithLayout creates a new table whose records are laid out as given. It fails if
+// a record of the layout doesn't fit in a block.
+func (t *TableManager) CreateTableWithLayout(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	err := checkFitsBlock(tableName, layout, tx)
+	if err != nil {
+		return err
+	}
 	// Insert a record into tableCatelog
 	tcat, err := table.NewTableScan(tx, t.tableCatelog, TableCatalogName)
 	if err != nil {
@@ -68,8 +77,21 @@ func (t *TableManager) CreateTable(tableName string, schema *record.Schema, tx *
 	if err != nil {
 		return err
 	}
+	return t.insertFields(tableName, layout, tx)
+}
 
-	// Insert a record into fieldCatelog for each field
+// checkFitsBlock returns an error if a record of the table's layout doesn't fit in a block
+func checkFitsBlock(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	if layout.FitsBlock(tx.BlockSize()) {
+		return nil
+	}
+	return fmt.Errorf("a record of table %s takes up %d bytes, which doesn't fit in a block of %d bytes",
+		tableName, layout.GetSlotSize(), tx.BlockSize())
+}
+
+// insertFields inserts a record into fieldCatelog for each field of the layout
+func (t *TableManager) insertFields(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	schema := layout.GetSchema()
 	fcat, err := table.NewTableScan(tx, t.fieldCatelog, FieldCatalogName)
 	if err != nil {
 		return err
@@ -104,6 +126,92 @@ func (t *TableManager) CreateTable(tableName string, schema *record.Schema, tx *
 	return nil
 }
 
+// SetLayout replaces the layout of an existing table in the catalogs, e.g. once its
+// records have been rewritten without a dropped field.
+func (t *TableManager) SetLayout(tableName string, layout *record.Layout, tx *transaction.Transaction) error {
+	err := checkFitsBlock(tableName, layout, tx)
+	if err != nil {
+		return err
+	}
+	tcat, err := table.NewTableScan(tx, t.tableCatelog, TableCatalogName)
+	if err != nil {
+		return err
+	}
+	defer tcat.Close()
+	found := false
+	for !found {
+		hasNext, err := tcat.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			return fmt.Errorf("table %s not found", tableName)
+		}
+		name, err := tcat.GetString("table_name")
+		if err != nil {
+			return err
+		}
+		found = name == tableName
+	}
+	err = tcat.SetInt("slot_size", layout.GetSlotSize())
+	if err != nil {
+		return err
+	}
+
+	fcat, err := table.NewTableScan(tx, t.fieldCatelog, FieldCatalogName)
+	if err != nil {
+		return err
+	}
+	defer fcat.Close()
+	for {
+		hasNext, err := fcat.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		name, err := fcat.GetString("table_name")
+		if err != nil {
+			return err
+		}
+		if name == tableName {
+			err = fcat.Delete()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return t.insertFields(tableName, layout, tx)
+}
+
+// ListTables returns the names of all tables in the table catalog, in creation order.
+// The catalog tables themselves are included; use IsCatalogTable to tell them apart.
+func (t *TableManager) ListTables(tx *transaction.Transaction) ([]string, error) {
+	tcat, err := table.NewTableScan(tx, t.tableCatelog, TableCatalogName)
+	if err != nil {
+		return nil, err
+	}
+	defer tcat.Close()
+
+	tables := []string{}
+	for {
+		hasNext, err := tcat.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			break
+		}
+		tableName, err := tcat.GetString("table_name")
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, tableName)
+	}
+	return tables, nil
+}
+
 // GetLayout retrieves the layout for a given table name by scanning the catalogs
 func (t *TableManager) GetLayout(tableName string, tx *transaction.Transaction) (*record.Layout, error) {
 	// First, find the slot size from table catalog
@@ -140,9 +248,14 @@ func (t *TableManager) GetLayout(tableName string, tx *transaction.Transaction)
 		return nil, fmt.Errorf("table %s not found", tableName)
 	}
 
-	// Build schema and offsets from field catalog
-	schema := record.NewSchema()
-	offsets := make(map[string]int)
+	// Read the fields from the field catalog
+	type catalogField struct {
+		name   string
+		typ    string
+		length int
+		offset int
+	}
+	fields := []catalogField{}
 
 	fcat, err := table.NewTableScan(tx, t.fieldCatelog, FieldCatalogName)
 	if err != nil {
@@ -179,13 +292,25 @@ func (t *TableManager) GetLayout(tableName string, tx *transaction.Transaction)
 			if err != nil {
 				return nil, err
 			}
+			fields = append(fields, catalogField{name: fieldName, typ: fieldType, length: fieldLength, offset: offset})
+		}
+	}
 
-			offsets[fieldName] = offset
-			if fieldType == "int" {
-				schema.AddIntField(fieldName)
-			} else if fieldType == "string" {
-				schema.AddStringField(fieldName, fieldLength)
-			}
+	// Fields are laid out in schema order, so ordering them by offset gives back the
+	// original schema even if the catalog records aren't in the order they were written
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].offset < fields[j].offset
+	})
+	schema := record.NewSchema()
+	offsets := make(map[string]int)
+	for _, field := range fields {
+		offsets[field.name] = field.offset
+		if field.typ == "int" {
+			schema.AddIntField(field.name)
+		} else if field.typ == "bigint" {
+			schema.AddBigIntField(field.name)
+		} else if field.typ == "string" {
+			schema.AddStringField(field.name, field.length)
 		}
 	}
 
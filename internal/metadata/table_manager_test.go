@@ -240,3 +240,110 @@ func TestTableManager_BasicOperations(t *testing.T) {
 
 	tx8.Commit()
 }
+
+func TestTableManager_LayoutRoundTrip(t *testing.T) {
+	dbDir := "testdata_layout_roundtrip"
+	defer os.RemoveAll(dbDir)
+
+	fm, err := file.NewManager(dbDir, 400)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+
+	tx := transaction.NewTransaction(fm, lm, bm, transaction.NewLockTable())
+	defer tx.Commit()
+	tm := NewTableManager(true, tx)
+
+	accounts := record.NewSchema()
+	accounts.AddBigIntField("id")
+	accounts.AddStringField("owner", 30)
+	accounts.AddIntField("balance")
+	require.NoError(t, tm.CreateTable("accounts", accounts, tx))
+	notes := record.NewSchema()
+	notes.AddIntField("id")
+	notes.AddStringField("body", 100)
+	require.NoError(t, tm.CreateTableWithLayout("notes", record.NewPackedLayoutFromSchema(notes), tx))
+
+	// Move the catalog record of the first field of accounts behind the others
+	fcat, err := table.NewTableScan(tx, tm.fieldCatelog, FieldCatalogName)
+	require.NoError(t, err)
+	var moved map[string]interface{}
+	for {
+		hasNext, err := fcat.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		tableName, _ := fcat.GetString("table_name")
+		fieldName, _ := fcat.GetString("field_name")
+		if tableName == "accounts" && fieldName == "id" {
+			moved = map[string]interface{}{}
+			for _, field := range tm.fieldCatelog.GetSchema().Fields() {
+				moved[field], err = fcat.GetValue(field)
+				require.NoError(t, err)
+			}
+			require.NoError(t, fcat.Delete())
+		}
+	}
+	require.NotNil(t, moved)
+	require.NoError(t, fcat.Insert())
+	for field, value := range moved {
+		require.NoError(t, fcat.SetValue(field, value))
+	}
+	fcat.Close()
+
+	layout, err := tm.GetLayout("accounts", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "owner", "balance"}, layout.GetSchema().Fields())
+	assert.True(t, accounts.Equal(layout.GetSchema()))
+	assert.True(t, record.NewLayoutFromSchema(accounts).Equal(layout))
+
+	layout, err = tm.GetLayout("notes", tx)
+	require.NoError(t, err)
+	assert.True(t, notes.Equal(layout.GetSchema()))
+	assert.True(t, record.NewPackedLayoutFromSchema(notes).Equal(layout))
+	assert.False(t, record.NewLayoutFromSchema(notes).Equal(layout))
+}
+
+func TestTableManager_SetLayout(t *testing.T) {
+	dbDir := "testdata_set_layout"
+	defer os.RemoveAll(dbDir)
+
+	fm, err := file.NewManager(dbDir, 400)
+	require.NoError(t, err)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	defer lm.Close()
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+
+	tx := transaction.NewTransaction(fm, lm, bm, transaction.NewLockTable())
+	defer tx.Commit()
+	tm := NewTableManager(true, tx)
+
+	notes := record.NewSchema()
+	notes.AddIntField("id")
+	notes.AddStringField("title", 20)
+	notes.AddStringField("body", 100)
+	require.NoError(t, tm.CreateTableWithLayout("notes", record.NewPackedLayoutFromSchema(notes), tx))
+	others := record.NewSchema()
+	others.AddIntField("id")
+	require.NoError(t, tm.CreateTable("others", others, tx))
+
+	// The table gets the layout of its remaining fields, and other tables keep theirs
+	notes.RemoveField("title")
+	require.NoError(t, tm.SetLayout("notes", record.NewPackedLayoutFromSchema(notes), tx))
+	layout, err := tm.GetLayout("notes", tx)
+	require.NoError(t, err)
+	assert.True(t, layout.Equal(record.NewPackedLayoutFromSchema(notes)))
+	layout, err = tm.GetLayout("others", tx)
+	require.NoError(t, err)
+	assert.True(t, layout.Equal(record.NewLayoutFromSchema(others)))
+
+	assert.Error(t, tm.SetLayout("missing", layout, tx))
+}
@@ -5,32 +5,58 @@ import (
 	"fmt"
 	"strings"
 	"text/scanner"
+
+	"github.com/yashagw/cranedb/internal/query"
 )
 
 var ErrBadSyntax = errors.New("bad syntax")
 
+// SyntaxError tells where a statement stopped making sense: what the parser expected, the
+// token it found instead and the position of that token in the input, counting from 1.
+// Expected is empty for a token after the end of a statement.
+// It wraps ErrBadSyntax, so errors.Is(err, ErrBadSyntax) holds for it.
+type SyntaxError struct {
+	Expected string
+	Found    string
+	Position int
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("bad syntax: unexpected %s at position %d", e.Found, e.Position)
+	}
+	return fmt.Sprintf("bad syntax: expected %s at position %d, got %s", e.Expected, e.Position, e.Found)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return ErrBadSyntax
+}
+
+// operatorToken marks a two-character operator such as "<=", "<>" or "||".
+// text/scanner only produces single-character tokens for punctuation.
+const operatorToken rune = -100
+
+// quotedIdentToken marks a double-quoted identifier, whose name keeps its case and may be a keyword.
+const quotedIdentToken rune = -101
+
+// comparisonOperators are the comparison operators recognized by the lexer.
+var comparisonOperators = map[string]bool{
+	"=": true, "<": true, ">": true, "<=": true, ">=": true, "<>": true, "!=": true,
+}
+
 type Lexer struct {
-	keywords map[string]bool
 	scanner  scanner.Scanner
 	token    rune
 	tokenVal string
+	// offset is the byte offset of the current token in the input
+	offset int
 }
 
 func NewLexer(input string) *Lexer {
-	keywords := map[string]bool{
-		"select": true, "from": true, "where": true, "and": true,
-		"insert": true, "into": true, "values": true,
-		"delete": true, "update": true, "set": true,
-		"create": true, "table": true, "varchar": true, "int": true,
-		"view": true, "as": true, "index": true, "on": true,
-	}
-
-	l := &Lexer{
-		keywords: keywords,
-	}
+	l := &Lexer{}
 
 	l.scanner.Init(strings.NewReader(input))
-	l.scanner.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanStrings | scanner.ScanComments | scanner.SkipComments
+	l.scanner.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanFloats | scanner.ScanComments | scanner.SkipComments
 	l.scanner.Whitespace = 1<<'\t' | 1<<'\n' | 1<<'\r' | 1<<' '
 
 	l.nextToken()
@@ -38,54 +64,134 @@ func NewLexer(input string) *Lexer {
 }
 
 // nextToken advances to the next token and updates token/tokenVal.
-// The scanner doesn't handle single-quoted strings, so we parse them manually.
+// The scanner doesn't handle single-quoted strings or double-quoted identifiers,
+// so we parse them manually.
+// Comments are skipped like whitespace: the scanner skips /* block comments */,
+// and "--" comments, which run to the end of the line, are skipped here.
 func (l *Lexer) nextToken() {
 	l.token = l.scanner.Scan()
+	for l.token == '-' && l.scanner.Peek() == '-' {
+		for ch := l.scanner.Next(); ch != '\n' && ch != scanner.EOF; ch = l.scanner.Next() {
+		}
+		l.token = l.scanner.Scan()
+	}
 	l.tokenVal = l.scanner.TokenText()
+	l.offset = l.scanner.Position.Offset
 
 	if l.token == '\'' {
-		var sb strings.Builder
-		for {
-			ch := l.scanner.Next()
-			if ch == scanner.EOF {
-				break
-			}
-			if ch == '\'' {
-				// Two consecutive quotes means an escaped quote
-				if l.scanner.Peek() == '\'' {
-					sb.WriteRune('\'')
-					l.scanner.Next() // consume the second quote
-				} else {
-					// Single quote means end of string
-					break
-				}
-			} else {
-				sb.WriteRune(ch)
-			}
-		}
-		l.tokenVal = sb.String() // Store unquoted string value
+		l.tokenVal = l.scanQuoted('\'')
 		// Keep token as '\'' to mark it as a string constant
 		return
 	}
 
+	if l.token == '"' {
+		l.tokenVal = l.scanQuoted('"')
+		l.token = quotedIdentToken
+		return
+	}
+
+	if l.token == '|' && l.scanner.Peek() == '|' {
+		l.scanner.Next()
+		l.tokenVal = "||"
+		l.token = operatorToken
+		return
+	}
+
+	if l.token == '<' || l.token == '>' || l.token == '!' {
+		next := l.scanner.Peek()
+		if next == '=' || (l.token == '<' && next == '>') {
+			l.scanner.Next()
+			l.tokenVal += string(next)
+			l.token = operatorToken
+		}
+		return
+	}
+
 	if l.token == scanner.Ident {
 		l.tokenVal = strings.ToLower(l.tokenVal)
 	}
 }
 
+// scanQuoted reads the rest of a quoted token whose opening quote has been scanned, and
+// returns its content. Two consecutive quotes stand for a quote in the content.
+func (l *Lexer) scanQuoted(quote rune) string {
+	var sb strings.Builder
+	for {
+		ch := l.scanner.Next()
+		if ch == scanner.EOF {
+			break
+		}
+		if ch == quote {
+			if l.scanner.Peek() != quote {
+				break
+			}
+			l.scanner.Next() // consume the second quote
+		}
+		sb.WriteRune(ch)
+	}
+	return sb.String()
+}
+
+// syntaxError returns an error saying that something else was expected at the current token
+func (l *Lexer) syntaxError(expected string) error {
+	return &SyntaxError{
+		Expected: expected,
+		Found:    l.describeToken(),
+		Position: l.offset + 1,
+	}
+}
+
+// describeToken returns the current token as it is shown in syntax errors
+func (l *Lexer) describeToken() string {
+	switch l.token {
+	case scanner.EOF:
+		return "end of input"
+	case '\'':
+		return "'" + strings.ReplaceAll(l.tokenVal, "'", "''") + "'"
+	case quotedIdentToken:
+		return `"` + strings.ReplaceAll(l.tokenVal, `"`, `""`) + `"`
+	}
+	return "'" + l.tokenVal + "'"
+}
+
 // MatchDelim checks if the current token is the specified delimiter.
 func (l *Lexer) MatchDelim(d rune) bool {
 	return l.token == d
 }
 
+// AtEnd checks if the whole input has been read.
+func (l *Lexer) AtEnd() bool {
+	return l.token == scanner.EOF
+}
+
+// EatEnd checks that the whole input has been read but for a ';' ending the statement,
+// and returns a syntax error at the first token left otherwise.
+func (l *Lexer) EatEnd() error {
+	if l.token == ';' {
+		l.nextToken()
+	}
+	if l.token != scanner.EOF {
+		return &SyntaxError{Found: l.describeToken(), Position: l.offset + 1}
+	}
+	return nil
+}
+
+// MatchOperator checks if the current token is a comparison operator.
+func (l *Lexer) MatchOperator() bool {
+	if l.token != operatorToken && l.token != '=' && l.token != '<' && l.token != '>' {
+		return false
+	}
+	return comparisonOperators[l.tokenVal]
+}
+
 // MatchIntConstant checks if the current token is an integer constant.
 func (l *Lexer) MatchIntConstant() bool {
 	return l.token == scanner.Int
 }
 
-// MatchStringConstant checks if the current token is a string constant (single or double quoted).
+// MatchStringConstant checks if the current token is a string constant, which is single quoted.
 func (l *Lexer) MatchStringConstant() bool {
-	return l.token == '\'' || l.token == scanner.String
+	return l.token == '\''
 }
 
 // MatchKeyword checks if the current token is the specified keyword (case-insensitive).
@@ -93,32 +199,67 @@ func (l *Lexer) MatchKeyword(w string) bool {
 	return l.token == scanner.Ident && strings.EqualFold(l.tokenVal, w)
 }
 
-// MatchId checks if the current token is an identifier (not a keyword).
+// MatchId checks if the current token is an identifier: a name that isn't a keyword, or any
+// quoted name. A quoted name can't be empty or hold a '.', which qualifies field names.
 func (l *Lexer) MatchId() bool {
-	return l.token == scanner.Ident && !l.keywords[strings.ToLower(l.tokenVal)]
+	if l.token == quotedIdentToken {
+		return l.tokenVal != "" && !strings.Contains(l.tokenVal, ".")
+	}
+	return l.token == scanner.Ident && !query.IsKeyword(l.tokenVal)
+}
+
+// MatchQuotedId checks if the current token is a double-quoted identifier.
+func (l *Lexer) MatchQuotedId() bool {
+	return l.token == quotedIdentToken
 }
 
 // EatDelim consumes the current token if it matches the specified delimiter, then advances to the next token.
-// Returns ErrBadSyntax if the token doesn't match.
+// Returns a SyntaxError if the token doesn't match.
 func (l *Lexer) EatDelim(d rune) error {
 	if !l.MatchDelim(d) {
-		return ErrBadSyntax
+		return l.syntaxError("'" + string(d) + "'")
+	}
+	l.nextToken()
+	return nil
+}
+
+// EatOperator consumes the current token if it's a comparison operator, then advances to the next token.
+// Returns the operator symbol and a SyntaxError if the token is not a comparison operator.
+func (l *Lexer) EatOperator() (string, error) {
+	if !l.MatchOperator() {
+		return "", l.syntaxError("a comparison operator")
+	}
+	op := l.tokenVal
+	l.nextToken()
+	return op, nil
+}
+
+// MatchConcat checks if the current token is the string concatenation operator "||".
+func (l *Lexer) MatchConcat() bool {
+	return l.token == operatorToken && l.tokenVal == "||"
+}
+
+// EatConcat consumes the current token if it's the concatenation operator, then advances to the next token.
+// Returns a SyntaxError if the token is not "||".
+func (l *Lexer) EatConcat() error {
+	if !l.MatchConcat() {
+		return l.syntaxError("'||'")
 	}
 	l.nextToken()
 	return nil
 }
 
 // EatIntConstant consumes the current token if it's an integer constant, then advances to the next token.
-// Returns the integer value and ErrBadSyntax if the token is not an integer.
+// Returns the integer value and a SyntaxError if the token is not an integer.
 func (l *Lexer) EatIntConstant() (int, error) {
 	if !l.MatchIntConstant() {
-		return 0, ErrBadSyntax
+		return 0, l.syntaxError("an integer")
 	}
 
 	var i int
 	_, err := fmt.Sscanf(l.tokenVal, "%d", &i)
 	if err != nil {
-		return 0, ErrBadSyntax
+		return 0, l.syntaxError("an integer")
 	}
 
 	l.nextToken()
@@ -126,36 +267,32 @@ func (l *Lexer) EatIntConstant() (int, error) {
 }
 
 // EatStringConstant consumes the current token if it's a string constant, then advances to the next token.
-// Returns the unquoted string value and ErrBadSyntax if the token is not a string.
+// Returns the unquoted string value and a SyntaxError if the token is not a string.
 func (l *Lexer) EatStringConstant() (string, error) {
 	if !l.MatchStringConstant() {
-		return "", ErrBadSyntax
+		return "", l.syntaxError("a string")
 	}
 
 	s := l.tokenVal
-	if l.token == scanner.String && len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		s = s[1 : len(s)-1]
-	}
-
 	l.nextToken()
 	return s, nil
 }
 
 // EatKeyword consumes the current token if it matches the specified keyword (case-insensitive), then advances to the next token.
-// Returns ErrBadSyntax if the token is not the expected keyword.
+// Returns a SyntaxError if the token is not the expected keyword.
 func (l *Lexer) EatKeyword(w string) error {
 	if !l.MatchKeyword(w) {
-		return ErrBadSyntax
+		return l.syntaxError(strings.ToUpper(w))
 	}
 	l.nextToken()
 	return nil
 }
 
 // EatId consumes the current token if it's an identifier (not a keyword), then advances to the next token.
-// Returns the identifier name and ErrBadSyntax if the token is not an identifier.
+// Returns the identifier name and a SyntaxError if the token is not an identifier.
 func (l *Lexer) EatId() (string, error) {
 	if !l.MatchId() {
-		return "", ErrBadSyntax
+		return "", l.syntaxError("an identifier")
 	}
 	s := l.tokenVal
 	l.nextToken()
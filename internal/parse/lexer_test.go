@@ -1,6 +1,7 @@
 package parse
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,7 +24,8 @@ func TestLexerEatDelim(t *testing.T) {
 
 	err = lexer2.EatDelim(')')
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
+	assert.EqualError(t, err, "bad syntax: expected ')' at position 1, got '('")
 }
 
 func TestLexerEatIntConstant(t *testing.T) {
@@ -44,7 +46,11 @@ func TestLexerEatIntConstant(t *testing.T) {
 
 	_, err = lexer2.EatIntConstant()
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
+
+	// String constants are shown quoted, as they were written
+	_, err = NewLexer(" 'it''s'").EatIntConstant()
+	assert.EqualError(t, err, "bad syntax: expected an integer at position 2, got 'it''s'")
 }
 
 func TestLexerEatStringConstant(t *testing.T) {
@@ -60,13 +66,13 @@ func TestLexerEatStringConstant(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "world", val)
 
-	// Test double-quoted strings
+	// Double quotes make an identifier, not a string
 	lexer2 := NewLexer(`"test"`)
 	require.NotNil(t, lexer2)
 
-	val, err = lexer2.EatStringConstant()
-	require.NoError(t, err)
-	assert.Equal(t, "test", val)
+	assert.False(t, lexer2.MatchStringConstant())
+	_, err = lexer2.EatStringConstant()
+	assert.ErrorIs(t, err, ErrBadSyntax)
 
 	// Test escaped quote in single-quoted string
 	lexer3 := NewLexer("'John''s name'")
@@ -82,7 +88,7 @@ func TestLexerEatStringConstant(t *testing.T) {
 
 	_, err = lexer4.EatStringConstant()
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
 }
 
 func TestLexerEatKeyword(t *testing.T) {
@@ -114,7 +120,14 @@ func TestLexerEatKeyword(t *testing.T) {
 
 	err = lexer3.EatKeyword("from")
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
+	assert.EqualError(t, err, "bad syntax: expected FROM at position 1, got 'select'")
+
+	// The end of the input is reported where it is
+	lexer4 := NewLexer("select  ")
+	require.NoError(t, lexer4.EatKeyword("select"))
+	err = lexer4.EatKeyword("from")
+	assert.EqualError(t, err, "bad syntax: expected FROM at position 9, got end of input")
 }
 
 func TestLexerEatId(t *testing.T) {
@@ -135,7 +148,7 @@ func TestLexerEatId(t *testing.T) {
 
 	_, err = lexer2.EatId()
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
 
 	// Test lowercase conversion
 	lexer3 := NewLexer("MyTable")
@@ -146,6 +159,56 @@ func TestLexerEatId(t *testing.T) {
 	assert.Equal(t, "mytable", id)
 }
 
+func TestLexerQuotedId(t *testing.T) {
+	// Quoted names keep their case and may be keywords or hold spaces and quotes
+	lexer := NewLexer(`"MyTable" "select" "order items" "say ""hi""" plain`)
+	for _, expected := range []string{"MyTable", "select", "order items", `say "hi"`, "plain"} {
+		id, err := lexer.EatId()
+		require.NoError(t, err)
+		assert.Equal(t, expected, id)
+	}
+	assert.True(t, lexer.AtEnd())
+
+	// A quoted name is never a keyword
+	lexer = NewLexer(`"from"`)
+	assert.False(t, lexer.MatchKeyword("from"))
+
+	for _, input := range []string{`""`, `"students.id"`} {
+		_, err := NewLexer(input).EatId()
+		assert.ErrorIs(t, err, ErrBadSyntax, input)
+	}
+	_, err := NewLexer(`""`).EatId()
+	assert.EqualError(t, err, `bad syntax: expected an identifier at position 1, got ""`)
+}
+
+func TestLexerEatOperator(t *testing.T) {
+	lexer := NewLexer("= < > <= >= <> != ( 5")
+	require.NotNil(t, lexer)
+
+	for _, expected := range []string{"=", "<", ">", "<=", ">=", "<>", "!="} {
+		op, err := lexer.EatOperator()
+		require.NoError(t, err)
+		assert.Equal(t, expected, op)
+	}
+
+	// Test error case
+	assert.False(t, lexer.MatchOperator())
+	_, err := lexer.EatOperator()
+	assert.ErrorIs(t, err, ErrBadSyntax)
+
+	// Compound operators don't need surrounding spaces
+	lexer2 := NewLexer("age>=20")
+	id, err := lexer2.EatId()
+	require.NoError(t, err)
+	assert.Equal(t, "age", id)
+	op, err := lexer2.EatOperator()
+	require.NoError(t, err)
+	assert.Equal(t, ">=", op)
+	val, err := lexer2.EatIntConstant()
+	require.NoError(t, err)
+	assert.Equal(t, 20, val)
+}
+
 func TestLexerComplexQuery(t *testing.T) {
 	query := "select name, age from students where age = 25 and name = 'John'"
 	lexer := NewLexer(query)
@@ -200,3 +263,63 @@ func TestLexerComplexQuery(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "John", str)
 }
+
+func TestLexerComments(t *testing.T) {
+	t.Run("EndOfLine", func(t *testing.T) {
+		lexer := NewLexer("select age -- the age\nfrom students -- last line")
+		require.NoError(t, lexer.EatKeyword("select"))
+		id, err := lexer.EatId()
+		require.NoError(t, err)
+		assert.Equal(t, "age", id)
+		require.NoError(t, lexer.EatKeyword("from"))
+		id, err = lexer.EatId()
+		require.NoError(t, err)
+		assert.Equal(t, "students", id)
+		assert.ErrorIs(t, lexer.EatKeyword("where"), ErrBadSyntax, "Nothing follows the comment")
+	})
+
+	t.Run("WholeInput", func(t *testing.T) {
+		for _, input := range []string{"-- nothing here", "/* nothing\nhere */", "--"} {
+			lexer := NewLexer(input)
+			assert.False(t, lexer.MatchId(), input)
+			assert.EqualError(t, lexer.EatKeyword("select"), "bad syntax: expected SELECT at position "+
+				fmt.Sprint(len(input)+1)+", got end of input", input)
+		}
+	})
+
+	t.Run("BetweenTokens", func(t *testing.T) {
+		lexer := NewLexer("age/* block */>=/* another\nline */20 --\n and")
+		id, err := lexer.EatId()
+		require.NoError(t, err)
+		assert.Equal(t, "age", id)
+		op, err := lexer.EatOperator()
+		require.NoError(t, err)
+		assert.Equal(t, ">=", op)
+		val, err := lexer.EatIntConstant()
+		require.NoError(t, err)
+		assert.Equal(t, 20, val)
+		require.NoError(t, lexer.EatKeyword("and"))
+	})
+
+	t.Run("InsideString", func(t *testing.T) {
+		lexer := NewLexer("'a -- b' '/* c */' -- d")
+		str, err := lexer.EatStringConstant()
+		require.NoError(t, err)
+		assert.Equal(t, "a -- b", str)
+		str, err = lexer.EatStringConstant()
+		require.NoError(t, err)
+		assert.Equal(t, "/* c */", str)
+		assert.False(t, lexer.MatchStringConstant())
+	})
+
+	t.Run("MinusIsNotAComment", func(t *testing.T) {
+		lexer := NewLexer("5 - -3")
+		_, err := lexer.EatIntConstant()
+		require.NoError(t, err)
+		require.NoError(t, lexer.EatDelim('-'))
+		require.NoError(t, lexer.EatDelim('-'))
+		val, err := lexer.EatIntConstant()
+		require.NoError(t, err)
+		assert.Equal(t, 3, val)
+	})
+}
@@ -1,6 +1,12 @@
 package parse
 
 import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
 	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
@@ -9,6 +15,12 @@ import (
 // Parser is a parser for the Cranedb query language.
 type Parser struct {
 	lexer *Lexer
+	// aggregates collects the aggregate functions of the query being parsed.
+	// It is nil where aggregates are not allowed, such as in a WHERE clause.
+	aggregates *[]*query.AggregationFn
+	// wildcard is set while the select list is about to parse a column, which may be all
+	// the fields of a table (e.g. students.*). The primary that starts the column clears it.
+	wildcard bool
 }
 
 // NewParser creates a new Parser.
@@ -24,6 +36,13 @@ func NewParserFromString(sql string) *Parser {
 	return NewParser(lexer)
 }
 
+// EatEnd checks that nothing but a ';' follows the statement parsed, so that a statement
+// the parser stopped short of, such as one with an OR in its condition, fails rather than
+// running without its rest.
+func (p *Parser) EatEnd() error {
+	return p.lexer.EatEnd()
+}
+
 func (p *Parser) field() (string, error) {
 	id, err := p.lexer.EatId()
 	if err != nil {
@@ -32,7 +51,28 @@ func (p *Parser) field() (string, error) {
 	return id, nil
 }
 
+// qualifiedField parses a field name, optionally qualified by its table (e.g. students.id).
+func (p *Parser) qualifiedField() (string, error) {
+	id, err := p.field()
+	if err != nil {
+		return "", err
+	}
+	if !p.lexer.MatchDelim('.') {
+		return id, nil
+	}
+	p.lexer.EatDelim('.')
+	field, err := p.field()
+	if err != nil {
+		return "", err
+	}
+	return id + "." + field, nil
+}
+
+// constant parses a string or an integer constant. An integer may have a sign.
 func (p *Parser) constant() (any, error) {
+	if p.lexer.MatchDelim('-') || p.lexer.MatchDelim('+') {
+		return p.signedIntConstant()
+	}
 	if p.lexer.MatchIntConstant() {
 		val, err := p.lexer.EatIntConstant()
 		if err != nil {
@@ -47,32 +87,252 @@ func (p *Parser) constant() (any, error) {
 		}
 		return val, nil
 	}
-	return nil, ErrBadSyntax
+	return nil, p.lexer.syntaxError("a constant")
 }
 
+// signedIntConstant parses an integer constant preceded by '-' or '+'.
+// A sign only starts a constant where an operand is expected, so "a -5" is still a subtraction.
+func (p *Parser) signedIntConstant() (int, error) {
+	sign := 1
+	if p.lexer.MatchDelim('-') {
+		sign = -1
+		p.lexer.EatDelim('-')
+	} else {
+		err := p.lexer.EatDelim('+')
+		if err != nil {
+			return 0, err
+		}
+	}
+	val, err := p.lexer.EatIntConstant()
+	if err != nil {
+		return 0, err
+	}
+	return sign * val, nil
+}
+
+// arithmeticOperators maps arithmetic delimiters to query operators.
+var arithmeticOperators = map[rune]query.ArithmeticOperator{
+	'+': query.OpAdd,
+	'-': query.OpSubtract,
+	'*': query.OpMultiply,
+	'/': query.OpDivide,
+}
+
+// expression parses a concatenation or arithmetic expression.
+// '*' and '/' bind tighter than '+' and '-', which bind tighter than '||'.
+// Operators of equal precedence associate left.
 func (p *Parser) expression() (*query.Expression, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for p.lexer.MatchConcat() {
+		p.lexer.EatConcat()
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		left = query.NewBinaryExpression(left, query.OpConcat, right)
+	}
+	return left, nil
+}
+
+// additive parses a chain of '+' and '-' operations.
+func (p *Parser) additive() (*query.Expression, error) {
+	return p.binaryExpression(p.multiplicative, '+', '-')
+}
+
+// multiplicative parses a chain of '*' and '/' operations.
+func (p *Parser) multiplicative() (*query.Expression, error) {
+	return p.binaryExpression(p.primary, '*', '/')
+}
+
+// binaryExpression parses operands joined by any of the given operators.
+func (p *Parser) binaryExpression(operand func() (*query.Expression, error), ops ...rune) (*query.Expression, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op rune
+		for _, candidate := range ops {
+			if p.lexer.MatchDelim(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == 0 {
+			return left, nil
+		}
+		p.lexer.EatDelim(op)
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = query.NewBinaryExpression(left, arithmeticOperators[op], right)
+	}
+}
+
+// primary parses a field, a function call, a constant, a parenthesized expression
+// or a parenthesized query returning a single value.
+func (p *Parser) primary() (*query.Expression, error) {
+	wildcard := p.wildcard
+	p.wildcard = false
+	if p.lexer.MatchDelim('(') {
+		p.lexer.EatDelim('(')
+		if p.lexer.MatchKeyword("select") {
+			return p.scalarSubquery()
+		}
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		err = p.lexer.EatDelim(')')
+		if err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
 	if p.lexer.MatchId() {
+		// A quoted name is always a field, even if it is spelled like a function
+		quoted := p.lexer.MatchQuotedId()
 		id, err := p.field()
 		if err != nil {
 			return nil, err
 		}
+		if !quoted && p.lexer.MatchDelim('(') {
+			if query.IsAggregateFunction(id) {
+				return p.aggregateCall(id)
+			}
+			return p.functionCall(id)
+		}
+		if p.lexer.MatchDelim('.') {
+			p.lexer.EatDelim('.')
+			if wildcard && p.lexer.MatchDelim('*') {
+				p.lexer.EatDelim('*')
+				return query.NewFieldNameExpression(id + ".*"), nil
+			}
+			field, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			id += "." + field
+		}
 		return query.NewFieldNameExpression(id), nil
 	}
-	if p.lexer.MatchIntConstant() || p.lexer.MatchStringConstant() {
+	if p.lexer.MatchIntConstant() || p.lexer.MatchStringConstant() || p.lexer.MatchDelim('-') || p.lexer.MatchDelim('+') {
 		val, err := p.constant()
 		if err != nil {
 			return nil, err
 		}
 		switch v := val.(type) {
 		case int:
+			// An integer too large for an INT is a BIGINT, so arithmetic on it doesn't overflow
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return query.NewConstantExpression(*query.NewLongConstant(int64(v))), nil
+			}
 			return query.NewConstantExpression(*query.NewIntConstant(v)), nil
 		case string:
 			return query.NewConstantExpression(*query.NewStringConstant(v)), nil
 		default:
-			return nil, ErrBadSyntax
+			return nil, p.lexer.syntaxError("a constant")
+		}
+	}
+	return nil, p.lexer.syntaxError("an expression")
+}
+
+// scalarSubquery parses a query nested in an expression, whose opening parenthesis has already been read.
+func (p *Parser) scalarSubquery() (*query.Expression, error) {
+	queryData, err := p.Query()
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+	return query.NewSubqueryExpression(query.NewSubquery(queryData)), nil
+}
+
+// functionCall parses the parenthesized argument list of a function whose name has already been read.
+func (p *Parser) functionCall(name string) (*query.Expression, error) {
+	err := p.lexer.EatDelim('(')
+	if err != nil {
+		return nil, err
+	}
+	args := []*query.Expression{}
+	if !p.lexer.MatchDelim(')') {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.lexer.MatchDelim(',') {
+				break
+			}
+			p.lexer.EatDelim(',')
+		}
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+	return query.NewFunctionExpression(name, args)
+}
+
+// aggregateCall parses the argument of an aggregate function whose name has already been read,
+// either a field or "*". The call refers to the aggregate's output column, so it becomes a field
+// expression named after the aggregate, e.g. "count(id)".
+func (p *Parser) aggregateCall(name string) (*query.Expression, error) {
+	err := p.lexer.EatDelim('(')
+	if err != nil {
+		return nil, err
+	}
+	var field string
+	if p.lexer.MatchDelim('*') {
+		p.lexer.EatDelim('*')
+		field = "*"
+	} else {
+		field, err = p.qualifiedField()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+
+	fn, err := query.NewAggregationFn(name, field)
+	if err != nil {
+		return nil, err
+	}
+	if p.aggregates == nil {
+		return nil, fmt.Errorf("aggregate function %s is not allowed here", fn.FieldName())
+	}
+	exists := false
+	for _, existing := range *p.aggregates {
+		if existing.FieldName() == fn.FieldName() {
+			exists = true
+			break
 		}
 	}
-	return nil, ErrBadSyntax
+	if !exists {
+		*p.aggregates = append(*p.aggregates, fn)
+	}
+	return query.NewAggregateExpression(fn), nil
+}
+
+// operators maps comparison symbols to query operators.
+var operators = map[string]query.Operator{
+	"=":  query.OpEquals,
+	"<>": query.OpNotEquals,
+	"!=": query.OpNotEquals,
+	"<":  query.OpLessThan,
+	"<=": query.OpLessThanOrEqual,
+	">":  query.OpGreaterThan,
+	">=": query.OpGreaterThanOrEqual,
 }
 
 func (p *Parser) term() (*query.Term, error) {
@@ -80,7 +340,12 @@ func (p *Parser) term() (*query.Term, error) {
 	if err != nil {
 		return nil, err
 	}
-	err = p.lexer.EatDelim('=')
+	return p.comparison(*left)
+}
+
+// comparison parses the operator and right-hand side of a term whose left side has already been read.
+func (p *Parser) comparison(left query.Expression) (*query.Term, error) {
+	symbol, err := p.lexer.EatOperator()
 	if err != nil {
 		return nil, err
 	}
@@ -88,70 +353,405 @@ func (p *Parser) term() (*query.Term, error) {
 	if err != nil {
 		return nil, err
 	}
-	return query.NewTerm(*left, *right), nil
+	return query.NewComparisonTerm(left, operators[symbol], *right), nil
+}
+
+// inList parses "IN (const, const, ...)" or "IN (query)" for an expression that has already
+// been read. The list must contain at least one constant.
+func (p *Parser) inList(left query.Expression) (*query.Term, error) {
+	err := p.lexer.EatKeyword("in")
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim('(')
+	if err != nil {
+		return nil, err
+	}
+	if p.lexer.MatchKeyword("select") {
+		queryData, err := p.Query()
+		if err != nil {
+			return nil, err
+		}
+		err = p.lexer.EatDelim(')')
+		if err != nil {
+			return nil, err
+		}
+		return query.NewInSubqueryTerm(left, query.NewSubquery(queryData)), nil
+	}
+	consts, err := p.constList()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]query.Constant, len(consts))
+	for i, c := range consts {
+		switch v := c.(type) {
+		case int:
+			values[i] = *query.NewIntConstant(v)
+		case string:
+			values[i] = *query.NewStringConstant(v)
+		}
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+	return query.NewInTerm(left, values), nil
+}
+
+// condition parses a single term, an IN list, a LIKE pattern, a BETWEEN range, an EXISTS subquery
+// or a negated condition. "x BETWEEN low AND high" becomes the two terms "x >= low" and "x <= high".
+func (p *Parser) condition() (*query.Predicate, error) {
+	if p.lexer.MatchKeyword("exists") {
+		term, err := p.exists(false)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewPredicate(*term), nil
+	}
+	if p.lexer.MatchKeyword("not") {
+		p.lexer.EatKeyword("not")
+		return p.negation()
+	}
+	left, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	// "x NOT IN (...)", "x NOT LIKE 'p'" and "x NOT BETWEEN low AND high" negate the whole test
+	if p.lexer.MatchKeyword("not") {
+		p.lexer.EatKeyword("not")
+		if !p.lexer.MatchKeyword("in") && !p.lexer.MatchKeyword("like") && !p.lexer.MatchKeyword("between") {
+			return nil, p.lexer.EatKeyword("in")
+		}
+		pred, err := p.test(*left)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewPredicate(*query.NewNotTerm(pred)), nil
+	}
+	return p.test(*left)
+}
+
+// negation parses what follows a NOT that starts a condition: EXISTS (query), a predicate in
+// parentheses, or a single condition, e.g. NOT (age = 25 AND name = 'x') or NOT age = 25.
+func (p *Parser) negation() (*query.Predicate, error) {
+	if p.lexer.MatchKeyword("exists") {
+		term, err := p.exists(true)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewPredicate(*term), nil
+	}
+	var negated *query.Predicate
+	var err error
+	if p.lexer.MatchDelim('(') {
+		p.lexer.EatDelim('(')
+		negated, err = p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		err = p.lexer.EatDelim(')')
+	} else {
+		negated, err = p.condition()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hasExists(negated) {
+		return nil, fmt.Errorf("EXISTS can't be negated with other conditions: use NOT EXISTS")
+	}
+	return query.NewPredicate(*query.NewNotTerm(negated)), nil
+}
+
+// hasExists checks if the predicate has an EXISTS term, negated or not.
+func hasExists(pred *query.Predicate) bool {
+	for _, term := range pred.GetTerms() {
+		if term.Subquery() != nil || (term.Negated() != nil && hasExists(term.Negated())) {
+			return true
+		}
+	}
+	return false
+}
+
+// test parses the IN list, LIKE pattern, BETWEEN range or comparison that tests an expression
+// that has already been read.
+func (p *Parser) test(left query.Expression) (*query.Predicate, error) {
+	if p.lexer.MatchKeyword("in") {
+		term, err := p.inList(left)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewPredicate(*term), nil
+	}
+	if p.lexer.MatchKeyword("like") {
+		p.lexer.EatKeyword("like")
+		pattern, err := p.lexer.EatStringConstant()
+		if err != nil {
+			return nil, err
+		}
+		if p.lexer.MatchKeyword("escape") {
+			p.lexer.EatKeyword("escape")
+			escape, err := p.lexer.EatStringConstant()
+			if err != nil {
+				return nil, err
+			}
+			pattern, err = withLikeEscape(pattern, escape)
+			if err != nil {
+				return nil, err
+			}
+		}
+		term := query.NewComparisonTerm(left, query.OpLike, *query.NewConstantExpression(*query.NewStringConstant(pattern)))
+		return query.NewPredicate(*term), nil
+	}
+	if !p.lexer.MatchKeyword("between") {
+		term, err := p.comparison(left)
+		if err != nil {
+			return nil, err
+		}
+		return query.NewPredicate(*term), nil
+	}
+
+	p.lexer.EatKeyword("between")
+	low, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatKeyword("and")
+	if err != nil {
+		return nil, err
+	}
+	high, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	pred := query.NewPredicate(*query.NewComparisonTerm(left, query.OpGreaterThanOrEqual, *low))
+	pred.ConjunctWith(*query.NewPredicate(*query.NewComparisonTerm(left, query.OpLessThanOrEqual, *high)))
+	return pred, nil
+}
+
+// withLikeEscape rewrites a LIKE pattern whose wildcards are escaped by the given character
+// into one escaped by a backslash, the escape character LIKE patterns use otherwise.
+// An empty escape turns escaping off, so a backslash matches itself.
+func withLikeEscape(pattern string, escape string) (string, error) {
+	escapeRunes := []rune(escape)
+	if len(escapeRunes) > 1 {
+		return "", fmt.Errorf("invalid escape string %q: must be a single character", escape)
+	}
+	var sb strings.Builder
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case len(escapeRunes) == 1 && runes[i] == escapeRunes[0]:
+			if i+1 == len(runes) {
+				return "", fmt.Errorf("LIKE pattern %q must not end with the escape character", pattern)
+			}
+			i++
+			sb.WriteRune('\\')
+			sb.WriteRune(runes[i])
+		case runes[i] == '\\':
+			sb.WriteString(`\\`)
+		default:
+			sb.WriteRune(runes[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// exists parses "EXISTS (query)", which follows a NOT if negated is set. The query may refer
+// to the fields of the enclosing query's tables.
+func (p *Parser) exists(negated bool) (*query.Term, error) {
+	err := p.lexer.EatKeyword("exists")
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim('(')
+	if err != nil {
+		return nil, err
+	}
+	queryData, err := p.Query()
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+	return query.NewExistsTerm(query.NewSubquery(queryData), negated), nil
 }
 
 func (p *Parser) predicate() (*query.Predicate, error) {
-	firstTerm, err := p.term()
+	pred, err := p.condition()
 	if err != nil {
 		return nil, err
 	}
-	pred := query.NewPredicate(*firstTerm)
 	for p.lexer.MatchKeyword("and") {
 		p.lexer.EatKeyword("and")
-		term, err := p.term()
+		next, err := p.condition()
 		if err != nil {
 			return nil, err
 		}
-		pred.ConjunctWith(*query.NewPredicate(*term))
+		pred.ConjunctWith(*next)
 	}
 	return pred, nil
 }
 
 func (p *Parser) Query() (*parserdata.QueryData, error) {
+	// Aggregates are collected per query, so restore the enclosing statement's list when done
+	aggregates := []*query.AggregationFn{}
+	outer := p.aggregates
+	defer func() {
+		p.aggregates = outer
+	}()
+
 	// Select
 	err := p.lexer.EatKeyword("select")
 	if err != nil {
 		return nil, err
 	}
-	// Field List
-	fields, err := p.fieldList()
-	if err != nil {
-		return nil, err
+	// Field List, which may be empty: SELECT FROM t returns a row without columns per record
+	p.aggregates = &aggregates
+	fields, expressions := []string{}, map[string]*query.Expression{}
+	if !p.lexer.MatchKeyword("from") {
+		fields, expressions, err = p.selectList()
+		if err != nil {
+			return nil, err
+		}
 	}
+	p.aggregates = nil
 	// From
 	err = p.lexer.EatKeyword("from")
 	if err != nil {
 		return nil, err
 	}
 	// Table List
-	tableNames, err := p.tableList()
+	tableNames, aliases, err := p.tableList()
 	if err != nil {
 		return nil, err
 	}
 
-	if !p.lexer.MatchKeyword("where") {
-		return parserdata.NewQueryData(fields, tableNames, nil), nil
+	// Where
+	var predicate *query.Predicate
+	if p.lexer.MatchKeyword("where") {
+		p.lexer.EatKeyword("where")
+		predicate, err = p.predicate()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Where
-	err = p.lexer.EatKeyword("where")
-	if err != nil {
-		return nil, err
+	// Group By
+	var groupFields []string
+	if p.lexer.MatchKeyword("group") {
+		p.lexer.EatKeyword("group")
+		err = p.lexer.EatKeyword("by")
+		if err != nil {
+			return nil, err
+		}
+		groupFields, err = p.qualifiedFieldList()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Predicate
-	predicate, err := p.predicate()
-	if err != nil {
-		return nil, err
+	// Having
+	var having *query.Predicate
+	if p.lexer.MatchKeyword("having") {
+		p.lexer.EatKeyword("having")
+		p.aggregates = &aggregates
+		having, err = p.predicate()
+		if err != nil {
+			return nil, err
+		}
+		p.aggregates = nil
+	}
+
+	// Order By
+	var orderBy []*query.SortKey
+	if p.lexer.MatchKeyword("order") {
+		p.lexer.EatKeyword("order")
+		err = p.lexer.EatKeyword("by")
+		if err != nil {
+			return nil, err
+		}
+		p.aggregates = &aggregates
+		orderBy, err = p.orderByList(fields, expressions, aggregates)
+		if err != nil {
+			return nil, err
+		}
+		p.aggregates = nil
+	}
+
+	if len(groupFields) == 0 && len(aggregates) == 0 {
+		if having != nil {
+			return nil, fmt.Errorf("HAVING requires GROUP BY or an aggregate function")
+		}
+		return parserdata.NewQueryDataWithExpressions(fields, expressions, tableNames, predicate).WithAliases(aliases).WithOrderBy(orderBy), nil
+	}
+	return parserdata.NewGroupedQueryData(fields, expressions, tableNames, predicate, groupFields, aggregates, having).WithAliases(aliases).WithOrderBy(orderBy), nil
+}
+
+// orderByList parses the keys of an ORDER BY clause, each an expression or the 1-based
+// position of a column of the select list, followed by ASC or DESC. A position or the name
+// of a computed column stands for the column's expression.
+func (p *Parser) orderByList(fields []string, expressions map[string]*query.Expression, aggregates []*query.AggregationFn) ([]*query.SortKey, error) {
+	keys := []*query.SortKey{}
+	for {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if val := expr.AsConstant(); expr.IsConstant() && val.IsInt() {
+			position := val.AsInt()
+			if position < 1 || position > len(fields) {
+				return nil, fmt.Errorf("ORDER BY position %d is not in the select list", position)
+			}
+			if isWildcard(fields[position-1]) {
+				return nil, fmt.Errorf("ORDER BY position %d is %s, not a column", position, fields[position-1])
+			}
+			expr = columnExpression(fields[position-1], expressions, aggregates)
+		} else if expr.IsFieldName() && expressions[expr.AsFieldName()] != nil {
+			expr = expressions[expr.AsFieldName()]
+		}
+
+		descending := false
+		if p.lexer.MatchKeyword("desc") {
+			p.lexer.EatKeyword("desc")
+			descending = true
+		} else if p.lexer.MatchKeyword("asc") {
+			p.lexer.EatKeyword("asc")
+		}
+		keys = append(keys, query.NewSortKey(expr, descending))
+
+		if !p.lexer.MatchDelim(',') {
+			return keys, nil
+		}
+		p.lexer.EatDelim(',')
 	}
+}
 
-	return parserdata.NewQueryData(fields, tableNames, predicate), nil
+// columnExpression returns the expression of a column of the select list: the expression
+// of a computed column, or the field or aggregate it names.
+func columnExpression(field string, expressions map[string]*query.Expression, aggregates []*query.AggregationFn) *query.Expression {
+	if expr := expressions[field]; expr != nil {
+		return expr
+	}
+	for _, fn := range aggregates {
+		if fn.FieldName() == field {
+			return query.NewAggregateExpression(fn)
+		}
+	}
+	return query.NewFieldNameExpression(field)
 }
 
 func (p *Parser) UpdateCmd() (interface{}, error) {
 	if p.lexer.MatchKeyword("insert") {
-		return p.insert()
+		insertData, err := p.insert()
+		if err != nil {
+			return nil, err
+		}
+		if p.lexer.MatchKeyword("on") {
+			return p.onConflict(insertData)
+		}
+		return insertData, nil
 	}
 	if p.lexer.MatchKeyword("update") {
 		return p.modify()
@@ -159,6 +759,18 @@ func (p *Parser) UpdateCmd() (interface{}, error) {
 	if p.lexer.MatchKeyword("delete") {
 		return p.delete()
 	}
+	if p.lexer.MatchKeyword("copy") {
+		return p.copy()
+	}
+	if p.lexer.MatchKeyword("vacuum") {
+		return p.vacuum()
+	}
+	if p.lexer.MatchKeyword("reindex") {
+		return p.reindex()
+	}
+	if p.lexer.MatchKeyword("alter") {
+		return p.alterTable()
+	}
 	return p.CreateCmd()
 }
 
@@ -175,11 +787,12 @@ func (p *Parser) CreateCmd() (interface{}, error) {
 	} else if p.lexer.MatchKeyword("index") {
 		return p.createIndex()
 	} else {
-		return nil, ErrBadSyntax
+		return nil, p.lexer.syntaxError("TABLE, VIEW or INDEX")
 	}
 }
 
-func (p *Parser) createTable() (*parserdata.CreateTableData, error) {
+// createTable parses either a table definition or CREATE TABLE ... AS SELECT.
+func (p *Parser) createTable() (interface{}, error) {
 	// Create is already eaten by CreateCmd()
 
 	// Table Name
@@ -192,6 +805,15 @@ func (p *Parser) createTable() (*parserdata.CreateTableData, error) {
 	if err != nil {
 		return nil, err
 	}
+	// As Query
+	if p.lexer.MatchKeyword("as") {
+		p.lexer.EatKeyword("as")
+		query, err := p.Query()
+		if err != nil {
+			return nil, err
+		}
+		return parserdata.NewCreateTableAsData(tableName, query), nil
+	}
 	// (
 	err = p.lexer.EatDelim('(')
 	if err != nil {
@@ -207,8 +829,14 @@ func (p *Parser) createTable() (*parserdata.CreateTableData, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Packed
+	packedStrings := false
+	if p.lexer.MatchKeyword("packed") {
+		p.lexer.EatKeyword("packed")
+		packedStrings = true
+	}
 
-	return parserdata.NewCreateTableData(tableName, schema), nil
+	return parserdata.NewCreateTableData(tableName, schema, packedStrings), nil
 }
 
 func (p *Parser) createView() (*parserdata.CreateViewData, error) {
@@ -264,6 +892,12 @@ func (p *Parser) createIndex() (*parserdata.CreateIndexData, error) {
 		return nil, err
 	}
 
+	// USING can come before the field, as in PostgreSQL, or after it
+	indexType, err := p.indexType()
+	if err != nil {
+		return nil, err
+	}
+
 	// (
 	err = p.lexer.EatDelim('(')
 	if err != nil {
@@ -281,7 +915,33 @@ func (p *Parser) createIndex() (*parserdata.CreateIndexData, error) {
 	if err != nil {
 		return nil, err
 	}
-	return parserdata.NewCreateIndexData(indexName, tableName, fieldName), nil
+
+	if indexType == "" {
+		indexType, err = p.indexType()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if indexType == "" {
+		indexType = index.HashType
+	}
+	return parserdata.NewCreateIndexData(indexName, tableName, fieldName, indexType), nil
+}
+
+// indexType reads an optional USING HASH or USING BTREE clause of a CREATE INDEX, and returns
+// the index type it names, or "" if there is none.
+func (p *Parser) indexType() (string, error) {
+	if !p.lexer.MatchKeyword("using") {
+		return "", nil
+	}
+	p.lexer.EatKeyword("using")
+	for _, indexType := range []string{index.HashType, index.BTreeType} {
+		if p.lexer.MatchKeyword(indexType) {
+			p.lexer.EatKeyword(indexType)
+			return indexType, nil
+		}
+	}
+	return "", p.lexer.syntaxError("HASH or BTREE")
 }
 
 func (p *Parser) insert() (*parserdata.InsertData, error) {
@@ -339,6 +999,160 @@ func (p *Parser) insert() (*parserdata.InsertData, error) {
 	return parserdata.NewInsertData(table, fields, values), nil
 }
 
+// onConflict parses the ON CONFLICT (field) DO UPDATE SET field = expression clause of an insert.
+func (p *Parser) onConflict(insertData *parserdata.InsertData) (*parserdata.UpsertData, error) {
+	// On Conflict
+	err := p.lexer.EatKeyword("on")
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatKeyword("conflict")
+	if err != nil {
+		return nil, err
+	}
+	// (Field)
+	err = p.lexer.EatDelim('(')
+	if err != nil {
+		return nil, err
+	}
+	conflictField, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim(')')
+	if err != nil {
+		return nil, err
+	}
+	// Do Update Set
+	err = p.lexer.EatKeyword("do")
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatKeyword("update")
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatKeyword("set")
+	if err != nil {
+		return nil, err
+	}
+	// Field = Value
+	field, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	err = p.lexer.EatDelim('=')
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return parserdata.NewUpsertData(insertData, conflictField, field, value), nil
+}
+
+// copy parses COPY table [(field, ...)] FROM 'path'
+func (p *Parser) copy() (*parserdata.CopyData, error) {
+	// Copy
+	err := p.lexer.EatKeyword("copy")
+	if err != nil {
+		return nil, err
+	}
+	// Table
+	table, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	// Optional (Fields)
+	var fields []string
+	if p.lexer.MatchDelim('(') {
+		err = p.lexer.EatDelim('(')
+		if err != nil {
+			return nil, err
+		}
+		fields, err = p.fieldList()
+		if err != nil {
+			return nil, err
+		}
+		err = p.lexer.EatDelim(')')
+		if err != nil {
+			return nil, err
+		}
+	}
+	// From
+	err = p.lexer.EatKeyword("from")
+	if err != nil {
+		return nil, err
+	}
+	// Path
+	path, err := p.lexer.EatStringConstant()
+	if err != nil {
+		return nil, err
+	}
+	return parserdata.NewCopyData(table, fields, path), nil
+}
+
+// vacuum parses VACUUM table
+func (p *Parser) vacuum() (*parserdata.VacuumData, error) {
+	err := p.lexer.EatKeyword("vacuum")
+	if err != nil {
+		return nil, err
+	}
+	table, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	return parserdata.NewVacuumData(table), nil
+}
+
+// reindex parses REINDEX index or REINDEX TABLE table
+func (p *Parser) reindex() (*parserdata.ReindexData, error) {
+	err := p.lexer.EatKeyword("reindex")
+	if err != nil {
+		return nil, err
+	}
+	if p.lexer.MatchKeyword("table") {
+		p.lexer.EatKeyword("table")
+		table, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		return parserdata.NewReindexTableData(table), nil
+	}
+	index, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	return parserdata.NewReindexData(index), nil
+}
+
+// alterTable parses ALTER TABLE table DROP COLUMN field
+func (p *Parser) alterTable() (*parserdata.DropColumnData, error) {
+	for _, keyword := range []string{"alter", "table"} {
+		err := p.lexer.EatKeyword(keyword)
+		if err != nil {
+			return nil, err
+		}
+	}
+	table, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	for _, keyword := range []string{"drop", "column"} {
+		err := p.lexer.EatKeyword(keyword)
+		if err != nil {
+			return nil, err
+		}
+	}
+	column, err := p.field()
+	if err != nil {
+		return nil, err
+	}
+	return parserdata.NewDropColumnData(table, column), nil
+}
+
 func (p *Parser) delete() (*parserdata.DeleteData, error) {
 	// Delete
 	err := p.lexer.EatKeyword("delete")
@@ -420,6 +1234,61 @@ func (p *Parser) modify() (*parserdata.ModifyData, error) {
 	return parserdata.NewModifyData(table, field, value, predicate), nil
 }
 
+// selectList parses the output columns of a query.
+// Columns that are not plain fields are named after their expression text, or the
+// alias given with AS, and returned in the expressions map, keyed by that name.
+func (p *Parser) selectList() ([]string, map[string]*query.Expression, error) {
+	fields := []string{}
+	expressions := map[string]*query.Expression{}
+
+	for {
+		p.wildcard = true
+		expr, err := p.expression()
+		p.wildcard = false
+		if err != nil {
+			return nil, nil, err
+		}
+		if expr.IsFieldName() && isWildcard(expr.AsFieldName()) {
+			// The planner expands it into the table's fields, so it can't be renamed
+			// or be part of an expression
+			if p.lexer.MatchKeyword("as") {
+				return nil, nil, fmt.Errorf("%s can't be renamed", expr.AsFieldName())
+			}
+			fields = append(fields, expr.AsFieldName())
+		} else if slices.ContainsFunc(expr.FieldNames(), isWildcard) {
+			return nil, nil, fmt.Errorf("a table's .* must be a column of its own")
+		} else if p.lexer.MatchKeyword("as") {
+			p.lexer.EatKeyword("as")
+			alias, err := p.field()
+			if err != nil {
+				return nil, nil, err
+			}
+			if slices.Contains(fields, alias) {
+				return nil, nil, fmt.Errorf("duplicate column: %s", alias)
+			}
+			fields = append(fields, alias)
+			expressions[alias] = expr
+		} else if expr.IsFieldName() {
+			fields = append(fields, expr.AsFieldName())
+		} else {
+			name := expr.String()
+			fields = append(fields, name)
+			expressions[name] = expr
+		}
+
+		if !p.lexer.MatchDelim(',') {
+			return fields, expressions, nil
+		}
+		p.lexer.EatDelim(',')
+	}
+}
+
+// isWildcard reports whether a column of the select list stands for all the fields of a
+// table (e.g. students.*).
+func isWildcard(field string) bool {
+	return strings.HasSuffix(field, ".*")
+}
+
 func (p *Parser) fieldList() ([]string, error) {
 	fields := []string{}
 
@@ -445,29 +1314,63 @@ func (p *Parser) fieldList() ([]string, error) {
 	return fields, nil
 }
 
-func (p *Parser) tableList() ([]string, error) {
-	tableNames := []string{}
-
-	firstTable, err := p.lexer.EatId()
-	if err != nil {
-		return nil, err
-	}
-	tableNames = append(tableNames, firstTable)
-
-	// Now look for ", table" patterns.
-	for p.lexer.MatchDelim(',') {
-		err = p.lexer.EatDelim(',')
+// qualifiedFieldList parses a comma-separated list of fields that may be qualified by their tables.
+func (p *Parser) qualifiedFieldList() ([]string, error) {
+	fields := []string{}
+	for {
+		field, err := p.qualifiedField()
 		if err != nil {
 			return nil, err
 		}
+		fields = append(fields, field)
+		if !p.lexer.MatchDelim(',') {
+			return fields, nil
+		}
+		p.lexer.EatDelim(',')
+	}
+}
+
+// tableList parses the tables of a query, each of which may be followed by an alias,
+// with or without AS (e.g. "students s"). It returns the table names and their aliases,
+// which are "" for a table without one.
+func (p *Parser) tableList() ([]string, []string, error) {
+	tableNames := []string{}
+	aliases := []string{}
+	// names holds the names the tables are referred to by so far
+	names := map[string]bool{}
+
+	for {
 		table, err := p.lexer.EatId()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		alias := ""
+		if p.lexer.MatchKeyword("as") {
+			p.lexer.EatKeyword("as")
+			alias, err = p.lexer.EatId()
+			if err != nil {
+				return nil, nil, err
+			}
+		} else if p.lexer.MatchId() {
+			alias, _ = p.lexer.EatId()
+		}
+		if alias != "" {
+			if names[alias] {
+				return nil, nil, fmt.Errorf("duplicate table alias: %s", alias)
+			}
+			names[alias] = true
+		} else {
+			names[table] = true
 		}
 		tableNames = append(tableNames, table)
-	}
+		aliases = append(aliases, alias)
 
-	return tableNames, nil
+		// Now look for ", table" patterns.
+		if !p.lexer.MatchDelim(',') {
+			return tableNames, aliases, nil
+		}
+		p.lexer.EatDelim(',')
+	}
 }
 
 func (p *Parser) constList() ([]any, error) {
@@ -534,6 +1437,13 @@ func (p *Parser) fieldType(fieldName string) (*record.Schema, error) {
 		}
 		schema.AddIntField(fieldName)
 		return schema, nil
+	} else if p.lexer.MatchKeyword("bigint") {
+		err := p.lexer.EatKeyword("bigint")
+		if err != nil {
+			return nil, err
+		}
+		schema.AddBigIntField(fieldName)
+		return schema, nil
 	} else if p.lexer.MatchKeyword("varchar") {
 		err := p.lexer.EatKeyword("varchar")
 		if err != nil {
@@ -554,6 +1464,6 @@ func (p *Parser) fieldType(fieldName string) (*record.Schema, error) {
 		schema.AddStringField(fieldName, length)
 		return schema, nil
 	} else {
-		return nil, ErrBadSyntax
+		return nil, p.lexer.syntaxError("INT, BIGINT or VARCHAR")
 	}
 }
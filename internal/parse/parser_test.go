@@ -1,11 +1,14 @@
 package parse
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
+	"github.com/yashagw/cranedb/internal/query"
 )
 
 func TestParserField(t *testing.T) {
@@ -19,7 +22,7 @@ func TestParserField(t *testing.T) {
 	// Next token should not be an id; expect error
 	_, err = p.field()
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
 }
 
 func TestParserConstant(t *testing.T) {
@@ -37,19 +40,70 @@ func TestParserConstant(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "hello", val)
 
-	// Double-quoted string
+	// A double-quoted name is an identifier, not a constant
 	p3 := NewParser(NewLexer(`"world"`))
 	require.NotNil(t, p3)
-	val, err = p3.constant()
-	require.NoError(t, err)
-	assert.Equal(t, "world", val)
+	_, err = p3.constant()
+	assert.ErrorIs(t, err, ErrBadSyntax)
 
 	// Error case
 	p4 := NewParser(NewLexer("select"))
 	require.NotNil(t, p4)
 	_, err = p4.constant()
 	assert.Error(t, err)
-	assert.Equal(t, ErrBadSyntax, err)
+	assert.ErrorIs(t, err, ErrBadSyntax)
+}
+
+func TestParserNegativeConstants(t *testing.T) {
+	t.Run("Constant", func(t *testing.T) {
+		for q, expected := range map[string]int{"-50": -50, "+7": 7, "- 3": -3} {
+			val, err := NewParser(NewLexer(q)).constant()
+			require.NoError(t, err, q)
+			assert.Equal(t, expected, val, q)
+		}
+		_, err := NewParser(NewLexer("-'abc'")).constant()
+		assert.ErrorIs(t, err, ErrBadSyntax)
+	})
+
+	t.Run("Predicate", func(t *testing.T) {
+		pred, err := NewParser(NewLexer("balance = -50 and total > +10")).predicate()
+		require.NoError(t, err)
+		assert.Equal(t, "balance = -50 and total > 10", pred.String())
+	})
+
+	t.Run("UnaryAndSubtraction", func(t *testing.T) {
+		tests := map[string]string{
+			"balance - -5": "balance - -5",
+			"balance -5":   "balance - 5",
+			"-2 * balance": "-2 * balance",
+		}
+		for q, expected := range tests {
+			expr, err := NewParser(NewLexer(q)).expression()
+			require.NoError(t, err, q)
+			assert.Equal(t, expected, expr.String(), q)
+		}
+		// Only constants take a sign
+		_, err := NewParser(NewLexer("3 - -balance")).expression()
+		assert.ErrorIs(t, err, ErrBadSyntax)
+	})
+
+	t.Run("InsertValues", func(t *testing.T) {
+		cmd, err := NewParser(NewLexer("insert into accounts (id, balance) values (-1, -250)")).UpdateCmd()
+		require.NoError(t, err)
+		id, ok := cmd.(*parserdata.InsertData)
+		require.True(t, ok)
+		assert.Equal(t, []any{-1, -250}, id.Values())
+	})
+
+	t.Run("UpdateAssignment", func(t *testing.T) {
+		cmd, err := NewParser(NewLexer("update accounts set balance = -75 where id = -1")).UpdateCmd()
+		require.NoError(t, err)
+		ud, ok := cmd.(*parserdata.ModifyData)
+		require.True(t, ok)
+		constVal := ud.NewValue().AsConstant()
+		assert.Equal(t, -75, constVal.AsInt())
+		assert.Equal(t, "id = -1", ud.Predicate().String())
+	})
 }
 
 func TestParserExpression(t *testing.T) {
@@ -98,7 +152,253 @@ func TestParserPredicate(t *testing.T) {
 	pr, err := p.predicate()
 	require.NoError(t, err)
 	require.NotNil(t, pr)
-	assert.Equal(t, "age = 25 and name = John", pr.String())
+	assert.Equal(t, "age = 25 and name = 'John'", pr.String())
+}
+
+func TestParserComparisonTerm(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		op       query.Operator
+	}{
+		{"age < 25", "age < 25", query.OpLessThan},
+		{"age > 25", "age > 25", query.OpGreaterThan},
+		{"age <= 25", "age <= 25", query.OpLessThanOrEqual},
+		{"age >= 25", "age >= 25", query.OpGreaterThanOrEqual},
+		{"age <> 25", "age <> 25", query.OpNotEquals},
+		{"age != 25", "age <> 25", query.OpNotEquals},
+		{"name<'m'", "name < 'm'", query.OpLessThan},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		tm, err := p.term()
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, tm.String())
+		assert.Equal(t, tt.op, tm.Operator())
+	}
+
+	// Missing operator
+	p := NewParser(NewLexer("age 25"))
+	_, err := p.term()
+	assert.Error(t, err)
+}
+
+func TestParserBetween(t *testing.T) {
+	p := NewParser(NewLexer("age between 20 and 30"))
+	pr, err := p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "age >= 20 and age <= 30", pr.String())
+
+	// BETWEEN combined with other conditions
+	p = NewParser(NewLexer("id = 1 and name BETWEEN 'a' AND 'm' and age > 5"))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "id = 1 and name >= 'a' and name <= 'm' and age > 5", pr.String())
+
+	// BETWEEN without AND
+	p = NewParser(NewLexer("age between 20 30"))
+	_, err = p.predicate()
+	assert.Error(t, err)
+}
+
+func TestParserIn(t *testing.T) {
+	p := NewParser(NewLexer("status in ('active', 'pending', 'active')"))
+	pr, err := p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "status in ('active', 'pending')", pr.String())
+
+	p = NewParser(NewLexer("id IN (3) and age > 20"))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "id in (3) and age > 20", pr.String())
+
+	// Empty IN list
+	p = NewParser(NewLexer("status in ()"))
+	_, err = p.predicate()
+	assert.Error(t, err)
+
+	// Missing parenthesis
+	p = NewParser(NewLexer("status in ('active'"))
+	_, err = p.predicate()
+	assert.Error(t, err)
+
+	// The values of a subquery, which may be negated
+	p = NewParser(NewLexer("student_id in (select id from students where status = 'inactive') and not course in (select name from courses)"))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "student_id in (SELECT id FROM students WHERE status = 'inactive') and not (course in (SELECT name FROM courses))", pr.String())
+	subqueries := pr.InSubqueries()
+	require.Len(t, subqueries, 2)
+	inner, ok := subqueries[0].Query().(*parserdata.QueryData)
+	require.True(t, ok)
+	assert.Equal(t, []string{"students"}, inner.Tables())
+	assert.Empty(t, pr.Subqueries())
+
+	p = NewParser(NewLexer("id in (select id from students"))
+	_, err = p.predicate()
+	assert.ErrorIs(t, err, ErrBadSyntax)
+}
+
+func TestParserNot(t *testing.T) {
+	for stmt, expected := range map[string]string{
+		"NOT (age = 25)":                           "not (age = 25)",
+		"not age = 25 and id > 1":                  "not (age = 25) and id > 1",
+		"NOT (age = 25 AND name = 'x') and id > 1": "not (age = 25 and name = 'x') and id > 1",
+		"age NOT IN (1, 2)":                        "not (age in (1, 2))",
+		"name not like 'A%'":                       "not (name like 'A%')",
+		"age not between 1 and 5":                  "not (age >= 1 and age <= 5)",
+		"not not age = 1":                          "not (not (age = 1))",
+		"not exists (select id from t)":            "not exists (SELECT id FROM t)",
+	} {
+		p := NewParser(NewLexer(stmt))
+		pr, err := p.predicate()
+		require.NoError(t, err, stmt)
+		assert.Equal(t, expected, pr.String(), stmt)
+	}
+
+	for _, stmt := range []string{
+		"not",
+		"not (age = 25",
+		"age not = 25",
+		"not (exists (select id from t) and age = 1)",
+	} {
+		p := NewParser(NewLexer(stmt))
+		_, err := p.predicate()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserLike(t *testing.T) {
+	p := NewParser(NewLexer("name LIKE 'A%' and age = 20"))
+	pr, err := p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "name like 'A%' and age = 20", pr.String())
+
+	// Backslashes are kept for the matcher
+	p = NewParser(NewLexer("name like '100\\%'"))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, query.OpLike, pr.GetTerms()[0].Operator())
+	assert.Equal(t, "name like '100\\%'", pr.String())
+
+	// The pattern must be a string constant
+	p = NewParser(NewLexer("name like 5"))
+	_, err = p.predicate()
+	assert.Error(t, err)
+
+	// ESCAPE picks another escape character, and a backslash then matches itself
+	p = NewParser(NewLexer(`name like '100!%\_%' escape '!'`))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, `name like '100\%\\_%'`, pr.String())
+	p = NewParser(NewLexer(`name like 'a\%' escape ''`))
+	pr, err = p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, `name like 'a\\%'`, pr.String())
+
+	for _, stmt := range []string{"name like 'a%' escape '!!'", "name like 'a!' escape '!'", "name like 'a%' escape 5"} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.predicate()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserArithmeticExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a + b", "a + b"},
+		{"a + b * 2", "a + (b * 2)"},
+		{"a * b + 2", "(a * b) + 2"},
+		{"(a + b) * 2", "(a + b) * 2"},
+		{"a - b - c", "(a - b) - c"},
+		{"a / 2 * 3", "(a / 2) * 3"},
+		{"((a))", "a"},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		e, err := p.expression()
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, e.String())
+	}
+
+	// Missing operand or parenthesis
+	for _, input := range []string{"a +", "(a + b", "* 2"} {
+		p := NewParser(NewLexer(input))
+		_, err := p.expression()
+		assert.Error(t, err, input)
+	}
+
+	// Arithmetic in a predicate
+	p := NewParser(NewLexer("age + 5 > 30"))
+	pr, err := p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "age + 5 > 30", pr.String())
+
+	// An integer too large for an INT is a BIGINT constant
+	p = NewParser(NewLexer("3000000000 * 2"))
+	e, err := p.expression()
+	require.NoError(t, err)
+	val, err := e.Evaluate(nil)
+	require.NoError(t, err)
+	assert.True(t, val.IsLong())
+	assert.Equal(t, int64(6000000000), val.AsLong())
+}
+
+func TestParserFunctionsAndConcat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"UPPER(name)", "upper(name)"},
+		{"substr(name, 1, len + 1)", "substr(name, 1, len + 1)"},
+		{"first || last || id", "(first || last) || id"},
+		{"name || id + 1", "name || (id + 1)"},
+		{"lower(a || b)", "lower(a || b)"},
+	}
+	for _, tt := range tests {
+		p := NewParser(NewLexer(tt.input))
+		e, err := p.expression()
+		require.NoError(t, err, tt.input)
+		assert.Equal(t, tt.expected, e.String())
+	}
+
+	// Unknown functions and wrong argument counts are rejected
+	for _, input := range []string{"reverse(name)", "upper(a, b)", "upper()", "substr(name, 1"} {
+		p := NewParser(NewLexer(input))
+		_, err := p.expression()
+		assert.Error(t, err, input)
+	}
+
+	// A single '|' is not the concatenation operator
+	p := NewParser(NewLexer("a | b"))
+	e, err := p.expression()
+	require.NoError(t, err)
+	assert.Equal(t, "a", e.String())
+	assert.True(t, p.lexer.MatchDelim('|'))
+
+	// Functions in a predicate
+	p = NewParser(NewLexer("length(name) > 3 and upper(name) = 'BOB'"))
+	pr, err := p.predicate()
+	require.NoError(t, err)
+	assert.Equal(t, "length(name) > 3 and upper(name) = 'BOB'", pr.String())
+}
+
+func TestParserQueryWithExpressions(t *testing.T) {
+	p := NewParser(NewLexer("select name, salary * 2, (salary + bonus) / 12 from employees"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "salary * 2", "(salary + bonus) / 12"}, qd.Fields())
+	assert.Nil(t, qd.Expression("name"))
+	require.NotNil(t, qd.Expression("salary * 2"))
+	assert.True(t, qd.Expression("salary * 2").IsBinary())
+
+	// The query text parses back to the same columns
+	p = NewParser(NewLexer(qd.String()))
+	qd2, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, qd.Fields(), qd2.Fields())
 }
 
 func TestParserQuery(t *testing.T) {
@@ -124,7 +424,17 @@ func TestParserQuery(t *testing.T) {
 		assert.Equal(t, []string{"name"}, qd.Fields())
 		assert.Equal(t, []string{"students"}, qd.Tables())
 		require.NotNil(t, qd.Predicate())
-		assert.Equal(t, "age = 25 and name = John", qd.Predicate().String())
+		assert.Equal(t, "age = 25 and name = 'John'", qd.Predicate().String())
+	})
+
+	t.Run("BigInt", func(t *testing.T) {
+		stmt := "create table accounts (id int, balance bigint)"
+		p := NewParser(NewLexer(stmt))
+		cmd, err := p.CreateCmd()
+		require.NoError(t, err)
+		sch := cmd.(*parserdata.CreateTableData).Schema()
+		assert.Equal(t, "bigint", sch.Type("balance"))
+		assert.Equal(t, 8, sch.Length("balance"))
 	})
 
 	t.Run("CaseInsensitiveKeywords", func(t *testing.T) {
@@ -140,16 +450,260 @@ func TestParserQuery(t *testing.T) {
 		assert.Equal(t, "age = 30", qd.Predicate().String())
 	})
 
+	t.Run("EmptySelectList", func(t *testing.T) {
+		q := "select from students where age = 30"
+		p := NewParser(NewLexer(q))
+		qd, err := p.Query()
+		require.NoError(t, err)
+		assert.Empty(t, qd.Fields())
+		assert.Equal(t, []string{"students"}, qd.Tables())
+		assert.Equal(t, "age = 30", qd.Predicate().String())
+	})
+
 	t.Run("MissingFromError", func(t *testing.T) {
 		q := "select name students"
 		p := NewParser(NewLexer(q))
 		require.NotNil(t, p)
 		_, err := p.Query()
 		assert.Error(t, err)
-		assert.Equal(t, ErrBadSyntax, err)
+		assert.ErrorIs(t, err, ErrBadSyntax)
 	})
 }
 
+func TestParserGroupByHaving(t *testing.T) {
+	p := NewParser(NewLexer("select dept, count(id), max(salary) * 2 from employees where salary > 0 group by dept having count(id) > 2 and min(salary) >= 10"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dept", "count(id)", "max(salary) * 2"}, qd.Fields())
+	assert.Equal(t, []string{"dept"}, qd.GroupFields())
+	assert.True(t, qd.IsGrouped())
+
+	// Aggregates used only in HAVING are computed too
+	names := []string{}
+	for _, fn := range qd.Aggregates() {
+		names = append(names, fn.FieldName())
+	}
+	assert.Equal(t, []string{"count(id)", "max(salary)", "min(salary)"}, names)
+	assert.Equal(t, "count(id) > 2 and min(salary) >= 10", qd.Having().String())
+	assert.Equal(t, "SELECT dept, count(id), max(salary) * 2 FROM employees WHERE salary > 0 GROUP BY dept HAVING count(id) > 2 and min(salary) >= 10", qd.String())
+
+	// Aggregates without GROUP BY aggregate the whole table
+	p = NewParser(NewLexer("select COUNT(*) from employees"))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"count(*)"}, qd.Fields())
+	assert.Empty(t, qd.GroupFields())
+	assert.True(t, qd.IsGrouped())
+
+	// Plain queries are not grouped
+	p = NewParser(NewLexer("select name from employees"))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	assert.False(t, qd.IsGrouped())
+
+	for _, stmt := range []string{
+		"select name from employees where count(id) > 1",
+		"select name from employees having name = 'x'",
+		"select sum(*) from employees",
+		"select dept from employees group dept",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserQualifiedFields(t *testing.T) {
+	p := NewParser(NewLexer("select students.name, courses.id + 1, count(students.id) from students, courses where students.id = courses.student_id group by students.name, courses.id"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"students.name", "courses.id + 1", "count(students.id)"}, qd.Fields())
+	assert.Equal(t, []string{"students.name", "courses.id"}, qd.GroupFields())
+	require.Len(t, qd.Aggregates(), 1)
+	assert.Equal(t, "students.id", qd.Aggregates()[0].Field())
+
+	terms := qd.Predicate().GetTerms()
+	require.Len(t, terms, 1)
+	other := terms[0].EquatesWithField("students.id")
+	require.NotNil(t, other)
+	assert.Equal(t, "courses.student_id", *other)
+
+	for _, stmt := range []string{
+		"select students. from students",
+		"select students.id. from students",
+		"select .id from students",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserTableWildcard(t *testing.T) {
+	p := NewParser(NewLexer("select students.*, enrollments.course from students, enrollments where students.id = enrollments.student_id order by 2"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"students.*", "enrollments.course"}, qd.Fields())
+	require.Len(t, qd.OrderBy(), 1)
+	assert.Equal(t, "enrollments.course", qd.OrderBy()[0].Expression().String())
+
+	for _, stmt := range []string{
+		"select students.* as s from students",
+		"select students.* + 1 from students",
+		"select count(students.*) from students",
+		"select id from students where students.* = 1",
+		"select students.* from students order by 1",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserQuotedIdentifiers(t *testing.T) {
+	p := NewParser(NewLexer(`select "Select", "Total" * 2, count("Total") from "My Table" "T" where "Select" = 'x' group by "Select"`))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Select", `"Total" * 2`, `count("Total")`}, qd.Fields())
+	assert.Equal(t, []string{"My Table"}, qd.Tables())
+	assert.Equal(t, []string{"T"}, qd.Aliases())
+	assert.Equal(t, []string{"Select"}, qd.GroupFields())
+	require.Len(t, qd.Aggregates(), 1)
+	assert.Equal(t, "Total", qd.Aggregates()[0].Field())
+
+	// The query is written back with the names that need it quoted, so it parses to the same query
+	text := qd.String()
+	assert.Equal(t, `SELECT "Select", "Total" * 2, count("Total") FROM "My Table" "T" WHERE "Select" = 'x' GROUP BY "Select"`, text)
+
+	// String constants are written back in quotes, with their quotes doubled
+	p = NewParser(NewLexer(`select name || '-x' from t where name in ('it''s', 'b') and upper(name) = 'A'`))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	text = qd.String()
+	assert.Equal(t, `SELECT name || '-x' FROM t WHERE name in ('it''s', 'b') and upper(name) = 'A'`, text)
+	reparsed, err := NewParser(NewLexer(text)).Query()
+	require.NoError(t, err)
+	assert.Equal(t, text, reparsed.String())
+
+	// A quoted name is a field even when spelled like a function
+	p = NewParser(NewLexer(`select "upper" from t`))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upper"}, qd.Fields())
+
+	cmd, err := NewParser(NewLexer(`create table "Order Items" ("Order" int, name varchar(10))`)).CreateCmd()
+	require.NoError(t, err)
+	ct := cmd.(*parserdata.CreateTableData)
+	assert.Equal(t, "Order Items", ct.TableName())
+	assert.Equal(t, []string{"Order", "name"}, ct.Schema().Fields())
+}
+
+func TestParserSelectAliases(t *testing.T) {
+	p := NewParser(NewLexer("select id, salary * 2 as bonus, name as who, count(id) as n from employees group by id, name"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "bonus", "who", "n"}, qd.Fields())
+	assert.Nil(t, qd.Expression("id"))
+	assert.Equal(t, "salary * 2", qd.Expression("bonus").String())
+	assert.Equal(t, "name", qd.Expression("who").String())
+	assert.Equal(t, "count(id)", qd.Expression("n").String())
+	assert.Equal(t, "SELECT id, salary * 2 AS bonus, name AS who, count(id) AS n FROM employees GROUP BY id, name", qd.String())
+
+	for _, stmt := range []string{
+		"select id as from employees",
+		"select id as x, name as x from employees",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserOrderBy(t *testing.T) {
+	p := NewParser(NewLexer("select name, salary * 2 as bonus from employees where salary > 0 order by salary * 2 desc, name asc, 2, bonus desc"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	keys := []string{}
+	for _, key := range qd.OrderBy() {
+		keys = append(keys, key.String())
+	}
+	// Positions and names of computed columns stand for the column's expression
+	assert.Equal(t, []string{"salary * 2 desc", "name", "salary * 2", "salary * 2 desc"}, keys)
+	assert.Equal(t, "SELECT name, salary * 2 AS bonus FROM employees WHERE salary > 0 ORDER BY salary * 2 desc, name, salary * 2, salary * 2 desc", qd.String())
+
+	// A position can name an aggregate, and ORDER BY can use aggregates not selected
+	p = NewParser(NewLexer("select dept, count(id) from employees group by dept order by 2 desc, max(salary), 1"))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT dept, count(id) FROM employees GROUP BY dept ORDER BY count(id) desc, max(salary), dept", qd.String())
+	assert.Len(t, qd.Aggregates(), 2)
+
+	p = NewParser(NewLexer("select name from employees"))
+	qd, err = p.Query()
+	require.NoError(t, err)
+	assert.Nil(t, qd.OrderBy())
+
+	for _, stmt := range []string{
+		"select name from employees order by 0",
+		"select name from employees order by 2",
+		"select from employees order by 1",
+		"select name from employees order name",
+		"select name from employees order by",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserExists(t *testing.T) {
+	p := NewParser(NewLexer("select name from students s where exists (select 1 from enrollments e where e.student_id = s.id) and not exists (select 1 from dropouts where sid = s.id)"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"students"}, qd.Tables())
+	assert.Equal(t, []string{"s"}, qd.Aliases())
+
+	terms := qd.Predicate().GetTerms()
+	require.Len(t, terms, 2)
+	assert.Equal(t, query.OpExists, terms[0].Operator())
+	assert.Equal(t, query.OpNotExists, terms[1].Operator())
+	inner, ok := terms[0].Subquery().Query().(*parserdata.QueryData)
+	require.True(t, ok)
+	assert.Equal(t, []string{"enrollments"}, inner.Tables())
+	assert.Equal(t, []string{"e"}, inner.Aliases())
+	assert.Equal(t, "e.student_id = s.id", inner.Predicate().String())
+	assert.Equal(t, "SELECT name FROM students s WHERE exists (SELECT 1 FROM enrollments e WHERE e.student_id = s.id) and not exists (SELECT 1 FROM dropouts WHERE sid = s.id)", qd.String())
+
+	for _, stmt := range []string{
+		"select name from students where exists select 1 from enrollments",
+		"select name from students where exists (select 1 from enrollments",
+		"select name from students where not (select 1 from enrollments)",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.Query()
+		assert.ErrorIs(t, err, ErrBadSyntax, stmt)
+	}
+}
+
+func TestParserScalarSubquery(t *testing.T) {
+	p := NewParser(NewLexer("select name from employees where salary = (select max(salary) from employees) and id > (select min(id) from employees) + 1"))
+	qd, err := p.Query()
+	require.NoError(t, err)
+	assert.Equal(t, "salary = (SELECT max(salary) FROM employees) and id > (SELECT min(id) FROM employees) + 1", qd.Predicate().String())
+
+	subqueries := qd.Predicate().Subqueries()
+	require.Len(t, subqueries, 2)
+	inner, ok := subqueries[0].Query().(*parserdata.QueryData)
+	require.True(t, ok)
+	assert.Equal(t, []string{"max(salary)"}, inner.Fields())
+	// The aggregate belongs to the subquery, not the enclosing query
+	assert.False(t, qd.IsGrouped())
+
+	p = NewParser(NewLexer("select name from employees where salary = (select max(salary) from employees"))
+	_, err = p.Query()
+	assert.ErrorIs(t, err, ErrBadSyntax)
+}
+
 func TestParserInsert(t *testing.T) {
 	t.Run("SimpleInsert", func(t *testing.T) {
 		q := "insert into students (name, age) values ('John', 25)"
@@ -176,6 +730,30 @@ func TestParserInsert(t *testing.T) {
 		assert.Equal(t, []string{"name", "age"}, ins.Fields())
 		assert.Equal(t, []any{"Alice", 30}, ins.Values())
 	})
+
+	t.Run("InsertOnConflict", func(t *testing.T) {
+		q := "INSERT INTO counters (name, hits) VALUES ('home', 1) ON CONFLICT (name) DO UPDATE SET hits = hits + 1"
+		p := NewParser(NewLexer(q))
+		cmd, err := p.UpdateCmd()
+		require.NoError(t, err)
+		upsert, ok := cmd.(*parserdata.UpsertData)
+		require.True(t, ok)
+		assert.Equal(t, "counters", upsert.Insert().Table())
+		assert.Equal(t, []any{"home", 1}, upsert.Insert().Values())
+		assert.Equal(t, "name", upsert.ConflictField())
+		assert.Equal(t, "hits", upsert.FieldName())
+		assert.Equal(t, "hits + 1", upsert.NewValue().String())
+
+		for _, stmt := range []string{
+			"insert into counters (name) values ('home') on conflict do update set hits = 1",
+			"insert into counters (name) values ('home') on conflict (name) update set hits = 1",
+			"insert into counters (name) values ('home') on conflict (name) do update hits = 1",
+		} {
+			p = NewParser(NewLexer(stmt))
+			_, err = p.UpdateCmd()
+			assert.Error(t, err, stmt)
+		}
+	})
 }
 
 func TestParserHelpers(t *testing.T) {
@@ -190,9 +768,22 @@ func TestParserHelpers(t *testing.T) {
 	t.Run("tableList", func(t *testing.T) {
 		p := NewParser(NewLexer("Students, Classes"))
 		require.NotNil(t, p)
-		tables, err := p.tableList()
+		tables, aliases, err := p.tableList()
 		require.NoError(t, err)
 		assert.Equal(t, []string{"students", "classes"}, tables)
+		assert.Equal(t, []string{"", ""}, aliases)
+	})
+
+	t.Run("tableListWithAliases", func(t *testing.T) {
+		p := NewParser(NewLexer("students s, classes AS c, enrollments"))
+		tables, aliases, err := p.tableList()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"students", "classes", "enrollments"}, tables)
+		assert.Equal(t, []string{"s", "c", ""}, aliases)
+
+		p = NewParser(NewLexer("students s, classes s"))
+		_, _, err = p.tableList()
+		assert.ErrorContains(t, err, "duplicate table alias: s")
 	})
 
 	t.Run("constListMixedTypes", func(t *testing.T) {
@@ -228,8 +819,139 @@ func TestParserDelete(t *testing.T) {
 		require.True(t, ok)
 		require.NotNil(t, dd)
 		require.NotNil(t, dd.Predicate())
-		assert.Equal(t, "age = 25 and name = John", dd.Predicate().String())
+		assert.Equal(t, "age = 25 and name = 'John'", dd.Predicate().String())
+	})
+}
+
+func TestParserCopy(t *testing.T) {
+	t.Run("AllFields", func(t *testing.T) {
+		p := NewParser(NewLexer("copy students from 'students.csv'"))
+		cmd, err := p.UpdateCmd()
+		require.NoError(t, err)
+		cd, ok := cmd.(*parserdata.CopyData)
+		require.True(t, ok)
+		assert.Equal(t, "students", cd.Table())
+		assert.Empty(t, cd.Fields())
+		assert.Equal(t, "students.csv", cd.Path())
+	})
+
+	t.Run("WithFields", func(t *testing.T) {
+		p := NewParser(NewLexer("COPY students (name, id) FROM '/tmp/students.csv'"))
+		cmd, err := p.UpdateCmd()
+		require.NoError(t, err)
+		cd, ok := cmd.(*parserdata.CopyData)
+		require.True(t, ok)
+		assert.Equal(t, []string{"name", "id"}, cd.Fields())
+		assert.Equal(t, "/tmp/students.csv", cd.Path())
 	})
+
+	t.Run("MissingPath", func(t *testing.T) {
+		p := NewParser(NewLexer("copy students from students"))
+		_, err := p.UpdateCmd()
+		assert.Error(t, err)
+	})
+}
+
+func TestParserSyntaxErrors(t *testing.T) {
+	tests := map[string]string{
+		"insert into students (id, name values (1, 'Ann')": "expected ')' at position 32, got 'values'",
+		"select name students":                             "expected FROM at position 13, got 'students'",
+		"select name from students where age = ":           "expected an expression at position 39, got end of input",
+		"select name from students where 'Ann' name":       "expected a comparison operator at position 39, got 'name'",
+		"update students set age 26":                       "expected '=' at position 25, got '26'",
+		"create tabel students (id int)":                   "expected TABLE, VIEW or INDEX at position 8, got 'tabel'",
+		"create table students (id float)":                 "expected INT, BIGINT or VARCHAR at position 27, got 'float'",
+		"create table select (id int)":                     "expected an identifier at position 14, got 'select'",
+		"select name from students where id = 1 or id = 3": "unexpected 'or' at position 40",
+		"delete from students where id = 1 or id = 3":      "unexpected 'or' at position 35",
+		"select name from students; drop":                  "unexpected 'drop' at position 28",
+	}
+	for sql, expected := range tests {
+		var err error
+		p := NewParser(NewLexer(sql))
+		if strings.HasPrefix(sql, "select") {
+			_, err = p.Query()
+		} else {
+			_, err = p.UpdateCmd()
+		}
+		if err == nil {
+			err = p.EatEnd()
+		}
+		require.Error(t, err, sql)
+		assert.ErrorIs(t, err, ErrBadSyntax, sql)
+		assert.EqualError(t, err, "bad syntax: "+expected, sql)
+
+		// The position points at the token that was found
+		var syntaxErr *SyntaxError
+		require.ErrorAs(t, err, &syntaxErr, sql)
+		if syntaxErr.Found != "end of input" {
+			assert.True(t, strings.HasPrefix(sql[syntaxErr.Position-1:], strings.Trim(syntaxErr.Found, "'")), sql)
+		}
+	}
+
+	// A statement may end with a ';'
+	p := NewParser(NewLexer("select name from students;"))
+	_, err := p.Query()
+	require.NoError(t, err)
+	assert.NoError(t, p.EatEnd())
+}
+
+func TestParserVacuum(t *testing.T) {
+	p := NewParser(NewLexer("VACUUM students"))
+	cmd, err := p.UpdateCmd()
+	require.NoError(t, err)
+	vd, ok := cmd.(*parserdata.VacuumData)
+	require.True(t, ok)
+	assert.Equal(t, "students", vd.Table())
+
+	p = NewParser(NewLexer("vacuum"))
+	_, err = p.UpdateCmd()
+	assert.Error(t, err)
+}
+
+func TestParserDropColumn(t *testing.T) {
+	p := NewParser(NewLexer("ALTER TABLE students DROP COLUMN age"))
+	cmd, err := p.UpdateCmd()
+	require.NoError(t, err)
+	dd, ok := cmd.(*parserdata.DropColumnData)
+	require.True(t, ok)
+	assert.Equal(t, "students", dd.Table())
+	assert.Equal(t, "age", dd.Column())
+
+	for _, stmt := range []string{
+		"alter students drop column age",
+		"alter table students drop age",
+		"alter table students drop column",
+		"alter table students add column age int",
+	} {
+		p = NewParser(NewLexer(stmt))
+		_, err = p.UpdateCmd()
+		assert.Error(t, err, stmt)
+	}
+}
+
+func TestParserReindex(t *testing.T) {
+	p := NewParser(NewLexer("REINDEX students_age_idx"))
+	cmd, err := p.UpdateCmd()
+	require.NoError(t, err)
+	rd, ok := cmd.(*parserdata.ReindexData)
+	require.True(t, ok)
+	assert.Equal(t, "students_age_idx", rd.Index())
+	assert.Equal(t, "", rd.Table())
+
+	p = NewParser(NewLexer("reindex table students"))
+	cmd, err = p.UpdateCmd()
+	require.NoError(t, err)
+	rd, ok = cmd.(*parserdata.ReindexData)
+	require.True(t, ok)
+	assert.Equal(t, "", rd.Index())
+	assert.Equal(t, "students", rd.Table())
+
+	for _, sql := range []string{"reindex", "reindex table"} {
+		p = NewParser(NewLexer(sql))
+		_, err = p.UpdateCmd()
+		assert.Error(t, err, sql)
+	}
 }
 
 func TestParserUpdate(t *testing.T) {
@@ -302,6 +1024,18 @@ func TestParserCreateTable(t *testing.T) {
 		assert.Equal(t, "int", sch.Type("age"))
 		assert.Equal(t, "string", sch.Type("nickname"))
 		assert.Equal(t, 8, sch.Length("nickname"))
+		assert.False(t, ct.PackedStrings())
+	})
+
+	t.Run("Packed", func(t *testing.T) {
+		stmt := "create table notes (id int, body varchar(200)) packed"
+		p := NewParser(NewLexer(stmt))
+		cmd, err := p.CreateCmd()
+		require.NoError(t, err)
+		ct := cmd.(*parserdata.CreateTableData)
+		assert.Equal(t, "notes", ct.TableName())
+		assert.True(t, ct.PackedStrings())
+		assert.Equal(t, 200, ct.Schema().Length("body"))
 	})
 }
 
@@ -323,6 +1057,26 @@ func TestParserCreateView(t *testing.T) {
 	assert.Equal(t, "age = 30", qd.Predicate().String())
 }
 
+func TestParserCreateTableAs(t *testing.T) {
+	stmt := "create table Adults as select id, name from students where age >= 18"
+	p := NewParser(NewLexer(stmt))
+	cmd, err := p.CreateCmd()
+	require.NoError(t, err)
+	ct, ok := cmd.(*parserdata.CreateTableAsData)
+	require.True(t, ok)
+	assert.Equal(t, "adults", ct.TableName())
+	qd := ct.Query()
+	require.NotNil(t, qd)
+	assert.Equal(t, []string{"id", "name"}, qd.Fields())
+	assert.Equal(t, []string{"students"}, qd.Tables())
+	assert.Equal(t, "age >= 18", qd.Predicate().String())
+
+	// AS must be followed by a query
+	p = NewParser(NewLexer("create table adults as students"))
+	_, err = p.CreateCmd()
+	assert.Error(t, err)
+}
+
 func TestParserCreateIndex(t *testing.T) {
 	stmt := "create index idx_name on students (name)"
 	p := NewParser(NewLexer(stmt))
@@ -335,6 +1089,22 @@ func TestParserCreateIndex(t *testing.T) {
 	assert.Equal(t, "idx_name", ci.IndexName())
 	assert.Equal(t, "students", ci.TableName())
 	assert.Equal(t, "name", ci.FieldName())
+	assert.Equal(t, index.HashType, ci.IndexType())
+
+	// USING names the type of index, before or after the field
+	for stmt, indexType := range map[string]string{
+		"create index idx_age on students (age) using btree": index.BTreeType,
+		"create index idx_age on students using BTREE (age)": index.BTreeType,
+		"create index idx_age on students (age) USING hash":  index.HashType,
+	} {
+		cmd, err := NewParser(NewLexer(stmt)).CreateCmd()
+		require.NoError(t, err, stmt)
+		ci := cmd.(*parserdata.CreateIndexData)
+		assert.Equal(t, "age", ci.FieldName(), stmt)
+		assert.Equal(t, indexType, ci.IndexType(), stmt)
+	}
+	_, err = NewParser(NewLexer("create index idx_age on students (age) using gist")).CreateCmd()
+	assert.ErrorContains(t, err, "HASH or BTREE")
 }
 
 func TestParserFieldDefinitionsHelpers(t *testing.T) {
@@ -0,0 +1,29 @@
+package parserdata
+
+// CopyData holds a COPY statement, which loads the records of a CSV file into a table.
+// An empty field list means the fields of the table in their schema order.
+type CopyData struct {
+	table  string
+	fields []string
+	path   string
+}
+
+func NewCopyData(table string, fields []string, path string) *CopyData {
+	return &CopyData{
+		table:  table,
+		fields: fields,
+		path:   path,
+	}
+}
+
+func (c *CopyData) Table() string {
+	return c.table
+}
+
+func (c *CopyData) Fields() []string {
+	return c.fields
+}
+
+func (c *CopyData) Path() string {
+	return c.path
+}
@@ -4,13 +4,17 @@ type CreateIndexData struct {
 	indexName string
 	tableName string
 	fieldName string
+	indexType string
 }
 
-func NewCreateIndexData(indexName string, tableName string, fieldName string) *CreateIndexData {
+// NewCreateIndexData creates the data of a CREATE INDEX statement. The index type is
+// index.HashType or index.BTreeType.
+func NewCreateIndexData(indexName string, tableName string, fieldName string, indexType string) *CreateIndexData {
 	return &CreateIndexData{
 		indexName: indexName,
 		tableName: tableName,
 		fieldName: fieldName,
+		indexType: indexType,
 	}
 }
 
@@ -25,3 +29,8 @@ func (c *CreateIndexData) TableName() string {
 func (c *CreateIndexData) FieldName() string {
 	return c.fieldName
 }
+
+// IndexType returns the kind of index to create: index.HashType or index.BTreeType.
+func (c *CreateIndexData) IndexType() string {
+	return c.indexType
+}
@@ -0,0 +1,23 @@
+package parserdata
+
+// CreateTableAsData holds a CREATE TABLE ... AS SELECT statement.
+// The new table's schema is taken from the query's output.
+type CreateTableAsData struct {
+	tableName string
+	query     *QueryData
+}
+
+func NewCreateTableAsData(tableName string, query *QueryData) *CreateTableAsData {
+	return &CreateTableAsData{
+		tableName: tableName,
+		query:     query,
+	}
+}
+
+func (c *CreateTableAsData) TableName() string {
+	return c.tableName
+}
+
+func (c *CreateTableAsData) Query() *QueryData {
+	return c.query
+}
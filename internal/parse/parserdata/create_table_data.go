@@ -5,12 +5,16 @@ import "github.com/yashagw/cranedb/internal/record"
 type CreateTableData struct {
 	tableName string
 	schema    *record.Schema
+	// packedStrings is set by a trailing PACKED, which packs the table's strings into
+	// the end of each block instead of giving each its maximum length
+	packedStrings bool
 }
 
-func NewCreateTableData(tableName string, schema *record.Schema) *CreateTableData {
+func NewCreateTableData(tableName string, schema *record.Schema, packedStrings bool) *CreateTableData {
 	return &CreateTableData{
-		tableName: tableName,
-		schema:    schema,
+		tableName:     tableName,
+		schema:        schema,
+		packedStrings: packedStrings,
 	}
 }
 
@@ -21,3 +25,8 @@ func (c *CreateTableData) TableName() string {
 func (c *CreateTableData) Schema() *record.Schema {
 	return c.schema
 }
+
+// PackedStrings reports whether the table's strings are packed
+func (c *CreateTableData) PackedStrings() bool {
+	return c.packedStrings
+}
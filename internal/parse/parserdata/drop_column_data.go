@@ -0,0 +1,24 @@
+package parserdata
+
+// DropColumnData holds an ALTER TABLE ... DROP COLUMN statement, which removes a field
+// from a table and its records.
+type DropColumnData struct {
+	table  string
+	column string
+}
+
+func NewDropColumnData(table string, column string) *DropColumnData {
+	return &DropColumnData{
+		table:  table,
+		column: column,
+	}
+}
+
+func (d *DropColumnData) Table() string {
+	return d.table
+}
+
+// Column returns the name of the field to drop
+func (d *DropColumnData) Column() string {
+	return d.column
+}
@@ -5,16 +5,40 @@ import (
 )
 
 type QueryData struct {
-	fields    []string
-	tables    []string
-	predicate *query.Predicate
+	fields      []string
+	expressions map[string]*query.Expression
+	tables      []string
+	aliases     []string
+	predicate   *query.Predicate
+	groupFields []string
+	aggregates  []*query.AggregationFn
+	having      *query.Predicate
+	orderBy     []*query.SortKey
 }
 
 func NewQueryData(fields []string, tables []string, predicate *query.Predicate) *QueryData {
+	return NewQueryDataWithExpressions(fields, nil, tables, predicate)
+}
+
+// NewQueryDataWithExpressions creates a QueryData whose output columns include computed expressions.
+// Each computed column appears in fields under its name and maps to its expression in expressions.
+func NewQueryDataWithExpressions(fields []string, expressions map[string]*query.Expression, tables []string, predicate *query.Predicate) *QueryData {
+	return NewGroupedQueryData(fields, expressions, tables, predicate, nil, nil, nil)
+}
+
+// NewGroupedQueryData creates a QueryData that groups its records.
+// Each aggregate appears in fields (and in having) under its output column name, e.g. "count(id)".
+// The aggregates include those only used in having.
+func NewGroupedQueryData(fields []string, expressions map[string]*query.Expression, tables []string, predicate *query.Predicate,
+	groupFields []string, aggregates []*query.AggregationFn, having *query.Predicate) *QueryData {
 	return &QueryData{
-		fields:    fields,
-		tables:    tables,
-		predicate: predicate,
+		fields:      fields,
+		expressions: expressions,
+		tables:      tables,
+		predicate:   predicate,
+		groupFields: groupFields,
+		aggregates:  aggregates,
+		having:      having,
 	}
 }
 
@@ -22,14 +46,92 @@ func (q *QueryData) Fields() []string {
 	return q.fields
 }
 
+// WithFields returns a copy of the query that outputs other columns, with the same expressions.
+func (q *QueryData) WithFields(fields []string) *QueryData {
+	result := *q
+	result.fields = fields
+	return &result
+}
+
+// Expression returns the expression computing the given output column, or nil if it is a plain field.
+func (q *QueryData) Expression(field string) *query.Expression {
+	return q.expressions[field]
+}
+
 func (q *QueryData) Tables() []string {
 	return q.tables
 }
 
+// WithAliases sets the aliases of the tables, one for each table in the same order,
+// with "" for a table that has none, and returns the query.
+func (q *QueryData) WithAliases(aliases []string) *QueryData {
+	q.aliases = aliases
+	return q
+}
+
+// Aliases returns the names the query refers to its tables by, in the order of Tables:
+// a table's alias, or the table name if it has none.
+func (q *QueryData) Aliases() []string {
+	aliases := make([]string, len(q.tables))
+	for i, table := range q.tables {
+		aliases[i] = table
+		if i < len(q.aliases) && q.aliases[i] != "" {
+			aliases[i] = q.aliases[i]
+		}
+	}
+	return aliases
+}
+
+// WithPredicate returns a copy of the query that selects its records with another predicate.
+func (q *QueryData) WithPredicate(predicate *query.Predicate) *QueryData {
+	result := *q
+	result.predicate = predicate
+	return &result
+}
+
 func (q *QueryData) Predicate() *query.Predicate {
 	return q.predicate
 }
 
+// GroupFields returns the fields listed in GROUP BY.
+func (q *QueryData) GroupFields() []string {
+	return q.groupFields
+}
+
+// Aggregates returns the aggregate functions computed by the query.
+func (q *QueryData) Aggregates() []*query.AggregationFn {
+	return q.aggregates
+}
+
+// Having returns the predicate filtering the groups, or nil if there is none.
+func (q *QueryData) Having() *query.Predicate {
+	return q.having
+}
+
+// WithHaving returns a copy of the query that filters its groups with another predicate.
+func (q *QueryData) WithHaving(having *query.Predicate) *QueryData {
+	result := *q
+	result.having = having
+	return &result
+}
+
+// WithOrderBy sets the keys the query's rows are sorted by, and returns the query.
+func (q *QueryData) WithOrderBy(keys []*query.SortKey) *QueryData {
+	q.orderBy = keys
+	return q
+}
+
+// OrderBy returns the keys of the ORDER BY clause, or nil if the rows aren't sorted.
+// A key given by the position of a column is the column's expression.
+func (q *QueryData) OrderBy() []*query.SortKey {
+	return q.orderBy
+}
+
+// IsGrouped checks if the query groups its records, either with GROUP BY or by computing aggregates.
+func (q *QueryData) IsGrouped() bool {
+	return len(q.groupFields) > 0 || len(q.aggregates) > 0
+}
+
 // String returns a SQL string representation of the query.
 func (q *QueryData) String() string {
 	result := "SELECT "
@@ -39,16 +141,27 @@ func (q *QueryData) String() string {
 		if i > 0 {
 			result += ", "
 		}
-		result += field
+		if expr := q.expressions[field]; expr != nil && expr.String() != field {
+			result += expr.String() + " AS " + query.QuoteIdentifier(field)
+		} else if expr != nil || q.isAggregate(field) {
+			// The name of a computed column or an aggregate is the expression itself
+			result += field
+		} else {
+			result += query.QuoteFieldName(field)
+		}
 	}
 
 	// Add tables
 	result += " FROM "
+	aliases := q.Aliases()
 	for i, table := range q.tables {
 		if i > 0 {
 			result += ", "
 		}
-		result += table
+		result += query.QuoteIdentifier(table)
+		if aliases[i] != table {
+			result += " " + query.QuoteIdentifier(aliases[i])
+		}
 	}
 
 	// Add predicate if present
@@ -56,5 +169,39 @@ func (q *QueryData) String() string {
 		result += " WHERE " + q.predicate.String()
 	}
 
+	if len(q.groupFields) > 0 {
+		result += " GROUP BY "
+		for i, field := range q.groupFields {
+			if i > 0 {
+				result += ", "
+			}
+			result += query.QuoteFieldName(field)
+		}
+	}
+
+	if q.having != nil && q.having.String() != "" {
+		result += " HAVING " + q.having.String()
+	}
+
+	if len(q.orderBy) > 0 {
+		result += " ORDER BY "
+		for i, key := range q.orderBy {
+			if i > 0 {
+				result += ", "
+			}
+			result += key.String()
+		}
+	}
+
 	return result
 }
+
+// isAggregate checks if the field is the output column of one of the query's aggregates.
+func (q *QueryData) isAggregate(field string) bool {
+	for _, fn := range q.aggregates {
+		if fn.FieldName() == field {
+			return true
+		}
+	}
+	return false
+}
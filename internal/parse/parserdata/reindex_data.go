@@ -0,0 +1,30 @@
+package parserdata
+
+// ReindexData holds a REINDEX statement, which rebuilds an index, or every index of a
+// table, from the records of the table.
+type ReindexData struct {
+	index string
+	table string
+}
+
+func NewReindexData(index string) *ReindexData {
+	return &ReindexData{
+		index: index,
+	}
+}
+
+func NewReindexTableData(table string) *ReindexData {
+	return &ReindexData{
+		table: table,
+	}
+}
+
+// Index returns the name of the index to rebuild, or "" when rebuilding a table
+func (r *ReindexData) Index() string {
+	return r.index
+}
+
+// Table returns the name of the table whose indexes to rebuild, or "" when rebuilding an index
+func (r *ReindexData) Table() string {
+	return r.table
+}
@@ -0,0 +1,38 @@
+package parserdata
+
+import "github.com/yashagw/cranedb/internal/query"
+
+// UpsertData is an insert that modifies the existing records instead when the table
+// already has records with the inserted value of the conflict field
+// (INSERT ... ON CONFLICT (field) DO UPDATE SET ...).
+type UpsertData struct {
+	insert        *InsertData
+	conflictField string
+	fieldName     string
+	newValue      *query.Expression
+}
+
+func NewUpsertData(insert *InsertData, conflictField string, fieldName string, newValue *query.Expression) *UpsertData {
+	return &UpsertData{
+		insert:        insert,
+		conflictField: conflictField,
+		fieldName:     fieldName,
+		newValue:      newValue,
+	}
+}
+
+func (u *UpsertData) Insert() *InsertData {
+	return u.insert
+}
+
+func (u *UpsertData) ConflictField() string {
+	return u.conflictField
+}
+
+func (u *UpsertData) FieldName() string {
+	return u.fieldName
+}
+
+func (u *UpsertData) NewValue() *query.Expression {
+	return u.newValue
+}
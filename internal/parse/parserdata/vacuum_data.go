@@ -0,0 +1,17 @@
+package parserdata
+
+// VacuumData holds a VACUUM statement, which packs the records of a table into as few
+// blocks as possible.
+type VacuumData struct {
+	table string
+}
+
+func NewVacuumData(table string) *VacuumData {
+	return &VacuumData{
+		table: table,
+	}
+}
+
+func (v *VacuumData) Table() string {
+	return v.table
+}
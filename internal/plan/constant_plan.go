@@ -0,0 +1,62 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*ConstantPlan)(nil)
+)
+
+// ConstantPlan is the Plan for a single record of values known at planning time,
+// such as a COUNT(*) answered from the table statistics.
+type ConstantPlan struct {
+	fields []string
+	values []query.Constant
+	schema *record.Schema
+}
+
+// NewConstantPlan creates a plan for one record with the given fields and values.
+// The type of each field is taken from its value.
+func NewConstantPlan(fields []string, values []query.Constant) *ConstantPlan {
+	schema := record.NewSchema()
+	for i, field := range fields {
+		if values[i].IsLong() {
+			schema.AddBigIntField(field)
+		} else if values[i].IsInt() {
+			schema.AddIntField(field)
+		} else {
+			schema.AddStringField(field, len(values[i].AsString()))
+		}
+	}
+	return &ConstantPlan{
+		fields: fields,
+		values: values,
+		schema: schema,
+	}
+}
+
+func (cp *ConstantPlan) Open() (scan.Scan, error) {
+	return query.NewConstantScan(cp.fields, cp.values), nil
+}
+
+// BlocksAccessed returns 0 since no blocks are read.
+func (cp *ConstantPlan) BlocksAccessed() int {
+	return 0
+}
+
+// RecordsOutput returns 1.
+func (cp *ConstantPlan) RecordsOutput() int {
+	return 1
+}
+
+// DistinctValues returns 1 since there is a single record.
+func (cp *ConstantPlan) DistinctValues(fldname string) (int, error) {
+	return 1, nil
+}
+
+func (cp *ConstantPlan) Schema() *record.Schema {
+	return cp.schema
+}
@@ -0,0 +1,45 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*EmptyPlan)(nil)
+)
+
+// EmptyPlan is the Plan for no records, such as the records of a table a query's predicate
+// can never be satisfied for.
+type EmptyPlan struct {
+	schema *record.Schema
+}
+
+// NewEmptyPlan creates a plan without records whose records would have the given schema.
+func NewEmptyPlan(schema *record.Schema) *EmptyPlan {
+	return &EmptyPlan{schema: schema}
+}
+
+func (ep *EmptyPlan) Open() (scan.Scan, error) {
+	return query.NewEmptyScan(ep.schema.Fields()), nil
+}
+
+// BlocksAccessed returns 0 since no blocks are read.
+func (ep *EmptyPlan) BlocksAccessed() int {
+	return 0
+}
+
+// RecordsOutput returns 0.
+func (ep *EmptyPlan) RecordsOutput() int {
+	return 0
+}
+
+// DistinctValues returns 0 since there are no records.
+func (ep *EmptyPlan) DistinctValues(fldname string) (int, error) {
+	return 0, nil
+}
+
+func (ep *EmptyPlan) Schema() *record.Schema {
+	return ep.schema
+}
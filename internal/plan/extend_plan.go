@@ -0,0 +1,63 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*ExtendPlan)(nil)
+)
+
+// ExtendPlan is the Plan for a computed column (e.g. SELECT salary * 2 or SELECT UPPER(name)).
+type ExtendPlan struct {
+	p         Plan
+	fieldName string
+	expr      query.Expression
+	schema    *record.Schema
+}
+
+func NewExtendPlan(p Plan, fieldName string, expr query.Expression) *ExtendPlan {
+	schema := record.NewSchema()
+	schema.CopyAll(p.Schema())
+	fieldType, length := expr.FieldInfo(p.Schema())
+	schema.AddField(fieldName, fieldType, length)
+	return &ExtendPlan{
+		p:         p,
+		fieldName: fieldName,
+		expr:      expr,
+		schema:    schema,
+	}
+}
+
+func (ep *ExtendPlan) Open() (scan.Scan, error) {
+	s, err := ep.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewExtendScan(s, ep.fieldName, ep.expr), nil
+}
+
+// BlocksAccessed returns the same as the underlying plan (the value is computed per record).
+func (ep *ExtendPlan) BlocksAccessed() int {
+	return ep.p.BlocksAccessed()
+}
+
+// RecordsOutput returns the same as the underlying plan.
+func (ep *ExtendPlan) RecordsOutput() int {
+	return ep.p.RecordsOutput()
+}
+
+// DistinctValues assumes every record may compute a different value for the new field.
+func (ep *ExtendPlan) DistinctValues(fldname string) (int, error) {
+	if fldname == ep.fieldName {
+		return ep.p.RecordsOutput(), nil
+	}
+	return ep.p.DistinctValues(fldname)
+}
+
+// Schema returns the underlying schema plus the computed field.
+func (ep *ExtendPlan) Schema() *record.Schema {
+	return ep.schema
+}
@@ -0,0 +1,130 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*GroupByPlan)(nil)
+)
+
+// GroupByPlan is the Plan for grouping records and computing aggregates
+// (e.g. SELECT dept, COUNT(id) FROM employees GROUP BY dept).
+// Its output has the group fields followed by one field per aggregate function.
+type GroupByPlan struct {
+	p           Plan
+	groupFields []string
+	aggFns      []*query.AggregationFn
+	maxGroups   int
+	schema      *record.Schema
+}
+
+func NewGroupByPlan(p Plan, groupFields []string, aggFns []*query.AggregationFn) *GroupByPlan {
+	return NewGroupByPlanWithLimit(p, groupFields, aggFns, 0)
+}
+
+// NewGroupByPlanWithLimit creates a group by plan whose scan fails with query.ErrResultTooLarge
+// instead of holding more than maxGroups groups in memory. A maxGroups of 0 means no limit.
+func NewGroupByPlanWithLimit(p Plan, groupFields []string, aggFns []*query.AggregationFn, maxGroups int) *GroupByPlan {
+	schema := record.NewSchema()
+	for _, field := range groupFields {
+		schema.Copy(p.Schema(), field)
+	}
+	for _, fn := range aggFns {
+		fieldType, length := fn.FieldInfo(p.Schema())
+		schema.AddField(fn.FieldName(), fieldType, length)
+	}
+	return &GroupByPlan{
+		p:           p,
+		groupFields: groupFields,
+		aggFns:      aggFns,
+		maxGroups:   maxGroups,
+		schema:      schema,
+	}
+}
+
+func (gp *GroupByPlan) Open() (scan.Scan, error) {
+	s, err := gp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewGroupByScanWithLimit(s, gp.groupFields, gp.aggFns, gp.maxGroups), nil
+}
+
+// BlocksAccessed returns the same as the underlying plan, which is read once.
+func (gp *GroupByPlan) BlocksAccessed() int {
+	return gp.p.BlocksAccessed()
+}
+
+// RecordsOutput estimates the number of groups as the product of the distinct values
+// of the group fields, bounded by the number of input records.
+func (gp *GroupByPlan) RecordsOutput() int {
+	groups := 1
+	for _, field := range gp.groupFields {
+		distinct, err := gp.p.DistinctValues(field)
+		if err != nil {
+			return gp.p.RecordsOutput()
+		}
+		groups *= max(distinct, 1)
+	}
+	return min(groups, max(gp.p.RecordsOutput(), 1))
+}
+
+// DistinctValues returns the underlying estimate for group fields.
+// Aggregates are assumed to differ for every group.
+func (gp *GroupByPlan) DistinctValues(fldname string) (int, error) {
+	for _, field := range gp.groupFields {
+		if field == fldname {
+			return gp.p.DistinctValues(fldname)
+		}
+	}
+	return gp.RecordsOutput(), nil
+}
+
+// Schema returns the group fields and the aggregate output fields.
+func (gp *GroupByPlan) Schema() *record.Schema {
+	return gp.schema
+}
+
+var (
+	_ Plan = (*ParallelGroupByPlan)(nil)
+)
+
+// ParallelGroupByPlan is a GroupByPlan over the records of one table, optionally filtered by
+// a predicate, whose scan splits the table's blocks between several workers. Each worker
+// reads its blocks and groups their records, and the groups are merged at the end.
+type ParallelGroupByPlan struct {
+	*GroupByPlan
+	tablePlan *TablePlan
+	// pred filters the records of the table, or is nil to group all of them
+	pred    *query.Predicate
+	workers int
+}
+
+// NewParallelGroupByPlan creates a plan computing the groups of the group by plan with up to
+// workers goroutines. The group by plan's input must read tablePlan filtered by pred, if any.
+func NewParallelGroupByPlan(gp *GroupByPlan, tablePlan *TablePlan, pred *query.Predicate, workers int) *ParallelGroupByPlan {
+	return &ParallelGroupByPlan{
+		GroupByPlan: gp,
+		tablePlan:   tablePlan,
+		pred:        pred,
+		workers:     workers,
+	}
+}
+
+func (pp *ParallelGroupByPlan) Open() (scan.Scan, error) {
+	tableScans, err := pp.tablePlan.openPartitions(pp.workers)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]scan.Scan, len(tableScans))
+	for i, ts := range tableScans {
+		inputs[i] = ts
+		if pp.pred != nil {
+			inputs[i] = query.NewSelectScan(ts, *pp.pred)
+		}
+	}
+	return query.NewParallelGroupByScan(inputs, pp.groupFields, pp.aggFns, pp.maxGroups), nil
+}
@@ -0,0 +1,104 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+var (
+	_ Plan = (*HashJoinPlan)(nil)
+)
+
+// HashJoinMaxRecords is the number of build records a hash join holds in memory
+// before splitting its inputs into temp tables.
+const HashJoinMaxRecords = 10000
+
+// HashJoinPlan is the Plan for an equi-join (WHERE a.x = b.y) evaluated with a hash table.
+// The smaller input, by estimated records, is built into the hash table and the larger one probes it.
+type HashJoinPlan struct {
+	tx         *transaction.Transaction
+	p1         Plan
+	p2         Plan
+	field1     string
+	field2     string
+	maxRecords int
+	schema     *record.Schema
+}
+
+// NewHashJoinPlan creates a plan joining the records of p1 and p2 where field1 of p1 equals field2 of p2.
+func NewHashJoinPlan(tx *transaction.Transaction, p1 Plan, p2 Plan, field1 string, field2 string) *HashJoinPlan {
+	return NewHashJoinPlanWithLimit(tx, p1, p2, field1, field2, HashJoinMaxRecords)
+}
+
+// NewHashJoinPlanWithLimit creates a hash join plan that holds at most maxRecords build records in memory.
+func NewHashJoinPlanWithLimit(tx *transaction.Transaction, p1 Plan, p2 Plan, field1 string, field2 string, maxRecords int) *HashJoinPlan {
+	schema := record.NewSchema()
+	schema.CopyAll(p1.Schema())
+	schema.CopyAll(p2.Schema())
+	return &HashJoinPlan{
+		tx:         tx,
+		p1:         p1,
+		p2:         p2,
+		field1:     field1,
+		field2:     field2,
+		maxRecords: maxRecords,
+		schema:     schema,
+	}
+}
+
+func (hp *HashJoinPlan) Open() (scan.Scan, error) {
+	build, buildField, probe, probeField := hp.p1, hp.field1, hp.p2, hp.field2
+	if build.RecordsOutput() > probe.RecordsOutput() {
+		build, buildField, probe, probeField = probe, probeField, build, buildField
+	}
+
+	buildScan, err := build.Open()
+	if err != nil {
+		return nil, err
+	}
+	probeScan, err := probe.Open()
+	if err != nil {
+		buildScan.Close()
+		return nil, err
+	}
+	return query.NewHashJoinScan(hp.tx, buildScan, build.Schema(), buildField, probeScan, probe.Schema(), probeField, hp.maxRecords), nil
+}
+
+// BlocksAccessed reads each input once. When the smaller input doesn't fit in memory,
+// both inputs are also written to temp tables and read back.
+func (hp *HashJoinPlan) BlocksAccessed() int {
+	blocks := hp.p1.BlocksAccessed() + hp.p2.BlocksAccessed()
+	if min(hp.p1.RecordsOutput(), hp.p2.RecordsOutput()) > hp.maxRecords {
+		return 3 * blocks
+	}
+	return blocks
+}
+
+// RecordsOutput estimates the join size as the product size divided by the larger
+// number of distinct join values, as for a select on a product.
+func (hp *HashJoinPlan) RecordsOutput() int {
+	distinct1, err := hp.p1.DistinctValues(hp.field1)
+	if err != nil {
+		distinct1 = 1
+	}
+	distinct2, err := hp.p2.DistinctValues(hp.field2)
+	if err != nil {
+		distinct2 = 1
+	}
+	return hp.p1.RecordsOutput() * hp.p2.RecordsOutput() / max(distinct1, distinct2, 1)
+}
+
+// DistinctValues delegates to whichever underlying plan contains the field.
+func (hp *HashJoinPlan) DistinctValues(fldname string) (int, error) {
+	if hp.p1.Schema().HasField(fldname) {
+		return hp.p1.DistinctValues(fldname)
+	}
+	return hp.p2.DistinctValues(fldname)
+}
+
+// Schema returns the combined schema of both plans.
+func (hp *HashJoinPlan) Schema() *record.Schema {
+	return hp.schema
+}
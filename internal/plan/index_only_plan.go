@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*IndexOnlyPlan)(nil)
+)
+
+// IndexOnlyPlan is the Plan for a selection with index that needs no field but the
+// indexed one, so the values are read from the index without touching the table.
+// The index is searched once for each value.
+type IndexOnlyPlan struct {
+	indexInfo *metadata.IndexInfo
+	schema    *record.Schema
+	values    []any
+}
+
+// NewIndexOnlyPlan creates an index-only plan over the indexed field of the table schema
+func NewIndexOnlyPlan(tableSchema *record.Schema, indexInfo *metadata.IndexInfo, values []any) *IndexOnlyPlan {
+	schema := record.NewSchema()
+	schema.Copy(tableSchema, indexInfo.FieldName())
+	return &IndexOnlyPlan{
+		indexInfo: indexInfo,
+		schema:    schema,
+		values:    values,
+	}
+}
+
+func (iop *IndexOnlyPlan) Open() (scan.Scan, error) {
+	index, err := iop.indexInfo.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewIndexOnlyScan(index, iop.schema, iop.values)
+}
+
+// BlocksAccessed returns one index traversal per value; no data records are read.
+func (iop *IndexOnlyPlan) BlocksAccessed() int {
+	return len(iop.values) * iop.indexInfo.BlocksAccessed()
+}
+
+// RecordsOutput returns the matching records summed over all values.
+func (iop *IndexOnlyPlan) RecordsOutput() int {
+	return len(iop.values) * iop.indexInfo.RecordsOutput()
+}
+
+// DistinctValues delegates to the index.
+func (iop *IndexOnlyPlan) DistinctValues(fieldName string) (int, error) {
+	return iop.indexInfo.DistinctValues(fieldName), nil
+}
+
+// Schema returns a schema holding the indexed field alone.
+func (iop *IndexOnlyPlan) Schema() *record.Schema {
+	return iop.schema
+}
@@ -0,0 +1,113 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
+)
+
+var (
+	_ Plan = (*IndexRangePlan)(nil)
+)
+
+// IndexRangePlan is the Plan for a selection of a range of values of a field with a B-tree
+// index. The range is the one allowed by comparisons of the field with constants, such as
+// age > 30 AND age <= 40 or age BETWEEN 30 AND 40.
+type IndexRangePlan struct {
+	p         Plan
+	indexInfo *metadata.IndexInfo
+	rangePred *query.Predicate
+}
+
+// NewIndexRangePlan creates a plan searching the index for the range its field is given by
+// the predicate, which holds only comparisons of that field with constants.
+func NewIndexRangePlan(p Plan, indexInfo *metadata.IndexInfo, rangePred *query.Predicate) *IndexRangePlan {
+	return &IndexRangePlan{
+		p:         p,
+		indexInfo: indexInfo,
+		rangePred: rangePred,
+	}
+}
+
+func (irp *IndexRangePlan) Open() (scan.Scan, error) {
+	inputScan, err := irp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	idx, err := irp.indexInfo.Open()
+	if err != nil {
+		return nil, err
+	}
+	rangeIndex, ok := idx.(index.RangeIndex)
+	if !ok {
+		return nil, fmt.Errorf("index %s can't be searched for a range", irp.indexInfo.IndexName())
+	}
+	inputTableScan, ok := inputScan.(*table.TableScan)
+	if !ok {
+		return nil, fmt.Errorf("input scan is not a TableScan")
+	}
+	return query.NewIndexRangeScan(inputTableScan, rangeIndex, irp.searchRange())
+}
+
+// searchRange returns the range of values the comparisons allow the indexed field: above the
+// highest of their lower bounds and below the lowest of their upper bounds.
+func (irp *IndexRangePlan) searchRange() index.Range {
+	var low, high *query.Constant
+	r := index.Range{}
+	terms := irp.rangePred.GetTerms()
+	for i := range terms {
+		op, constant := terms[i].ComparesWithConstant(irp.indexInfo.FieldName())
+		if constant == nil {
+			continue
+		}
+		switch op {
+		case query.OpGreaterThan, query.OpGreaterThanOrEqual:
+			inclusive := op == query.OpGreaterThanOrEqual
+			if low == nil || constant.CompareTo(low) > 0 || (constant.CompareTo(low) == 0 && !inclusive) {
+				low, r.LowInclusive = constant, inclusive
+			}
+		case query.OpLessThan, query.OpLessThanOrEqual:
+			inclusive := op == query.OpLessThanOrEqual
+			if high == nil || constant.CompareTo(high) < 0 || (constant.CompareTo(high) == 0 && !inclusive) {
+				high, r.HighInclusive = constant, inclusive
+			}
+		}
+	}
+	if low != nil {
+		r.Low = searchValue(*low)
+	}
+	if high != nil {
+		r.High = searchValue(*high)
+	}
+	return r
+}
+
+// BlocksAccessed returns index traversal cost plus a random read for each matching data record.
+func (irp *IndexRangePlan) BlocksAccessed() int {
+	return irp.indexInfo.BlocksAccessed() + irp.RecordsOutput()*RandomIOCost
+}
+
+// RecordsOutput estimates the records in the range as the table's records reduced by the
+// comparisons, like a selection.
+func (irp *IndexRangePlan) RecordsOutput() int {
+	reductionFactor, err := irp.rangePred.ReductionFactor(irp.p)
+	if err != nil || reductionFactor == 0 {
+		return irp.p.RecordsOutput()
+	}
+	return irp.p.RecordsOutput() / reductionFactor
+}
+
+// DistinctValues delegates to the data table.
+func (irp *IndexRangePlan) DistinctValues(fieldName string) (int, error) {
+	return irp.p.DistinctValues(fieldName)
+}
+
+// Schema returns the schema of the data table.
+func (irp *IndexRangePlan) Schema() *record.Schema {
+	return irp.p.Schema()
+}
@@ -45,9 +45,9 @@ func (isp *IndexSelectPlan) Open() (scan.Scan, error) {
 	return query.NewIndexSelectScan(inputTableScan, index, isp.value)
 }
 
-// BlocksAccessed returns index traversal cost plus matching data records.
+// BlocksAccessed returns index traversal cost plus a random read for each matching data record.
 func (isp *IndexSelectPlan) BlocksAccessed() int {
-	return isp.indexInfo.BlocksAccessed() + isp.RecordsOutput()
+	return isp.indexInfo.BlocksAccessed() + isp.RecordsOutput()*RandomIOCost
 }
 
 // RecordsOutput returns the number of search key values for the index.
@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/table"
 )
@@ -42,7 +43,7 @@ func TestIndexSelectPlan(t *testing.T) {
 
 	// Create an index on the "id" field
 	indexName := "test_id_idx"
-	err = md.CreateIndex(indexName, tableName, "id", tx)
+	err = md.CreateIndex(indexName, tableName, "id", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Get index info
@@ -71,8 +72,8 @@ func TestIndexSelectPlan(t *testing.T) {
 	actualRecords := indexSelectPlan.RecordsOutput()
 	assert.Equal(t, expectedRecords, actualRecords)
 
-	// Test BlocksAccessed - should be indexInfo.BlocksAccessed() + RecordsOutput()
-	expectedBlocks := indexInfo.BlocksAccessed() + indexSelectPlan.RecordsOutput()
+	// Test BlocksAccessed - should be indexInfo.BlocksAccessed() plus a random read per record
+	expectedBlocks := indexInfo.BlocksAccessed() + indexSelectPlan.RecordsOutput()*RandomIOCost
 	actualBlocks := indexSelectPlan.BlocksAccessed()
 	assert.Equal(t, expectedBlocks, actualBlocks)
 
@@ -132,7 +133,7 @@ func TestIndexSelectPlanWithStringField(t *testing.T) {
 
 	// Create an index on the "name" field (string field)
 	indexName := "test_name_idx"
-	err = md.CreateIndex(indexName, tableName, "name", tx)
+	err = md.CreateIndex(indexName, tableName, "name", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Get index info
@@ -161,7 +162,7 @@ func TestIndexSelectPlanWithStringField(t *testing.T) {
 	assert.Equal(t, expectedRecords, actualRecords)
 
 	// Test BlocksAccessed
-	expectedBlocks := indexInfo.BlocksAccessed() + indexSelectPlan.RecordsOutput()
+	expectedBlocks := indexInfo.BlocksAccessed() + indexSelectPlan.RecordsOutput()*RandomIOCost
 	actualBlocks := indexSelectPlan.BlocksAccessed()
 	assert.Equal(t, expectedBlocks, actualBlocks)
 
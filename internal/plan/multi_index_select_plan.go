@@ -0,0 +1,68 @@
+package plan
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
+)
+
+var (
+	_ Plan = (*MultiIndexSelectPlan)(nil)
+)
+
+// MultiIndexSelectPlan is the Plan for an IN list selection with index.
+// The index is searched once for each value in the list.
+type MultiIndexSelectPlan struct {
+	p         Plan
+	indexInfo *metadata.IndexInfo
+	values    []any
+}
+
+func NewMultiIndexSelectPlan(p Plan, indexInfo *metadata.IndexInfo, values []any) *MultiIndexSelectPlan {
+	return &MultiIndexSelectPlan{
+		p:         p,
+		indexInfo: indexInfo,
+		values:    values,
+	}
+}
+
+func (misp *MultiIndexSelectPlan) Open() (scan.Scan, error) {
+	inputScan, err := misp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	index, err := misp.indexInfo.Open()
+	if err != nil {
+		return nil, err
+	}
+	inputTableScan, ok := inputScan.(*table.TableScan)
+	if !ok {
+		return nil, fmt.Errorf("input scan is not a TableScan")
+	}
+	return query.NewMultiIndexSelectScan(inputTableScan, index, misp.values)
+}
+
+// BlocksAccessed returns one index traversal plus a random read of each of its matching
+// data records per value.
+func (misp *MultiIndexSelectPlan) BlocksAccessed() int {
+	return len(misp.values) * (misp.indexInfo.BlocksAccessed() + misp.indexInfo.RecordsOutput()*RandomIOCost)
+}
+
+// RecordsOutput returns the matching records summed over all values.
+func (misp *MultiIndexSelectPlan) RecordsOutput() int {
+	return len(misp.values) * misp.indexInfo.RecordsOutput()
+}
+
+// DistinctValues delegates to the index.
+func (misp *MultiIndexSelectPlan) DistinctValues(fieldName string) (int, error) {
+	return misp.indexInfo.DistinctValues(fieldName), nil
+}
+
+// Schema returns the schema of the data table.
+func (misp *MultiIndexSelectPlan) Schema() *record.Schema {
+	return misp.p.Schema()
+}
@@ -1,10 +1,23 @@
 package plan
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
 )
 
+// ErrNotUpdatable is returned by a statement that changes records through a plan whose scan
+// can't change the records it reads.
+var ErrNotUpdatable = errors.New("plan is not updatable")
+
+// RandomIOCost is the cost of reading a block at random, in sequential block reads.
+// A table scan reads its blocks one after another, while an index lookup reads the
+// block of each matching record wherever it is, so an index only pays off when it
+// matches few records.
+const RandomIOCost = 4
+
 // Plan is the core interface for a relational algebra query plan node.
 // It provides methods for both execution (Open) and query cost/metadata estimation.
 type Plan interface {
@@ -19,3 +32,18 @@ type Plan interface {
 	// Schema returns the schema of the output records produced by this plan node.
 	Schema() *record.Schema
 }
+
+// openUpdateScan opens the plan and returns its scan as an UpdateScan. A plan whose scan
+// isn't one fails with ErrNotUpdatable, so that a statement never quietly changes nothing.
+func openUpdateScan(p Plan) (scan.UpdateScan, error) {
+	s, err := p.Open()
+	if err != nil {
+		return nil, err
+	}
+	us, ok := s.(scan.UpdateScan)
+	if !ok {
+		s.Close()
+		return nil, fmt.Errorf("%w: %T", ErrNotUpdatable, p)
+	}
+	return us, nil
+}
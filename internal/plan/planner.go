@@ -5,6 +5,7 @@ import (
 
 	"github.com/yashagw/cranedb/internal/parse"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
+	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
@@ -13,10 +14,16 @@ type QueryPlanner interface {
 }
 
 type UpdatePlanner interface {
-	ExecuteModify(modifyData *parserdata.ModifyData, tx *transaction.Transaction) (int, error)
-	ExecuteInsert(insertData *parserdata.InsertData, tx *transaction.Transaction) (int, error)
+	ExecuteModify(modifyData *parserdata.ModifyData, tx *transaction.Transaction) (int, []*record.RID, error)
+	ExecuteInsert(insertData *parserdata.InsertData, tx *transaction.Transaction) (int, []*record.RID, error)
+	ExecuteUpsert(upsertData *parserdata.UpsertData, tx *transaction.Transaction) (int, []*record.RID, error)
+	ExecuteCopy(copyData *parserdata.CopyData, tx *transaction.Transaction) (int, error)
 	ExecuteDelete(deleteData *parserdata.DeleteData, tx *transaction.Transaction) (int, error)
+	ExecuteVacuum(vacuumData *parserdata.VacuumData, tx *transaction.Transaction) (int, error)
+	ExecuteReindex(reindexData *parserdata.ReindexData, tx *transaction.Transaction) (int, error)
+	ExecuteDropColumn(dropColumnData *parserdata.DropColumnData, tx *transaction.Transaction) (int, error)
 	ExecuteCreateTable(createTableData *parserdata.CreateTableData, tx *transaction.Transaction) (int, error)
+	ExecuteCreateTableAs(createTableAsData *parserdata.CreateTableAsData, tx *transaction.Transaction) (int, error)
 	ExecuteCreateView(createViewData *parserdata.CreateViewData, tx *transaction.Transaction) (int, error)
 	ExecuteCreateIndex(createIndexData *parserdata.CreateIndexData, tx *transaction.Transaction) (int, error)
 }
@@ -24,6 +31,8 @@ type UpdatePlanner interface {
 type Planner struct {
 	queryPlanner  QueryPlanner
 	updatePlanner UpdatePlanner
+	// queryCache keeps the parsed form of the queries, or is nil to parse each one
+	queryCache *QueryCache
 }
 
 func NewPlanner(queryPlanner QueryPlanner, updatePlanner UpdatePlanner) *Planner {
@@ -33,36 +42,88 @@ func NewPlanner(queryPlanner QueryPlanner, updatePlanner UpdatePlanner) *Planner
 	}
 }
 
+// SetQueryCache makes the planner take the parsed form of queries from the cache, and
+// drop the cached queries of a table once DDL changes it. nil turns the cache off.
+func (p *Planner) SetQueryCache(cache *QueryCache) {
+	p.queryCache = cache
+}
+
 func (p *Planner) CreatePlan(sql string, tx *transaction.Transaction) (Plan, error) {
+	if p.queryCache != nil {
+		if queryData := p.queryCache.get(sql); queryData != nil {
+			return p.queryPlanner.CreatePlan(queryData, tx)
+		}
+	}
 	parser := parse.NewParserFromString(sql)
 	queryData, err := parser.Query()
+	if err == nil {
+		err = parser.EatEnd()
+	}
 	if err != nil {
 		return nil, err
 	}
+	if p.queryCache != nil {
+		p.queryCache.put(sql, queryData)
+	}
 	return p.queryPlanner.CreatePlan(queryData, tx)
 }
 
 func (p *Planner) ExecuteUpdate(sql string, tx *transaction.Transaction) (int, error) {
+	count, _, err := p.ExecuteUpdateWithRIDs(sql, tx)
+	return count, err
+}
+
+// ExecuteUpdateWithRIDs executes an update statement and returns the number of affected records,
+// along with the RIDs of the inserted or modified records. Other statements return no RIDs.
+func (p *Planner) ExecuteUpdateWithRIDs(sql string, tx *transaction.Transaction) (int, []*record.RID, error) {
 	parser := parse.NewParserFromString(sql)
 	updateData, err := parser.UpdateCmd()
+	if err == nil {
+		err = parser.EatEnd()
+	}
 	if err != nil {
-		return 0, err
+		return 0, nil, err
 	}
 
+	var count int
 	switch updateData := updateData.(type) {
 	case *parserdata.ModifyData:
 		return p.updatePlanner.ExecuteModify(updateData, tx)
 	case *parserdata.InsertData:
 		return p.updatePlanner.ExecuteInsert(updateData, tx)
+	case *parserdata.UpsertData:
+		return p.updatePlanner.ExecuteUpsert(updateData, tx)
+	case *parserdata.CopyData:
+		count, err = p.updatePlanner.ExecuteCopy(updateData, tx)
 	case *parserdata.DeleteData:
-		return p.updatePlanner.ExecuteDelete(updateData, tx)
+		count, err = p.updatePlanner.ExecuteDelete(updateData, tx)
+	case *parserdata.VacuumData:
+		count, err = p.updatePlanner.ExecuteVacuum(updateData, tx)
+	case *parserdata.ReindexData:
+		count, err = p.updatePlanner.ExecuteReindex(updateData, tx)
+	case *parserdata.DropColumnData:
+		count, err = p.updatePlanner.ExecuteDropColumn(updateData, tx)
+		p.invalidate(updateData.Table())
 	case *parserdata.CreateTableData:
-		return p.updatePlanner.ExecuteCreateTable(updateData, tx)
+		count, err = p.updatePlanner.ExecuteCreateTable(updateData, tx)
+		p.invalidate(updateData.TableName())
+	case *parserdata.CreateTableAsData:
+		count, err = p.updatePlanner.ExecuteCreateTableAs(updateData, tx)
+		p.invalidate(updateData.TableName())
 	case *parserdata.CreateViewData:
-		return p.updatePlanner.ExecuteCreateView(updateData, tx)
+		count, err = p.updatePlanner.ExecuteCreateView(updateData, tx)
 	case *parserdata.CreateIndexData:
-		return p.updatePlanner.ExecuteCreateIndex(updateData, tx)
+		count, err = p.updatePlanner.ExecuteCreateIndex(updateData, tx)
+		p.invalidate(updateData.TableName())
+	default:
+		return 0, nil, errors.New("invalid update command")
 	}
+	return count, nil, err
+}
 
-	return 0, errors.New("invalid update command")
+// invalidate drops the cached queries of the table, if there is a cache.
+func (p *Planner) invalidate(tableName string) {
+	if p.queryCache != nil {
+		p.queryCache.Invalidate(tableName)
+	}
 }
@@ -1,11 +1,25 @@
 package plan
 
 import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/parse"
+	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/table"
+	"github.com/yashagw/cranedb/internal/transaction"
 )
 
 func TestPlanner_E2E(t *testing.T) {
@@ -168,6 +182,81 @@ func TestPlanner_E2E(t *testing.T) {
 	assert.Equal(t, 2, remaining)
 }
 
+// TestPlanner_InMemoryRecovery runs statements against an in-memory database, then
+// restarts it over the same files after a crash and checks that recovery undoes the
+// changes of the transaction that never committed
+func TestPlanner_InMemoryRecovery(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+
+	// start opens the database, as after a restart, and returns a planner along with
+	// a function that begins transactions and the buffer manager they use
+	start := func(isNew bool) (*Planner, func() *transaction.Transaction, *buffer.Manager) {
+		lm, err := log.NewManager(fm, "testlog")
+		require.NoError(t, err)
+		bm, err := buffer.NewManager(fm, lm, 8)
+		require.NoError(t, err)
+		lockTable := transaction.NewLockTable()
+
+		tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+		require.NoError(t, tx.DoRecovery())
+		md := metadata.NewManager(isNew, tx)
+		require.NoError(t, tx.Commit())
+
+		planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+		newTx := func() *transaction.Transaction {
+			return transaction.NewTransaction(fm, lm, bm, lockTable)
+		}
+		return planner, newTx, bm
+	}
+
+	planner, newTx, bm := start(true)
+	tx := newTx()
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20))",
+		"INSERT INTO students (id, name) VALUES (1, 'Alice')",
+		"INSERT INTO students (id, name) VALUES (2, 'Bob')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	// This transaction's changes reach the files, but it never commits
+	tx = newTx()
+	for _, sql := range []string{
+		"UPDATE students SET name = 'Carol' WHERE id = 1",
+		"INSERT INTO students (id, name) VALUES (3, 'Dave')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	require.NoError(t, bm.FlushAllBuffers())
+
+	planner, newTx, _ = start(false)
+	tx = newTx()
+	defer tx.Commit()
+	plan, err := planner.CreatePlan("SELECT id, name FROM students", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	rows := []string{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		name, err := s.GetString("name")
+		require.NoError(t, err)
+		rows = append(rows, fmt.Sprintf("%d:%s", id, name))
+	}
+	assert.Equal(t, []string{"1:Alice", "2:Bob"}, rows)
+}
+
 func TestPlanner_CreateView(t *testing.T) {
 	_, tx, md, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -401,3 +490,1585 @@ func TestPlanner_ComplexPredicateScenario(t *testing.T) {
 	// 3. Join predicates are applied in Phase 3 after ProductPlan
 	// 4. All 4 types of predicates work together correctly
 }
+
+func TestPlanner_RangePredicates(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	updatePlanner := NewBasicUpdatePlanner(md)
+	planner := NewPlanner(queryPlanner, updatePlanner)
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE people (id INT, name VARCHAR(20), age INT)", tx)
+	require.NoError(t, err)
+	_, err = planner.ExecuteUpdate("CREATE INDEX people_age_idx ON people (age)", tx)
+	require.NoError(t, err)
+
+	people := []string{
+		"INSERT INTO people (id, name, age) VALUES (1, 'alice', 19)",
+		"INSERT INTO people (id, name, age) VALUES (2, 'bob', 20)",
+		"INSERT INTO people (id, name, age) VALUES (3, 'carol', 25)",
+		"INSERT INTO people (id, name, age) VALUES (4, 'dave', 30)",
+		"INSERT INTO people (id, name, age) VALUES (5, 'erin', 31)",
+	}
+	for _, sql := range people {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	selectIds := func(where string) []int {
+		plan, err := planner.CreatePlan("SELECT id FROM people WHERE "+where, tx)
+		require.NoError(t, err)
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		err = scan.BeforeFirst()
+		require.NoError(t, err)
+
+		ids := []int{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := scan.GetInt("id")
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// BETWEEN includes both boundary values
+	assert.ElementsMatch(t, []int{2, 3, 4}, selectIds("age BETWEEN 20 AND 30"))
+	assert.ElementsMatch(t, []int{2, 3, 4}, selectIds("name BETWEEN 'bob' AND 'dave'"))
+
+	assert.ElementsMatch(t, []int{1, 2}, selectIds("age < 25"))
+	assert.ElementsMatch(t, []int{1, 2, 3}, selectIds("age <= 25"))
+	assert.ElementsMatch(t, []int{4, 5}, selectIds("age > 25"))
+	assert.ElementsMatch(t, []int{3, 4, 5}, selectIds("age >= 25"))
+	assert.ElementsMatch(t, []int{1, 2, 4, 5}, selectIds("age <> 25"))
+	assert.ElementsMatch(t, []int{4, 5}, selectIds("name > 'carol'"))
+
+	// The equality uses the index on age while the range on the same field still applies
+	assert.ElementsMatch(t, []int{3}, selectIds("age = 25 AND age >= 20"))
+	assert.Empty(t, selectIds("age = 25 AND age > 25"))
+}
+
+func TestPlanner_NegativeIntegers(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE accounts (id INT, balance INT)",
+		"CREATE INDEX accounts_balance_idx ON accounts (balance)",
+		"INSERT INTO accounts (id, balance) VALUES (1, -50)",
+		"INSERT INTO accounts (id, balance) VALUES (2, 20)",
+		"INSERT INTO accounts (id, balance) VALUES (3, -5)",
+		"UPDATE accounts SET balance = balance - 100 WHERE id = 2",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	balances := func(where string) map[int]int {
+		plan, err := planner.CreatePlan("SELECT id, balance FROM accounts WHERE "+where, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		result := map[int]int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := s.GetInt("id")
+			require.NoError(t, err)
+			balance, err := s.GetInt("balance")
+			require.NoError(t, err)
+			result[id] = balance
+		}
+		return result
+	}
+
+	assert.Equal(t, map[int]int{1: -50, 2: -80, 3: -5}, balances("balance < 0"))
+	assert.Equal(t, map[int]int{1: -50}, balances("balance = -50"))
+	assert.Equal(t, map[int]int{3: -5}, balances("balance > -10"))
+	assert.Equal(t, map[int]int{2: -80}, balances("balance - -80 = 0"))
+}
+
+func TestPlanner_BigInt(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE accounts (id INT, balance BIGINT)",
+		"CREATE INDEX accounts_balance_idx ON accounts (balance)",
+		"INSERT INTO accounts (id, balance) VALUES (1, 5000000000)",
+		"INSERT INTO accounts (id, balance) VALUES (2, -9000000000)",
+		"INSERT INTO accounts (id, balance) VALUES (3, 7)",
+		"UPDATE accounts SET balance = balance * 1000 WHERE id = 3",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err, sql)
+	}
+
+	balances := func(sql string) map[int]int {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		result := map[int]int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := s.GetInt("id")
+			require.NoError(t, err)
+			balance, err := s.GetInt("balance")
+			require.NoError(t, err)
+			result[id] = balance
+		}
+		return result
+	}
+
+	all := map[int]int{1: 5000000000, 2: -9000000000, 3: 7000}
+	assert.Equal(t, all, balances("SELECT id, balance FROM accounts"))
+	// Equality on the indexed field, and comparisons with values of both sizes
+	assert.Equal(t, map[int]int{1: 5000000000}, balances("SELECT id, balance FROM accounts WHERE balance = 5000000000"))
+	assert.Equal(t, map[int]int{3: 7000}, balances("SELECT id, balance FROM accounts WHERE balance = 7000"))
+	assert.Equal(t, map[int]int{1: 5000000000, 3: 7000}, balances("SELECT id, balance FROM accounts WHERE balance > 0"))
+	assert.Equal(t, map[int]int{2: -9000000000}, balances("SELECT id, balance FROM accounts WHERE balance < -2147483649"))
+
+	// Arithmetic on a bigint field produces a bigint
+	plan, err := planner.CreatePlan("SELECT id, balance * 2 AS balance FROM accounts WHERE id = 1", tx)
+	require.NoError(t, err)
+	assert.Equal(t, "bigint", plan.Schema().Type("balance"))
+	assert.Equal(t, map[int]int{1: 10000000000}, balances("SELECT id, balance * 2 AS balance FROM accounts WHERE id = 1"))
+	_, err = planner.ExecuteUpdate("UPDATE accounts SET balance = balance * 5000000000 WHERE id = 1", tx)
+	assert.ErrorIs(t, err, query.ErrIntegerOverflow)
+
+	// SUM of a bigint field is a bigint
+	plan, err = planner.CreatePlan("SELECT SUM(balance) FROM accounts", tx)
+	require.NoError(t, err)
+	assert.Equal(t, "bigint", plan.Schema().Type("sum(balance)"))
+	s, err := plan.Open()
+	require.NoError(t, err)
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	sum, err := s.GetInt("sum(balance)")
+	require.NoError(t, err)
+	assert.Equal(t, -3999993000, sum)
+	s.Close()
+
+	// The values survive a table created from the query
+	_, err = planner.ExecuteUpdate("CREATE TABLE rich AS SELECT id, balance FROM accounts WHERE balance > 1000000", tx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{1: 5000000000}, balances("SELECT id, balance FROM rich"))
+}
+
+func TestPlanner_ArithmeticExpressions(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	updatePlanner := NewBasicUpdatePlanner(md)
+	planner := NewPlanner(queryPlanner, updatePlanner)
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE employees (id INT, age INT, salary INT)", tx)
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"INSERT INTO employees (id, age, salary) VALUES (1, 22, 1000)",
+		"INSERT INTO employees (id, age, salary) VALUES (2, 26, 2000)",
+		"INSERT INTO employees (id, age, salary) VALUES (3, 30, 3000)",
+	} {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// Computed column in SELECT
+	plan, err := planner.CreatePlan("SELECT id, salary * 2 FROM employees WHERE age + 5 > 30", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "salary * 2"}, plan.Schema().Fields())
+	assert.Equal(t, "int", plan.Schema().Type("salary * 2"))
+
+	scan, err := plan.Open()
+	require.NoError(t, err)
+	err = scan.BeforeFirst()
+	require.NoError(t, err)
+	results := map[int]int{}
+	for {
+		hasNext, err := scan.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := scan.GetInt("id")
+		require.NoError(t, err)
+		doubled, err := scan.GetInt("salary * 2")
+		require.NoError(t, err)
+		results[id] = doubled
+	}
+	scan.Close()
+	assert.Equal(t, map[int]int{2: 4000, 3: 6000}, results)
+
+	// Aliased columns, computed or not
+	plan, err = planner.CreatePlan("SELECT id AS emp, salary * 2 AS bonus FROM employees WHERE id = 3", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"emp", "bonus"}, plan.Schema().Fields())
+	assert.Equal(t, "int", plan.Schema().Type("emp"))
+	scan, err = plan.Open()
+	require.NoError(t, err)
+	require.NoError(t, scan.BeforeFirst())
+	hasNext, err := scan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	emp, err := scan.GetInt("emp")
+	require.NoError(t, err)
+	assert.Equal(t, 3, emp)
+	bonus, err := scan.GetInt("bonus")
+	require.NoError(t, err)
+	assert.Equal(t, 6000, bonus)
+	assert.False(t, scan.HasField("salary"))
+	scan.Close()
+
+	// Aliases name the columns of a table created from the query
+	_, err = planner.ExecuteUpdate("CREATE TABLE bonuses AS SELECT id, salary * 2 AS bonus FROM employees", tx)
+	require.NoError(t, err)
+	layout, err := md.GetTableLayout("bonuses", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "bonus"}, layout.GetSchema().Fields())
+
+	// Arithmetic in UPDATE ... SET
+	count, err := planner.ExecuteUpdate("UPDATE employees SET salary = salary + salary / 10 WHERE id = 1", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	plan, err = planner.CreatePlan("SELECT salary FROM employees WHERE id = 1", tx)
+	require.NoError(t, err)
+	scan, err = plan.Open()
+	require.NoError(t, err)
+	err = scan.BeforeFirst()
+	require.NoError(t, err)
+	hasNext, err = scan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	salary, err := scan.GetInt("salary")
+	require.NoError(t, err)
+	assert.Equal(t, 1100, salary)
+	scan.Close()
+
+	// Division by zero returns an error
+	plan, err = planner.CreatePlan("SELECT id FROM employees WHERE salary / (age - 22) > 1", tx)
+	require.NoError(t, err)
+	scan, err = plan.Open()
+	require.NoError(t, err)
+	defer scan.Close()
+	err = scan.BeforeFirst()
+	require.NoError(t, err)
+	_, err = scan.Next()
+	assert.ErrorIs(t, err, query.ErrDivisionByZero)
+
+	// Ints that don't fit in an INT field are refused rather than wrapped around
+	_, err = planner.ExecuteUpdate("INSERT INTO employees (id, age, salary) VALUES (4, 40, 2147483648)", tx)
+	assert.ErrorIs(t, err, transaction.ErrIntOutOfRange)
+	assert.ErrorContains(t, err, "2147483648")
+	_, err = planner.ExecuteUpdate("UPDATE employees SET salary = salary * 10000000 WHERE id = 1", tx)
+	assert.ErrorIs(t, err, query.ErrIntegerOverflow)
+}
+
+func TestPlanner_ScalarFunctions(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	updatePlanner := NewBasicUpdatePlanner(md)
+	planner := NewPlanner(queryPlanner, updatePlanner)
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE students (id INT, name VARCHAR(20))", tx)
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"INSERT INTO students (id, name) VALUES (1, 'Alice')",
+		"INSERT INTO students (id, name) VALUES (2, 'Bob')",
+		"INSERT INTO students (id, name) VALUES (3, 'Charlie')",
+	} {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	plan, err := planner.CreatePlan("SELECT id, UPPER(name), name || '#' || id FROM students WHERE LENGTH(name) > 3", tx)
+	require.NoError(t, err)
+	schema := plan.Schema()
+	assert.Equal(t, []string{"id", "upper(name)", "(name || '#') || id"}, schema.Fields())
+	assert.Equal(t, "string", schema.Type("upper(name)"))
+	assert.Equal(t, 20, schema.Length("upper(name)"))
+	assert.Equal(t, "string", schema.Type("(name || '#') || id"))
+
+	scan, err := plan.Open()
+	require.NoError(t, err)
+	defer scan.Close()
+	err = scan.BeforeFirst()
+	require.NoError(t, err)
+
+	upper := map[int]string{}
+	tagged := map[int]string{}
+	for {
+		hasNext, err := scan.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := scan.GetInt("id")
+		require.NoError(t, err)
+		upper[id], err = scan.GetString("upper(name)")
+		require.NoError(t, err)
+		tagged[id], err = scan.GetString("(name || '#') || id")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, map[int]string{1: "ALICE", 3: "CHARLIE"}, upper)
+	assert.Equal(t, map[int]string{1: "Alice#1", 3: "Charlie#3"}, tagged)
+
+	// String functions on int fields fail when evaluated
+	plan, err = planner.CreatePlan("SELECT id FROM students WHERE UPPER(id) = 'X'", tx)
+	require.NoError(t, err)
+	errScan, err := plan.Open()
+	require.NoError(t, err)
+	defer errScan.Close()
+	err = errScan.BeforeFirst()
+	require.NoError(t, err)
+	_, err = errScan.Next()
+	assert.Error(t, err)
+}
+
+func TestPlanner_GroupByHaving(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	updatePlanner := NewBasicUpdatePlanner(md)
+	planner := NewPlanner(queryPlanner, updatePlanner)
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE employees (id INT, name VARCHAR(20), dept VARCHAR(10), salary INT)", tx)
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"INSERT INTO employees (id, name, dept, salary) VALUES (1, 'Alice', 'eng', 100)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (2, 'Bob', 'eng', 120)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (3, 'Carol', 'eng', 90)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (4, 'Dave', 'sales', 80)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (5, 'Erin', 'sales', 85)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (6, 'Frank', 'ops', 70)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (7, 'Grace', 'ops', 75)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (8, 'Heidi', 'ops', 95)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (9, 'Ivan', 'hr', 60)",
+	} {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	readGroups := func(sql string, fields ...string) []map[string]any {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		require.NoError(t, scan.BeforeFirst())
+
+		rows := []map[string]any{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			row := map[string]any{}
+			for _, field := range fields {
+				if plan.Schema().Type(field) == "int" {
+					row[field], err = scan.GetInt(field)
+				} else {
+					row[field], err = scan.GetString(field)
+				}
+				require.NoError(t, err)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	// Only departments with more than two members are kept
+	rows := readGroups("SELECT dept, COUNT(id), SUM(salary) FROM employees GROUP BY dept HAVING COUNT(id) > 2", "dept", "count(id)", "sum(salary)")
+	assert.Equal(t, []map[string]any{
+		{"dept": "eng", "count(id)": 3, "sum(salary)": 310},
+		{"dept": "ops", "count(id)": 3, "sum(salary)": 240},
+	}, rows)
+
+	// WHERE filters records before grouping, HAVING may use aggregates that are not selected
+	rows = readGroups("SELECT dept, MAX(name) FROM employees WHERE salary >= 80 GROUP BY dept HAVING MIN(salary) < 100", "dept", "max(name)")
+	assert.Equal(t, []map[string]any{
+		{"dept": "eng", "max(name)": "Carol"},
+		{"dept": "ops", "max(name)": "Heidi"},
+		{"dept": "sales", "max(name)": "Erin"},
+	}, rows)
+
+	// Expressions over aggregates and aggregates without GROUP BY
+	rows = readGroups("SELECT COUNT(*), AVG(salary), MAX(salary) - MIN(salary) FROM employees", "count(*)", "avg(salary)", "max(salary) - min(salary)")
+	assert.Equal(t, []map[string]any{
+		{"count(*)": 9, "avg(salary)": 86, "max(salary) - min(salary)": 60},
+	}, rows)
+
+	// Fields that are neither grouped nor aggregated are rejected
+	_, err = planner.CreatePlan("SELECT dept, name FROM employees GROUP BY dept", tx)
+	assert.ErrorContains(t, err, "name")
+	_, err = planner.CreatePlan("SELECT dept FROM employees GROUP BY dept HAVING salary > 10", tx)
+	assert.Error(t, err)
+}
+
+func TestPlanner_OrderBy(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE employees (id INT, name VARCHAR(20), dept VARCHAR(10), salary INT)", tx)
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"INSERT INTO employees (id, name, dept, salary) VALUES (1, 'Alice', 'eng', 100)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (2, 'Bob', 'eng', 120)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (3, 'Carol', 'ops', 90)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (4, 'Dave', 'sales', 80)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (5, 'Erin', 'ops', 120)",
+	} {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// readColumn returns the values of the first column of a query's rows, in order
+	readColumn := func(sql string) []any {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err, sql)
+		scan, err := plan.Open()
+		require.NoError(t, err, sql)
+		defer scan.Close()
+		field := plan.Schema().Fields()[0]
+		values := []any{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err, sql)
+			if !hasNext {
+				return values
+			}
+			if plan.Schema().Type(field) == "int" {
+				val, err := scan.GetInt(field)
+				require.NoError(t, err, sql)
+				values = append(values, val)
+			} else {
+				val, err := scan.GetString(field)
+				require.NoError(t, err, sql)
+				values = append(values, val)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		sql      string
+		expected []any
+	}{
+		// A computed column, by its expression, its name or its position; equal keys keep the table's order
+		{"SELECT name, salary * 2 AS double FROM employees ORDER BY salary * 2", []any{"Dave", "Carol", "Alice", "Bob", "Erin"}},
+		{"SELECT name, salary * 2 AS double FROM employees ORDER BY double DESC", []any{"Bob", "Erin", "Alice", "Carol", "Dave"}},
+		{"SELECT name, salary * 2 AS double FROM employees ORDER BY 2 DESC, 1 DESC", []any{"Erin", "Bob", "Alice", "Carol", "Dave"}},
+		{"SELECT salary - id * 10 FROM employees ORDER BY 1 ASC", []any{40, 60, 70, 90, 100}},
+		// An expression over fields that aren't selected
+		{"SELECT name FROM employees WHERE salary > 85 ORDER BY salary - id * 10 DESC", []any{"Bob", "Alice", "Erin", "Carol"}},
+		{"SELECT id FROM employees ORDER BY dept DESC, name", []any{4, 3, 5, 1, 2}},
+		// Groups, by an aggregate given by position or not selected
+		{"SELECT dept, COUNT(id) FROM employees GROUP BY dept ORDER BY 2 DESC, dept DESC", []any{"ops", "eng", "sales"}},
+		{"SELECT dept FROM employees GROUP BY dept ORDER BY MAX(salary) - MIN(salary), 1", []any{"sales", "eng", "ops"}},
+	} {
+		assert.Equal(t, tc.expected, readColumn(tc.sql), tc.sql)
+	}
+
+	for sql, message := range map[string]string{
+		"SELECT name FROM employees ORDER BY 3":                           "ORDER BY position 3",
+		"SELECT name FROM employees ORDER BY bonus":                       "unknown column: bonus",
+		"SELECT dept FROM employees GROUP BY dept ORDER BY name":          "ORDER BY name must only use GROUP BY fields",
+		"SELECT dept, COUNT(id) FROM employees GROUP BY dept ORDER BY id": "ORDER BY id must only use GROUP BY fields",
+	} {
+		_, err := planner.CreatePlan(sql, tx)
+		assert.ErrorContains(t, err, message, sql)
+	}
+}
+
+func TestPlanner_Not(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE people (id INT, age INT, name VARCHAR(10))",
+		"CREATE INDEX people_age_idx ON people (age)",
+		"INSERT INTO people (id, age, name) VALUES (1, 25, 'Ann')",
+		"INSERT INTO people (id, age, name) VALUES (2, 30, 'Ben')",
+		"INSERT INTO people (id, age, name) VALUES (3, 25, 'Cy')",
+		"INSERT INTO people (id, age, name) VALUES (4, 40, 'Di')",
+		"INSERT INTO people (id, age, name) VALUES (5, 35, 'Ed')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// readIDs returns the ids a query selects, and checks that it doesn't search the index
+	readIDs := func(sql string) []int {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err, sql)
+		assert.False(t, containsPlan[*IndexSelectPlan](plan), sql)
+		assert.False(t, containsPlan[*IndexOnlyPlan](plan), sql)
+		scan, err := plan.Open()
+		require.NoError(t, err, sql)
+		defer scan.Close()
+		ids := []int{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err, sql)
+			if !hasNext {
+				return ids
+			}
+			id, err := scan.GetInt("id")
+			require.NoError(t, err, sql)
+			ids = append(ids, id)
+		}
+	}
+
+	// NOT (age = 25) returns the complement of age = 25
+	assert.Equal(t, []int{2, 4, 5}, readIDs("SELECT id FROM people WHERE NOT (age = 25)"))
+	assert.Equal(t, []int{2, 4, 5}, readIDs("SELECT id FROM people WHERE NOT age = 25"))
+	assert.Equal(t, []int{5}, readIDs("SELECT id FROM people WHERE age NOT IN (25, 30, 40)"))
+	assert.Equal(t, []int{1, 2, 5}, readIDs("SELECT id FROM people WHERE NOT (age > 30 AND name <> 'Ed') AND id NOT BETWEEN 3 AND 4"))
+	assert.Equal(t, []int{1, 3, 5}, readIDs("SELECT id FROM people WHERE name NOT LIKE '%e%' AND NOT (id = 4)"))
+
+	// Updates and deletes take negated conditions too
+	affected, err := planner.ExecuteUpdate("DELETE FROM people WHERE age NOT IN (25)", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, affected)
+	assert.Equal(t, []int{1, 3}, readIDs("SELECT id FROM people WHERE NOT (age = 0)"))
+}
+
+func TestPlanner_IndexTypes(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	// Wide records take up a block each, so that reading a range through an index is cheaper
+	// than reading the whole table
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE events (id INT, day INT, note VARCHAR(300))",
+		"CREATE INDEX events_id_idx ON events (id)",
+		"CREATE INDEX events_day_idx ON events (day) USING BTREE",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	for i := 1; i <= 120; i++ {
+		_, err := planner.ExecuteUpdate(fmt.Sprintf("INSERT INTO events (id, day, note) VALUES (%d, %d, 'note')", i, 121-i), tx)
+		require.NoError(t, err)
+	}
+
+	// readIDs returns the ids a query selects
+	readIDs := func(plan Plan) []int {
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		ids := []int{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				return ids
+			}
+			id, err := scan.GetInt("id")
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+	}
+
+	// An equality is searched for in either kind of index
+	for _, sql := range []string{
+		"SELECT id, note FROM events WHERE id = 7",
+		"SELECT id, note FROM events WHERE day = 114",
+	} {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		assert.True(t, containsPlan[*IndexSelectPlan](plan), sql)
+		assert.Equal(t, []int{7}, readIDs(plan), sql)
+	}
+
+	// A range is only searched for in the B-tree index, which returns it in order
+	plan, err := planner.CreatePlan("SELECT id, note FROM events WHERE day BETWEEN 3 AND 6 AND day <> 4", tx)
+	require.NoError(t, err)
+	assert.True(t, containsPlan[*IndexRangePlan](plan))
+	assert.Equal(t, []int{118, 116, 115}, readIDs(plan))
+
+	plan, err = planner.CreatePlan("SELECT id, note FROM events WHERE 117 < day AND day < 1000", tx)
+	require.NoError(t, err)
+	assert.True(t, containsPlan[*IndexRangePlan](plan))
+	assert.Equal(t, []int{3, 2, 1}, readIDs(plan))
+
+	plan, err = planner.CreatePlan("SELECT id, note FROM events WHERE id > 117", tx)
+	require.NoError(t, err)
+	assert.False(t, containsPlan[*IndexRangePlan](plan))
+	assert.False(t, containsPlan[*IndexSelectPlan](plan))
+	assert.ElementsMatch(t, []int{118, 119, 120}, readIDs(plan))
+
+	// The B-tree index is kept up to date by updates and deletes
+	_, err = planner.ExecuteUpdate("UPDATE events SET day = 200 WHERE id = 1", tx)
+	require.NoError(t, err)
+	_, err = planner.ExecuteUpdate("DELETE FROM events WHERE id = 2", tx)
+	require.NoError(t, err)
+	plan, err = planner.CreatePlan("SELECT id, note FROM events WHERE day >= 117 AND day <= 300", tx)
+	require.NoError(t, err)
+	assert.True(t, containsPlan[*IndexRangePlan](plan))
+	assert.Equal(t, []int{4, 3, 1}, readIDs(plan))
+}
+
+func TestPlanner_CountFromStats(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	updatePlanner := NewBasicUpdatePlanner(md)
+	planner := NewPlanner(queryPlanner, updatePlanner)
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE items (id INT, name VARCHAR(10))", tx)
+	require.NoError(t, err)
+
+	// Load the records directly so that no statistics are cached yet
+	layout, err := md.GetTableLayout("items", tx)
+	require.NoError(t, err)
+	ts, err := table.NewTableScan(tx, layout, "items")
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("id", i))
+		require.NoError(t, ts.SetString("name", "item"))
+	}
+	ts.Close()
+
+	count := func(sql string) (Plan, int) {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		require.NoError(t, scan.BeforeFirst())
+		hasNext, err := scan.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		val, err := scan.GetInt("count(*)")
+		require.NoError(t, err)
+		hasNext, err = scan.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext, "COUNT(*) should produce a single row")
+		return plan, val
+	}
+
+	// Fresh statistics answer the count without a scan
+	plan, n := count("SELECT COUNT(*) FROM items")
+	assert.IsType(t, &ConstantPlan{}, plan)
+	assert.Equal(t, 3, n)
+
+	// A predicate needs the real aggregate
+	plan, n = count("SELECT COUNT(*) FROM items WHERE id > 1")
+	assert.IsType(t, &ProjectPlan{}, plan)
+	assert.Equal(t, 2, n)
+
+	// Other aggregates next to COUNT(*) need the real aggregate
+	plan, err = planner.CreatePlan("SELECT COUNT(*), MAX(id) FROM items", tx)
+	require.NoError(t, err)
+	assert.IsType(t, &ProjectPlan{}, plan)
+
+	// After an insert the statistics are stale and the records are counted
+	_, err = planner.ExecuteUpdate("INSERT INTO items (id, name) VALUES (4, 'item')", tx)
+	require.NoError(t, err)
+	plan, n = count("SELECT COUNT(*) FROM items")
+	assert.IsType(t, &ProjectPlan{}, plan)
+	assert.Equal(t, 4, n)
+
+	// The same after a delete
+	_, err = planner.ExecuteUpdate("DELETE FROM items WHERE id = 1", tx)
+	require.NoError(t, err)
+	plan, n = count("SELECT COUNT(*) FROM items")
+	assert.IsType(t, &ProjectPlan{}, plan)
+	assert.Equal(t, 3, n)
+}
+
+// TestPlanner_CountFromStatsAfterFailedWrites checks that COUNT(*) isn't answered from
+// statistics that count changes which were rolled back or never noted.
+func TestPlanner_CountFromStatsAfterFailedWrites(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 8)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	newTx := func() *transaction.Transaction {
+		return transaction.NewTransaction(fm, lm, bm, lockTable)
+	}
+	tx := newTx()
+	md := metadata.NewManager(true, tx)
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+
+	count := func(tx *transaction.Transaction) int {
+		plan, err := planner.CreatePlan("SELECT COUNT(*) FROM items", tx)
+		require.NoError(t, err)
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		require.NoError(t, scan.BeforeFirst())
+		hasNext, err := scan.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		n, err := scan.GetInt("count(*)")
+		require.NoError(t, err)
+		return n
+	}
+
+	_, err = planner.ExecuteUpdate("CREATE TABLE items (id INT, name VARCHAR(10))", tx)
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		_, err = planner.ExecuteUpdate(fmt.Sprintf("INSERT INTO items (id, name) VALUES (%d, 'item')", i), tx)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tx.Commit())
+
+	// A transaction counts its own uncommitted record, and once it rolls back the count
+	// no longer includes it
+	tx = newTx()
+	_, err = planner.ExecuteUpdate("INSERT INTO items (id, name) VALUES (4, 'item')", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count(tx))
+	require.NoError(t, tx.Rollback())
+	tx = newTx()
+	assert.Equal(t, 3, count(tx))
+	require.NoError(t, tx.Commit())
+
+	// A COPY that fails part way keeps the blocks it wrote in the open transaction
+	var csv strings.Builder
+	for i := 10; i < 100; i++ {
+		fmt.Fprintf(&csv, "%d,item\n", i)
+	}
+	csv.WriteString("x,item\n")
+	path := filepath.Join(t.TempDir(), "items.csv")
+	require.NoError(t, os.WriteFile(path, []byte(csv.String()), 0644))
+	tx = newTx()
+	assert.Equal(t, 3, count(tx))
+	_, err = planner.ExecuteUpdate(fmt.Sprintf("COPY items FROM '%s'", path), tx)
+	require.Error(t, err)
+	require.NoError(t, tx.Commit())
+
+	tx = newTx()
+	defer tx.Commit()
+	layout, err := md.GetTableLayout("items", tx)
+	require.NoError(t, err)
+	ts, err := table.NewTableScan(tx, layout, "items")
+	require.NoError(t, err)
+	actual := 0
+	for {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		actual++
+	}
+	ts.Close()
+	require.Greater(t, actual, 3)
+	assert.Equal(t, actual, count(tx))
+}
+
+// TestPlanner_MinMaxFromIndex checks that a bare MIN or MAX of a field with a B-tree index is
+// read from the index, and gives the same value as aggregating a scan of the table.
+func TestPlanner_MinMaxFromIndex(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE scores (id INT, score INT, name VARCHAR(10))",
+		"CREATE INDEX scores_id_idx ON scores (id)",
+		"CREATE INDEX scores_score_idx ON scores (score) USING BTREE",
+		"CREATE INDEX scores_name_idx ON scores (name) USING BTREE",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	order := rand.New(rand.NewSource(1)).Perm(200)
+	for i, n := range order {
+		sql := fmt.Sprintf("INSERT INTO scores (id, score, name) VALUES (%d, %d, 'name%03d')", i, n*7-500, n)
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// value returns the single value of a plan's only record
+	value := func(plan Plan, fieldName string) query.Constant {
+		scan, err := plan.Open()
+		require.NoError(t, err)
+		defer scan.Close()
+		require.NoError(t, scan.BeforeFirst())
+		hasNext, err := scan.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		val, err := scan.GetValue(fieldName)
+		require.NoError(t, err)
+		hasNext, err = scan.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext)
+		return val.(query.Constant)
+	}
+	// scanned returns the aggregate computed over a scan of the whole table
+	scanned := func(name string, field string) query.Constant {
+		tablePlan, err := NewTablePlan("scores", tx, md)
+		require.NoError(t, err)
+		aggFn, err := query.NewAggregationFn(name, field)
+		require.NoError(t, err)
+		return value(NewGroupByPlan(tablePlan, nil, []*query.AggregationFn{aggFn}), aggFn.FieldName())
+	}
+	check := func() {
+		for _, name := range []string{"min", "max"} {
+			for _, field := range []string{"score", "name"} {
+				sql := fmt.Sprintf("SELECT %s(%s) FROM scores", name, field)
+				plan, err := planner.CreatePlan(sql, tx)
+				require.NoError(t, err)
+				assert.IsType(t, &ConstantPlan{}, plan, sql)
+				assert.Equal(t, scanned(name, field), value(plan, fmt.Sprintf("%s(%s)", name, field)), sql)
+			}
+		}
+	}
+	check()
+	assert.Equal(t, *query.NewIntConstant(893), scanned("max", "score"))
+
+	// Deleting the highest and lowest records leaves leaves of the index empty
+	for _, sql := range []string{"DELETE FROM scores WHERE score > 300", "DELETE FROM scores WHERE score < -400"} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	check()
+	assert.Equal(t, *query.NewIntConstant(298), scanned("max", "score"))
+
+	// A predicate, an index that isn't a B-tree, or another aggregate need the real aggregate
+	for _, sql := range []string{
+		"SELECT MAX(score) FROM scores WHERE id > 3",
+		"SELECT MAX(id) FROM scores",
+		"SELECT MAX(score), MIN(score) FROM scores",
+		"SELECT MAX(score) FROM scores GROUP BY name",
+	} {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		assert.IsType(t, &ProjectPlan{}, plan, sql)
+	}
+	plan, err := planner.CreatePlan("SELECT MAX(id) FROM scores", tx)
+	require.NoError(t, err)
+	assert.Equal(t, scanned("max", "id"), value(plan, "max(id)"))
+
+	// An empty index leaves the value to the regular plan
+	_, err = planner.ExecuteUpdate("DELETE FROM scores WHERE id > -1", tx)
+	require.NoError(t, err)
+	plan, err = planner.CreatePlan("SELECT MAX(score) FROM scores", tx)
+	require.NoError(t, err)
+	assert.IsType(t, &ProjectPlan{}, plan)
+}
+
+// TestPlanner_ConstantPredicates checks that conditions on constants alone are dropped when
+// they are always true, and read no table when they are always false.
+func TestPlanner_ConstantPredicates(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE items (id INT, name VARCHAR(10))", tx)
+	require.NoError(t, err)
+
+	// Load the records directly so that the statistics stay exact
+	layout, err := md.GetTableLayout("items", tx)
+	require.NoError(t, err)
+	ts, err := table.NewTableScan(tx, layout, "items")
+	require.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("id", i))
+		require.NoError(t, ts.SetString("name", fmt.Sprintf("item%d", i)))
+	}
+	ts.Close()
+
+	// count returns the number of records of a query's plan
+	count := func(plan Plan) int {
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		n, err := countScanResults(s)
+		require.NoError(t, err)
+		return n
+	}
+
+	for _, tc := range []struct {
+		sql       string
+		count     int
+		hasSelect bool
+		empty     bool
+	}{
+		{sql: "SELECT id FROM items WHERE 1 = 1", count: 10},
+		{sql: "SELECT id FROM items WHERE 2 > 1 AND 'a' = 'a' AND NOT (1 = 2)", count: 10},
+		{sql: "SELECT id FROM items WHERE 1 = 1 AND id > 3", count: 7, hasSelect: true},
+		{sql: "SELECT id FROM items WHERE 1 = 2", count: 0, empty: true},
+		{sql: "SELECT id FROM items WHERE id > 3 AND 1 + 1 = 3", count: 0, empty: true},
+		{sql: "SELECT i.id, j.id FROM items i, items j WHERE i.id = j.id AND 1 IN (2, 3)", count: 0, empty: true},
+	} {
+		plan, err := planner.CreatePlan(tc.sql, tx)
+		require.NoError(t, err, tc.sql)
+		assert.Equal(t, tc.count, count(plan), tc.sql)
+		assert.Equal(t, tc.hasSelect, containsPlan[*SelectPlan](plan), tc.sql)
+		assert.Equal(t, tc.empty, containsPlan[*EmptyPlan](plan), tc.sql)
+		assert.Equal(t, !tc.empty, containsPlan[*TablePlan](plan), tc.sql)
+	}
+
+	// An always true condition still lets COUNT(*) be answered from the statistics
+	plan, err := planner.CreatePlan("SELECT COUNT(*) FROM items WHERE 1 = 1", tx)
+	require.NoError(t, err)
+	assert.IsType(t, &ConstantPlan{}, plan)
+
+	// Aggregating no records gives a count of 0
+	plan, err = planner.CreatePlan("SELECT COUNT(*) FROM items WHERE 1 = 2", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	n, err := s.GetInt("count(*)")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// The fields and types of a query that reads nothing are still checked
+	_, err = planner.CreatePlan("SELECT missing FROM items WHERE 1 = 2", tx)
+	assert.Error(t, err)
+	_, err = planner.CreatePlan("SELECT id FROM items WHERE name = 3 AND 1 = 2", tx)
+	assert.ErrorIs(t, err, query.ErrTypeMismatch)
+}
+
+// TestPlanner_HashJoinMatchesProduct checks that a hash join returns the same records as
+// a product followed by a select, on the data of TestPlanner_ComplexPredicateScenario.
+func TestPlanner_HashJoinMatchesProduct(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, age INT, status VARCHAR(10), name VARCHAR(20))",
+		"CREATE TABLE courses (student_id INT, credits INT, course_name VARCHAR(30))",
+		"INSERT INTO students (id, age, status, name) VALUES (1, 25, 'active', 'Alice')",
+		"INSERT INTO students (id, age, status, name) VALUES (2, 30, 'inactive', 'Bob')",
+		"INSERT INTO students (id, age, status, name) VALUES (3, 25, 'active', 'Charlie')",
+		"INSERT INTO students (id, age, status, name) VALUES (4, 22, 'active', 'Diana')",
+		"INSERT INTO students (id, age, status, name) VALUES (5, 25, 'inactive', 'Eve')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (1, 4, 'Math')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (2, 2, 'History')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (3, 4, 'Physics')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (4, 3, 'English')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (5, 4, 'Science')",
+		"INSERT INTO courses (student_id, credits, course_name) VALUES (3, 2, 'Art')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	parser := parse.NewParserFromString("SELECT id FROM students, courses WHERE age = 25 AND status = 'active' AND credits = 4 AND id = student_id")
+	queryData, err := parser.Query()
+	require.NoError(t, err)
+	predicate := queryData.Predicate()
+
+	students, err := NewTablePlan("students", tx, md)
+	require.NoError(t, err)
+	courses, err := NewTablePlan("courses", tx, md)
+	require.NoError(t, err)
+
+	readAll := func(plan Plan) []string {
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.BeforeFirst())
+		rows := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			row := ""
+			for _, field := range plan.Schema().Fields() {
+				val, err := s.GetValue(field)
+				require.NoError(t, err)
+				row += fmt.Sprintf("%s=%v ", field, val)
+			}
+			rows = append(rows, row)
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	// Both with and without the join condition's filter, and with the inputs split into temp tables
+	for _, pred := range []*query.Predicate{predicate, nil} {
+		var expected []string
+		if pred != nil {
+			expected = readAll(NewSelectPlan(NewProductPlan(students, courses), pred))
+		} else {
+			onlyJoin := query.NewPredicate(*query.NewTerm(*query.NewFieldNameExpression("id"), *query.NewFieldNameExpression("student_id")))
+			expected = readAll(NewSelectPlan(NewProductPlan(students, courses), onlyJoin))
+		}
+		require.NotEmpty(t, expected)
+
+		for _, maxRecords := range []int{HashJoinMaxRecords, 1} {
+			var joined Plan = NewHashJoinPlanWithLimit(tx, students, courses, "id", "student_id", maxRecords)
+			if pred != nil {
+				joined = NewSelectPlan(joined, pred)
+			}
+			assert.Equal(t, expected, readAll(joined), "maxRecords=%d", maxRecords)
+		}
+	}
+}
+
+func TestPlanner_ChoosesHashJoinForLargeJoins(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE customers (cid INT, cname VARCHAR(10))", tx)
+	require.NoError(t, err)
+	_, err = planner.ExecuteUpdate("CREATE TABLE purchases (buyer INT, amount INT)", tx)
+	require.NoError(t, err)
+
+	// Load the records directly so that the statistics reflect them
+	load := func(tableName string, n int, set func(ts *table.TableScan, i int)) {
+		layout, err := md.GetTableLayout(tableName, tx)
+		require.NoError(t, err)
+		ts, err := table.NewTableScan(tx, layout, tableName)
+		require.NoError(t, err)
+		defer ts.Close()
+		for i := range n {
+			require.NoError(t, ts.Insert())
+			set(ts, i)
+		}
+	}
+	load("customers", 150, func(ts *table.TableScan, i int) {
+		require.NoError(t, ts.SetInt("cid", i))
+		require.NoError(t, ts.SetString("cname", fmt.Sprintf("c%d", i)))
+	})
+	load("purchases", 300, func(ts *table.TableScan, i int) {
+		require.NoError(t, ts.SetInt("buyer", i%150))
+		require.NoError(t, ts.SetInt("amount", i))
+	})
+
+	plan, err := planner.CreatePlan("SELECT cname, amount FROM customers, purchases WHERE cid = buyer", tx)
+	require.NoError(t, err)
+	assert.True(t, containsPlan[*HashJoinPlan](plan), "Large equi-join should use a hash join")
+
+	s, err := plan.Open()
+	require.NoError(t, err)
+	count := 0
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		amount, err := s.GetInt("amount")
+		require.NoError(t, err)
+		cname, err := s.GetString("cname")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("c%d", amount%150), cname)
+		count++
+	}
+	s.Close()
+	assert.Equal(t, 300, count)
+
+	// A join without an equality stays a product
+	plan, err = planner.CreatePlan("SELECT cname, amount FROM customers, purchases WHERE cid > buyer", tx)
+	require.NoError(t, err)
+	assert.False(t, containsPlan[*HashJoinPlan](plan))
+
+	// With an index on the join field the hash join isn't used
+	_, err = planner.ExecuteUpdate("CREATE INDEX purchases_buyer_idx ON purchases (buyer)", tx)
+	require.NoError(t, err)
+	plan, err = planner.CreatePlan("SELECT cname, amount FROM customers, purchases WHERE cid = buyer", tx)
+	require.NoError(t, err)
+	assert.False(t, containsPlan[*HashJoinPlan](plan))
+}
+
+// containsPlan checks if a plan of type T appears in the plan tree.
+func containsPlan[T Plan](plan Plan) bool {
+	if _, ok := plan.(T); ok {
+		return true
+	}
+	switch p := plan.(type) {
+	case *ProjectPlan:
+		return containsPlan[T](p.p)
+	case *SelectPlan:
+		return containsPlan[T](p.p)
+	case *ExtendPlan:
+		return containsPlan[T](p.p)
+	case *ProductPlan:
+		return containsPlan[T](p.p1) || containsPlan[T](p.p2)
+	case *HashJoinPlan:
+		return containsPlan[T](p.p1) || containsPlan[T](p.p2)
+	case *GroupByPlan:
+		return containsPlan[T](p.p)
+	}
+	return false
+}
+
+func TestPlanner_AmbiguousColumn(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE authors (id INT, author VARCHAR(20))",
+		"CREATE TABLE books (id INT, author_id INT, title VARCHAR(20))",
+		"INSERT INTO authors (id, author) VALUES (1, 'Austen')",
+		"INSERT INTO books (id, author_id, title) VALUES (10, 1, 'Emma')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// Both tables have an id field
+	for _, sql := range []string{
+		"SELECT id, title FROM authors, books WHERE id = author_id",
+		"SELECT title FROM authors, books WHERE id = author_id",
+		"SELECT title, id + 1 FROM authors, books",
+		"SELECT author, COUNT(id) FROM authors, books GROUP BY author",
+		"SELECT id FROM authors, books GROUP BY id",
+	} {
+		_, err := planner.CreatePlan(sql, tx)
+		require.Error(t, err, sql)
+		assert.Contains(t, err.Error(), "ambiguous column: id", sql)
+	}
+
+	// Fields only one table has are fine, and so is id on a single table
+	for _, sql := range []string{
+		"SELECT author, title FROM authors, books WHERE author_id = 1",
+		"SELECT id, author FROM authors",
+	} {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err, sql)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		require.NoError(t, s.BeforeFirst())
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		assert.True(t, hasNext, sql)
+		s.Close()
+	}
+}
+
+func TestPlanner_UnknownColumn(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE books (id INT, author_id INT, title VARCHAR(20))",
+		"INSERT INTO books (id, author_id, title) VALUES (10, 1, 'Emma')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// The projected fields are checked when the plan is created, not when it is read
+	for sql, column := range map[string]string{
+		"SELECT id, price FROM books":                 "price",
+		"SELECT price FROM books WHERE id = 10":       "price",
+		"SELECT title, price * 2 AS total FROM books": "price",
+	} {
+		plan, err := planner.CreatePlan(sql, tx)
+		assert.Nil(t, plan, sql)
+		assert.EqualError(t, err, "unknown column: "+column, sql)
+	}
+}
+
+func TestPlanner_TypeMismatch(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20), age INT)",
+		"CREATE TABLE courses (id INT, title VARCHAR(20))",
+		"INSERT INTO students (id, name, age) VALUES (1, 'Alice', 20)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// Comparisons between numbers and strings fail when planned instead of never matching
+	for sql, expected := range map[string]string{
+		"SELECT id FROM students WHERE age = 'abc'":                         "type mismatch: cannot compare age (int) with 'abc' (string)",
+		"SELECT id FROM students WHERE name > 5":                            "type mismatch: cannot compare name (string) with 5 (int)",
+		"SELECT id FROM students WHERE id = 1 AND age IN (20, '21')":        "type mismatch: cannot compare age (int) with '21'",
+		"SELECT title FROM students, courses WHERE name = courses.id":       "type mismatch: cannot compare name (string) with courses.id (int)",
+		"SELECT age, COUNT(id) FROM students GROUP BY age HAVING age = 'x'": "type mismatch: cannot compare age (int) with 'x' (string)",
+	} {
+		_, err := planner.CreatePlan(sql, tx)
+		assert.ErrorIs(t, err, query.ErrTypeMismatch, sql)
+		assert.EqualError(t, err, expected, sql)
+	}
+	for _, sql := range []string{
+		"UPDATE students SET age = 21 WHERE name = 1",
+		"DELETE FROM students WHERE age LIKE '2%'",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		assert.ErrorIs(t, err, query.ErrTypeMismatch, sql)
+	}
+
+	// Nothing was changed
+	plan, err := planner.CreatePlan("SELECT age FROM students WHERE name = 'Alice'", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	age, err := s.GetInt("age")
+	require.NoError(t, err)
+	assert.Equal(t, 20, age)
+}
+
+func TestPlanner_QualifiedFields(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE authors (id INT, name VARCHAR(20))",
+		"CREATE TABLE books (id INT, author_id INT, name VARCHAR(20))",
+		"INSERT INTO authors (id, name) VALUES (1, 'Austen')",
+		"INSERT INTO authors (id, name) VALUES (2, 'Bronte')",
+		"INSERT INTO books (id, author_id, name) VALUES (10, 1, 'Emma')",
+		"INSERT INTO books (id, author_id, name) VALUES (11, 1, 'Persuasion')",
+		"INSERT INTO books (id, author_id, name) VALUES (12, 2, 'Villette')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	readRows := func(plan Plan) []string {
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.BeforeFirst())
+		rows := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			row := ""
+			for _, field := range plan.Schema().Fields() {
+				val, err := s.GetValue(field)
+				require.NoError(t, err)
+				if c, ok := val.(query.Constant); ok {
+					val = c.String()
+				}
+				row += fmt.Sprintf("%s=%v ", field, val)
+			}
+			rows = append(rows, row)
+		}
+		sort.Strings(rows)
+		return rows
+	}
+
+	plan, err := planner.CreatePlan("SELECT authors.name, books.name, books.id FROM authors, books WHERE authors.id = books.author_id AND books.id > 10", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"authors.name", "books.name", "books.id"}, plan.Schema().Fields())
+	assert.Equal(t, []string{
+		"authors.name=Austen books.name=Persuasion books.id=11 ",
+		"authors.name=Bronte books.name=Villette books.id=12 ",
+	}, readRows(plan))
+
+	// The same join evaluated with a hash join
+	authors, err := NewTablePlan("authors", tx, md)
+	require.NoError(t, err)
+	books, err := NewTablePlan("books", tx, md)
+	require.NoError(t, err)
+	for _, maxRecords := range []int{HashJoinMaxRecords, 1} {
+		joined, err := NewProjectPlan(NewHashJoinPlanWithLimit(tx, authors, books, "authors.id", "books.author_id", maxRecords), []string{"authors.name", "books.name"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"authors.name=Austen books.name=Emma ",
+			"authors.name=Austen books.name=Persuasion ",
+			"authors.name=Bronte books.name=Villette ",
+		}, readRows(joined), "maxRecords=%d", maxRecords)
+	}
+
+	// Qualified names work on a single table, grouped and in expressions
+	plan, err = planner.CreatePlan("SELECT books.author_id, COUNT(books.id) FROM books WHERE books.id >= 11 GROUP BY books.author_id", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"books.author_id=1 count(books.id)=1 ",
+		"books.author_id=2 count(books.id)=1 ",
+	}, readRows(plan))
+
+	plan, err = planner.CreatePlan("SELECT books.id * 2 FROM books WHERE books.name = 'Emma'", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"books.id * 2=20 "}, readRows(plan))
+
+	// Unqualified shared fields are still ambiguous, and qualifiers must name a table of the query
+	_, err = planner.CreatePlan("SELECT name FROM authors, books WHERE authors.id = books.author_id", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ambiguous column: name")
+	_, err = planner.CreatePlan("SELECT authors.name FROM authors WHERE books.id = 1", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown column: books.id")
+
+	// CREATE TABLE AS names the columns after their fields
+	_, err = planner.ExecuteUpdate("CREATE TABLE titles AS SELECT authors.name, books.id FROM authors, books WHERE authors.id = books.author_id", tx)
+	require.NoError(t, err)
+	layout, err := md.GetTableLayout("titles", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name", "id"}, layout.GetSchema().Fields())
+	_, err = planner.ExecuteUpdate("CREATE TABLE names AS SELECT authors.name, books.name FROM authors, books", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate column: name")
+}
+
+func TestPlanner_QuotedIdentifiers(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		`CREATE TABLE "Order Items" ("Select" INT, "Name" VARCHAR(20), name VARCHAR(20))`,
+		`INSERT INTO "Order Items" ("Select", "Name", name) VALUES (1, 'Upper', 'lower')`,
+		`INSERT INTO "Order Items" ("Select", "Name", name) VALUES (2, '50%_off', 'x')`,
+		`CREATE VIEW "Big Orders" AS SELECT "Select", "Name" FROM "Order Items" WHERE "Select" > 1`,
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err, sql)
+	}
+
+	// The catalog holds the names as written
+	tables, err := md.ListTables(tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Order Items"}, tables)
+	layout, err := md.GetTableLayout("Order Items", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Select", "Name", "name"}, layout.GetSchema().Fields())
+	viewDef, err := md.GetViewDef("Big Orders", tx)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "Select", "Name" FROM "Order Items" WHERE "Select" > 1`, viewDef)
+
+	values := func(sql string, field string) []string {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err, sql)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		result := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			val, err := s.GetValue(field)
+			require.NoError(t, err)
+			if c, ok := val.(query.Constant); ok {
+				val = c.String()
+			}
+			result = append(result, fmt.Sprint(val))
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	// Quoted names keep their case, so "Name" and name are different fields
+	assert.Equal(t, []string{"Upper"}, values(`SELECT "Name" FROM "Order Items" WHERE "Select" = 1`, "Name"))
+	assert.Equal(t, []string{"lower"}, values(`SELECT name FROM "Order Items" WHERE "Select" = 1`, "name"))
+	assert.Equal(t, []string{"4"}, values(`SELECT "Select" * 2 FROM "Order Items" WHERE "Select" = 2`, `"Select" * 2`))
+
+	// An unquoted name is read in lowercase, so it doesn't find the table
+	_, err = planner.CreatePlan(`SELECT name FROM Order_Items`, tx)
+	assert.Error(t, err)
+
+	// ESCAPE makes the wildcards of the pattern literal
+	assert.Equal(t, []string{"50%_off"}, values(`SELECT "Name" FROM "Order Items" WHERE "Name" LIKE '50#%#_%' ESCAPE '#'`, "Name"))
+	assert.Empty(t, values(`SELECT "Name" FROM "Order Items" WHERE "Name" LIKE '50#%#_' ESCAPE '#'`, "Name"))
+}
+
+func TestPlanner_TableWildcard(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20))",
+		"CREATE TABLE enrollments (student_id INT, course VARCHAR(20))",
+		"INSERT INTO students (id, name) VALUES (1, 'Ada')",
+		"INSERT INTO students (id, name) VALUES (2, 'Grace')",
+		"INSERT INTO enrollments (student_id, course) VALUES (1, 'math')",
+		"INSERT INTO enrollments (student_id, course) VALUES (2, 'physics')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	plan, err := planner.CreatePlan("SELECT students.*, enrollments.course FROM students, enrollments WHERE students.id = enrollments.student_id ORDER BY students.id", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"students.id", "students.name", "enrollments.course"}, plan.Schema().Fields())
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	rows := [][]string{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		row := []string{}
+		for _, field := range plan.Schema().Fields() {
+			val, err := s.GetValue(field)
+			require.NoError(t, err)
+			if c, ok := val.(query.Constant); ok {
+				val = c.String()
+			}
+			row = append(row, fmt.Sprint(val))
+		}
+		rows = append(rows, row)
+	}
+	assert.Equal(t, [][]string{{"1", "Ada", "math"}, {"2", "Grace", "physics"}}, rows)
+
+	// An alias names the table, and only a table of the query can be expanded
+	plan, err = planner.CreatePlan("SELECT e.*, s.name FROM students s, enrollments e WHERE s.id = e.student_id", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"e.student_id", "e.course", "s.name"}, plan.Schema().Fields())
+	_, err = planner.CreatePlan("SELECT courses.* FROM students", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown table: courses")
+	_, err = planner.CreatePlan("SELECT students.* FROM students s", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown table: students")
+}
+
+func TestPlanner_QueryCache(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	countRecords := func(plan Plan) int {
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		count, err := countScanResults(s)
+		require.NoError(t, err)
+		return count
+	}
+	cache := NewQueryCache(2)
+	planner.SetQueryCache(cache)
+	for _, sql := range []string{
+		"CREATE TABLE events (id INT, day INT, note VARCHAR(300))",
+		"CREATE TABLE people (id INT)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	for i := 1; i <= 50; i++ {
+		_, err := planner.ExecuteUpdate(fmt.Sprintf("INSERT INTO events (id, day, note) VALUES (%d, %d, 'note')", i, i%7), tx)
+		require.NoError(t, err)
+	}
+
+	// The second run of a query, even laid out differently, is taken from the cache
+	const sql = "SELECT id, note FROM events WHERE id = 7"
+	_, err := planner.CreatePlan(sql, tx)
+	require.NoError(t, err)
+	plan, err := planner.CreatePlan("SELECT id,  note -- with its note\n FROM events WHERE id = 7;", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Hits())
+	assert.Equal(t, 1, cache.Misses())
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, 1, countRecords(plan))
+
+	// Quoted text is part of the key as it is
+	_, err = planner.CreatePlan("SELECT id FROM events WHERE note = 'a  b'", tx)
+	require.NoError(t, err)
+	_, err = planner.CreatePlan("SELECT id FROM events WHERE note = 'a b'", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Hits())
+
+	// The least recently used query made room for the last one
+	_, err = planner.CreatePlan(sql, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Hits())
+	assert.Equal(t, 2, cache.Len())
+
+	// A query with a subquery isn't cached
+	_, err = planner.CreatePlan("SELECT id FROM events WHERE id IN (SELECT id FROM people)", tx)
+	require.NoError(t, err)
+	_, err = planner.CreatePlan("SELECT id FROM events WHERE id IN (SELECT id FROM people)", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Hits())
+
+	// An index on the table drops its queries, so the query is parsed again
+	_, err = planner.ExecuteUpdate("CREATE INDEX events_id_idx ON events (id)", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cache.Len())
+	misses := cache.Misses()
+	plan, err = planner.CreatePlan(sql, tx)
+	require.NoError(t, err)
+	assert.Equal(t, misses+1, cache.Misses())
+	assert.Equal(t, 1, countRecords(plan))
+
+	// DDL on another table leaves them cached
+	_, err = planner.ExecuteUpdate("CREATE INDEX people_id_idx ON people (id)", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+}
+
+// TestPlanner_TrailingTokens checks that a statement with tokens after its end fails rather
+// than running without them
+func TestPlanner_TrailingTokens(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE items (id INT, name VARCHAR(10));",
+		"INSERT INTO items (id, name) VALUES (1, 'a')",
+		"INSERT INTO items (id, name) VALUES (3, 'c')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	_, err := planner.ExecuteUpdate("DELETE FROM items WHERE id = 1 OR id = 3", tx)
+	assert.ErrorIs(t, err, parse.ErrBadSyntax)
+	assert.EqualError(t, err, "bad syntax: unexpected 'or' at position 32")
+	_, err = planner.CreatePlan("SELECT name FROM items WHERE id = 1 OR id = 3", tx)
+	assert.ErrorIs(t, err, parse.ErrBadSyntax)
+
+	plan, err := planner.CreatePlan("SELECT id FROM items;", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	n, err := countScanResults(s)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
@@ -12,19 +12,19 @@ var (
 
 // ProductPlan is the Plan for a Cartesian product (cross join).
 type ProductPlan struct {
-	p1     Plan
-	p2     Plan
+	p1 Plan
+	p2 Plan
+	// schema is the combined schema of both plans, built by the first call to Schema
 	schema *record.Schema
 }
 
+// NewProductPlan creates the product of two plans. The planner builds a product for each join
+// order it considers and keeps only the cheapest, so the combined schema, whose size grows with
+// the number of tables joined, is only built once the plan's schema is asked for.
 func NewProductPlan(p1 Plan, p2 Plan) *ProductPlan {
-	schema := record.NewSchema()
-	schema.CopyAll(p1.Schema())
-	schema.CopyAll(p2.Schema())
 	return &ProductPlan{
-		p1:     p1,
-		p2:     p2,
-		schema: schema,
+		p1: p1,
+		p2: p2,
 	}
 }
 
@@ -60,5 +60,10 @@ func (pp *ProductPlan) DistinctValues(fldname string) (int, error) {
 
 // Schema returns the combined schema of both plans.
 func (pp *ProductPlan) Schema() *record.Schema {
+	if pp.schema == nil {
+		pp.schema = record.NewSchema()
+		pp.schema.CopyAll(pp.p1.Schema())
+		pp.schema.CopyAll(pp.p2.Schema())
+	}
 	return pp.schema
 }
@@ -1,6 +1,7 @@
 package plan
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -111,3 +112,79 @@ func TestProductPlan(t *testing.T) {
 	require.NotNil(t, scan)
 	scan.Close()
 }
+
+// createJoinTables creates n tables of a few fields each and returns a TablePlan of each
+func createJoinTables(tb testing.TB, n int) ([]Plan, func()) {
+	_, tx, md, cleanup := setupTestDB(tb)
+	plans := make([]Plan, n)
+	for i := range n {
+		schema := record.NewSchema()
+		for j := range 6 {
+			schema.AddIntField(fmt.Sprintf("t%d_f%d", i, j))
+		}
+		tableName := fmt.Sprintf("t%d", i)
+		require.NoError(tb, md.CreateTable(tableName, schema, tx))
+		tablePlan, err := NewTablePlan(tableName, tx, md)
+		require.NoError(tb, err)
+		plans[i] = tablePlan
+	}
+	return plans, cleanup
+}
+
+// joinTree joins the plans like the planner does, keeping the cheaper of the two orders of each join
+func joinTree(plans []Plan) Plan {
+	result := plans[0]
+	for _, next := range plans[1:] {
+		p1 := NewProductPlan(result, next)
+		p2 := NewProductPlan(next, result)
+		if p2.BlocksAccessed() <= p1.BlocksAccessed() {
+			result = p2
+		} else {
+			result = p1
+		}
+	}
+	return result
+}
+
+func TestProductPlan_SchemaBuiltOnce(t *testing.T) {
+	plans, cleanup := createJoinTables(t, 5)
+	defer cleanup()
+
+	// Costing the join orders doesn't build any schema
+	tree := joinTree(plans).(*ProductPlan)
+	tree.BlocksAccessed()
+	tree.RecordsOutput()
+	assert.Nil(t, tree.schema)
+
+	// The schema is built once, with the schemas of the products below it
+	schema := tree.Schema()
+	assert.Len(t, schema.Fields(), 30)
+	assert.Same(t, schema, tree.Schema())
+	tree.BlocksAccessed()
+	assert.Same(t, schema, tree.Schema())
+	for p := Plan(tree); ; {
+		product, ok := p.(*ProductPlan)
+		if !ok {
+			break
+		}
+		assert.NotNil(t, product.schema)
+		if _, ok := product.p1.(*ProductPlan); ok {
+			p = product.p1
+		} else {
+			p = product.p2
+		}
+	}
+}
+
+// BenchmarkProductPlan_JoinOrder measures building the join tree of 5 tables and its schema
+func BenchmarkProductPlan_JoinOrder(b *testing.B) {
+	plans, cleanup := createJoinTables(b, 5)
+	defer cleanup()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if len(joinTree(plans).Schema().Fields()) != 30 {
+			b.Fatal("wrong number of fields")
+		}
+	}
+}
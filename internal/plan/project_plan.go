@@ -1,6 +1,8 @@
 package plan
 
 import (
+	"fmt"
+
 	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
@@ -11,20 +13,45 @@ var (
 )
 
 // ProjectPlan is the Plan for a projection (SELECT fields).
+// Fields can also be computed by expressions, e.g. SELECT salary * 2 AS bonus.
 type ProjectPlan struct {
-	p      Plan
-	schema *record.Schema
+	p           Plan
+	expressions map[string]query.Expression
+	schema      *record.Schema
+}
+
+func NewProjectPlan(p Plan, fieldList []string) (*ProjectPlan, error) {
+	return NewProjectPlanWithExpressions(p, fieldList, nil)
 }
 
-func NewProjectPlan(p Plan, fieldList []string) *ProjectPlan {
+// NewProjectPlanWithExpressions creates a projection whose fields include computed ones,
+// mapped to their expression in expressions by their name. Every other field, and every
+// field an expression reads, must be in the schema of the underlying plan.
+func NewProjectPlanWithExpressions(p Plan, fieldList []string, expressions map[string]*query.Expression) (*ProjectPlan, error) {
 	schema := record.NewSchema()
+	computed := map[string]query.Expression{}
 	for _, fldname := range fieldList {
+		if expr := expressions[fldname]; expr != nil {
+			for _, field := range expr.FieldNames() {
+				if !p.Schema().HasField(field) {
+					return nil, fmt.Errorf("unknown column: %s", field)
+				}
+			}
+			fieldType, length := expr.FieldInfo(p.Schema())
+			schema.AddField(fldname, fieldType, length)
+			computed[fldname] = *expr
+			continue
+		}
+		if !p.Schema().HasField(fldname) {
+			return nil, fmt.Errorf("unknown column: %s", fldname)
+		}
 		schema.Copy(p.Schema(), fldname)
 	}
 	return &ProjectPlan{
-		p:      p,
-		schema: schema,
-	}
+		p:           p,
+		expressions: computed,
+		schema:      schema,
+	}, nil
 }
 
 func (pp *ProjectPlan) Open() (scan.Scan, error) {
@@ -32,7 +59,7 @@ func (pp *ProjectPlan) Open() (scan.Scan, error) {
 	if err != nil {
 		return nil, err
 	}
-	return query.NewProjectScan(s, pp.schema.Fields()), nil
+	return query.NewProjectScanWithExpressions(s, pp.schema.Fields(), pp.expressions), nil
 }
 
 // BlocksAccessed returns the same as the underlying plan (projection doesn't change block access).
@@ -45,8 +72,12 @@ func (pp *ProjectPlan) RecordsOutput() int {
 	return pp.p.RecordsOutput()
 }
 
-// DistinctValues delegates to the underlying plan.
+// DistinctValues delegates to the underlying plan. A computed field is assumed
+// to have a different value for every record.
 func (pp *ProjectPlan) DistinctValues(fldname string) (int, error) {
+	if _, ok := pp.expressions[fldname]; ok {
+		return pp.p.RecordsOutput(), nil
+	}
 	return pp.p.DistinctValues(fldname)
 }
 
@@ -26,7 +26,8 @@ func TestProjectPlan(t *testing.T) {
 	tablePlan, err := NewTablePlan(tableName, tx, md)
 	require.NoError(t, err)
 	fieldList := []string{"id", "name"}
-	projectPlan := NewProjectPlan(tablePlan, fieldList)
+	projectPlan, err := NewProjectPlan(tablePlan, fieldList)
+	require.NoError(t, err)
 
 	// Test Schema - should only have projected fields
 	projectedSchema := projectPlan.Schema()
@@ -59,4 +60,8 @@ func TestProjectPlan(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, scan)
 	scan.Close()
+
+	// Projecting a field the table doesn't have fails
+	_, err = NewProjectPlan(tablePlan, []string{"id", "phone"})
+	assert.EqualError(t, err, "unknown column: phone")
 }
@@ -0,0 +1,176 @@
+package plan
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/yashagw/cranedb/internal/parse/parserdata"
+	"github.com/yashagw/cranedb/internal/query"
+)
+
+// QueryCache keeps the parsed form of recently run queries, keyed by their normalized SQL
+// text, so that running a query again skips the lexer and the parser. Plans aren't kept,
+// since each one belongs to the transaction it was created in and picks its indexes from
+// the statistics of the moment. The entries of a table are dropped when DDL changes its
+// fields or indexes. Once the cache holds its maximum number of queries, the least recently
+// used one makes room for a new one. A QueryCache is safe for concurrent use.
+type QueryCache struct {
+	maxEntries int
+	// order holds the entries from the most recently used to the least
+	order   *list.List
+	entries map[string]*list.Element
+	hits    int
+	misses  int
+	mu      sync.Mutex
+}
+
+type cacheEntry struct {
+	key       string
+	queryData *parserdata.QueryData
+}
+
+// NewQueryCache creates a cache holding up to maxEntries queries.
+func NewQueryCache(maxEntries int) *QueryCache {
+	return &QueryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// get returns the parsed form of the query, or nil if it isn't cached.
+func (c *QueryCache) get(sql string) *parserdata.QueryData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[normalizeSQL(sql)]
+	if !ok {
+		c.misses++
+		return nil
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).queryData
+}
+
+// put caches the parsed form of the query. A query with subqueries isn't cached, since
+// planning binds its subqueries to the transaction running it.
+func (c *QueryCache) put(sql string, queryData *parserdata.QueryData) {
+	if c.maxEntries <= 0 || hasSubqueries(queryData) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := normalizeSQL(sql)
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).queryData = queryData
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, queryData: queryData})
+	if c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Invalidate drops the queries that read the table.
+func (c *QueryCache) Invalidate(tableName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		entry := elem.Value.(*cacheEntry)
+		for _, name := range entry.queryData.Tables() {
+			if name == tableName {
+				c.order.Remove(elem)
+				delete(c.entries, entry.key)
+				break
+			}
+		}
+		elem = next
+	}
+}
+
+// Len returns the number of cached queries.
+func (c *QueryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Hits returns how many queries were found in the cache, and so weren't parsed again.
+func (c *QueryCache) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
+
+// Misses returns how many queries weren't found in the cache and had to be parsed.
+func (c *QueryCache) Misses() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.misses
+}
+
+// hasSubqueries reports whether the WHERE or HAVING clause or an expression of the select
+// list of the query holds a subquery.
+func hasSubqueries(queryData *parserdata.QueryData) bool {
+	for _, pred := range []*query.Predicate{queryData.Predicate(), queryData.Having()} {
+		if pred == nil {
+			continue
+		}
+		if len(pred.Subqueries()) > 0 || len(pred.InSubqueries()) > 0 {
+			return true
+		}
+		for _, term := range pred.GetTerms() {
+			if term.Subquery() != nil {
+				return true
+			}
+		}
+	}
+	for _, field := range queryData.Fields() {
+		if expr := queryData.Expression(field); expr != nil && len(expr.Subqueries()) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSQL returns the statement without "--" comments, surrounding whitespace or a final
+// semicolon, and with each run of whitespace outside quotes made a single space, so that
+// statements differing only in their layout share an entry.
+func normalizeSQL(sql string) string {
+	var sb strings.Builder
+	var quote rune
+	space := false
+	runes := []rune(sql)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		if quote == 0 && ch == '-' && i+1 < len(runes) && runes[i+1] == '-' {
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			space = true
+			continue
+		}
+		if quote == 0 && unicode.IsSpace(ch) {
+			space = true
+			continue
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		switch {
+		case quote == 0 && (ch == '\'' || ch == '"'):
+			quote = ch
+		case ch == quote:
+			quote = 0
+		}
+		sb.WriteRune(ch)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(sb.String(), ";"))
+}
@@ -1,12 +1,17 @@
 package plan
 
 import (
+	"fmt"
+	"slices"
 	"sort"
+	"strings"
 
+	"github.com/yashagw/cranedb/internal/index"
 	"github.com/yashagw/cranedb/internal/metadata"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
 	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
@@ -16,40 +21,150 @@ var (
 
 type BasicQueryPlanner struct {
 	metadataManager *metadata.Manager
+	// maxRows bounds the rows the plans hold in memory, or 0 for no limit
+	maxRows int
+	// workers is the number of goroutines that aggregate a table, or 1 to aggregate serially
+	workers int
+	// updatable limits the plans to those whose scans can change the records they read
+	updatable bool
 }
 
 func NewBasicQueryPlanner(metadataManager *metadata.Manager) *BasicQueryPlanner {
 	return &BasicQueryPlanner{
 		metadataManager: metadataManager,
+		workers:         1,
 	}
 }
 
+// SetMaxRows makes the plans created from then on fail with query.ErrResultTooLarge instead of
+// holding more than maxRows rows in memory, such as the groups of a GROUP BY or the records of
+// an ORDER BY. Operators that can write their rows to temp tables, like hash joins, aren't
+// limited. 0 removes the limit.
+func (p *BasicQueryPlanner) SetMaxRows(maxRows int) {
+	p.maxRows = maxRows
+}
+
+// WithWorkers returns a copy of the planner whose plans aggregate a single table with up to
+// workers goroutines, each reading a part of its blocks. 1 aggregates serially.
+func (p *BasicQueryPlanner) WithWorkers(workers int) *BasicQueryPlanner {
+	planner := *p
+	planner.workers = max(workers, 1)
+	return &planner
+}
+
+// forUpdate returns a copy of the planner that uses an index only to look up a single value,
+// with an IndexSelectPlan, whose scan can change the records it reads.
+func (p *BasicQueryPlanner) forUpdate() *BasicQueryPlanner {
+	planner := *p
+	planner.updatable = true
+	return &planner
+}
+
 func (p *BasicQueryPlanner) CreatePlan(queryData *parserdata.QueryData, tx *transaction.Transaction) (Plan, error) {
+	// Subqueries in expressions and IN terms are run first, so that their values can be used
+	// like constants
+	queryData, err := p.substituteSubqueries(queryData, tx)
+	if err != nil {
+		return nil, err
+	}
 	tables := queryData.Tables()
+
+	// Conditions on constants alone are true for every record or for none of them
+	alwaysFalse := false
+	if predicate := queryData.Predicate(); predicate != nil {
+		folded, satisfiable := predicate.Fold()
+		if satisfiable {
+			queryData = queryData.WithPredicate(folded)
+		} else {
+			alwaysFalse = true
+		}
+	}
 	predicate := queryData.Predicate()
 
+	// A bare COUNT(*) is answered from the table statistics when they are exact
+	countPlan, err := p.countFromStats(queryData, tx)
+	if err != nil {
+		return nil, err
+	}
+	if countPlan != nil {
+		return countPlan, nil
+	}
+
+	// So is a bare MIN or MAX of a field with a B-tree index, from its first or last record
+	minMaxPlan, err := p.minMaxFromIndex(queryData, tx)
+	if err != nil {
+		return nil, err
+	}
+	if minMaxPlan != nil {
+		return minMaxPlan, nil
+	}
+
 	// Phase 1: Create optimized table plans with index selection
 	tablePlans := make([]Plan, len(tables))
+	aliases := queryData.Aliases()
 	for i, tableName := range tables {
-		tablePlan, err := NewTablePlan(tableName, tx, p.metadataManager)
+		tablePlan, err := NewAliasedTablePlan(tableName, aliases[i], tx, p.metadataManager)
 		if err != nil {
 			return nil, err
 		}
+		tablePlans[i] = tablePlan
+	}
+	queryData, err = expandWildcards(queryData, tablePlans)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subqueries find out which fields they take from these tables before the
+	// predicate is split up between them
+	if predicate != nil && !alwaysFalse {
+		err = p.bindSubqueries(predicate, tablePlans, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, tableName := range tables {
+		tablePlan := tablePlans[i]
 
 		// Apply index optimization for this table
-		if predicate != nil {
-			optimizedPlan, err := p.optimizeTableWithIndex(tablePlan, tableName, predicate, tx)
+		if predicate != nil && !alwaysFalse {
+			// A query over one table may be answered from an index alone
+			var neededFields []string
+			if len(tables) == 1 {
+				neededFields = referencedFields(queryData)
+			}
+			optimizedPlan, err := p.optimizeTableWithIndex(tablePlan, tableName, predicate, neededFields, tx)
 			if err != nil {
 				return nil, err
 			}
 			tablePlans[i] = optimizedPlan
-		} else {
-			tablePlans[i] = tablePlan
 		}
 	}
 
+	err = checkFieldReferences(queryData, tablePlans)
+	if err != nil {
+		return nil, err
+	}
+	if predicate != nil {
+		err = predicate.CheckTypes(combinedSchema(tablePlans))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// No table is read for a predicate that can't be satisfied
+	if alwaysFalse {
+		for i := range tablePlans {
+			tablePlans[i] = NewEmptyPlan(tablePlans[i].Schema())
+		}
+		predicate = nil
+	}
+
 	// Phase 2: Optimize join order
-	plan := p.optimizeJoinOrder(tablePlans, predicate)
+	plan, err := p.optimizeJoinOrder(tables, aliases, tablePlans, predicate, tx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Phase 3: Apply remaining predicates (both table-specific and join predicates)
 	// TODO: apply only the join predicates
@@ -58,15 +173,585 @@ func (p *BasicQueryPlanner) CreatePlan(queryData *parserdata.QueryData, tx *tran
 		plan = NewSelectPlan(plan, predicate)
 	}
 
-	// Phase 4: Project the required fields
-	plan = NewProjectPlan(plan, queryData.Fields())
+	// Phase 4: Group the records and filter the groups
+	if queryData.IsGrouped() {
+		groupPlan := NewGroupByPlanWithLimit(plan, queryData.GroupFields(), queryData.Aggregates(), p.maxRows)
+		plan = p.parallelGroupBy(groupPlan)
+		err := checkGroupedFields(queryData, plan.Schema())
+		if err != nil {
+			return nil, err
+		}
+		if having := queryData.Having(); having != nil {
+			err := having.CheckTypes(plan.Schema())
+			if err != nil {
+				return nil, err
+			}
+			plan = NewSelectPlan(plan, having)
+		}
+	}
+
+	// Phase 5: Sort the records, before the projection drops the fields the keys may use
+	if orderBy := queryData.OrderBy(); len(orderBy) > 0 {
+		err := checkOrderBy(queryData, plan.Schema())
+		if err != nil {
+			return nil, err
+		}
+		plan = NewSortPlan(plan, orderBy, p.maxRows)
+	}
+
+	// Phase 6: Project the required fields, computing expression columns
+	expressions := map[string]*query.Expression{}
+	for _, field := range queryData.Fields() {
+		if expr := queryData.Expression(field); expr != nil {
+			expressions[field] = expr
+		}
+	}
+	projectPlan, err := NewProjectPlanWithExpressions(plan, queryData.Fields(), expressions)
+	if err != nil {
+		return nil, err
+	}
+	return projectPlan, nil
+}
+
+// parallelGroupBy returns a plan computing the groups of the group by plan with the planner's
+// workers when its input is a scan of one table, filtered or not. Otherwise, and when there
+// is a single worker, the group by plan is returned unchanged. A filter with an EXISTS
+// subquery keeps the plan serial, since the subquery runs within the scan.
+func (p *BasicQueryPlanner) parallelGroupBy(gp *GroupByPlan) Plan {
+	if p.workers <= 1 {
+		return gp
+	}
+	switch input := gp.p.(type) {
+	case *TablePlan:
+		return NewParallelGroupByPlan(gp, input, nil, p.workers)
+	case *SelectPlan:
+		tablePlan, ok := input.p.(*TablePlan)
+		if !ok {
+			return gp
+		}
+		for _, term := range input.pred.GetTerms() {
+			if term.Subquery() != nil {
+				return gp
+			}
+		}
+		return NewParallelGroupByPlan(gp, tablePlan, input.pred, p.workers)
+	}
+	return gp
+}
+
+// countFromStats returns a plan producing the record count of the table for a query of
+// the form SELECT COUNT(*) FROM t, taken from the table's statistics instead of a scan.
+// Returns nil if the query has any other shape or the statistics are stale, in which
+// case the count is computed by the regular plan. The table is share locked first, as a
+// scan would, so the count can't change under the transaction.
+func (p *BasicQueryPlanner) countFromStats(queryData *parserdata.QueryData, tx *transaction.Transaction) (Plan, error) {
+	tables := queryData.Tables()
+	aggregates := queryData.Aggregates()
+	fields := queryData.Fields()
+	if len(tables) != 1 || queryData.Predicate() != nil || len(queryData.GroupFields()) > 0 || queryData.Having() != nil {
+		return nil, nil
+	}
+	if len(aggregates) != 1 || aggregates[0].Name() != "count" || aggregates[0].Field() != "*" {
+		return nil, nil
+	}
+	if len(fields) != 1 || fields[0] != aggregates[0].FieldName() || queryData.Expression(fields[0]) != nil {
+		return nil, nil
+	}
+
+	tableName := tables[0]
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.SLockFile(tableName + ".tbl")
+	if err != nil {
+		return nil, err
+	}
+	statInfo, err := p.metadataManager.GetStatInfo(tableName, layout, tx)
+	if err != nil {
+		return nil, err
+	}
+	if !p.metadataManager.IsStatInfoFresh(tableName, statInfo) {
+		return nil, nil
+	}
+	count := query.NewIntConstant(statInfo.RecordsOutput())
+	return NewConstantPlan(fields, []query.Constant{*count}), nil
+}
+
+// minMaxFromIndex returns a plan producing the value of a query of the form SELECT MIN(f)
+// FROM t or SELECT MAX(f) FROM t, read from a B-tree index on f instead of a scan: the value
+// of its first record for MIN and of its last for MAX. Returns nil if the query has any
+// other shape, f has no B-tree index, or the index is empty, in which case the value is
+// computed by the regular plan.
+func (p *BasicQueryPlanner) minMaxFromIndex(queryData *parserdata.QueryData, tx *transaction.Transaction) (Plan, error) {
+	tables := queryData.Tables()
+	aggregates := queryData.Aggregates()
+	fields := queryData.Fields()
+	if len(tables) != 1 || queryData.Predicate() != nil || len(queryData.GroupFields()) > 0 || queryData.Having() != nil {
+		return nil, nil
+	}
+	if len(aggregates) != 1 || (aggregates[0].Name() != "min" && aggregates[0].Name() != "max") {
+		return nil, nil
+	}
+	if len(fields) != 1 || fields[0] != aggregates[0].FieldName() || queryData.Expression(fields[0]) != nil {
+		return nil, nil
+	}
+
+	indexes, err := p.metadataManager.GetIndexInfo(tables[0], tx)
+	if err != nil {
+		return nil, err
+	}
+	indexInfo, exists := indexes[aggregates[0].Field()]
+	if !exists || indexInfo.IndexType() != index.BTreeType {
+		return nil, nil
+	}
+	idx, err := indexInfo.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+	rangeIndex, ok := idx.(index.RangeIndex)
+	if !ok {
+		return nil, nil
+	}
+
+	var value any
+	found := false
+	if aggregates[0].Name() == "max" {
+		value, found, err = rangeIndex.MaxValue()
+	} else {
+		err = rangeIndex.BeforeRange(index.Range{})
+		if err == nil {
+			found, err = rangeIndex.Next()
+		}
+		if err == nil && found {
+			value, err = rangeIndex.GetDataVal()
+		}
+	}
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var constant *query.Constant
+	switch v := value.(type) {
+	case int:
+		constant = query.NewIntConstant(v)
+	case int64:
+		constant = query.NewLongConstant(v)
+	default:
+		constant = query.NewStringConstant(v.(string))
+	}
+	return NewConstantPlan(fields, []query.Constant{*constant}), nil
+}
+
+// checkFieldReferences checks that every field the query refers to can be told apart.
+// A field that more than one of the query's tables has must be qualified by its table
+// (e.g. students.id), and a qualified field must belong to one of the tables.
+func checkFieldReferences(queryData *parserdata.QueryData, tablePlans []Plan) error {
+	tablesWithField := map[string]int{}
+	for _, tablePlan := range tablePlans {
+		for _, field := range tablePlan.Schema().Fields() {
+			tablesWithField[field]++
+		}
+	}
+
+	for _, field := range referencedFields(queryData) {
+		if table, _ := record.SplitFieldName(field); table != "" {
+			known := false
+			for _, tablePlan := range tablePlans {
+				if tablePlan.Schema().HasField(field) {
+					known = true
+					break
+				}
+			}
+			if !known {
+				return fmt.Errorf("unknown column: %s", field)
+			}
+			continue
+		}
+		if tablesWithField[field] > 1 {
+			return fmt.Errorf("ambiguous column: %s", field)
+		}
+	}
+	return nil
+}
+
+// expandWildcards returns the query with each table's * in its select list (e.g. students.*)
+// replaced by the table's fields, qualified by the name the query refers to the table by.
+func expandWildcards(queryData *parserdata.QueryData, tablePlans []Plan) (*parserdata.QueryData, error) {
+	fields := queryData.Fields()
+	if !slices.ContainsFunc(fields, func(field string) bool { return strings.HasSuffix(field, ".*") }) {
+		return queryData, nil
+	}
+
+	aliases := queryData.Aliases()
+	expanded := []string{}
+	for _, field := range fields {
+		table, found := strings.CutSuffix(field, ".*")
+		if !found || queryData.Expression(field) != nil {
+			expanded = append(expanded, field)
+			continue
+		}
+		i := slices.Index(aliases, table)
+		if i < 0 {
+			return nil, fmt.Errorf("unknown table: %s", table)
+		}
+		for _, name := range tablePlans[i].Schema().Fields() {
+			expanded = append(expanded, table+"."+name)
+		}
+	}
+	return queryData.WithFields(expanded), nil
+}
+
+// combinedSchema returns a schema holding the fields of all the plans
+func combinedSchema(plans []Plan) *record.Schema {
+	schema := record.NewSchema()
+	for _, p := range plans {
+		schema.CopyAll(p.Schema())
+	}
+	return schema
+}
+
+// substituteSubqueries returns the query with the subqueries in the expressions and IN terms
+// of its WHERE and HAVING clauses replaced by their values.
+func (p *BasicQueryPlanner) substituteSubqueries(queryData *parserdata.QueryData, tx *transaction.Transaction) (*parserdata.QueryData, error) {
+	result := queryData
+	if predicate := queryData.Predicate(); predicate != nil {
+		substituted, err := p.withSubqueryValues(predicate, tx)
+		if err != nil {
+			return nil, err
+		}
+		if substituted != predicate {
+			result = result.WithPredicate(substituted)
+		}
+	}
+	if having := queryData.Having(); having != nil {
+		substituted, err := p.withSubqueryValues(having, tx)
+		if err != nil {
+			return nil, err
+		}
+		if substituted != having {
+			result = result.WithHaving(substituted)
+		}
+	}
+	return result, nil
+}
+
+// withSubqueryValues returns the predicate with the subqueries in its expressions replaced by
+// their values, and those of its IN terms by the lists of values they return, or the predicate
+// itself if it has neither. Each subquery runs once and must not refer to the enclosing query.
+// One in an expression must return a single value: one column of one row.
+func (p *BasicQueryPlanner) withSubqueryValues(pred *query.Predicate, tx *transaction.Transaction) (*query.Predicate, error) {
+	values := map[*query.Subquery]query.Constant{}
+	for _, subquery := range pred.Subqueries() {
+		val, err := p.scalarValue(subquery, tx)
+		if err != nil {
+			return nil, err
+		}
+		values[subquery] = val
+	}
+	lists := map[*query.Subquery][]query.Constant{}
+	for _, subquery := range pred.InSubqueries() {
+		list, err := p.columnValues(subquery, tx)
+		if err != nil {
+			return nil, err
+		}
+		lists[subquery] = list
+	}
+
+	result := pred
+	if len(values) > 0 {
+		result = result.WithSubqueryValues(values)
+	}
+	if len(lists) > 0 {
+		result = result.WithInValues(lists)
+	}
+	return result, nil
+}
+
+// columnValues runs the subquery of an IN term and returns the values of the single column it
+// returns. They are held in memory, so there may be no more than the planner's maxRows of them.
+func (p *BasicQueryPlanner) columnValues(subquery *query.Subquery, tx *transaction.Transaction) ([]query.Constant, error) {
+	innerData, ok := subquery.Query().(*parserdata.QueryData)
+	if !ok {
+		return nil, fmt.Errorf("unsupported subquery: %s", subquery.String())
+	}
+	plan, err := p.CreatePlan(innerData, tx)
+	if err != nil {
+		return nil, err
+	}
+	fields := plan.Schema().Fields()
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("subquery %s must return one column, got %d", subquery.String(), len(fields))
+	}
+
+	s, err := plan.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	err = s.BeforeFirst()
+	if err != nil {
+		return nil, err
+	}
+	values := []query.Constant{}
+	for {
+		hasNext, err := s.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			return values, nil
+		}
+		if p.maxRows > 0 && len(values) == p.maxRows {
+			return nil, fmt.Errorf("%w: subquery %s returned more than %d rows", query.ErrResultTooLarge, subquery.String(), p.maxRows)
+		}
+		val, err := query.NewFieldNameExpression(fields[0]).Evaluate(s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, val)
+	}
+}
+
+// scalarValue runs a subquery and returns the single value it returns.
+func (p *BasicQueryPlanner) scalarValue(subquery *query.Subquery, tx *transaction.Transaction) (query.Constant, error) {
+	innerData, ok := subquery.Query().(*parserdata.QueryData)
+	if !ok {
+		return query.Constant{}, fmt.Errorf("unsupported subquery: %s", subquery.String())
+	}
+	plan, err := p.CreatePlan(innerData, tx)
+	if err != nil {
+		return query.Constant{}, err
+	}
+	fields := plan.Schema().Fields()
+	if len(fields) != 1 {
+		return query.Constant{}, fmt.Errorf("subquery %s must return one column, got %d", subquery.String(), len(fields))
+	}
+
+	s, err := plan.Open()
+	if err != nil {
+		return query.Constant{}, err
+	}
+	defer s.Close()
+	err = s.BeforeFirst()
+	if err != nil {
+		return query.Constant{}, err
+	}
+	hasNext, err := s.Next()
+	if err != nil {
+		return query.Constant{}, err
+	}
+	if !hasNext {
+		return query.Constant{}, fmt.Errorf("subquery %s returned no rows", subquery.String())
+	}
+	val, err := query.NewFieldNameExpression(fields[0]).Evaluate(s)
+	if err != nil {
+		return query.Constant{}, err
+	}
+	hasNext, err = s.Next()
+	if err != nil {
+		return query.Constant{}, err
+	}
+	if hasNext {
+		return query.Constant{}, fmt.Errorf("subquery %s returned more than one row", subquery.String())
+	}
+	return val, nil
+}
+
+// bindSubqueries binds the EXISTS subqueries of a predicate to the plans of the tables of
+// the enclosing query. A field in the WHERE clause of a subquery that none of its own tables
+// has is taken from these tables. Each time a subquery runs, it is planned again with these
+// fields replaced by their values in the current record of the enclosing query.
+func (p *BasicQueryPlanner) bindSubqueries(predicate *query.Predicate, tablePlans []Plan, tx *transaction.Transaction) error {
+	terms := predicate.GetTerms()
+	for i := range terms {
+		subquery := terms[i].Subquery()
+		if subquery == nil {
+			continue
+		}
+		innerData, ok := subquery.Query().(*parserdata.QueryData)
+		if !ok {
+			return fmt.Errorf("unsupported subquery: %s", subquery.String())
+		}
+		outerFields, err := p.outerFields(innerData, tablePlans, tx)
+		if err != nil {
+			return err
+		}
+		subquery.Bind(outerFields, func(outer scan.Scan) (bool, error) {
+			return p.exists(innerData, outerFields, outer, tx)
+		})
+	}
+	return nil
+}
+
+// outerFields returns the fields in the WHERE clause of a subquery that belong to one of
+// the tables of the enclosing query rather than to the subquery's own tables.
+func (p *BasicQueryPlanner) outerFields(innerData *parserdata.QueryData, outerPlans []Plan, tx *transaction.Transaction) ([]string, error) {
+	predicate := innerData.Predicate()
+	if predicate == nil {
+		return nil, nil
+	}
+	innerSchemas := []*record.Schema{}
+	for i, tableName := range innerData.Tables() {
+		tablePlan, err := NewAliasedTablePlan(tableName, innerData.Aliases()[i], tx, p.metadataManager)
+		if err != nil {
+			return nil, err
+		}
+		innerSchemas = append(innerSchemas, tablePlan.Schema())
+	}
+	hasField := func(schemas []*record.Schema, field string) bool {
+		for _, sch := range schemas {
+			if sch.HasField(field) {
+				return true
+			}
+		}
+		return false
+	}
+	outerSchemas := make([]*record.Schema, len(outerPlans))
+	for i, outerPlan := range outerPlans {
+		outerSchemas[i] = outerPlan.Schema()
+	}
+
+	fields := []string{}
+	terms := predicate.GetTerms()
+	for i := range terms {
+		for _, field := range terms[i].FieldNames() {
+			if !hasField(innerSchemas, field) && hasField(outerSchemas, field) && !slices.Contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// exists plans and runs a subquery with its outer fields replaced by their values in the
+// current record of outer, and reports whether it returns a row.
+func (p *BasicQueryPlanner) exists(innerData *parserdata.QueryData, outerFields []string, outer scan.Scan, tx *transaction.Transaction) (bool, error) {
+	if len(outerFields) > 0 {
+		values := map[string]query.Constant{}
+		for _, field := range outerFields {
+			val, err := query.NewFieldNameExpression(field).Evaluate(outer)
+			if err != nil {
+				return false, err
+			}
+			values[field] = val
+		}
+		innerData = innerData.WithPredicate(innerData.Predicate().WithFieldValues(values))
+	}
+
+	plan, err := p.CreatePlan(innerData, tx)
+	if err != nil {
+		return false, err
+	}
+	s, err := plan.Open()
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	err = s.BeforeFirst()
+	if err != nil {
+		return false, err
+	}
+	return s.Next()
+}
+
+// referencedFields returns the table fields the query refers to: its output columns,
+// the fields of its expressions, conditions and groups, and the fields it aggregates.
+// A field may be listed more than once.
+func referencedFields(queryData *parserdata.QueryData) []string {
+	aggregateFields := map[string]bool{}
+	for _, fn := range queryData.Aggregates() {
+		aggregateFields[fn.FieldName()] = true
+	}
+
+	referenced := []string{}
+	for _, field := range queryData.Fields() {
+		if expr := queryData.Expression(field); expr != nil {
+			referenced = append(referenced, expr.FieldNames()...)
+		} else {
+			referenced = append(referenced, field)
+		}
+	}
+	for _, pred := range []*query.Predicate{queryData.Predicate(), queryData.Having()} {
+		if pred == nil {
+			continue
+		}
+		terms := pred.GetTerms()
+		for i := range terms {
+			referenced = append(referenced, terms[i].FieldNames()...)
+		}
+	}
+	referenced = append(referenced, queryData.GroupFields()...)
+	for _, key := range queryData.OrderBy() {
+		referenced = append(referenced, key.Expression().FieldNames()...)
+	}
+	for _, fn := range queryData.Aggregates() {
+		if fn.Field() != "*" {
+			referenced = append(referenced, fn.Field())
+		}
+	}
+
+	// Aggregate columns are computed by the query, not read from a table
+	fields := []string{}
+	for _, field := range referenced {
+		if !aggregateFields[field] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// checkGroupedFields checks that a grouped query only outputs group fields, aggregates
+// and expressions over them, since other fields have no single value per group.
+func checkGroupedFields(queryData *parserdata.QueryData, groupSchema *record.Schema) error {
+	for _, field := range queryData.Fields() {
+		if expr := queryData.Expression(field); expr != nil {
+			if !expr.AppliesTo(groupSchema) {
+				return fmt.Errorf("column %s must only use GROUP BY fields and aggregate functions", field)
+			}
+			continue
+		}
+		if _, ok := groupSchema.GetFieldInfo(field); !ok {
+			return fmt.Errorf("field %s must appear in GROUP BY or be used in an aggregate function", field)
+		}
+	}
+	if having := queryData.Having(); having != nil {
+		terms := having.GetTerms()
+		for i := range terms {
+			term := &terms[i]
+			if !term.AppliesTo(groupSchema) {
+				return fmt.Errorf("HAVING condition %s must only use GROUP BY fields and aggregate functions", term.String())
+			}
+		}
+	}
+	return nil
+}
 
-	return plan, nil
+// checkOrderBy checks that the ORDER BY keys of a query only use the fields of the records
+// it sorts: those of its tables, or for a grouped query the group fields and aggregates.
+func checkOrderBy(queryData *parserdata.QueryData, sch *record.Schema) error {
+	for _, key := range queryData.OrderBy() {
+		if key.Expression().AppliesTo(sch) {
+			continue
+		}
+		if queryData.IsGrouped() {
+			return fmt.Errorf("ORDER BY %s must only use GROUP BY fields and aggregate functions", key.Expression().String())
+		}
+		for _, field := range key.Expression().FieldNames() {
+			if !sch.HasField(field) {
+				return fmt.Errorf("unknown column: %s", field)
+			}
+		}
+	}
+	return nil
 }
 
 // optimizeTableWithIndex attempts to use an index for selection on a single table
-// and applies ALL table-specific predicates (both indexed and non-indexed)
-func (p *BasicQueryPlanner) optimizeTableWithIndex(tablePlan Plan, tableName string, predicate *query.Predicate, tx *transaction.Transaction) (Plan, error) {
+// and applies ALL table-specific predicates (both indexed and non-indexed).
+// If neededFields is given and holds no field but the indexed one, the index is read
+// without the table. A planner for updates only considers equalities with constants.
+func (p *BasicQueryPlanner) optimizeTableWithIndex(tablePlan Plan, tableName string, predicate *query.Predicate, neededFields []string, tx *transaction.Transaction) (Plan, error) {
 	tableSchema := tablePlan.Schema()
 
 	tablePredicate := predicate.SelectSubPred(tableSchema)
@@ -84,20 +769,20 @@ func (p *BasicQueryPlanner) optimizeTableWithIndex(tablePlan Plan, tableName str
 	bestPlan := tablePlan
 	bestCost := tablePlan.BlocksAccessed()
 	var indexedField string
+	var indexedByList bool
+	var indexedByRange bool
 
 	for fieldName, indexInfo := range indexInfoMap {
 		// Check if predicate has equality condition on this field
+		covered := coversFields(tableSchema, fieldName, neededFields) && !p.updatable
+
 		constant := tablePredicate.EquatesWithConstant(fieldName)
 		if constant != nil {
 			// Create index select plan
-			var searchValue any
-			if constant.IsString() {
-				searchValue = constant.AsString()
-			} else {
-				searchValue = constant.AsInt()
+			var indexPlan Plan = NewIndexSelectPlan(tablePlan, indexInfo, searchValue(*constant))
+			if covered {
+				indexPlan = NewIndexOnlyPlan(tableSchema, indexInfo, []any{searchValue(*constant)})
 			}
-
-			indexPlan := NewIndexSelectPlan(tablePlan, indexInfo, searchValue)
 			indexCost := indexPlan.BlocksAccessed()
 
 			// Use index if it's more efficient
@@ -105,14 +790,66 @@ func (p *BasicQueryPlanner) optimizeTableWithIndex(tablePlan Plan, tableName str
 				bestPlan = indexPlan
 				bestCost = indexCost
 				indexedField = fieldName
+				indexedByList = false
+				indexedByRange = false
+			}
+			continue
+		}
+		if p.updatable {
+			continue
+		}
+
+		// Otherwise check for an IN list on this field, which probes the index once per value
+		constants := tablePredicate.InConstants(fieldName)
+		if constants != nil {
+			searchValues := make([]any, len(constants))
+			for i, c := range constants {
+				searchValues[i] = searchValue(c)
+			}
+
+			var indexPlan Plan = NewMultiIndexSelectPlan(tablePlan, indexInfo, searchValues)
+			if covered {
+				indexPlan = NewIndexOnlyPlan(tableSchema, indexInfo, searchValues)
+			}
+			indexCost := indexPlan.BlocksAccessed()
+
+			if indexCost < bestCost {
+				bestPlan = indexPlan
+				bestCost = indexCost
+				indexedField = fieldName
+				indexedByList = true
+				indexedByRange = false
+			}
+			continue
+		}
+
+		// Otherwise a B-tree index can be searched for the range that comparisons with
+		// constants allow the field; a hash index only finds single values
+		if indexInfo.IndexType() != index.BTreeType {
+			continue
+		}
+		if rangePred := rangeTerms(tablePredicate, fieldName); rangePred != nil {
+			indexPlan := NewIndexRangePlan(tablePlan, indexInfo, rangePred)
+			indexCost := indexPlan.BlocksAccessed()
+
+			if indexCost < bestCost {
+				bestPlan = indexPlan
+				bestCost = indexCost
+				indexedField = fieldName
+				indexedByList = false
+				indexedByRange = true
 			}
 		}
 	}
 
 	// Apply remaining table predicates (non-indexed conditions)
 	if bestPlan != tablePlan {
-		// Index was used - apply remaining non-indexed predicates
-		remainingPredicate := p.removeIndexedTerm(tablePredicate, indexedField)
+		// Index was used - apply remaining non-indexed predicates. The comparisons a range
+		// was searched for are checked again, which reads no more blocks.
+		remainingPredicate := tablePredicate
+		if !indexedByRange {
+			remainingPredicate = p.removeIndexedTerm(tablePredicate, indexedField, indexedByList)
+		}
 		if remainingPredicate != nil {
 			bestPlan = NewSelectPlan(bestPlan, remainingPredicate)
 		}
@@ -124,10 +861,56 @@ func (p *BasicQueryPlanner) optimizeTableWithIndex(tablePlan Plan, tableName str
 	return bestPlan, nil
 }
 
-// optimizeJoinOrder sorts tables by estimated cost and builds optimal join tree
-func (p *BasicQueryPlanner) optimizeJoinOrder(tablePlans []Plan, predicate *query.Predicate) Plan {
+// rangeTerms returns the terms of the predicate that compare the field with a constant
+// using <, <=, > or >=, or nil if there are none.
+func rangeTerms(predicate *query.Predicate, fieldName string) *query.Predicate {
+	var result *query.Predicate
+	for _, term := range predicate.GetTerms() {
+		if _, constant := term.ComparesWithConstant(fieldName); constant == nil {
+			continue
+		}
+		if result == nil {
+			result = query.NewPredicate(term)
+		} else {
+			result.ConjunctWith(*query.NewPredicate(term))
+		}
+	}
+	return result
+}
+
+// coversFields reports whether fields, which must not be empty, all name the indexed field
+// of the table schema, so that the index holds everything a query needs.
+func coversFields(tableSchema *record.Schema, indexedField string, fields []string) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	for _, field := range fields {
+		name, ok := tableSchema.Resolve(field)
+		if !ok || name != indexedField {
+			return false
+		}
+	}
+	return true
+}
+
+// optimizeJoinOrder sorts tables by estimated cost and builds optimal join tree.
+// Large equi-joins on fields without an index are joined with a hash join.
+// The aliases are the names the tables are referred to by, in the same order.
+func (p *BasicQueryPlanner) optimizeJoinOrder(tables []string, aliases []string, tablePlans []Plan, predicate *query.Predicate, tx *transaction.Transaction) (Plan, error) {
 	if len(tablePlans) == 1 {
-		return tablePlans[0]
+		return tablePlans[0], nil
+	}
+
+	// Fields with an index are left to index-based access rather than a hash join
+	indexedFields := map[string]bool{}
+	for i, tableName := range tables {
+		indexInfoMap, err := p.metadataManager.GetIndexInfo(tableName, tx)
+		if err != nil {
+			return nil, err
+		}
+		for fieldName := range indexInfoMap {
+			indexedFields[aliases[i]+"."+fieldName] = true
+		}
 	}
 
 	// Sort tables by estimated cost (most selective first)
@@ -142,14 +925,58 @@ func (p *BasicQueryPlanner) optimizeJoinOrder(tablePlans []Plan, predicate *quer
 		p1 := NewProductPlan(result, tablePlans[i])
 		p2 := NewProductPlan(tablePlans[i], result)
 
-		if p1.BlocksAccessed() < p2.BlocksAccessed() {
-			result = p1
-		} else {
-			result = p2
+		var best Plan = p1
+		if p2.BlocksAccessed() <= p1.BlocksAccessed() {
+			best = p2
 		}
+		if hashJoin := p.hashJoin(result, tablePlans[i], predicate, indexedFields, tx); hashJoin != nil && hashJoin.BlocksAccessed() < best.BlocksAccessed() {
+			best = hashJoin
+		}
+		result = best
 	}
 
-	return result
+	return result, nil
+}
+
+// hashJoinMinRecords is the number of records the larger input of an equi-join needs
+// before a hash join is considered instead of a nested loop.
+const hashJoinMinRecords = 100
+
+// hashJoin returns a hash join of the two plans if the predicate equates a field of each of them,
+// neither field is indexed and the inputs are large. Otherwise it returns nil.
+func (p *BasicQueryPlanner) hashJoin(p1 Plan, p2 Plan, predicate *query.Predicate, indexedFields map[string]bool, tx *transaction.Transaction) Plan {
+	if predicate == nil || max(p1.RecordsOutput(), p2.RecordsOutput()) < hashJoinMinRecords {
+		return nil
+	}
+	joinPredicate := predicate.JoinSubPred(p1.Schema(), p2.Schema())
+	if joinPredicate == nil {
+		return nil
+	}
+	for _, term := range joinPredicate.GetTerms() {
+		lhs, rhs := term.GetLHS(), term.GetRHS()
+		if term.Operator() != query.OpEquals || !lhs.IsFieldName() || !rhs.IsFieldName() {
+			continue
+		}
+		field1, field2 := lhs.AsFieldName(), rhs.AsFieldName()
+		if !p1.Schema().HasField(field1) {
+			field1, field2 = field2, field1
+		}
+		if !p1.Schema().HasField(field1) || !p2.Schema().HasField(field2) {
+			continue
+		}
+		if indexedFields[tableFieldName(p1.Schema(), field1)] || indexedFields[tableFieldName(p2.Schema(), field2)] {
+			continue
+		}
+		return NewHashJoinPlan(tx, p1, p2, field1, field2)
+	}
+	return nil
+}
+
+// tableFieldName returns the name of a field qualified by the table it comes from, e.g. students.id,
+// or by the table's alias.
+func tableFieldName(sch *record.Schema, fieldName string) string {
+	_, field := record.SplitFieldName(fieldName)
+	return sch.Table(fieldName) + "." + field
 }
 
 // extractJoinPredicate extracts join conditions from the overall predicate
@@ -191,15 +1018,24 @@ func (p *BasicQueryPlanner) extractRemainingPredicate(predicate *query.Predicate
 	}
 }
 
-// removeIndexedTerm creates a new predicate without the term that uses the indexed field
-func (p *BasicQueryPlanner) removeIndexedTerm(predicate *query.Predicate, indexedField string) *query.Predicate {
+// removeIndexedTerm creates a new predicate without the term that uses the indexed field.
+// byList selects whether the index was searched with an IN list or a single equality.
+func (p *BasicQueryPlanner) removeIndexedTerm(predicate *query.Predicate, indexedField string, byList bool) *query.Predicate {
 	// Get all terms from the predicate
 	terms := predicate.GetTerms()
 	var result *query.Predicate
+	removed := false
 
 	for _, term := range terms {
-		// Skip the term that equates the indexed field with a constant
-		if term.GetLHS().IsFieldName() && term.GetLHS().AsFieldName() == indexedField && term.GetRHS().IsConstant() {
+		// Skip the term that the index search was built from, which is the first one that
+		// matches. Other comparisons on the indexed field (e.g. >, <, or a second equality)
+		// still need to be applied.
+		if !removed && byList && term.InConstants(indexedField) != nil {
+			removed = true
+			continue // This term is handled by the index
+		}
+		if !removed && !byList && term.EquatesWithConstant(indexedField) != nil {
+			removed = true
 			continue // This term is handled by the index
 		}
 		// Add all other terms to the result
@@ -213,3 +1049,11 @@ func (p *BasicQueryPlanner) removeIndexedTerm(predicate *query.Predicate, indexe
 
 	return result
 }
+
+// searchValue converts a constant into the value type used for index searches
+func searchValue(c query.Constant) any {
+	if c.IsString() {
+		return c.AsString()
+	}
+	return c.AsInt()
+}
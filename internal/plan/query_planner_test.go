@@ -1,11 +1,20 @@
 package plan
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/log"
 	"github.com/yashagw/cranedb/internal/metadata"
+	"github.com/yashagw/cranedb/internal/parse"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
 	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
@@ -333,11 +342,11 @@ func TestBasicQueryPlanner_WithIndex(t *testing.T) {
 	})
 
 	// Create an index on the id field
-	err := md.CreateIndex("emp_id_idx", "employees", "id", tx)
+	err := md.CreateIndex("emp_id_idx", "employees", "id", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Create an index on the department field
-	err = md.CreateIndex("emp_dept_idx", "employees", "department", tx)
+	err = md.CreateIndex("emp_dept_idx", "employees", "department", index.HashType, tx)
 	require.NoError(t, err)
 
 	planner := NewBasicQueryPlanner(md)
@@ -439,9 +448,9 @@ func TestBasicQueryPlanner_MultipleIndexes(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create indexes BEFORE inserting data
-	err = md.CreateIndex("products_id_idx", "products", "id", tx)
+	err = md.CreateIndex("products_id_idx", "products", "id", index.HashType, tx)
 	require.NoError(t, err)
-	err = md.CreateIndex("products_cat_idx", "products", "category_id", tx)
+	err = md.CreateIndex("products_cat_idx", "products", "category_id", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Insert data using UpdatePlanner to ensure indexes are populated
@@ -453,7 +462,7 @@ func TestBasicQueryPlanner_MultipleIndexes(t *testing.T) {
 		values := []interface{}{i, i % 5, "Product", "active"}
 		insertData := parserdata.NewInsertData("products", fields, values)
 
-		_, err = updatePlanner.ExecuteInsert(insertData, tx)
+		_, _, err = updatePlanner.ExecuteInsert(insertData, tx)
 		require.NoError(t, err)
 	}
 
@@ -519,7 +528,7 @@ func TestBasicQueryPlanner_IndexWithStringField(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create index on string field BEFORE inserting data
-	err = md.CreateIndex("items_status_idx", "items", "status", tx)
+	err = md.CreateIndex("items_status_idx", "items", "status", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Insert data with index in place
@@ -588,3 +597,648 @@ func TestBasicQueryPlanner_IndexWithStringField(t *testing.T) {
 	t.Logf("Index plan cost: %d", cost)
 	assert.True(t, cost <= 5, "Index plan should have low cost")
 }
+
+// TestBasicQueryPlanner_InListWithIndex tests that an IN list on an indexed field probes the index
+// once per value and returns the same records as the equivalent equality queries
+func TestBasicQueryPlanner_InListWithIndex(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	planner := NewPlanner(queryPlanner, NewBasicUpdatePlanner(md))
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE items (id INT, status VARCHAR(10))", tx)
+	require.NoError(t, err)
+	_, err = planner.ExecuteUpdate("CREATE INDEX items_status_idx ON items (status)", tx)
+	require.NoError(t, err)
+
+	// 500 distinct statuses, so that probing the index for a few of them beats a table scan.
+	// The records are copied at once, so the statistics count all their distinct values.
+	var csv strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csv, "%d,s%d\n", i, i%500)
+	}
+	csvPath := filepath.Join(dbPath, "items.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	_, err = planner.ExecuteUpdate(fmt.Sprintf("COPY items FROM '%s'", csvPath), tx)
+	require.NoError(t, err)
+
+	selectIds := func(where string) []int {
+		plan, err := planner.CreatePlan("SELECT id FROM items WHERE "+where, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		err = s.BeforeFirst()
+		require.NoError(t, err)
+
+		ids := []int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := s.GetInt("id")
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// The IN list uses the index
+	pred := query.NewPredicate(*query.NewInTerm(*query.NewFieldNameExpression("status"), []query.Constant{
+		*query.NewStringConstant("s1"), *query.NewStringConstant("s2"),
+	}))
+	tablePlan, err := NewTablePlan("items", tx, md)
+	require.NoError(t, err)
+	optimized, err := queryPlanner.optimizeTableWithIndex(tablePlan, "items", pred, nil, tx)
+	require.NoError(t, err)
+	assert.IsType(t, &MultiIndexSelectPlan{}, optimized)
+
+	// Results match the union of the individual equalities
+	expected := append(selectIds("status = 's1'"), selectIds("status = 's2'")...)
+	assert.Len(t, expected, 4)
+	assert.ElementsMatch(t, expected, selectIds("status IN ('s1', 's2')"))
+	assert.ElementsMatch(t, expected, selectIds("status IN ('s2', 's1', 's2', 'missing')"))
+
+	// Remaining conditions are still applied on top of the index
+	assert.ElementsMatch(t, []int{1, 2}, selectIds("status IN ('s1', 's2') AND id < 500"))
+}
+
+// TestBasicQueryPlanner_LowSelectivityAvoidsIndex tests that an index matching many records
+// loses to a table scan, since each record it matches is read at random
+func TestBasicQueryPlanner_LowSelectivityAvoidsIndex(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	planner := NewPlanner(queryPlanner, NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT, status VARCHAR(10), code INT)",
+		"CREATE INDEX orders_status_idx ON orders (status)",
+		"CREATE INDEX orders_code_idx ON orders (code)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// 20 records per status but only 2 per code
+	var csv strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csv, "%d,s%d,%d\n", i, i%50, i%500)
+	}
+	csvPath := filepath.Join(dbPath, "orders.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	_, err := planner.ExecuteUpdate(fmt.Sprintf("COPY orders FROM '%s'", csvPath), tx)
+	require.NoError(t, err)
+
+	tablePlan, err := NewTablePlan("orders", tx, md)
+	require.NoError(t, err)
+	indexInfo, err := md.GetIndexInfo("orders", tx)
+	require.NoError(t, err)
+
+	// Counting every block the same, the status index would read fewer blocks than the table
+	statusInfo := indexInfo["status"]
+	require.Less(t, statusInfo.BlocksAccessed()+statusInfo.RecordsOutput(), tablePlan.BlocksAccessed())
+
+	pred := query.NewPredicate(*query.NewTerm(*query.NewFieldNameExpression("status"), *query.NewConstantExpression(*query.NewStringConstant("s7"))))
+	optimized, err := queryPlanner.optimizeTableWithIndex(tablePlan, "orders", pred, nil, tx)
+	require.NoError(t, err)
+	selectPlan, ok := optimized.(*SelectPlan)
+	require.True(t, ok)
+	assert.IsType(t, &TablePlan{}, selectPlan.p)
+
+	// The selective code index is still used
+	pred = query.NewPredicate(*query.NewTerm(*query.NewFieldNameExpression("code"), *query.NewConstantExpression(*query.NewIntConstant(7))))
+	optimized, err = queryPlanner.optimizeTableWithIndex(tablePlan, "orders", pred, nil, tx)
+	require.NoError(t, err)
+	assert.IsType(t, &IndexSelectPlan{}, optimized)
+}
+
+// TestBasicQueryPlanner_IndexWithResidualPredicate tests that the terms of a predicate the
+// index search doesn't cover are applied on top of it, and only the indexed term is dropped
+func TestBasicQueryPlanner_IndexWithResidualPredicate(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	planner := NewPlanner(queryPlanner, NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT, code INT, amount INT)",
+		"CREATE INDEX orders_code_idx ON orders (code)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// 2 records per code, one with an amount below 10 for codes under 10
+	var csv strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csv, "%d,%d,%d\n", i, i%500, i)
+	}
+	csvPath := filepath.Join(dbPath, "orders.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	_, err := planner.ExecuteUpdate(fmt.Sprintf("COPY orders FROM '%s'", csvPath), tx)
+	require.NoError(t, err)
+
+	tablePlan, err := NewTablePlan("orders", tx, md)
+	require.NoError(t, err)
+	tests := []struct {
+		where    string
+		residual string
+		ids      []int
+	}{
+		{"code = 5 and amount > 10", "amount > 10", []int{505}},
+		{"amount > 10 and 5 = code", "amount > 10", []int{505}},
+		{"code = 5 and code > 3", "code > 3", []int{5, 505}},
+		{"code = 5 and code = 6", "code = 6", []int{}},
+		{"code = 5 and amount < 100 and amount >= 5", "amount < 100 and amount >= 5", []int{5}},
+	}
+	for _, tt := range tests {
+		queryData, err := parse.NewParserFromString("SELECT id FROM orders WHERE " + tt.where).Query()
+		require.NoError(t, err, tt.where)
+		optimized, err := queryPlanner.optimizeTableWithIndex(tablePlan, "orders", queryData.Predicate(), nil, tx)
+		require.NoError(t, err, tt.where)
+
+		selectPlan, ok := optimized.(*SelectPlan)
+		require.True(t, ok, tt.where)
+		assert.IsType(t, &IndexSelectPlan{}, selectPlan.p, tt.where)
+		assert.Equal(t, tt.residual, selectPlan.pred.String(), tt.where)
+
+		s, err := optimized.Open()
+		require.NoError(t, err, tt.where)
+		ids := []int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := s.GetInt("id")
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		s.Close()
+		assert.ElementsMatch(t, tt.ids, ids, tt.where)
+	}
+}
+
+// TestBasicQueryPlanner_IndexOnly tests that a query needing nothing but an indexed field
+// is answered from the index without reading the table
+func TestBasicQueryPlanner_IndexOnly(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 8)
+	require.NoError(t, err)
+	tx := transaction.NewTransaction(fm, lm, bm, transaction.NewLockTable())
+	defer tx.Commit()
+	md := metadata.NewManager(true, tx)
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	planner := NewPlanner(queryPlanner, NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20), age INT)",
+		"CREATE INDEX students_age_idx ON students (age)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	// The students of each age are spread over the table's blocks, which outnumber the buffers
+	for i := 0; i < 300; i++ {
+		sql := fmt.Sprintf("INSERT INTO students (id, name, age) VALUES (%d, 'student%d', %d)", i, i, i%50)
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// run returns the plan's input below the projection, the values of its first column,
+	// which must be an int, and the number of blocks of the table read while running it
+	run := func(sql string) (Plan, []int, int) {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		readsBefore := fm.BlocksRead("students.tbl")
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		column := plan.Schema().Fields()[0]
+		values := []int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			val, err := s.GetInt(column)
+			require.NoError(t, err)
+			values = append(values, val)
+		}
+		return plan.(*ProjectPlan).p, values, fm.BlocksRead("students.tbl") - readsBefore
+	}
+
+	input, ages, tableReads := run("SELECT students.age FROM students WHERE age = 7")
+	assert.IsType(t, &IndexOnlyPlan{}, input)
+	assert.Equal(t, []int{7, 7, 7, 7, 7, 7}, ages)
+	assert.Equal(t, 0, tableReads, "An index-only scan must not read the table")
+
+	// Fetching another field needs the table's records
+	input, ids, tableReads := run("SELECT id, age FROM students WHERE age = 7")
+	assert.IsType(t, &IndexSelectPlan{}, input)
+	assert.ElementsMatch(t, []int{7, 57, 107, 157, 207, 257}, ids)
+	assert.Greater(t, tableReads, 3)
+
+	input, counts, tableReads := run("SELECT COUNT(*) FROM students WHERE age IN (1, 2, 3)")
+	assert.IsType(t, &IndexOnlyPlan{}, input.(*GroupByPlan).p)
+	assert.Equal(t, []int{18}, counts)
+	assert.Equal(t, 0, tableReads)
+
+	// Remaining conditions on the indexed field are applied to the index's values
+	input, ages, _ = run("SELECT age FROM students WHERE age = 7 AND age < 5")
+	assert.IsType(t, &IndexOnlyPlan{}, input.(*SelectPlan).p)
+	assert.Empty(t, ages)
+}
+
+func TestBasicQueryPlanner_SameTableFieldTerm(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE pairs (id INT, a INT, b INT)",
+		"CREATE INDEX pairs_a_idx ON pairs (a)",
+		"CREATE TABLE labels (pid INT, label VARCHAR(10))",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	// a equals b for every third record, and for some others by chance
+	pair := func(i int) (int, int) {
+		if i%3 == 0 {
+			return i % 150, i % 150
+		}
+		return i % 150, i % 7
+	}
+	var pairsCSV, labelsCSV strings.Builder
+	for i := 0; i < 300; i++ {
+		a, b := pair(i)
+		fmt.Fprintf(&pairsCSV, "%d,%d,%d\n", i, a, b)
+		fmt.Fprintf(&labelsCSV, "%d,label%d\n", i, i)
+	}
+	for table, csv := range map[string]string{"pairs": pairsCSV.String(), "labels": labelsCSV.String()} {
+		csvPath := filepath.Join(dbPath, table+".csv")
+		require.NoError(t, os.WriteFile(csvPath, []byte(csv), 0644))
+		_, err := planner.ExecuteUpdate(fmt.Sprintf("COPY %s FROM '%s'", table, csvPath), tx)
+		require.NoError(t, err)
+	}
+
+	ids := func(sql string) []int {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.BeforeFirst())
+		result := []int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			id, err := s.GetInt("id")
+			require.NoError(t, err)
+			result = append(result, id)
+		}
+		return result
+	}
+	var equal []int
+	for i := 0; i < 300; i++ {
+		if a, b := pair(i); a == b {
+			equal = append(equal, i)
+		}
+	}
+
+	assert.ElementsMatch(t, equal, ids("SELECT id FROM pairs WHERE a = b"))
+	assert.ElementsMatch(t, equal, ids("SELECT id FROM pairs WHERE pairs.b = pairs.a"))
+
+	// The indexed field is looked up, and the field-to-field term still filters the records
+	plan, err := planner.CreatePlan("SELECT id FROM pairs WHERE a = 3 AND a = b", tx)
+	require.NoError(t, err)
+	selectPlan, ok := plan.(*ProjectPlan).p.(*SelectPlan)
+	require.True(t, ok)
+	assert.IsType(t, &IndexSelectPlan{}, selectPlan.p)
+	assert.ElementsMatch(t, []int{3, 153}, ids("SELECT id FROM pairs WHERE a = 3 AND a = b"))
+	assert.ElementsMatch(t, []int{3, 153}, ids("SELECT id, a FROM pairs WHERE a = b AND a = 3"))
+	assert.ElementsMatch(t, []int{5}, ids("SELECT id FROM pairs WHERE a = b AND a = 5"))
+
+	// With a second table, the term selects records of its own table rather than joining.
+	// The tables are large enough for their join on id = pid to be hashed.
+	assert.ElementsMatch(t, equal, ids("SELECT id, label FROM pairs, labels WHERE a = b AND id = pid"))
+}
+
+func TestBasicQueryPlanner_Exists(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20))",
+		"INSERT INTO students (id, name) VALUES (1, 'Alice')",
+		"INSERT INTO students (id, name) VALUES (2, 'Bob')",
+		"INSERT INTO students (id, name) VALUES (3, 'Charlie')",
+		"INSERT INTO students (id, name) VALUES (4, 'Diana')",
+		"CREATE TABLE enrollments (student_id INT, course VARCHAR(20))",
+		"INSERT INTO enrollments (student_id, course) VALUES (1, 'Math')",
+		"INSERT INTO enrollments (student_id, course) VALUES (2, 'Physics')",
+		"INSERT INTO enrollments (student_id, course) VALUES (2, 'Chemistry')",
+		"INSERT INTO enrollments (student_id, course) VALUES (3, 'History')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	names := func(sql string) []string {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.BeforeFirst())
+		field := plan.Schema().Fields()[0]
+		result := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			name, err := s.GetString(field)
+			require.NoError(t, err)
+			result = append(result, name)
+		}
+		return result
+	}
+
+	check := func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"Alice", "Bob", "Charlie"},
+			names("SELECT name FROM students s WHERE EXISTS (SELECT 1 FROM enrollments e WHERE e.student_id = s.id)"))
+		assert.ElementsMatch(t, []string{"Diana"},
+			names("SELECT s.name FROM students s WHERE NOT EXISTS (SELECT 1 FROM enrollments e WHERE e.student_id = s.id)"))
+		assert.ElementsMatch(t, []string{"Bob"},
+			names("SELECT name FROM students s WHERE EXISTS (SELECT 1 FROM enrollments e WHERE e.student_id = s.id AND e.course = 'Physics')"))
+		// Fields the subquery's table doesn't have are taken from the enclosing query, qualified or not
+		assert.ElementsMatch(t, []string{"Alice", "Bob", "Charlie"},
+			names("SELECT name FROM students WHERE EXISTS (SELECT course FROM enrollments WHERE student_id = id)"))
+		assert.ElementsMatch(t, []string{"Charlie"},
+			names("SELECT name FROM students WHERE id > 2 AND EXISTS (SELECT course FROM enrollments WHERE student_id = students.id)"))
+
+		// A subquery that doesn't refer to the enclosing query gives the same answer for every record
+		assert.ElementsMatch(t, []string{"Alice", "Bob", "Charlie", "Diana"},
+			names("SELECT name FROM students WHERE EXISTS (SELECT 1 FROM enrollments WHERE course = 'Math')"))
+		assert.Empty(t, names("SELECT name FROM students WHERE EXISTS (SELECT 1 FROM enrollments WHERE course = 'Art')"))
+
+		// The subquery can also filter the records of a join
+		assert.ElementsMatch(t, []string{"Math", "Physics", "Chemistry"},
+			names("SELECT e.course FROM students s, enrollments e WHERE s.id = e.student_id AND EXISTS (SELECT 1 FROM enrollments o WHERE o.student_id = s.id AND o.course <> 'History')"))
+	}
+
+	t.Run("WithoutIndex", check)
+
+	_, err := planner.ExecuteUpdate("CREATE INDEX enrollments_student_idx ON enrollments (student_id)", tx)
+	require.NoError(t, err)
+	t.Run("WithIndex", check)
+
+	t.Run("UnknownAlias", func(t *testing.T) {
+		_, err := planner.CreatePlan("SELECT name FROM students s WHERE students.id = 1", tx)
+		assert.ErrorContains(t, err, "unknown column: students.id")
+	})
+}
+
+func TestBasicQueryPlanner_ScalarSubquery(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE employees (id INT, name VARCHAR(20), dept VARCHAR(10), salary INT)",
+		"CREATE INDEX employees_salary_idx ON employees (salary)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (1, 'Alice', 'eng', 120)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (2, 'Bob', 'eng', 90)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (3, 'Carol', 'ops', 70)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (4, 'Dan', 'ops', 120)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (5, 'Eve', 'ops', 60)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	names := func(sql string) []string {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		require.NoError(t, s.BeforeFirst())
+		result := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			name, err := s.GetString("name")
+			require.NoError(t, err)
+			result = append(result, name)
+		}
+		return result
+	}
+
+	assert.ElementsMatch(t, []string{"Alice", "Dan"}, names("SELECT name FROM employees WHERE salary = (SELECT MAX(salary) FROM employees)"))
+	assert.ElementsMatch(t, []string{"Carol", "Eve"},
+		names("SELECT name FROM employees WHERE salary < (SELECT AVG(salary) FROM employees WHERE dept = 'eng') - 20"))
+	assert.ElementsMatch(t, []string{"Bob"},
+		names("SELECT name FROM employees WHERE salary = (SELECT salary FROM employees WHERE id = 2)"))
+	assert.ElementsMatch(t, []string{"Dan"},
+		names("SELECT name FROM employees WHERE dept = 'ops' AND salary = (SELECT MAX(salary) FROM employees WHERE dept = (SELECT dept FROM employees WHERE id = 5))"))
+
+	// The value is substituted before planning, so the term compares with a constant
+	plan, err := planner.CreatePlan("SELECT name FROM employees WHERE salary = (SELECT MIN(salary) FROM employees)", tx)
+	require.NoError(t, err)
+	selectPlan, ok := plan.(*ProjectPlan).p.(*SelectPlan)
+	require.True(t, ok)
+	assert.Equal(t, "salary = 60", selectPlan.pred.String())
+	assert.NotNil(t, selectPlan.pred.EquatesWithConstant("salary"))
+
+	t.Run("Errors", func(t *testing.T) {
+		for sql, expected := range map[string]string{
+			"SELECT name FROM employees WHERE salary = (SELECT salary FROM employees WHERE dept = 'ops')": "returned more than one row",
+			"SELECT name FROM employees WHERE salary = (SELECT id, salary FROM employees WHERE id = 1)":   "must return one column, got 2",
+			"SELECT name FROM employees WHERE salary = (SELECT salary FROM employees WHERE id = 9)":       "returned no rows",
+		} {
+			_, err := planner.CreatePlan(sql, tx)
+			assert.ErrorContains(t, err, expected, sql)
+		}
+	})
+}
+
+func TestBasicQueryPlanner_InSubquery(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE employees (id INT, name VARCHAR(20), dept VARCHAR(10), salary INT)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (1, 'Alice', 'eng', 120)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (2, 'Bob', 'eng', 90)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (3, 'Carol', 'ops', 70)",
+		"INSERT INTO employees (id, name, dept, salary) VALUES (4, 'Dan', 'ops', 120)",
+		"CREATE TABLE depts (name VARCHAR(10), remote INT)",
+		"INSERT INTO depts (name, remote) VALUES ('eng', 1)",
+		"INSERT INTO depts (name, remote) VALUES ('ops', 0)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	names := func(sql string) []string {
+		plan, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		result := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				return result
+			}
+			name, err := s.GetString("name")
+			require.NoError(t, err)
+			result = append(result, name)
+		}
+	}
+
+	assert.ElementsMatch(t, []string{"Alice", "Bob"}, names("SELECT name FROM employees WHERE dept IN (SELECT name FROM depts WHERE remote = 1)"))
+	assert.ElementsMatch(t, []string{"Carol", "Dan"}, names("SELECT name FROM employees WHERE NOT dept IN (SELECT name FROM depts WHERE remote = 1)"))
+	assert.ElementsMatch(t, []string{"Alice", "Dan"}, names("SELECT name FROM employees WHERE salary IN (SELECT MAX(salary) FROM employees GROUP BY dept) AND id > 0"))
+	assert.Empty(t, names("SELECT name FROM employees WHERE dept IN (SELECT name FROM depts WHERE remote = 2)"))
+
+	// The values are substituted before planning, so the term is an IN list
+	plan, err := planner.CreatePlan("SELECT name FROM employees WHERE id IN (SELECT id FROM employees WHERE salary = 120)", tx)
+	require.NoError(t, err)
+	selectPlan, ok := plan.(*ProjectPlan).p.(*SelectPlan)
+	require.True(t, ok)
+	assert.Equal(t, "id in (1, 4)", selectPlan.pred.String())
+
+	_, err = planner.CreatePlan("SELECT name FROM employees WHERE dept IN (SELECT name, remote FROM depts)", tx)
+	assert.ErrorContains(t, err, "must return one column, got 2")
+
+	limited := NewBasicQueryPlanner(md)
+	limited.SetMaxRows(1)
+	_, err = NewPlanner(limited, NewBasicUpdatePlanner(md)).CreatePlan("SELECT name FROM employees WHERE dept IN (SELECT name FROM depts)", tx)
+	assert.ErrorIs(t, err, query.ErrResultTooLarge)
+}
+
+// loadAggregateTable creates the items table and COPYs records into it, spread over
+// 10 groups, with every 7th name empty
+func loadAggregateTable(tb testing.TB, planner *Planner, dbPath string, tx *transaction.Transaction, records int) {
+	_, err := planner.ExecuteUpdate("CREATE TABLE items (id INT, grp INT, total BIGINT, name VARCHAR(10))", tx)
+	require.NoError(tb, err)
+
+	var csv strings.Builder
+	for i := 0; i < records; i++ {
+		name := fmt.Sprintf("n%d", i%997)
+		if i%7 == 0 {
+			name = ""
+		}
+		fmt.Fprintf(&csv, "%d,%d,%d,%s\n", i, i%10, int64(i)<<33, name)
+	}
+	csvPath := filepath.Join(dbPath, "items.csv")
+	require.NoError(tb, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	_, err = planner.ExecuteUpdate(fmt.Sprintf("COPY items FROM '%s'", csvPath), tx)
+	require.NoError(tb, err)
+}
+
+// TestBasicQueryPlanner_ParallelAggregate tests that aggregates over one table computed by
+// several workers, each over a part of the table's blocks, match the serial ones
+func TestBasicQueryPlanner_ParallelAggregate(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	serial := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	parallel := NewPlanner(NewBasicQueryPlanner(md).WithWorkers(4), NewBasicUpdatePlanner(md))
+	loadAggregateTable(t, serial, dbPath, tx, 3000)
+
+	// readAll returns the rows of a query's plan, and the plan below its projection
+	readAll := func(planner *Planner, sql string) ([][]any, Plan) {
+		p, err := planner.CreatePlan(sql, tx)
+		require.NoError(t, err, sql)
+		s, err := p.Open()
+		require.NoError(t, err, sql)
+		defer s.Close()
+		rows := [][]any{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err, sql)
+			if !hasNext {
+				break
+			}
+			row := []any{}
+			for _, field := range p.Schema().Fields() {
+				val, err := s.GetValue(field)
+				require.NoError(t, err, sql)
+				row = append(row, val)
+			}
+			rows = append(rows, row)
+		}
+		return rows, p.(*ProjectPlan).p
+	}
+
+	for _, sql := range []string{
+		"SELECT COUNT(*), SUM(id), AVG(id), MIN(name), MAX(total) FROM items",
+		"SELECT grp, COUNT(name), SUM(total), MIN(id) FROM items WHERE id > 100 AND name <> '' GROUP BY grp",
+		"SELECT grp, MAX(name) FROM items GROUP BY grp HAVING grp > 6",
+		"SELECT COUNT(id), MAX(id) FROM items WHERE id > 5000",
+	} {
+		expected, serialPlan := readAll(serial, sql)
+		actual, parallelPlan := readAll(parallel, sql)
+		assert.Equal(t, expected, actual, sql)
+		assert.NotEmpty(t, actual, sql)
+		assert.NotContains(t, fmt.Sprintf("%T", serialPlan), "Parallel", sql)
+		if selectPlan, ok := parallelPlan.(*SelectPlan); ok {
+			parallelPlan = selectPlan.p
+		}
+		assert.IsType(t, &ParallelGroupByPlan{}, parallelPlan, sql)
+	}
+
+	// A join is aggregated serially
+	_, err := parallel.ExecuteUpdate("CREATE TABLE groups (gid INT)", tx)
+	require.NoError(t, err)
+	_, p := readAll(parallel, "SELECT COUNT(id) FROM items, groups WHERE grp = gid")
+	assert.IsType(t, &GroupByPlan{}, p)
+}
+
+// BenchmarkAggregate compares aggregating a table serially and with several workers
+func BenchmarkAggregate(b *testing.B) {
+	dbPath, tx, md, cleanup := setupTestDB(b)
+	defer cleanup()
+	loadAggregateTable(b, NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md)), dbPath, tx, 100_000)
+
+	for _, workers := range []int{1, 2, 4} {
+		planner := NewPlanner(NewBasicQueryPlanner(md).WithWorkers(workers), NewBasicUpdatePlanner(md))
+		b.Run(fmt.Sprintf("Workers%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				p, err := planner.CreatePlan("SELECT COUNT(id), SUM(total), MAX(name) FROM items", tx)
+				require.NoError(b, err)
+				s, err := p.Open()
+				require.NoError(b, err)
+				hasNext, err := s.Next()
+				require.NoError(b, err)
+				require.True(b, hasNext)
+				s.Close()
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package plan
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -178,3 +179,44 @@ func TestSelectPlanRecordsOutputCalculation(t *testing.T) {
 	assert.True(t, selectRecords < tableRecords)
 	assert.True(t, selectRecords > 0)
 }
+
+func TestSelectPlanRecordsOutputByOperator(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 10)
+	tableName := "people"
+	require.NoError(t, md.CreateTable(tableName, schema, tx))
+	layout, err := md.GetTableLayout(tableName, tx)
+	require.NoError(t, err)
+
+	ts, err := table.NewTableScan(tx, layout, tableName)
+	require.NoError(t, err)
+	for i := 1; i <= 60; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("id", i))
+		require.NoError(t, ts.SetString("name", fmt.Sprintf("name%d", i)))
+	}
+	ts.Close()
+
+	tablePlan, err := NewTablePlan(tableName, tx, md)
+	require.NoError(t, err)
+	require.Equal(t, 60, tablePlan.RecordsOutput())
+
+	recordsOutput := func(fldname string, op query.Operator, val query.Constant) int {
+		term := query.NewComparisonTerm(*query.NewFieldNameExpression(fldname), op, *query.NewConstantExpression(val))
+		return NewSelectPlan(tablePlan, query.NewPredicate(*term)).RecordsOutput()
+	}
+	equals := recordsOutput("id", query.OpEquals, *query.NewIntConstant(7))
+	greater := recordsOutput("id", query.OpGreaterThan, *query.NewIntConstant(7))
+	like := recordsOutput("name", query.OpLike, *query.NewStringConstant("name1%"))
+	notEquals := recordsOutput("id", query.OpNotEquals, *query.NewIntConstant(7))
+
+	assert.Equal(t, 1, equals)
+	assert.Equal(t, 20, greater, "A range keeps about a third of the records")
+	assert.Equal(t, 12, like, "A LIKE pattern keeps about a fifth of the records")
+	assert.Equal(t, 60, notEquals)
+	assert.Equal(t, equals, recordsOutput("name", query.OpLike, *query.NewStringConstant("name7")), "A LIKE pattern without wildcards is an equality")
+}
@@ -0,0 +1,57 @@
+package plan
+
+import (
+	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ Plan = (*SortPlan)(nil)
+)
+
+// SortPlan is the Plan for ordering records (ORDER BY), which it does in memory.
+type SortPlan struct {
+	p       Plan
+	keys    []*query.SortKey
+	maxRows int
+}
+
+// NewSortPlan creates a plan returning the records of p ordered by the keys. Its scan fails
+// with query.ErrResultTooLarge instead of holding more than maxRows records in memory.
+// A maxRows of 0 means no limit.
+func NewSortPlan(p Plan, keys []*query.SortKey, maxRows int) *SortPlan {
+	return &SortPlan{
+		p:       p,
+		keys:    keys,
+		maxRows: maxRows,
+	}
+}
+
+func (sp *SortPlan) Open() (scan.Scan, error) {
+	s, err := sp.p.Open()
+	if err != nil {
+		return nil, err
+	}
+	return query.NewSortScan(s, sp.p.Schema(), sp.keys, sp.maxRows), nil
+}
+
+// BlocksAccessed returns the same as the underlying plan, which is read once.
+func (sp *SortPlan) BlocksAccessed() int {
+	return sp.p.BlocksAccessed()
+}
+
+// RecordsOutput returns the same as the underlying plan, since sorting keeps every record.
+func (sp *SortPlan) RecordsOutput() int {
+	return sp.p.RecordsOutput()
+}
+
+// DistinctValues returns the same as the underlying plan.
+func (sp *SortPlan) DistinctValues(fldname string) (int, error) {
+	return sp.p.DistinctValues(fldname)
+}
+
+// Schema returns the schema of the underlying plan.
+func (sp *SortPlan) Schema() *record.Schema {
+	return sp.p.Schema()
+}
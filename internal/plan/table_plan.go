@@ -15,12 +15,21 @@ var (
 // TablePlan is the Plan for a base table.
 type TablePlan struct {
 	tableName string
-	layout    *record.Layout
-	tx        *transaction.Transaction
-	statInfo  *metadata.StatInfo
+	// alias qualifies the table's fields, e.g. s for FROM students s, or is the table name
+	alias    string
+	layout   *record.Layout
+	schema   *record.Schema
+	tx       *transaction.Transaction
+	statInfo *metadata.StatInfo
 }
 
 func NewTablePlan(tableName string, tx *transaction.Transaction, md *metadata.Manager) (*TablePlan, error) {
+	return NewAliasedTablePlan(tableName, tableName, tx, md)
+}
+
+// NewAliasedTablePlan creates a plan for a table whose fields are qualified by an alias
+// instead of the table name, e.g. s.id for FROM students s.
+func NewAliasedTablePlan(tableName string, alias string, tx *transaction.Transaction, md *metadata.Manager) (*TablePlan, error) {
 	layout, err := md.GetTableLayout(tableName, tx)
 	if err != nil {
 		return nil, err
@@ -31,7 +40,9 @@ func NewTablePlan(tableName string, tx *transaction.Transaction, md *metadata.Ma
 	}
 	return &TablePlan{
 		tableName: tableName,
+		alias:     alias,
 		layout:    layout,
+		schema:    layout.GetSchema().WithTable(alias),
 		tx:        tx,
 		statInfo:  statInfo,
 	}, nil
@@ -42,9 +53,22 @@ func (p *TablePlan) Open() (scan.Scan, error) {
 	if err != nil {
 		return nil, err
 	}
+	scan.SetAlias(p.alias)
 	return scan, nil
 }
 
+// openPartitions opens scans over up to n parts of the table, which can be read at once.
+func (p *TablePlan) openPartitions(n int) ([]*table.TableScan, error) {
+	scans, err := table.PartitionScans(p.tx, p.layout, p.tableName, n)
+	if err != nil {
+		return nil, err
+	}
+	for _, scan := range scans {
+		scan.SetAlias(p.alias)
+	}
+	return scans, nil
+}
+
 // BlocksAccessed returns the number of blocks in the table.
 func (p *TablePlan) BlocksAccessed() int {
 	return p.statInfo.BlocksAccessed()
@@ -57,9 +81,13 @@ func (p *TablePlan) RecordsOutput() int {
 
 // DistinctValues returns the number of distinct values for the field in the table.
 func (p *TablePlan) DistinctValues(fldname string) (int, error) {
+	if name, ok := p.schema.Resolve(fldname); ok {
+		fldname = name
+	}
 	return p.statInfo.DistinctValues(fldname), nil
 }
 
+// Schema returns the table's fields, which can also be referred to qualified by the table name or alias.
 func (p *TablePlan) Schema() *record.Schema {
-	return p.layout.GetSchema()
+	return p.schema
 }
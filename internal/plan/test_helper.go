@@ -14,14 +14,16 @@ import (
 )
 
 // setupTestDB creates a test database environment for plan tests.
-func setupTestDB(t *testing.T) (string, *transaction.Transaction, *metadata.Manager, func()) {
+// The database is kept in memory; the returned directory holds any other
+// files a test needs, such as CSV files to COPY.
+func setupTestDB(t testing.TB) (string, *transaction.Transaction, *metadata.Manager, func()) {
 	tempDir, err := os.MkdirTemp("", "plan_test_*")
 	require.NoError(t, err)
 
 	dbPath := filepath.Join(tempDir, "testdb")
+	require.NoError(t, os.MkdirAll(dbPath, 0755))
 
-	fm, err := file.NewManager(dbPath, 400)
-	require.NoError(t, err)
+	fm := file.NewMemoryManager(400)
 	lm, err := log.NewManager(fm, "testlog")
 	require.NoError(t, err)
 	bm, err := buffer.NewManager(fm, lm, 8)
@@ -1,10 +1,21 @@
 package plan
 
 import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
 	"github.com/yashagw/cranedb/internal/metadata"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
 	"github.com/yashagw/cranedb/internal/query"
+	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
@@ -22,26 +33,88 @@ func NewBasicUpdatePlanner(metadataManager *metadata.Manager) *BasicUpdatePlanne
 	}
 }
 
+// selectWhere returns a plan for the records of the table plan that satisfy the predicate
+// of a statement's WHERE clause, which is nil if there is none. An equality of an indexed
+// field with a constant is looked up in the index, if that reads fewer blocks than the
+// table, and the other terms are checked by a select plan; otherwise the table plan is only
+// wrapped in a select plan. Either way the plan's scan can change the records it reads.
+// A predicate comparing values of different types fails with query.ErrTypeMismatch.
+// The subqueries in the predicate's expressions and IN terms run first, before any record
+// is changed, so that the statement's own changes don't affect which records it changes.
+func (p *BasicUpdatePlanner) selectWhere(tablePlan *TablePlan, predicate *query.Predicate, tx *transaction.Transaction) (Plan, error) {
+	if predicate == nil {
+		return tablePlan, nil
+	}
+	queryPlanner := NewBasicQueryPlanner(p.metadataManager).forUpdate()
+	predicate, err := queryPlanner.withSubqueryValues(predicate, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := predicate.CheckTypes(tablePlan.Schema()); err != nil {
+		return nil, err
+	}
+	plan, err := queryPlanner.optimizeTableWithIndex(tablePlan, tablePlan.tableName, predicate, nil, tx)
+	if err != nil {
+		return nil, err
+	}
+	if scannedIndexField(plan) == "" {
+		return NewSelectPlan(tablePlan, predicate), nil
+	}
+	return plan, nil
+}
+
+// scannedIndexField returns the field whose index the plan from selectWhere reads the
+// records through, or "" if it reads the table.
+func scannedIndexField(plan Plan) string {
+	if sp, ok := plan.(*SelectPlan); ok {
+		plan = sp.p
+	}
+	if isp, ok := plan.(*IndexSelectPlan); ok {
+		return isp.indexInfo.FieldName()
+	}
+	return ""
+}
+
 // ExecuteDelete executes a delete statement and returns the number of records deleted.
+// The index entries of the deleted records are removed along with them, since their
+// slots are reused by later records. The entry of the index the records are found through,
+// if any, is removed by its scan.
 func (p *BasicUpdatePlanner) ExecuteDelete(deleteData *parserdata.DeleteData, tx *transaction.Transaction) (int, error) {
 	tablePlan, err := NewTablePlan(deleteData.Table(), tx, p.metadataManager)
 	if err != nil {
 		return 0, err
 	}
-	plan := NewSelectPlan(tablePlan, deleteData.Predicate())
-
-	s, err := plan.Open()
+	indexInfo, err := p.metadataManager.GetIndexInfo(deleteData.Table(), tx)
+	if err != nil {
+		return 0, err
+	}
+	plan, err := p.selectWhere(tablePlan, deleteData.Predicate(), tx)
 	if err != nil {
 		return 0, err
 	}
-	us, ok := s.(scan.UpdateScan)
-	if !ok {
-		s.Close()
-		return 0, nil
+	if fieldName := scannedIndexField(plan); fieldName != "" {
+		others := make(map[string]*metadata.IndexInfo, len(indexInfo))
+		for name, ii := range indexInfo {
+			if name != fieldName {
+				others[name] = ii
+			}
+		}
+		indexInfo = others
 	}
 
-	// Delete all matching records
+	us, err := openUpdateScan(plan)
+	if err != nil {
+		return 0, err
+	}
+
+	// Delete all matching records. The statistics are updated for the records deleted even
+	// if the statement fails part way, since an open transaction keeps its changes.
 	count := 0
+	defer func() {
+		if count > 0 {
+			p.metadataManager.RecordsDeleted(deleteData.Table(), count, tx)
+		}
+	}()
 	for {
 		hasNext, err := us.Next()
 		if err != nil {
@@ -51,6 +124,13 @@ func (p *BasicUpdatePlanner) ExecuteDelete(deleteData *parserdata.DeleteData, tx
 		if !hasNext {
 			break
 		}
+		if len(indexInfo) > 0 {
+			err = deleteIndexEntries(indexInfo, us)
+			if err != nil {
+				us.Close()
+				return 0, err
+			}
+		}
 		err = us.Delete()
 		if err != nil {
 			us.Close()
@@ -59,35 +139,104 @@ func (p *BasicUpdatePlanner) ExecuteDelete(deleteData *parserdata.DeleteData, tx
 		count++
 	}
 	us.Close()
-
 	return count, nil
 }
 
-// ExecuteModify executes an update statement and returns the number of records modified.
-func (p *BasicUpdatePlanner) ExecuteModify(modifyData *parserdata.ModifyData, tx *transaction.Transaction) (int, error) {
-	tablePlan, err := NewTablePlan(modifyData.Table(), tx, p.metadataManager)
+// deleteIndexEntries removes the entries of the scan's current record from the indexes
+func deleteIndexEntries(indexInfo map[string]*metadata.IndexInfo, us scan.UpdateScan) error {
+	rid, err := us.GetRID()
+	if err != nil {
+		return err
+	}
+	for fieldName, ii := range indexInfo {
+		val, err := us.GetValue(fieldName)
+		if err != nil {
+			return err
+		}
+		idx, err := ii.Open()
+		if err != nil {
+			return err
+		}
+		err = idx.Delete(val, rid)
+		idx.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecuteVacuum packs the records of a table into the first blocks of its file, moving
+// their index entries along, and returns the number of records moved. The emptied blocks
+// at the end of the file are dropped once the transaction commits.
+func (p *BasicUpdatePlanner) ExecuteVacuum(vacuumData *parserdata.VacuumData, tx *transaction.Transaction) (int, error) {
+	tableName := vacuumData.Table()
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	indexInfo, err := p.metadataManager.GetIndexInfo(tableName, tx)
 	if err != nil {
 		return 0, err
 	}
-	plan := NewSelectPlan(tablePlan, modifyData.Predicate())
 
-	s, err := plan.Open()
+	count, err := table.Vacuum(tx, layout, tableName, func(oldRID, newRID *record.RID, ts *table.TableScan) error {
+		for fieldName, ii := range indexInfo {
+			val, err := ts.GetValue(fieldName)
+			if err != nil {
+				return err
+			}
+			idx, err := ii.Open()
+			if err != nil {
+				return err
+			}
+			err = idx.Delete(val, oldRID)
+			if err == nil {
+				err = idx.Insert(val, newRID)
+			}
+			idx.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	us, ok := s.(scan.UpdateScan)
-	if !ok {
-		s.Close()
-		return 0, nil
+	return count, nil
+}
+
+// ExecuteModify executes an update statement and returns the number of records modified
+// and their RIDs.
+func (p *BasicUpdatePlanner) ExecuteModify(modifyData *parserdata.ModifyData, tx *transaction.Transaction) (int, []*record.RID, error) {
+	tablePlan, err := NewTablePlan(modifyData.Table(), tx, p.metadataManager)
+	if err != nil {
+		return 0, nil, err
+	}
+	plan, err := p.selectWhere(tablePlan, modifyData.Predicate(), tx)
+	if err != nil {
+		return 0, nil, err
 	}
 
-	// Update all matching records
+	us, err := openUpdateScan(plan)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Update all matching records, noting the ones updated even if the statement fails
 	count := 0
+	defer func() {
+		if count > 0 {
+			p.metadataManager.RecordsModified(modifyData.Table(), count, tx)
+		}
+	}()
+	rids := []*record.RID{}
 	for {
 		hasNext, err := us.Next()
 		if err != nil {
 			us.Close()
-			return 0, err
+			return 0, nil, err
 		}
 		if !hasNext {
 			break
@@ -95,64 +244,68 @@ func (p *BasicUpdatePlanner) ExecuteModify(modifyData *parserdata.ModifyData, tx
 		val, err := modifyData.NewValue().Evaluate(us)
 		if err != nil {
 			us.Close()
-			return 0, err
+			return 0, nil, err
 		}
 
 		if val.IsInt() {
 			err = us.SetInt(modifyData.FieldName(), val.AsInt())
 			if err != nil {
 				us.Close()
-				return 0, err
+				return 0, nil, err
 			}
 		} else {
 			err = us.SetString(modifyData.FieldName(), val.AsString())
 			if err != nil {
 				us.Close()
-				return 0, err
+				return 0, nil, err
 			}
 		}
 
+		rid, err := us.GetRID()
+		if err != nil {
+			us.Close()
+			return 0, nil, err
+		}
+		rids = append(rids, rid)
 		count++
 	}
 	us.Close()
-
-	return count, nil
+	return count, rids, nil
 }
 
-// ExecuteInsert executes an insert statement and returns 1 (always inserts one record).
-func (p *BasicUpdatePlanner) ExecuteInsert(insertData *parserdata.InsertData, tx *transaction.Transaction) (int, error) {
+// ExecuteInsert executes an insert statement and returns 1 (always inserts one record)
+// and the RID of the new record.
+func (p *BasicUpdatePlanner) ExecuteInsert(insertData *parserdata.InsertData, tx *transaction.Transaction) (int, []*record.RID, error) {
 	plan, err := NewTablePlan(insertData.Table(), tx, p.metadataManager)
 	if err != nil {
-		return 0, err
+		return 0, nil, err
+	}
+	if err := checkInsert(insertData, plan.Schema()); err != nil {
+		return 0, nil, err
 	}
 
-	s, err := plan.Open()
+	us, err := openUpdateScan(plan)
 	if err != nil {
-		return 0, err
-	}
-	us, ok := s.(scan.UpdateScan)
-	if !ok {
-		s.Close()
-		return 0, nil
+		return 0, nil, err
 	}
 
 	err = us.Insert()
 	if err != nil {
 		us.Close()
-		return 0, err
+		return 0, nil, err
 	}
-
 	rid, err := us.GetRID()
 	if err != nil {
 		us.Close()
-		return 0, err
+		return 0, nil, err
 	}
+	p.metadataManager.RecordInserted(insertData.Table(), rid, tx)
 
 	// Check if index exists for the table
 	indexInfo, err := p.metadataManager.GetIndexInfo(insertData.Table(), tx)
 	if err != nil {
 		us.Close()
-		return 0, err
+		return 0, nil, err
 	}
 
 	fields := insertData.Fields()
@@ -160,69 +313,447 @@ func (p *BasicUpdatePlanner) ExecuteInsert(insertData *parserdata.InsertData, tx
 
 	// Set field values
 	for i, fieldName := range fields {
-		val := values[i]
-
-		var constant *query.Constant
-		switch v := val.(type) {
-		case int:
-			constant = query.NewIntConstant(v)
-		case string:
-			constant = query.NewStringConstant(v)
-		case *query.Constant:
-			constant = v
-		case query.Constant:
-			constant = &v
-		}
+		val := insertValue(values[i])
 
 		if ii, exists := indexInfo[fieldName]; exists {
 			index, err := ii.Open()
 			if err != nil {
 				us.Close()
-				return 0, err
+				return 0, nil, err
 			}
 			defer index.Close()
 			err = index.Insert(val, rid)
 			if err != nil {
 				us.Close()
-				return 0, err
+				return 0, nil, err
 			}
 			err = index.Close()
 			if err != nil {
 				us.Close()
-				return 0, err
+				return 0, nil, err
 			}
 		}
 
-		if constant != nil {
-			if constant.IsInt() {
-				err = us.SetInt(fieldName, constant.AsInt())
-				if err != nil {
-					us.Close()
-					return 0, err
-				}
+		err = us.SetValue(fieldName, val)
+		if err != nil {
+			us.Close()
+			return 0, nil, err
+		}
+	}
+
+	us.Close()
+	return 1, []*record.RID{rid}, nil
+}
+
+// checkInsert checks that an insert gives one value for each field it lists, that each field
+// is a field of the table and is listed once, and that each value fits its field: an int
+// within the range of an int field, or a string no longer than a string field allows.
+func checkInsert(insertData *parserdata.InsertData, schema *record.Schema) error {
+	fields := insertData.Fields()
+	values := insertData.Values()
+	if len(fields) != len(values) {
+		return fmt.Errorf("%d fields are listed but %d values are given", len(fields), len(values))
+	}
+	for i, fieldName := range fields {
+		if !schema.HasField(fieldName) {
+			return fmt.Errorf("field %s not found in table %s", fieldName, insertData.Table())
+		}
+		if slices.Index(fields, fieldName) < i {
+			return fmt.Errorf("field %s is listed twice", fieldName)
+		}
+
+		switch v := insertValue(values[i]).(type) {
+		case int:
+			if schema.Type(fieldName) == "string" {
+				return fmt.Errorf("field %s expects a string, got %d", fieldName, v)
+			}
+			if schema.Type(fieldName) == "int" && (v < math.MinInt32 || v > math.MaxInt32) {
+				return fmt.Errorf("field %s: %w: %d", fieldName, transaction.ErrIntOutOfRange, v)
+			}
+		case string:
+			if schema.Type(fieldName) != "string" {
+				return fmt.Errorf("field %s expects an int, got '%s'", fieldName, v)
+			}
+			if len(v) > schema.Length(fieldName) {
+				return fmt.Errorf("value for field %s is longer than %d", fieldName, schema.Length(fieldName))
+			}
+		default:
+			return fmt.Errorf("unsupported value %v for field %s", v, fieldName)
+		}
+	}
+	return nil
+}
+
+// insertValue returns a value given to an insert as an int or a string. The values of a parsed
+// insert already are; a value given as a constant is converted.
+func insertValue(val any) any {
+	if c, ok := val.(query.Constant); ok {
+		val = &c
+	}
+	if c, ok := val.(*query.Constant); ok {
+		if c.IsString() {
+			return c.AsString()
+		}
+		return c.AsInt()
+	}
+	return val
+}
+
+// ExecuteCopy loads the records of a CSV file into a table and returns the number of
+// records loaded. Each line holds a value for each of the listed fields, or for every
+// field of the table if none are listed; fields that aren't listed are set to 0 or an empty string.
+func (p *BasicUpdatePlanner) ExecuteCopy(copyData *parserdata.CopyData, tx *transaction.Transaction) (int, error) {
+	f, err := os.Open(copyData.Path())
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return p.LoadCSV(copyData.Table(), copyData.Fields(), csv.NewReader(f), tx)
+}
+
+// LoadCSV loads the records read by a CSV reader into a table, like COPY, and returns the
+// number of records loaded. Each record holds a value for each of the listed fields, or for
+// every field of the table if none are listed. A value that doesn't convert to the type of
+// its field fails the load with the line it is on.
+// The records are written with a bulk loader, and the indexes of the table are updated
+// once all of them are written.
+func (p *BasicUpdatePlanner) LoadCSV(tableName string, fields []string, reader *csv.Reader, tx *transaction.Transaction) (int, error) {
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	schema := layout.GetSchema()
+	schemaFields := schema.Fields()
+	if len(fields) == 0 {
+		fields = schemaFields
+	}
+	positions := make([]int, len(fields))
+	for i, fieldName := range fields {
+		positions[i] = slices.Index(schemaFields, fieldName)
+		if positions[i] < 0 {
+			return 0, fmt.Errorf("field %s not found in table %s", fieldName, tableName)
+		}
+	}
+
+	reader.FieldsPerRecord = len(fields)
+
+	// The loader writes each block as it fills, so the records written before a failure stay
+	loader := table.NewBulkLoader(tx, layout, tableName)
+	defer func() {
+		if rids := loader.RIDs(); len(rids) > 0 {
+			p.metadataManager.RecordsInserted(tableName, rids, tx)
+		}
+	}()
+	rows := [][]any{}
+	for {
+		texts, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		values := make([]any, len(schemaFields))
+		for i, fieldName := range schemaFields {
+			if schema.Type(fieldName) == "string" {
+				values[i] = ""
 			} else {
-				err = us.SetString(fieldName, constant.AsString())
-				if err != nil {
-					us.Close()
-					return 0, err
-				}
+				values[i] = 0
 			}
 		}
+		for i, text := range texts {
+			pos := positions[i]
+			if schema.Type(schemaFields[pos]) == "string" {
+				values[pos] = text
+				continue
+			}
+			val, err := strconv.Atoi(strings.TrimSpace(text))
+			if err != nil {
+				line, _ := reader.FieldPos(i)
+				return 0, fmt.Errorf("line %d: field %s expects an int, got '%s'", line, fields[i], text)
+			}
+			values[pos] = val
+		}
+		err = loader.Add(values)
+		if err != nil {
+			// A quoted line break makes a record span lines, so this is the one it starts on
+			line, _ := reader.FieldPos(0)
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, values)
 	}
+	err = loader.Flush()
+	if err != nil {
+		return 0, err
+	}
+	rids := loader.RIDs()
 
-	us.Close()
-	return 1, nil
+	indexInfo, err := p.metadataManager.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	for fieldName, ii := range indexInfo {
+		pos := slices.Index(schemaFields, fieldName)
+		index, err := ii.Open()
+		if err != nil {
+			return 0, err
+		}
+		for i, rid := range rids {
+			err = index.Insert(rows[i][pos], rid)
+			if err != nil {
+				index.Close()
+				return 0, err
+			}
+		}
+		err = index.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(rids), nil
+}
+
+// ExecuteUpsert executes an insert with an ON CONFLICT clause. The index on the conflict
+// field is probed for the inserted value: the records that have it are modified as by an
+// update, or if there are none, the record is inserted. It returns the number of records
+// inserted or modified and their RIDs.
+func (p *BasicUpdatePlanner) ExecuteUpsert(upsertData *parserdata.UpsertData, tx *transaction.Transaction) (int, []*record.RID, error) {
+	insertData := upsertData.Insert()
+	tableName := insertData.Table()
+	conflictField := upsertData.ConflictField()
+
+	pos := slices.Index(insertData.Fields(), conflictField)
+	if pos < 0 {
+		return 0, nil, fmt.Errorf("conflict field %s is not inserted", conflictField)
+	}
+	indexInfo, err := p.metadataManager.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	conflictIndex, exists := indexInfo[conflictField]
+	if !exists {
+		return 0, nil, fmt.Errorf("ON CONFLICT (%s) requires an index on %s", conflictField, conflictField)
+	}
+
+	rids, err := findByIndex(conflictIndex, insertData.Values()[pos])
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rids) == 0 {
+		return p.ExecuteInsert(insertData, tx)
+	}
+
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return 0, nil, err
+	}
+	fieldName := upsertData.FieldName()
+	if !layout.GetSchema().HasField(fieldName) {
+		return 0, nil, fmt.Errorf("field %s not found in table %s", fieldName, tableName)
+	}
+	ts, err := table.NewTableScan(tx, layout, tableName)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer ts.Close()
+
+	modified := 0
+	defer func() {
+		if modified > 0 {
+			p.metadataManager.RecordsModified(tableName, modified, tx)
+		}
+	}()
+	for _, rid := range rids {
+		err = ts.MoveToRID(rid)
+		if err != nil {
+			return 0, nil, err
+		}
+		oldVal, err := ts.GetValue(fieldName)
+		if err != nil {
+			return 0, nil, err
+		}
+		val, err := upsertData.NewValue().Evaluate(ts)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var newVal any
+		if val.IsInt() {
+			newVal = val.AsInt()
+			err = ts.SetInt(fieldName, val.AsInt())
+		} else {
+			newVal = val.AsString()
+			err = ts.SetString(fieldName, val.AsString())
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		modified++
+
+		// Move the record's entry in the index on the modified field
+		if ii, exists := indexInfo[fieldName]; exists {
+			err = moveIndexEntry(ii, oldVal, newVal, rid)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+
+	return len(rids), rids, nil
+}
+
+// findByIndex returns the RIDs of the records the index holds for the key.
+func findByIndex(ii *metadata.IndexInfo, key any) ([]*record.RID, error) {
+	idx, err := ii.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer idx.Close()
+
+	err = idx.BeforeFirst(key)
+	if err != nil {
+		return nil, err
+	}
+	rids := []*record.RID{}
+	for {
+		hasNext, err := idx.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			break
+		}
+		rid, err := idx.GetDataRid()
+		if err != nil {
+			return nil, err
+		}
+		rids = append(rids, rid)
+	}
+	return rids, nil
+}
+
+// moveIndexEntry replaces the index entry of a record whose indexed field changed from oldVal to newVal.
+func moveIndexEntry(ii *metadata.IndexInfo, oldVal any, newVal any, rid *record.RID) error {
+	idx, err := ii.Open()
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	err = idx.Delete(oldVal, rid)
+	if err != nil {
+		return err
+	}
+	return idx.Insert(newVal, rid)
 }
 
 // ExecuteCreateTable executes a create table statement and returns 0.
 func (p *BasicUpdatePlanner) ExecuteCreateTable(createTableData *parserdata.CreateTableData, tx *transaction.Transaction) (int, error) {
-	err := p.metadataManager.CreateTable(createTableData.TableName(), createTableData.Schema(), tx)
+	layout := record.NewLayoutFromSchema(createTableData.Schema())
+	if createTableData.PackedStrings() {
+		layout = record.NewPackedLayoutFromSchema(createTableData.Schema())
+	}
+	err := p.metadataManager.CreateTableWithLayout(createTableData.TableName(), layout, tx)
 	if err != nil {
 		return 0, err
 	}
 	return 0, nil
 }
 
+// ExecuteCreateTableAs creates a table with the output schema of a query, copies the
+// query's records into it and returns the number of records copied.
+func (p *BasicUpdatePlanner) ExecuteCreateTableAs(createTableAsData *parserdata.CreateTableAsData, tx *transaction.Transaction) (int, error) {
+	queryPlan, err := NewBasicQueryPlanner(p.metadataManager).CreatePlan(createTableAsData.Query(), tx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Column types and lengths come from the query's output. Qualified columns
+	// (e.g. students.id) are named after their field.
+	schema := record.NewSchema()
+	srcFields := map[string]string{}
+	for _, srcField := range queryPlan.Schema().Fields() {
+		_, field := record.SplitFieldName(srcField)
+		if schema.HasField(field) {
+			return 0, fmt.Errorf("duplicate column: %s", field)
+		}
+		schema.AddField(field, queryPlan.Schema().Type(srcField), queryPlan.Schema().Length(srcField))
+		srcFields[field] = srcField
+	}
+	tableName := createTableAsData.TableName()
+	err = p.metadataManager.CreateTable(tableName, schema, tx)
+	if err != nil {
+		return 0, err
+	}
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := queryPlan.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := table.NewTableScan(tx, layout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	err = src.BeforeFirst()
+	if err != nil {
+		return 0, err
+	}
+
+	// Copy all records
+	count := 0
+	for {
+		hasNext, err := src.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !hasNext {
+			break
+		}
+		err = dst.Insert()
+		if err != nil {
+			return 0, err
+		}
+		rid, err := dst.GetRID()
+		if err != nil {
+			return 0, err
+		}
+		p.metadataManager.RecordInserted(tableName, rid, tx)
+		for _, fieldName := range schema.Fields() {
+			if schema.Type(fieldName) != "string" {
+				val, err := src.GetInt(srcFields[fieldName])
+				if err != nil {
+					return 0, err
+				}
+				err = dst.SetInt(fieldName, val)
+				if err != nil {
+					return 0, err
+				}
+			} else {
+				val, err := src.GetString(srcFields[fieldName])
+				if err != nil {
+					return 0, err
+				}
+				err = dst.SetString(fieldName, val)
+				if err != nil {
+					return 0, err
+				}
+			}
+		}
+		count++
+	}
+
+	return count, nil
+}
+
 // ExecuteCreateView executes a create view statement and returns 0.
 func (p *BasicUpdatePlanner) ExecuteCreateView(createViewData *parserdata.CreateViewData, tx *transaction.Transaction) (int, error) {
 	err := p.metadataManager.CreateView(createViewData.ViewName(), createViewData.Query().String(), tx)
@@ -232,11 +763,76 @@ func (p *BasicUpdatePlanner) ExecuteCreateView(createViewData *parserdata.Create
 	return 0, nil
 }
 
-// ExecuteCreateIndex executes a create index statement and returns 0.
+// ExecuteCreateIndex executes a create index statement and returns 0. The index is filled
+// with the records already in the table.
 func (p *BasicUpdatePlanner) ExecuteCreateIndex(createIndexData *parserdata.CreateIndexData, tx *transaction.Transaction) (int, error) {
-	err := p.metadataManager.CreateIndex(createIndexData.IndexName(), createIndexData.TableName(), createIndexData.FieldName(), tx)
+	err := p.metadataManager.CreateIndex(createIndexData.IndexName(), createIndexData.TableName(), createIndexData.FieldName(), createIndexData.IndexType(), tx)
+	if err != nil {
+		return 0, err
+	}
+	_, err = p.metadataManager.RebuildIndex(createIndexData.IndexName(), tx)
 	if err != nil {
 		return 0, err
 	}
 	return 0, nil
 }
+
+// ExecuteReindex rebuilds an index, or every index of a table, from the records of the
+// table, and returns the number of index entries written.
+func (p *BasicUpdatePlanner) ExecuteReindex(reindexData *parserdata.ReindexData, tx *transaction.Transaction) (int, error) {
+	if reindexData.Table() != "" {
+		return p.metadataManager.RebuildTableIndexes(reindexData.Table(), tx)
+	}
+	return p.metadataManager.RebuildIndex(reindexData.Index(), tx)
+}
+
+// ExecuteDropColumn removes a field from a table, rewriting its records into the layout of
+// the remaining fields, and returns the number of records rewritten. The table's indexes
+// are rebuilt, since the records move. A field with an index can't be dropped, and neither
+// can the only field of a table.
+func (p *BasicUpdatePlanner) ExecuteDropColumn(dropColumnData *parserdata.DropColumnData, tx *transaction.Transaction) (int, error) {
+	tableName, column := dropColumnData.Table(), dropColumnData.Column()
+	if metadata.IsCatalogTable(tableName) {
+		return 0, fmt.Errorf("can't alter catalog table %s", tableName)
+	}
+	layout, err := p.metadataManager.GetTableLayout(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	schema := layout.GetSchema()
+	if !schema.HasField(column) {
+		return 0, fmt.Errorf("field %s not found in table %s", column, tableName)
+	}
+	if len(schema.Fields()) == 1 {
+		return 0, fmt.Errorf("can't drop %s, the only field of table %s", column, tableName)
+	}
+	indexInfo, err := p.metadataManager.GetIndexInfo(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	if ii, exists := indexInfo[column]; exists {
+		return 0, fmt.Errorf("can't drop %s: it is indexed by %s", column, ii.IndexName())
+	}
+
+	newSchema := record.NewSchema()
+	newSchema.CopyAll(schema)
+	newSchema.RemoveField(column)
+	newLayout := record.NewLayoutFromSchema(newSchema)
+	if layout.PackedStrings() {
+		newLayout = record.NewPackedLayoutFromSchema(newSchema)
+	}
+
+	count, err := table.Rewrite(tx, layout, newLayout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	err = p.metadataManager.SetTableLayout(tableName, newLayout, tx)
+	if err != nil {
+		return 0, err
+	}
+	_, err = p.metadataManager.RebuildTableIndexes(tableName, tx)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -1,14 +1,24 @@
 package plan
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/metadata"
 	"github.com/yashagw/cranedb/internal/parse/parserdata"
 	"github.com/yashagw/cranedb/internal/query"
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/table"
+	"github.com/yashagw/cranedb/internal/transaction"
 )
 
 func TestBasicUpdatePlanner_ExecuteInsert(t *testing.T) {
@@ -33,14 +43,22 @@ func TestBasicUpdatePlanner_ExecuteInsert(t *testing.T) {
 		[]any{1, "Alice"},
 	)
 
-	count, err := planner.ExecuteInsert(insertData, tx)
+	count, rids, err := planner.ExecuteInsert(insertData, tx)
 	require.NoError(t, err)
 	assert.Equal(t, 1, count)
+	require.Len(t, rids, 1)
 
-	// Verify the insert
+	// The returned RID points at the new record
 	layout := record.NewLayoutFromSchema(schema)
 	ts, err := table.NewTableScan(tx, layout, tableName)
 	require.NoError(t, err)
+	err = ts.MoveToRID(rids[0])
+	require.NoError(t, err)
+	name, err := ts.GetString("name")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", name)
+
+	// Verify the insert
 	err = ts.BeforeFirst()
 	require.NoError(t, err)
 	found := false
@@ -76,7 +94,7 @@ func TestBasicUpdatePlanner_ExecuteInsertWithIndex(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create index
-	err = md.CreateIndex("idx_name", tableName, "name", tx)
+	err = md.CreateIndex("idx_name", tableName, "name", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Create planner
@@ -89,7 +107,7 @@ func TestBasicUpdatePlanner_ExecuteInsertWithIndex(t *testing.T) {
 		[]any{1, "Alice"},
 	)
 
-	count, err := planner.ExecuteInsert(insertData, tx)
+	count, _, err := planner.ExecuteInsert(insertData, tx)
 	require.NoError(t, err)
 	assert.Equal(t, 1, count)
 
@@ -162,6 +180,66 @@ func TestBasicUpdatePlanner_ExecuteInsertWithIndex(t *testing.T) {
 	assert.True(t, found, "Inserted record should be found")
 }
 
+// TestBasicUpdatePlanner_ExecuteInsertValidation tests that an insert whose fields and values
+// don't match the table fails before anything is written
+func TestBasicUpdatePlanner_ExecuteInsertValidation(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 5)
+	schema.AddBigIntField("total")
+	tableName := "students"
+	require.NoError(t, md.CreateTable(tableName, schema, tx))
+	require.NoError(t, md.CreateIndex("idx_name", tableName, "name", index.HashType, tx))
+	planner := NewBasicUpdatePlanner(md)
+
+	tests := []struct {
+		name     string
+		fields   []string
+		values   []any
+		expected string
+	}{
+		{"more values than fields", []string{"id", "name"}, []any{1, "Ann", 3}, "2 fields are listed but 3 values are given"},
+		{"fewer values than fields", []string{"id", "name"}, []any{1}, "2 fields are listed but 1 values are given"},
+		{"unknown field", []string{"id", "age"}, []any{1, 20}, "field age not found in table students"},
+		{"field listed twice", []string{"id", "id"}, []any{1, 2}, "field id is listed twice"},
+		{"string into int", []string{"id", "name"}, []any{"one", "Ann"}, "field id expects an int, got 'one'"},
+		{"string into bigint", []string{"total"}, []any{"many"}, "field total expects an int, got 'many'"},
+		{"int into string", []string{"id", "name"}, []any{1, 42}, "field name expects a string, got 42"},
+		{"string too long", []string{"id", "name"}, []any{1, "Annabel"}, "value for field name is longer than 5"},
+		{"int out of range", []string{"id"}, []any{1 << 40}, "field id: int value out of range"},
+		{"int constant into string", []string{"name"}, []any{query.NewIntConstant(7)}, "field name expects a string, got 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := planner.ExecuteInsert(parserdata.NewInsertData(tableName, tt.fields, tt.values), tx)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expected)
+		})
+	}
+
+	// None of the failed inserts left a record or an index entry behind
+	ts, err := table.NewTableScan(tx, record.NewLayoutFromSchema(schema), tableName)
+	require.NoError(t, err)
+	hasNext, err := ts.Next()
+	ts.Close()
+	require.NoError(t, err)
+	assert.False(t, hasNext)
+	indexInfo, err := md.GetIndexInfo(tableName, tx)
+	require.NoError(t, err)
+	rids, err := findByIndex(indexInfo["name"], "Ann")
+	require.NoError(t, err)
+	assert.Empty(t, rids)
+
+	// A bigint field takes an int beyond the range of an int field
+	insertData := parserdata.NewInsertData(tableName, []string{"id", "name", "total"}, []any{1, "Ann", 1 << 40})
+	count, _, err := planner.ExecuteInsert(insertData, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
 func TestBasicUpdatePlanner_ExecuteDelete(t *testing.T) {
 	_, tx, md, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -231,6 +309,125 @@ func TestBasicUpdatePlanner_ExecuteDelete(t *testing.T) {
 	assert.Equal(t, 4, remaining)
 }
 
+func TestBasicUpdatePlanner_DeleteByIndexedField(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20))",
+		"CREATE INDEX students_id_idx ON students (id)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	for i := 1; i <= 20; i++ {
+		_, err := planner.ExecuteUpdate(fmt.Sprintf("INSERT INTO students (id, name) VALUES (%d, 'student%d')", i%10, i), tx)
+		require.NoError(t, err)
+	}
+
+	count, err := planner.ExecuteUpdate("DELETE FROM students WHERE id = 3", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// The records and their index entries are gone, and the others are left alone
+	indexInfo, err := md.GetIndexInfo("students", tx)
+	require.NoError(t, err)
+	idx, err := indexInfo["id"].Open()
+	require.NoError(t, err)
+	require.NoError(t, idx.BeforeFirst(3))
+	hasNext, err := idx.Next()
+	require.NoError(t, err)
+	assert.False(t, hasNext)
+	idx.Close()
+	plan, err := planner.CreatePlan("SELECT name FROM students WHERE id = 4", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	remaining, err := countScanResults(s)
+	require.NoError(t, err)
+	assert.Equal(t, 2, remaining)
+
+	// A plan whose scan can't change records fails rather than changing none
+	tablePlan, err := NewTablePlan("students", tx, md)
+	require.NoError(t, err)
+	projectPlan, err := NewProjectPlan(tablePlan, []string{"id"})
+	require.NoError(t, err)
+	_, err = openUpdateScan(projectPlan)
+	assert.ErrorIs(t, err, ErrNotUpdatable)
+}
+
+// TestBasicUpdatePlanner_DeleteThroughIndex tests that a delete with an equality on an
+// indexed field reads the records through the index rather than the whole table, for each
+// type of index
+func TestBasicUpdatePlanner_DeleteThroughIndex(t *testing.T) {
+	for _, indexType := range []string{"HASH", "BTREE"} {
+		t.Run(indexType, func(t *testing.T) {
+			dbPath, tx, md, cleanup := setupTestDB(t)
+			defer cleanup()
+
+			planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+			_, err := planner.ExecuteUpdate("CREATE TABLE orders (id INT, code INT, note VARCHAR(100))", tx)
+			require.NoError(t, err)
+			var csv strings.Builder
+			for i := 0; i < 1000; i++ {
+				fmt.Fprintf(&csv, "%d,%d,order%d\n", i, i%100, i)
+			}
+			csvPath := filepath.Join(dbPath, "orders.csv")
+			require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+			_, err = planner.ExecuteUpdate(fmt.Sprintf("COPY orders FROM '%s'", csvPath), tx)
+			require.NoError(t, err)
+			for _, sql := range []string{
+				fmt.Sprintf("CREATE INDEX orders_code_idx ON orders (code) USING %s", indexType),
+				"CREATE INDEX orders_id_idx ON orders (id)",
+			} {
+				_, err = planner.ExecuteUpdate(sql, tx)
+				require.NoError(t, err)
+			}
+			tablePlan, err := NewTablePlan("orders", tx, md)
+			require.NoError(t, err)
+			tableBlocks := tablePlan.BlocksAccessed()
+
+			// Every record with the value is deleted, though each deletion changes the index
+			// being read, while reading a fraction of the table's blocks
+			before := tx.BlocksAccessed()
+			count, err := planner.ExecuteUpdate("DELETE FROM orders WHERE code = 42", tx)
+			require.NoError(t, err)
+			assert.Equal(t, 10, count)
+			assert.Less(t, tx.BlocksAccessed()-before, tableBlocks/2)
+
+			// The records are gone from both indexes, and the others are left alone
+			indexInfo, err := md.GetIndexInfo("orders", tx)
+			require.NoError(t, err)
+			for fieldName, value := range map[string]int{"code": 42, "id": 142} {
+				idx, err := indexInfo[fieldName].Open()
+				require.NoError(t, err)
+				require.NoError(t, idx.BeforeFirst(value))
+				hasNext, err := idx.Next()
+				require.NoError(t, err)
+				assert.False(t, hasNext, fieldName)
+				idx.Close()
+			}
+			plan, err := planner.CreatePlan("SELECT id FROM orders", tx)
+			require.NoError(t, err)
+			s, err := plan.Open()
+			require.NoError(t, err)
+			remaining, err := countScanResults(s)
+			s.Close()
+			require.NoError(t, err)
+			assert.Equal(t, 990, remaining)
+
+			// An update finds its records the same way, and checks the other terms
+			before = tx.BlocksAccessed()
+			count, err = planner.ExecuteUpdate("UPDATE orders SET note = 'changed' WHERE code = 7 AND id < 500", tx)
+			require.NoError(t, err)
+			assert.Equal(t, 5, count)
+			assert.Less(t, tx.BlocksAccessed()-before, tableBlocks/2)
+		})
+	}
+}
+
 func TestBasicUpdatePlanner_ExecuteModify(t *testing.T) {
 	_, tx, md, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -272,13 +469,21 @@ func TestBasicUpdatePlanner_ExecuteModify(t *testing.T) {
 	newValue := query.NewConstantExpression(*query.NewStringConstant("NewName"))
 	modifyData := parserdata.NewModifyData(tableName, "name", newValue, pred)
 
-	count, err := planner.ExecuteModify(modifyData, tx)
+	count, rids, err := planner.ExecuteModify(modifyData, tx)
 	require.NoError(t, err)
 	assert.Equal(t, 1, count, "Should update 1 record")
+	require.Len(t, rids, 1)
 
-	// Verify update
+	// The returned RID points at the modified record
 	ts, err = table.NewTableScan(tx, layout, tableName)
 	require.NoError(t, err)
+	err = ts.MoveToRID(rids[0])
+	require.NoError(t, err)
+	modifiedID, err := ts.GetInt("id")
+	require.NoError(t, err)
+	assert.Equal(t, 2, modifiedID)
+
+	// Verify update
 	updatedCount := 0
 	oldNameCount := 0
 	err = ts.BeforeFirst()
@@ -308,6 +513,114 @@ func TestBasicUpdatePlanner_ExecuteModify(t *testing.T) {
 	assert.Equal(t, 2, oldNameCount)
 }
 
+// TestBasicUpdatePlanner_WithoutWhere tests that UPDATE and DELETE without a WHERE clause apply to every record
+func TestBasicUpdatePlanner_WithoutWhere(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20))",
+		"INSERT INTO students (id, name) VALUES (1, 'Alice')",
+		"INSERT INTO students (id, name) VALUES (2, 'Bob')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	count, err := planner.ExecuteUpdate("UPDATE students SET name = 'Student'", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = planner.ExecuteUpdate("DELETE FROM students WHERE name = 'Student'", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = planner.ExecuteUpdate("INSERT INTO students (id, name) VALUES (3, 'Carol')", tx)
+	require.NoError(t, err)
+	count, err = planner.ExecuteUpdate("DELETE FROM students", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestBasicUpdatePlanner_InSubquery tests UPDATE and DELETE of the records whose field is among
+// the values a subquery on another table returns
+func TestBasicUpdatePlanner_InSubquery(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, status VARCHAR(10))",
+		"CREATE TABLE enrollments (student_id INT, course VARCHAR(10))",
+		"CREATE INDEX enrollments_student_idx ON enrollments (student_id)",
+		"INSERT INTO students (id, status) VALUES (1, 'active')",
+		"INSERT INTO students (id, status) VALUES (2, 'inactive')",
+		"INSERT INTO students (id, status) VALUES (3, 'active')",
+		"INSERT INTO students (id, status) VALUES (4, 'inactive')",
+		"INSERT INTO enrollments (student_id, course) VALUES (1, 'math')",
+		"INSERT INTO enrollments (student_id, course) VALUES (2, 'math')",
+		"INSERT INTO enrollments (student_id, course) VALUES (2, 'art')",
+		"INSERT INTO enrollments (student_id, course) VALUES (3, 'art')",
+		"INSERT INTO enrollments (student_id, course) VALUES (4, 'history')",
+		"INSERT INTO enrollments (student_id, course) VALUES (5, 'math')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// enrollments returns the enrollments left, as student:course
+	enrollments := func() []string {
+		plan, err := planner.CreatePlan("SELECT student_id, course FROM enrollments", tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		rows := []string{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				return rows
+			}
+			id, err := s.GetInt("student_id")
+			require.NoError(t, err)
+			course, err := s.GetString("course")
+			require.NoError(t, err)
+			rows = append(rows, fmt.Sprintf("%d:%s", id, course))
+		}
+	}
+
+	count, err := planner.ExecuteUpdate("UPDATE enrollments SET course = 'none' WHERE student_id NOT IN (SELECT id FROM students)", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT id FROM students WHERE status = 'inactive') AND course <> 'art'", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []string{"1:math", "2:art", "3:art", "5:none"}, enrollments())
+
+	count, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT id FROM students WHERE status = 'inactive')", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.ElementsMatch(t, []string{"1:math", "3:art", "5:none"}, enrollments())
+
+	// A subquery that returns nothing matches nothing
+	count, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT id FROM students WHERE status = 'graduated')", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// The subquery runs before any record is deleted, so it isn't affected by the deletes
+	count, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT student_id FROM enrollments WHERE course = 'art')", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.ElementsMatch(t, []string{"1:math", "5:none"}, enrollments())
+
+	_, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT id, status FROM students)", tx)
+	assert.ErrorContains(t, err, "must return one column, got 2")
+	_, err = planner.ExecuteUpdate("DELETE FROM enrollments WHERE student_id IN (SELECT missing FROM students)", tx)
+	assert.Error(t, err)
+}
+
 func TestBasicUpdatePlanner_ExecuteCreateTable(t *testing.T) {
 	_, tx, md, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -319,7 +632,7 @@ func TestBasicUpdatePlanner_ExecuteCreateTable(t *testing.T) {
 	schema := record.NewSchema()
 	schema.AddIntField("id")
 	schema.AddStringField("name", 30)
-	createTableData := parserdata.NewCreateTableData("newtable", schema)
+	createTableData := parserdata.NewCreateTableData("newtable", schema, false)
 
 	count, err := planner.ExecuteCreateTable(createTableData, tx)
 	require.NoError(t, err)
@@ -380,7 +693,7 @@ func TestBasicUpdatePlanner_ExecuteCreateIndex(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create index
-	createIndexData := parserdata.NewCreateIndexData("idx_name", "students", "name")
+	createIndexData := parserdata.NewCreateIndexData("idx_name", "students", "name", index.HashType)
 	count, err := planner.ExecuteCreateIndex(createIndexData, tx)
 	require.NoError(t, err)
 	assert.Equal(t, 0, count)
@@ -394,5 +707,649 @@ func TestBasicUpdatePlanner_ExecuteCreateIndex(t *testing.T) {
 	require.NotNil(t, indexInfo)
 	require.Equal(t, "idx_name", indexInfo.IndexName())
 	require.Equal(t, "name", indexInfo.FieldName())
-	require.Equal(t, schema, indexInfo.TableSchema())
+	require.True(t, schema.Equal(indexInfo.TableSchema()))
+}
+
+// TestBasicUpdatePlanner_CreateIndexOnPopulatedTable tests that an index created after its
+// table is loaded finds the records that were already there
+func TestBasicUpdatePlanner_CreateIndexOnPopulatedTable(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	queryPlanner := NewBasicQueryPlanner(md)
+	planner := NewPlanner(queryPlanner, NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE orders (id INT, code INT)", tx)
+	require.NoError(t, err)
+
+	var csv strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&csv, "%d,%d\n", i, i%500)
+	}
+	csvPath := filepath.Join(dbPath, "orders.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte(csv.String()), 0644))
+	_, err = planner.ExecuteUpdate(fmt.Sprintf("COPY orders FROM '%s'", csvPath), tx)
+	require.NoError(t, err)
+
+	_, err = planner.ExecuteUpdate("CREATE INDEX orders_code_idx ON orders (code)", tx)
+	require.NoError(t, err)
+
+	tablePlan, err := NewTablePlan("orders", tx, md)
+	require.NoError(t, err)
+	pred := query.NewPredicate(*query.NewTerm(*query.NewFieldNameExpression("code"), *query.NewConstantExpression(*query.NewIntConstant(7))))
+	optimized, err := queryPlanner.optimizeTableWithIndex(tablePlan, "orders", pred, nil, tx)
+	require.NoError(t, err)
+	require.IsType(t, &IndexSelectPlan{}, optimized)
+
+	s, err := optimized.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	ids := []int{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.ElementsMatch(t, []int{7, 507}, ids)
+}
+
+func TestBasicUpdatePlanner_ExecuteCreateTableAs(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+
+	_, err := planner.ExecuteUpdate("CREATE TABLE students (id INT, name VARCHAR(20), age INT)", tx)
+	require.NoError(t, err)
+	for _, sql := range []string{
+		"INSERT INTO students (id, name, age) VALUES (1, 'Alice', 17)",
+		"INSERT INTO students (id, name, age) VALUES (2, 'Bob', 18)",
+		"INSERT INTO students (id, name, age) VALUES (3, 'Charlie', 25)",
+	} {
+		_, err = planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	count, err := planner.ExecuteUpdate("CREATE TABLE adults AS SELECT name, id, age * 12 FROM students WHERE age >= 18", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// The layout matches the projected schema, in select list order
+	layout, err := md.GetTableLayout("adults", tx)
+	require.NoError(t, err)
+	newSchema := layout.GetSchema()
+	assert.Equal(t, []string{"name", "id", "age * 12"}, newSchema.Fields())
+	assert.Equal(t, "string", newSchema.Type("name"))
+	assert.Equal(t, 20, newSchema.Length("name"))
+	assert.Equal(t, "int", newSchema.Type("id"))
+	assert.Equal(t, "int", newSchema.Type("age * 12"))
+
+	// The table holds exactly the selected rows
+	ts, err := table.NewTableScan(tx, layout, "adults")
+	require.NoError(t, err)
+	defer ts.Close()
+	err = ts.BeforeFirst()
+	require.NoError(t, err)
+	rows := map[int]string{}
+	months := map[int]int{}
+	for {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := ts.GetInt("id")
+		require.NoError(t, err)
+		rows[id], err = ts.GetString("name")
+		require.NoError(t, err)
+		months[id], err = ts.GetInt("age * 12")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, map[int]string{2: "Bob", 3: "Charlie"}, rows)
+	assert.Equal(t, map[int]int{2: 216, 3: 300}, months)
+}
+
+func TestBasicUpdatePlanner_IncrementalStats(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE events (id INT, kind VARCHAR(10))", tx)
+	require.NoError(t, err)
+
+	exec := func(sql string) {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	// The first insert calculates the statistics of the empty table; every later
+	// change only updates them, since there are too few changes for a rescan
+	for i := 1; i <= 40; i++ {
+		exec(fmt.Sprintf("INSERT INTO events (id, kind) VALUES (%d, 'k%d')", i, i%4))
+	}
+	exec("DELETE FROM events WHERE kind = 'k1'")
+	exec("DELETE FROM events WHERE id = 2")
+	exec("UPDATE events SET kind = 'k9' WHERE id = 4")
+	for i := 41; i <= 45; i++ {
+		exec(fmt.Sprintf("INSERT INTO events (id, kind) VALUES (%d, 'k0')", i))
+	}
+
+	layout, err := md.GetTableLayout("events", tx)
+	require.NoError(t, err)
+	ts, err := table.NewTableScan(tx, layout, "events")
+	require.NoError(t, err)
+	actualRecs, actualBlocks := 0, 0
+	for {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		actualRecs++
+		rid, err := ts.GetRID()
+		require.NoError(t, err)
+		actualBlocks = max(actualBlocks, rid.Block()+1)
+	}
+	ts.Close()
+	require.Equal(t, 34, actualRecs)
+
+	si, err := md.GetStatInfo("events", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, actualRecs, si.RecordsOutput())
+	assert.Equal(t, actualBlocks, si.BlocksAccessed())
+	assert.Equal(t, 0, si.DistinctValues("id"), "Distinct values are only counted by a rescan")
+}
+
+func TestBasicUpdatePlanner_ExecuteUpsert(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE pages (name VARCHAR(10), hits INT)",
+		"CREATE INDEX pages_name_idx ON pages (name)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	upsert := func(name string, set string) []*record.RID {
+		sql := fmt.Sprintf("INSERT INTO pages (name, hits) VALUES ('%s', 1) ON CONFLICT (name) DO UPDATE SET %s", name, set)
+		count, rids, err := planner.ExecuteUpdateWithRIDs(sql, tx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		require.Len(t, rids, 1)
+		return rids
+	}
+	readPages := func() map[string]int {
+		plan, err := planner.CreatePlan("SELECT name, hits FROM pages", tx)
+		require.NoError(t, err)
+		s, err := plan.Open()
+		require.NoError(t, err)
+		defer s.Close()
+		pages := map[string]int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			name, err := s.GetString("name")
+			require.NoError(t, err)
+			hits, err := s.GetInt("hits")
+			require.NoError(t, err)
+			pages[name] = hits
+		}
+		return pages
+	}
+	indexed := func(name string) []*record.RID {
+		indexInfo, err := md.GetIndexInfo("pages", tx)
+		require.NoError(t, err)
+		rids, err := findByIndex(indexInfo["name"], name)
+		require.NoError(t, err)
+		return rids
+	}
+
+	// No record has the key yet, so it is inserted
+	home := upsert("home", "hits = hits + 1")
+	assert.Equal(t, map[string]int{"home": 1}, readPages())
+
+	// The existing record is modified, using its current values
+	assert.Equal(t, home, upsert("home", "hits = hits + 1"))
+	upsert("about", "hits = hits + 1")
+	upsert("home", "hits = hits * 10")
+	assert.Equal(t, map[string]int{"home": 20, "about": 1}, readPages())
+
+	// Changing the key moves the record's index entry
+	assert.Equal(t, home, upsert("home", "name = 'start'"))
+	assert.Empty(t, indexed("home"))
+	assert.Equal(t, home, indexed("start"))
+	upsert("home", "hits = 0")
+	assert.Equal(t, map[string]int{"start": 20, "about": 1, "home": 1}, readPages())
+
+	// The conflict field needs an index and an inserted value
+	_, err := planner.ExecuteUpdate("INSERT INTO pages (name, hits) VALUES ('home', 1) ON CONFLICT (hits) DO UPDATE SET hits = 2", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires an index on hits")
+	_, err = planner.ExecuteUpdate("INSERT INTO pages (hits) VALUES (1) ON CONFLICT (name) DO UPDATE SET hits = 2", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "conflict field name is not inserted")
+	_, err = planner.ExecuteUpdate("INSERT INTO pages (name, hits) VALUES ('home', 1) ON CONFLICT (name) DO UPDATE SET missing = 2", tx)
+	require.Error(t, err)
+}
+
+func TestBasicUpdatePlanner_ExecuteCopy(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE people (id INT, name VARCHAR(10), age INT)",
+		"CREATE INDEX people_name_idx ON people (name)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	writeCSV := func(name string, lines ...string) string {
+		path := filepath.Join(dbPath, name)
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+		return path
+	}
+	lines := []string{}
+	for i := 1; i <= 40; i++ {
+		lines = append(lines, fmt.Sprintf("n%d, %d", i%4, i))
+	}
+	path := writeCSV("people.csv", lines...)
+
+	count, err := planner.ExecuteUpdate(fmt.Sprintf("COPY people (name, id) FROM '%s'", path), tx)
+	require.NoError(t, err)
+	assert.Equal(t, 40, count)
+
+	// The index was updated with the loaded records
+	plan, err := planner.CreatePlan("SELECT id, age FROM people WHERE name = 'n1'", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	ids := []int{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		ids = append(ids, id)
+		age, err := s.GetInt("age")
+		require.NoError(t, err)
+		assert.Equal(t, 0, age, "Fields that aren't listed are left at 0")
+	}
+	s.Close()
+	assert.ElementsMatch(t, []int{1, 5, 9, 13, 17, 21, 25, 29, 33, 37}, ids)
+
+	layout, err := md.GetTableLayout("people", tx)
+	require.NoError(t, err)
+	si, err := md.GetStatInfo("people", layout, tx)
+	require.NoError(t, err)
+	assert.Equal(t, 40, si.RecordsOutput())
+
+	// Without a field list, every field is given in the table's order
+	path = writeCSV("more.csv", "41,alice,30", "42,bob,31")
+	count, err = planner.ExecuteUpdate(fmt.Sprintf("COPY people FROM '%s'", path), tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	t.Run("Errors", func(t *testing.T) {
+		tests := []struct {
+			name string
+			sql  string
+		}{
+			{"MissingFile", fmt.Sprintf("COPY people FROM '%s'", filepath.Join(dbPath, "missing.csv"))},
+			{"UnknownField", fmt.Sprintf("COPY people (id, missing) FROM '%s'", path)},
+			{"WrongFieldCount", fmt.Sprintf("COPY people (id, name) FROM '%s'", path)},
+			{"InvalidInt", fmt.Sprintf("COPY people (name, age, id) FROM '%s'", path)},
+			{"StringTooLong", fmt.Sprintf("COPY people FROM '%s'", writeCSV("long.csv", "1,much too long,2"))},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := planner.ExecuteUpdate(tt.sql, tx)
+				assert.Error(t, err)
+			})
+		}
+	})
+}
+
+func TestBasicUpdatePlanner_PackedTable(t *testing.T) {
+	dbPath, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE fixed_notes (id INT, body VARCHAR(100))",
+		"CREATE TABLE notes (id INT, body VARCHAR(100)) PACKED",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	layout, err := md.GetTableLayout("notes", tx)
+	require.NoError(t, err)
+	assert.True(t, layout.PackedStrings(), "The packed layout must be kept in the catalog")
+
+	for i := 1; i <= 30; i++ {
+		for _, tableName := range []string{"fixed_notes", "notes"} {
+			sql := fmt.Sprintf("INSERT INTO %s (id, body) VALUES (%d, 'note %d')", tableName, i, i)
+			_, err := planner.ExecuteUpdate(sql, tx)
+			require.NoError(t, err)
+		}
+	}
+	fixedBlocks, err := tx.Size("fixed_notes.tbl")
+	require.NoError(t, err)
+	packedBlocks, err := tx.Size("notes.tbl")
+	require.NoError(t, err)
+	assert.Less(t, packedBlocks, fixedBlocks/2, "Short strings should take up far fewer blocks when packed")
+
+	for _, sql := range []string{
+		"UPDATE notes SET body = 'a much longer note than before' WHERE id = 2",
+		"DELETE FROM notes WHERE id = 3",
+		"INSERT INTO notes (id, body) VALUES (31, 'note 31')",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// COPY fills new blocks with as many records as fit
+	path := filepath.Join(dbPath, "notes.csv")
+	require.NoError(t, os.WriteFile(path, []byte("32,copied\n33,\n"), 0o644))
+	count, err := planner.ExecuteUpdate(fmt.Sprintf("COPY notes FROM '%s'", path), tx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	plan, err := planner.CreatePlan("SELECT id, body FROM notes", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	defer s.Close()
+	bodies := map[int]string{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		body, err := s.GetString("body")
+		require.NoError(t, err)
+		bodies[id] = body
+	}
+	assert.Len(t, bodies, 32)
+	assert.Equal(t, "note 1", bodies[1])
+	assert.Equal(t, "a much longer note than before", bodies[2])
+	assert.NotContains(t, bodies, 3)
+	assert.Equal(t, "note 31", bodies[31])
+	assert.Equal(t, "copied", bodies[32])
+	assert.Equal(t, "", bodies[33])
+}
+
+func TestBasicUpdatePlanner_ExecuteVacuum(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, err := log.NewManager(fm, "testlog")
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 8)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	tx := transaction.NewTransaction(fm, lm, bm, lockTable)
+	md := metadata.NewManager(true, tx)
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	for _, sql := range []string{
+		"CREATE TABLE students (id INT, name VARCHAR(20), age INT)",
+		"CREATE INDEX students_age_idx ON students (age)",
+	} {
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		sql := fmt.Sprintf("INSERT INTO students (id, name, age) VALUES (%d, 'student%d', %d)", i, i, i%10)
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	// Every other record is deleted, leaving a hole in each block
+	count, err := planner.ExecuteUpdate("DELETE FROM students WHERE id / 2 * 2 = id", tx)
+	require.NoError(t, err)
+	require.Equal(t, 50, count)
+	blocksBefore, err := tx.Size("students.tbl")
+	require.NoError(t, err)
+
+	moved, err := planner.ExecuteUpdate("VACUUM students", tx)
+	require.NoError(t, err)
+	assert.Greater(t, moved, 0)
+	sizeBeforeCommit, err := tx.Size("students.tbl")
+	require.NoError(t, err)
+	assert.Equal(t, blocksBefore, sizeBeforeCommit, "Blocks are only dropped once the transaction commits")
+	require.NoError(t, tx.Commit())
+
+	tx = transaction.NewTransaction(fm, lm, bm, lockTable)
+	defer tx.Commit()
+	blocksAfter, err := tx.Size("students.tbl")
+	require.NoError(t, err)
+	assert.Less(t, blocksAfter, blocksBefore)
+	slotsPerBlock := (400 - record.RecordHeaderSize) / 36
+	assert.Equal(t, (50+slotsPerBlock-1)/slotsPerBlock, blocksAfter)
+
+	plan, err := planner.CreatePlan("SELECT id, name, age FROM students", tx)
+	require.NoError(t, err)
+	s, err := plan.Open()
+	require.NoError(t, err)
+	ids := map[int]bool{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		name, err := s.GetString("name")
+		require.NoError(t, err)
+		age, err := s.GetInt("age")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("student%d", id), name)
+		assert.Equal(t, id%10, age)
+		ids[id] = true
+	}
+	s.Close()
+	assert.Len(t, ids, 50)
+	for i := 1; i < 100; i += 2 {
+		assert.True(t, ids[i], "student %d is missing", i)
+	}
+
+	// Each index entry leads to a remaining record with its value
+	indexInfo, err := md.GetIndexInfo("students", tx)
+	require.NoError(t, err)
+	layout, err := md.GetTableLayout("students", tx)
+	require.NoError(t, err)
+	ts, err := table.NewTableScan(tx, layout, "students")
+	require.NoError(t, err)
+	defer ts.Close()
+	for age := 0; age < 10; age++ {
+		rids, err := findByIndex(indexInfo["age"], age)
+		require.NoError(t, err)
+		found := []int{}
+		for _, rid := range rids {
+			require.NoError(t, ts.MoveToRID(rid))
+			recordAge, err := ts.GetInt("age")
+			require.NoError(t, err)
+			assert.Equal(t, age, recordAge)
+			id, err := ts.GetInt("id")
+			require.NoError(t, err)
+			found = append(found, id)
+		}
+		if age%2 == 0 {
+			assert.Empty(t, found, "The entries of deleted records must be gone")
+		} else {
+			assert.ElementsMatch(t, []int{age, age + 10, age + 20, age + 30, age + 40, age + 50, age + 60, age + 70, age + 80, age + 90}, found)
+		}
+	}
+}
+
+func TestBasicUpdatePlanner_ExecuteReindex(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE students (id INT, name VARCHAR(20), age INT)", tx)
+	require.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		sql := fmt.Sprintf("INSERT INTO students (id, name, age) VALUES (%d, 'student%d', %d)", i, i, i%3)
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+
+	// idsByAge returns the ids of the records the index finds for each age
+	idsByAge := func() map[int][]int {
+		indexInfo, err := md.GetIndexInfo("students", tx)
+		require.NoError(t, err)
+		layout, err := md.GetTableLayout("students", tx)
+		require.NoError(t, err)
+		ts, err := table.NewTableScan(tx, layout, "students")
+		require.NoError(t, err)
+		defer ts.Close()
+
+		result := map[int][]int{}
+		for age := 0; age < 3; age++ {
+			rids, err := findByIndex(indexInfo["age"], age)
+			require.NoError(t, err)
+			for _, rid := range rids {
+				require.NoError(t, ts.MoveToRID(rid))
+				id, err := ts.GetInt("id")
+				require.NoError(t, err)
+				result[age] = append(result[age], id)
+			}
+		}
+		return result
+	}
+	expected := map[int][]int{}
+	for i := 0; i < 30; i++ {
+		expected[i%3] = append(expected[i%3], i)
+	}
+	assertIndexed := func() {
+		found := idsByAge()
+		for age := 0; age < 3; age++ {
+			assert.ElementsMatch(t, expected[age], found[age], "age %d", age)
+		}
+	}
+
+	// The records already in the table are indexed when the index is created
+	_, err = planner.ExecuteUpdate("CREATE INDEX students_age_idx ON students (age)", tx)
+	require.NoError(t, err)
+	assertIndexed()
+
+	// makeStale drops the entries of the records with age 1 and adds a wrong one
+	makeStale := func() {
+		indexInfo, err := md.GetIndexInfo("students", tx)
+		require.NoError(t, err)
+		rids, err := findByIndex(indexInfo["age"], 1)
+		require.NoError(t, err)
+		require.NotEmpty(t, rids)
+		idx, err := indexInfo["age"].Open()
+		require.NoError(t, err)
+		defer idx.Close()
+		for _, rid := range rids {
+			require.NoError(t, idx.Delete(1, rid))
+		}
+		require.NoError(t, idx.Insert(2, rids[0]))
+	}
+
+	makeStale()
+	count, err := planner.ExecuteUpdate("REINDEX students_age_idx", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 30, count)
+	assertIndexed()
+
+	makeStale()
+	count, err = planner.ExecuteUpdate("REINDEX TABLE students", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 30, count)
+	assertIndexed()
+
+	_, err = planner.ExecuteUpdate("REINDEX missing_idx", tx)
+	assert.EqualError(t, err, "index missing_idx not found")
+	_, err = planner.ExecuteUpdate("REINDEX TABLE missing", tx)
+	assert.Error(t, err)
+}
+
+func TestBasicUpdatePlanner_ExecuteDropColumn(t *testing.T) {
+	_, tx, md, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	planner := NewPlanner(NewBasicQueryPlanner(md), NewBasicUpdatePlanner(md))
+	_, err := planner.ExecuteUpdate("CREATE TABLE students (id INT, bio VARCHAR(40), name VARCHAR(20), age INT)", tx)
+	require.NoError(t, err)
+	for i := 0; i < 30; i++ {
+		sql := fmt.Sprintf("INSERT INTO students (id, bio, name, age) VALUES (%d, 'bio of student%d', 'student%d', %d)", i, i, i, i%3)
+		_, err := planner.ExecuteUpdate(sql, tx)
+		require.NoError(t, err)
+	}
+	_, err = planner.ExecuteUpdate("CREATE INDEX students_age_idx ON students (age)", tx)
+	require.NoError(t, err)
+	oldLayout, err := md.GetTableLayout("students", tx)
+	require.NoError(t, err)
+
+	count, err := planner.ExecuteUpdate("ALTER TABLE students DROP COLUMN bio", tx)
+	require.NoError(t, err)
+	assert.Equal(t, 30, count)
+
+	// The catalog holds the smaller layout of the remaining fields
+	layout, err := md.GetTableLayout("students", tx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "age"}, layout.GetSchema().Fields())
+	assert.Equal(t, oldLayout.GetSlotSize()-44, layout.GetSlotSize())
+	assert.True(t, layout.Equal(record.NewLayoutFromSchema(layout.GetSchema())))
+
+	// The remaining fields keep their values, and the rebuilt index finds the moved records
+	ts, err := table.NewTableScan(tx, layout, "students")
+	require.NoError(t, err)
+	ids := []int{}
+	for {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		id, err := ts.GetInt("id")
+		require.NoError(t, err)
+		name, err := ts.GetString("name")
+		require.NoError(t, err)
+		age, err := ts.GetInt("age")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("student%d", id), name)
+		assert.Equal(t, id%3, age)
+		ids = append(ids, id)
+	}
+	ts.Close()
+	assert.Len(t, ids, 30)
+	indexInfo, err := md.GetIndexInfo("students", tx)
+	require.NoError(t, err)
+	rids, err := findByIndex(indexInfo["age"], 1)
+	require.NoError(t, err)
+	assert.Len(t, rids, 10)
+	_, err = planner.CreatePlan("SELECT bio FROM students", tx)
+	assert.Error(t, err)
+
+	// An indexed field, the only field of a table and a missing field can't be dropped
+	_, err = planner.ExecuteUpdate("ALTER TABLE students DROP COLUMN age", tx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "students_age_idx")
+	_, err = planner.ExecuteUpdate("ALTER TABLE students DROP COLUMN bio", tx)
+	assert.Error(t, err)
+	_, err = planner.ExecuteUpdate("CREATE TABLE ids (id INT)", tx)
+	require.NoError(t, err)
+	_, err = planner.ExecuteUpdate("ALTER TABLE ids DROP COLUMN id", tx)
+	assert.Error(t, err)
 }
@@ -0,0 +1,177 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+// aggregateFunctions are the names of the supported aggregate functions.
+var aggregateFunctions = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+}
+
+// IsAggregateFunction checks if name is an aggregate function such as COUNT or MAX.
+func IsAggregateFunction(name string) bool {
+	return aggregateFunctions[strings.ToLower(name)]
+}
+
+// AggregationFn is an aggregate function applied to a field, e.g. COUNT(id) or MAX(salary).
+// COUNT(*) counts records regardless of their values.
+// SUM and AVG only apply to int and bigint fields; AVG rounds toward zero.
+type AggregationFn struct {
+	name  string
+	field string
+}
+
+// NewAggregationFn creates a new aggregate function applied to the field.
+// Returns an error if the function doesn't exist or "*" is used with a function other than COUNT.
+func NewAggregationFn(name string, field string) (*AggregationFn, error) {
+	name = strings.ToLower(name)
+	if !aggregateFunctions[name] {
+		return nil, fmt.Errorf("unknown aggregate function: %s", name)
+	}
+	if field == "*" && name != "count" {
+		return nil, fmt.Errorf("function %s does not accept *", name)
+	}
+	return &AggregationFn{
+		name:  name,
+		field: field,
+	}, nil
+}
+
+// Name returns the lowercase name of the aggregate function.
+func (a *AggregationFn) Name() string {
+	return a.name
+}
+
+// Field returns the field the function is applied to, or "*" for COUNT(*).
+func (a *AggregationFn) Field() string {
+	return a.field
+}
+
+// FieldName returns the name of the output column holding the aggregate, e.g. "count(id)".
+// It is the call as written in a statement, so a field that needs quotes is quoted.
+func (a *AggregationFn) FieldName() string {
+	if a.field == "*" {
+		return a.name + "(*)"
+	}
+	return fmt.Sprintf("%s(%s)", a.name, QuoteFieldName(a.field))
+}
+
+// FieldInfo returns the type and length of the output column, given the schema of the input records.
+// MIN and MAX keep the type of their field, and so do SUM and AVG of a bigint field;
+// the other functions produce ints.
+func (a *AggregationFn) FieldInfo(sch *record.Schema) (string, int) {
+	if (a.name == "min" || a.name == "max") && sch.Type(a.field) == "string" {
+		return "string", sch.Length(a.field)
+	}
+	if a.name != "count" && sch.Type(a.field) == "bigint" {
+		return "bigint", 8
+	}
+	return "int", 4
+}
+
+// AppliesTo checks if the function's field is in the schema.
+func (a *AggregationFn) AppliesTo(sch *record.Schema) bool {
+	if a.field == "*" {
+		return true
+	}
+	_, ok := sch.GetFieldInfo(a.field)
+	return ok
+}
+
+// aggregateState accumulates the value of an aggregate function over the records of one group.
+type aggregateState struct {
+	fn    *AggregationFn
+	count int
+	sum   int
+	// long is set once a BIGINT value is added, making the sum a BIGINT
+	long  bool
+	value Constant
+}
+
+func (a *AggregationFn) newState() *aggregateState {
+	return &aggregateState{fn: a}
+}
+
+// add folds the current record of the scan into the aggregate.
+func (st *aggregateState) add(s scan.Scan) error {
+	if st.fn.field == "*" {
+		st.count++
+		return nil
+	}
+
+	val, err := NewFieldNameExpression(st.fn.field).Evaluate(s)
+	if err != nil {
+		return err
+	}
+
+	switch st.fn.name {
+	case "sum", "avg":
+		if !val.IsInt() {
+			return fmt.Errorf("function %s requires an int argument, got %s", st.fn.name, val.String())
+		}
+		st.sum += val.AsInt()
+		st.long = st.long || val.IsLong()
+	case "min":
+		if st.count == 0 || val.CompareTo(&st.value) < 0 {
+			st.value = val
+		}
+	case "max":
+		if st.count == 0 || val.CompareTo(&st.value) > 0 {
+			st.value = val
+		}
+	}
+	st.count++
+	return nil
+}
+
+// merge folds the records added to another state of the same function into this one.
+func (st *aggregateState) merge(other *aggregateState) {
+	switch st.fn.name {
+	case "min":
+		if other.count > 0 && (st.count == 0 || other.value.CompareTo(&st.value) < 0) {
+			st.value = other.value
+		}
+	case "max":
+		if other.count > 0 && (st.count == 0 || other.value.CompareTo(&st.value) > 0) {
+			st.value = other.value
+		}
+	}
+	st.count += other.count
+	st.sum += other.sum
+	st.long = st.long || other.long
+}
+
+// result returns the value of the aggregate over the records added so far.
+// With no records, COUNT, SUM and AVG are 0, and MIN and MAX hold no value.
+func (st *aggregateState) result() Constant {
+	switch st.fn.name {
+	case "count":
+		return *NewIntConstant(st.count)
+	case "sum":
+		return st.intResult(st.sum)
+	case "avg":
+		if st.count == 0 {
+			return *NewIntConstant(0)
+		}
+		return st.intResult(st.sum / st.count)
+	default:
+		return st.value
+	}
+}
+
+// intResult returns a SUM or AVG result, as a BIGINT if the values added were
+func (st *aggregateState) intResult(val int) Constant {
+	if st.long {
+		return *NewLongConstant(int64(val))
+	}
+	return *NewIntConstant(val)
+}
@@ -1,15 +1,21 @@
 package query
 
 import (
+	"cmp"
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+
+	"github.com/yashagw/cranedb/internal/record"
 )
 
 // Constant represents either an integer or string constant value.
+// A long constant is an integer holding the value of a BIGINT; it compares
+// equal to an int constant with the same value.
 type Constant struct {
 	intVal *int
 	strVal *string
+	long   bool
 }
 
 // NewIntConstant creates a new Constant with an integer value.
@@ -19,6 +25,15 @@ func NewIntConstant(val int) *Constant {
 	}
 }
 
+// NewLongConstant creates a new Constant with a BIGINT value.
+func NewLongConstant(val int64) *Constant {
+	intVal := int(val)
+	return &Constant{
+		intVal: &intVal,
+		long:   true,
+	}
+}
+
 // NewStringConstant creates a new Constant with a string value.
 func NewStringConstant(val string) *Constant {
 	return &Constant{
@@ -39,44 +54,75 @@ func (c *Constant) AsInt() int {
 	return *c.intVal
 }
 
+// AsLong returns the integer value of the constant as 8 bytes.
+func (c *Constant) AsLong() int64 {
+	return int64(*c.intVal)
+}
+
 // asString returns the string value of the constant.
 func (c *Constant) AsString() string {
 	return *c.strVal
 }
 
-// equals checks if the constant is equal to another constant.
+// Equals checks if the constant is equal to another constant, i.e. if CompareTo finds them equal.
 func (c *Constant) Equals(other *Constant) bool {
-	if c.intVal != nil && other.intVal != nil {
-		return *c.intVal == *other.intVal
+	return c.CompareTo(other) == 0
+}
+
+// CompareTo returns -1, 0, or 1 if this Constant is less than, equal to, or greater than the other, respectively.
+// Constants of different types are ordered by type, so that any constants can be sorted:
+// numbers come before strings, whatever their values.
+func (c *Constant) CompareTo(other *Constant) int {
+	if rank, otherRank := c.typeRank(), other.typeRank(); rank != otherRank {
+		return cmp.Compare(rank, otherRank)
 	}
-	if c.strVal != nil && other.strVal != nil {
-		return *c.strVal == *other.strVal
+	switch {
+	case c.intVal != nil:
+		return cmp.Compare(*c.intVal, *other.intVal)
+	case c.strVal != nil:
+		return cmp.Compare(*c.strVal, *other.strVal)
 	}
-	return false
+	return 0
 }
 
-// compareTo returns -1, 0, or 1 if this Constant is less than, equal to, or greater than the other, respectively.
-// Returns -1 if types do not match.
-func (c *Constant) CompareTo(other *Constant) int {
-	if c.intVal != nil && other.intVal != nil {
-		if *c.intVal < *other.intVal {
-			return -1
-		} else if *c.intVal > *other.intVal {
-			return 1
-		} else {
-			return 0
-		}
+// typeRank returns the position of the constant's type in the order of CompareTo. A Constant
+// without a value, such as the zero Constant, comes first.
+func (c *Constant) typeRank() int {
+	switch {
+	case c.intVal != nil:
+		return 1
+	case c.strVal != nil:
+		return 2
 	}
-	if c.strVal != nil && other.strVal != nil {
-		if *c.strVal < *other.strVal {
-			return -1
-		} else if *c.strVal > *other.strVal {
-			return 1
-		} else {
-			return 0
-		}
+	return 0
+}
+
+// ToBytes returns the key encoding of the constant (see record.EncodeKey): comparing the
+// encodings of two constants byte by byte orders them like CompareTo.
+func (c *Constant) ToBytes() []byte {
+	switch {
+	case c.intVal != nil:
+		return record.EncodeNumberKey(int64(*c.intVal))
+	case c.strVal != nil:
+		return record.EncodeStringKey(*c.strVal)
 	}
-	return -1 // types don't match
+	return []byte{}
+}
+
+// NewConstantFromBytes returns the constant of a field of the given type whose key encoding
+// is b, as ToBytes returns it.
+func NewConstantFromBytes(fieldType string, b []byte) (*Constant, error) {
+	val, err := record.DecodeKey(fieldType, b)
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case int:
+		return NewIntConstant(v), nil
+	case int64:
+		return NewLongConstant(v), nil
+	}
+	return NewStringConstant(val.(string)), nil
 }
 
 // IsInt returns true if the constant holds an integer value.
@@ -84,13 +130,19 @@ func (c *Constant) IsInt() bool {
 	return c.intVal != nil
 }
 
+// IsLong returns true if the constant holds a BIGINT value.
+func (c *Constant) IsLong() bool {
+	return c.long
+}
+
 // IsString returns true if the constant holds a string value.
 func (c *Constant) IsString() bool {
 	return c.strVal != nil
 }
 
-// Hash returns a hash of the constant.
-func (c *Constant) Hash() int {
+// HashCode returns a hash of the constant. Constants that are equal have the same hash, so it
+// can pick the bucket of a constant in a hash table.
+func (c *Constant) HashCode() int {
 	hasher := fnv.New64a()
 
 	if c.intVal != nil {
@@ -98,7 +150,7 @@ func (c *Constant) Hash() int {
 		buf[0] = 0x01
 		binary.LittleEndian.PutUint64(buf[1:], uint64(int64(*c.intVal)))
 		_, _ = hasher.Write(buf[:])
-	} else {
+	} else if c.strVal != nil {
 		_, _ = hasher.Write([]byte{0x02})
 		_, _ = hasher.Write([]byte(*c.strVal))
 	}
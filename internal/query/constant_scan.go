@@ -0,0 +1,85 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*ConstantScan)(nil)
+)
+
+// ConstantScan produces a single record holding fixed values,
+// e.g. a result that is already known without reading any table.
+type ConstantScan struct {
+	fields  []string
+	values  []Constant
+	current int
+}
+
+// NewConstantScan creates a scan over one record whose fields have the given values.
+func NewConstantScan(fields []string, values []Constant) *ConstantScan {
+	return &ConstantScan{
+		fields:  fields,
+		values:  values,
+		current: -1,
+	}
+}
+
+func (s *ConstantScan) BeforeFirst() error {
+	s.current = -1
+	return nil
+}
+
+func (s *ConstantScan) Next() (bool, error) {
+	if s.current < 1 {
+		s.current++
+	}
+	return s.current == 0, nil
+}
+
+func (s *ConstantScan) GetInt(fldname string) (int, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return 0, err
+	}
+	if !val.IsInt() {
+		return 0, fmt.Errorf("field %s is not an int", fldname)
+	}
+	return val.AsInt(), nil
+}
+
+func (s *ConstantScan) GetString(fldname string) (string, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return "", err
+	}
+	if !val.IsString() {
+		return "", fmt.Errorf("field %s is not a string", fldname)
+	}
+	return val.AsString(), nil
+}
+
+func (s *ConstantScan) GetValue(fldname string) (any, error) {
+	return s.value(fldname)
+}
+
+func (s *ConstantScan) HasField(fldname string) bool {
+	return slices.Contains(s.fields, fldname)
+}
+
+func (s *ConstantScan) Close() {}
+
+// value returns the value of the field if the scan is positioned on its record.
+func (s *ConstantScan) value(fldname string) (Constant, error) {
+	if s.current != 0 {
+		return Constant{}, fmt.Errorf("constant scan is not positioned on a record")
+	}
+	i := slices.Index(s.fields, fldname)
+	if i < 0 {
+		return Constant{}, fmt.Errorf("field %s not found in constant scan", fldname)
+	}
+	return s.values[i], nil
+}
@@ -0,0 +1,44 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConstantScanSingleRecord tests that the scan yields exactly one record with its values
+func TestConstantScanSingleRecord(t *testing.T) {
+	s := NewConstantScan([]string{"count(*)", "name"}, []Constant{*NewIntConstant(8), *NewStringConstant("Alice")})
+	defer s.Close()
+
+	assert.True(t, s.HasField("count(*)"))
+	assert.False(t, s.HasField("missing"))
+
+	// Not positioned yet
+	_, err := s.GetInt("count(*)")
+	assert.Error(t, err)
+
+	for range 2 {
+		require.NoError(t, s.BeforeFirst())
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+
+		count, err := s.GetInt("count(*)")
+		require.NoError(t, err)
+		assert.Equal(t, 8, count)
+		name, err := s.GetString("name")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", name)
+		_, err = s.GetString("count(*)")
+		assert.Error(t, err)
+
+		hasNext, err = s.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext)
+		hasNext, err = s.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext)
+	}
+}
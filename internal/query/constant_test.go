@@ -1,10 +1,13 @@
 package query
 
 import (
+	"bytes"
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/record"
 )
 
 func TestConstantBasic(t *testing.T) {
@@ -52,4 +55,133 @@ func TestConstantBasic(t *testing.T) {
 
 	// Test CompareTo with different types
 	assert.Equal(t, -1, intConst1.CompareTo(strConst1)) // types don't match
+
+	// Long constants hold values beyond 32 bits and compare with ints
+	longConst := NewLongConstant(5000000000)
+	assert.True(t, longConst.IsInt())
+	assert.True(t, longConst.IsLong())
+	assert.False(t, intConst1.IsLong())
+	assert.Equal(t, int64(5000000000), longConst.AsLong())
+	assert.Equal(t, "5000000000", longConst.String())
+	assert.Equal(t, 1, longConst.CompareTo(intConst1))
+	assert.True(t, NewLongConstant(10).Equals(intConst1))
+	assert.Equal(t, intConst1.HashCode(), NewLongConstant(10).HashCode())
+}
+
+func TestConstantOrdering(t *testing.T) {
+	// Sorted order: numbers by value, whatever their size, then strings
+	sorted := []*Constant{
+		NewLongConstant(-5000000000),
+		NewIntConstant(-1),
+		NewIntConstant(0),
+		NewIntConstant(7),
+		NewLongConstant(5000000000),
+		NewStringConstant(""),
+		NewStringConstant("10"),
+		NewStringConstant("apple"),
+		NewStringConstant("banana"),
+	}
+	for i, a := range sorted {
+		for j, b := range sorted {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			assert.Equal(t, expected, a.CompareTo(b), "%s compared to %s", a, b)
+			assert.Equal(t, i == j, a.Equals(b), "%s equals %s", a, b)
+		}
+	}
+}
+
+func TestConstantToBytes(t *testing.T) {
+	// The encodings order like the values: negative numbers first, strings after numbers,
+	// and a string before the longer ones it starts
+	sorted := []*Constant{
+		NewLongConstant(math.MinInt64),
+		NewLongConstant(-5000000000),
+		NewIntConstant(math.MinInt32),
+		NewIntConstant(-256),
+		NewIntConstant(-1),
+		NewIntConstant(0),
+		NewIntConstant(1),
+		NewIntConstant(255),
+		NewIntConstant(256),
+		NewIntConstant(math.MaxInt32),
+		NewLongConstant(5000000000),
+		NewLongConstant(math.MaxInt64),
+		NewStringConstant(""),
+		NewStringConstant("10"),
+		NewStringConstant("9"),
+		NewStringConstant("a"),
+		NewStringConstant("ab"),
+		NewStringConstant("b"),
+	}
+	// The values of fields, as index records hold them, encode the same way
+	value := func(c *Constant) any {
+		switch {
+		case c.IsLong():
+			return c.AsLong()
+		case c.IsInt():
+			return c.AsInt()
+		}
+		return c.AsString()
+	}
+	for _, a := range sorted {
+		for _, b := range sorted {
+			assert.Equal(t, a.CompareTo(b), bytes.Compare(a.ToBytes(), b.ToBytes()), "%s compared to %s", a, b)
+		}
+		key, err := record.EncodeKey(value(a))
+		require.NoError(t, err)
+		assert.Equal(t, a.ToBytes(), key)
+	}
+	_, err := record.EncodeKey(1.5)
+	assert.Error(t, err)
+
+	// An int and a bigint of the same value encode alike
+	assert.Equal(t, NewIntConstant(42).ToBytes(), NewLongConstant(42).ToBytes())
+
+	// Decoding gives back the constant, with the type of the field
+	for fieldType, c := range map[string]*Constant{
+		"int":    NewIntConstant(-7),
+		"bigint": NewLongConstant(-5000000000),
+		"string": NewStringConstant("hello"),
+	} {
+		decoded, err := NewConstantFromBytes(fieldType, c.ToBytes())
+		require.NoError(t, err)
+		assert.True(t, c.Equals(decoded))
+		assert.Equal(t, c.IsLong(), decoded.IsLong())
+	}
+	_, err = NewConstantFromBytes("int", NewStringConstant("7").ToBytes())
+	assert.Error(t, err)
+	_, err = NewConstantFromBytes("string", NewIntConstant(7).ToBytes())
+	assert.Error(t, err)
+	_, err = NewConstantFromBytes("int", NewLongConstant(5000000000).ToBytes())
+	assert.Error(t, err)
+}
+
+func TestConstantHashCode(t *testing.T) {
+	// Equal constants hash identically, whichever way they were made
+	equal := [][2]*Constant{
+		{NewIntConstant(42), NewIntConstant(42)},
+		{NewIntConstant(-3), NewLongConstant(-3)},
+		{NewStringConstant("crane"), NewStringConstant("cr" + "ane")},
+		{NewStringConstant(""), NewStringConstant("")},
+	}
+	for _, pair := range equal {
+		require.True(t, pair[0].Equals(pair[1]))
+		assert.Equal(t, pair[0].HashCode(), pair[1].HashCode(), "%s", pair[0])
+	}
+
+	// An int and the string of its digits differ, and so do their hashes
+	assert.False(t, NewIntConstant(1).Equals(NewStringConstant("1")))
+	assert.NotEqual(t, NewIntConstant(1).HashCode(), NewStringConstant("1").HashCode())
+
+	// The zero Constant equals only itself and comes before any value
+	var zero Constant
+	assert.True(t, zero.Equals(&Constant{}))
+	assert.False(t, zero.Equals(NewIntConstant(0)))
+	assert.Equal(t, -1, zero.CompareTo(NewIntConstant(math.MinInt32)))
+	assert.Equal(t, zero.HashCode(), (&Constant{}).HashCode())
 }
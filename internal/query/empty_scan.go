@@ -0,0 +1,53 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*EmptyScan)(nil)
+)
+
+// EmptyScan produces no records, e.g. for a query whose predicate can never be satisfied.
+// It still has the fields of the records it would produce.
+type EmptyScan struct {
+	fields []string
+}
+
+// NewEmptyScan creates a scan without records whose records would have the given fields.
+func NewEmptyScan(fields []string) *EmptyScan {
+	return &EmptyScan{fields: fields}
+}
+
+func (s *EmptyScan) BeforeFirst() error {
+	return nil
+}
+
+func (s *EmptyScan) Next() (bool, error) {
+	return false, nil
+}
+
+func (s *EmptyScan) GetInt(fldname string) (int, error) {
+	return 0, s.noRecord()
+}
+
+func (s *EmptyScan) GetString(fldname string) (string, error) {
+	return "", s.noRecord()
+}
+
+func (s *EmptyScan) GetValue(fldname string) (any, error) {
+	return nil, s.noRecord()
+}
+
+func (s *EmptyScan) HasField(fldname string) bool {
+	return slices.Contains(s.fields, fldname)
+}
+
+func (s *EmptyScan) Close() {}
+
+func (s *EmptyScan) noRecord() error {
+	return fmt.Errorf("empty scan has no records")
+}
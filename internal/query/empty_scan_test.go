@@ -0,0 +1,27 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmptyScan(t *testing.T) {
+	s := NewEmptyScan([]string{"id", "name"})
+	defer s.Close()
+
+	assert.True(t, s.HasField("name"))
+	assert.False(t, s.HasField("missing"))
+
+	for range 2 {
+		require.NoError(t, s.BeforeFirst())
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext)
+	}
+	_, err := s.GetInt("id")
+	assert.Error(t, err)
+	_, err = s.GetValue("name")
+	assert.Error(t, err)
+}
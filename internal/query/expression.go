@@ -1,16 +1,56 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
 )
 
-// Expression represents either a constant value or a field name in a query.
+// ErrDivisionByZero is returned when an expression divides by zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrIntegerOverflow is returned when arithmetic produces a value outside the range of an INT,
+// or of a BIGINT when an operand is a BIGINT.
+var ErrIntegerOverflow = errors.New("integer overflow")
+
+// ArithmeticOperator is the operator of a binary arithmetic expression.
+type ArithmeticOperator rune
+
+const (
+	OpAdd      ArithmeticOperator = '+'
+	OpSubtract ArithmeticOperator = '-'
+	OpMultiply ArithmeticOperator = '*'
+	OpDivide   ArithmeticOperator = '/'
+	OpConcat   ArithmeticOperator = '|'
+)
+
+// String returns the SQL symbol of the operator.
+func (op ArithmeticOperator) String() string {
+	if op == OpConcat {
+		return "||"
+	}
+	return string(rune(op))
+}
+
+// Expression represents a constant value, a field name, a binary
+// operation over two other expressions, a function call, a scalar subquery or a placeholder in a query.
 type Expression struct {
-	val     Constant
-	fldName *string
+	val      Constant
+	fldName  *string
+	op       ArithmeticOperator
+	lhs      *Expression
+	rhs      *Expression
+	fnName   string
+	args     []*Expression
+	subquery *Subquery
+	// placeholder is the name of a placeholder, such as ?, that stands for a value given later
+	placeholder string
+	// aggregate is set for a field name that refers to the output column of an aggregate
+	aggregate bool
 }
 
 // NewConstantExpression creates a new Expression with a constant value.
@@ -27,6 +67,68 @@ func NewFieldNameExpression(fldName string) *Expression {
 	}
 }
 
+// NewAggregateExpression creates an Expression referring to the output column of an aggregate
+// function. It is written as the function call rather than as a field name.
+func NewAggregateExpression(fn *AggregationFn) *Expression {
+	fldName := fn.FieldName()
+	return &Expression{
+		fldName:   &fldName,
+		aggregate: true,
+	}
+}
+
+// NewBinaryExpression creates a new Expression applying a binary operator to two expressions.
+// Arithmetic is only defined on int values, and produces a BIGINT if either operand is one;
+// concatenation converts ints to text.
+func NewBinaryExpression(lhs *Expression, op ArithmeticOperator, rhs *Expression) *Expression {
+	return &Expression{
+		op:  op,
+		lhs: lhs,
+		rhs: rhs,
+	}
+}
+
+// NewSubqueryExpression creates a new Expression whose value is the single value a subquery returns.
+// The planner replaces it with that value before the expression is evaluated.
+func NewSubqueryExpression(subquery *Subquery) *Expression {
+	return &Expression{
+		subquery: subquery,
+	}
+}
+
+// NewPlaceholderExpression creates a new Expression standing for a value that is given later,
+// e.g. a parameter of a prepared statement. SubstituteConstant replaces it with that value.
+func NewPlaceholderExpression(name string) *Expression {
+	return &Expression{
+		placeholder: name,
+	}
+}
+
+// IsBinary checks if the expression is an arithmetic operation.
+func (e *Expression) IsBinary() bool {
+	return e.lhs != nil
+}
+
+// IsFunction checks if the expression is a function call.
+func (e *Expression) IsFunction() bool {
+	return e.fnName != ""
+}
+
+// IsSubquery checks if the expression is a scalar subquery.
+func (e *Expression) IsSubquery() bool {
+	return e.subquery != nil
+}
+
+// AsSubquery returns the subquery of the expression.
+func (e *Expression) AsSubquery() *Subquery {
+	return e.subquery
+}
+
+// IsPlaceholder checks if the expression is a placeholder.
+func (e *Expression) IsPlaceholder() bool {
+	return e.placeholder != ""
+}
+
 // isFieldName checks if the expression is a field name.
 func (e *Expression) IsFieldName() bool {
 	return e.fldName != nil
@@ -44,19 +146,59 @@ func (e *Expression) AsFieldName() string {
 
 // IsConstant checks if the expression is a constant value.
 func (e *Expression) IsConstant() bool {
-	return e.fldName == nil
+	return e.fldName == nil && !e.IsBinary() && !e.IsFunction() && !e.IsSubquery() && !e.IsPlaceholder()
 }
 
 // String returns a string representation of the expression.
+// Nested arithmetic operands are parenthesized and string constants quoted, so the result
+// parses back to the same expression.
 func (e *Expression) String() string {
+	if e.IsBinary() {
+		return fmt.Sprintf("%s %s %s", e.lhs.operandString(), e.op.String(), e.rhs.operandString())
+	}
+	if e.IsFunction() {
+		args := make([]string, len(e.args))
+		for i, arg := range e.args {
+			args[i] = arg.String()
+		}
+		return fmt.Sprintf("%s(%s)", e.fnName, strings.Join(args, ", "))
+	}
+	if e.IsFieldName() && !e.aggregate {
+		return QuoteFieldName(e.AsFieldName())
+	}
 	if e.IsFieldName() {
 		return e.AsFieldName()
 	}
-	return e.val.String()
+	if e.IsSubquery() {
+		return e.subquery.String()
+	}
+	if e.IsPlaceholder() {
+		return e.placeholder
+	}
+	return constantString(e.val)
+}
+
+func (e *Expression) operandString() string {
+	if e.IsBinary() {
+		return "(" + e.String() + ")"
+	}
+	return e.String()
 }
 
 // evaluate returns the value of the expression for the current record in the scan.
 func (e *Expression) Evaluate(s scan.Scan) (Constant, error) {
+	if e.IsBinary() {
+		return e.evaluateBinary(s)
+	}
+	if e.IsFunction() {
+		return e.evaluateFunction(s)
+	}
+	if e.IsSubquery() {
+		return Constant{}, e.subquery.unboundError()
+	}
+	if e.IsPlaceholder() {
+		return Constant{}, fmt.Errorf("placeholder %s has no value", e.placeholder)
+	}
 	if e.IsFieldName() {
 		val, err := s.GetValue(e.AsFieldName())
 		if err != nil {
@@ -66,6 +208,8 @@ func (e *Expression) Evaluate(s scan.Scan) (Constant, error) {
 		switch v := val.(type) {
 		case int:
 			return *NewIntConstant(v), nil
+		case int64:
+			return *NewLongConstant(v), nil
 		case string:
 			return *NewStringConstant(v), nil
 		case Constant:
@@ -77,10 +221,261 @@ func (e *Expression) Evaluate(s scan.Scan) (Constant, error) {
 	return e.val, nil
 }
 
+// evaluateBinary evaluates both operands and applies the arithmetic operator.
+func (e *Expression) evaluateBinary(s scan.Scan) (Constant, error) {
+	lhsVal, err := e.lhs.Evaluate(s)
+	if err != nil {
+		return Constant{}, err
+	}
+	rhsVal, err := e.rhs.Evaluate(s)
+	if err != nil {
+		return Constant{}, err
+	}
+	if e.op == OpConcat {
+		return concat(lhsVal, rhsVal), nil
+	}
+	if !lhsVal.IsInt() || !rhsVal.IsInt() {
+		return Constant{}, fmt.Errorf("arithmetic requires int values: %s", e.String())
+	}
+
+	if lhsVal.IsLong() || rhsVal.IsLong() {
+		return e.evaluateLong(lhsVal.AsLong(), rhsVal.AsLong())
+	}
+
+	lhs, rhs := lhsVal.AsInt(), rhsVal.AsInt()
+	if !fitsInt32(lhs) || !fitsInt32(rhs) {
+		return Constant{}, fmt.Errorf("%w: %s", ErrIntegerOverflow, e.String())
+	}
+	// The operands fit in 32 bits, so the result can't overflow a Go int
+	var result int
+	switch e.op {
+	case OpAdd:
+		result = lhs + rhs
+	case OpSubtract:
+		result = lhs - rhs
+	case OpMultiply:
+		result = lhs * rhs
+	case OpDivide:
+		if rhs == 0 {
+			return Constant{}, ErrDivisionByZero
+		}
+		result = lhs / rhs
+	default:
+		return Constant{}, fmt.Errorf("unknown arithmetic operator: %s", e.op.String())
+	}
+	if !fitsInt32(result) {
+		return Constant{}, fmt.Errorf("%w: %s", ErrIntegerOverflow, e.String())
+	}
+	return *NewIntConstant(result), nil
+}
+
+// evaluateLong applies the arithmetic operator to BIGINT operands.
+func (e *Expression) evaluateLong(lhs int64, rhs int64) (Constant, error) {
+	var result int64
+	overflow := false
+	switch e.op {
+	case OpAdd:
+		result = lhs + rhs
+		overflow = (lhs >= 0) == (rhs >= 0) && (result >= 0) != (lhs >= 0)
+	case OpSubtract:
+		result = lhs - rhs
+		overflow = (lhs >= 0) != (rhs >= 0) && (result >= 0) != (lhs >= 0)
+	case OpMultiply:
+		result = lhs * rhs
+		overflow = lhs != 0 && (result/lhs != rhs || (lhs == -1 && rhs == math.MinInt64))
+	case OpDivide:
+		if rhs == 0 {
+			return Constant{}, ErrDivisionByZero
+		}
+		overflow = lhs == math.MinInt64 && rhs == -1
+		result = lhs / rhs
+	default:
+		return Constant{}, fmt.Errorf("unknown arithmetic operator: %s", e.op.String())
+	}
+	if overflow {
+		return Constant{}, fmt.Errorf("%w: %s", ErrIntegerOverflow, e.String())
+	}
+	return *NewLongConstant(result), nil
+}
+
+// fitsInt32 checks if the value is in the range of an INT
+func fitsInt32(val int) bool {
+	return val >= math.MinInt32 && val <= math.MaxInt32
+}
+
+// evaluateFunction evaluates the arguments and calls the function.
+func (e *Expression) evaluateFunction(s scan.Scan) (Constant, error) {
+	args := make([]Constant, len(e.args))
+	for i, arg := range e.args {
+		val, err := arg.Evaluate(s)
+		if err != nil {
+			return Constant{}, err
+		}
+		args[i] = val
+	}
+	return scalarFunctions[e.fnName].evaluate(args)
+}
+
+// FieldInfo returns the type and length of the values the expression produces
+// when evaluated against records of the given schema.
+func (e *Expression) FieldInfo(sch *record.Schema) (fieldType string, length int) {
+	switch {
+	case e.IsFieldName():
+		return sch.Type(e.AsFieldName()), sch.Length(e.AsFieldName())
+	case e.IsBinary() && e.op == OpConcat:
+		return "string", e.lhs.textLength(sch) + e.rhs.textLength(sch)
+	case e.IsBinary():
+		lhsType, _ := e.lhs.FieldInfo(sch)
+		rhsType, _ := e.rhs.FieldInfo(sch)
+		if lhsType == "bigint" || rhsType == "bigint" {
+			return "bigint", 8
+		}
+		return "int", 4
+	case e.IsFunction() && (e.fnName == "upper" || e.fnName == "lower" || e.fnName == "substr"):
+		// These fail on a number when evaluated, but never produce one
+		return "string", e.args[0].textLength(sch)
+	case e.IsFunction():
+		return "int", 4
+	case e.val.IsString():
+		return "string", len(e.val.AsString())
+	case e.val.IsLong():
+		return "bigint", 8
+	default:
+		return "int", 4
+	}
+}
+
+// textLength returns the maximum length of the expression's values converted to text.
+// An int takes at most 11 characters, e.g. -2147483648, and a bigint 20.
+func (e *Expression) textLength(sch *record.Schema) int {
+	fieldType, length := e.FieldInfo(sch)
+	if fieldType == "int" {
+		return 11
+	}
+	if fieldType == "bigint" {
+		return 20
+	}
+	return length
+}
+
 // appliesTo checks if the expression applies to the given schema.
 func (e *Expression) AppliesTo(schema *record.Schema) bool {
+	if e.IsBinary() {
+		return e.lhs.AppliesTo(schema) && e.rhs.AppliesTo(schema)
+	}
+	if e.IsFunction() {
+		for _, arg := range e.args {
+			if !arg.AppliesTo(schema) {
+				return false
+			}
+		}
+		return true
+	}
 	if e.IsFieldName() {
 		return schema.HasField(e.AsFieldName())
 	}
 	return true
 }
+
+// WithFieldValues returns a copy of the expression with the given fields replaced by their values.
+func (e *Expression) WithFieldValues(values map[string]Constant) *Expression {
+	return e.substitute(func(expr *Expression) (Constant, bool) {
+		if !expr.IsFieldName() {
+			return Constant{}, false
+		}
+		val, ok := values[expr.AsFieldName()]
+		return val, ok
+	})
+}
+
+// WithSubqueryValues returns a copy of the expression with the given scalar subqueries
+// replaced by their values.
+func (e *Expression) WithSubqueryValues(values map[*Subquery]Constant) *Expression {
+	return e.substitute(func(expr *Expression) (Constant, bool) {
+		val, ok := values[expr.subquery]
+		return val, ok && expr.IsSubquery()
+	})
+}
+
+// SubstituteConstant returns a copy of the expression with the placeholders or the fields
+// of the given name replaced by the value.
+func (e *Expression) SubstituteConstant(placeholderOrField string, value Constant) *Expression {
+	return e.substitute(func(expr *Expression) (Constant, bool) {
+		if expr.IsPlaceholder() {
+			return value, expr.placeholder == placeholderOrField
+		}
+		return value, expr.IsFieldName() && !expr.aggregate && expr.AsFieldName() == placeholderOrField
+	})
+}
+
+// HasPlaceholders checks if the expression holds a placeholder.
+func (e *Expression) HasPlaceholders() bool {
+	switch {
+	case e.IsBinary():
+		return e.lhs.HasPlaceholders() || e.rhs.HasPlaceholders()
+	case e.IsFunction():
+		for _, arg := range e.args {
+			if arg.HasPlaceholders() {
+				return true
+			}
+		}
+		return false
+	}
+	return e.IsPlaceholder()
+}
+
+// Subqueries returns the scalar subqueries of the expression, in order of appearance.
+func (e *Expression) Subqueries() []*Subquery {
+	switch {
+	case e.IsBinary():
+		return append(e.lhs.Subqueries(), e.rhs.Subqueries()...)
+	case e.IsFunction():
+		var subqueries []*Subquery
+		for _, arg := range e.args {
+			subqueries = append(subqueries, arg.Subqueries()...)
+		}
+		return subqueries
+	case e.IsSubquery():
+		return []*Subquery{e.subquery}
+	}
+	return nil
+}
+
+// substitute returns a copy of the expression in which every field or subquery that value
+// returns a constant for is replaced by that constant.
+func (e *Expression) substitute(value func(*Expression) (Constant, bool)) *Expression {
+	if val, ok := value(e); ok {
+		return NewConstantExpression(val)
+	}
+	switch {
+	case e.IsBinary():
+		return NewBinaryExpression(e.lhs.substitute(value), e.op, e.rhs.substitute(value))
+	case e.IsFunction():
+		result := *e
+		result.args = make([]*Expression, len(e.args))
+		for i, arg := range e.args {
+			result.args[i] = arg.substitute(value)
+		}
+		return &result
+	}
+	result := *e
+	return &result
+}
+
+// FieldNames returns the names of the fields the expression refers to, in order of appearance.
+func (e *Expression) FieldNames() []string {
+	if e.IsBinary() {
+		return append(e.lhs.FieldNames(), e.rhs.FieldNames()...)
+	}
+	if e.IsFunction() {
+		var fields []string
+		for _, arg := range e.args {
+			fields = append(fields, arg.FieldNames()...)
+		}
+		return fields
+	}
+	if e.IsFieldName() {
+		return []string{e.AsFieldName()}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package query
 
 import (
+	"math"
 	"os"
 	"testing"
 
@@ -29,7 +30,7 @@ func TestExpressionBasic(t *testing.T) {
 	require.NotNil(t, strExpr)
 	assert.False(t, strExpr.IsFieldName())
 	assert.Equal(t, *strConst, strExpr.AsConstant())
-	assert.Equal(t, "hello", strExpr.String())
+	assert.Equal(t, "'hello'", strExpr.String())
 
 	// Test creating field name expression
 	fieldExpr := NewFieldNameExpression("age")
@@ -144,3 +145,122 @@ func TestExpressionEvaluate(t *testing.T) {
 	ts.Close()
 	tx.Commit()
 }
+
+func TestExpressionArithmetic(t *testing.T) {
+	intExpr := func(v int) *Expression { return NewConstantExpression(*NewIntConstant(v)) }
+
+	tests := []struct {
+		expr     *Expression
+		str      string
+		expected int
+	}{
+		{NewBinaryExpression(intExpr(7), OpAdd, intExpr(3)), "7 + 3", 10},
+		{NewBinaryExpression(intExpr(7), OpSubtract, intExpr(3)), "7 - 3", 4},
+		{NewBinaryExpression(intExpr(7), OpMultiply, intExpr(3)), "7 * 3", 21},
+		{NewBinaryExpression(intExpr(7), OpDivide, intExpr(3)), "7 / 3", 2},
+		{NewBinaryExpression(NewBinaryExpression(intExpr(1), OpAdd, intExpr(2)), OpMultiply, intExpr(4)), "(1 + 2) * 4", 12},
+		{NewBinaryExpression(intExpr(1), OpAdd, NewBinaryExpression(intExpr(2), OpMultiply, intExpr(4))), "1 + (2 * 4)", 9},
+	}
+	for _, tt := range tests {
+		assert.True(t, tt.expr.IsBinary())
+		assert.False(t, tt.expr.IsConstant())
+		assert.False(t, tt.expr.IsFieldName())
+		assert.Equal(t, tt.str, tt.expr.String())
+		val, err := tt.expr.Evaluate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, val.AsInt(), tt.str)
+	}
+
+	// Division by zero is an error, not a panic
+	_, err := NewBinaryExpression(intExpr(1), OpDivide, intExpr(0)).Evaluate(nil)
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+
+	// Results outside the range of an INT are an error, not a wraparound
+	maxInt := intExpr(2147483647)
+	minInt := intExpr(-2147483648)
+	for _, expr := range []*Expression{
+		NewBinaryExpression(maxInt, OpAdd, intExpr(1)),
+		NewBinaryExpression(minInt, OpSubtract, intExpr(1)),
+		NewBinaryExpression(intExpr(65536), OpMultiply, intExpr(65536)),
+		NewBinaryExpression(minInt, OpDivide, intExpr(-1)),
+		NewBinaryExpression(intExpr(2147483648), OpAdd, intExpr(0)),
+	} {
+		_, err = expr.Evaluate(nil)
+		assert.ErrorIs(t, err, ErrIntegerOverflow, expr.String())
+	}
+	_, err = NewBinaryExpression(minInt, OpAdd, intExpr(1)).Evaluate(nil)
+	assert.NoError(t, err)
+	val, err := NewBinaryExpression(maxInt, OpSubtract, intExpr(2147483647)).Evaluate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, val.AsInt())
+
+	// With a BIGINT operand, arithmetic is done on 8 bytes and produces a BIGINT
+	longExpr := func(v int64) *Expression { return NewConstantExpression(*NewLongConstant(v)) }
+	val, err = NewBinaryExpression(longExpr(3000000000), OpMultiply, intExpr(1000)).Evaluate(nil)
+	require.NoError(t, err)
+	assert.True(t, val.IsLong())
+	assert.Equal(t, int64(3000000000000), val.AsLong())
+	val, err = NewBinaryExpression(intExpr(2147483647), OpAdd, longExpr(1)).Evaluate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2147483648), val.AsLong())
+	maxLong := longExpr(math.MaxInt64)
+	minLong := longExpr(math.MinInt64)
+	for _, expr := range []*Expression{
+		NewBinaryExpression(maxLong, OpAdd, longExpr(1)),
+		NewBinaryExpression(minLong, OpSubtract, longExpr(1)),
+		NewBinaryExpression(longExpr(1<<32), OpMultiply, longExpr(1<<32)),
+		NewBinaryExpression(minLong, OpMultiply, longExpr(-1)),
+		NewBinaryExpression(minLong, OpDivide, longExpr(-1)),
+	} {
+		_, err = expr.Evaluate(nil)
+		assert.ErrorIs(t, err, ErrIntegerOverflow, expr.String())
+	}
+	_, err = NewBinaryExpression(longExpr(1), OpDivide, longExpr(0)).Evaluate(nil)
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+
+	// Arithmetic on strings is an error
+	strExpr := NewConstantExpression(*NewStringConstant("a"))
+	_, err = NewBinaryExpression(intExpr(1), OpAdd, strExpr).Evaluate(nil)
+	assert.Error(t, err)
+
+	// A binary expression applies to a schema only if both operands do
+	schema := record.NewSchema()
+	schema.AddIntField("salary")
+	salaryTimesTwo := NewBinaryExpression(NewFieldNameExpression("salary"), OpMultiply, intExpr(2))
+	assert.True(t, salaryTimesTwo.AppliesTo(schema))
+	assert.False(t, NewBinaryExpression(NewFieldNameExpression("salary"), OpAdd, NewFieldNameExpression("bonus")).AppliesTo(schema))
+}
+
+func TestExpressionFieldNames(t *testing.T) {
+	assert.Empty(t, NewConstantExpression(*NewIntConstant(1)).FieldNames())
+	assert.Equal(t, []string{"age"}, NewFieldNameExpression("age").FieldNames())
+
+	// (age + bonus) * 2
+	sum := NewBinaryExpression(NewFieldNameExpression("age"), OpAdd, NewFieldNameExpression("bonus"))
+	expr := NewBinaryExpression(sum, OpMultiply, NewConstantExpression(*NewIntConstant(2)))
+	assert.Equal(t, []string{"age", "bonus"}, expr.FieldNames())
+
+	term := NewTerm(*NewFieldNameExpression("id"), *NewFieldNameExpression("student_id"))
+	assert.Equal(t, []string{"id", "student_id"}, term.FieldNames())
+	in := NewInTerm(*NewFieldNameExpression("id"), []Constant{*NewIntConstant(1)})
+	assert.Equal(t, []string{"id"}, in.FieldNames())
+}
+
+func TestExpressionSubquery(t *testing.T) {
+	subquery := NewSubquery(stringQuery("SELECT max(salary) FROM employees"))
+	expr := NewBinaryExpression(NewSubqueryExpression(subquery), OpSubtract, NewConstantExpression(*NewIntConstant(10)))
+	assert.Equal(t, "(SELECT max(salary) FROM employees) - 10", expr.String())
+	assert.Equal(t, []*Subquery{subquery}, expr.Subqueries())
+	assert.False(t, NewSubqueryExpression(subquery).IsConstant())
+
+	// Until the planner substitutes its value, the subquery can't be evaluated
+	_, err := expr.Evaluate(nil)
+	assert.ErrorContains(t, err, "only supported in the WHERE clause of a query")
+
+	bound := expr.WithSubqueryValues(map[*Subquery]Constant{subquery: *NewIntConstant(120)})
+	assert.Equal(t, "120 - 10", bound.String())
+	assert.Empty(t, bound.Subqueries())
+	val, err := bound.Evaluate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, 110, val.AsInt())
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*ExtendScan)(nil)
+)
+
+// ExtendScan adds a computed field to the records of its input scan.
+// The field's value is the expression evaluated against the current record.
+type ExtendScan struct {
+	input     scan.Scan
+	fieldName string
+	expr      Expression
+}
+
+func NewExtendScan(input scan.Scan, fieldName string, expr Expression) *ExtendScan {
+	return &ExtendScan{
+		input:     input,
+		fieldName: fieldName,
+		expr:      expr,
+	}
+}
+
+func (s *ExtendScan) BeforeFirst() error {
+	return s.input.BeforeFirst()
+}
+
+func (s *ExtendScan) Next() (bool, error) {
+	return s.input.Next()
+}
+
+func (s *ExtendScan) GetInt(fldname string) (int, error) {
+	if fldname != s.fieldName {
+		return s.input.GetInt(fldname)
+	}
+	val, err := s.expr.Evaluate(s.input)
+	if err != nil {
+		return 0, err
+	}
+	return val.AsInt(), nil
+}
+
+func (s *ExtendScan) GetString(fldname string) (string, error) {
+	if fldname != s.fieldName {
+		return s.input.GetString(fldname)
+	}
+	val, err := s.expr.Evaluate(s.input)
+	if err != nil {
+		return "", err
+	}
+	return val.AsString(), nil
+}
+
+func (s *ExtendScan) GetValue(fldname string) (any, error) {
+	if fldname != s.fieldName {
+		return s.input.GetValue(fldname)
+	}
+	return s.expr.Evaluate(s.input)
+}
+
+func (s *ExtendScan) HasField(fldname string) bool {
+	return fldname == s.fieldName || s.input.HasField(fldname)
+}
+
+func (s *ExtendScan) Close() {
+	s.input.Close()
+}
@@ -0,0 +1,60 @@
+package query
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtendScanComputedField tests reading a computed field alongside the input fields
+func TestExtendScanComputedField(t *testing.T) {
+	testDir := "/tmp/testdb_extendscan"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	// age * 2
+	expr := NewBinaryExpression(NewFieldNameExpression("age"), OpMultiply, NewConstantExpression(*NewIntConstant(2)))
+	extendScan := NewExtendScan(ts, "double_age", *expr)
+	defer extendScan.Close()
+
+	assert.True(t, extendScan.HasField("double_age"))
+	assert.True(t, extendScan.HasField("age"))
+	assert.False(t, extendScan.HasField("missing"))
+
+	err := extendScan.BeforeFirst()
+	require.NoError(t, err)
+	count := 0
+	for {
+		hasNext, err := extendScan.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		count++
+		age, err := extendScan.GetInt("age")
+		require.NoError(t, err)
+		doubled, err := extendScan.GetInt("double_age")
+		require.NoError(t, err)
+		assert.Equal(t, age*2, doubled)
+
+		val, err := extendScan.GetValue("double_age")
+		require.NoError(t, err)
+		assert.Equal(t, *NewIntConstant(age * 2), val)
+	}
+	assert.Equal(t, 8, count)
+
+	// Division by zero surfaces as an error when the field is read
+	divExpr := NewBinaryExpression(NewFieldNameExpression("age"), OpDivide, NewConstantExpression(*NewIntConstant(0)))
+	divScan := NewExtendScan(ts, "bad", *divExpr)
+	err = divScan.BeforeFirst()
+	require.NoError(t, err)
+	hasNext, err := divScan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	_, err = divScan.GetInt("bad")
+	assert.ErrorIs(t, err, ErrDivisionByZero)
+}
@@ -0,0 +1,115 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// scalarFunction is a built-in function that can be called in an expression.
+type scalarFunction struct {
+	numArgs  int
+	evaluate func(args []Constant) (Constant, error)
+}
+
+// scalarFunctions are the built-in functions, keyed by lowercase name.
+var scalarFunctions = map[string]scalarFunction{
+	"upper":  {numArgs: 1, evaluate: evalUpper},
+	"lower":  {numArgs: 1, evaluate: evalLower},
+	"length": {numArgs: 1, evaluate: evalLength},
+	"substr": {numArgs: 3, evaluate: evalSubstr},
+}
+
+// NewFunctionExpression creates a new Expression calling a built-in function.
+// Returns an error if the function doesn't exist or the number of arguments is wrong.
+func NewFunctionExpression(name string, args []*Expression) (*Expression, error) {
+	name = strings.ToLower(name)
+	fn, ok := scalarFunctions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+	if len(args) != fn.numArgs {
+		return nil, fmt.Errorf("function %s takes %d arguments, got %d", name, fn.numArgs, len(args))
+	}
+	return &Expression{
+		fnName: name,
+		args:   args,
+	}, nil
+}
+
+func stringArg(fnName string, arg Constant) (string, error) {
+	if !arg.IsString() {
+		return "", fmt.Errorf("function %s requires a string argument, got %s", fnName, arg.String())
+	}
+	return arg.AsString(), nil
+}
+
+func intArg(fnName string, arg Constant) (int, error) {
+	if !arg.IsInt() {
+		return 0, fmt.Errorf("function %s requires an int argument, got %s", fnName, arg.String())
+	}
+	return arg.AsInt(), nil
+}
+
+func evalUpper(args []Constant) (Constant, error) {
+	s, err := stringArg("upper", args[0])
+	if err != nil {
+		return Constant{}, err
+	}
+	return *NewStringConstant(strings.ToUpper(s)), nil
+}
+
+func evalLower(args []Constant) (Constant, error) {
+	s, err := stringArg("lower", args[0])
+	if err != nil {
+		return Constant{}, err
+	}
+	return *NewStringConstant(strings.ToLower(s)), nil
+}
+
+func evalLength(args []Constant) (Constant, error) {
+	s, err := stringArg("length", args[0])
+	if err != nil {
+		return Constant{}, err
+	}
+	return *NewIntConstant(utf8.RuneCountInString(s)), nil
+}
+
+// evalSubstr returns length characters starting at the 1-based position start.
+// Positions outside the string are clamped, so out-of-range arguments give a
+// shorter (possibly empty) result rather than an error.
+func evalSubstr(args []Constant) (Constant, error) {
+	s, err := stringArg("substr", args[0])
+	if err != nil {
+		return Constant{}, err
+	}
+	start, err := intArg("substr", args[1])
+	if err != nil {
+		return Constant{}, err
+	}
+	length, err := intArg("substr", args[2])
+	if err != nil {
+		return Constant{}, err
+	}
+
+	runes := []rune(s)
+	from := max(start, 1)
+	to := min(start+length, len(runes)+1)
+	if to <= from {
+		return *NewStringConstant(""), nil
+	}
+	return *NewStringConstant(string(runes[from-1 : to-1])), nil
+}
+
+// concat joins the text of two values. Ints are converted to their decimal text.
+func concat(lhs Constant, rhs Constant) Constant {
+	return *NewStringConstant(constantText(lhs) + constantText(rhs))
+}
+
+func constantText(c Constant) string {
+	if c.IsInt() {
+		return strconv.Itoa(c.AsInt())
+	}
+	return c.AsString()
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/record"
+)
+
+func TestFunctionExpressions(t *testing.T) {
+	str := func(v string) *Expression { return NewConstantExpression(*NewStringConstant(v)) }
+	num := func(v int) *Expression { return NewConstantExpression(*NewIntConstant(v)) }
+	call := func(name string, args ...*Expression) *Expression {
+		e, err := NewFunctionExpression(name, args)
+		require.NoError(t, err)
+		return e
+	}
+
+	tests := []struct {
+		expr     *Expression
+		str      string
+		expected Constant
+	}{
+		{call("upper", str("Alice")), "upper('Alice')", *NewStringConstant("ALICE")},
+		{call("LOWER", str("Alice")), "lower('Alice')", *NewStringConstant("alice")},
+		{call("length", str("Alice")), "length('Alice')", *NewIntConstant(5)},
+		{call("length", str("")), "length('')", *NewIntConstant(0)},
+		{call("substr", str("Charlie"), num(2), num(3)), "substr('Charlie', 2, 3)", *NewStringConstant("har")},
+		{NewBinaryExpression(str("id-"), OpConcat, num(7)), "'id-' || 7", *NewStringConstant("id-7")},
+		{call("upper", NewBinaryExpression(str("a"), OpConcat, str("b"))), "upper('a' || 'b')", *NewStringConstant("AB")},
+	}
+	for _, tt := range tests {
+		assert.True(t, tt.expr.IsFunction() || tt.expr.IsBinary())
+		assert.False(t, tt.expr.IsConstant())
+		assert.Equal(t, tt.str, tt.expr.String())
+		val, err := tt.expr.Evaluate(nil)
+		require.NoError(t, err, tt.str)
+		assert.Equal(t, tt.expected, val, tt.str)
+	}
+
+	// SUBSTR clamps out-of-range arguments
+	substrTests := []struct {
+		start, length int
+		expected      string
+	}{
+		{1, 100, "Charlie"},
+		{0, 3, "Ch"},
+		{-5, 10, "Char"},
+		{6, 10, "ie"},
+		{8, 2, ""},
+		{100, 2, ""},
+		{3, 0, ""},
+		{3, -1, ""},
+	}
+	for _, tt := range substrTests {
+		val, err := call("substr", str("Charlie"), num(tt.start), num(tt.length)).Evaluate(nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, val.AsString(), "substr(Charlie, %d, %d)", tt.start, tt.length)
+	}
+
+	// String functions on ints are errors
+	for _, name := range []string{"upper", "lower", "length"} {
+		_, err := call(name, num(5)).Evaluate(nil)
+		assert.Error(t, err, name)
+	}
+	_, err := call("substr", num(12345), num(1), num(2)).Evaluate(nil)
+	assert.Error(t, err)
+	_, err = call("substr", str("abc"), str("1"), num(2)).Evaluate(nil)
+	assert.Error(t, err)
+
+	// Unknown functions and wrong argument counts are rejected
+	_, err = NewFunctionExpression("reverse", []*Expression{str("abc")})
+	assert.Error(t, err)
+	_, err = NewFunctionExpression("upper", []*Expression{str("a"), str("b")})
+	assert.Error(t, err)
+}
+
+func TestExpressionFieldInfo(t *testing.T) {
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 20)
+
+	upper, err := NewFunctionExpression("upper", []*Expression{NewFieldNameExpression("name")})
+	require.NoError(t, err)
+	length, err := NewFunctionExpression("length", []*Expression{NewFieldNameExpression("name")})
+	require.NoError(t, err)
+
+	tests := []struct {
+		expr         *Expression
+		expectedType string
+		expectedLen  int
+	}{
+		{NewFieldNameExpression("name"), "string", 20},
+		{upper, "string", 20},
+		{length, "int", 4},
+		{NewBinaryExpression(NewFieldNameExpression("id"), OpMultiply, NewConstantExpression(*NewIntConstant(2))), "int", 4},
+		{NewBinaryExpression(NewFieldNameExpression("name"), OpConcat, NewFieldNameExpression("id")), "string", 31},
+		{NewConstantExpression(*NewStringConstant("abc")), "string", 3},
+	}
+	for _, tt := range tests {
+		fieldType, length := tt.expr.FieldInfo(schema)
+		assert.Equal(t, tt.expectedType, fieldType, tt.expr.String())
+		assert.Equal(t, tt.expectedLen, length, tt.expr.String())
+	}
+}
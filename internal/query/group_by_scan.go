@@ -0,0 +1,302 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*GroupByScan)(nil)
+)
+
+// ErrResultTooLarge is returned when a query would hold or return more rows than its limit
+var ErrResultTooLarge = errors.New("result too large")
+
+// group holds the grouping values of one group and its aggregates.
+type group struct {
+	values []Constant
+	states []*aggregateState
+}
+
+// groupTable holds the groups built from the records of one input, in the order they were found.
+type groupTable struct {
+	byKey  map[string]*group
+	groups []*group
+}
+
+// GroupByScan groups the records of its input scan by the values of the group fields
+// and computes the aggregate functions over each group, producing one record per group.
+// The groups are built in memory when the scan is positioned, and are returned in order
+// of their group values. Without group fields the whole input forms a single group,
+// which exists even if the input is empty.
+// A parallel group by scan has several inputs, each read by its own goroutine into groups
+// of its own, which are merged once all of them are read.
+type GroupByScan struct {
+	inputs      []scan.Scan
+	groupFields []string
+	aggFns      []*AggregationFn
+	maxGroups   int
+	groups      []*group
+	built       bool
+	current     int
+}
+
+func NewGroupByScan(input scan.Scan, groupFields []string, aggFns []*AggregationFn) *GroupByScan {
+	return NewGroupByScanWithLimit(input, groupFields, aggFns, 0)
+}
+
+// NewGroupByScanWithLimit creates a group by scan that fails with ErrResultTooLarge instead of
+// holding more than maxGroups groups in memory. A maxGroups of 0 means no limit.
+func NewGroupByScanWithLimit(input scan.Scan, groupFields []string, aggFns []*AggregationFn, maxGroups int) *GroupByScan {
+	return NewParallelGroupByScan([]scan.Scan{input}, groupFields, aggFns, maxGroups)
+}
+
+// NewParallelGroupByScan creates a group by scan over the records of all the inputs, which
+// are read at the same time. The inputs must be safe to read from different goroutines,
+// like table scans over different blocks of a table. A maxGroups of 0 means no limit;
+// otherwise it bounds the groups of each input as well as the merged ones.
+func NewParallelGroupByScan(inputs []scan.Scan, groupFields []string, aggFns []*AggregationFn, maxGroups int) *GroupByScan {
+	return &GroupByScan{
+		inputs:      inputs,
+		groupFields: groupFields,
+		aggFns:      aggFns,
+		maxGroups:   maxGroups,
+		current:     -1,
+	}
+}
+
+// BeforeFirst reads the whole input scan and positions the scan before the first group.
+func (s *GroupByScan) BeforeFirst() error {
+	err := s.buildGroups()
+	if err != nil {
+		return err
+	}
+	s.current = -1
+	return nil
+}
+
+func (s *GroupByScan) Next() (bool, error) {
+	if !s.built {
+		err := s.BeforeFirst()
+		if err != nil {
+			return false, err
+		}
+	}
+	if s.current < len(s.groups) {
+		s.current++
+	}
+	return s.current < len(s.groups), nil
+}
+
+func (s *GroupByScan) GetInt(fldname string) (int, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return 0, err
+	}
+	if !val.IsInt() {
+		return 0, nil
+	}
+	return val.AsInt(), nil
+}
+
+func (s *GroupByScan) GetString(fldname string) (string, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return "", err
+	}
+	if !val.IsString() {
+		return "", nil
+	}
+	return val.AsString(), nil
+}
+
+func (s *GroupByScan) GetValue(fldname string) (any, error) {
+	return s.value(fldname)
+}
+
+// HasField checks if the field is a group field or the output column of an aggregate.
+func (s *GroupByScan) HasField(fldname string) bool {
+	if slices.Contains(s.groupFields, fldname) {
+		return true
+	}
+	for _, fn := range s.aggFns {
+		if fn.FieldName() == fldname {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *GroupByScan) Close() {
+	for _, input := range s.inputs {
+		input.Close()
+	}
+}
+
+// value returns the value of a group field or aggregate for the current group.
+func (s *GroupByScan) value(fldname string) (Constant, error) {
+	if s.current < 0 || s.current >= len(s.groups) {
+		return Constant{}, fmt.Errorf("group by scan is not positioned on a group")
+	}
+	g := s.groups[s.current]
+	if i := slices.Index(s.groupFields, fldname); i >= 0 {
+		return g.values[i], nil
+	}
+	for i, fn := range s.aggFns {
+		if fn.FieldName() == fldname {
+			return g.states[i].result(), nil
+		}
+	}
+	return Constant{}, fmt.Errorf("field %s not found in group by scan", fldname)
+}
+
+// buildGroups reads every record of the inputs and accumulates it into its group.
+func (s *GroupByScan) buildGroups() error {
+	s.groups = nil
+	s.built = false
+
+	tables := make([]*groupTable, len(s.inputs))
+	errs := make([]error, len(s.inputs))
+	if len(s.inputs) == 1 {
+		tables[0], errs[0] = s.collectGroups(s.inputs[0])
+	} else {
+		var wg sync.WaitGroup
+		for i, input := range s.inputs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				tables[i], errs[i] = s.collectGroups(input)
+			}()
+		}
+		wg.Wait()
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	merged := tables[0]
+	for _, table := range tables[1:] {
+		for _, g := range table.groups {
+			key := groupKey(g.values)
+			existing, ok := merged.byKey[key]
+			if !ok {
+				if err := s.checkGroupCount(len(merged.groups)); err != nil {
+					return err
+				}
+				merged.byKey[key] = g
+				merged.groups = append(merged.groups, g)
+				continue
+			}
+			for i, st := range existing.states {
+				st.merge(g.states[i])
+			}
+		}
+	}
+	s.groups = merged.groups
+
+	if len(s.groups) == 0 && len(s.groupFields) == 0 {
+		s.groups = append(s.groups, s.newGroup(nil))
+	}
+
+	sort.SliceStable(s.groups, func(i, j int) bool {
+		return compareGroupValues(s.groups[i].values, s.groups[j].values) < 0
+	})
+	s.built = true
+	return nil
+}
+
+// collectGroups reads every record of an input and accumulates it into its group.
+func (s *GroupByScan) collectGroups(input scan.Scan) (*groupTable, error) {
+	err := input.BeforeFirst()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &groupTable{byKey: map[string]*group{}}
+	for {
+		hasNext, err := input.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !hasNext {
+			break
+		}
+
+		values := make([]Constant, len(s.groupFields))
+		for i, field := range s.groupFields {
+			values[i], err = NewFieldNameExpression(field).Evaluate(input)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		key := groupKey(values)
+		g, ok := table.byKey[key]
+		if !ok {
+			if err := s.checkGroupCount(len(table.groups)); err != nil {
+				return nil, err
+			}
+			g = s.newGroup(values)
+			table.byKey[key] = g
+			table.groups = append(table.groups, g)
+		}
+		for _, st := range g.states {
+			err := st.add(input)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return table, nil
+}
+
+// checkGroupCount fails with ErrResultTooLarge if a group can't be added to the given
+// number of groups without going over the limit.
+func (s *GroupByScan) checkGroupCount(groups int) error {
+	if s.maxGroups > 0 && groups >= s.maxGroups {
+		return fmt.Errorf("%w: more than %d groups", ErrResultTooLarge, s.maxGroups)
+	}
+	return nil
+}
+
+func (s *GroupByScan) newGroup(values []Constant) *group {
+	g := &group{
+		values: values,
+		states: make([]*aggregateState, len(s.aggFns)),
+	}
+	for i, fn := range s.aggFns {
+		g.states[i] = fn.newState()
+	}
+	return g
+}
+
+// groupKey encodes group values into a string that differs for every distinct combination of values.
+func groupKey(values []Constant) string {
+	var sb strings.Builder
+	for _, v := range values {
+		if v.IsInt() {
+			fmt.Fprintf(&sb, "i%d;", v.AsInt())
+		} else {
+			fmt.Fprintf(&sb, "s%d:%s;", len(v.AsString()), v.AsString())
+		}
+	}
+	return sb.String()
+}
+
+// compareGroupValues orders two lists of group values field by field.
+func compareGroupValues(a []Constant, b []Constant) int {
+	for i := range a {
+		if cmp := a[i].CompareTo(&b[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package query
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGroupByScanAggregates tests grouping records by a field and aggregating each group
+func TestGroupByScanAggregates(t *testing.T) {
+	testDir := "/tmp/testdb_groupbyscan"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	aggFns := []*AggregationFn{}
+	for _, spec := range [][2]string{{"count", "*"}, {"sum", "id"}, {"avg", "id"}, {"min", "name"}, {"max", "name"}} {
+		fn, err := NewAggregationFn(spec[0], spec[1])
+		require.NoError(t, err)
+		aggFns = append(aggFns, fn)
+	}
+	groupScan := NewGroupByScan(ts, []string{"age"}, aggFns)
+	defer groupScan.Close()
+
+	assert.True(t, groupScan.HasField("age"))
+	assert.True(t, groupScan.HasField("count(*)"))
+	assert.False(t, groupScan.HasField("name"))
+
+	type result struct {
+		count, sum, avg int
+		min, max        string
+	}
+	results := map[int]result{}
+	ages := []int{}
+
+	err := groupScan.BeforeFirst()
+	require.NoError(t, err)
+	for {
+		hasNext, err := groupScan.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		age, err := groupScan.GetInt("age")
+		require.NoError(t, err)
+		ages = append(ages, age)
+
+		var r result
+		r.count, err = groupScan.GetInt("count(*)")
+		require.NoError(t, err)
+		r.sum, err = groupScan.GetInt("sum(id)")
+		require.NoError(t, err)
+		r.avg, err = groupScan.GetInt("avg(id)")
+		require.NoError(t, err)
+		r.min, err = groupScan.GetString("min(name)")
+		require.NoError(t, err)
+		r.max, err = groupScan.GetString("max(name)")
+		require.NoError(t, err)
+		results[age] = r
+	}
+
+	// Groups come back in order of their values
+	assert.Equal(t, []int{25, 30, 35, 40, 45}, ages)
+	assert.Equal(t, result{count: 3, sum: 9, avg: 3, min: "Alice", max: "Eve"}, results[25])
+	assert.Equal(t, result{count: 2, sum: 9, avg: 4, min: "Bob", max: "Grace"}, results[30])
+	assert.Equal(t, result{count: 1, sum: 8, avg: 8, min: "Henry", max: "Henry"}, results[45])
+
+	_, err = groupScan.GetInt("name")
+	assert.Error(t, err)
+}
+
+// TestGroupByScanWithoutGroupFields tests aggregating the whole input as a single group
+func TestGroupByScanWithoutGroupFields(t *testing.T) {
+	testDir := "/tmp/testdb_groupbyscan_global"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	count, err := NewAggregationFn("COUNT", "id")
+	require.NoError(t, err)
+	maxAge, err := NewAggregationFn("max", "age")
+	require.NoError(t, err)
+
+	groupScan := NewGroupByScan(ts, nil, []*AggregationFn{count, maxAge})
+	err = groupScan.BeforeFirst()
+	require.NoError(t, err)
+	hasNext, err := groupScan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	n, err := groupScan.GetInt("count(id)")
+	require.NoError(t, err)
+	assert.Equal(t, 8, n)
+	oldest, err := groupScan.GetInt("max(age)")
+	require.NoError(t, err)
+	assert.Equal(t, 45, oldest)
+	hasNext, err = groupScan.Next()
+	require.NoError(t, err)
+	assert.False(t, hasNext)
+
+	// An empty input still produces one group
+	emptyScan := NewGroupByScan(NewSelectScan(ts, *createEqualsPredicate("age", 99)), nil, []*AggregationFn{count})
+	err = emptyScan.BeforeFirst()
+	require.NoError(t, err)
+	hasNext, err = emptyScan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	n, err = emptyScan.GetInt("count(id)")
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// SUM requires int values
+	sumName, err := NewAggregationFn("sum", "name")
+	require.NoError(t, err)
+	badScan := NewGroupByScan(ts, nil, []*AggregationFn{sumName})
+	assert.Error(t, badScan.BeforeFirst())
+
+	_, err = NewAggregationFn("max", "*")
+	assert.Error(t, err)
+	_, err = NewAggregationFn("median", "age")
+	assert.Error(t, err)
+}
+
+// TestGroupByScanLimit tests that a group by scan fails instead of holding more groups than its limit
+func TestGroupByScanLimit(t *testing.T) {
+	testDir := "/tmp/testdb_groupbyscan_limit"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	countFn, err := NewAggregationFn("count", "*")
+	require.NoError(t, err)
+	groupScan := NewGroupByScanWithLimit(ts, []string{"id"}, []*AggregationFn{countFn}, 2)
+	defer groupScan.Close()
+
+	err = groupScan.BeforeFirst()
+	assert.ErrorIs(t, err, ErrResultTooLarge)
+	assert.Equal(t, "result too large: more than 2 groups", err.Error())
+
+	// Without group fields there is a single group, whatever the limit
+	groupScan = NewGroupByScanWithLimit(ts, nil, []*AggregationFn{countFn}, 1)
+	require.NoError(t, groupScan.BeforeFirst())
+	hasNext, err := groupScan.Next()
+	require.NoError(t, err)
+	assert.True(t, hasNext)
+}
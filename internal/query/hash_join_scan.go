@@ -0,0 +1,480 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+var (
+	_ scan.Scan = (*HashJoinScan)(nil)
+)
+
+// hashJoinPartitions is the number of partitions each input is split into when the
+// build input doesn't fit in memory.
+const hashJoinPartitions = 4
+
+// joinRow is a record of the build input held in memory.
+type joinRow struct {
+	key    Constant
+	values []Constant
+}
+
+// hashJoinPartition holds the records of both inputs whose join keys hash to the same partition.
+type hashJoinPartition struct {
+	build *table.TempTable
+	probe *table.TempTable
+}
+
+// HashJoinScan joins two scans on the equality of a field from each of them.
+// It reads the build input into a hash table on its join field, then reads the probe input
+// once and looks up the build records matching each probe record.
+//
+// If the build input has more than maxRecords records, both inputs are first split into
+// temp tables by the hash of their join field, and the partitions are joined one at a time.
+// Records are returned in the order of the probe input within each partition.
+type HashJoinScan struct {
+	tx          *transaction.Transaction
+	build       scan.Scan
+	buildSchema *record.Schema
+	buildFields []string
+	buildField  string
+	probe       scan.Scan
+	probeSchema *record.Schema
+	probeField  string
+	maxRecords  int
+
+	partitions []hashJoinPartition
+	partition  int
+	probeScan  scan.Scan
+	buckets    map[int][]*joinRow
+	matches    []*joinRow
+	match      int
+	built      bool
+	ready      bool
+}
+
+// NewHashJoinScan creates a scan joining the build and probe scans where buildField equals probeField.
+// The schemas list the fields of each input, and maxRecords bounds the build records held in memory.
+func NewHashJoinScan(tx *transaction.Transaction, build scan.Scan, buildSchema *record.Schema, buildField string, probe scan.Scan, probeSchema *record.Schema, probeField string, maxRecords int) *HashJoinScan {
+	// Qualified join fields are looked up by the names the schemas hold them under
+	if name, ok := buildSchema.Resolve(buildField); ok {
+		buildField = name
+	}
+	if name, ok := probeSchema.Resolve(probeField); ok {
+		probeField = name
+	}
+	return &HashJoinScan{
+		tx:          tx,
+		build:       build,
+		buildSchema: buildSchema,
+		buildFields: buildSchema.Fields(),
+		buildField:  buildField,
+		probe:       probe,
+		probeSchema: probeSchema,
+		probeField:  probeField,
+		maxRecords:  maxRecords,
+	}
+}
+
+// BeforeFirst positions the scan before the first joined record.
+// The build input is only read the first time; later calls reuse its hash table or partitions.
+func (s *HashJoinScan) BeforeFirst() error {
+	s.closeProbe()
+	s.ready = false
+	s.matches = nil
+	s.match = -1
+
+	if s.built {
+		if s.partitions != nil {
+			err := s.openPartition(0)
+			if err != nil {
+				return err
+			}
+		} else {
+			err := s.probe.BeforeFirst()
+			if err != nil {
+				return err
+			}
+			s.probeScan = s.probe
+		}
+		s.ready = true
+		return nil
+	}
+
+	err := s.build.BeforeFirst()
+	if err != nil {
+		return err
+	}
+	rows := []*joinRow{}
+	for {
+		hasNext, err := s.build.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		row, err := s.readRow(s.build)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		if len(rows) > s.maxRecords {
+			err = s.spill(rows)
+			if err != nil {
+				return err
+			}
+			err = s.openPartition(0)
+			if err != nil {
+				return err
+			}
+			s.built = true
+			s.ready = true
+			return nil
+		}
+	}
+
+	// The build input fits in memory, so the probe input is read directly
+	s.loadBuckets(rows)
+	err = s.probe.BeforeFirst()
+	if err != nil {
+		return err
+	}
+	s.probeScan = s.probe
+	s.built = true
+	s.ready = true
+	return nil
+}
+
+// Next moves to the next pair of build and probe records with equal join fields.
+func (s *HashJoinScan) Next() (bool, error) {
+	if !s.ready {
+		err := s.BeforeFirst()
+		if err != nil {
+			return false, err
+		}
+	}
+	for {
+		if s.match+1 < len(s.matches) {
+			s.match++
+			return true, nil
+		}
+
+		hasNext, err := s.probeScan.Next()
+		if err != nil {
+			return false, err
+		}
+		if hasNext {
+			key, err := NewFieldNameExpression(s.probeField).Evaluate(s.probeScan)
+			if err != nil {
+				return false, err
+			}
+			s.matches = s.lookup(key)
+			s.match = -1
+			continue
+		}
+
+		// The probe records of this partition are done, move on to the next one
+		if s.partition+1 >= len(s.partitions) {
+			return false, nil
+		}
+		err = s.openPartition(s.partition + 1)
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (s *HashJoinScan) GetInt(fldname string) (int, error) {
+	if s.buildSchema.HasField(fldname) {
+		val, err := s.buildValue(fldname)
+		if err != nil {
+			return 0, err
+		}
+		return val.AsInt(), nil
+	}
+	return s.probeScan.GetInt(s.probeFieldName(fldname))
+}
+
+func (s *HashJoinScan) GetString(fldname string) (string, error) {
+	if s.buildSchema.HasField(fldname) {
+		val, err := s.buildValue(fldname)
+		if err != nil {
+			return "", err
+		}
+		return val.AsString(), nil
+	}
+	return s.probeScan.GetString(s.probeFieldName(fldname))
+}
+
+func (s *HashJoinScan) GetValue(fldname string) (any, error) {
+	if s.buildSchema.HasField(fldname) {
+		val, err := s.buildValue(fldname)
+		if err != nil {
+			return nil, err
+		}
+		if val.IsLong() {
+			return val.AsLong(), nil
+		}
+		if val.IsInt() {
+			return val.AsInt(), nil
+		}
+		return val.AsString(), nil
+	}
+	return s.probeScan.GetValue(s.probeFieldName(fldname))
+}
+
+func (s *HashJoinScan) HasField(fldname string) bool {
+	return s.buildSchema.HasField(fldname) || s.probeSchema.HasField(fldname)
+}
+
+func (s *HashJoinScan) Close() {
+	s.closeProbe()
+	s.build.Close()
+	s.probe.Close()
+}
+
+// probeFieldName returns the name the probe records hold a field under, since the
+// temp tables of the partitions only know the fields by those names.
+func (s *HashJoinScan) probeFieldName(fldname string) string {
+	if name, ok := s.probeSchema.Resolve(fldname); ok {
+		return name
+	}
+	return fldname
+}
+
+// buildValue returns the value of a build field in the build record matching the current probe record.
+func (s *HashJoinScan) buildValue(fldname string) (Constant, error) {
+	if s.match < 0 || s.match >= len(s.matches) {
+		return Constant{}, fmt.Errorf("hash join scan is not positioned on a record")
+	}
+	name, _ := s.buildSchema.Resolve(fldname)
+	for i, field := range s.buildFields {
+		if field == name {
+			return s.matches[s.match].values[i], nil
+		}
+	}
+	return Constant{}, fmt.Errorf("field %s not found in hash join scan", fldname)
+}
+
+// lookup returns the build records whose join field equals key.
+// Records whose keys only share the hash are skipped.
+func (s *HashJoinScan) lookup(key Constant) []*joinRow {
+	var matches []*joinRow
+	for _, row := range s.buckets[key.HashCode()] {
+		if row.key.Equals(&key) {
+			matches = append(matches, row)
+		}
+	}
+	return matches
+}
+
+// loadBuckets builds the hash table over the given build records.
+func (s *HashJoinScan) loadBuckets(rows []*joinRow) {
+	s.buckets = make(map[int][]*joinRow)
+	for _, row := range rows {
+		h := row.key.HashCode()
+		s.buckets[h] = append(s.buckets[h], row)
+	}
+}
+
+// readRow copies the current record of the build input, or of a build partition.
+func (s *HashJoinScan) readRow(src scan.Scan) (*joinRow, error) {
+	row := &joinRow{values: make([]Constant, len(s.buildFields))}
+	for i, field := range s.buildFields {
+		val, err := readConstant(src, s.buildSchema, field)
+		if err != nil {
+			return nil, err
+		}
+		row.values[i] = val
+		if field == s.buildField {
+			row.key = val
+		}
+	}
+	return row, nil
+}
+
+// spill splits both inputs into partitions, starting with the build records already read.
+func (s *HashJoinScan) spill(rows []*joinRow) error {
+	s.partitions = make([]hashJoinPartition, hashJoinPartitions)
+	for i := range s.partitions {
+		s.partitions[i] = hashJoinPartition{
+			build: table.NewTempTable(s.tx, s.buildSchema),
+			probe: table.NewTempTable(s.tx, s.probeSchema),
+		}
+	}
+
+	buildScans, err := s.openPartitionScans(func(p hashJoinPartition) *table.TempTable { return p.build })
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		err := writeRow(buildScans[partitionOf(row.key)], s.buildSchema, row.values)
+		if err != nil {
+			closeScans(buildScans)
+			return err
+		}
+	}
+	err = copyToPartitions(s.build, s.buildSchema, s.buildField, buildScans)
+	closeScans(buildScans)
+	if err != nil {
+		return err
+	}
+
+	probeScans, err := s.openPartitionScans(func(p hashJoinPartition) *table.TempTable { return p.probe })
+	if err != nil {
+		return err
+	}
+	defer closeScans(probeScans)
+	err = s.probe.BeforeFirst()
+	if err != nil {
+		return err
+	}
+	return copyToPartitions(s.probe, s.probeSchema, s.probeField, probeScans)
+}
+
+// openPartition loads the build records of a partition into memory and starts reading its probe records.
+func (s *HashJoinScan) openPartition(i int) error {
+	s.closeProbe()
+	s.partition = i
+	s.matches = nil
+	s.match = -1
+
+	p := s.partitions[i]
+	buildScan, err := p.build.Open()
+	if err != nil {
+		return err
+	}
+	defer buildScan.Close()
+	rows := []*joinRow{}
+	for {
+		hasNext, err := buildScan.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		row, err := s.readRow(buildScan)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	s.loadBuckets(rows)
+
+	probeScan, err := p.probe.Open()
+	if err != nil {
+		return err
+	}
+	s.probeScan = probeScan
+	return nil
+}
+
+// closeProbe closes the scan over the probe records of the current partition.
+// The probe input itself stays open until the scan is closed.
+func (s *HashJoinScan) closeProbe() {
+	if s.probeScan != nil && s.probeScan != s.probe {
+		s.probeScan.Close()
+	}
+	s.probeScan = nil
+}
+
+func (s *HashJoinScan) openPartitionScans(tempTable func(hashJoinPartition) *table.TempTable) ([]*table.TableScan, error) {
+	scans := make([]*table.TableScan, 0, len(s.partitions))
+	for _, p := range s.partitions {
+		ts, err := tempTable(p).Open()
+		if err != nil {
+			closeScans(scans)
+			return nil, err
+		}
+		scans = append(scans, ts)
+	}
+	return scans, nil
+}
+
+// copyToPartitions writes the remaining records of src into the partition of their join field.
+func copyToPartitions(src scan.Scan, sch *record.Schema, joinField string, partitions []*table.TableScan) error {
+	fields := sch.Fields()
+	for {
+		hasNext, err := src.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			return nil
+		}
+		values := make([]Constant, len(fields))
+		var key Constant
+		for i, field := range fields {
+			values[i], err = readConstant(src, sch, field)
+			if err != nil {
+				return err
+			}
+			if field == joinField {
+				key = values[i]
+			}
+		}
+		err = writeRow(partitions[partitionOf(key)], sch, values)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// partitionOf returns the partition holding the records with the given join key.
+func partitionOf(key Constant) int {
+	h := key.HashCode() % hashJoinPartitions
+	if h < 0 {
+		h += hashJoinPartitions
+	}
+	return h
+}
+
+// readConstant reads a field of the current record of the scan according to its type in the schema.
+func readConstant(s scan.Scan, sch *record.Schema, field string) (Constant, error) {
+	if sch.Type(field) == "int" || sch.Type(field) == "bigint" {
+		val, err := s.GetInt(field)
+		if err != nil {
+			return Constant{}, err
+		}
+		if sch.Type(field) == "bigint" {
+			return *NewLongConstant(int64(val)), nil
+		}
+		return *NewIntConstant(val), nil
+	}
+	val, err := s.GetString(field)
+	if err != nil {
+		return Constant{}, err
+	}
+	return *NewStringConstant(val), nil
+}
+
+// writeRow inserts a record with the given values, in schema field order, into the table scan.
+func writeRow(ts *table.TableScan, sch *record.Schema, values []Constant) error {
+	err := ts.Insert()
+	if err != nil {
+		return err
+	}
+	for i, field := range sch.Fields() {
+		if values[i].IsInt() {
+			err = ts.SetInt(field, values[i].AsInt())
+		} else {
+			err = ts.SetString(field, values[i].AsString())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func closeScans(scans []*table.TableScan) {
+	for _, ts := range scans {
+		ts.Close()
+	}
+}
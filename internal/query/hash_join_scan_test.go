@@ -0,0 +1,143 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/table"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// setupAgeLabels creates a table of labels for ages, with two labels for age 25 and none for 35, 40 or 45
+func setupAgeLabels(t *testing.T, tx *transaction.Transaction) (*table.TableScan, *record.Schema) {
+	schema := record.NewSchema()
+	schema.AddIntField("label_age")
+	schema.AddStringField("label", 20)
+
+	ts, err := table.NewTableScan(tx, record.NewLayoutFromSchema(schema), "AgeLabels")
+	require.NoError(t, err)
+
+	labels := []struct {
+		age   int
+		label string
+	}{
+		{25, "young"},
+		{30, "thirty"},
+		{25, "quarter"},
+		{50, "fifty"},
+	}
+	for _, l := range labels {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("label_age", l.age))
+		require.NoError(t, ts.SetString("label", l.label))
+	}
+	return ts, schema
+}
+
+// readJoined returns the name and label of every joined record, sorted
+func readJoined(t *testing.T, s *HashJoinScan) []string {
+	require.NoError(t, s.BeforeFirst())
+	results := []string{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		name, err := s.GetString("name")
+		require.NoError(t, err)
+		age, err := s.GetInt("age")
+		require.NoError(t, err)
+		labelAge, err := s.GetInt("label_age")
+		require.NoError(t, err)
+		assert.Equal(t, age, labelAge)
+		label, err := s.GetString("label")
+		require.NoError(t, err)
+		results = append(results, fmt.Sprintf("%s:%s", name, label))
+	}
+	sort.Strings(results)
+	return results
+}
+
+// TestHashJoinScan tests joining in memory and with the inputs split into temp tables
+func TestHashJoinScan(t *testing.T) {
+	expected := []string{
+		"Alice:quarter", "Alice:young",
+		"Bob:thirty",
+		"Charlie:quarter", "Charlie:young",
+		"Eve:quarter", "Eve:young",
+		"Grace:thirty",
+	}
+
+	tests := []struct {
+		name       string
+		maxRecords int
+		spilled    bool
+	}{
+		{"InMemory", 100, false},
+		{"Spilled", 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir := "/tmp/testdb_hashjoin_" + tt.name
+			defer os.RemoveAll(testDir)
+
+			tx, users := setupTestDB(t, testDir)
+			defer tx.Commit()
+			labels, labelSchema := setupAgeLabels(t, tx)
+
+			userSchema := record.NewSchema()
+			userSchema.AddIntField("id")
+			userSchema.AddIntField("age")
+			userSchema.AddStringField("name", 20)
+
+			// Labels are the build input, users probe it
+			s := NewHashJoinScan(tx, labels, labelSchema, "label_age", users, userSchema, "age", tt.maxRecords)
+			defer s.Close()
+
+			assert.True(t, s.HasField("name"))
+			assert.True(t, s.HasField("label"))
+			assert.False(t, s.HasField("missing"))
+
+			assert.Equal(t, expected, readJoined(t, s))
+			// Scanning again gives the same records
+			assert.Equal(t, expected, readJoined(t, s))
+
+			tempFiles, err := filepath.Glob(filepath.Join(testDir, file.TempFilePrefix+"*"))
+			require.NoError(t, err)
+			if tt.spilled {
+				assert.Len(t, tempFiles, 2*hashJoinPartitions, "Both inputs should be split into temp tables")
+			} else {
+				assert.Empty(t, tempFiles)
+			}
+		})
+	}
+}
+
+// TestHashJoinScanHashCollision tests that build records whose keys share a hash with the probe key don't match
+func TestHashJoinScanHashCollision(t *testing.T) {
+	s := &HashJoinScan{}
+	key := *NewIntConstant(25)
+	other := *NewStringConstant("25")
+
+	// Put a record with a different key into the same bucket
+	s.buckets = map[int][]*joinRow{
+		key.HashCode(): {
+			{key: other, values: []Constant{other}},
+			{key: key, values: []Constant{key}},
+		},
+	}
+
+	matches := s.lookup(key)
+	require.Len(t, matches, 1)
+	assert.True(t, matches[0].key.Equals(&key))
+	assert.Empty(t, s.lookup(*NewIntConstant(30)))
+}
@@ -0,0 +1,62 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/yashagw/cranedb/internal/record"
+)
+
+// keywords are the reserved words of the SQL dialect. They can only be used as names
+// when written as quoted identifiers, e.g. "select".
+var keywords = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true,
+	"insert": true, "into": true, "values": true,
+	"delete": true, "update": true, "set": true,
+	"create": true, "table": true, "varchar": true, "int": true, "bigint": true,
+	"view": true, "as": true, "index": true, "on": true,
+	"between": true, "in": true, "like": true, "escape": true,
+	"group": true, "by": true, "having": true,
+	"conflict": true, "do": true, "copy": true, "packed": true, "vacuum": true,
+	"exists": true, "not": true, "reindex": true,
+	"order": true, "asc": true, "desc": true,
+}
+
+// IsKeyword checks if the word is a reserved word, in any case.
+func IsKeyword(word string) bool {
+	return keywords[strings.ToLower(word)]
+}
+
+// QuoteIdentifier returns a name as it has to be written in a statement to be read back
+// unchanged: as is if it is a lowercase name that isn't a keyword, and otherwise in double
+// quotes, with every double quote in it doubled.
+func QuoteIdentifier(name string) string {
+	if isPlainIdentifier(name) && !IsKeyword(name) {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// QuoteFieldName quotes a field name like QuoteIdentifier, quoting the table and the field
+// of a qualified name (e.g. students.id) separately.
+func QuoteFieldName(name string) string {
+	table, field := record.SplitFieldName(name)
+	if table == "" {
+		return QuoteIdentifier(name)
+	}
+	return QuoteIdentifier(table) + "." + QuoteIdentifier(field)
+}
+
+// isPlainIdentifier checks if the name can be written without quotes: unquoted names are
+// read in lowercase, and must start with a letter or an underscore.
+func isPlainIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && !(unicode.IsLetter(r) && !unicode.IsUpper(r)) && !(i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
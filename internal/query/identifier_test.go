@@ -0,0 +1,30 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"students", "students"},
+		{"student_id2", "student_id2"},
+		{"_tmp", "_tmp"},
+		{"Students", `"Students"`},
+		{"select", `"select"`},
+		{"order items", `"order items"`},
+		{"2nd", `"2nd"`},
+		{`say "hi"`, `"say ""hi"""`},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, QuoteIdentifier(tt.name), tt.name)
+	}
+
+	assert.Equal(t, "students.id", QuoteFieldName("students.id"))
+	assert.Equal(t, `"Students"."From"`, QuoteFieldName("Students.From"))
+	assert.Equal(t, `"order items"`, QuoteFieldName("order items"))
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*IndexOnlyScan)(nil)
+)
+
+// IndexOnlyScan returns the indexed field of the records whose value matches any of
+// several values, read from the index records alone. Unlike IndexSelectScan it never
+// moves to the data records, so it only suits queries that need no other field.
+// The values must be distinct, so that no record is returned twice.
+type IndexOnlyScan struct {
+	index   index.Index
+	schema  *record.Schema
+	values  []any
+	current int
+}
+
+// NewIndexOnlyScan creates an index-only scan. The schema holds the indexed field alone.
+func NewIndexOnlyScan(idx index.Index, schema *record.Schema, values []any) (*IndexOnlyScan, error) {
+	ios := &IndexOnlyScan{
+		index:  idx,
+		schema: schema,
+		values: values,
+	}
+	err := ios.BeforeFirst()
+	if err != nil {
+		return nil, err
+	}
+	return ios, nil
+}
+
+func (ios *IndexOnlyScan) BeforeFirst() error {
+	ios.current = 0
+	if len(ios.values) == 0 {
+		return nil
+	}
+	return ios.index.BeforeFirst(ios.values[0])
+}
+
+func (ios *IndexOnlyScan) Next() (bool, error) {
+	for ios.current < len(ios.values) {
+		next, err := ios.index.Next()
+		if next || err != nil {
+			return next, err
+		}
+
+		// Current value is exhausted, probe the index with the next one
+		ios.current++
+		if ios.current < len(ios.values) {
+			err = ios.index.BeforeFirst(ios.values[ios.current])
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (ios *IndexOnlyScan) GetInt(fldname string) (int, error) {
+	val, err := ios.GetValue(fldname)
+	if err != nil {
+		return 0, err
+	}
+	switch v := val.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	}
+	return 0, fmt.Errorf("field %s is not an int", fldname)
+}
+
+func (ios *IndexOnlyScan) GetString(fldname string) (string, error) {
+	val, err := ios.GetValue(fldname)
+	if err != nil {
+		return "", err
+	}
+	strVal, ok := val.(string)
+	if !ok {
+		return "", fmt.Errorf("field %s is not a string", fldname)
+	}
+	return strVal, nil
+}
+
+func (ios *IndexOnlyScan) GetValue(fldname string) (any, error) {
+	if !ios.HasField(fldname) {
+		return nil, fmt.Errorf("field %s not found in index only scan", fldname)
+	}
+	return ios.index.GetDataVal()
+}
+
+func (ios *IndexOnlyScan) HasField(fieldName string) bool {
+	return ios.schema.HasField(fieldName)
+}
+
+func (ios *IndexOnlyScan) Close() {
+	ios.index.Close()
+}
@@ -0,0 +1,70 @@
+package query
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/record"
+)
+
+func TestIndexOnlyScan(t *testing.T) {
+	testDir := "/tmp/testdb_indexonlyscan"
+	defer os.RemoveAll(testDir)
+
+	tx, ts, hashIndex, _, _ := setupIndexSelectScanTest(t, testDir)
+	defer tx.Commit()
+	ts.Close()
+
+	schema := record.NewSchema()
+	schema.AddIntField("age")
+
+	collect := func(s *IndexOnlyScan) []int {
+		ages := []int{}
+		for {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				return ages
+			}
+			age, err := s.GetInt("age")
+			require.NoError(t, err)
+			ages = append(ages, age)
+		}
+	}
+
+	t.Run("SingleValue", func(t *testing.T) {
+		s, err := NewIndexOnlyScan(hashIndex, schema, []any{20})
+		require.NoError(t, err)
+		defer s.Close()
+		assert.Equal(t, []int{20, 20, 20, 20}, collect(s))
+
+		// Scanning again gives the same records
+		require.NoError(t, s.BeforeFirst())
+		assert.Len(t, collect(s), 4)
+	})
+
+	t.Run("SeveralValues", func(t *testing.T) {
+		s, err := NewIndexOnlyScan(hashIndex, schema, []any{22, 99, 21})
+		require.NoError(t, err)
+		defer s.Close()
+		assert.ElementsMatch(t, []int{22, 22, 21}, collect(s))
+	})
+
+	t.Run("OnlyTheIndexedField", func(t *testing.T) {
+		s, err := NewIndexOnlyScan(hashIndex, schema, []any{21})
+		require.NoError(t, err)
+		defer s.Close()
+		assert.True(t, s.HasField("age"))
+		assert.False(t, s.HasField("name"))
+
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		_, err = s.GetString("name")
+		assert.Error(t, err)
+		_, err = s.GetString("age")
+		assert.Error(t, err, "age is an int")
+	})
+}
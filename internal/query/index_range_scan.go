@@ -0,0 +1,69 @@
+package query
+
+import (
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
+)
+
+var (
+	_ scan.Scan = (*IndexRangeScan)(nil)
+)
+
+// IndexRangeScan returns the records whose indexed field is in a range of values, in order
+// of that field, by searching an index that keeps its records sorted.
+type IndexRangeScan struct {
+	tableScan   *table.TableScan
+	index       index.RangeIndex
+	searchRange index.Range
+}
+
+func NewIndexRangeScan(tableScan *table.TableScan, idx index.RangeIndex, searchRange index.Range) (*IndexRangeScan, error) {
+	irs := &IndexRangeScan{
+		tableScan:   tableScan,
+		index:       idx,
+		searchRange: searchRange,
+	}
+	err := irs.BeforeFirst()
+	if err != nil {
+		return nil, err
+	}
+	return irs, nil
+}
+
+func (irs *IndexRangeScan) BeforeFirst() error {
+	return irs.index.BeforeRange(irs.searchRange)
+}
+
+func (irs *IndexRangeScan) Next() (bool, error) {
+	next, err := irs.index.Next()
+	if !next || err != nil {
+		return next, err
+	}
+	dataRID, err := irs.index.GetDataRid()
+	if err != nil {
+		return false, err
+	}
+	return true, irs.tableScan.MoveToRID(dataRID)
+}
+
+func (irs *IndexRangeScan) GetInt(fldname string) (int, error) {
+	return irs.tableScan.GetInt(fldname)
+}
+
+func (irs *IndexRangeScan) GetString(fldname string) (string, error) {
+	return irs.tableScan.GetString(fldname)
+}
+
+func (irs *IndexRangeScan) GetValue(fldname string) (any, error) {
+	return irs.tableScan.GetValue(fldname)
+}
+
+func (irs *IndexRangeScan) HasField(fieldName string) bool {
+	return irs.tableScan.HasField(fieldName)
+}
+
+func (irs *IndexRangeScan) Close() {
+	irs.index.Close()
+	irs.tableScan.Close()
+}
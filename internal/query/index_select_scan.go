@@ -2,12 +2,13 @@ package query
 
 import (
 	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
 	"github.com/yashagw/cranedb/internal/table"
 )
 
 var (
-	_ scan.Scan = (*IndexSelectScan)(nil)
+	_ scan.UpdateScan = (*IndexSelectScan)(nil)
 )
 
 type IndexSelectScan struct {
@@ -61,6 +62,47 @@ func (iss *IndexSelectScan) HasField(fieldName string) bool {
 	return iss.tableScan.HasField(fieldName)
 }
 
+func (iss *IndexSelectScan) SetInt(fldname string, val int) error {
+	return iss.tableScan.SetInt(fldname, val)
+}
+
+func (iss *IndexSelectScan) SetString(fldname string, val string) error {
+	return iss.tableScan.SetString(fldname, val)
+}
+
+func (iss *IndexSelectScan) SetValue(fldname string, val any) error {
+	return iss.tableScan.SetValue(fldname, val)
+}
+
+// Insert inserts a record into the table. The index gets no entry for it; like with a
+// TableScan, adding the record's index entries is up to the caller.
+func (iss *IndexSelectScan) Insert() error {
+	return iss.tableScan.Insert()
+}
+
+// Delete deletes the current record along with its entry in the index, and leaves the scan
+// where Next moves on to the record after it. The record's entries in other indexes are up
+// to the caller.
+func (iss *IndexSelectScan) Delete() error {
+	rid, err := iss.tableScan.GetRID()
+	if err != nil {
+		return err
+	}
+	err = iss.index.Delete(iss.value, rid)
+	if err != nil {
+		return err
+	}
+	return iss.tableScan.Delete()
+}
+
+func (iss *IndexSelectScan) GetRID() (*record.RID, error) {
+	return iss.tableScan.GetRID()
+}
+
+func (iss *IndexSelectScan) MoveToRID(rid *record.RID) error {
+	return iss.tableScan.MoveToRID(rid)
+}
+
 func (iss *IndexSelectScan) Close() {
 	iss.index.Close()
 	iss.tableScan.Close()
@@ -86,7 +86,7 @@ func setupIndexSelectScanTest(t *testing.T, testDir string) (*transaction.Transa
 
 	// Create index on age field using metadata manager
 	indexName := "age_index"
-	err = indexManager.CreateIndex(indexName, "Students", "age", tx)
+	err = indexManager.CreateIndex(indexName, "Students", "age", index.HashType, tx)
 	require.NoError(t, err)
 
 	// Create hash index layout (block, id, dataval)
@@ -353,7 +353,7 @@ func TestIndexSelectScanWithEmptyTable(t *testing.T) {
 
 	// Create index
 	indexName := "value_index"
-	err = indexManager.CreateIndex(indexName, "EmptyTable", "value", tx)
+	err = indexManager.CreateIndex(indexName, "EmptyTable", "value", index.HashType, tx)
 	require.NoError(t, err)
 
 	indexSchema := record.NewSchema()
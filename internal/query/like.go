@@ -0,0 +1,82 @@
+package query
+
+// likeTokenKind is the kind of a single element of a LIKE pattern.
+type likeTokenKind int
+
+const (
+	likeLiteral likeTokenKind = iota
+	likeAnyChar               // _
+	likeAnyRun                // %
+)
+
+type likeToken struct {
+	kind likeTokenKind
+	ch   rune
+}
+
+// parseLikePattern splits a LIKE pattern into tokens.
+// A backslash makes the following character literal, so "\%" matches a percent sign.
+func parseLikePattern(pattern string) []likeToken {
+	runes := []rune(pattern)
+	tokens := make([]likeToken, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			i++
+			tokens = append(tokens, likeToken{kind: likeLiteral, ch: runes[i]})
+		case runes[i] == '%':
+			tokens = append(tokens, likeToken{kind: likeAnyRun})
+		case runes[i] == '_':
+			tokens = append(tokens, likeToken{kind: likeAnyChar})
+		default:
+			tokens = append(tokens, likeToken{kind: likeLiteral, ch: runes[i]})
+		}
+	}
+	return tokens
+}
+
+// hasLikeWildcard reports whether the LIKE pattern has a '%' or '_' that isn't escaped.
+func hasLikeWildcard(pattern string) bool {
+	for _, token := range parseLikePattern(pattern) {
+		if token.kind != likeLiteral {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLike reports whether s matches the LIKE pattern.
+// '%' matches any run of characters (including none) and '_' matches exactly one character.
+// Matching is case-sensitive.
+func matchLike(s string, pattern string) bool {
+	str := []rune(s)
+	pat := parseLikePattern(pattern)
+
+	si, pi := 0, 0
+	// Position of the last '%' seen and where in s it started matching,
+	// so we can backtrack by letting it consume one more character
+	lastRun, runStart := -1, 0
+
+	for si < len(str) {
+		if pi < len(pat) && pat[pi].kind == likeAnyRun {
+			lastRun = pi
+			runStart = si
+			pi++
+		} else if pi < len(pat) && (pat[pi].kind == likeAnyChar || pat[pi].ch == str[si]) {
+			si++
+			pi++
+		} else if lastRun >= 0 {
+			pi = lastRun + 1
+			runStart++
+			si = runStart
+		} else {
+			return false
+		}
+	}
+
+	// Any trailing '%' can match the empty string
+	for pi < len(pat) && pat[pi].kind == likeAnyRun {
+		pi++
+	}
+	return pi == len(pat)
+}
@@ -0,0 +1,42 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchLike(t *testing.T) {
+	tests := []struct {
+		s        string
+		pattern  string
+		expected bool
+	}{
+		{"Alice", "A%", true},
+		{"Bob", "A%", false},
+		{"Frank", "%k", true},
+		{"Frank", "%n", false},
+		{"Charlie", "%arl%", true},
+		{"Charlie", "%xyz%", false},
+		{"Bob", "B_b", true},
+		{"Bob", "B_", false},
+		{"Bob", "___", true},
+		{"", "%", true},
+		{"", "_", false},
+		{"abc", "abc", true},
+		{"abc", "ABC", false},
+		{"aXbXc", "a%b%c", true},
+		{"aXbX", "a%b%c", false},
+		{"mississippi", "%iss%ppi", true},
+		// Escaped wildcards match literally
+		{"100%", "100\\%", true},
+		{"1000", "100\\%", false},
+		{"a_b", "a\\_b", true},
+		{"axb", "a\\_b", false},
+		{"a\\b", "a\\\\b", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, matchLike(tt.s, tt.pattern), "%q LIKE %q", tt.s, tt.pattern)
+	}
+}
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"github.com/yashagw/cranedb/internal/index"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/table"
+)
+
+var (
+	_ scan.Scan = (*MultiIndexSelectScan)(nil)
+)
+
+// MultiIndexSelectScan returns the records whose indexed field matches any of several values.
+// It probes the index once per value and returns the union of the matching records.
+// The values must be distinct, so that no record is returned twice.
+type MultiIndexSelectScan struct {
+	tableScan *table.TableScan
+	index     index.Index
+	values    []any
+	current   int
+}
+
+func NewMultiIndexSelectScan(tableScan *table.TableScan, idx index.Index, values []any) (*MultiIndexSelectScan, error) {
+	miss := &MultiIndexSelectScan{
+		tableScan: tableScan,
+		index:     idx,
+		values:    values,
+	}
+	err := miss.BeforeFirst()
+	if err != nil {
+		return nil, err
+	}
+	return miss, nil
+}
+
+func (miss *MultiIndexSelectScan) BeforeFirst() error {
+	miss.current = 0
+	if len(miss.values) == 0 {
+		return nil
+	}
+	return miss.index.BeforeFirst(miss.values[0])
+}
+
+func (miss *MultiIndexSelectScan) Next() (bool, error) {
+	for miss.current < len(miss.values) {
+		next, err := miss.index.Next()
+		if err != nil {
+			return false, err
+		}
+		if next {
+			dataRID, err := miss.index.GetDataRid()
+			if err != nil {
+				return false, err
+			}
+			return true, miss.tableScan.MoveToRID(dataRID)
+		}
+
+		// Current value is exhausted, probe the index with the next one
+		miss.current++
+		if miss.current < len(miss.values) {
+			err = miss.index.BeforeFirst(miss.values[miss.current])
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (miss *MultiIndexSelectScan) GetInt(fldname string) (int, error) {
+	return miss.tableScan.GetInt(fldname)
+}
+
+func (miss *MultiIndexSelectScan) GetString(fldname string) (string, error) {
+	return miss.tableScan.GetString(fldname)
+}
+
+func (miss *MultiIndexSelectScan) GetValue(fldname string) (any, error) {
+	return miss.tableScan.GetValue(fldname)
+}
+
+func (miss *MultiIndexSelectScan) HasField(fieldName string) bool {
+	return miss.tableScan.HasField(fieldName)
+}
+
+func (miss *MultiIndexSelectScan) Close() {
+	miss.index.Close()
+	miss.tableScan.Close()
+}
@@ -0,0 +1,79 @@
+package query
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMultiIndexSelectScanUnionsValues tests that each value is probed and the matches are combined
+func TestMultiIndexSelectScanUnionsValues(t *testing.T) {
+	testDir := "/tmp/testdb_multiindexselectscan_union"
+	defer os.RemoveAll(testDir)
+
+	tx, ts, hashIndex, _, _ := setupIndexSelectScanTest(t, testDir)
+	defer tx.Commit()
+
+	collectNames := func(values []any) []string {
+		err := ts.BeforeFirst()
+		require.NoError(t, err)
+
+		scan, err := NewMultiIndexSelectScan(ts, hashIndex, values)
+		require.NoError(t, err)
+		defer scan.Close()
+
+		names := []string{}
+		for {
+			hasNext, err := scan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			name, err := scan.GetString("name")
+			require.NoError(t, err)
+			names = append(names, name)
+		}
+		return names
+	}
+
+	t.Run("MultipleValues", func(t *testing.T) {
+		// age 21 (David) and age 22 (Bob, Grace)
+		names := collectNames([]any{21, 22})
+		assert.ElementsMatch(t, []string{"David", "Bob", "Grace"}, names)
+	})
+
+	t.Run("MissingValuesAreSkipped", func(t *testing.T) {
+		// Values without matches at the start, middle and end of the list
+		names := collectNames([]any{99, 23, 98, 21, 97})
+		assert.ElementsMatch(t, []string{"Frank", "David"}, names)
+	})
+
+	t.Run("NoValues", func(t *testing.T) {
+		assert.Empty(t, collectNames([]any{}))
+	})
+
+	t.Run("BeforeFirstRestarts", func(t *testing.T) {
+		err := ts.BeforeFirst()
+		require.NoError(t, err)
+		scan, err := NewMultiIndexSelectScan(ts, hashIndex, []any{23, 21})
+		require.NoError(t, err)
+		defer scan.Close()
+
+		for range 2 {
+			count := 0
+			for {
+				hasNext, err := scan.Next()
+				require.NoError(t, err)
+				if !hasNext {
+					break
+				}
+				count++
+			}
+			assert.Equal(t, 2, count)
+			err = scan.BeforeFirst()
+			require.NoError(t, err)
+		}
+	})
+}
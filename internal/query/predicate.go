@@ -38,6 +38,42 @@ func (p *Predicate) IsSatisfied(s scan.Scan) (bool, error) {
 	return true, nil
 }
 
+// CheckTypes checks the types of every term like Term.CheckTypes, and returns the first error.
+func (p *Predicate) CheckTypes(sch *record.Schema) error {
+	for i := range p.terms {
+		if err := p.terms[i].CheckTypes(sch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fold evaluates the terms that don't depend on the record, such as 1 = 1. It returns the
+// predicate without those that are always true, or nil if no term is left, and false if any
+// of them is always false, in which case no record can satisfy the predicate. A term whose
+// evaluation fails is kept, so that the error is reported when the query is checked or run.
+func (p *Predicate) Fold() (*Predicate, bool) {
+	result := &Predicate{
+		terms: make([]Term, 0, len(p.terms)),
+	}
+	for i := range p.terms {
+		if p.terms[i].isConstant() {
+			satisfied, err := p.terms[i].IsSatisfied(nil)
+			if err == nil && !satisfied {
+				return nil, false
+			}
+			if err == nil {
+				continue
+			}
+		}
+		result.terms = append(result.terms, p.terms[i])
+	}
+	if len(result.terms) == 0 {
+		return nil, true
+	}
+	return result, true
+}
+
 // SelectSubPred returns a new predicate containing only the terms whose fields exist in the given schema.
 // Returns nil if no terms apply to the schema.
 func (p *Predicate) SelectSubPred(sch *record.Schema) *Predicate {
@@ -89,6 +125,17 @@ func (p *Predicate) EquatesWithConstant(fldname string) *Constant {
 	return nil
 }
 
+// InConstants returns the constants of an IN list on the given field, if any.
+func (p *Predicate) InConstants(fldname string) []Constant {
+	for _, t := range p.terms {
+		values := t.InConstants(fldname)
+		if values != nil {
+			return values
+		}
+	}
+	return nil
+}
+
 // EquatesWithField checks if the given field is equated with another field (e.g., field1 = field2).
 // If found, returns the name of the other field; otherwise returns nil.
 func (p *Predicate) EquatesWithField(fldname string) *string {
@@ -128,6 +175,71 @@ func (p *Predicate) String() string {
 	return strings.Join(parts, " and ")
 }
 
+// WithFieldValues returns a copy of the predicate with the given fields replaced by their values.
+func (p *Predicate) WithFieldValues(values map[string]Constant) *Predicate {
+	result := &Predicate{
+		terms: make([]Term, len(p.terms)),
+	}
+	for i := range p.terms {
+		result.terms[i] = *p.terms[i].WithFieldValues(values)
+	}
+	return result
+}
+
+// WithSubqueryValues returns a copy of the predicate with the given scalar subqueries replaced by their values.
+func (p *Predicate) WithSubqueryValues(values map[*Subquery]Constant) *Predicate {
+	result := &Predicate{
+		terms: make([]Term, len(p.terms)),
+	}
+	for i := range p.terms {
+		result.terms[i] = *p.terms[i].WithSubqueryValues(values)
+	}
+	return result
+}
+
+// SubstituteConstant returns a copy of the predicate with the placeholders or the fields of the
+// given name replaced by the value, e.g. to bind a parameter or the value of a correlated field.
+// The predicate itself is left unchanged, so it can be bound again with other values.
+func (p *Predicate) SubstituteConstant(placeholderOrField string, value Constant) *Predicate {
+	result := &Predicate{
+		terms: make([]Term, len(p.terms)),
+	}
+	for i := range p.terms {
+		result.terms[i] = *p.terms[i].SubstituteConstant(placeholderOrField, value)
+	}
+	return result
+}
+
+// Subqueries returns the scalar subqueries of the predicate's expressions.
+func (p *Predicate) Subqueries() []*Subquery {
+	var subqueries []*Subquery
+	for i := range p.terms {
+		subqueries = append(subqueries, p.terms[i].Subqueries()...)
+	}
+	return subqueries
+}
+
+// InSubqueries returns the subqueries of the predicate's IN terms.
+func (p *Predicate) InSubqueries() []*Subquery {
+	var subqueries []*Subquery
+	for i := range p.terms {
+		subqueries = append(subqueries, p.terms[i].InSubqueries()...)
+	}
+	return subqueries
+}
+
+// WithInValues returns a copy of the predicate with the given subqueries of IN terms replaced
+// by the lists of values they return.
+func (p *Predicate) WithInValues(values map[*Subquery][]Constant) *Predicate {
+	result := &Predicate{
+		terms: make([]Term, len(p.terms)),
+	}
+	for i := range p.terms {
+		result.terms[i] = *p.terms[i].WithInValues(values)
+	}
+	return result
+}
+
 // GetTerms returns a copy of the terms slice
 func (p *Predicate) GetTerms() []Term {
 	result := make([]Term, len(p.terms))
@@ -23,7 +23,7 @@ func TestPredicateBasic(t *testing.T) {
 	term2 := NewTerm(*fieldExpr2, *constExpr2)
 	pred2 := NewPredicate(*term2)
 	pred.ConjunctWith(*pred2)
-	assert.Equal(t, "age = 25 and name = John", pred.String())
+	assert.Equal(t, "age = 25 and name = 'John'", pred.String())
 
 	// Test empty predicate string
 	emptyPred := &Predicate{terms: []Term{}}
@@ -45,7 +45,7 @@ func TestPredicateSelectSubPred(t *testing.T) {
 	// SelectSubPred should return all terms that apply
 	result := pred.SelectSubPred(schema)
 	require.NotNil(t, result)
-	assert.Equal(t, "age = 25 and name = John", result.String())
+	assert.Equal(t, "age = 25 and name = 'John'", result.String())
 
 	// Create predicate with term that doesn't apply
 	term3 := NewTerm(*NewFieldNameExpression("missing"), *NewConstantExpression(*NewIntConstant(10)))
@@ -92,6 +92,14 @@ func TestPredicateJoinSubPred(t *testing.T) {
 	pred3 := NewPredicate(*term2)
 	result3 := pred3.JoinSubPred(schema1, schema2)
 	assert.Nil(t, result3)
+
+	// A term comparing two fields of schema1 selects from it rather than joining
+	term3 := NewTerm(*NewFieldNameExpression("id"), *NewFieldNameExpression("name"))
+	pred4 := NewPredicate(*term3)
+	assert.Nil(t, pred4.JoinSubPred(schema1, schema2))
+	result4 := pred4.SelectSubPred(schema1)
+	require.NotNil(t, result4)
+	assert.Equal(t, "id = name", result4.String())
 }
 
 func TestPredicateEquatesWithConstant(t *testing.T) {
@@ -156,3 +164,87 @@ func TestPredicateEquatesWithField(t *testing.T) {
 	result5 := pred3.EquatesWithField("age")
 	assert.Nil(t, result5)
 }
+
+func TestPredicateSubstituteConstant(t *testing.T) {
+	// age > ? and name = outer_name, as in a prepared statement or a correlated subquery
+	template := NewPredicate(*NewComparisonTerm(*NewFieldNameExpression("age"), OpGreaterThan,
+		*NewBinaryExpression(NewPlaceholderExpression("?"), OpAdd, NewConstantExpression(*NewIntConstant(1)))))
+	template.ConjunctWith(*NewPredicate(*NewTerm(*NewFieldNameExpression("name"), *NewFieldNameExpression("outer_name"))))
+	assert.Equal(t, "age > ? + 1 and name = outer_name", template.String())
+
+	schema := record.NewSchema()
+	schema.AddIntField("age")
+	schema.AddStringField("name", 20)
+	schema.AddStringField("outer_name", 20)
+	assert.NoError(t, template.CheckTypes(schema))
+
+	s := NewConstantScan([]string{"age", "name", "outer_name"},
+		[]Constant{*NewIntConstant(30), *NewStringConstant("Ann"), *NewStringConstant("Bob")})
+	require.NoError(t, s.BeforeFirst())
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+
+	// An unbound placeholder can't be evaluated
+	_, err = template.IsSatisfied(s)
+	assert.EqualError(t, err, "placeholder ? has no value")
+
+	young := template.SubstituteConstant("?", *NewIntConstant(20)).SubstituteConstant("outer_name", *NewStringConstant("Ann"))
+	assert.Equal(t, "age > 20 + 1 and name = 'Ann'", young.String())
+	satisfied, err := young.IsSatisfied(s)
+	require.NoError(t, err)
+	assert.True(t, satisfied)
+
+	old := template.SubstituteConstant("?", *NewIntConstant(30)).SubstituteConstant("outer_name", *NewStringConstant("Ann"))
+	satisfied, err = old.IsSatisfied(s)
+	require.NoError(t, err)
+	assert.False(t, satisfied)
+
+	// The type of a value is checked once it is bound
+	byName := NewPredicate(*NewTerm(*NewFieldNameExpression("name"), *NewPlaceholderExpression("?")))
+	assert.NoError(t, byName.CheckTypes(schema))
+	assert.ErrorIs(t, byName.SubstituteConstant("?", *NewIntConstant(3)).CheckTypes(schema), ErrTypeMismatch)
+
+	// The template is unaffected by the substitutions
+	assert.Equal(t, "age > ? + 1 and name = outer_name", template.String())
+	_, err = template.IsSatisfied(s)
+	assert.Error(t, err)
+}
+
+func TestPredicateFold(t *testing.T) {
+	one := *NewConstantExpression(*NewIntConstant(1))
+	two := *NewConstantExpression(*NewIntConstant(2))
+	age := NewTerm(*NewFieldNameExpression("age"), *NewConstantExpression(*NewIntConstant(25)))
+
+	// 1 = 1 and age = 25 keeps only the term on a field
+	pred := NewPredicate(*NewTerm(one, one))
+	pred.ConjunctWith(*NewPredicate(*age))
+	folded, satisfiable := pred.Fold()
+	assert.True(t, satisfiable)
+	require.NotNil(t, folded)
+	assert.Equal(t, "age = 25", folded.String())
+	assert.Equal(t, "1 = 1 and age = 25", pred.String())
+
+	// Conditions that are all true leave no predicate
+	pred = NewPredicate(*NewComparisonTerm(two, OpGreaterThan, one))
+	pred.ConjunctWith(*NewPredicate(*NewNotTerm(NewPredicate(*NewTerm(one, two)))))
+	pred.ConjunctWith(*NewPredicate(*NewInTerm(one, []Constant{*NewIntConstant(1), *NewIntConstant(3)})))
+	folded, satisfiable = pred.Fold()
+	assert.True(t, satisfiable)
+	assert.Nil(t, folded)
+
+	// A single false condition can't be satisfied
+	pred = NewPredicate(*age)
+	pred.ConjunctWith(*NewPredicate(*NewTerm(*NewBinaryExpression(&one, OpAdd, &one), two)))
+	pred.ConjunctWith(*NewPredicate(*NewTerm(one, two)))
+	_, satisfiable = pred.Fold()
+	assert.False(t, satisfiable)
+
+	// Placeholders, negated fields and conditions that fail to evaluate are kept
+	pred = NewPredicate(*NewTerm(one, *NewPlaceholderExpression("?")))
+	pred.ConjunctWith(*NewPredicate(*NewNotTerm(NewPredicate(*age))))
+	pred.ConjunctWith(*NewPredicate(*NewTerm(one, *NewConstantExpression(*NewStringConstant("a")))))
+	folded, satisfiable = pred.Fold()
+	assert.True(t, satisfiable)
+	assert.Len(t, folded.GetTerms(), 3)
+}
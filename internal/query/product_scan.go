@@ -9,6 +9,9 @@ var (
 type ProductScan struct {
 	scan1 scan.Scan
 	scan2 scan.Scan
+	// hasScan1Record is true while scan1 is on a record, which is false before BeforeFirst,
+	// when scan1 is empty and once the product is fully traversed
+	hasScan1Record bool
 }
 
 func NewProductScan(scan1 scan.Scan, scan2 scan.Scan) *ProductScan {
@@ -20,48 +23,49 @@ func NewProductScan(scan1 scan.Scan, scan2 scan.Scan) *ProductScan {
 
 // BeforeFirst positions the scan before the first record in both scans.
 // It prepares scan1 by moving it to the first record and positions scan2 before its first record.
+// Both scans start over, so records added or removed since the last pass are reflected.
 func (s *ProductScan) BeforeFirst() error {
+	s.hasScan1Record = false
 	if err := s.scan1.BeforeFirst(); err != nil {
 		return err
 	}
-	_, err := s.scan1.Next()
+	hasNext1, err := s.scan1.Next()
 	if err != nil {
 		return err
 	}
-	return s.scan2.BeforeFirst()
+	if err := s.scan2.BeforeFirst(); err != nil {
+		return err
+	}
+	s.hasScan1Record = hasNext1
+	return nil
 }
 
 // Next moves to the next record in the product of scan1 and scan2.
 // It tries to move scan2 to the next record; if successful, returns true.
-// Otherwise, it resets scan2 and advances scan1. If scan1 has a next record,
-// it advances scan2 to its next record and returns true.
-// Returns false when the product is fully traversed.
+// Otherwise, it resets scan2 and advances scan1, until scan1 runs out of records.
+// Returns false when the product is fully traversed, which is right away if scan1 is empty.
+// Canceling the transaction stops it through the table scans underneath.
 func (s *ProductScan) Next() (bool, error) {
-	hasNext, err := s.scan2.Next()
-	if err != nil {
-		return false, err
-	}
-	if hasNext {
-		// There is another record in scan2 for the current scan1 record
-		return true, nil
-	}
-	// Reset scan2 to before the first so we can reuse for the next scan1 record
-	if err := s.scan2.BeforeFirst(); err != nil {
-		return false, err
-	}
-	// Must advance scan1 first (left side) to ensure it moves forward before scan2 resets
-	hasNext1, err := s.scan1.Next()
-	if err != nil {
-		return false, err
-	}
-	if !hasNext1 {
-		return false, nil
-	}
-	hasNext2, err := s.scan2.Next()
-	if err != nil {
-		return false, err
+	for s.hasScan1Record {
+		hasNext2, err := s.scan2.Next()
+		if err != nil {
+			return false, err
+		}
+		if hasNext2 {
+			// There is another record in scan2 for the current scan1 record
+			return true, nil
+		}
+		// Reset scan2 to before the first so we can reuse for the next scan1 record
+		if err := s.scan2.BeforeFirst(); err != nil {
+			return false, err
+		}
+		s.hasScan1Record, err = s.scan1.Next()
+		if err != nil {
+			s.hasScan1Record = false
+			return false, err
+		}
 	}
-	return hasNext2, nil
+	return false, nil
 }
 
 func (s *ProductScan) GetInt(fldname string) (int, error) {
@@ -1,8 +1,11 @@
 package query
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -487,3 +490,228 @@ func TestProductScanWithSelectScan(t *testing.T) {
 
 	selectScan.Close()
 }
+
+// TestProductScanDoubleClose tests that closing a scan tree more than once, and its table scans
+// directly, doesn't unpin blocks that other scans still use
+func TestProductScanDoubleClose(t *testing.T) {
+	testDir := "/tmp/testdb_productscan_double_close"
+	defer os.RemoveAll(testDir)
+
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+	defer tx.Commit()
+
+	schema1 := record.NewSchema()
+	schema1.AddIntField("student_id")
+	layout1 := record.NewLayoutFromSchema(schema1)
+	ts1, err := table.NewTableScan(tx, layout1, "Students")
+	require.NoError(t, err)
+	for id := 1; id <= 3; id++ {
+		require.NoError(t, ts1.Insert())
+		require.NoError(t, ts1.SetInt("student_id", id))
+	}
+
+	schema2 := record.NewSchema()
+	schema2.AddIntField("course_id")
+	ts2, err := table.NewTableScan(tx, record.NewLayoutFromSchema(schema2), "Courses")
+	require.NoError(t, err)
+	require.NoError(t, ts2.Insert())
+	require.NoError(t, ts2.SetInt("course_id", 101))
+
+	// Another scan pins the same block as ts1
+	other, err := table.NewTableScan(tx, layout1, "Students")
+	require.NoError(t, err)
+	available := bufferManager.Available()
+
+	s := NewProjectScan(NewSelectScan(NewProductScan(ts1, ts2), *createEqualsPredicate("student_id", 2)), []string{"course_id"})
+	require.NoError(t, s.BeforeFirst())
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+
+	assert.NotPanics(t, func() {
+		s.Close()
+		s.Close()
+		ts1.Close()
+		ts2.Close()
+	})
+	// Only the Courses block is released, other still holds the Students block
+	assert.Equal(t, available+1, bufferManager.Available())
+
+	count := 0
+	for {
+		hasNext, err := other.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		count++
+	}
+	assert.Equal(t, 3, count)
+	other.Close()
+	assert.Equal(t, available+2, bufferManager.Available())
+
+	// A closed table scan can't be used until it is moved to a block again
+	_, err = ts1.Next()
+	assert.ErrorIs(t, err, table.ErrScanClosed)
+	assert.ErrorIs(t, ts1.Insert(), table.ErrScanClosed)
+	require.NoError(t, ts1.BeforeFirst())
+	hasNext, err = ts1.Next()
+	require.NoError(t, err)
+	assert.True(t, hasNext)
+	ts1.Close()
+	assert.Equal(t, available+2, bufferManager.Available())
+}
+
+// TestProductScanCancel tests that canceling the transaction's context stops a large
+// cartesian product promptly, and that closing the scan then releases its buffers
+func TestProductScanCancel(t *testing.T) {
+	testDir := "/tmp/testdb_productscan_cancel"
+	defer os.RemoveAll(testDir)
+
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+	defer tx.Commit()
+
+	newTable := func(tableName string, fieldName string) *table.TableScan {
+		schema := record.NewSchema()
+		schema.AddIntField(fieldName)
+		ts, err := table.NewTableScan(tx, record.NewLayoutFromSchema(schema), tableName)
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, ts.Insert())
+			require.NoError(t, ts.SetInt(fieldName, i))
+		}
+		return ts
+	}
+	ts1 := newTable("Left", "a")
+	ts2 := newTable("Right", "b")
+	available := bufferManager.Available() + 2
+
+	t.Run("BetweenRecords", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tx.SetContext(ctx)
+		defer tx.SetContext(nil)
+
+		s := NewProductScan(ts1, ts2)
+		require.NoError(t, s.BeforeFirst())
+		for i := 0; i < 100; i++ {
+			hasNext, err := s.Next()
+			require.NoError(t, err)
+			require.True(t, hasNext)
+		}
+		cancel()
+		_, err := s.Next()
+		assert.ErrorIs(t, err, transaction.ErrCanceled)
+		assert.ErrorIs(t, err, context.Canceled)
+		s.Close()
+		assert.Equal(t, available, bufferManager.Available())
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		tx.SetContext(ctx)
+		defer tx.SetContext(nil)
+
+		// No pair satisfies the predicate, so a single Next would read the whole product
+		s := NewSelectScan(NewProductScan(ts1, ts2), *createEqualsPredicate("a", -1))
+		require.NoError(t, s.BeforeFirst())
+		start := time.Now()
+		_, err := s.Next()
+		assert.ErrorIs(t, err, transaction.ErrCanceled)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 2*time.Second)
+		s.Close()
+		assert.Equal(t, available, bufferManager.Available())
+	})
+}
+
+// TestProductScanReiteration tests that each pass over a product reflects the current
+// contents of both tables, including when one of them has become empty
+func TestProductScanReiteration(t *testing.T) {
+	testDir := "/tmp/testdb_productscan_reiteration"
+	defer os.RemoveAll(testDir)
+
+	tx, ts1, ts2 := setupProductScanTest(t, testDir)
+	defer tx.Commit()
+
+	productScan := NewProductScan(ts1, ts2)
+	defer productScan.Close()
+
+	// pairs returns the student and course ids of each record of a fresh pass
+	pairs := func() []string {
+		require.NoError(t, productScan.BeforeFirst())
+		result := []string{}
+		for {
+			hasNext, err := productScan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			studentID, err := productScan.GetInt("student_id")
+			require.NoError(t, err)
+			courseID, err := productScan.GetInt("course_id")
+			require.NoError(t, err)
+			result = append(result, fmt.Sprintf("%d:%d", studentID, courseID))
+		}
+		// Once traversed, the product stays at its end
+		hasNext, err := productScan.Next()
+		require.NoError(t, err)
+		assert.False(t, hasNext)
+		return result
+	}
+
+	// deleteAll deletes every record of a table through a separate scan
+	deleteAll := func(tableName string, layout *record.Layout) {
+		ts, err := table.NewTableScan(tx, layout, tableName)
+		require.NoError(t, err)
+		defer ts.Close()
+		for {
+			hasNext, err := ts.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			require.NoError(t, ts.Delete())
+		}
+	}
+
+	coursesSchema := record.NewSchema()
+	coursesSchema.AddIntField("course_id")
+	coursesSchema.AddStringField("course_name", 20)
+	coursesLayout := record.NewLayoutFromSchema(coursesSchema)
+	studentsSchema := record.NewSchema()
+	studentsSchema.AddIntField("student_id")
+	studentsSchema.AddStringField("name", 20)
+	studentsLayout := record.NewLayoutFromSchema(studentsSchema)
+
+	assert.Equal(t, []string{"1:101", "1:102", "2:101", "2:102", "3:101", "3:102"}, pairs())
+
+	// The right table is emptied between passes
+	deleteAll("Courses", coursesLayout)
+	assert.Empty(t, pairs())
+
+	// A course is added back
+	courses, err := table.NewTableScan(tx, coursesLayout, "Courses")
+	require.NoError(t, err)
+	require.NoError(t, courses.Insert())
+	require.NoError(t, courses.SetInt("course_id", 103))
+	require.NoError(t, courses.SetString("course_name", "Art"))
+	courses.Close()
+	assert.Equal(t, []string{"1:103", "2:103", "3:103"}, pairs())
+
+	// The left table is emptied, so no course may be paired with a stale student
+	deleteAll("Students", studentsLayout)
+	assert.Empty(t, pairs())
+}
@@ -11,15 +11,26 @@ var (
 	_ scan.Scan = (*ProjectScan)(nil)
 )
 
+// ProjectScan outputs the listed fields of its input scan. A field can also be computed
+// by an expression over the input record, in which case it is named after the expression
+// or an alias (e.g. SELECT salary * 2 AS bonus).
 type ProjectScan struct {
-	input     scan.Scan
-	fieldList []string
+	input       scan.Scan
+	fieldList   []string
+	expressions map[string]Expression
 }
 
 func NewProjectScan(input scan.Scan, fieldList []string) *ProjectScan {
+	return NewProjectScanWithExpressions(input, fieldList, nil)
+}
+
+// NewProjectScanWithExpressions creates a project scan whose fields include computed ones,
+// mapped to their expression in expressions by their name.
+func NewProjectScanWithExpressions(input scan.Scan, fieldList []string, expressions map[string]Expression) *ProjectScan {
 	return &ProjectScan{
-		input:     input,
-		fieldList: fieldList,
+		input:       input,
+		fieldList:   fieldList,
+		expressions: expressions,
 	}
 }
 
@@ -35,6 +46,13 @@ func (s *ProjectScan) GetInt(fldname string) (int, error) {
 	if !s.HasField(fldname) {
 		return 0, fmt.Errorf("field not found: %s", fldname)
 	}
+	if expr, ok := s.expressions[fldname]; ok {
+		val, err := expr.Evaluate(s.input)
+		if err != nil {
+			return 0, err
+		}
+		return val.AsInt(), nil
+	}
 	return s.input.GetInt(fldname)
 }
 
@@ -42,6 +60,13 @@ func (s *ProjectScan) GetString(fldname string) (string, error) {
 	if !s.HasField(fldname) {
 		return "", fmt.Errorf("field not found: %s", fldname)
 	}
+	if expr, ok := s.expressions[fldname]; ok {
+		val, err := expr.Evaluate(s.input)
+		if err != nil {
+			return "", err
+		}
+		return val.AsString(), nil
+	}
 	return s.input.GetString(fldname)
 }
 
@@ -49,6 +74,9 @@ func (s *ProjectScan) GetValue(fldname string) (any, error) {
 	if !s.HasField(fldname) {
 		return nil, fmt.Errorf("field not found: %s", fldname)
 	}
+	if expr, ok := s.expressions[fldname]; ok {
+		return expr.Evaluate(s.input)
+	}
 	return s.input.GetValue(fldname)
 }
 
@@ -517,3 +517,45 @@ func TestProjectScanOrdering(t *testing.T) {
 
 	projectScan.Close()
 }
+
+// TestProjectScanComputedFields tests projecting computed fields next to plain ones
+func TestProjectScanComputedFields(t *testing.T) {
+	testDir := "/tmp/testdb_projectscan_computed"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	expressions := map[string]Expression{
+		"bonus": *NewBinaryExpression(NewFieldNameExpression("age"), OpMultiply, NewConstantExpression(*NewIntConstant(2))),
+		"who":   *NewFieldNameExpression("name"),
+	}
+	projectScan := NewProjectScanWithExpressions(ts, []string{"id", "bonus", "who"}, expressions)
+	defer projectScan.Close()
+
+	assert.True(t, projectScan.HasField("bonus"))
+	assert.True(t, projectScan.HasField("who"))
+	assert.False(t, projectScan.HasField("age"), "Fields only used by expressions are not projected")
+	assert.False(t, projectScan.HasField("name"))
+
+	require.NoError(t, projectScan.BeforeFirst())
+	hasNext, err := projectScan.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+
+	id, err := projectScan.GetInt("id")
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	bonus, err := projectScan.GetInt("bonus")
+	require.NoError(t, err)
+	assert.Equal(t, 50, bonus)
+	who, err := projectScan.GetString("who")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", who)
+	val, err := projectScan.GetValue("bonus")
+	require.NoError(t, err)
+	assert.Equal(t, *NewIntConstant(50), val)
+
+	_, err = projectScan.GetInt("age")
+	assert.Error(t, err)
+}
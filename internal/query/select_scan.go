@@ -27,6 +27,8 @@ func (s *SelectScan) BeforeFirst() error {
 	return s.input.BeforeFirst()
 }
 
+// Next moves to the next record that satisfies the predicate. Records that don't are
+// skipped, each through the input's Next, so a canceled transaction still stops the loop.
 func (s *SelectScan) Next() (bool, error) {
 	for {
 		hasNext, err := s.input.Next()
@@ -82,6 +84,14 @@ func (s *SelectScan) SetString(fldname string, val string) error {
 	return updateScan.SetString(fldname, val)
 }
 
+func (s *SelectScan) SetValue(fldname string, val any) error {
+	updateScan, ok := s.input.(scan.UpdateScan)
+	if !ok {
+		return fmt.Errorf("input is not an scan.UpdateScan")
+	}
+	return updateScan.SetValue(fldname, val)
+}
+
 func (s *SelectScan) Insert() error {
 	updateScan, ok := s.input.(scan.UpdateScan)
 	if !ok {
@@ -666,3 +666,49 @@ func TestSelectScanNavigationOperations(t *testing.T) {
 		selectScan.Close()
 	})
 }
+
+// TestSelectScanLike tests filtering string fields with LIKE patterns
+func TestSelectScanLike(t *testing.T) {
+	testDir := "/tmp/testdb_selectscan_like"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+
+	selectNames := func(fieldName string, pattern string) []string {
+		term := NewComparisonTerm(*NewFieldNameExpression(fieldName), OpLike, *NewConstantExpression(*NewStringConstant(pattern)))
+		selectScan := NewSelectScan(ts, *NewPredicate(*term))
+		err := selectScan.BeforeFirst()
+		require.NoError(t, err)
+
+		names := []string{}
+		for {
+			hasNext, err := selectScan.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				break
+			}
+			name, err := selectScan.GetString("name")
+			require.NoError(t, err)
+			names = append(names, name)
+		}
+		return names
+	}
+
+	// Prefix
+	assert.ElementsMatch(t, []string{"Alice"}, selectNames("name", "A%"))
+	// Suffix
+	assert.ElementsMatch(t, []string{"Frank"}, selectNames("name", "%k"))
+	assert.ElementsMatch(t, []string{"Alice", "Charlie", "Eve", "Grace"}, selectNames("name", "%e"))
+	// Infix
+	assert.ElementsMatch(t, []string{"Charlie", "David", "Frank", "Grace"}, selectNames("name", "%a%"))
+	// Single character wildcard
+	assert.ElementsMatch(t, []string{"Bob", "Eve"}, selectNames("name", "___"))
+
+	// LIKE on an int field is a type error
+	term := NewComparisonTerm(*NewFieldNameExpression("age"), OpLike, *NewConstantExpression(*NewStringConstant("%")))
+	selectScan := NewSelectScan(ts, *NewPredicate(*term))
+	require.NoError(t, selectScan.BeforeFirst())
+	_, err := selectScan.Next()
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+}
@@ -0,0 +1,219 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+var (
+	_ scan.Scan = (*SortScan)(nil)
+)
+
+// SortKey is one key of an ORDER BY: an expression over the fields of the records to sort,
+// in ascending order unless descending is set.
+type SortKey struct {
+	expr       *Expression
+	descending bool
+}
+
+// NewSortKey creates a key ordering records by the value of the expression.
+func NewSortKey(expr *Expression, descending bool) *SortKey {
+	return &SortKey{
+		expr:       expr,
+		descending: descending,
+	}
+}
+
+// Expression returns the expression the records are ordered by.
+func (k *SortKey) Expression() *Expression {
+	return k.expr
+}
+
+// IsDescending checks if the records are ordered from the greatest value to the smallest.
+func (k *SortKey) IsDescending() bool {
+	return k.descending
+}
+
+// String returns the key as it is written in an ORDER BY clause.
+func (k *SortKey) String() string {
+	if k.descending {
+		return k.expr.String() + " desc"
+	}
+	return k.expr.String()
+}
+
+// sortedRow holds the values of the fields of one record and of the sort keys.
+type sortedRow struct {
+	values []Constant
+	keys   []Constant
+}
+
+// SortScan returns the records of its input scan ordered by the sort keys: by the first key,
+// then by the next one among records with equal values, and so on. Records equal on every key
+// keep the order of the input. Numbers come before strings, as in Constant.CompareTo.
+// The records are read into memory when the scan is positioned; only the fields of the given
+// schema are kept, and can be read by the names the schema resolves, qualified or not.
+type SortScan struct {
+	input   scan.Scan
+	schema  *record.Schema
+	fields  []string
+	keys    []*SortKey
+	maxRows int
+	rows    []*sortedRow
+	built   bool
+	current int
+}
+
+// NewSortScan creates a sort scan keeping the fields of the schema from its input's records.
+// It fails with ErrResultTooLarge instead of holding more than maxRows records in memory; a
+// maxRows of 0 means no limit.
+func NewSortScan(input scan.Scan, schema *record.Schema, keys []*SortKey, maxRows int) *SortScan {
+	return &SortScan{
+		input:   input,
+		schema:  schema,
+		fields:  schema.Fields(),
+		keys:    keys,
+		maxRows: maxRows,
+		current: -1,
+	}
+}
+
+// BeforeFirst reads and sorts the whole input scan, and positions the scan before the first record.
+func (s *SortScan) BeforeFirst() error {
+	err := s.sortRows()
+	if err != nil {
+		return err
+	}
+	s.current = -1
+	return nil
+}
+
+func (s *SortScan) Next() (bool, error) {
+	if !s.built {
+		err := s.BeforeFirst()
+		if err != nil {
+			return false, err
+		}
+	}
+	if s.current < len(s.rows) {
+		s.current++
+	}
+	return s.current < len(s.rows), nil
+}
+
+func (s *SortScan) GetInt(fldname string) (int, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return 0, err
+	}
+	if !val.IsInt() {
+		return 0, fmt.Errorf("field %s is not an int", fldname)
+	}
+	return val.AsInt(), nil
+}
+
+func (s *SortScan) GetString(fldname string) (string, error) {
+	val, err := s.value(fldname)
+	if err != nil {
+		return "", err
+	}
+	if !val.IsString() {
+		return "", fmt.Errorf("field %s is not a string", fldname)
+	}
+	return val.AsString(), nil
+}
+
+func (s *SortScan) GetValue(fldname string) (any, error) {
+	return s.value(fldname)
+}
+
+func (s *SortScan) HasField(fldname string) bool {
+	return s.schema.HasField(fldname)
+}
+
+func (s *SortScan) Close() {
+	s.input.Close()
+}
+
+// value returns the value of a field of the current record.
+func (s *SortScan) value(fldname string) (Constant, error) {
+	if s.current < 0 || s.current >= len(s.rows) {
+		return Constant{}, fmt.Errorf("sort scan is not positioned on a record")
+	}
+	name, ok := s.schema.Resolve(fldname)
+	if !ok {
+		return Constant{}, fmt.Errorf("field %s not found in sort scan", fldname)
+	}
+	i := slices.Index(s.fields, name)
+	return s.rows[s.current].values[i], nil
+}
+
+// sortRows reads the records of the input scan with the values of their keys, and sorts them.
+func (s *SortScan) sortRows() error {
+	s.rows = nil
+	s.built = false
+
+	err := s.input.BeforeFirst()
+	if err != nil {
+		return err
+	}
+	fieldExprs := make([]*Expression, len(s.fields))
+	for i, field := range s.fields {
+		fieldExprs[i] = NewFieldNameExpression(field)
+	}
+	rows := []*sortedRow{}
+	for {
+		hasNext, err := s.input.Next()
+		if err != nil {
+			return err
+		}
+		if !hasNext {
+			break
+		}
+		if s.maxRows > 0 && len(rows) >= s.maxRows {
+			return fmt.Errorf("%w: more than %d rows to sort", ErrResultTooLarge, s.maxRows)
+		}
+		row := &sortedRow{
+			values: make([]Constant, len(s.fields)),
+			keys:   make([]Constant, len(s.keys)),
+		}
+		for i, expr := range fieldExprs {
+			row.values[i], err = expr.Evaluate(s.input)
+			if err != nil {
+				return err
+			}
+		}
+		for i, key := range s.keys {
+			row.keys[i], err = key.expr.Evaluate(s.input)
+			if err != nil {
+				return err
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return s.compareRows(rows[i], rows[j]) < 0
+	})
+	s.rows = rows
+	s.built = true
+	return nil
+}
+
+// compareRows orders two records by their keys, the first one that differs deciding.
+func (s *SortScan) compareRows(a *sortedRow, b *sortedRow) int {
+	for i, key := range s.keys {
+		cmp := a.keys[i].CompareTo(&b.keys[i])
+		if key.descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package query
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/record"
+)
+
+// readSorted returns the ids of the records of a sort scan, in order
+func readSorted(t *testing.T, s *SortScan) []int {
+	require.NoError(t, s.BeforeFirst())
+	ids := []int{}
+	for {
+		hasNext, err := s.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			return ids
+		}
+		id, err := s.GetInt("id")
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+}
+
+// idSchema returns the schema of the id field of the test table
+func idSchema() *record.Schema {
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	return schema
+}
+
+// TestSortScan tests ordering records by fields and computed expressions, in both directions
+func TestSortScan(t *testing.T) {
+	testDir := "/tmp/testdb_sortscan"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+	fields := record.NewSchema()
+	fields.AddIntField("id")
+	fields.AddIntField("age")
+	fields.AddStringField("name", 20)
+
+	// By age, then by name descending among equal ages
+	byAge := NewSortScan(ts, fields, []*SortKey{
+		NewSortKey(NewFieldNameExpression("age"), false),
+		NewSortKey(NewFieldNameExpression("name"), true),
+	}, 0)
+	assert.Equal(t, []int{5, 3, 1, 7, 2, 4, 6, 8}, readSorted(t, byAge))
+	assert.True(t, byAge.HasField("name"))
+	assert.False(t, byAge.HasField("salary"))
+
+	// The records keep all their fields
+	require.NoError(t, byAge.BeforeFirst())
+	hasNext, err := byAge.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	name, err := byAge.GetString("name")
+	require.NoError(t, err)
+	assert.Equal(t, "Eve", name)
+	val, err := byAge.GetValue("age")
+	require.NoError(t, err)
+	assert.Equal(t, *NewIntConstant(25), val)
+
+	// By a computed value descending: records equal on it keep the order of the input
+	byComputed := NewSortScan(ts, fields, []*SortKey{
+		NewSortKey(NewBinaryExpression(NewFieldNameExpression("age"), OpDivide, NewConstantExpression(*NewIntConstant(10))), true),
+	}, 0)
+	assert.Equal(t, []int{6, 8, 2, 4, 7, 1, 3, 5}, readSorted(t, byComputed))
+
+	// The keys don't have to be kept
+	idsOnly := NewSortScan(ts, idSchema(), []*SortKey{NewSortKey(NewFieldNameExpression("name"), true)}, 0)
+	assert.Equal(t, []int{8, 7, 6, 5, 4, 3, 2, 1}, readSorted(t, idsOnly))
+	_, err = idsOnly.GetString("name")
+	assert.Error(t, err)
+
+	// Fields of a table can be read by their qualified names
+	qualified := NewSortScan(ts, idSchema().WithTable("people"), []*SortKey{NewSortKey(NewFieldNameExpression("id"), true)}, 0)
+	require.NoError(t, qualified.BeforeFirst())
+	hasNext, err = qualified.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	id, err := qualified.GetInt("people.id")
+	require.NoError(t, err)
+	assert.Equal(t, 8, id)
+	assert.True(t, qualified.HasField("people.id"))
+	assert.False(t, qualified.HasField("others.id"))
+}
+
+// TestSortScanLimit tests that a sort scan fails instead of holding more records than its limit
+func TestSortScanLimit(t *testing.T) {
+	testDir := "/tmp/testdb_sortscan_limit"
+	defer os.RemoveAll(testDir)
+
+	tx, ts := setupTestDB(t, testDir)
+	defer tx.Commit()
+	keys := []*SortKey{NewSortKey(NewFieldNameExpression("id"), false)}
+
+	_, err := NewSortScan(ts, idSchema(), keys, 7).Next()
+	assert.True(t, errors.Is(err, ErrResultTooLarge))
+
+	assert.Len(t, readSorted(t, NewSortScan(ts, idSchema(), keys, 8)), 8)
+}
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/scan"
+)
+
+// Subquery is a query nested in a condition, e.g. EXISTS (SELECT ...), or in an expression,
+// e.g. salary = (SELECT MAX(salary) FROM employees). The parser only records the query.
+// The planner binds an EXISTS subquery before the condition is checked, with the fields
+// of the enclosing query it refers to and a function that runs it for a record; it replaces
+// a subquery in an expression with its value.
+type Subquery struct {
+	query       fmt.Stringer
+	outerFields []string
+	exists      func(outer scan.Scan) (bool, error)
+}
+
+// NewSubquery creates an unbound subquery for a parsed query.
+func NewSubquery(query fmt.Stringer) *Subquery {
+	return &Subquery{query: query}
+}
+
+// Query returns the parsed query.
+func (sq *Subquery) Query() fmt.Stringer {
+	return sq.query
+}
+
+// Bind sets the fields of the enclosing query the subquery refers to, and the function
+// that reports whether it returns a row for the current record of the enclosing scan.
+func (sq *Subquery) Bind(outerFields []string, exists func(outer scan.Scan) (bool, error)) {
+	sq.outerFields = outerFields
+	sq.exists = exists
+}
+
+// OuterFields returns the fields of the enclosing query the subquery refers to.
+func (sq *Subquery) OuterFields() []string {
+	return sq.outerFields
+}
+
+// Exists reports whether the subquery returns a row for the current record of outer.
+func (sq *Subquery) Exists(outer scan.Scan) (bool, error) {
+	if sq.exists == nil {
+		return false, sq.unboundError()
+	}
+	return sq.exists(outer)
+}
+
+// unboundError is the error of running a subquery the planner hasn't handled.
+func (sq *Subquery) unboundError() error {
+	return fmt.Errorf("subquery %s is only supported in the WHERE clause of a query", sq.String())
+}
+
+// String returns the parenthesized query.
+func (sq *Subquery) String() string {
+	return "(" + sq.query.String() + ")"
+}
@@ -1,66 +1,489 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/yashagw/cranedb/internal/record"
 	"github.com/yashagw/cranedb/internal/scan"
 )
 
+// ErrTypeMismatch is returned for a term comparing a number with a string, or matching a
+// number with LIKE
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// Operator is the comparison operator of a Term.
+type Operator int
+
+const (
+	OpEquals Operator = iota
+	OpNotEquals
+	OpLessThan
+	OpLessThanOrEqual
+	OpGreaterThan
+	OpGreaterThanOrEqual
+	OpIn
+	OpLike
+	OpExists
+	OpNotExists
+	OpNot
+)
+
+// String returns the SQL symbol of the operator.
+func (op Operator) String() string {
+	switch op {
+	case OpNotEquals:
+		return "<>"
+	case OpLessThan:
+		return "<"
+	case OpLessThanOrEqual:
+		return "<="
+	case OpGreaterThan:
+		return ">"
+	case OpGreaterThanOrEqual:
+		return ">="
+	case OpIn:
+		return "in"
+	case OpLike:
+		return "like"
+	case OpExists:
+		return "exists"
+	case OpNotExists:
+		return "not exists"
+	case OpNot:
+		return "not"
+	default:
+		return "="
+	}
+}
+
 // Term represents a boolean comparison between two expressions
-// (e.g., field = constant, field = field, constant = constant).
+// (e.g., field = constant, field > constant, field = field, constant = constant),
+// an IN list test of an expression against a set of constants or the values a subquery
+// returns, an EXISTS test of a subquery, or the negation of a predicate.
 type Term struct {
-	left  Expression
-	right Expression
+	left     Expression
+	op       Operator
+	right    Expression
+	values   []Constant
+	subquery *Subquery
+	// inQuery is the subquery an IN term takes its values from, until the planner replaces it
+	// with the values it returns
+	inQuery *Subquery
+	// negated is the predicate a NOT term negates
+	negated *Predicate
 }
 
-// NewTerm creates a new Term with two expressions
+// NewTerm creates a new equality Term with two expressions
 func NewTerm(left Expression, right Expression) *Term {
+	return NewComparisonTerm(left, OpEquals, right)
+}
+
+// NewComparisonTerm creates a new Term comparing two expressions with the given operator
+func NewComparisonTerm(left Expression, op Operator, right Expression) *Term {
 	return &Term{
 		left:  left,
+		op:    op,
 		right: right,
 	}
 }
 
+// NewInTerm creates a new Term that is satisfied when the expression equals any of the values.
+// Duplicate values are removed.
+func NewInTerm(left Expression, values []Constant) *Term {
+	unique := make([]Constant, 0, len(values))
+	for _, v := range values {
+		duplicate := false
+		for _, u := range unique {
+			if u.Equals(&v) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, v)
+		}
+	}
+	return &Term{
+		left:   left,
+		op:     OpIn,
+		values: unique,
+	}
+}
+
+// NewInSubqueryTerm creates a new Term that is satisfied when the expression equals any of the
+// values of the single column the subquery returns, e.g. id IN (SELECT student_id FROM enrollments).
+func NewInSubqueryTerm(left Expression, subquery *Subquery) *Term {
+	return &Term{
+		left:    left,
+		op:      OpIn,
+		inQuery: subquery,
+	}
+}
+
+// NewExistsTerm creates a new Term that is satisfied when the subquery returns a row,
+// or when it returns none if negated is set.
+func NewExistsTerm(subquery *Subquery, negated bool) *Term {
+	op := OpExists
+	if negated {
+		op = OpNotExists
+	}
+	return &Term{
+		op:       op,
+		subquery: subquery,
+	}
+}
+
+// NewNotTerm creates a new Term that is satisfied when the predicate isn't, e.g. NOT (age = 25).
+func NewNotTerm(pred *Predicate) *Term {
+	return &Term{
+		op:      OpNot,
+		negated: pred,
+	}
+}
+
 // String returns a string representation of the term
 func (t *Term) String() string {
-	return fmt.Sprintf("%s = %s", t.left.String(), t.right.String())
+	if t.op == OpNot {
+		return fmt.Sprintf("not (%s)", t.negated.String())
+	}
+	if t.subquery != nil {
+		return fmt.Sprintf("%s %s", t.op.String(), t.subquery.String())
+	}
+	if t.inQuery != nil {
+		return fmt.Sprintf("%s in %s", t.left.String(), t.inQuery.String())
+	}
+	if t.op == OpIn {
+		parts := make([]string, len(t.values))
+		for i, v := range t.values {
+			parts[i] = constantString(v)
+		}
+		return fmt.Sprintf("%s in (%s)", t.left.String(), strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("%s %s %s", t.left.String(), t.op.String(), t.right.String())
+}
+
+// Operator returns the comparison operator of the term
+func (t *Term) Operator() Operator {
+	return t.op
+}
+
+// Negated returns the predicate a NOT term negates, or nil for any other term
+func (t *Term) Negated() *Predicate {
+	return t.negated
+}
+
+// Subquery returns the subquery of an EXISTS term, or nil for any other term
+func (t *Term) Subquery() *Subquery {
+	return t.subquery
+}
+
+// InSubqueries returns the subqueries of the IN terms the term is or negates whose values
+// haven't been given yet.
+func (t *Term) InSubqueries() []*Subquery {
+	if t.op == OpNot {
+		return t.negated.InSubqueries()
+	}
+	if t.inQuery != nil {
+		return []*Subquery{t.inQuery}
+	}
+	return nil
+}
+
+// WithInValues returns a copy of the term with the given subqueries of IN terms replaced by
+// the lists of values they return.
+func (t *Term) WithInValues(values map[*Subquery][]Constant) *Term {
+	if t.op == OpNot {
+		result := *t
+		result.negated = t.negated.WithInValues(values)
+		return &result
+	}
+	if list, ok := values[t.inQuery]; ok && t.inQuery != nil {
+		return NewInTerm(t.left, list)
+	}
+	return t
+}
+
+// WithFieldValues returns a copy of the term with the given fields replaced by their values.
+// The subquery of an EXISTS term is kept as it is.
+func (t *Term) WithFieldValues(values map[string]Constant) *Term {
+	return t.mapExpressions(func(e *Expression) *Expression {
+		return e.WithFieldValues(values)
+	})
+}
+
+// WithSubqueryValues returns a copy of the term with the given scalar subqueries replaced by their values.
+func (t *Term) WithSubqueryValues(values map[*Subquery]Constant) *Term {
+	return t.mapExpressions(func(e *Expression) *Expression {
+		return e.WithSubqueryValues(values)
+	})
+}
+
+// SubstituteConstant returns a copy of the term with the placeholders or the fields of the
+// given name replaced by the value.
+func (t *Term) SubstituteConstant(placeholderOrField string, value Constant) *Term {
+	return t.mapExpressions(func(e *Expression) *Expression {
+		return e.SubstituteConstant(placeholderOrField, value)
+	})
+}
+
+// mapExpressions returns a copy of the term whose expressions are replaced by fn applied to them.
+func (t *Term) mapExpressions(fn func(*Expression) *Expression) *Term {
+	result := *t
+	if t.op == OpNot {
+		result.negated = &Predicate{terms: make([]Term, len(t.negated.terms))}
+		for i := range t.negated.terms {
+			result.negated.terms[i] = *t.negated.terms[i].mapExpressions(fn)
+		}
+	} else if t.subquery == nil {
+		result.left = *fn(&t.left)
+		if t.op != OpIn {
+			result.right = *fn(&t.right)
+		}
+	}
+	return &result
+}
+
+// Subqueries returns the scalar subqueries of the term's expressions.
+func (t *Term) Subqueries() []*Subquery {
+	if t.op == OpNot {
+		return t.negated.Subqueries()
+	}
+	if t.subquery != nil {
+		return nil
+	}
+	return append(t.left.Subqueries(), t.right.Subqueries()...)
 }
 
 // IsSatisfied checks if the term is true for the current record in the scan.
+// Comparing a number with a string fails with ErrTypeMismatch; a value of an IN list
+// of a different type than the tested value just doesn't match it.
 func (t *Term) IsSatisfied(s scan.Scan) (bool, error) {
+	if t.subquery != nil {
+		exists, err := t.subquery.Exists(s)
+		if err != nil {
+			return false, err
+		}
+		return exists == (t.op == OpExists), nil
+	}
+	if t.op == OpNot {
+		// Without NULLs a condition is either true or false, so its negation is the opposite.
+		// With them, the negation of an unknown condition would have to stay unknown.
+		satisfied, err := t.negated.IsSatisfied(s)
+		if err != nil {
+			return false, err
+		}
+		return !satisfied, nil
+	}
 	lhsVal, err := t.left.Evaluate(s)
 	if err != nil {
 		return false, err
 	}
+	if t.op == OpIn {
+		if t.inQuery != nil {
+			return false, t.inQuery.unboundError()
+		}
+		for _, v := range t.values {
+			if v.Equals(&lhsVal) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
 	rhsVal, err := t.right.Evaluate(s)
 	if err != nil {
 		return false, err
 	}
-	return (&rhsVal).Equals(&lhsVal), nil
+	if lhsVal.IsInt() != rhsVal.IsInt() {
+		return false, fmt.Errorf("%w: cannot compare %s with %s", ErrTypeMismatch, constantString(lhsVal), constantString(rhsVal))
+	}
+	if t.op == OpLike {
+		if !lhsVal.IsString() {
+			return false, fmt.Errorf("%w: LIKE needs strings, got %s", ErrTypeMismatch, constantString(lhsVal))
+		}
+		return matchLike(lhsVal.AsString(), rhsVal.AsString()), nil
+	}
+
+	cmp := (&lhsVal).CompareTo(&rhsVal)
+	switch t.op {
+	case OpNotEquals:
+		return cmp != 0, nil
+	case OpLessThan:
+		return cmp < 0, nil
+	case OpLessThanOrEqual:
+		return cmp <= 0, nil
+	case OpGreaterThan:
+		return cmp > 0, nil
+	case OpGreaterThanOrEqual:
+		return cmp >= 0, nil
+	default:
+		return cmp == 0, nil
+	}
+}
+
+// CheckTypes checks, for records of the given schema, that the term compares numbers with
+// numbers and strings with strings, and only matches strings with LIKE. It fails with
+// ErrTypeMismatch otherwise. Terms that don't apply to the schema, or hold subqueries whose
+// values aren't known yet, aren't checked.
+func (t *Term) CheckTypes(sch *record.Schema) error {
+	if t.op == OpNot {
+		return t.negated.CheckTypes(sch)
+	}
+	// The type of a placeholder is only known once its value is given
+	if t.subquery != nil || t.inQuery != nil || len(t.Subqueries()) > 0 || t.left.HasPlaceholders() || t.right.HasPlaceholders() || !t.AppliesTo(sch) {
+		return nil
+	}
+	lhsType, _ := t.left.FieldInfo(sch)
+	if t.op == OpIn {
+		for _, v := range t.values {
+			if (lhsType == "string") != v.IsString() {
+				return fmt.Errorf("%w: cannot compare %s (%s) with %s", ErrTypeMismatch, t.left.String(), lhsType, constantString(v))
+			}
+		}
+		return nil
+	}
+	rhsType, _ := t.right.FieldInfo(sch)
+	if (lhsType == "string") != (rhsType == "string") {
+		return fmt.Errorf("%w: cannot compare %s (%s) with %s (%s)", ErrTypeMismatch, t.left.String(), lhsType, t.right.String(), rhsType)
+	}
+	if t.op == OpLike && lhsType != "string" {
+		return fmt.Errorf("%w: LIKE needs strings, got %s (%s)", ErrTypeMismatch, t.left.String(), lhsType)
+	}
+	return nil
+}
+
+// constantString returns the constant as it is written in a statement, in quotes if it is a string
+func constantString(c Constant) string {
+	if c.IsString() {
+		return "'" + strings.ReplaceAll(c.AsString(), "'", "''") + "'"
+	}
+	return c.String()
 }
 
 // appliesTo checks if both expressions of the term apply to the given schema.
+// An EXISTS term applies to a schema holding every field of it the subquery refers to,
+// and a NOT term to one every term it negates applies to.
 func (t *Term) AppliesTo(sch *record.Schema) bool {
+	if t.op == OpNot {
+		for i := range t.negated.terms {
+			if !t.negated.terms[i].AppliesTo(sch) {
+				return false
+			}
+		}
+		return true
+	}
+	if t.subquery != nil {
+		for _, field := range t.subquery.OuterFields() {
+			if !sch.HasField(field) {
+				return false
+			}
+		}
+		return true
+	}
 	return t.left.AppliesTo(sch) && t.right.AppliesTo(sch)
 }
 
+// isConstant checks if the term refers to no field, placeholder or subquery, so that it is
+// either always true or always false. A NOT term is when every term it negates is.
+func (t *Term) isConstant() bool {
+	if t.op == OpNot {
+		for i := range t.negated.terms {
+			if !t.negated.terms[i].isConstant() {
+				return false
+			}
+		}
+		return true
+	}
+	if t.subquery != nil || t.inQuery != nil || len(t.Subqueries()) > 0 || len(t.FieldNames()) > 0 {
+		return false
+	}
+	return !t.left.HasPlaceholders() && !t.right.HasPlaceholders()
+}
+
+// FieldNames returns the names of the fields the term refers to.
+// Those of an EXISTS term are the fields of the enclosing query its subquery refers to, and
+// those of a NOT term the fields of the terms it negates.
+func (t *Term) FieldNames() []string {
+	if t.op == OpNot {
+		var fields []string
+		for i := range t.negated.terms {
+			fields = append(fields, t.negated.terms[i].FieldNames()...)
+		}
+		return fields
+	}
+	if t.subquery != nil {
+		return append([]string{}, t.subquery.OuterFields()...)
+	}
+	return append(t.left.FieldNames(), t.right.FieldNames()...)
+}
+
 // EquatesWithConstant checks if this term is "field = constant" or "constant = field" for the given field name.
 // If yes, it returns the constant on the other side; otherwise, it returns nil.
 func (t *Term) EquatesWithConstant(fieldName string) *Constant {
-	if t.left.IsFieldName() && t.left.AsFieldName() == fieldName && !t.right.IsFieldName() {
+	if t.op != OpEquals {
+		return nil
+	}
+	if t.left.IsFieldName() && t.left.AsFieldName() == fieldName && t.right.IsConstant() {
 		constVal := t.right.AsConstant()
 		return &constVal
-	} else if t.right.IsFieldName() && t.right.AsFieldName() == fieldName && !t.left.IsFieldName() {
+	} else if t.right.IsFieldName() && t.right.AsFieldName() == fieldName && t.left.IsConstant() {
 		constVal := t.left.AsConstant()
 		return &constVal
 	}
 	return nil
 }
 
+// ComparesWithConstant checks if this term compares the given field with a constant using
+// <, <=, > or >=. If yes, it returns the operator as it applies with the field on the left
+// (e.g. GreaterThan for "5 < age") and the constant; otherwise, it returns a nil constant.
+func (t *Term) ComparesWithConstant(fieldName string) (Operator, *Constant) {
+	switch t.op {
+	case OpLessThan, OpLessThanOrEqual, OpGreaterThan, OpGreaterThanOrEqual:
+	default:
+		return t.op, nil
+	}
+	if t.left.IsFieldName() && t.left.AsFieldName() == fieldName && t.right.IsConstant() {
+		constVal := t.right.AsConstant()
+		return t.op, &constVal
+	}
+	if t.right.IsFieldName() && t.right.AsFieldName() == fieldName && t.left.IsConstant() {
+		constVal := t.left.AsConstant()
+		return reversedComparison(t.op), &constVal
+	}
+	return t.op, nil
+}
+
+// reversedComparison returns the comparison that holds with the sides swapped.
+func reversedComparison(op Operator) Operator {
+	switch op {
+	case OpLessThan:
+		return OpGreaterThan
+	case OpLessThanOrEqual:
+		return OpGreaterThanOrEqual
+	case OpGreaterThan:
+		return OpLessThan
+	case OpGreaterThanOrEqual:
+		return OpLessThanOrEqual
+	}
+	return op
+}
+
+// InConstants checks if this term is "field IN (constants)" for the given field name.
+// If yes, it returns the list of constants; otherwise, it returns nil.
+func (t *Term) InConstants(fieldName string) []Constant {
+	if t.op != OpIn || len(t.values) == 0 || !t.left.IsFieldName() || t.left.AsFieldName() != fieldName {
+		return nil
+	}
+	return t.values
+}
+
 // EquatesWithField checks if this term is "field = field" for the given field name.
 // If yes, it returns the name of the field on the other side; otherwise, it returns nil.
 func (t *Term) EquatesWithField(fldName string) *string {
+	if t.op != OpEquals {
+		return nil
+	}
 	if t.left.IsFieldName() && t.left.AsFieldName() == fldName && t.right.IsFieldName() {
 		field := t.right.AsFieldName()
 		return &field
@@ -72,11 +495,67 @@ func (t *Term) EquatesWithField(fldName string) *string {
 	}
 }
 
+// Reduction factors assumed for comparisons that don't pick out single values.
+const (
+	// rangeReductionFactor assumes a range comparison keeps about a third of the records
+	rangeReductionFactor = 3
+	// likeReductionFactor assumes a LIKE pattern with wildcards keeps about a fifth of the records
+	likeReductionFactor = 5
+)
+
 // ReductionFactor estimates the reduction factor for this term.
 // For "field = constant", it returns the number of distinct values for the field.
 // For "field = field", it returns the maximum of the two fields' distinct values.
+// For "field IN (constants)", it divides the field's distinct values by the number of constants.
+// For "<>" and NOT it returns 1, since nearly every record differs from a single value, and
+// a negated condition is assumed to keep most records.
+// Range comparisons and LIKE patterns with wildcards are assumed to keep a fixed share of
+// the records, but never fewer than an equality would; a LIKE pattern without wildcards is
+// an equality.
 // This represents an estimate of how many records will remain after applying the filter.
 func (t *Term) ReductionFactor(plan interface{ DistinctValues(string) (int, error) }) (int, error) {
+	switch t.op {
+	case OpIn:
+		if !t.left.IsFieldName() || len(t.values) == 0 {
+			return 1, nil
+		}
+		distinct, err := plan.DistinctValues(t.left.AsFieldName())
+		if err != nil {
+			return 0, err
+		}
+		return max(distinct/len(t.values), 1), nil
+	case OpNotEquals, OpNot:
+		return 1, nil
+	case OpLessThan, OpLessThanOrEqual, OpGreaterThan, OpGreaterThanOrEqual:
+		return t.cappedReductionFactor(plan, rangeReductionFactor)
+	case OpLike:
+		if t.right.IsConstant() {
+			pattern := t.right.AsConstant()
+			if pattern.IsString() && !hasLikeWildcard(pattern.AsString()) {
+				return t.equalityReductionFactor(plan)
+			}
+		}
+		return t.cappedReductionFactor(plan, likeReductionFactor)
+	default:
+		return t.equalityReductionFactor(plan)
+	}
+}
+
+// cappedReductionFactor returns the given factor for a term on a field, limited to the
+// reduction factor the term would have as an equality.
+func (t *Term) cappedReductionFactor(plan interface{ DistinctValues(string) (int, error) }, factor int) (int, error) {
+	if !t.left.IsFieldName() && !t.right.IsFieldName() {
+		return 1, nil
+	}
+	equality, err := t.equalityReductionFactor(plan)
+	if err != nil {
+		return 0, err
+	}
+	return max(min(equality, factor), 1), nil
+}
+
+// equalityReductionFactor estimates the reduction factor of the term as if it were an equality.
+func (t *Term) equalityReductionFactor(plan interface{ DistinctValues(string) (int, error) }) (int, error) {
 	var lhsName, rhsName string
 
 	if t.left.IsFieldName() {
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
 )
 
 func TestTermBasic(t *testing.T) {
@@ -97,3 +98,276 @@ func TestTermEquatesWithField(t *testing.T) {
 	result4 := term2.EquatesWithField("age")
 	assert.Nil(t, result4)
 }
+
+func TestTermComparisonOperators(t *testing.T) {
+	intExpr := func(v int) Expression { return *NewConstantExpression(*NewIntConstant(v)) }
+	strExpr := func(v string) Expression { return *NewConstantExpression(*NewStringConstant(v)) }
+
+	tests := []struct {
+		left     Expression
+		op       Operator
+		right    Expression
+		str      string
+		expected bool
+	}{
+		{intExpr(10), OpEquals, intExpr(10), "10 = 10", true},
+		{intExpr(10), OpNotEquals, intExpr(10), "10 <> 10", false},
+		{intExpr(10), OpNotEquals, intExpr(20), "10 <> 20", true},
+		{intExpr(10), OpLessThan, intExpr(20), "10 < 20", true},
+		{intExpr(20), OpLessThan, intExpr(20), "20 < 20", false},
+		{intExpr(20), OpLessThanOrEqual, intExpr(20), "20 <= 20", true},
+		{intExpr(30), OpGreaterThan, intExpr(20), "30 > 20", true},
+		{intExpr(20), OpGreaterThan, intExpr(20), "20 > 20", false},
+		{intExpr(20), OpGreaterThanOrEqual, intExpr(20), "20 >= 20", true},
+		{intExpr(19), OpGreaterThanOrEqual, intExpr(20), "19 >= 20", false},
+		{strExpr("apple"), OpLessThan, strExpr("banana"), "'apple' < 'banana'", true},
+		{strExpr("banana"), OpGreaterThanOrEqual, strExpr("banana"), "'banana' >= 'banana'", true},
+		{strExpr("cherry"), OpLessThanOrEqual, strExpr("banana"), "'cherry' <= 'banana'", false},
+	}
+
+	for _, tt := range tests {
+		term := NewComparisonTerm(tt.left, tt.op, tt.right)
+		assert.Equal(t, tt.str, term.String())
+		assert.Equal(t, tt.op, term.Operator())
+		ok, err := term.IsSatisfied(nil)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, ok, tt.str)
+	}
+
+	// Comparing an int with a string is a type error
+	term := NewComparisonTerm(intExpr(10), OpLessThan, strExpr("10"))
+	_, err := term.IsSatisfied(nil)
+	assert.ErrorIs(t, err, ErrTypeMismatch)
+	assert.EqualError(t, err, "type mismatch: cannot compare 10 with '10'")
+}
+
+func TestTermCheckTypes(t *testing.T) {
+	schema := record.NewSchema()
+	schema.AddIntField("age")
+	schema.AddBigIntField("total")
+	schema.AddStringField("name", 20)
+	field := func(name string) Expression { return *NewFieldNameExpression(name) }
+	intExpr := func(v int) Expression { return *NewConstantExpression(*NewIntConstant(v)) }
+	strExpr := func(v string) Expression { return *NewConstantExpression(*NewStringConstant(v)) }
+
+	valid := []*Term{
+		NewTerm(field("age"), intExpr(30)),
+		NewComparisonTerm(field("total"), OpGreaterThan, field("age")),
+		NewComparisonTerm(field("name"), OpLike, strExpr("A%")),
+		NewInTerm(field("name"), []Constant{*NewStringConstant("Alice"), *NewStringConstant("Bob")}),
+		// Fields the schema doesn't have are left to the schema that has them
+		NewTerm(field("city"), intExpr(1)),
+	}
+	for _, term := range valid {
+		assert.NoError(t, term.CheckTypes(schema), term.String())
+	}
+
+	tests := []struct {
+		term     *Term
+		expected string
+	}{
+		{NewTerm(field("age"), strExpr("abc")), "type mismatch: cannot compare age (int) with 'abc' (string)"},
+		{NewComparisonTerm(intExpr(5), OpLessThan, field("name")), "type mismatch: cannot compare 5 (int) with name (string)"},
+		{NewTerm(field("total"), field("name")), "type mismatch: cannot compare total (bigint) with name (string)"},
+		{NewComparisonTerm(field("age"), OpLike, field("age")), "type mismatch: LIKE needs strings, got age (int)"},
+		{NewInTerm(field("age"), []Constant{*NewIntConstant(1), *NewStringConstant("2")}), "type mismatch: cannot compare age (int) with '2'"},
+	}
+	for _, tt := range tests {
+		err := tt.term.CheckTypes(schema)
+		assert.ErrorIs(t, err, ErrTypeMismatch, tt.term.String())
+		assert.EqualError(t, err, tt.expected)
+	}
+}
+
+func TestTermInequalityIsNotEquality(t *testing.T) {
+	fieldExpr := NewFieldNameExpression("age")
+	constExpr := NewConstantExpression(*NewIntConstant(25))
+	otherField := NewFieldNameExpression("years")
+
+	// Index selection and join planning rely on equality, so other operators must not match
+	term := NewComparisonTerm(*fieldExpr, OpGreaterThan, *constExpr)
+	assert.Nil(t, term.EquatesWithConstant("age"))
+
+	term2 := NewComparisonTerm(*fieldExpr, OpLessThanOrEqual, *otherField)
+	assert.Nil(t, term2.EquatesWithField("age"))
+}
+
+func TestTermIn(t *testing.T) {
+	fieldExpr := NewFieldNameExpression("status")
+	values := []Constant{
+		*NewStringConstant("active"),
+		*NewStringConstant("pending"),
+		*NewStringConstant("active"),
+	}
+
+	// Duplicates are removed
+	term := NewInTerm(*fieldExpr, values)
+	assert.Equal(t, "status in ('active', 'pending')", term.String())
+	assert.Equal(t, OpIn, term.Operator())
+	require.Len(t, term.InConstants("status"), 2)
+	assert.Nil(t, term.InConstants("other"))
+
+	// An IN list is not an equality
+	assert.Nil(t, term.EquatesWithConstant("status"))
+
+	// Evaluation against constants
+	intTerm := NewInTerm(*NewConstantExpression(*NewIntConstant(2)), []Constant{*NewIntConstant(1), *NewIntConstant(2)})
+	ok, err := intTerm.IsSatisfied(nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	intTerm = NewInTerm(*NewConstantExpression(*NewIntConstant(3)), []Constant{*NewIntConstant(1), *NewIntConstant(2)})
+	ok, err = intTerm.IsSatisfied(nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Mixed types never match
+	mixedTerm := NewInTerm(*NewConstantExpression(*NewIntConstant(1)), []Constant{*NewStringConstant("1")})
+	ok, err = mixedTerm.IsSatisfied(nil)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// distinctValues is a plan stub giving the number of distinct values of each field
+type distinctValues map[string]int
+
+func (d distinctValues) DistinctValues(fldname string) (int, error) {
+	return d[fldname], nil
+}
+
+func TestTermReductionFactor(t *testing.T) {
+	plan := distinctValues{"id": 100, "name": 90, "flag": 2}
+	field := func(name string) Expression { return *NewFieldNameExpression(name) }
+	intConst := func(v int) Expression { return *NewConstantExpression(*NewIntConstant(v)) }
+	strConst := func(v string) Expression { return *NewConstantExpression(*NewStringConstant(v)) }
+
+	tests := []struct {
+		name     string
+		term     *Term
+		expected int
+	}{
+		{"Equals", NewTerm(field("id"), intConst(5)), 100},
+		{"EqualsField", NewTerm(field("id"), field("name")), 100},
+		{"NotEquals", NewComparisonTerm(field("id"), OpNotEquals, intConst(5)), 1},
+		{"GreaterThan", NewComparisonTerm(field("id"), OpGreaterThan, intConst(5)), rangeReductionFactor},
+		{"LessThanOrEqual", NewComparisonTerm(intConst(5), OpLessThanOrEqual, field("id")), rangeReductionFactor},
+		{"RangeOnFewValues", NewComparisonTerm(field("flag"), OpLessThan, intConst(1)), 2},
+		{"RangeOnConstants", NewComparisonTerm(intConst(1), OpLessThan, intConst(2)), 1},
+		{"Like", NewComparisonTerm(field("name"), OpLike, strConst("A%")), likeReductionFactor},
+		{"LikeWithoutWildcards", NewComparisonTerm(field("name"), OpLike, strConst("Alice")), 90},
+		{"LikeEscapedWildcard", NewComparisonTerm(field("name"), OpLike, strConst(`100\%`)), 90},
+		{"In", NewInTerm(field("id"), []Constant{*NewIntConstant(1), *NewIntConstant(2)}), 50},
+		{"Not", NewNotTerm(NewPredicate(*NewTerm(field("id"), intConst(5)))), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factor, err := tt.term.ReductionFactor(plan)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, factor)
+		})
+	}
+}
+
+func TestTermWithFieldValues(t *testing.T) {
+	term := NewComparisonTerm(
+		*NewFieldNameExpression("student_id"),
+		OpEquals,
+		*NewBinaryExpression(NewFieldNameExpression("s.id"), OpAdd, NewConstantExpression(*NewIntConstant(1))),
+	)
+	bound := term.WithFieldValues(map[string]Constant{"s.id": *NewIntConstant(4)})
+	assert.Equal(t, "student_id = 4 + 1", bound.String())
+	assert.Equal(t, []string{"student_id"}, bound.FieldNames())
+	// The original term is unchanged
+	assert.Equal(t, "student_id = s.id + 1", term.String())
+}
+
+// stringQuery is a query given by its text
+type stringQuery string
+
+func (q stringQuery) String() string {
+	return string(q)
+}
+
+func TestTermExists(t *testing.T) {
+	subquery := NewSubquery(stringQuery("SELECT 1 FROM enrollments WHERE student_id = id"))
+	exists := NewExistsTerm(subquery, false)
+	notExists := NewExistsTerm(subquery, true)
+	assert.Equal(t, "exists (SELECT 1 FROM enrollments WHERE student_id = id)", exists.String())
+	assert.Equal(t, "not exists (SELECT 1 FROM enrollments WHERE student_id = id)", notExists.String())
+
+	// A subquery the planner hasn't bound can't run
+	_, err := exists.IsSatisfied(nil)
+	assert.ErrorContains(t, err, "only supported in the WHERE clause of a query")
+
+	subquery.Bind([]string{"id"}, func(outer scan.Scan) (bool, error) {
+		id, err := outer.GetInt("id")
+		return id%2 == 0, err
+	})
+	schema := record.NewSchema()
+	schema.AddIntField("id")
+	assert.True(t, exists.AppliesTo(schema))
+	assert.False(t, exists.AppliesTo(record.NewSchema()))
+	assert.Equal(t, []string{"id"}, exists.FieldNames())
+
+	s := NewConstantScan([]string{"id"}, []Constant{*NewIntConstant(2)})
+	require.NoError(t, s.BeforeFirst())
+	hasNext, err := s.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	satisfied, err := exists.IsSatisfied(s)
+	require.NoError(t, err)
+	assert.True(t, satisfied)
+	satisfied, err = notExists.IsSatisfied(s)
+	require.NoError(t, err)
+	assert.False(t, satisfied)
+}
+
+func TestTermNot(t *testing.T) {
+	age := *NewFieldNameExpression("age")
+	equals := NewPredicate(*NewTerm(age, *NewConstantExpression(*NewIntConstant(25))))
+	notEquals := NewNotTerm(equals)
+	notIn := NewNotTerm(NewPredicate(*NewInTerm(age, []Constant{*NewIntConstant(25), *NewIntConstant(30)})))
+	assert.Equal(t, "not (age = 25)", notEquals.String())
+	assert.Equal(t, OpNot, notEquals.Operator())
+	assert.Same(t, equals, notEquals.Negated())
+
+	// The negation is satisfied exactly where the negated predicate isn't
+	for _, tc := range []struct {
+		age              int
+		notEquals, notIn bool
+	}{
+		{25, false, false},
+		{30, true, false},
+		{40, true, true},
+	} {
+		s := NewConstantScan([]string{"age"}, []Constant{*NewIntConstant(tc.age)})
+		_, err := s.Next()
+		require.NoError(t, err)
+		satisfied, err := notEquals.IsSatisfied(s)
+		require.NoError(t, err)
+		assert.Equal(t, tc.notEquals, satisfied, "age %d", tc.age)
+		satisfied, err = notIn.IsSatisfied(s)
+		require.NoError(t, err)
+		assert.Equal(t, tc.notIn, satisfied, "age %d", tc.age)
+	}
+
+	// A negated equality isn't one, so no index is searched with it
+	assert.Nil(t, notEquals.EquatesWithConstant("age"))
+	assert.Nil(t, notIn.InConstants("age"))
+
+	schema := record.NewSchema()
+	schema.AddIntField("age")
+	assert.True(t, notEquals.AppliesTo(schema))
+	assert.False(t, notEquals.AppliesTo(record.NewSchema()))
+	assert.Equal(t, []string{"age"}, notEquals.FieldNames())
+
+	// Types and field values reach the negated terms
+	mismatch := NewNotTerm(NewPredicate(*NewTerm(age, *NewConstantExpression(*NewStringConstant("x")))))
+	assert.ErrorIs(t, mismatch.CheckTypes(schema), ErrTypeMismatch)
+	bound := notEquals.WithFieldValues(map[string]Constant{"age": *NewIntConstant(25)})
+	assert.Equal(t, "not (25 = 25)", bound.String())
+	assert.Equal(t, "not (age = 25)", notEquals.String())
+	satisfied, err := bound.IsSatisfied(nil)
+	require.NoError(t, err)
+	assert.False(t, satisfied)
+}
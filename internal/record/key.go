@@ -0,0 +1,88 @@
+package record
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The key encoding of a value orders like the value: comparing the encodings of two values
+// byte by byte, as bytes.Compare does, orders them by value, with numbers before strings.
+// The records of hash and B-tree indexes hold the key encoding of their values, so they are
+// compared the same way whatever the type of the indexed field.
+//
+// Key format: [tag(1)] [value]
+// The tag is 1 for a number and 2 for a string. A number is 8 bytes, big-endian with the
+// sign bit flipped so that negative numbers come before the others; an int and a bigint of
+// the same value encode alike. A string is its bytes. No value encodes as no bytes.
+const (
+	keyNumberTag = 1
+	keyStringTag = 2
+	keyNumberLen = 9
+)
+
+// EncodeKey returns the key encoding of a value of a field: an int, an int64 or a string.
+// nil encodes as no bytes, and a value of any other type is an error.
+func EncodeKey(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case nil:
+		return []byte{}, nil
+	case int:
+		return EncodeNumberKey(int64(v)), nil
+	case int64:
+		return EncodeNumberKey(v), nil
+	case string:
+		return EncodeStringKey(v), nil
+	}
+	return nil, fmt.Errorf("no key encoding for a value of type %T", val)
+}
+
+// EncodeNumberKey returns the key encoding of the value of an int or a bigint field
+func EncodeNumberKey(v int64) []byte {
+	key := make([]byte, keyNumberLen)
+	key[0] = keyNumberTag
+	binary.BigEndian.PutUint64(key[1:], uint64(v)^(1<<63))
+	return key
+}
+
+// EncodeStringKey returns the key encoding of the value of a string field
+func EncodeStringKey(v string) []byte {
+	key := make([]byte, 1+len(v))
+	key[0] = keyStringTag
+	copy(key[1:], v)
+	return key
+}
+
+// KeyLength returns the length of the longest key encoding of a value of a field of the given
+// type and declared length
+func KeyLength(fieldType string, length int) int {
+	if fieldType == "string" {
+		return 1 + length
+	}
+	return keyNumberLen
+}
+
+// DecodeKey returns the value of a field of the given type whose key encoding is key: an int
+// for an int field, an int64 for a bigint field and a string for a string field.
+func DecodeKey(fieldType string, key []byte) (any, error) {
+	switch fieldType {
+	case "int", "bigint":
+		if len(key) != keyNumberLen || key[0] != keyNumberTag {
+			return nil, fmt.Errorf("key of %d bytes isn't the key of a number", len(key))
+		}
+		v := int64(binary.BigEndian.Uint64(key[1:]) ^ (1 << 63))
+		if fieldType == "bigint" {
+			return v, nil
+		}
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return nil, fmt.Errorf("key of %d is out of the range of an int field", v)
+		}
+		return int(v), nil
+	case "string":
+		if len(key) == 0 || key[0] != keyStringTag {
+			return nil, fmt.Errorf("key of %d bytes isn't the key of a string", len(key))
+		}
+		return string(key[1:]), nil
+	}
+	return nil, fmt.Errorf("no key encoding for fields of type %s", fieldType)
+}
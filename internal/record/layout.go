@@ -1,34 +1,62 @@
 package record
 
+// MaxInlineStringLength is the longest declared length of a string field whose values are
+// kept in the slots of a layout that doesn't pack its strings. The values of a longer field
+// may not fit in a block, so they are kept in a chain of overflow blocks instead, and the
+// slot only refers to the chain.
+const MaxInlineStringLength = 300
+
 type Layout struct {
 	schema   *Schema
 	offsets  map[string]int
 	slotSize int
+	// packedStrings is set if string values are kept in a heap at the end of each block,
+	// taking up only their actual length, and the slots only hold their offsets
+	packedStrings bool
 }
 
-// NewLayoutFromSchema creates a new layout from a schema
+// NewLayoutFromSchema creates a new layout from a schema.
+// Each string field takes up room for its maximum length in every slot.
 func NewLayoutFromSchema(schema *Schema) *Layout {
+	return newLayout(schema, false)
+}
+
+// NewPackedLayoutFromSchema creates a layout for a schema whose string values are packed
+// into a heap at the end of each block, so that short values don't waste the room of the
+// maximum length. A schema without string fields gets the same layout as NewLayoutFromSchema.
+func NewPackedLayoutFromSchema(schema *Schema) *Layout {
+	layout := newLayout(schema, true)
+	if layout.slotSize == NewLayoutFromSchema(schema).slotSize {
+		return NewLayoutFromSchema(schema)
+	}
+	return layout
+}
+
+func newLayout(schema *Schema, packedStrings bool) *Layout {
 	offsets := make(map[string]int)
 	pos := 4 // 4 bytes for the empty/inuse flag
+	layout := &Layout{
+		schema:        schema,
+		offsets:       offsets,
+		packedStrings: packedStrings,
+	}
 	for _, field := range schema.fields {
 		offsets[field] = pos
-		pos += schema.fieldInfo[field].fieldLength
+		pos += layout.lengthInBytes(field)
 	}
-	slotSize := pos
+	layout.slotSize = pos
 
-	return &Layout{
-		schema:   schema,
-		offsets:  offsets,
-		slotSize: slotSize,
-	}
+	return layout
 }
 
-// NewLayout creates a new layout from a schema and offsets
+// NewLayout creates a new layout from a schema and offsets.
+// A slot size that only a packed layout of the schema has means that its strings are packed.
 func NewLayout(schema *Schema, offsets map[string]int, slotSize int) *Layout {
 	return &Layout{
-		schema:   schema,
-		offsets:  offsets,
-		slotSize: slotSize,
+		schema:        schema,
+		offsets:       offsets,
+		slotSize:      slotSize,
+		packedStrings: slotSize != NewLayoutFromSchema(schema).slotSize && slotSize == newLayout(schema, true).slotSize,
 	}
 }
 
@@ -45,6 +73,51 @@ func (l *Layout) GetSchema() *Schema {
 	return l.schema
 }
 
+// Equal reports whether the other layout has an equal schema and places every field
+// at the same offset of a slot of the same size.
+func (l *Layout) Equal(other *Layout) bool {
+	if !l.schema.Equal(other.schema) || l.slotSize != other.slotSize || l.packedStrings != other.packedStrings {
+		return false
+	}
+	for _, field := range l.schema.fields {
+		if l.offsets[field] != other.offsets[field] {
+			return false
+		}
+	}
+	return true
+}
+
+// PackedStrings reports whether string values are packed into a heap at the end of each block
+func (l *Layout) PackedStrings() bool {
+	return l.packedStrings
+}
+
+// SlotsPerBlock returns the number of slots of a record page of the layout in a block of the
+// given size, which for a packed layout is the most it can have, with no strings
+func (l *Layout) SlotsPerBlock(blockSize int) int {
+	if l.packedStrings {
+		return (blockSize - PackedHeaderSize) / l.slotSize
+	}
+	return (blockSize - RecordHeaderSize) / l.slotSize
+}
+
+// FitsBlock reports whether a record page of the layout in a block of the given size has
+// room for a record, with a packed layout one whose strings are as long as they can be
+func (l *Layout) FitsBlock(blockSize int) bool {
+	if l.packedStrings {
+		return PackedHeaderSize+l.slotSize+l.maxHeapSize() <= blockSize
+	}
+	return l.SlotsPerBlock(blockSize) > 0
+}
+
+// Overflows reports whether the values of the field are kept in overflow blocks rather than
+// in the slots, which is the case for a string field declared longer than MaxInlineStringLength
+// in a layout that doesn't pack its strings.
+func (l *Layout) Overflows(fieldName string) bool {
+	fieldInfo, ok := l.schema.fieldInfo[fieldName]
+	return ok && !l.packedStrings && fieldInfo.fieldType == "string" && fieldInfo.fieldLength > MaxInlineStringLength
+}
+
 func (l *Layout) lengthInBytes(fieldName string) int {
 	fieldInfo, ok := l.schema.fieldInfo[fieldName]
 	if !ok {
@@ -53,9 +126,18 @@ func (l *Layout) lengthInBytes(fieldName string) int {
 
 	if fieldInfo.fieldType == "int" {
 		return 4
+	} else if fieldInfo.fieldType == "bigint" {
+		return 8
 	} else if fieldInfo.fieldType == "string" {
-		// Assume string's length field tells max bytes for storage, plus 4 bytes prefix for VARCHAR length
-		// Adjust depending on your actual Page & encoding logic
+		if l.packedStrings {
+			// The slot holds the offset of the value in the block's heap
+			return 4
+		}
+		if l.Overflows(fieldName) {
+			// The slot holds the first block of the value's overflow chain and its length
+			return overflowRefSize
+		}
+		// Strings are stored with a 4 byte length prefix followed by up to fieldLength bytes
 		return 4 + fieldInfo.fieldLength
 	}
 	return 0
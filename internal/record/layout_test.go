@@ -19,8 +19,8 @@ func TestLayout(t *testing.T) {
 	assert.Equal(t, schema, layout.schema)
 
 	// Check slot size calculation
-	// 4 bytes (empty/inuse flag) + 4 bytes (id) + 20 bytes (name) = 28 bytes
-	expectedSlotSize := 4 + 4 + 20
+	// 4 bytes (empty/inuse flag) + 4 bytes (id) + 4 bytes (name length) + 20 bytes (name) = 32 bytes
+	expectedSlotSize := 4 + 4 + 4 + 20
 	assert.Equal(t, expectedSlotSize, layout.GetSlotSize())
 
 	// Check field offsets
@@ -29,4 +29,58 @@ func TestLayout(t *testing.T) {
 
 	// Check offset for non-existent field
 	assert.Equal(t, 0, layout.GetOffset("nonexistent"))
+
+	// A bigint takes 8 bytes
+	schema.AddBigIntField("balance")
+	layout = NewLayoutFromSchema(schema)
+	assert.Equal(t, "bigint", schema.Type("balance"))
+	assert.Equal(t, expectedSlotSize+8, layout.GetSlotSize())
+	assert.Equal(t, 32, layout.GetOffset("balance"))
+}
+
+// TestLayoutRemovedField tests that the layout of a schema with a field removed packs
+// the remaining fields into a smaller slot
+func TestLayoutRemovedField(t *testing.T) {
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 20)
+	schema.AddBigIntField("balance")
+	assert.Equal(t, 4+4+24+8, NewLayoutFromSchema(schema).GetSlotSize())
+
+	schema.RemoveField("name")
+	assert.Equal(t, []string{"id", "balance"}, schema.Fields())
+	assert.False(t, schema.HasField("name"))
+	layout := NewLayoutFromSchema(schema)
+	assert.Equal(t, 4+4+8, layout.GetSlotSize())
+	assert.Equal(t, 4, layout.GetOffset("id"))
+	assert.Equal(t, 8, layout.GetOffset("balance"))
+
+	// Removing a field the schema doesn't have changes nothing
+	schema.RemoveField("name")
+	assert.Equal(t, []string{"id", "balance"}, schema.Fields())
+
+	// Without its only string field, a packed layout has nothing left to pack
+	assert.False(t, NewPackedLayoutFromSchema(schema).PackedStrings())
+}
+
+func TestPackedLayout(t *testing.T) {
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 20)
+
+	// 4 bytes (empty/inuse flag) + 4 bytes (id) + 4 bytes (offset of name in the heap)
+	layout := NewPackedLayoutFromSchema(schema)
+	assert.True(t, layout.PackedStrings())
+	assert.Equal(t, 12, layout.GetSlotSize())
+	assert.Equal(t, 8, layout.GetOffset("name"))
+
+	// A layout read back from the catalog is packed if its slot size says so
+	offsets := map[string]int{"id": 4, "name": 8}
+	assert.True(t, NewLayout(schema, offsets, 12).PackedStrings())
+	assert.False(t, NewLayout(schema, offsets, 32).PackedStrings())
+
+	// Without strings there is nothing to pack
+	ints := NewSchema()
+	ints.AddIntField("id")
+	assert.False(t, NewPackedLayoutFromSchema(ints).PackedStrings())
 }
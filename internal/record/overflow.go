@@ -0,0 +1,194 @@
+package record
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// The values of a field that overflows (see Layout.Overflows) are kept in a file of their
+// own, named after the record file with an ".ovf" suffix, as chains of overflow blocks. The
+// slot holds the number of the chain's first block, 0 for a slot without a chain, and the
+// length of the value. Block 0 of the file is left empty, so that no chain starts there and
+// a zeroed slot holds the empty string.
+//
+// Overflow block format: [next(4)] [length(4)] [bytes]
+// next is the number of the chain's next block, or 0 for its last one, and length is the
+// number of the value's bytes the block holds.
+//
+// A chain belongs to its slot for good: setting a value writes over the blocks of the chain
+// the slot already has, appending blocks only if the value needs more, and the blocks the
+// value doesn't need are kept in the chain for the next one. Every write is logged, so a
+// rollback restores the old value.
+const (
+	overflowRefSize = 8
+
+	overflowNextOffset   = 0
+	overflowLengthOffset = 4
+	overflowDataOffset   = 8
+)
+
+// OverflowFileName returns the name of the file holding the overflow chains of the record file
+func OverflowFileName(fileName string) string {
+	return fileName + ".ovf"
+}
+
+// WriteOverflowString writes the value into a new chain of overflow blocks of the record file,
+// and returns the number of its first block, or 0 for the empty string, which needs none.
+func WriteOverflowString(tx *transaction.Transaction, fileName string, value string) (int, error) {
+	return writeOverflowChain(tx, OverflowFileName(fileName), 0, value)
+}
+
+// WriteOverflowRef writes a reference to the overflow chain holding a value of the given
+// length at the offset of the page, where a field that overflows starts.
+func WriteOverflowRef(page *file.Page, offset int, head int, length int) {
+	page.SetInt(offset, head)
+	page.SetInt(offset+4, length)
+}
+
+// getOverflowString reads the value of a field that overflows from its chain.
+func (rp *RecordPage) getOverflowString(slot int, fieldName string) (string, error) {
+	offset := rp.fieldOffset(slot, fieldName)
+	head, err := rp.transaction.GetInt(rp.block, offset)
+	if err != nil {
+		return "", err
+	}
+	length, err := rp.transaction.GetInt(rp.block, offset+4)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := OverflowFileName(rp.block.Filename())
+	var sb strings.Builder
+	for blockNum := head; sb.Len() < length; {
+		if blockNum == 0 {
+			return "", fmt.Errorf("overflow chain of field %s in slot %d of %s ends early", fieldName, slot, rp.block)
+		}
+		chunk, next, err := readOverflowBlock(rp.transaction, file.NewBlockID(fileName, blockNum))
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(chunk)
+		blockNum = next
+	}
+	return sb.String(), nil
+}
+
+// setOverflowString writes the value of a field that overflows into the slot's chain.
+func (rp *RecordPage) setOverflowString(slot int, fieldName string, value string) error {
+	offset := rp.fieldOffset(slot, fieldName)
+	head, err := rp.transaction.GetInt(rp.block, offset)
+	if err != nil {
+		return err
+	}
+	newHead, err := writeOverflowChain(rp.transaction, OverflowFileName(rp.block.Filename()), head, value)
+	if err != nil {
+		return err
+	}
+	if newHead != head {
+		err = rp.transaction.SetInt(rp.block, offset, newHead, true)
+		if err != nil {
+			return err
+		}
+	}
+	return rp.transaction.SetInt(rp.block, offset+4, len(value), true)
+}
+
+// writeOverflowChain writes the value into the chain of the overflow file starting at head,
+// or into a new one if head is 0, and returns the chain's first block.
+func writeOverflowChain(tx *transaction.Transaction, fileName string, head int, value string) (int, error) {
+	if head == 0 && len(value) > 0 {
+		var err error
+		head, err = appendOverflowBlock(tx, fileName)
+		if err != nil {
+			return 0, err
+		}
+	}
+	capacity := tx.BlockSize() - overflowDataOffset
+	blockNum := head
+	for pos := 0; pos < len(value); {
+		chunk := value[pos:min(pos+capacity, len(value))]
+		pos += len(chunk)
+		next, err := writeOverflowBlock(tx, file.NewBlockID(fileName, blockNum), chunk, pos < len(value))
+		if err != nil {
+			return 0, err
+		}
+		blockNum = next
+	}
+	return head, nil
+}
+
+// readOverflowBlock returns the part of a value the overflow block holds, and its next block.
+func readOverflowBlock(tx *transaction.Transaction, blk *file.BlockID) (string, int, error) {
+	_, err := tx.Pin(blk)
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Unpin(blk)
+	chunk, err := tx.GetString(blk, overflowLengthOffset)
+	if err != nil {
+		return "", 0, err
+	}
+	next, err := tx.GetInt(blk, overflowNextOffset)
+	if err != nil {
+		return "", 0, err
+	}
+	return chunk, next, nil
+}
+
+// writeOverflowBlock writes a part of a value into the overflow block and returns its next
+// block. If more of the value follows and the block is the last of its chain, a block is
+// appended to the chain.
+func writeOverflowBlock(tx *transaction.Transaction, blk *file.BlockID, chunk string, more bool) (int, error) {
+	_, err := tx.Pin(blk)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Unpin(blk)
+	// The bytes are logged as they are, in pieces that fit in a log record
+	err = tx.SetInt(blk, overflowLengthOffset, len(chunk), true)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.SetBytes(blk, overflowDataOffset, []byte(chunk), true)
+	if err != nil {
+		return 0, err
+	}
+	next, err := tx.GetInt(blk, overflowNextOffset)
+	if err != nil {
+		return 0, err
+	}
+	if more && next == 0 {
+		next, err = appendOverflowBlock(tx, blk.Filename())
+		if err != nil {
+			return 0, err
+		}
+		err = tx.SetInt(blk, overflowNextOffset, next, true)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return next, nil
+}
+
+// appendOverflowBlock appends an empty block to the overflow file and returns its number,
+// first appending block 0 if the file has none.
+func appendOverflowBlock(tx *transaction.Transaction, fileName string) (int, error) {
+	size, err := tx.Size(fileName)
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		_, err = tx.Append(fileName)
+		if err != nil {
+			return 0, err
+		}
+	}
+	blk, err := tx.Append(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return blk.Number(), nil
+}
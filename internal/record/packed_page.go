@@ -0,0 +1,356 @@
+package record
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/file"
+)
+
+// A record page of a packed layout starts with a header, followed by its slots. The string
+// values of its records are kept in a heap that grows down from the end of the block, each
+// as a 4 byte length followed by its bytes, and a string field of a slot holds the offset
+// of its value in the heap, or 0 for the empty string. An all-zero block is an empty page.
+//
+// Header format: [numSlots(4)] [heapStart(4)] [garbage(4)] [usedSlots(4)]
+// heapStart is where the heap begins, with 0 standing for the end of the block, garbage
+// counts the heap bytes no value uses any more, which compacting the heap reclaims, and
+// usedSlots counts the slots in use, so that a page without empty slots isn't searched.
+const (
+	// PackedHeaderSize is the size of the header of a record page of a packed layout
+	PackedHeaderSize = 16
+
+	packedNumSlotsOffset  = 0
+	packedHeapStartOffset = 4
+	packedGarbageOffset   = 8
+	packedUsedSlotsOffset = 12
+)
+
+// PackedRecordSize returns the room a record takes up in a block of a packed layout, given
+// its values in the order of the layout's schema: its slot plus the heap entries of its
+// non-empty strings.
+func PackedRecordSize(layout *Layout, values []any) int {
+	size := layout.GetSlotSize()
+	for _, value := range values {
+		if v, ok := value.(string); ok && v != "" {
+			size += 4 + len(v)
+		}
+	}
+	return size
+}
+
+// WritePackedRecords lays out the records in the page of an empty block of a packed layout,
+// one slot each, in order. The values of each record are given in the order of the layout's
+// schema, ints as int and strings as string, and must fit in the block together.
+func WritePackedRecords(layout *Layout, page *file.Page, records [][]any) {
+	fields := layout.schema.Fields()
+	heapStart := len(page.Bytes())
+	for slot, values := range records {
+		slotOffset := PackedHeaderSize + slot*layout.GetSlotSize()
+		page.SetInt(slotOffset, int(SlotStatusInUse))
+		for i, fieldName := range fields {
+			offset := slotOffset + layout.GetOffset(fieldName)
+			switch v := values[i].(type) {
+			case int:
+				if layout.schema.Type(fieldName) == "bigint" {
+					page.SetLong(offset, int64(v))
+				} else {
+					page.SetInt(offset, v)
+				}
+			case string:
+				if v == "" {
+					page.SetInt(offset, 0)
+					continue
+				}
+				heapStart -= 4 + len(v)
+				page.SetString(heapStart, v)
+				page.SetInt(offset, heapStart)
+			}
+		}
+	}
+	page.SetInt(packedNumSlotsOffset, len(records))
+	page.SetInt(packedHeapStartOffset, heapStart)
+	page.SetInt(packedGarbageOffset, 0)
+	page.SetInt(packedUsedSlotsOffset, len(records))
+}
+
+// formatPacked empties the page, leaving it without slots
+func (rp *RecordPage) formatPacked() error {
+	for _, offset := range []int{packedNumSlotsOffset, packedHeapStartOffset, packedGarbageOffset, packedUsedSlotsOffset} {
+		err := rp.transaction.SetInt(rp.block, offset, 0, true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertPackedSlot uses the next empty slot after the given one, or adds a new slot at the end,
+// as long as the block has room for the slot and the longest strings its record can hold.
+// It returns -1 if there isn't.
+func (rp *RecordPage) insertPackedSlot(slot int) (int, error) {
+	newSlot := -1
+	full, err := rp.full()
+	if err != nil {
+		return -1, err
+	}
+	if !full {
+		newSlot, err = rp.searchAfter(slot, SlotStatusEmpty)
+		if err != nil {
+			return -1, err
+		}
+	}
+	free, garbage, err := rp.heapRoom()
+	if err != nil {
+		return -1, err
+	}
+	needed := rp.layout.maxHeapSize()
+	if newSlot < 0 {
+		needed += rp.layout.GetSlotSize()
+	}
+	if free+garbage < needed {
+		return -1, nil
+	}
+
+	if newSlot < 0 {
+		if free < rp.layout.GetSlotSize() {
+			err = rp.compact()
+			if err != nil {
+				return -1, err
+			}
+		}
+		newSlot, err = rp.numSlots()
+		if err != nil {
+			return -1, err
+		}
+		err = rp.transaction.SetInt(rp.block, packedNumSlotsOffset, newSlot+1, true)
+		if err != nil {
+			return -1, err
+		}
+		// The room of the new slot may hold stale heap bytes, so clear its fields
+		for _, fieldName := range rp.layout.schema.Fields() {
+			err = rp.transaction.SetInt(rp.block, rp.fieldOffset(newSlot, fieldName), 0, true)
+			if err != nil {
+				return -1, err
+			}
+		}
+	}
+	err = rp.setSlotStatus(newSlot, SlotStatusInUse)
+	if err != nil {
+		return -1, err
+	}
+	err = rp.addUsedSlots(1)
+	if err != nil {
+		return -1, err
+	}
+	return newSlot, nil
+}
+
+// getPackedString reads a string through its offset in the heap
+func (rp *RecordPage) getPackedString(slot int, fieldName string) (string, error) {
+	ref, err := rp.transaction.GetInt(rp.block, rp.fieldOffset(slot, fieldName))
+	if err != nil {
+		return "", err
+	}
+	if ref == 0 {
+		return "", nil
+	}
+	return rp.transaction.GetString(rp.block, ref)
+}
+
+// setPackedString writes a string into the heap. A value no longer than the old one
+// overwrites it in place; a longer one gets a new heap entry, compacting the heap first
+// if that makes room for it.
+func (rp *RecordPage) setPackedString(slot int, fieldName string, value string) error {
+	if len(value) > rp.layout.schema.Length(fieldName) {
+		return fmt.Errorf("value for field %s is longer than %d", fieldName, rp.layout.schema.Length(fieldName))
+	}
+	refOffset := rp.fieldOffset(slot, fieldName)
+	ref, err := rp.transaction.GetInt(rp.block, refOffset)
+	if err != nil {
+		return err
+	}
+	if ref != 0 {
+		old, err := rp.transaction.GetString(rp.block, ref)
+		if err != nil {
+			return err
+		}
+		if value != "" && len(value) <= len(old) {
+			err = rp.transaction.SetString(rp.block, ref, value, true)
+			if err != nil {
+				return err
+			}
+			return rp.addGarbage(len(old) - len(value))
+		}
+		err = rp.transaction.SetInt(rp.block, refOffset, 0, true)
+		if err != nil {
+			return err
+		}
+		err = rp.addGarbage(4 + len(old))
+		if err != nil {
+			return err
+		}
+	}
+	if value == "" {
+		return nil
+	}
+
+	needed := 4 + len(value)
+	free, garbage, err := rp.heapRoom()
+	if err != nil {
+		return err
+	}
+	if free < needed {
+		if free+garbage < needed {
+			return fmt.Errorf("no room in block %d for the value of field %s", rp.block.Number(), fieldName)
+		}
+		err = rp.compact()
+		if err != nil {
+			return err
+		}
+	}
+
+	heapStart, err := rp.heapStart()
+	if err != nil {
+		return err
+	}
+	heapStart -= needed
+	entry := file.NewPage(needed)
+	entry.SetString(0, value)
+	err = rp.transaction.SetBytes(rp.block, heapStart, entry.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	err = rp.transaction.SetInt(rp.block, packedHeapStartOffset, heapStart, true)
+	if err != nil {
+		return err
+	}
+	return rp.transaction.SetInt(rp.block, refOffset, heapStart, true)
+}
+
+// releasePackedStrings turns the heap entries of a deleted slot's strings into garbage
+func (rp *RecordPage) releasePackedStrings(slot int) error {
+	for _, fieldName := range rp.layout.schema.Fields() {
+		if rp.layout.schema.Type(fieldName) != "string" {
+			continue
+		}
+		value, err := rp.getPackedString(slot, fieldName)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			continue
+		}
+		err = rp.transaction.SetInt(rp.block, rp.fieldOffset(slot, fieldName), 0, true)
+		if err != nil {
+			return err
+		}
+		err = rp.addGarbage(4 + len(value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compact rewrites the heap with the strings still in use next to each other at the end
+// of the block, reclaiming its garbage
+func (rp *RecordPage) compact() error {
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return err
+	}
+	type heapValue struct {
+		refOffset int
+		value     string
+	}
+	var values []heapValue
+	size := 0
+	for slot := 0; slot < numSlots; slot++ {
+		for _, fieldName := range rp.layout.schema.Fields() {
+			if rp.layout.schema.Type(fieldName) != "string" {
+				continue
+			}
+			value, err := rp.getPackedString(slot, fieldName)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				continue
+			}
+			values = append(values, heapValue{refOffset: rp.fieldOffset(slot, fieldName), value: value})
+			size += 4 + len(value)
+		}
+	}
+
+	heapStart := rp.transaction.BlockSize() - size
+	heap := file.NewPage(size)
+	pos := 0
+	for _, v := range values {
+		heap.SetString(pos, v.value)
+		err = rp.transaction.SetInt(rp.block, v.refOffset, heapStart+pos, true)
+		if err != nil {
+			return err
+		}
+		pos += 4 + len(v.value)
+	}
+	err = rp.transaction.SetBytes(rp.block, heapStart, heap.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	err = rp.transaction.SetInt(rp.block, packedHeapStartOffset, heapStart, true)
+	if err != nil {
+		return err
+	}
+	return rp.transaction.SetInt(rp.block, packedGarbageOffset, 0, true)
+}
+
+// heapStart returns where the heap begins
+func (rp *RecordPage) heapStart() (int, error) {
+	heapStart, err := rp.transaction.GetInt(rp.block, packedHeapStartOffset)
+	if err != nil {
+		return 0, err
+	}
+	if heapStart == 0 {
+		return rp.transaction.BlockSize(), nil
+	}
+	return heapStart, nil
+}
+
+// heapRoom returns the free bytes between the last slot and the heap, and the garbage bytes in the heap
+func (rp *RecordPage) heapRoom() (int, int, error) {
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return 0, 0, err
+	}
+	heapStart, err := rp.heapStart()
+	if err != nil {
+		return 0, 0, err
+	}
+	garbage, err := rp.transaction.GetInt(rp.block, packedGarbageOffset)
+	if err != nil {
+		return 0, 0, err
+	}
+	return heapStart - rp.slotOffset(numSlots), garbage, nil
+}
+
+func (rp *RecordPage) addGarbage(n int) error {
+	if n == 0 {
+		return nil
+	}
+	garbage, err := rp.transaction.GetInt(rp.block, packedGarbageOffset)
+	if err != nil {
+		return err
+	}
+	return rp.transaction.SetInt(rp.block, packedGarbageOffset, garbage+n, true)
+}
+
+// maxHeapSize returns the heap room the longest strings of a record take up
+func (l *Layout) maxHeapSize() int {
+	size := 0
+	for _, fieldName := range l.schema.Fields() {
+		if l.schema.Type(fieldName) == "string" {
+			size += 4 + l.schema.Length(fieldName)
+		}
+	}
+	return size
+}
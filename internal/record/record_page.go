@@ -1,6 +1,8 @@
 package record
 
 import (
+	"fmt"
+
 	"github.com/yashagw/cranedb/internal/file"
 	"github.com/yashagw/cranedb/internal/transaction"
 )
@@ -12,6 +14,45 @@ const (
 	SlotStatusInUse SlotStatus = 1
 )
 
+// String returns the status as it is shown in diagnostics
+func (s SlotStatus) String() string {
+	switch s {
+	case SlotStatusEmpty:
+		return "empty"
+	case SlotStatusInUse:
+		return "in use"
+	}
+	return fmt.Sprintf("unknown (%d)", int(s))
+}
+
+// SlotInfo describes a slot of a record page, for diagnostics.
+type SlotInfo struct {
+	Slot   int
+	Status SlotStatus
+	// Values holds the value of each field of the record in the slot: an int, an int64
+	// for a bigint field, or a string. It is nil for a slot that holds no record.
+	Values map[string]any
+}
+
+// A record page of an unpacked layout starts with a header, followed by as many slots as
+// fit in the rest of the block. The header counts the slots in use, so that an insert can
+// tell a full block from its header alone instead of searching its slots for an empty one.
+// An all-zero block is an empty page.
+//
+// Header format: [usedSlots(4)]
+const (
+	// RecordHeaderSize is the size of the header of a record page of an unpacked layout
+	RecordHeaderSize = 4
+
+	usedSlotsOffset = 0
+)
+
+// WriteRecordHeader writes the header of a record page of an unpacked layout into the page,
+// for a block whose slots are written directly, with the number of its slots in use.
+func WriteRecordHeader(page *file.Page, usedSlots int) {
+	page.SetInt(usedSlotsOffset, usedSlots)
+}
+
 type RecordPage struct {
 	transaction *transaction.Transaction
 	block       *file.BlockID
@@ -30,45 +71,113 @@ func NewRecordPage(transaction *transaction.Transaction, block *file.BlockID, la
 	return &RecordPage{
 		transaction: transaction,
 		block:       block,
-		layout:      NewLayoutFromSchema(layout.schema),
+		layout:      newLayout(layout.schema, layout.packedStrings),
 	}, nil
 }
 
 // GetInt retrieves the integer value stored in the specified slot and field.
-// Block Offset -> Where the slot starts (slot * layout.GetSlotSize()) + Where the field starts in the slot (layout.GetOffset(fieldName))
+// Block Offset -> Where the slot starts (slotOffset(slot)) + Where the field starts in the slot (layout.GetOffset(fieldName))
 func (rp *RecordPage) GetInt(slot int, fieldName string) (int, error) {
-	fieldOffset := rp.layout.GetOffset(fieldName)
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := fieldOffset + slotOffset
-	return rp.transaction.GetInt(rp.block, totalOffset)
+	return rp.transaction.GetInt(rp.block, rp.fieldOffset(slot, fieldName))
+}
+
+// GetLong retrieves the 8 byte integer value stored in the specified slot and field.
+func (rp *RecordPage) GetLong(slot int, fieldName string) (int64, error) {
+	return rp.transaction.GetLong(rp.block, rp.fieldOffset(slot, fieldName))
 }
 
-// GetString retrieves the string value stored in the specified slot and field.
+// GetString retrieves the string value stored in the specified slot and field, following
+// the field's overflow chain if its values overflow.
 func (rp *RecordPage) GetString(slot int, fieldName string) (string, error) {
-	fieldOffset := rp.layout.GetOffset(fieldName)
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := fieldOffset + slotOffset
-	return rp.transaction.GetString(rp.block, totalOffset)
+	if rp.layout.packedStrings {
+		return rp.getPackedString(slot, fieldName)
+	}
+	if rp.layout.Overflows(fieldName) {
+		return rp.getOverflowString(slot, fieldName)
+	}
+	return rp.transaction.GetString(rp.block, rp.fieldOffset(slot, fieldName))
 }
 
 // SetInt sets the integer value in the specified slot and field.
 func (rp *RecordPage) SetInt(slot int, fieldName string, value int) error {
-	fieldOffset := rp.layout.GetOffset(fieldName)
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := fieldOffset + slotOffset
-	return rp.transaction.SetInt(rp.block, totalOffset, value, true)
+	return rp.transaction.SetInt(rp.block, rp.fieldOffset(slot, fieldName), value, true)
+}
+
+// SetLong sets the 8 byte integer value in the specified slot and field.
+func (rp *RecordPage) SetLong(slot int, fieldName string, value int64) error {
+	return rp.transaction.SetLong(rp.block, rp.fieldOffset(slot, fieldName), value, true)
 }
 
-// SetString sets the string value in the specified slot and field.
+// SetString sets the string value in the specified slot and field, writing it into the
+// field's overflow chain if its values overflow.
 func (rp *RecordPage) SetString(slot int, fieldName string, value string) error {
-	fieldOffset := rp.layout.GetOffset(fieldName)
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := fieldOffset + slotOffset
-	return rp.transaction.SetString(rp.block, totalOffset, value, true)
+	if rp.layout.packedStrings {
+		return rp.setPackedString(slot, fieldName, value)
+	}
+	if rp.layout.Overflows(fieldName) {
+		return rp.setOverflowString(slot, fieldName, value)
+	}
+	return rp.transaction.SetString(rp.block, rp.fieldOffset(slot, fieldName), value, true)
+}
+
+// GetValue retrieves the value stored in the specified slot and field, read by the field's
+// type: an int for an int field, an int64 for a bigint field, or a string.
+func (rp *RecordPage) GetValue(slot int, fieldName string) (any, error) {
+	switch rp.layout.schema.Type(fieldName) {
+	case "int":
+		return rp.GetInt(slot, fieldName)
+	case "bigint":
+		return rp.GetLong(slot, fieldName)
+	default:
+		return rp.GetString(slot, fieldName)
+	}
 }
 
+// SetValue sets the value in the specified slot and field, written by the field's type. An int
+// field takes an int, a bigint field an int or an int64, and a string field a string.
+func (rp *RecordPage) SetValue(slot int, fieldName string, value any) error {
+	fieldType := rp.layout.schema.Type(fieldName)
+	switch v := value.(type) {
+	case int:
+		if fieldType == "int" {
+			return rp.SetInt(slot, fieldName, v)
+		}
+		if fieldType == "bigint" {
+			return rp.SetLong(slot, fieldName, int64(v))
+		}
+	case int64:
+		if fieldType == "bigint" {
+			return rp.SetLong(slot, fieldName, v)
+		}
+	case string:
+		if fieldType == "string" {
+			return rp.SetString(slot, fieldName, v)
+		}
+	}
+	return fmt.Errorf("field %s of type %s can't hold the value %v", fieldName, fieldType, value)
+}
+
+// Delete marks the slot empty. With a packed layout, the room of its strings is reclaimed
+// the next time the block's heap is compacted.
 func (rp *RecordPage) Delete(slot int) error {
-	return rp.setSlotStatus(slot, SlotStatusEmpty)
+	status, err := rp.getSlotStatus(slot)
+	if err != nil {
+		return err
+	}
+	err = rp.setSlotStatus(slot, SlotStatusEmpty)
+	if err != nil {
+		return err
+	}
+	if status == SlotStatusInUse {
+		err = rp.addUsedSlots(-1)
+		if err != nil {
+			return err
+		}
+	}
+	if rp.layout.packedStrings {
+		return rp.releasePackedStrings(slot)
+	}
+	return nil
 }
 
 // NextUsedSlot returns the index of the next slot after the given slot that is marked as USED.
@@ -78,8 +187,16 @@ func (rp *RecordPage) NextUsedSlot(slot int) (int, error) {
 }
 
 // InsertSlot finds the next EMPTY slot after the given slot index, marks it as USED, and returns its index.
-// If no empty slot is found, it returns -1.
+// If no empty slot is found, it returns -1. With a packed layout, a slot is only used if the block
+// has room for the longest strings of a record, and a new slot is added when there is room for it.
 func (rp *RecordPage) InsertSlot(slot int) (int, error) {
+	if rp.layout.packedStrings {
+		return rp.insertPackedSlot(slot)
+	}
+	full, err := rp.full()
+	if err != nil || full {
+		return -1, err
+	}
 	newSlot, err := rp.searchAfter(slot, SlotStatusEmpty)
 	if err != nil {
 		return -1, err
@@ -89,34 +206,114 @@ func (rp *RecordPage) InsertSlot(slot int) (int, error) {
 		if err != nil {
 			return -1, err
 		}
+		err = rp.addUsedSlots(1)
+		if err != nil {
+			return -1, err
+		}
 	}
 	return newSlot, nil
 }
 
+// InsertAfter is InsertSlot for a slot after every slot in use as well as the given one, so the
+// new record comes after all the records of the page and no room freed by a delete is reused.
+// If there is no such slot, it returns -1.
+func (rp *RecordPage) InsertAfter(slot int) (int, error) {
+	if !rp.layout.packedStrings {
+		full, err := rp.full()
+		if err != nil || full {
+			return -1, err
+		}
+	}
+	lastUsed, err := rp.lastUsedSlot()
+	if err != nil {
+		return -1, err
+	}
+	return rp.InsertSlot(max(slot, lastUsed))
+}
+
+// lastUsedSlot returns the index of the last slot that is marked as USED, or -1 if there is none.
+func (rp *RecordPage) lastUsedSlot() (int, error) {
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return -1, err
+	}
+	for slot := numSlots - 1; slot >= 0; slot-- {
+		status, err := rp.getSlotStatus(slot)
+		if err != nil {
+			return -1, err
+		}
+		if status == SlotStatusInUse {
+			return slot, nil
+		}
+	}
+	return -1, nil
+}
+
+// Slots returns every slot of the page in order, with its status and the values of the record
+// it holds, without changing the page. Reading takes a shared lock on the block.
+func (rp *RecordPage) Slots() ([]SlotInfo, error) {
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return nil, err
+	}
+	schema := rp.layout.schema
+	slots := make([]SlotInfo, 0, numSlots)
+	for slot := 0; slot < numSlots; slot++ {
+		status, err := rp.getSlotStatus(slot)
+		if err != nil {
+			return nil, err
+		}
+		info := SlotInfo{Slot: slot, Status: status}
+		if status == SlotStatusInUse {
+			info.Values = map[string]any{}
+			for _, fieldName := range schema.Fields() {
+				val, err := rp.GetValue(slot, fieldName)
+				if err != nil {
+					return nil, err
+				}
+				info.Values[fieldName] = val
+			}
+		}
+		slots = append(slots, info)
+	}
+	return slots, nil
+}
+
 // searchAfter finds and returns the first slot after the given slot index that matches the provided status.
 // If no matching slot is found, it returns -1.
 func (rp *RecordPage) searchAfter(slot int, status SlotStatus) (int, error) {
-	slot++
-	for rp.isValidSlot(slot) {
-		slotOffset := slot * rp.layout.GetSlotSize()
-		currStatusInt, err := rp.transaction.GetInt(rp.block, slotOffset)
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return -1, err
+	}
+	for slot++; slot < numSlots; slot++ {
+		currStatus, err := rp.getSlotStatus(slot)
 		if err != nil {
 			return -1, err
 		}
-		currStatus := SlotStatus(currStatusInt)
 		if currStatus == status {
 			return slot, nil
 		}
-		slot++
 	}
 	return -1, nil
 }
 
 // Format initializes all slots in the record page by setting them to empty status
 // and initializing all fields with default values (0 for integers, empty string for strings).
+// With a packed layout, the page is left without any slots and with an empty heap.
 func (rp *RecordPage) Format() error {
-	slot := 0
-	for rp.isValidSlot(slot) {
+	if rp.layout.packedStrings {
+		return rp.formatPacked()
+	}
+	err := rp.transaction.SetInt(rp.block, usedSlotsOffset, 0, true)
+	if err != nil {
+		return err
+	}
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return err
+	}
+	for slot := 0; slot < numSlots; slot++ {
 		err := rp.setSlotStatus(slot, SlotStatusEmpty)
 		if err != nil {
 			return err
@@ -132,6 +329,11 @@ func (rp *RecordPage) Format() error {
 				if err != nil {
 					return err
 				}
+			} else if fieldInfo.fieldType == "bigint" {
+				err = rp.SetLong(slot, fieldName, 0)
+				if err != nil {
+					return err
+				}
 			} else if fieldInfo.fieldType == "string" {
 				err = rp.SetString(slot, fieldName, "")
 				if err != nil {
@@ -139,20 +341,69 @@ func (rp *RecordPage) Format() error {
 				}
 			}
 		}
-		slot++
 	}
 	return nil
 }
 
-func (rp *RecordPage) isValidSlot(slot int) bool {
-	slotOffset := (slot + 1) * rp.layout.GetSlotSize()
-	return slotOffset <= rp.transaction.BlockSize()
+// numSlots returns the number of slots of the page. With a packed layout, the page has as
+// many slots as were added to it; otherwise it has as many as fit in the block.
+func (rp *RecordPage) numSlots() (int, error) {
+	if rp.layout.packedStrings {
+		return rp.transaction.GetInt(rp.block, packedNumSlotsOffset)
+	}
+	return rp.layout.SlotsPerBlock(rp.transaction.BlockSize()), nil
+}
+
+// usedSlots returns the number of slots of the page in use, as counted in its header
+func (rp *RecordPage) usedSlots() (int, error) {
+	if rp.layout.packedStrings {
+		return rp.transaction.GetInt(rp.block, packedUsedSlotsOffset)
+	}
+	return rp.transaction.GetInt(rp.block, usedSlotsOffset)
+}
+
+// addUsedSlots adds delta to the number of slots in use in the page's header
+func (rp *RecordPage) addUsedSlots(delta int) error {
+	used, err := rp.usedSlots()
+	if err != nil {
+		return err
+	}
+	offset := usedSlotsOffset
+	if rp.layout.packedStrings {
+		offset = packedUsedSlotsOffset
+	}
+	return rp.transaction.SetInt(rp.block, offset, used+delta, true)
+}
+
+// full reports whether every slot of the page is in use. With a packed layout, a page that
+// is full may still have room for a new slot.
+func (rp *RecordPage) full() (bool, error) {
+	used, err := rp.usedSlots()
+	if err != nil {
+		return false, err
+	}
+	numSlots, err := rp.numSlots()
+	if err != nil {
+		return false, err
+	}
+	return used >= numSlots, nil
+}
+
+// slotOffset returns where the slot starts in the block
+func (rp *RecordPage) slotOffset(slot int) int {
+	if rp.layout.packedStrings {
+		return PackedHeaderSize + slot*rp.layout.GetSlotSize()
+	}
+	return RecordHeaderSize + slot*rp.layout.GetSlotSize()
+}
+
+// fieldOffset returns where the field of the slot starts in the block
+func (rp *RecordPage) fieldOffset(slot int, fieldName string) int {
+	return rp.slotOffset(slot) + rp.layout.GetOffset(fieldName)
 }
 
 func (rp *RecordPage) getSlotStatus(slot int) (SlotStatus, error) {
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := slotOffset
-	statusInt, err := rp.transaction.GetInt(rp.block, totalOffset)
+	statusInt, err := rp.transaction.GetInt(rp.block, rp.slotOffset(slot))
 	if err != nil {
 		return 0, err
 	}
@@ -160,9 +411,7 @@ func (rp *RecordPage) getSlotStatus(slot int) (SlotStatus, error) {
 }
 
 func (rp *RecordPage) setSlotStatus(slot int, status SlotStatus) error {
-	slotOffset := slot * rp.layout.GetSlotSize()
-	totalOffset := slotOffset
-	return rp.transaction.SetInt(rp.block, totalOffset, int(status), true)
+	return rp.transaction.SetInt(rp.block, rp.slotOffset(slot), int(status), true)
 }
 
 // Block returns the BlockID associated with this record page.
@@ -1,6 +1,8 @@
 package record
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -115,3 +117,514 @@ func TestRecordPage_Format(t *testing.T) {
 	// Cleanup
 	tx.Commit()
 }
+
+func TestRecordPage_FullLengthStringKeepsNextField(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+
+	schema := NewSchema()
+	schema.AddStringField("name", 8)
+	schema.AddIntField("id")
+	layout := NewLayoutFromSchema(schema)
+
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+
+	slot, err := recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.SetString(slot, "name", "12345678"))
+	require.NoError(t, recordPage.SetInt(slot, "id", 7))
+
+	// Writing the int right after the string must not clobber the string's last bytes
+	name, err := recordPage.GetString(slot, "name")
+	require.NoError(t, err)
+	assert.Equal(t, "12345678", name)
+	id, err := recordPage.GetInt(slot, "id")
+	require.NoError(t, err)
+	assert.Equal(t, 7, id)
+
+	require.NoError(t, tx.Commit())
+}
+
+func TestRecordPage_InsertAfter(t *testing.T) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+
+	schema := NewSchema()
+	schema.AddIntField("id")
+	layout := NewLayoutFromSchema(schema)
+
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+
+	for i := 0; i < 3; i++ {
+		slot, err := recordPage.InsertAfter(-1)
+		require.NoError(t, err)
+		assert.Equal(t, i, slot)
+	}
+	require.NoError(t, recordPage.Delete(0))
+	require.NoError(t, recordPage.Delete(2))
+
+	// InsertAfter goes after the last record, even past a freed slot at the end
+	slot, err := recordPage.InsertAfter(-1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, slot)
+	slot, err = recordPage.InsertAfter(-1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, slot)
+
+	// InsertSlot reuses the first free slot
+	slot, err = recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, slot)
+
+	// Once the last slot is used, there is no slot after it
+	numSlots := (400 - RecordHeaderSize) / layout.GetSlotSize()
+	for i := 4; i < numSlots; i++ {
+		_, err := recordPage.InsertAfter(-1)
+		require.NoError(t, err)
+	}
+	require.NoError(t, recordPage.Delete(1))
+	slot, err = recordPage.InsertAfter(-1)
+	require.NoError(t, err)
+	assert.Equal(t, -1, slot)
+
+	require.NoError(t, tx.Commit())
+}
+
+func TestRecordPage_UsedSlots(t *testing.T) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+
+	schema := NewSchema()
+	schema.AddIntField("id")
+	layout := NewLayoutFromSchema(schema)
+
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+
+	numSlots := (400 - RecordHeaderSize) / layout.GetSlotSize()
+	for i := 0; i < numSlots; i++ {
+		_, err := recordPage.InsertSlot(-1)
+		require.NoError(t, err)
+	}
+	used, err := recordPage.usedSlots()
+	require.NoError(t, err)
+	assert.Equal(t, numSlots, used)
+	slot, err := recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, -1, slot)
+
+	// Deleting a slot twice frees it once
+	require.NoError(t, recordPage.Delete(5))
+	require.NoError(t, recordPage.Delete(5))
+	used, err = recordPage.usedSlots()
+	require.NoError(t, err)
+	assert.Equal(t, numSlots-1, used)
+	require.NoError(t, tx.Commit())
+
+	// The count is restored with the slots when a transaction rolls back
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	recordPage, err = NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	slot, err = recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, slot)
+	require.NoError(t, recordPage.Delete(0))
+	require.NoError(t, tx.Rollback())
+
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	recordPage, err = NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	used, err = recordPage.usedSlots()
+	require.NoError(t, err)
+	assert.Equal(t, numSlots-1, used)
+	slot, err = recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, 5, slot)
+	require.NoError(t, tx.Commit())
+}
+
+// newPackedTestPage formats a block with a packed layout and returns the transaction that
+// formatted it, its record page, and a function that starts further transactions
+func newPackedTestPage(t *testing.T) (*transaction.Transaction, *RecordPage, func() *transaction.Transaction) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	newTx := func() *transaction.Transaction {
+		return transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	}
+	tx := newTx()
+
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 100)
+	schema.AddStringField("note", 20)
+	layout := NewPackedLayoutFromSchema(schema)
+	require.True(t, layout.PackedStrings())
+
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+	return tx, recordPage, newTx
+}
+
+func TestRecordPage_PackedStrings(t *testing.T) {
+	tx, recordPage, _ := newPackedTestPage(t)
+
+	// With the fixed layout a slot takes 136 bytes, so only two records fit in the block
+	names := []string{"", "a", "Bob", strings.Repeat("x", 50), strings.Repeat("y", 100)}
+	var slots []int
+	for i, name := range names {
+		slot, err := recordPage.InsertSlot(-1)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, slot, 0, "record %d should fit in the block", i)
+		require.NoError(t, recordPage.SetInt(slot, "id", i))
+		require.NoError(t, recordPage.SetString(slot, "name", name))
+		require.NoError(t, recordPage.SetString(slot, "note", fmt.Sprintf("note %d", i)))
+		slots = append(slots, slot)
+	}
+	for i, slot := range slots {
+		id, err := recordPage.GetInt(slot, "id")
+		require.NoError(t, err)
+		assert.Equal(t, i, id)
+		name, err := recordPage.GetString(slot, "name")
+		require.NoError(t, err)
+		assert.Equal(t, names[i], name)
+		note, err := recordPage.GetString(slot, "note")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("note %d", i), note)
+	}
+
+	// Shrinking and growing values keeps the other records intact
+	require.NoError(t, recordPage.SetString(slots[3], "name", "short"))
+	require.NoError(t, recordPage.SetString(slots[1], "name", strings.Repeat("z", 60)))
+	name, err := recordPage.GetString(slots[3], "name")
+	require.NoError(t, err)
+	assert.Equal(t, "short", name)
+	name, err = recordPage.GetString(slots[1], "name")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("z", 60), name)
+	name, err = recordPage.GetString(slots[4], "name")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("y", 100), name)
+
+	err = recordPage.SetString(slots[0], "name", strings.Repeat("w", 101))
+	assert.Error(t, err, "a value longer than the field must be rejected")
+
+	require.NoError(t, tx.Commit())
+}
+
+func TestRecordPage_PackedDeleteReclaimsRoom(t *testing.T) {
+	tx, recordPage, _ := newPackedTestPage(t)
+
+	long := strings.Repeat("x", 100)
+	fill := func() []int {
+		var slots []int
+		for {
+			slot, err := recordPage.InsertSlot(-1)
+			require.NoError(t, err)
+			if slot < 0 {
+				return slots
+			}
+			require.NoError(t, recordPage.SetString(slot, "name", long))
+			slots = append(slots, slot)
+		}
+	}
+	slots := fill()
+	require.NotEmpty(t, slots)
+
+	// The room of deleted strings is reused once the heap is compacted
+	for _, slot := range slots {
+		require.NoError(t, recordPage.Delete(slot))
+	}
+	assert.Equal(t, slots, fill())
+
+	// Deleting one record and inserting another keeps the survivors readable
+	require.NoError(t, recordPage.Delete(slots[0]))
+	slot, err := recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, slots[0], slot)
+	require.NoError(t, recordPage.SetString(slot, "name", "new"))
+	for _, s := range slots[1:] {
+		name, err := recordPage.GetString(s, "name")
+		require.NoError(t, err)
+		assert.Equal(t, long, name)
+	}
+	name, err := recordPage.GetString(slot, "name")
+	require.NoError(t, err)
+	assert.Equal(t, "new", name)
+
+	require.NoError(t, tx.Commit())
+}
+
+func TestRecordPage_PackedRollback(t *testing.T) {
+	tx, recordPage, newTx := newPackedTestPage(t)
+	block := recordPage.Block()
+	layout := recordPage.layout
+
+	slot, err := recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.SetString(slot, "name", "kept"))
+	require.NoError(t, tx.Commit())
+
+	// Changes that move the heap around, including a compaction, are all undone
+	tx2 := newTx()
+	recordPage, err = NewRecordPage(tx2, block, layout)
+	require.NoError(t, err)
+	for i := 0; i < 8; i++ {
+		newSlot, err := recordPage.InsertSlot(-1)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, newSlot, 0)
+		require.NoError(t, recordPage.SetString(newSlot, "name", strings.Repeat("x", 60)))
+		require.NoError(t, recordPage.Delete(newSlot))
+	}
+	require.NoError(t, recordPage.SetString(slot, "name", "changed"))
+	require.NoError(t, tx2.Rollback())
+
+	tx3 := newTx()
+	recordPage, err = NewRecordPage(tx3, block, layout)
+	require.NoError(t, err)
+	name, err := recordPage.GetString(slot, "name")
+	require.NoError(t, err)
+	assert.Equal(t, "kept", name)
+	next, err := recordPage.NextUsedSlot(slot)
+	require.NoError(t, err)
+	assert.Equal(t, -1, next)
+	require.NoError(t, tx3.Commit())
+}
+
+func TestRecordPage_OverflowStrings(t *testing.T) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	newTx := func() *transaction.Transaction {
+		return transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	}
+
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("body", 5000)
+	schema.AddStringField("title", 20)
+	layout := NewLayoutFromSchema(schema)
+	require.True(t, layout.Overflows("body"))
+	require.False(t, layout.Overflows("title"))
+	assert.Equal(t, 4+4+8+24, layout.GetSlotSize())
+
+	// A value several blocks long is read back intact, and the fields around it keep theirs
+	long := func(n int, seed string) string {
+		var sb strings.Builder
+		for i := 0; sb.Len() < n; i++ {
+			fmt.Fprintf(&sb, "%s%d ", seed, i)
+		}
+		return sb.String()[:n]
+	}
+	original := long(1500, "kept")
+	tx := newTx()
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+	slot, err := recordPage.InsertSlot(-1)
+	require.NoError(t, err)
+	body, err := recordPage.GetString(slot, "body")
+	require.NoError(t, err)
+	assert.Equal(t, "", body)
+	require.NoError(t, recordPage.SetInt(slot, "id", 7))
+	require.NoError(t, recordPage.SetString(slot, "body", original))
+	require.NoError(t, recordPage.SetString(slot, "title", "title"))
+	other, err := recordPage.InsertSlot(slot)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.SetString(other, "body", "short"))
+	require.NoError(t, tx.Commit())
+
+	tx = newTx()
+	recordPage, err = NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	body, err = recordPage.GetString(slot, "body")
+	require.NoError(t, err)
+	assert.Equal(t, original, body)
+	title, err := recordPage.GetString(slot, "title")
+	require.NoError(t, err)
+	assert.Equal(t, "title", title)
+	body, err = recordPage.GetString(other, "body")
+	require.NoError(t, err)
+	assert.Equal(t, "short", body)
+	chainBlocks, err := tx.Size(OverflowFileName("testfile"))
+	require.NoError(t, err)
+
+	// Shorter and longer values reuse the slot's chain, which grows only when it must
+	for _, value := range []string{long(20, "short"), "", long(1500, "same length")} {
+		require.NoError(t, recordPage.SetString(slot, "body", value))
+		body, err = recordPage.GetString(slot, "body")
+		require.NoError(t, err)
+		assert.Equal(t, value, body)
+	}
+	size, err := tx.Size(OverflowFileName("testfile"))
+	require.NoError(t, err)
+	assert.Equal(t, chainBlocks, size)
+	require.NoError(t, recordPage.SetString(slot, "body", long(3000, "longer")))
+	require.NoError(t, recordPage.SetString(other, "body", long(800, "other")))
+	size, err = tx.Size(OverflowFileName("testfile"))
+	require.NoError(t, err)
+	assert.Greater(t, size, chainBlocks)
+
+	// A rollback restores the old values, whichever blocks of the chains they were in
+	require.NoError(t, tx.Rollback())
+	tx = newTx()
+	defer tx.Commit()
+	recordPage, err = NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	body, err = recordPage.GetString(slot, "body")
+	require.NoError(t, err)
+	assert.Equal(t, original, body)
+	body, err = recordPage.GetString(other, "body")
+	require.NoError(t, err)
+	assert.Equal(t, "short", body)
+}
+
+func TestRecordPage_Slots(t *testing.T) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddBigIntField("total")
+	schema.AddStringField("name", 20)
+	layout := NewLayoutFromSchema(schema)
+
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+	recordPage, err := NewRecordPage(tx, block, layout)
+	require.NoError(t, err)
+	require.NoError(t, recordPage.Format())
+	for i, name := range []string{"first", "second"} {
+		slot, err := recordPage.InsertSlot(-1)
+		require.NoError(t, err)
+		require.NoError(t, recordPage.SetInt(slot, "id", i))
+		require.NoError(t, recordPage.SetLong(slot, "total", int64(i)<<40))
+		require.NoError(t, recordPage.SetString(slot, "name", name))
+	}
+	require.NoError(t, recordPage.Delete(0))
+	require.NoError(t, tx.Commit())
+
+	// Two transactions can dump the block at once, since reading it only takes a shared lock
+	var dumps [][]SlotInfo
+	for range 2 {
+		reader := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+		recordPage, err := NewRecordPage(reader, block, layout)
+		require.NoError(t, err)
+		slots, err := recordPage.Slots()
+		require.NoError(t, err)
+		dumps = append(dumps, slots)
+		defer reader.Commit()
+	}
+	assert.Equal(t, dumps[0], dumps[1])
+
+	slots := dumps[0]
+	require.Len(t, slots, (400-RecordHeaderSize)/layout.GetSlotSize())
+	assert.Equal(t, SlotInfo{Slot: 0, Status: SlotStatusEmpty}, slots[0])
+	assert.Equal(t, SlotInfo{
+		Slot:   1,
+		Status: SlotStatusInUse,
+		Values: map[string]any{"id": 1, "total": int64(1) << 40, "name": "second"},
+	}, slots[1])
+	for _, slot := range slots[2:] {
+		assert.Equal(t, SlotStatusEmpty, slot.Status)
+		assert.Nil(t, slot.Values)
+	}
+	assert.Equal(t, "in use", SlotStatusInUse.String())
+}
+
+// TestRecordPage_Values tests reading and writing values by the type of their field, with both layouts
+func TestRecordPage_Values(t *testing.T) {
+	for _, packed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("packed=%v", packed), func(t *testing.T) {
+			fileManager := file.NewMemoryManager(400)
+			logManager, err := log.NewManager(fileManager, "test.log")
+			require.NoError(t, err)
+			bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+			require.NoError(t, err)
+			tx := transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+			defer tx.Commit()
+
+			schema := NewSchema()
+			schema.AddIntField("id")
+			schema.AddBigIntField("total")
+			schema.AddStringField("name", 20)
+			layout := NewLayoutFromSchema(schema)
+			if packed {
+				layout = NewPackedLayoutFromSchema(schema)
+			}
+			block, err := tx.Append("testfile")
+			require.NoError(t, err)
+			recordPage, err := NewRecordPage(tx, block, layout)
+			require.NoError(t, err)
+			require.NoError(t, recordPage.Format())
+			slot, err := recordPage.InsertSlot(-1)
+			require.NoError(t, err)
+
+			require.NoError(t, recordPage.SetValue(slot, "id", -7))
+			require.NoError(t, recordPage.SetValue(slot, "total", int64(1)<<40))
+			require.NoError(t, recordPage.SetValue(slot, "name", "Alice"))
+			for fieldName, expected := range map[string]any{"id": -7, "total": int64(1) << 40, "name": "Alice"} {
+				val, err := recordPage.GetValue(slot, fieldName)
+				require.NoError(t, err)
+				assert.Equal(t, expected, val, fieldName)
+			}
+
+			// A bigint field also takes an int, and is read back as an int64
+			require.NoError(t, recordPage.SetValue(slot, "total", 12))
+			val, err := recordPage.GetValue(slot, "total")
+			require.NoError(t, err)
+			assert.Equal(t, int64(12), val)
+
+			// A value of another type is rejected without changing the field
+			assert.Error(t, recordPage.SetValue(slot, "id", "seven"))
+			assert.Error(t, recordPage.SetValue(slot, "id", int64(7)))
+			assert.Error(t, recordPage.SetValue(slot, "name", 7))
+			val, err = recordPage.GetValue(slot, "id")
+			require.NoError(t, err)
+			assert.Equal(t, -7, val)
+		})
+	}
+}
@@ -1,8 +1,16 @@
 package record
 
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
 type FieldInfo struct {
 	fieldLength int
 	fieldType   string
+	// table is the table the field belongs to, or "" if it isn't known
+	table string
 }
 
 type Schema struct {
@@ -18,37 +26,100 @@ func NewSchema() *Schema {
 	}
 }
 
-func (s *Schema) AddField(name string, fieldType string, length int) {
-	if _, exists := s.fieldInfo[name]; !exists {
-		s.fields = append(s.fields, name)
+// SplitFieldName splits a field name qualified by its table (e.g. students.id) into the
+// table and the field. Any other name, such as an unqualified field or the name of a
+// computed column, returns an empty table.
+func SplitFieldName(name string) (table string, field string) {
+	table, field, found := strings.Cut(name, ".")
+	if !found || !isIdentifier(table) || !isIdentifier(field) {
+		return "", name
 	}
-	s.fieldInfo[name] = FieldInfo{
+	return table, field
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Schema) AddField(name string, fieldType string, length int) {
+	s.addFieldInfo(name, FieldInfo{
 		fieldLength: length,
 		fieldType:   fieldType,
-	}
+	})
 }
 
 func (s *Schema) AddIntField(name string) {
 	s.AddField(name, "int", 4)
 }
 
+// AddBigIntField adds an 8 byte int field
+func (s *Schema) AddBigIntField(name string) {
+	s.AddField(name, "bigint", 8)
+}
+
 func (s *Schema) AddStringField(name string, length int) {
 	s.AddField(name, "string", length)
 }
 
+// RemoveField removes a field from the schema, keeping the order of the others. A layout
+// made from the schema before still has the field, so a new layout must be made for it.
+func (s *Schema) RemoveField(name string) {
+	if _, exists := s.fieldInfo[name]; !exists {
+		return
+	}
+	s.fields = slices.DeleteFunc(s.fields, func(field string) bool { return field == name })
+	delete(s.fieldInfo, name)
+}
+
+// Copy adds a field of the other schema under the given name, which may be qualified by its table.
 func (s *Schema) Copy(other *Schema, fieldName string) {
-	if info, exists := other.fieldInfo[fieldName]; exists {
-		s.AddField(fieldName, info.fieldType, info.fieldLength)
+	if name, exists := other.Resolve(fieldName); exists {
+		s.addFieldInfo(fieldName, other.fieldInfo[name])
 	}
 }
 
+// CopyAll adds all the fields of the other schema. If a field has the same name as a field
+// of a different table already in the schema, both are renamed to their qualified names
+// (e.g. students.id and courses.id), so that neither is lost.
 func (s *Schema) CopyAll(other *Schema) {
 	for _, field := range other.fields {
 		info := other.fieldInfo[field]
-		s.AddField(field, info.fieldType, info.fieldLength)
+		existing, exists := s.fieldInfo[field]
+		switch {
+		case info.table == "":
+			s.addFieldInfo(field, info)
+		case exists && existing.table != "" && existing.table != info.table:
+			s.rename(field, existing.table+"."+field)
+			s.addFieldInfo(info.table+"."+field, info)
+		case !exists && s.hasQualified(info.table, field):
+			// An earlier conflict already qualified this field name
+			s.addFieldInfo(info.table+"."+field, info)
+		default:
+			s.addFieldInfo(field, info)
+		}
 	}
 }
 
+// WithTable returns a copy of the schema whose fields belong to the given table,
+// so that they can also be found by their qualified names.
+func (s *Schema) WithTable(table string) *Schema {
+	result := NewSchema()
+	for _, field := range s.fields {
+		info := s.fieldInfo[field]
+		info.table = table
+		result.addFieldInfo(field, info)
+	}
+	return result
+}
+
 // Fields returns a copy of the field names slice
 func (s *Schema) Fields() []string {
 	fields := make([]string, len(s.fields))
@@ -56,15 +127,52 @@ func (s *Schema) Fields() []string {
 	return fields
 }
 
+// Equal reports whether the other schema has the same fields in the same order, each
+// with the same type and length. The tables the fields belong to aren't compared.
+func (s *Schema) Equal(other *Schema) bool {
+	if len(s.fields) != len(other.fields) {
+		return false
+	}
+	for i, field := range s.fields {
+		if other.fields[i] != field {
+			return false
+		}
+		info, otherInfo := s.fieldInfo[field], other.fieldInfo[field]
+		if info.fieldType != otherInfo.fieldType || info.fieldLength != otherInfo.fieldLength {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns the name under which the schema holds a field.
+// The field can be given by that name, or qualified by its table (e.g. students.id).
+func (s *Schema) Resolve(fieldName string) (string, bool) {
+	if _, exists := s.fieldInfo[fieldName]; exists {
+		return fieldName, true
+	}
+	table, field := SplitFieldName(fieldName)
+	if table == "" {
+		return "", false
+	}
+	if info, exists := s.fieldInfo[field]; exists && info.table == table {
+		return field, true
+	}
+	return "", false
+}
+
 // GetFieldInfo returns the field information for a given field name
 func (s *Schema) GetFieldInfo(fieldName string) (FieldInfo, bool) {
-	info, exists := s.fieldInfo[fieldName]
-	return info, exists
+	name, exists := s.Resolve(fieldName)
+	if !exists {
+		return FieldInfo{}, false
+	}
+	return s.fieldInfo[name], true
 }
 
 // Type returns the type of a field
 func (s *Schema) Type(fieldName string) string {
-	if info, exists := s.fieldInfo[fieldName]; exists {
+	if info, exists := s.GetFieldInfo(fieldName); exists {
 		return info.fieldType
 	}
 	return ""
@@ -72,14 +180,49 @@ func (s *Schema) Type(fieldName string) string {
 
 // Length returns the length of a field
 func (s *Schema) Length(fieldName string) int {
-	if info, exists := s.fieldInfo[fieldName]; exists {
+	if info, exists := s.GetFieldInfo(fieldName); exists {
 		return info.fieldLength
 	}
 	return 0
 }
 
+// Table returns the table a field belongs to, or "" if it isn't known.
+func (s *Schema) Table(fieldName string) string {
+	info, _ := s.GetFieldInfo(fieldName)
+	return info.table
+}
+
 // HasField checks if the schema contains the specified field.
 func (s *Schema) HasField(fieldName string) bool {
-	_, exists := s.fieldInfo[fieldName]
+	_, exists := s.Resolve(fieldName)
 	return exists
 }
+
+func (s *Schema) addFieldInfo(name string, info FieldInfo) {
+	if _, exists := s.fieldInfo[name]; !exists {
+		s.fields = append(s.fields, name)
+	}
+	s.fieldInfo[name] = info
+}
+
+// rename changes the name of a field, keeping its position.
+func (s *Schema) rename(oldName string, newName string) {
+	for i, field := range s.fields {
+		if field == oldName {
+			s.fields[i] = newName
+		}
+	}
+	s.fieldInfo[newName] = s.fieldInfo[oldName]
+	delete(s.fieldInfo, oldName)
+}
+
+// hasQualified checks if the schema holds a field of another table under its qualified name.
+func (s *Schema) hasQualified(table string, field string) bool {
+	for _, name := range s.fields {
+		t, f := SplitFieldName(name)
+		if f == field && t != table && s.fieldInfo[name].table == t {
+			return true
+		}
+	}
+	return false
+}
@@ -52,3 +52,87 @@ func TestSchema(t *testing.T) {
 	assert.Equal(t, "string", nameInfo.fieldType)
 	assert.Equal(t, 50, nameInfo.fieldLength)
 }
+
+func TestSchemaQualifiedFields(t *testing.T) {
+	table, field := SplitFieldName("students.id")
+	assert.Equal(t, "students", table)
+	assert.Equal(t, "id", field)
+	for _, name := range []string{"id", "count(students.id)", "students.age * 2"} {
+		table, field = SplitFieldName(name)
+		assert.Empty(t, table, name)
+		assert.Equal(t, name, field)
+	}
+
+	students := NewSchema()
+	students.AddIntField("id")
+	students.AddStringField("name", 20)
+	students = students.WithTable("students")
+	courses := NewSchema()
+	courses.AddIntField("id")
+	courses.AddIntField("student_id")
+	courses = courses.WithTable("courses")
+
+	// Fields of a table can be found by their qualified names
+	assert.True(t, students.HasField("students.id"))
+	assert.True(t, students.HasField("id"))
+	assert.False(t, students.HasField("courses.id"))
+	assert.Equal(t, "students", students.Table("name"))
+	assert.Equal(t, 20, students.Length("students.name"))
+	name, ok := students.Resolve("students.name")
+	require.True(t, ok)
+	assert.Equal(t, "name", name)
+
+	// Combining both keeps each id under its qualified name
+	combined := NewSchema()
+	combined.CopyAll(students)
+	combined.CopyAll(courses)
+	assert.Equal(t, []string{"students.id", "name", "courses.id", "student_id"}, combined.Fields())
+	assert.False(t, combined.HasField("id"), "An unqualified shared field is ambiguous")
+	assert.True(t, combined.HasField("students.id"))
+	assert.True(t, combined.HasField("courses.student_id"))
+	assert.Equal(t, "courses", combined.Table("courses.id"))
+
+	// A third table with an id is qualified as well
+	teachers := NewSchema()
+	teachers.AddIntField("id")
+	combined.CopyAll(teachers.WithTable("teachers"))
+	assert.Equal(t, []string{"students.id", "name", "courses.id", "student_id", "teachers.id"}, combined.Fields())
+
+	// A projection can keep the qualified name
+	projected := NewSchema()
+	projected.Copy(combined, "students.name")
+	assert.Equal(t, []string{"students.name"}, projected.Fields())
+	assert.Equal(t, "string", projected.Type("students.name"))
+}
+
+func TestSchemaEqual(t *testing.T) {
+	schema := NewSchema()
+	schema.AddIntField("id")
+	schema.AddStringField("name", 20)
+
+	same := NewSchema()
+	same.AddIntField("id")
+	same.AddStringField("name", 20)
+	assert.True(t, schema.Equal(same))
+	assert.True(t, schema.Equal(same.WithTable("students")), "The tables of the fields aren't compared")
+
+	reordered := NewSchema()
+	reordered.AddStringField("name", 20)
+	reordered.AddIntField("id")
+	assert.False(t, schema.Equal(reordered))
+
+	longer := NewSchema()
+	longer.AddIntField("id")
+	longer.AddStringField("name", 30)
+	assert.False(t, schema.Equal(longer))
+
+	retyped := NewSchema()
+	retyped.AddBigIntField("id")
+	retyped.AddStringField("name", 20)
+	assert.False(t, schema.Equal(retyped))
+
+	fewer := NewSchema()
+	fewer.AddIntField("id")
+	assert.False(t, schema.Equal(fewer))
+	assert.False(t, fewer.Equal(schema))
+}
@@ -33,6 +33,9 @@ type UpdateScan interface {
 	SetInt(fldname string, val int) error
 	// SetString sets the value of the specified string field in the current record.
 	SetString(fldname string, val string) error
+	// SetValue sets the value of the specified field in the current record: an int or a
+	// string, or an int64 for a bigint field.
+	SetValue(fldname string, val any) error
 	// Insert inserts a new record in the scan.
 	Insert() error
 	// Delete removes the current record from the scan.
@@ -0,0 +1,192 @@
+package table
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// BulkLoader appends many records to a table faster than inserting them one by one
+// through a TableScan. Records are queued until they fill a block, then written into a
+// newly appended block as whole slots, with a single log record for the block instead of
+// one for every value. Blocks that already hold records are never written to.
+// With a packed layout, a block holds as many records as their strings leave room for.
+// The values of fields that overflow are written into their chains of overflow blocks
+// first, and those writes are logged one by one.
+type BulkLoader struct {
+	transaction   *transaction.Transaction
+	layout        *record.Layout
+	fileName      string
+	fields        []string
+	slotsPerBlock int
+	pending       [][]any
+	// pendingSize is the room the queued records take up in a block of a packed layout
+	pendingSize int
+	rids        []*record.RID
+}
+
+// NewBulkLoader creates a bulk loader for the given table
+func NewBulkLoader(transaction *transaction.Transaction, layout *record.Layout, tableName string) *BulkLoader {
+	return &BulkLoader{
+		transaction:   transaction,
+		layout:        layout,
+		fileName:      tableName + ".tbl",
+		fields:        layout.GetSchema().Fields(),
+		slotsPerBlock: layout.SlotsPerBlock(transaction.BlockSize()),
+	}
+}
+
+// Add queues a record, given a value for each field of the table in the order of its schema.
+// Ints and bigints are given as int and strings as string. Once a block's worth of records is queued,
+// they are written to the table.
+func (bl *BulkLoader) Add(values []any) error {
+	schema := bl.layout.GetSchema()
+	if len(values) != len(bl.fields) {
+		return fmt.Errorf("expected %d values, got %d", len(bl.fields), len(values))
+	}
+	for i, fieldName := range bl.fields {
+		switch v := values[i].(type) {
+		case int:
+			if schema.Type(fieldName) == "string" {
+				return fmt.Errorf("field %s expects a string, got %d", fieldName, v)
+			}
+			if schema.Type(fieldName) == "int" && (v < math.MinInt32 || v > math.MaxInt32) {
+				return fmt.Errorf("field %s: %w: %d", fieldName, transaction.ErrIntOutOfRange, v)
+			}
+		case string:
+			if schema.Type(fieldName) != "string" {
+				return fmt.Errorf("field %s expects an int, got '%s'", fieldName, v)
+			}
+			if len(v) > schema.Length(fieldName) {
+				return fmt.Errorf("value for field %s is longer than %d", fieldName, schema.Length(fieldName))
+			}
+		default:
+			return fmt.Errorf("unsupported value %v for field %s", v, fieldName)
+		}
+	}
+
+	if bl.layout.PackedStrings() {
+		return bl.addPacked(values)
+	}
+	bl.pending = append(bl.pending, values)
+	if len(bl.pending) == bl.slotsPerBlock {
+		return bl.Flush()
+	}
+	return nil
+}
+
+// addPacked queues a record for a packed layout, first writing the queued records if
+// it doesn't fit in their block
+func (bl *BulkLoader) addPacked(values []any) error {
+	size := record.PackedRecordSize(bl.layout, values)
+	if len(bl.pending) > 0 && record.PackedHeaderSize+bl.pendingSize+size > bl.transaction.BlockSize() {
+		err := bl.Flush()
+		if err != nil {
+			return err
+		}
+	}
+	bl.pending = append(bl.pending, values)
+	bl.pendingSize += size
+	return nil
+}
+
+// Flush writes the queued records to the table
+func (bl *BulkLoader) Flush() error {
+	if len(bl.pending) == 0 {
+		return nil
+	}
+
+	heads, err := bl.writeOverflowChains()
+	if err != nil {
+		return err
+	}
+	blk, err := bl.transaction.Append(bl.fileName)
+	if err != nil {
+		return err
+	}
+	_, err = bl.transaction.Pin(blk)
+	if err != nil {
+		return err
+	}
+	defer bl.transaction.Unpin(blk)
+
+	// The appended block is all zeros, which is already an empty record page.
+	// A record page has its header before its slots, so undoing the block zeroes every
+	// int of it rather than the int at the start of every slot.
+	err = bl.transaction.WriteNewBlock(blk, 4, func(page *file.Page) {
+		if bl.layout.PackedStrings() {
+			record.WritePackedRecords(bl.layout, page, bl.pending)
+		} else {
+			for slot, values := range bl.pending {
+				bl.writeSlot(page, slot, values, heads[slot])
+			}
+			record.WriteRecordHeader(page, len(bl.pending))
+		}
+		for slot := range bl.pending {
+			bl.rids = append(bl.rids, record.NewRID(blk.Number(), slot))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	bl.pending = bl.pending[:0]
+	bl.pendingSize = 0
+	return nil
+}
+
+// RIDs returns the record IDs of the records written so far, in the order they were added
+func (bl *BulkLoader) RIDs() []*record.RID {
+	return bl.rids
+}
+
+// writeOverflowChains writes the values of the queued records' fields that overflow into
+// chains of overflow blocks, and returns the first block of each value's chain by record
+// and field. A record has none if no field overflows.
+func (bl *BulkLoader) writeOverflowChains() ([][]int, error) {
+	heads := make([][]int, len(bl.pending))
+	if !slices.ContainsFunc(bl.fields, bl.layout.Overflows) {
+		return heads, nil
+	}
+	for slot, values := range bl.pending {
+		heads[slot] = make([]int, len(bl.fields))
+		for i, fieldName := range bl.fields {
+			if !bl.layout.Overflows(fieldName) {
+				continue
+			}
+			head, err := record.WriteOverflowString(bl.transaction, bl.fileName, values[i].(string))
+			if err != nil {
+				return nil, err
+			}
+			heads[slot][i] = head
+		}
+	}
+	return heads, nil
+}
+
+// writeSlot writes a whole record into a slot of the page and marks it in use. The values of
+// fields that overflow are given by the first blocks of their chains.
+func (bl *BulkLoader) writeSlot(page *file.Page, slot int, values []any, heads []int) {
+	slotOffset := record.RecordHeaderSize + slot*bl.layout.GetSlotSize()
+	page.SetInt(slotOffset, int(record.SlotStatusInUse))
+	for i, fieldName := range bl.fields {
+		offset := slotOffset + bl.layout.GetOffset(fieldName)
+		switch v := values[i].(type) {
+		case int:
+			if bl.layout.GetSchema().Type(fieldName) == "bigint" {
+				page.SetLong(offset, int64(v))
+			} else {
+				page.SetInt(offset, v)
+			}
+		case string:
+			if bl.layout.Overflows(fieldName) {
+				record.WriteOverflowRef(page, offset, heads[i], len(v))
+			} else {
+				page.SetString(offset, v)
+			}
+		}
+	}
+}
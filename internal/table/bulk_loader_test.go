@@ -0,0 +1,161 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// readAll returns the A and B values of every record of the table, in scan order
+func readAll(t *testing.T, tx *transaction.Transaction, layout *record.Layout, tableName string) []string {
+	ts, err := NewTableScan(tx, layout, tableName)
+	require.NoError(t, err)
+	defer ts.Close()
+	records := []string{}
+	for {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		if !hasNext {
+			break
+		}
+		a, err := ts.GetInt("A")
+		require.NoError(t, err)
+		b, err := ts.GetString("B")
+		require.NoError(t, err)
+		records = append(records, fmt.Sprintf("%d:%s", a, b))
+	}
+	return records
+}
+
+func TestBulkLoader(t *testing.T) {
+	testDir := "/tmp/testdb_bulkloader"
+	defer os.RemoveAll(testDir)
+
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+
+	// A record inserted the usual way, in the first block
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	ts, err := NewTableScan(tx, layout, "TestTable")
+	require.NoError(t, err)
+	require.NoError(t, ts.Insert())
+	require.NoError(t, ts.SetInt("A", 0))
+	require.NoError(t, ts.SetString("B", "first"))
+	ts.Close()
+
+	loader := NewBulkLoader(tx, layout, "TestTable")
+	expected := []string{"0:first"}
+	for i := 1; i <= 50; i++ {
+		require.NoError(t, loader.Add([]any{i, fmt.Sprintf("rec%d", i)}))
+		expected = append(expected, fmt.Sprintf("%d:rec%d", i, i))
+	}
+	require.NoError(t, loader.Flush())
+	require.NoError(t, tx.Commit())
+
+	rids := loader.RIDs()
+	require.Len(t, rids, 50)
+	assert.Equal(t, 1, rids[0].Block(), "Loaded records start in a new block")
+	assert.Equal(t, 0, rids[0].Slot())
+
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	assert.Equal(t, expected, readAll(t, tx, layout, "TestTable"))
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		loader := NewBulkLoader(tx, layout, "TestTable")
+		assert.Error(t, loader.Add([]any{1}))
+		assert.Error(t, loader.Add([]any{"1", "one"}))
+		assert.Error(t, loader.Add([]any{1, 2}))
+		assert.Error(t, loader.Add([]any{1, "much too long"}))
+		require.NoError(t, loader.Flush())
+		assert.Empty(t, loader.RIDs())
+	})
+	require.NoError(t, tx.Commit())
+
+	// Rolling back empties the blocks that were loaded
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	loader = NewBulkLoader(tx, layout, "TestTable")
+	for i := 100; i < 130; i++ {
+		require.NoError(t, loader.Add([]any{i, "rolled"}))
+	}
+	require.NoError(t, loader.Flush())
+	assert.Len(t, readAll(t, tx, layout, "TestTable"), 81)
+	require.NoError(t, tx.Rollback())
+
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	assert.Equal(t, expected, readAll(t, tx, layout, "TestTable"))
+	require.NoError(t, tx.Commit())
+
+	// Values of a field that overflows are loaded into their chains of overflow blocks
+	longSchema := record.NewSchema()
+	longSchema.AddIntField("A")
+	longSchema.AddStringField("B", 1000)
+	longLayout := record.NewLayoutFromSchema(longSchema)
+	require.True(t, longLayout.Overflows("B"))
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	defer tx.Commit()
+	loader = NewBulkLoader(tx, longLayout, "LongTable")
+	expected = []string{}
+	for i := 0; i < 20; i++ {
+		value := strings.Repeat(fmt.Sprint(i%10), i*50)
+		require.NoError(t, loader.Add([]any{i, value}))
+		expected = append(expected, fmt.Sprintf("%d:%s", i, value))
+	}
+	require.NoError(t, loader.Flush())
+	assert.Equal(t, expected, readAll(t, tx, longLayout, "LongTable"))
+}
+
+const benchmarkLoadRecords = 100_000
+
+// BenchmarkBulkLoad compares loading records with a bulk loader and with a TableScan insert loop
+func BenchmarkBulkLoad(b *testing.B) {
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+
+	b.Run("InsertLoop", func(b *testing.B) {
+		for b.Loop() {
+			tx := newTestTransaction(b, b.TempDir())
+			ts, err := NewTableScan(tx, layout, "BenchTable")
+			require.NoError(b, err)
+			for i := 0; i < benchmarkLoadRecords; i++ {
+				require.NoError(b, ts.Insert())
+				require.NoError(b, ts.SetInt("A", i))
+				require.NoError(b, ts.SetString("B", "bench"))
+			}
+			ts.Close()
+			require.NoError(b, tx.Commit())
+		}
+	})
+
+	b.Run("BulkLoader", func(b *testing.B) {
+		for b.Loop() {
+			tx := newTestTransaction(b, b.TempDir())
+			loader := NewBulkLoader(tx, layout, "BenchTable")
+			for i := 0; i < benchmarkLoadRecords; i++ {
+				require.NoError(b, loader.Add([]any{i, "bench"}))
+			}
+			require.NoError(b, loader.Flush())
+			require.NoError(b, tx.Commit())
+		}
+	})
+}
@@ -0,0 +1,31 @@
+package table
+
+import (
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// DumpBlock returns every slot of a block of the table with its status and record, to
+// show how full the block is and which records it holds. The block is read under a shared
+// lock and left unchanged.
+func DumpBlock(tx *transaction.Transaction, layout *record.Layout, tableName string, blockNum int) ([]record.SlotInfo, error) {
+	fileName := tableName + ".tbl"
+	numBlocks, err := tx.Size(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if blockNum < 0 || blockNum >= numBlocks {
+		return nil, fmt.Errorf("block %d out of range: table %s has %d block(s)", blockNum, tableName, numBlocks)
+	}
+
+	blk := file.NewBlockID(fileName, blockNum)
+	rp, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Unpin(blk)
+	return rp.Slots()
+}
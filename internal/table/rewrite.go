@@ -0,0 +1,113 @@
+package table
+
+import (
+	"log"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// Rewrite lays the records of a table out again in another layout, e.g. one without a
+// dropped field, and returns the number of records. Each field of the new layout keeps its
+// value from the old one. The table is locked exclusively first. The records are copied to
+// a temp table, and the table's blocks are formatted for the new layout and filled again
+// from its first block, so every record may get a new RID. The changes are logged like any
+// other, so a rollback restores the old records. The blocks left empty at the end of the
+// file are dropped once the transaction commits.
+func Rewrite(tx *transaction.Transaction, oldLayout *record.Layout, newLayout *record.Layout, tableName string) (int, error) {
+	fileName := tableName + ".tbl"
+	err := tx.XLockFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	temp := NewTempTable(tx, newLayout.GetSchema())
+	count, err := copyRecords(tx, oldLayout, tableName, temp.Layout(), temp.Name())
+	if err != nil {
+		return 0, err
+	}
+
+	numBlocks, err := tx.Size(fileName)
+	if err != nil {
+		return 0, err
+	}
+	for blockNum := range numBlocks {
+		err = formatBlock(tx, file.NewBlockID(fileName, blockNum), newLayout)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = copyRecords(tx, temp.Layout(), temp.Name(), newLayout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	tx.OnEnd(func(allCommitted bool) {
+		if !allCommitted {
+			return
+		}
+		if err := truncateEmptyBlocks(tx, newLayout, fileName); err != nil {
+			log.Printf("[REWRITE] failed to truncate %s: %v", fileName, err)
+		}
+	})
+	return count, nil
+}
+
+// formatBlock empties the block and formats it for the layout. The values of the old
+// layout don't line up with the new one, so the block is first cleared with SetBytes,
+// which logs its old bytes as they are rather than as values of the new layout's types.
+func formatBlock(tx *transaction.Transaction, blk *file.BlockID, layout *record.Layout) error {
+	rp, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		return err
+	}
+	defer tx.Unpin(blk)
+	err = tx.SetBytes(blk, 0, make([]byte, tx.BlockSize()), true)
+	if err != nil {
+		return err
+	}
+	return rp.Format()
+}
+
+// copyRecords inserts a record into the destination table for each record of the source
+// table, with the values of the destination's fields, and returns the number of records.
+func copyRecords(tx *transaction.Transaction, srcLayout *record.Layout, srcTable string, dstLayout *record.Layout, dstTable string) (int, error) {
+	src, err := NewTableScan(tx, srcLayout, srcTable)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	dst, err := NewTableScan(tx, dstLayout, dstTable)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	fields := dstLayout.GetSchema().Fields()
+	count := 0
+	for {
+		hasNext, err := src.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !hasNext {
+			return count, nil
+		}
+		err = dst.Insert()
+		if err != nil {
+			return 0, err
+		}
+		for _, fieldName := range fields {
+			val, err := src.GetValue(fieldName)
+			if err != nil {
+				return 0, err
+			}
+			err = dst.SetValue(fieldName, val)
+			if err != nil {
+				return 0, err
+			}
+		}
+		count++
+	}
+}
@@ -0,0 +1,78 @@
+package table
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+func TestRewrite(t *testing.T) {
+	testDir := "/tmp/testdb_rewrite"
+	defer os.RemoveAll(testDir)
+
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+	newTx := func() *transaction.Transaction {
+		return transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	}
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	schema.AddStringField("C", 40)
+	oldLayout := record.NewLayoutFromSchema(schema)
+	newSchema := record.NewSchema()
+	newSchema.CopyAll(schema)
+	newSchema.RemoveField("C")
+	newLayout := record.NewLayoutFromSchema(newSchema)
+
+	tx := newTx()
+	ts, err := NewTableScan(tx, oldLayout, "T")
+	require.NoError(t, err)
+	expected := []string{}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("A", i))
+		require.NoError(t, ts.SetString("B", fmt.Sprintf("rec%d", i)))
+		require.NoError(t, ts.SetString("C", "dropped"))
+		expected = append(expected, fmt.Sprintf("%d:rec%d", i, i))
+	}
+	ts.Close()
+	require.NoError(t, tx.Commit())
+	tx = newTx()
+	oldBlocks, err := tx.Size("T.tbl")
+	require.NoError(t, err)
+
+	// A rolled back rewrite leaves the records as they were
+	count, err := Rewrite(tx, oldLayout, newLayout, "T")
+	require.NoError(t, err)
+	assert.Equal(t, 50, count)
+	require.NoError(t, tx.Rollback())
+	tx = newTx()
+	assert.Equal(t, expected, readAll(t, tx, oldLayout, "T"))
+
+	// A committed one keeps every value but those of the dropped field, in fewer blocks
+	_, err = Rewrite(tx, oldLayout, newLayout, "T")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, readAll(t, tx, newLayout, "T"))
+	require.NoError(t, tx.Commit())
+	tx = newTx()
+	defer tx.Commit()
+	assert.ElementsMatch(t, expected, readAll(t, tx, newLayout, "T"))
+	newBlocks, err := tx.Size("T.tbl")
+	require.NoError(t, err)
+	assert.Less(t, newBlocks, oldBlocks)
+}
@@ -1,6 +1,7 @@
 package table
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
@@ -9,13 +10,27 @@ import (
 	"github.com/yashagw/cranedb/internal/transaction"
 )
 
+// ErrScanClosed is returned when a closed table scan is used before being moved to a block again
+var ErrScanClosed = errors.New("table scan is closed")
+
 // TableScan provides an iterator interface for scanning through records in a table
 type TableScan struct {
-	transaction       *transaction.Transaction
-	layout            *record.Layout
+	transaction *transaction.Transaction
+	layout      *record.Layout
+	tableName   string
+	// alias is the name that qualifies the table's fields, the table name unless SetAlias changes it
+	alias             string
 	fileName          string
 	currentRecordPage *record.RecordPage
 	currentSlot       int
+	// logger receives informational messages about inserts, or nil to stay silent
+	logger *log.Logger
+	// appendOnly makes inserts go after the last record of the table instead of into free room
+	appendOnly bool
+	// firstBlock and endBlock bound the blocks the scan reads, from firstBlock up to endBlock
+	// excluded; endBlock is -1 for a scan that reads up to the end of the file
+	firstBlock int
+	endBlock   int
 }
 
 // NewTableScan creates a new table scanner for the given table
@@ -25,7 +40,10 @@ func NewTableScan(transaction *transaction.Transaction, layout *record.Layout, t
 	ts := &TableScan{
 		transaction: transaction,
 		layout:      layout,
+		tableName:   tableName,
+		alias:       tableName,
 		fileName:    fileName,
+		endBlock:    -1,
 	}
 
 	if numBlocks, err := transaction.Size(fileName); err != nil {
@@ -45,34 +63,130 @@ func NewTableScan(transaction *transaction.Transaction, layout *record.Layout, t
 	return ts, nil
 }
 
-// Close unpins the current record page
+// PartitionScans splits the blocks of a table into at most n ranges of consecutive blocks,
+// whose sizes differ by one block at most, and returns a scan over the records of each.
+// The scans can be read at the same time from different goroutines sharing the transaction,
+// e.g. to aggregate the parts of a large table at once. They are meant for reading only.
+// A table without blocks gets a single scan, like NewTableScan.
+func PartitionScans(transaction *transaction.Transaction, layout *record.Layout, tableName string, n int) ([]*TableScan, error) {
+	numBlocks, err := transaction.Size(tableName + ".tbl")
+	if err != nil {
+		return nil, err
+	}
+	if numBlocks == 0 {
+		ts, err := NewTableScan(transaction, layout, tableName)
+		if err != nil {
+			return nil, err
+		}
+		return []*TableScan{ts}, nil
+	}
+
+	n = max(1, min(n, numBlocks))
+	scans := make([]*TableScan, 0, n)
+	first := 0
+	for i := range n {
+		end := first + numBlocks/n
+		if i < numBlocks%n {
+			end++
+		}
+		ts := &TableScan{
+			transaction: transaction,
+			layout:      layout,
+			tableName:   tableName,
+			alias:       tableName,
+			fileName:    tableName + ".tbl",
+			firstBlock:  first,
+			endBlock:    end,
+		}
+		if err := ts.MoveToBlock(first); err != nil {
+			for _, opened := range scans {
+				opened.Close()
+			}
+			return nil, err
+		}
+		scans = append(scans, ts)
+		first = end
+	}
+	return scans, nil
+}
+
+// Close unpins the current record page. Closing a closed scan does nothing.
+// BeforeFirst or MoveToRID reopens the scan.
 func (ts *TableScan) Close() {
 	if ts.currentRecordPage != nil {
 		ts.transaction.Unpin(ts.currentRecordPage.Block())
+		ts.currentRecordPage = nil
+	}
+	ts.currentSlot = -1
+}
+
+// SetLogger makes the scan log where each insert puts its record and the blocks it
+// moves past. A nil logger, the default, keeps the scan silent.
+func (ts *TableScan) SetLogger(logger *log.Logger) {
+	ts.logger = logger
+}
+
+func (ts *TableScan) logf(format string, args ...any) {
+	if ts.logger != nil {
+		ts.logger.Printf(format, args...)
 	}
 }
 
+// SetAppendOnly makes inserts put their records after the last record of the table, so that
+// records are read back in the order they were inserted and each gets a greater RID than the
+// records before it. By default an insert takes the first free slot from the scan's position
+// on, reusing the room of deleted records, which keeps the table smaller but may place a new
+// record before older ones.
+func (ts *TableScan) SetAppendOnly(appendOnly bool) {
+	ts.appendOnly = appendOnly
+}
+
+// SetAlias makes the scan take field names qualified by an alias of the table
+// (e.g. s.id for FROM students s) instead of by the table's name.
+func (ts *TableScan) SetAlias(alias string) {
+	ts.alias = alias
+}
+
 // HasField checks if the table scan has the specified field.
+// The field may be qualified by the table's name or alias (e.g. students.id).
 func (ts *TableScan) HasField(fieldName string) bool {
-	return ts.layout.GetSchema().HasField(fieldName)
+	return ts.layout.GetSchema().HasField(ts.resolve(fieldName))
+}
+
+// resolve strips the table's name or alias from a qualified field name.
+// Other names are returned unchanged.
+func (ts *TableScan) resolve(fieldName string) string {
+	table, field := record.SplitFieldName(fieldName)
+	if table == ts.alias && !ts.layout.GetSchema().HasField(fieldName) {
+		return field
+	}
+	return fieldName
 }
 
 // BeforeFirst positions the scanner before the first record
 func (ts *TableScan) BeforeFirst() error {
-	return ts.MoveToBlock(0)
+	return ts.MoveToBlock(ts.firstBlock)
 }
 
-// Next moves to the next record and returns true if successful
+// Next moves to the next record and returns true if successful.
+// It fails with transaction.ErrCanceled once the transaction's context is done,
+// which stops every scan built on top of this one.
 func (ts *TableScan) Next() (bool, error) {
+	if ts.currentRecordPage == nil {
+		return false, ErrScanClosed
+	}
+	if err := ts.transaction.Err(); err != nil {
+		return false, err
+	}
 	nextSlot, err := ts.currentRecordPage.NextUsedSlot(ts.currentSlot)
 	if err != nil {
 		return false, err
 	}
 	ts.currentSlot = nextSlot
 	for ts.currentSlot == -1 {
-		if atLastBlock, err := ts.AtLastBlock(); err != nil {
+		if atEnd, err := ts.atEndBlock(); err != nil {
 			return false, err
-		} else if atLastBlock {
+		} else if atEnd {
 			return false, nil
 		}
 		err := ts.MoveToBlock(ts.currentRecordPage.Block().Number() + 1)
@@ -91,9 +205,18 @@ func (ts *TableScan) Next() (bool, error) {
 // Insert inserts a new record somewhere in the scan and moves the scan to the new record.
 // If there is no room in the current block, it moves to the next block.
 // If there are no more blocks, it creates a new block.
+// An append-only scan moves to the last block first, and inserts after its last record.
 func (ts *TableScan) Insert() error {
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
+	}
+	if ts.appendOnly {
+		if err := ts.moveToLastBlock(); err != nil {
+			return err
+		}
+	}
 	// Try to insert in the current block
-	newSlot, err := ts.currentRecordPage.InsertSlot(ts.currentSlot)
+	newSlot, err := ts.insertSlot()
 	if err != nil {
 		log.Printf("[INSERT] InsertSlot failed: %v", err)
 		return err
@@ -109,8 +232,10 @@ func (ts *TableScan) Insert() error {
 		}
 
 		createdNewBlock := false
+		blockNum := ts.currentRecordPage.Block().Number()
 		if atLastBlock {
 			// No more blocks, create a new one
+			ts.logf("[INSERT] block %d of %s is full, appending a new block", blockNum, ts.tableName)
 			err = ts.MoveToNewBlock()
 			if err != nil {
 				log.Printf("[INSERT] MoveToNewBlock failed: %v", err)
@@ -119,8 +244,8 @@ func (ts *TableScan) Insert() error {
 			createdNewBlock = true
 		} else {
 			// Move to the next block
-			nextBlockNum := ts.currentRecordPage.Block().Number() + 1
-			err = ts.MoveToBlock(nextBlockNum)
+			ts.logf("[INSERT] block %d of %s is full, trying the next block", blockNum, ts.tableName)
+			err = ts.MoveToBlock(blockNum + 1)
 			if err != nil {
 				log.Printf("[INSERT] MoveToBlock failed: %v", err)
 				return err
@@ -128,7 +253,7 @@ func (ts *TableScan) Insert() error {
 		}
 
 		// Try to insert in the new/next block
-		newSlot, err = ts.currentRecordPage.InsertSlot(ts.currentSlot)
+		newSlot, err = ts.insertSlot()
 		if err != nil {
 			log.Printf("[INSERT] InsertSlot failed: %v", err)
 			return err
@@ -141,11 +266,35 @@ func (ts *TableScan) Insert() error {
 		}
 	}
 
+	ts.logf("[INSERT] inserted into block %d slot %d of %s", ts.currentRecordPage.Block().Number(), ts.currentSlot, ts.tableName)
 	return nil
 }
 
+// insertSlot takes a slot for a new record in the current block, after the current slot.
+func (ts *TableScan) insertSlot() (int, error) {
+	if ts.appendOnly {
+		return ts.currentRecordPage.InsertAfter(ts.currentSlot)
+	}
+	return ts.currentRecordPage.InsertSlot(ts.currentSlot)
+}
+
+// moveToLastBlock moves the scanner to the last block, unless it is there already
+func (ts *TableScan) moveToLastBlock() error {
+	numBlocks, err := ts.transaction.Size(ts.fileName)
+	if err != nil {
+		return err
+	}
+	if ts.currentRecordPage.Block().Number() == numBlocks-1 {
+		return nil
+	}
+	return ts.MoveToBlock(numBlocks - 1)
+}
+
 // Delete removes the current record
 func (ts *TableScan) Delete() error {
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
+	}
 	return ts.currentRecordPage.Delete(ts.currentSlot)
 }
 
@@ -184,6 +333,9 @@ func (ts *TableScan) MoveToNewBlock() error {
 
 // AtLastBlock returns true if the scanner is at the last block
 func (ts *TableScan) AtLastBlock() (bool, error) {
+	if ts.currentRecordPage == nil {
+		return false, ErrScanClosed
+	}
 	if numBlocks, err := ts.transaction.Size(ts.fileName); err != nil {
 		return false, err
 	} else {
@@ -191,6 +343,14 @@ func (ts *TableScan) AtLastBlock() (bool, error) {
 	}
 }
 
+// atEndBlock returns true if the scanner is at the last block it reads
+func (ts *TableScan) atEndBlock() (bool, error) {
+	if ts.endBlock < 0 {
+		return ts.AtLastBlock()
+	}
+	return ts.currentRecordPage.Block().Number() >= ts.endBlock-1, nil
+}
+
 // MoveToRID moves the scanner to the record with the specified RID
 func (ts *TableScan) MoveToRID(rid *record.RID) error {
 	ts.Close()
@@ -212,12 +372,25 @@ func (ts *TableScan) GetRID() (*record.RID, error) {
 	return record.NewRID(ts.currentRecordPage.Block().Number(), ts.currentSlot), nil
 }
 
-// GetInt retrieves an integer value from the current record
+// GetInt retrieves an integer value from the current record.
+// The value of a bigint field is read whole, since an int holds 64 bits.
 func (ts *TableScan) GetInt(fieldName string) (int, error) {
 	if ts.currentSlot < 0 {
 		return 0, fmt.Errorf("attempted to GetInt on invalid slot %d", ts.currentSlot)
 	}
-	return ts.currentRecordPage.GetInt(ts.currentSlot, fieldName)
+	if ts.layout.GetSchema().Type(ts.resolve(fieldName)) == "bigint" {
+		val, err := ts.GetLong(fieldName)
+		return int(val), err
+	}
+	return ts.currentRecordPage.GetInt(ts.currentSlot, ts.resolve(fieldName))
+}
+
+// GetLong retrieves an 8 byte integer value from the current record
+func (ts *TableScan) GetLong(fieldName string) (int64, error) {
+	if ts.currentSlot < 0 {
+		return 0, fmt.Errorf("attempted to GetLong on invalid slot %d", ts.currentSlot)
+	}
+	return ts.currentRecordPage.GetLong(ts.currentSlot, ts.resolve(fieldName))
 }
 
 // GetString retrieves a string value from the current record
@@ -225,32 +398,51 @@ func (ts *TableScan) GetString(fieldName string) (string, error) {
 	if ts.currentSlot < 0 {
 		return "", fmt.Errorf("attempted to GetString on invalid slot %d", ts.currentSlot)
 	}
-	return ts.currentRecordPage.GetString(ts.currentSlot, fieldName)
+	return ts.currentRecordPage.GetString(ts.currentSlot, ts.resolve(fieldName))
 }
 
-// GetValue retrieves a value from the current record as an interface{}
+// GetValue retrieves a value from the current record as an interface{}:
+// an int, an int64 for a bigint field, or a string
 func (ts *TableScan) GetValue(fieldName string) (any, error) {
-	fieldType := ts.layout.GetSchema().Type(fieldName)
-	if fieldType == "int" {
-		return ts.GetInt(fieldName)
+	if ts.currentSlot < 0 {
+		return nil, fmt.Errorf("attempted to GetValue on invalid slot %d", ts.currentSlot)
 	}
-	return ts.GetString(fieldName)
+	return ts.currentRecordPage.GetValue(ts.currentSlot, ts.resolve(fieldName))
 }
 
-// SetInt sets an integer value in the current record
+// SetInt sets an integer value in the current record.
+// The value of a bigint field is stored whole, since an int holds 64 bits.
 func (ts *TableScan) SetInt(fieldName string, value int) error {
-	return ts.currentRecordPage.SetInt(ts.currentSlot, fieldName, value)
+	if ts.layout.GetSchema().Type(ts.resolve(fieldName)) == "bigint" {
+		return ts.SetLong(fieldName, int64(value))
+	}
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
+	}
+	return ts.currentRecordPage.SetInt(ts.currentSlot, ts.resolve(fieldName), value)
+}
+
+// SetLong sets an 8 byte integer value in the current record
+func (ts *TableScan) SetLong(fieldName string, value int64) error {
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
+	}
+	return ts.currentRecordPage.SetLong(ts.currentSlot, ts.resolve(fieldName), value)
 }
 
 // SetString sets a string value in the current record
 func (ts *TableScan) SetString(fieldName string, value string) error {
-	return ts.currentRecordPage.SetString(ts.currentSlot, fieldName, value)
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
+	}
+	return ts.currentRecordPage.SetString(ts.currentSlot, ts.resolve(fieldName), value)
 }
 
+// SetValue sets a value in the current record: an int, an int64 or an int for a bigint
+// field, or a string
 func (ts *TableScan) SetValue(fieldName string, value any) error {
-	fieldType := ts.layout.GetSchema().Type(fieldName)
-	if fieldType == "int" {
-		return ts.SetInt(fieldName, value.(int))
+	if ts.currentRecordPage == nil {
+		return ErrScanClosed
 	}
-	return ts.SetString(fieldName, value.(string))
+	return ts.currentRecordPage.SetValue(ts.currentSlot, ts.resolve(fieldName), value)
 }
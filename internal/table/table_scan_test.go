@@ -1,7 +1,14 @@
 package table
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	stdlog "log"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -242,3 +249,500 @@ func TestTableScan(t *testing.T) {
 	err = tx.Commit()
 	require.NoError(t, err)
 }
+
+func TestTableScanQualifiedFields(t *testing.T) {
+	testDir := "/tmp/testdb_tablescan_qualified"
+	defer os.RemoveAll(testDir)
+
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	ts, err := NewTableScan(tx, record.NewLayoutFromSchema(schema), "TestTable")
+	require.NoError(t, err)
+	defer ts.Close()
+
+	assert.True(t, ts.HasField("TestTable.A"))
+	assert.False(t, ts.HasField("Other.A"))
+
+	require.NoError(t, ts.Insert())
+	require.NoError(t, ts.SetInt("TestTable.A", 7))
+	require.NoError(t, ts.SetString("B", "seven"))
+
+	require.NoError(t, ts.BeforeFirst())
+	hasNext, err := ts.Next()
+	require.NoError(t, err)
+	require.True(t, hasNext)
+	a, err := ts.GetInt("A")
+	require.NoError(t, err)
+	assert.Equal(t, 7, a)
+	b, err := ts.GetString("TestTable.B")
+	require.NoError(t, err)
+	assert.Equal(t, "seven", b)
+}
+
+func TestTableScanBigInt(t *testing.T) {
+	testDir := "/tmp/testdb_tablescan_bigint"
+	defer os.RemoveAll(testDir)
+
+	tx := newTestTransaction(t, testDir)
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddBigIntField("B")
+	ts, err := NewTableScan(tx, record.NewLayoutFromSchema(schema), "TestTable")
+	require.NoError(t, err)
+	defer ts.Close()
+
+	values := []int64{1 << 40, -5000000000, 7}
+	for i, val := range values {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("A", i))
+		require.NoError(t, ts.SetLong("B", val))
+	}
+	// SetInt stores all 8 bytes of a bigint field
+	require.NoError(t, ts.Insert())
+	require.NoError(t, ts.SetInt("A", 3))
+	require.NoError(t, ts.SetInt("B", 3000000000))
+	values = append(values, 3000000000)
+
+	require.NoError(t, ts.BeforeFirst())
+	for i, want := range values {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		a, err := ts.GetInt("A")
+		require.NoError(t, err)
+		assert.Equal(t, i, a)
+		b, err := ts.GetLong("B")
+		require.NoError(t, err)
+		assert.Equal(t, want, b)
+		val, err := ts.GetValue("B")
+		require.NoError(t, err)
+		assert.Equal(t, want, val)
+		n, err := ts.GetInt("B")
+		require.NoError(t, err)
+		assert.Equal(t, int(want), n)
+	}
+}
+
+// TestTableScanLogger tests that inserts are only logged when the scan has a logger
+func TestTableScanLogger(t *testing.T) {
+	testDir := "/tmp/testdb_tablescan_logger"
+	defer os.RemoveAll(testDir)
+
+	tx := newTestTransaction(t, testDir)
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	ts, err := NewTableScan(tx, record.NewLayoutFromSchema(schema), "TestTable")
+	require.NoError(t, err)
+	defer ts.Close()
+
+	var out bytes.Buffer
+	stdlog.SetOutput(&out)
+	defer stdlog.SetOutput(os.Stderr)
+
+	// Enough records to fill the first block
+	for i := 0; i < 100; i++ {
+		require.NoError(t, ts.Insert())
+	}
+	assert.Empty(t, out.String(), "inserts should be silent by default")
+
+	ts.SetLogger(stdlog.New(&out, "", 0))
+	require.NoError(t, ts.Insert())
+	assert.Contains(t, out.String(), "[INSERT] inserted into block")
+
+	out.Reset()
+	ts.SetLogger(nil)
+	require.NoError(t, ts.Insert())
+	assert.Empty(t, out.String())
+}
+
+func TestTableScanAppendOnly(t *testing.T) {
+	testDir := "/tmp/testdb_tablescan_append"
+	defer os.RemoveAll(testDir)
+
+	tx := newTestTransaction(t, testDir)
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	layout := record.NewLayoutFromSchema(schema)
+
+	// readAll returns the values of the table's records in scan order
+	readAll := func(ts *TableScan) []int {
+		require.NoError(t, ts.BeforeFirst())
+		values := []int{}
+		for {
+			hasNext, err := ts.Next()
+			require.NoError(t, err)
+			if !hasNext {
+				return values
+			}
+			a, err := ts.GetInt("A")
+			require.NoError(t, err)
+			values = append(values, a)
+		}
+	}
+	// fill inserts 60 records over two blocks, then deletes the first one
+	fill := func(tableName string) *TableScan {
+		ts, err := NewTableScan(tx, layout, tableName)
+		require.NoError(t, err)
+		for i := 0; i < 60; i++ {
+			require.NoError(t, ts.Insert())
+			require.NoError(t, ts.SetInt("A", i))
+		}
+		require.NoError(t, ts.BeforeFirst())
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		require.NoError(t, ts.Delete())
+		return ts
+	}
+
+	// By default the new record takes the room of the deleted one, at the start of the table
+	ts := fill("Reused")
+	defer ts.Close()
+	require.NoError(t, ts.BeforeFirst())
+	require.NoError(t, ts.Insert())
+	require.NoError(t, ts.SetInt("A", 60))
+	rid, err := ts.GetRID()
+	require.NoError(t, err)
+	assert.Equal(t, record.NewRID(0, 0), rid)
+	assert.Equal(t, 60, readAll(ts)[0])
+
+	// An append-only scan puts it after every other record, wherever the scan is
+	appended := fill("Appended")
+	defer appended.Close()
+	appended.SetAppendOnly(true)
+	var lastRID *record.RID
+	for i := 60; i < 120; i++ {
+		require.NoError(t, appended.BeforeFirst())
+		require.NoError(t, appended.Insert())
+		require.NoError(t, appended.SetInt("A", i))
+		rid, err := appended.GetRID()
+		require.NoError(t, err)
+		if lastRID != nil {
+			assert.True(t, rid.Block() > lastRID.Block() || (rid.Block() == lastRID.Block() && rid.Slot() > lastRID.Slot()),
+				"RID %v should come after %v", rid, lastRID)
+		}
+		lastRID = rid
+	}
+	values := readAll(appended)
+	require.Len(t, values, 119)
+	for i, a := range values {
+		assert.Equal(t, i+1, a)
+	}
+}
+
+// TestTableScanConcurrentUpdates has many transactions scan and update the records of the
+// same block while its buffer is written to disk, to surface races on the page (run with -race).
+func TestTableScanUseAfterClose(t *testing.T) {
+	testDir := "/tmp/testdb_tablescan_closed"
+	defer os.RemoveAll(testDir)
+
+	tx := newTestTransaction(t, testDir)
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	layout := record.NewLayoutFromSchema(schema)
+	ts, err := NewTableScan(tx, layout, "T")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("A", i))
+	}
+
+	// A closed scan fails until it is moved to a block again
+	ts.Close()
+	_, err = ts.Next()
+	assert.ErrorIs(t, err, ErrScanClosed)
+	_, err = ts.GetInt("A")
+	assert.Error(t, err)
+	_, err = ts.GetRID()
+	assert.Error(t, err)
+	assert.ErrorIs(t, ts.SetInt("A", 5), ErrScanClosed)
+	assert.ErrorIs(t, ts.Delete(), ErrScanClosed)
+	_, err = ts.AtLastBlock()
+	assert.ErrorIs(t, err, ErrScanClosed)
+	ts.Close()
+
+	require.NoError(t, ts.BeforeFirst())
+	hasNext, err := ts.Next()
+	require.NoError(t, err)
+	assert.True(t, hasNext)
+
+	// Ending the transaction unpins the scan's block without closing the scan
+	require.NoError(t, tx.Commit())
+	_, err = ts.Next()
+	assert.ErrorIs(t, err, transaction.ErrNotPinned)
+	assert.ErrorIs(t, ts.SetInt("A", 5), transaction.ErrNotPinned)
+	ts.Close()
+}
+
+func TestTableScanConcurrentUpdates(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	defer fileManager.Close()
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 20)
+	require.NoError(t, err)
+	lockTable := transaction.NewLockTable()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	schema.AddStringField("B", 9)
+	layout := record.NewLayoutFromSchema(schema)
+
+	const numWorkers = 8
+	const numUpdates = 20
+	tx := transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	ts, err := NewTableScan(tx, layout, "TestTable")
+	require.NoError(t, err)
+	for range numWorkers {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("A", 0))
+		require.NoError(t, ts.SetString("B", "rec"))
+	}
+	ts.Close()
+	require.NoError(t, tx.Commit())
+
+	// update has a transaction read every record and increment the one of the worker
+	update := func(worker int) error {
+		tx := transaction.NewTransactionWithIsolation(fileManager, logManager, bufferManager, lockTable, transaction.ReadCommitted)
+		ts, err := NewTableScan(tx, layout, "TestTable")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for slot := 0; ; slot++ {
+			hasNext, err := ts.Next()
+			if err == nil && hasNext && slot == worker {
+				var val int
+				val, err = ts.GetInt("A")
+				if err == nil {
+					err = ts.SetInt("A", val+1)
+				}
+				if err == nil {
+					err = ts.SetString("B", fmt.Sprintf("w%d", val+1))
+				}
+			}
+			if err != nil {
+				ts.Close()
+				tx.Rollback()
+				return err
+			}
+			if !hasNext {
+				break
+			}
+		}
+		ts.Close()
+		return tx.Commit()
+	}
+
+	done := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		// Write the buffers to disk while the workers change them
+		defer close(flushed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				assert.NoError(t, bufferManager.FlushAllBuffers())
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for worker := range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range numUpdates {
+				err := update(worker)
+				// A lock wait that times out is retried
+				for errors.Is(err, transaction.ErrLockAbort) {
+					err = update(worker)
+				}
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-flushed
+
+	tx = transaction.NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	defer tx.Commit()
+	ts, err = NewTableScan(tx, layout, "TestTable")
+	require.NoError(t, err)
+	defer ts.Close()
+	for range numWorkers {
+		hasNext, err := ts.Next()
+		require.NoError(t, err)
+		require.True(t, hasNext)
+		val, err := ts.GetInt("A")
+		require.NoError(t, err)
+		assert.Equal(t, numUpdates, val)
+		str, err := ts.GetString("B")
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("w%d", numUpdates), str)
+	}
+}
+
+func TestPartitionScans(t *testing.T) {
+	tx := newTestTransaction(t, t.TempDir())
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	layout := record.NewLayoutFromSchema(schema)
+
+	// A table without blocks gets one scan, which finds nothing
+	scans, err := PartitionScans(tx, layout, "Parts", 4)
+	require.NoError(t, err)
+	require.Len(t, scans, 1)
+	hasNext, err := scans[0].Next()
+	require.NoError(t, err)
+	assert.False(t, hasNext)
+	scans[0].Close()
+
+	ts, err := NewTableScan(tx, layout, "Parts")
+	require.NoError(t, err)
+	for i := 0; i < 400; i++ {
+		require.NoError(t, ts.Insert())
+		require.NoError(t, ts.SetInt("A", i))
+	}
+	ts.Close()
+	numBlocks, err := tx.Size("Parts.tbl")
+	require.NoError(t, err)
+	require.Greater(t, numBlocks, 4)
+
+	for _, n := range []int{1, 3, 4, numBlocks + 5} {
+		scans, err := PartitionScans(tx, layout, "Parts", n)
+		require.NoError(t, err)
+		assert.Len(t, scans, min(n, numBlocks))
+
+		// Every record is read by exactly one scan, and BeforeFirst goes back to the start
+		// of the scan's range
+		seen := map[int]bool{}
+		for _, scan := range scans {
+			for pass := 0; pass < 2; pass++ {
+				require.NoError(t, scan.BeforeFirst())
+				count := 0
+				for {
+					hasNext, err := scan.Next()
+					require.NoError(t, err)
+					if !hasNext {
+						break
+					}
+					val, err := scan.GetInt("A")
+					require.NoError(t, err)
+					if pass == 0 {
+						assert.False(t, seen[val], "record %d read twice", val)
+						seen[val] = true
+					}
+					count++
+				}
+				assert.Positive(t, count)
+			}
+			scan.Close()
+		}
+		assert.Len(t, seen, 400)
+	}
+}
+
+func newTestTransaction(tb testing.TB, testDir string) *transaction.Transaction {
+	fileManager, err := file.NewManager(testDir, 400)
+	require.NoError(tb, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(tb, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(tb, err)
+	return transaction.NewTransaction(fileManager, logManager, bufferManager, transaction.NewLockTable())
+}
+
+// BenchmarkTableScanInsert compares inserting records silently and with a logger
+func BenchmarkTableScanInsert(b *testing.B) {
+	for _, logged := range []bool{false, true} {
+		name := "Quiet"
+		if logged {
+			name = "Logged"
+		}
+		b.Run(name, func(b *testing.B) {
+			tx := newTestTransaction(b, b.TempDir())
+			defer tx.Commit()
+
+			schema := record.NewSchema()
+			schema.AddIntField("A")
+			schema.AddStringField("B", 9)
+			ts, err := NewTableScan(tx, record.NewLayoutFromSchema(schema), "BenchTable")
+			require.NoError(b, err)
+			defer ts.Close()
+			if logged {
+				ts.SetLogger(stdlog.New(io.Discard, "", stdlog.LstdFlags))
+			}
+
+			i := 0
+			for b.Loop() {
+				if err := ts.Insert(); err != nil {
+					b.Fatal(err)
+				}
+				if err := ts.SetInt("A", i); err != nil {
+					b.Fatal(err)
+				}
+				if err := ts.SetString("B", strings.Repeat("x", i%9)); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+	}
+}
+
+// BenchmarkTableScanInsertFullBlocks inserts from the start of a table whose leading blocks
+// are full, so every insert skips past them to the block with room
+func BenchmarkTableScanInsertFullBlocks(b *testing.B) {
+	tx := newTestTransaction(b, b.TempDir())
+	defer tx.Commit()
+
+	schema := record.NewSchema()
+	schema.AddIntField("A")
+	layout := record.NewLayoutFromSchema(schema)
+	loader := NewBulkLoader(tx, layout, "BenchTable")
+	for i := 0; i < 100*((400-record.RecordHeaderSize)/layout.GetSlotSize()); i++ {
+		require.NoError(b, loader.Add([]any{i}))
+	}
+	require.NoError(b, loader.Flush())
+
+	ts, err := NewTableScan(tx, layout, "BenchTable")
+	require.NoError(b, err)
+	defer ts.Close()
+	i := 0
+	for b.Loop() {
+		if err := ts.BeforeFirst(); err != nil {
+			b.Fatal(err)
+		}
+		if err := ts.Insert(); err != nil {
+			b.Fatal(err)
+		}
+		if err := ts.SetInt("A", i); err != nil {
+			b.Fatal(err)
+		}
+		i++
+	}
+}
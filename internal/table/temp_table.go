@@ -0,0 +1,46 @@
+package table
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// nextTempTable numbers temp tables so that every one gets its own file.
+var nextTempTable atomic.Int64
+
+// TempTable is a table holding intermediate records of a query, e.g. the partitions of a
+// hash join. It isn't registered in the catalog, and its file is removed when the database
+// restarts.
+type TempTable struct {
+	tx     *transaction.Transaction
+	name   string
+	layout *record.Layout
+}
+
+// NewTempTable creates an empty temp table with the given schema.
+func NewTempTable(tx *transaction.Transaction, schema *record.Schema) *TempTable {
+	return &TempTable{
+		tx:     tx,
+		name:   fmt.Sprintf("%s%d", file.TempFilePrefix, nextTempTable.Add(1)),
+		layout: record.NewLayoutFromSchema(schema),
+	}
+}
+
+// Open opens a scan for reading and inserting the records of the temp table.
+func (tt *TempTable) Open() (*TableScan, error) {
+	return NewTableScan(tt.tx, tt.layout, tt.name)
+}
+
+// Name returns the name of the temp table.
+func (tt *TempTable) Name() string {
+	return tt.name
+}
+
+// Layout returns the layout of the temp table's records.
+func (tt *TempTable) Layout() *record.Layout {
+	return tt.layout
+}
@@ -0,0 +1,153 @@
+package table
+
+import (
+	"log"
+
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// Vacuum moves the records at the end of a table into the empty slots before them, so
+// that its records fill the first blocks of its file, and returns the number of records
+// moved. The table is locked exclusively first. moved is called for every record once it
+// is copied, with the scan positioned on the copy and before the original is deleted.
+// The blocks left empty at the end of the file are dropped once the transaction commits.
+func Vacuum(tx *transaction.Transaction, layout *record.Layout, tableName string, moved func(oldRID, newRID *record.RID, ts *TableScan) error) (int, error) {
+	fileName := tableName + ".tbl"
+	err := tx.XLockFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	numBlocks, err := tx.Size(fileName)
+	if err != nil {
+		return 0, err
+	}
+	if numBlocks == 0 {
+		return 0, nil
+	}
+
+	count, err := moveRecordsForward(tx, layout, tableName, numBlocks, moved)
+	if err != nil {
+		return 0, err
+	}
+	tx.OnEnd(func(allCommitted bool) {
+		// The moves may have been undone, and truncating can't be
+		if !allCommitted {
+			return
+		}
+		if err := truncateEmptyBlocks(tx, layout, fileName); err != nil {
+			log.Printf("[VACUUM] failed to truncate %s: %v", fileName, err)
+		}
+	})
+	return count, nil
+}
+
+// moveRecordsForward moves records, last one first, into the first empty slot of the
+// table until that slot is no longer before the record.
+func moveRecordsForward(tx *transaction.Transaction, layout *record.Layout, tableName string, numBlocks int, moved func(oldRID, newRID *record.RID, ts *TableScan) error) (int, error) {
+	dst, err := NewTableScan(tx, layout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	src, err := NewTableScan(tx, layout, tableName)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	fields := layout.GetSchema().Fields()
+	count := 0
+	for blockNum := numBlocks - 1; blockNum >= 0; blockNum-- {
+		slots, err := usedSlots(tx, layout, file.NewBlockID(tableName+".tbl", blockNum))
+		if err != nil {
+			return 0, err
+		}
+		for i := len(slots) - 1; i >= 0; i-- {
+			oldRID := record.NewRID(blockNum, slots[i])
+			err = dst.Insert()
+			if err != nil {
+				return 0, err
+			}
+			newRID, err := dst.GetRID()
+			if err != nil {
+				return 0, err
+			}
+			if newRID.Block() > oldRID.Block() || (newRID.Block() == oldRID.Block() && newRID.Slot() > oldRID.Slot()) {
+				// Every record before this one is already packed
+				return count, dst.Delete()
+			}
+
+			err = src.MoveToRID(oldRID)
+			if err != nil {
+				return 0, err
+			}
+			for _, fieldName := range fields {
+				val, err := src.GetValue(fieldName)
+				if err != nil {
+					return 0, err
+				}
+				err = dst.SetValue(fieldName, val)
+				if err != nil {
+					return 0, err
+				}
+			}
+			err = moved(oldRID, newRID, dst)
+			if err != nil {
+				return 0, err
+			}
+			err = src.Delete()
+			if err != nil {
+				return 0, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// usedSlots returns the slots of the block that hold a record, in order
+func usedSlots(tx *transaction.Transaction, layout *record.Layout, blk *file.BlockID) ([]int, error) {
+	rp, err := record.NewRecordPage(tx, blk, layout)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Unpin(blk)
+
+	slots := []int{}
+	slot := -1
+	for {
+		slot, err = rp.NextUsedSlot(slot)
+		if err != nil {
+			return nil, err
+		}
+		if slot < 0 {
+			return slots, nil
+		}
+		slots = append(slots, slot)
+	}
+}
+
+// truncateEmptyBlocks drops the blocks at the end of the table's file that hold no records
+func truncateEmptyBlocks(tx *transaction.Transaction, layout *record.Layout, fileName string) error {
+	numBlocks, err := tx.Size(fileName)
+	if err != nil {
+		return err
+	}
+	keep := numBlocks
+	for keep > 0 {
+		slots, err := usedSlots(tx, layout, file.NewBlockID(fileName, keep-1))
+		if err != nil {
+			return err
+		}
+		if len(slots) > 0 {
+			break
+		}
+		keep--
+	}
+	if keep == numBlocks {
+		return nil
+	}
+	return tx.Truncate(fileName, keep)
+}
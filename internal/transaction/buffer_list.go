@@ -1,13 +1,18 @@
 package transaction
 
 import (
+	"sync"
+
 	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
 )
 
+// BufferList holds the buffers a transaction has pinned. It may be used from several
+// goroutines at once, such as the workers of a parallel scan.
 type BufferList struct {
 	bufferManager *buffer.Manager
 
+	mu      sync.Mutex
 	buffers map[blockKey]*buffer.Buffer
 	pins    map[blockKey]int // Track pin count for each block
 }
@@ -21,6 +26,8 @@ func NewBufferList(bufferManager *buffer.Manager) *BufferList {
 }
 
 func (bl *BufferList) GetBuffer(blk *file.BlockID) *buffer.Buffer {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
 	return bl.buffers[makeKey(blk)]
 }
 
@@ -28,22 +35,39 @@ func (bl *BufferList) Pin(blk *file.BlockID) (*buffer.Buffer, error) {
 	key := makeKey(blk)
 
 	// If buffer is already pinned, just increment pin count
+	bl.mu.Lock()
 	if pinCount, exists := bl.pins[key]; exists {
 		bl.pins[key] = pinCount + 1
-		return bl.buffers[key], nil
+		buff := bl.buffers[key]
+		bl.mu.Unlock()
+		return buff, nil
 	}
+	bl.mu.Unlock()
 
-	// First time pinning this buffer
+	// First time pinning this buffer. The buffer manager may wait for a buffer to be
+	// unpinned, so the list isn't locked meanwhile
 	buff, err := bl.bufferManager.Pin(blk)
 	if err != nil {
 		return nil, err
 	}
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	if pinCount, exists := bl.pins[key]; exists {
+		// Another goroutine pinned the block in the meantime, so the list holds it already
+		bl.pins[key] = pinCount + 1
+		bl.bufferManager.Unpin(buff)
+		return bl.buffers[key], nil
+	}
 	bl.buffers[key] = buff
 	bl.pins[key] = 1
 	return buff, nil
 }
 
 func (bl *BufferList) Unpin(blk *file.BlockID) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
 	key := makeKey(blk)
 	if pinCount, exists := bl.pins[key]; exists {
 		bl.pins[key] = pinCount - 1
@@ -58,6 +82,9 @@ func (bl *BufferList) Unpin(blk *file.BlockID) {
 }
 
 func (bl *BufferList) UnpinAll() {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
 	for _, buff := range bl.buffers {
 		bl.bufferManager.Unpin(buff)
 	}
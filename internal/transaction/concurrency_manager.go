@@ -54,14 +54,9 @@ func (cm *ConcurrencyManager) xLock(block *file.BlockID) error {
 			return nil
 		}
 
-		// We have a shared lock
-		// Release the shared lock first, then acquire exclusive lock
-		err := cm.lockTable.unlock(block)
-		if err != nil {
-			return err
-		}
-
-		err = cm.lockTable.xLock(block)
+		// We have a shared lock, which is upgraded without releasing it
+		// so that no other writer can take the block in between
+		err := cm.lockTable.upgrade(block)
 		if err != nil {
 			return err
 		}
@@ -80,6 +75,25 @@ func (cm *ConcurrencyManager) xLock(block *file.BlockID) error {
 	return nil
 }
 
+// sUnlock releases a shared lock on the block before the transaction ends.
+// Exclusive locks are kept, since they protect uncommitted changes.
+func (cm *ConcurrencyManager) sUnlock(block *file.BlockID) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	key := makeKey(block)
+	if cm.locks[key] != "S" {
+		return nil
+	}
+
+	err := cm.lockTable.unlock(block)
+	if err != nil {
+		return err
+	}
+	delete(cm.locks, key)
+	return nil
+}
+
 func (cm *ConcurrencyManager) release() error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
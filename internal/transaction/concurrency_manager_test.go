@@ -34,7 +34,7 @@ func TestConcurrencyManager_LockingAndUpgrade(t *testing.T) {
 	}()
 
 	// Give cm2 time to start waiting
-	// Note: Since cm2 already has S lock, it will upgrade (unlock S, lock X)
+	// Note: Since cm2 already has S lock, it will upgrade it to X, keeping the S lock while waiting
 	// But cm1 still has S lock, so it should wait
 
 	// Release cm1's shared lock
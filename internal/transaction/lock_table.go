@@ -12,6 +12,8 @@ var ErrLockAbort = errors.New("lock abort")
 var ErrLockDoNotExist = errors.New("lock does not exist")
 
 const (
+	// MAX_WAITING_TIME is how long a lock table lets a transaction wait for a lock, unless
+	// set otherwise with SetMaxWaitingTime
 	MAX_WAITING_TIME = 10 * time.Second
 )
 
@@ -30,74 +32,83 @@ func makeKey(block *file.BlockID) blockKey {
 type LockTable struct {
 	locks   map[blockKey]int
 	mu      sync.Mutex
-	waiters map[blockKey]chan struct{} // Block-specific notification channels
+	waiters map[blockKey]chan struct{} // Block-specific notification channels, closed on unlock
+	// maxWaitingTime is how long a lock is waited for before giving up with ErrLockAbort
+	maxWaitingTime time.Duration
 }
 
 func NewLockTable() *LockTable {
 	return &LockTable{
-		locks:   make(map[blockKey]int),
-		waiters: make(map[blockKey]chan struct{}),
+		locks:          make(map[blockKey]int),
+		waiters:        make(map[blockKey]chan struct{}),
+		maxWaitingTime: MAX_WAITING_TIME,
 	}
 }
 
-func (lt *LockTable) sLock(block *file.BlockID) error {
-	key := makeKey(block)
-	deadline := time.Now().Add(MAX_WAITING_TIME)
-
-	for {
-		lt.mu.Lock()
-		// Check if there's an exclusive lock
-		if lt.locks[key] != -1 {
-			// No exclusive lock, we can acquire shared lock
-			lt.locks[key]++
-			lt.mu.Unlock()
-			return nil
-		}
+// SetMaxWaitingTime sets how long a lock is waited for before giving up with ErrLockAbort.
+// There is no deadlock detection, so a deadlock lasts until one of its waits gives up.
+// It is set before the table is used.
+func (lt *LockTable) SetMaxWaitingTime(maxWaitingTime time.Duration) {
+	lt.maxWaitingTime = maxWaitingTime
+}
 
-		// There's an exclusive lock, need to wait
-		if lt.waiters[key] == nil {
-			lt.waiters[key] = make(chan struct{}, 1)
+func (lt *LockTable) sLock(block *file.BlockID) error {
+	return lt.lock(block, func(locks int) (int, bool) {
+		// Any number of shared locks can be held, as long as there is no exclusive lock
+		if locks == -1 {
+			return locks, false
 		}
-		waiter := lt.waiters[key]
-		lt.mu.Unlock()
+		return locks + 1, true
+	})
+}
 
-		timeout := time.Until(deadline)
-		if timeout <= 0 {
-			return ErrLockAbort
+func (lt *LockTable) xLock(block *file.BlockID) error {
+	return lt.lock(block, func(locks int) (int, bool) {
+		// An exclusive lock needs the block to be free of any lock
+		if locks != 0 {
+			return locks, false
 		}
-		timer := time.NewTimer(timeout)
+		return -1, true
+	})
+}
 
-		select {
-		case <-waiter:
-			timer.Stop()
-		case <-timer.C:
-			return ErrLockAbort
+// upgrade turns a shared lock the caller holds on the block into an exclusive lock. The
+// shared lock is kept while waiting for the other shared locks to be released, so no other
+// writer can lock the block in between. If the wait times out, the shared lock is still held.
+func (lt *LockTable) upgrade(block *file.BlockID) error {
+	return lt.lock(block, func(locks int) (int, bool) {
+		// The caller's own shared lock must be the only lock left
+		if locks != 1 {
+			return locks, false
 		}
-	}
+		return -1, true
+	})
 }
 
-func (lt *LockTable) xLock(block *file.BlockID) error {
+// lock waits until grant allows the lock given the block's current locks (-1 for an exclusive
+// lock, otherwise the number of shared locks), and sets the locks grant returns. It gives up
+// with ErrLockAbort after the table's maximum waiting time.
+func (lt *LockTable) lock(block *file.BlockID, grant func(locks int) (int, bool)) error {
 	key := makeKey(block)
-	deadline := time.Now().Add(MAX_WAITING_TIME)
+	deadline := time.Now().Add(lt.maxWaitingTime)
 
 	for {
 		lt.mu.Lock()
-		// Check if there are any locks (shared or exclusive locks)
-		if lt.locks[key] == 0 {
-			// No locks, we can acquire exclusive lock
-			lt.locks[key] = -1
+		if locks, ok := grant(lt.locks[key]); ok {
+			lt.locks[key] = locks
 			lt.mu.Unlock()
 			return nil
 		}
 
 		if lt.waiters[key] == nil {
-			lt.waiters[key] = make(chan struct{}, 1)
+			lt.waiters[key] = make(chan struct{})
 		}
 		waiter := lt.waiters[key]
 		lt.mu.Unlock()
 
 		timeout := time.Until(deadline)
 		if timeout <= 0 {
+			txLockAborts.Add(1)
 			return ErrLockAbort
 		}
 		timer := time.NewTimer(timeout)
@@ -106,6 +117,7 @@ func (lt *LockTable) xLock(block *file.BlockID) error {
 		case <-waiter:
 			timer.Stop()
 		case <-timer.C:
+			txLockAborts.Add(1)
 			return ErrLockAbort
 		}
 	}
@@ -128,18 +140,16 @@ func (lt *LockTable) unlock(block *file.BlockID) error {
 		lt.locks[key]--
 		if lt.locks[key] == 0 {
 			delete(lt.locks, key)
-		} else {
 		}
 	} else {
 		return ErrLockDoNotExist
 	}
 
-	// Notify waiting goroutines for this specific block
+	// Wake every goroutine waiting on this block; each one re-checks the lock
+	// state, so several shared lockers can proceed after a single unlock.
 	if waiter, exists := lt.waiters[key]; exists {
-		select {
-		case waiter <- struct{}{}:
-		default:
-		}
+		close(waiter)
+		delete(lt.waiters, key)
 	}
 
 	return nil
@@ -18,6 +18,11 @@ const (
 	LogRecordRollback   LogRecordType = 3
 	LogRecordSetInt     LogRecordType = 4
 	LogRecordSetString  LogRecordType = 5
+	LogRecordSavepoint  LogRecordType = 6
+	LogRecordNewBlock   LogRecordType = 7
+	LogRecordSetBytes   LogRecordType = 8
+	LogRecordCLR        LogRecordType = 9
+	LogRecordSetLong    LogRecordType = 10
 )
 
 // LogRecord interface
@@ -27,6 +32,14 @@ type LogRecord interface {
 	Undo(tx *Transaction) error
 }
 
+// updateRecord is a log record of a change to a block, whose undo is compensated by a CLR
+type updateRecord interface {
+	LogRecord
+	Block() *file.BlockID
+	// undoOnPage undoes the change in a copy of the block, without the transaction
+	undoOnPage(page *file.Page)
+}
+
 // CreateLogRecord returns the correct LogRecord based on the operation type
 func CreateLogRecord(bytes []byte) LogRecord {
 	page := file.NewPageFromBytes(bytes)
@@ -46,6 +59,16 @@ func CreateLogRecord(bytes []byte) LogRecord {
 		return NewSetIntLogRecord(page)
 	case LogRecordSetString:
 		return NewSetStringLogRecord(page)
+	case LogRecordSavepoint:
+		return NewSavepointLogRecord(page)
+	case LogRecordNewBlock:
+		return NewNewBlockLogRecord(page)
+	case LogRecordSetBytes:
+		return NewSetBytesLogRecord(page)
+	case LogRecordCLR:
+		return NewCLRLogRecord(page)
+	case LogRecordSetLong:
+		return NewSetLongLogRecord(page)
 	default:
 		panic("invalid operation type")
 	}
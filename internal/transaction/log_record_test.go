@@ -5,6 +5,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
 	"github.com/yashagw/cranedb/internal/log"
 )
@@ -54,6 +55,34 @@ func TestSetIntLogRecord_EncodeDecode(t *testing.T) {
 	assert.Equal(t, LogRecordSetInt, decodedRecord.Op())
 }
 
+func TestSetLongLogRecord_EncodeDecode(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager, err := file.NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "log_test")
+	assert.NoError(t, err)
+
+	blockID := file.NewBlockID("test_file", 5)
+	oldValue := int64(-9000000000)
+
+	_, err = WriteSetLongLogRecord(logManager, 42, blockID, 100, oldValue)
+	assert.NoError(t, err)
+
+	iterator, err := logManager.Iterator()
+	assert.NoError(t, err)
+	require.True(t, iterator.HasNext())
+	record := CreateLogRecord(iterator.Next())
+
+	decodedRecord, ok := record.(*SetLongLogRecord)
+	require.True(t, ok, "expected a SetLongLogRecord, got %T", record)
+	assert.Equal(t, 42, decodedRecord.TxNumber())
+	assert.Equal(t, 100, decodedRecord.offset)
+	assert.Equal(t, oldValue, decodedRecord.oldValue)
+	assert.Equal(t, "test_file", decodedRecord.Block().Filename())
+	assert.Equal(t, 5, decodedRecord.Block().Number())
+	assert.Equal(t, LogRecordSetLong, decodedRecord.Op())
+}
+
 func TestSetStringLogRecord_EncodeDecode(t *testing.T) {
 	tempDir := t.TempDir()
 	fileManager, err := file.NewManager(tempDir, 400)
@@ -208,7 +237,12 @@ func TestCheckpointLogRecord_EncodeDecode(t *testing.T) {
 	logManager, err := log.NewManager(fileManager, "log_test")
 	assert.NoError(t, err)
 
-	_, err = WriteCheckpointLogRecord(logManager)
+	activeTXs := map[int]int{3: 120, 5: 240}
+	dirtyPages := []buffer.DirtyPage{
+		{Block: file.NewBlockID("users.tbl", 2), RecLSN: 100},
+		{Block: file.NewBlockID("users_id.idx", 0), RecLSN: 260},
+	}
+	_, err = WriteCheckpointLogRecord(logManager, 300, activeTXs, dirtyPages)
 	assert.NoError(t, err)
 
 	// Get the last log record
@@ -231,4 +265,176 @@ func TestCheckpointLogRecord_EncodeDecode(t *testing.T) {
 	// Verify the decoded record matches the original
 	assert.Equal(t, -1, decodedRecord.TxNumber(), "Transaction number mismatch")
 	assert.Equal(t, LogRecordCheckpoint, decodedRecord.Op())
+	assert.Equal(t, 300, decodedRecord.BeginLSN())
+	assert.Equal(t, 0, decodedRecord.Part())
+	assert.Equal(t, 1, decodedRecord.NumParts())
+	assert.Equal(t, activeTXs, decodedRecord.ActiveTXs())
+	assert.Equal(t, dirtyPages, decodedRecord.DirtyPages())
+
+	// Tables too large for one log record are split over several
+	dirtyPages = []buffer.DirtyPage{}
+	for i := range 40 {
+		dirtyPages = append(dirtyPages, buffer.DirtyPage{Block: file.NewBlockID("users.tbl", i), RecLSN: 500 + i})
+	}
+	_, err = WriteCheckpointLogRecord(logManager, 700, activeTXs, dirtyPages)
+	assert.NoError(t, err)
+
+	iterator, err = logManager.Iterator()
+	assert.NoError(t, err)
+	decodedPages := []buffer.DirtyPage{}
+	numParts := 0
+	for iterator.HasNext() {
+		part := CreateLogRecord(iterator.Next()).(*CheckpointLogRecord)
+		if part.BeginLSN() != 700 {
+			break
+		}
+		numParts++
+		assert.Equal(t, numParts, part.NumParts()-part.Part(), "Parts are written in order")
+		decodedPages = append(part.DirtyPages(), decodedPages...)
+	}
+	assert.Greater(t, numParts, 1)
+	assert.Equal(t, dirtyPages, decodedPages)
+}
+
+func TestSavepointLogRecord_EncodeDecode(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager, err := file.NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "log_test")
+	assert.NoError(t, err)
+
+	txNum := 42
+	savepointID := 3
+
+	_, err = WriteSavepointLogRecord(logManager, txNum, savepointID)
+	assert.NoError(t, err)
+
+	// Get the last log record
+	iterator, err := logManager.Iterator()
+	assert.NoError(t, err)
+	var lastRecord []byte
+	for iterator.HasNext() {
+		lastRecord = iterator.Next()
+	}
+
+	// Make sure we got a record
+	require.NotNil(t, lastRecord, "No log record was written")
+
+	// Decode the log record through the generic constructor
+	decodedRecord, ok := CreateLogRecord(lastRecord).(*SavepointLogRecord)
+	require.True(t, ok)
+
+	// Verify the decoded record matches the original
+	assert.Equal(t, txNum, decodedRecord.TxNumber(), "Transaction number mismatch")
+	assert.Equal(t, savepointID, decodedRecord.SavepointID(), "Savepoint id mismatch")
+	assert.Equal(t, LogRecordSavepoint, decodedRecord.Op())
+}
+
+func TestNewBlockLogRecord_EncodeDecode(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager, err := file.NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "log_test")
+	assert.NoError(t, err)
+
+	txNum := 42
+	slotSize := 21
+	blockID := file.NewBlockID("test_file", 7)
+
+	_, err = WriteNewBlockLogRecord(logManager, txNum, blockID, slotSize)
+	assert.NoError(t, err)
+
+	// Get the last log record
+	iterator, err := logManager.Iterator()
+	assert.NoError(t, err)
+	var lastRecord []byte
+	for iterator.HasNext() {
+		lastRecord = iterator.Next()
+	}
+
+	// Make sure we got a record
+	require.NotNil(t, lastRecord, "No log record was written")
+
+	// Decode the log record through the generic constructor
+	decodedRecord, ok := CreateLogRecord(lastRecord).(*NewBlockLogRecord)
+	require.True(t, ok)
+
+	// Verify the decoded record matches the original
+	assert.Equal(t, txNum, decodedRecord.TxNumber(), "Transaction number mismatch")
+	assert.Equal(t, slotSize, decodedRecord.slotSize, "Slot size mismatch")
+	assert.Equal(t, "test_file", decodedRecord.block.Filename(), "Filename mismatch")
+	assert.Equal(t, 7, decodedRecord.block.Number(), "Block number mismatch")
+	assert.Equal(t, LogRecordNewBlock, decodedRecord.Op())
+}
+
+func TestSetBytesLogRecord_EncodeDecode(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager, err := file.NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "log_test")
+	assert.NoError(t, err)
+
+	txNum := 42
+	offset := 300
+	oldBytes := []byte{0, 0, 0, 3, 'a', 'b', 'c', 0xff}
+	blockID := file.NewBlockID("test_file", 5)
+
+	_, err = WriteSetBytesLogRecord(logManager, txNum, blockID, offset, oldBytes)
+	assert.NoError(t, err)
+
+	// Get the last log record
+	iterator, err := logManager.Iterator()
+	assert.NoError(t, err)
+	var lastRecord []byte
+	for iterator.HasNext() {
+		lastRecord = iterator.Next()
+	}
+
+	// Make sure we got a record
+	require.NotNil(t, lastRecord, "No log record was written")
+
+	// Decode the log record through the generic constructor
+	decodedRecord, ok := CreateLogRecord(lastRecord).(*SetBytesLogRecord)
+	require.True(t, ok)
+
+	// Verify the decoded record matches the original
+	assert.Equal(t, txNum, decodedRecord.TxNumber(), "Transaction number mismatch")
+	assert.Equal(t, offset, decodedRecord.offset, "Offset mismatch")
+	assert.Equal(t, oldBytes, decodedRecord.oldBytes, "Bytes mismatch")
+	assert.Equal(t, "test_file", decodedRecord.block.Filename(), "Filename mismatch")
+	assert.Equal(t, 5, decodedRecord.block.Number(), "Block number mismatch")
+	assert.Equal(t, LogRecordSetBytes, decodedRecord.Op())
+}
+
+func TestCLRLogRecord_EncodeDecode(t *testing.T) {
+	tempDir := t.TempDir()
+	fileManager, err := file.NewManager(tempDir, 400)
+	assert.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "log_test")
+	assert.NoError(t, err)
+
+	// The CLR carries the encoded SetInt record it compensates
+	undoneLSN, err := WriteSetIntLogRecord(logManager, 42, file.NewBlockID("test_file", 5), 100, 12345)
+	assert.NoError(t, err)
+	iterator, err := logManager.Iterator()
+	assert.NoError(t, err)
+	undone := iterator.Next()
+
+	clrLSN, err := WriteCLRLogRecord(logManager, 42, undoneLSN-1, undone)
+	assert.NoError(t, err)
+	assert.Greater(t, clrLSN, undoneLSN)
+
+	iterator, err = logManager.Iterator()
+	assert.NoError(t, err)
+	decodedRecord, ok := CreateLogRecord(iterator.Next()).(*CLRLogRecord)
+	require.True(t, ok)
+	assert.Equal(t, clrLSN, iterator.LSN())
+
+	assert.Equal(t, 42, decodedRecord.TxNumber(), "Transaction number mismatch")
+	assert.Equal(t, undoneLSN-1, decodedRecord.UndoNextLSN(), "Undo next LSN mismatch")
+	assert.Equal(t, LogRecordCLR, decodedRecord.Op())
+	setInt, ok := decodedRecord.Undone().(*SetIntLogRecord)
+	require.True(t, ok)
+	assert.Equal(t, 100, setInt.offset)
+	assert.Equal(t, 12345, setInt.oldValue)
 }
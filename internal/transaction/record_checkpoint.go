@@ -1,18 +1,64 @@
 package transaction
 
 import (
+	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
 	"github.com/yashagw/cranedb/internal/log"
 )
 
+// checkpointHeaderSize is the size of a CheckpointLogRecord without any table entries
+const checkpointHeaderSize = 24
+
+// CheckpointLogRecord holds the transaction table and the dirty page table as they were
+// when the LSN of the latest log record was beginLSN, so that recovery can start from them
+// instead of reading the log written before. Running transactions aren't waited for.
+// Tables that don't fit in one log record are split over several, written one after another;
+// a checkpoint counts only once its last part is in the log.
 type CheckpointLogRecord struct {
 	LogRecord
+	beginLSN   int
+	part       int
+	numParts   int
+	activeTXs  map[int]int
+	dirtyPages []buffer.DirtyPage
 }
 
-// NewCheckpointLogRecord creates a new StartLogRecord
-// Page format: [op(4)]
+// NewCheckpointLogRecord creates a new CheckpointLogRecord
+// Page format: [op(4)] [beginLSN(4)] [part(4)] [numParts(4)]
+// [numTXs(4)] [txNum(4) startLSN(4)]... [numPages(4)] [filename(4+len) blockNum(4) recLSN(4)]...
 func NewCheckpointLogRecord(page *file.Page) *CheckpointLogRecord {
-	return &CheckpointLogRecord{}
+	opPos := 0
+	beginLSNPos := opPos + LogRecordTypeSize()
+	partPos := beginLSNPos + 4
+	numPartsPos := partPos + 4
+
+	pos := numPartsPos + 4
+	numTXs := page.GetInt(pos)
+	pos += 4
+	activeTXs := map[int]int{}
+	for range numTXs {
+		activeTXs[page.GetInt(pos)] = page.GetInt(pos + 4)
+		pos += 8
+	}
+
+	numPages := page.GetInt(pos)
+	pos += 4
+	dirtyPages := []buffer.DirtyPage{}
+	for range numPages {
+		fileName := page.GetString(pos)
+		pos += 4 + len(fileName)
+		blk := file.NewBlockID(fileName, page.GetInt(pos))
+		dirtyPages = append(dirtyPages, buffer.DirtyPage{Block: blk, RecLSN: page.GetInt(pos + 4)})
+		pos += 8
+	}
+
+	return &CheckpointLogRecord{
+		beginLSN:   page.GetInt(beginLSNPos),
+		part:       page.GetInt(partPos),
+		numParts:   page.GetInt(numPartsPos),
+		activeTXs:  activeTXs,
+		dirtyPages: dirtyPages,
+	}
 }
 
 // Op returns the operation type for this log record
@@ -26,19 +72,104 @@ func (s *CheckpointLogRecord) TxNumber() int {
 	return -1
 }
 
+// BeginLSN returns the LSN of the latest log record when the tables were taken
+func (s *CheckpointLogRecord) BeginLSN() int {
+	return s.beginLSN
+}
+
+// Part returns the position of this record among the parts of the checkpoint, from 0
+func (s *CheckpointLogRecord) Part() int {
+	return s.part
+}
+
+// NumParts returns the number of records the checkpoint is split over
+func (s *CheckpointLogRecord) NumParts() int {
+	return s.numParts
+}
+
+// ActiveTXs returns the running transactions held by this part, each with the LSN
+// its log records come after
+func (s *CheckpointLogRecord) ActiveTXs() map[int]int {
+	return s.activeTXs
+}
+
+// DirtyPages returns the dirty pages held by this part
+func (s *CheckpointLogRecord) DirtyPages() []buffer.DirtyPage {
+	return s.dirtyPages
+}
+
 // Undo performs the undo operation for this log record
 func (s *CheckpointLogRecord) Undo(tx *Transaction) error {
 	// No need to undo anything for Checkpoint Record
 	return nil
 }
 
-// WriteCheckpointLogRecord writes a CheckpointLogRecord to the log manager
-func WriteCheckpointLogRecord(lm *log.Manager) (int, error) {
-	opPos := 0
-	finalLen := opPos + LogRecordTypeSize()
+// WriteCheckpointLogRecord writes the tables of a checkpoint to the log manager, in as many
+// CheckpointLogRecords as they need, and returns the LSN of the last one.
+func WriteCheckpointLogRecord(lm *log.Manager, beginLSN int, activeTXs map[int]int, dirtyPages []buffer.DirtyPage) (int, error) {
+	type checkpointPart struct {
+		txNums []int
+		pages  []buffer.DirtyPage
+	}
+	parts := []checkpointPart{{}}
+	size := checkpointHeaderSize
+	// fit starts a new part unless an entry of the given size fits in the current one
+	fit := func(entrySize int) {
+		if size+entrySize > lm.MaxRecordSize() {
+			parts = append(parts, checkpointPart{})
+			size = checkpointHeaderSize
+		}
+		size += entrySize
+	}
+	for txNum := range activeTXs {
+		fit(8)
+		parts[len(parts)-1].txNums = append(parts[len(parts)-1].txNums, txNum)
+	}
+	for _, page := range dirtyPages {
+		fit(12 + len(page.Block.Filename()))
+		parts[len(parts)-1].pages = append(parts[len(parts)-1].pages, page)
+	}
+
+	lsn := -1
+	for i, part := range parts {
+		opPos := 0
+		beginLSNPos := opPos + LogRecordTypeSize()
+		partPos := beginLSNPos + 4
+		numPartsPos := partPos + 4
+		finalLen := checkpointHeaderSize + 8*len(part.txNums)
+		for _, page := range part.pages {
+			finalLen += 12 + len(page.Block.Filename())
+		}
+
+		page := file.NewPage(finalLen)
+		page.SetInt(opPos, int(LogRecordCheckpoint))
+		page.SetInt(beginLSNPos, beginLSN)
+		page.SetInt(partPos, i)
+		page.SetInt(numPartsPos, len(parts))
 
-	page := file.NewPage(finalLen)
-	page.SetInt(opPos, int(LogRecordCheckpoint))
+		pos := numPartsPos + 4
+		page.SetInt(pos, len(part.txNums))
+		pos += 4
+		for _, txNum := range part.txNums {
+			page.SetInt(pos, txNum)
+			page.SetInt(pos+4, activeTXs[txNum])
+			pos += 8
+		}
+		page.SetInt(pos, len(part.pages))
+		pos += 4
+		for _, dirty := range part.pages {
+			page.SetString(pos, dirty.Block.Filename())
+			pos += 4 + len(dirty.Block.Filename())
+			page.SetInt(pos, dirty.Block.Number())
+			page.SetInt(pos+4, dirty.RecLSN)
+			pos += 8
+		}
 
-	return lm.Append(page.Bytes())
+		var err error
+		lsn, err = lm.Append(page.Bytes())
+		if err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
 }
@@ -0,0 +1,90 @@
+package transaction
+
+import (
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+// CLRLogRecord is a compensation log record, written for every update record that a
+// rollback or recovery undoes. It carries the undone record, whose undo is redone if
+// the change it made didn't reach the disk before a crash, and undoNextLSN: the records
+// of the transaction with a greater LSN than it are undone, so undoing carries on from
+// there. A CLR is never undone itself.
+type CLRLogRecord struct {
+	LogRecord
+	txNum       int
+	undoNextLSN int
+	undone      []byte
+}
+
+// NewCLRLogRecord creates a new CLRLogRecord
+// Page format: [op(4)] [txNum(4)] [undoNextLSN(4)] [undone record(4+len(record))]
+func NewCLRLogRecord(page *file.Page) *CLRLogRecord {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	txNum := page.GetInt(txNumPos)
+
+	undoNextPos := txNumPos + 4
+	undoNextLSN := page.GetInt(undoNextPos)
+
+	undonePos := undoNextPos + 4
+	undone := append([]byte{}, page.GetBytesArray(undonePos)...)
+
+	return &CLRLogRecord{
+		txNum:       txNum,
+		undoNextLSN: undoNextLSN,
+		undone:      undone,
+	}
+}
+
+// Op returns the operation type for this log record
+func (c *CLRLogRecord) Op() LogRecordType {
+	return LogRecordCLR
+}
+
+// TxNumber returns the transaction number associated with this log record
+func (c *CLRLogRecord) TxNumber() int {
+	return c.txNum
+}
+
+// UndoNextLSN returns the LSN up to which the transaction's records remain to be undone
+func (c *CLRLogRecord) UndoNextLSN() int {
+	return c.undoNextLSN
+}
+
+// Undone returns the log record whose undo this record compensates
+func (c *CLRLogRecord) Undone() LogRecord {
+	return CreateLogRecord(c.undone)
+}
+
+// block returns the block changed by the compensation
+func (c *CLRLogRecord) block() *file.BlockID {
+	return c.Undone().(updateRecord).Block()
+}
+
+// Undo does nothing, since compensation is never undone
+func (c *CLRLogRecord) Undo(tx *Transaction) error {
+	return nil
+}
+
+// Redo applies the undo of the compensated record again
+func (c *CLRLogRecord) Redo(tx *Transaction) error {
+	return c.Undone().Undo(tx)
+}
+
+// WriteCLRLogRecord writes a CLRLogRecord compensating the given log record to the log manager
+func WriteCLRLogRecord(lm *log.Manager, txNum int, undoNextLSN int, undone []byte) (int, error) {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	undoNextPos := txNumPos + 4
+	undonePos := undoNextPos + 4
+	finalLen := undonePos + 4 + len(undone)
+
+	page := file.NewPage(finalLen)
+	page.SetInt(opPos, int(LogRecordCLR))
+	page.SetInt(txNumPos, txNum)
+	page.SetInt(undoNextPos, undoNextLSN)
+	page.SetBytesArray(undonePos, undone)
+
+	return lm.Append(page.Bytes())
+}
@@ -0,0 +1,98 @@
+package transaction
+
+import (
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+// NewBlockLogRecord stands for all the values a transaction wrote into a block it
+// appended, instead of one record per value. Undoing it sets the int at the start of
+// every slot of the block back to zero, which marks the slots of a record page empty.
+type NewBlockLogRecord struct {
+	LogRecord
+	txNum    int
+	slotSize int
+	block    *file.BlockID
+}
+
+// NewNewBlockLogRecord creates a new NewBlockLogRecord
+// Page format: [op(4)] [txNum(4)] [filename(4+len(filename))] [blockNum(4)] [slotSize(4)]
+func NewNewBlockLogRecord(page *file.Page) *NewBlockLogRecord {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	txNum := page.GetInt(txNumPos)
+
+	fileNamePos := txNumPos + 4
+	fileName := page.GetString(fileNamePos)
+
+	blockNumPos := fileNamePos + 4 + len(fileName)
+	blockNum := page.GetInt(blockNumPos)
+
+	slotSizePos := blockNumPos + 4
+	slotSize := page.GetInt(slotSizePos)
+
+	return &NewBlockLogRecord{
+		txNum:    txNum,
+		slotSize: slotSize,
+		block:    file.NewBlockID(fileName, blockNum),
+	}
+}
+
+// Op returns the operation type for this log record
+func (n *NewBlockLogRecord) Op() LogRecordType {
+	return LogRecordNewBlock
+}
+
+// TxNumber returns the transaction number associated with this log record
+func (n *NewBlockLogRecord) TxNumber() int {
+	return n.txNum
+}
+
+// Block returns the block changed by the operation
+func (n *NewBlockLogRecord) Block() *file.BlockID {
+	return n.block
+}
+
+// Undo performs the undo operation for this log record
+func (n *NewBlockLogRecord) Undo(tx *Transaction) error {
+	_, err := tx.Pin(n.block)
+	if err != nil {
+		return err
+	}
+	defer tx.Unpin(n.block)
+
+	// log=false because we don't want to log the undo operation itself
+	for offset := 0; offset+n.slotSize <= tx.BlockSize(); offset += n.slotSize {
+		err = tx.SetInt(n.block, offset, 0, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoOnPage marks every slot empty in a copy of the block
+func (n *NewBlockLogRecord) undoOnPage(page *file.Page) {
+	for offset := 0; offset+n.slotSize <= len(page.Bytes()); offset += n.slotSize {
+		page.SetInt(offset, 0)
+	}
+}
+
+// WriteNewBlockLogRecord writes a NewBlockLogRecord to the log manager
+func WriteNewBlockLogRecord(lm *log.Manager, txNum int, blk *file.BlockID, slotSize int) (int, error) {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	fileNamePos := txNumPos + 4
+	blockNumPos := fileNamePos + 4 + len(blk.Filename())
+	slotSizePos := blockNumPos + 4
+	finalLen := slotSizePos + 4
+
+	page := file.NewPage(finalLen)
+	page.SetInt(opPos, int(LogRecordNewBlock))
+	page.SetInt(txNumPos, txNum)
+	page.SetString(fileNamePos, blk.Filename())
+	page.SetInt(blockNumPos, blk.Number())
+	page.SetInt(slotSizePos, slotSize)
+
+	return lm.Append(page.Bytes())
+}
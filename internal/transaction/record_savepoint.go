@@ -0,0 +1,63 @@
+package transaction
+
+import (
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+type SavepointLogRecord struct {
+	LogRecord
+	txNum       int
+	savepointID int
+}
+
+// NewSavepointLogRecord creates a new SavepointLogRecord
+// Page format: [op(4)] [txNum(4)] [savepointID(4)]
+func NewSavepointLogRecord(page *file.Page) *SavepointLogRecord {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	txNum := page.GetInt(txNumPos)
+	savepointPos := txNumPos + 4
+	savepointID := page.GetInt(savepointPos)
+
+	return &SavepointLogRecord{
+		txNum:       txNum,
+		savepointID: savepointID,
+	}
+}
+
+// Op returns the operation type for this log record
+func (s *SavepointLogRecord) Op() LogRecordType {
+	return LogRecordSavepoint
+}
+
+// TxNumber returns the transaction number associated with this log record
+func (s *SavepointLogRecord) TxNumber() int {
+	return s.txNum
+}
+
+// SavepointID returns the savepoint marked by this log record
+func (s *SavepointLogRecord) SavepointID() int {
+	return s.savepointID
+}
+
+// Undo performs the undo operation for this log record
+func (s *SavepointLogRecord) Undo(tx *Transaction) error {
+	// No need to undo anything for Savepoint Record
+	return nil
+}
+
+// WriteSavepointLogRecord writes a SavepointLogRecord to the log manager
+func WriteSavepointLogRecord(lm *log.Manager, txNum int, savepointID int) (int, error) {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	savepointPos := txNumPos + 4
+	finalLen := savepointPos + 4
+
+	page := file.NewPage(finalLen)
+	page.SetInt(opPos, int(LogRecordSavepoint))
+	page.SetInt(txNumPos, txNum)
+	page.SetInt(savepointPos, savepointID)
+
+	return lm.Append(page.Bytes())
+}
@@ -0,0 +1,97 @@
+package transaction
+
+import (
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+// SetBytesLogRecord holds the bytes of a block region before a transaction overwrote
+// them with SetBytes. Unlike the old value of a SetString, the region doesn't need to
+// hold a well-formed value.
+type SetBytesLogRecord struct {
+	LogRecord
+	txNum    int
+	offset   int
+	oldBytes []byte
+	block    *file.BlockID
+}
+
+// NewSetBytesLogRecord creates a new SetBytesLogRecord
+// Page format: [op(4)] [txNum(4)] [filename(4+len(filename))] [blockNum(4)] [offset(4)] [oldbytes(4+len(oldbytes))]
+func NewSetBytesLogRecord(page *file.Page) *SetBytesLogRecord {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	txNum := page.GetInt(txNumPos)
+
+	fileNamePos := txNumPos + 4
+	fileName := page.GetString(fileNamePos)
+
+	blockNumPos := fileNamePos + 4 + len(fileName)
+	blockNum := page.GetInt(blockNumPos)
+
+	offsetPos := blockNumPos + 4
+	offset := page.GetInt(offsetPos)
+
+	oldBytesPos := offsetPos + 4
+	oldBytes := append([]byte{}, page.GetBytesArray(oldBytesPos)...)
+
+	return &SetBytesLogRecord{
+		txNum:    txNum,
+		offset:   offset,
+		oldBytes: oldBytes,
+		block:    file.NewBlockID(fileName, blockNum),
+	}
+}
+
+// Op returns the operation type for this log record
+func (s *SetBytesLogRecord) Op() LogRecordType {
+	return LogRecordSetBytes
+}
+
+// TxNumber returns the transaction number associated with this log record
+func (s *SetBytesLogRecord) TxNumber() int {
+	return s.txNum
+}
+
+// Block returns the block changed by the operation
+func (s *SetBytesLogRecord) Block() *file.BlockID {
+	return s.block
+}
+
+// Undo performs the undo operation for this log record
+func (s *SetBytesLogRecord) Undo(tx *Transaction) error {
+	_, err := tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	defer tx.Unpin(s.block)
+
+	// log=false because we don't want to log the undo operation itself
+	return tx.SetBytes(s.block, s.offset, s.oldBytes, false)
+}
+
+// undoOnPage restores the old bytes in a copy of the block
+func (s *SetBytesLogRecord) undoOnPage(page *file.Page) {
+	copy(page.Bytes()[s.offset:], s.oldBytes)
+}
+
+// WriteSetBytesLogRecord writes a SetBytesLogRecord to the log manager
+func WriteSetBytesLogRecord(lm *log.Manager, txNum int, blk *file.BlockID, offset int, oldBytes []byte) (int, error) {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	fileNamePos := txNumPos + 4
+	blockNumPos := fileNamePos + 4 + len(blk.Filename())
+	offsetPos := blockNumPos + 4
+	oldBytesPos := offsetPos + 4
+	finalLen := oldBytesPos + 4 + len(oldBytes)
+
+	page := file.NewPage(finalLen)
+	page.SetInt(opPos, int(LogRecordSetBytes))
+	page.SetInt(txNumPos, txNum)
+	page.SetString(fileNamePos, blk.Filename())
+	page.SetInt(blockNumPos, blk.Number())
+	page.SetInt(offsetPos, offset)
+	page.SetBytesArray(oldBytesPos, oldBytes)
+
+	return lm.Append(page.Bytes())
+}
@@ -52,13 +52,31 @@ func (s *SetIntLogRecord) TxNumber() int {
 	return s.txNum
 }
 
+// Block returns the block changed by the operation
+func (s *SetIntLogRecord) Block() *file.BlockID {
+	return s.block
+}
+
 // Undo performs the undo operation for this log record
 func (s *SetIntLogRecord) Undo(tx *Transaction) error {
+	// The buffer may already have been unpinned by the time we undo,
+	// so pin the block for the duration of the restore.
+	_, err := tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	defer tx.Unpin(s.block)
+
 	// Restore the old value at the specified offset in the block
 	// log=false because we don't want to log the undo operation itself
 	return tx.SetInt(s.block, s.offset, s.oldValue, false)
 }
 
+// undoOnPage restores the old value in a copy of the block
+func (s *SetIntLogRecord) undoOnPage(page *file.Page) {
+	page.SetInt(s.offset, s.oldValue)
+}
+
 // WriteSetIntLogRecord writes a SetIntLogRecord to the log manager
 func WriteSetIntLogRecord(lm *log.Manager, txNum int, blk *file.BlockID, offset int, oldValue int) (int, error) {
 	opPos := 0
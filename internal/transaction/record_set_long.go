@@ -0,0 +1,99 @@
+package transaction
+
+import (
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+type SetLongLogRecord struct {
+	LogRecord
+	txNum    int
+	offset   int
+	oldValue int64
+	block    *file.BlockID
+}
+
+// NewSetLongLogRecord creates a new SetLongLogRecord
+// Page format: [op(4)] [txNum(4)] [filename(4+len(filename))] [blockNum(4)] [offset(4)] [oldvalue(8)]
+func NewSetLongLogRecord(page *file.Page) *SetLongLogRecord {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	txNum := page.GetInt(txNumPos)
+
+	fileNamePos := txNumPos + 4
+	fileName := page.GetString(fileNamePos)
+
+	blockNumPos := fileNamePos + 4 + len(fileName)
+	blockNum := page.GetInt(blockNumPos)
+
+	offsetPos := blockNumPos + 4
+	offset := page.GetInt(offsetPos)
+
+	oldValuePos := offsetPos + 4
+	oldValue := page.GetLong(oldValuePos)
+
+	block := file.NewBlockID(fileName, blockNum)
+
+	return &SetLongLogRecord{
+		txNum:    txNum,
+		offset:   offset,
+		oldValue: oldValue,
+		block:    block,
+	}
+}
+
+// Op returns the operation type for this log record
+func (s *SetLongLogRecord) Op() LogRecordType {
+	return LogRecordSetLong
+}
+
+// TxNumber returns the transaction number associated with this log record
+func (s *SetLongLogRecord) TxNumber() int {
+	return s.txNum
+}
+
+// Block returns the block changed by the operation
+func (s *SetLongLogRecord) Block() *file.BlockID {
+	return s.block
+}
+
+// Undo performs the undo operation for this log record
+func (s *SetLongLogRecord) Undo(tx *Transaction) error {
+	// The buffer may already have been unpinned by the time we undo,
+	// so pin the block for the duration of the restore.
+	_, err := tx.Pin(s.block)
+	if err != nil {
+		return err
+	}
+	defer tx.Unpin(s.block)
+
+	// Restore the old value at the specified offset in the block
+	// log=false because we don't want to log the undo operation itself
+	return tx.SetLong(s.block, s.offset, s.oldValue, false)
+}
+
+// undoOnPage restores the old value in a copy of the block
+func (s *SetLongLogRecord) undoOnPage(page *file.Page) {
+	page.SetLong(s.offset, s.oldValue)
+}
+
+// WriteSetLongLogRecord writes a SetLongLogRecord to the log manager
+func WriteSetLongLogRecord(lm *log.Manager, txNum int, blk *file.BlockID, offset int, oldValue int64) (int, error) {
+	opPos := 0
+	txNumPos := opPos + LogRecordTypeSize()
+	fileNamePos := txNumPos + 4
+	blockNumPos := fileNamePos + 4 + len(blk.Filename())
+	offsetPos := blockNumPos + 4
+	oldValuePos := offsetPos + 4
+	finalLen := oldValuePos + 8
+
+	page := file.NewPage(finalLen)
+	page.SetInt(opPos, int(LogRecordSetLong))
+	page.SetInt(txNumPos, txNum)
+	page.SetString(fileNamePos, blk.Filename())
+	page.SetInt(blockNumPos, blk.Number())
+	page.SetInt(offsetPos, offset)
+	page.SetLong(oldValuePos, oldValue)
+
+	return lm.Append(page.Bytes())
+}
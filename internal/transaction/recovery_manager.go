@@ -1,9 +1,8 @@
 package transaction
 
 import (
-	"slices"
-
 	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
 	"github.com/yashagw/cranedb/internal/log"
 )
 
@@ -16,6 +15,9 @@ type RecoveryManager struct {
 	transaction   *Transaction
 	logManager    *log.Manager
 	bufferManager *buffer.Manager
+	// startLSN is the LSN the transaction's log records come after,
+	// or -1 while it hasn't written any
+	startLSN int
 }
 
 func NewRecoveryManager(txNum int, transaction *Transaction, logManager *log.Manager, bufferManager *buffer.Manager) *RecoveryManager {
@@ -24,6 +26,14 @@ func NewRecoveryManager(txNum int, transaction *Transaction, logManager *log.Man
 		transaction:   transaction,
 		logManager:    logManager,
 		bufferManager: bufferManager,
+		startLSN:      -1,
+	}
+}
+
+// register adds the transaction to the transaction table before it writes a log record
+func (rm *RecoveryManager) register() {
+	if rm.startLSN < 0 {
+		rm.startLSN = registerTx(rm.logManager, rm.txNum)
 	}
 }
 
@@ -32,7 +42,7 @@ func (rm *RecoveryManager) Commit() error {
 	if err != nil {
 		return err
 	}
-	lsn, err := WriteCommitLogRecord(rm.logManager, rm.txNum)
+	lsn, err := finishTx(rm.logManager, rm.txNum, WriteCommitLogRecord)
 	if err != nil {
 		return err
 	}
@@ -48,7 +58,7 @@ func (rm *RecoveryManager) Rollback() error {
 	if err != nil {
 		return err
 	}
-	lsn, err := WriteCommitLogRecord(rm.logManager, rm.txNum)
+	lsn, err := finishTx(rm.logManager, rm.txNum, WriteRollbackLogRecord)
 	if err != nil {
 		return err
 	}
@@ -64,11 +74,24 @@ func (rm *RecoveryManager) Recover() error {
 	if err != nil {
 		return err
 	}
-	lsn, err := WriteCheckpointLogRecord(rm.logManager)
-	if err != nil {
-		return err
-	}
-	return rm.logManager.Flush(lsn)
+	return Checkpoint(rm.logManager, rm.bufferManager)
+}
+
+// SetSavepoint writes a Savepoint log record marking the given savepoint
+// of this transaction.
+func (rm *RecoveryManager) SetSavepoint(savepointID int) error {
+	rm.register()
+	_, err := WriteSavepointLogRecord(rm.logManager, rm.txNum, savepointID)
+	return err
+}
+
+// RollbackToSavepoint undoes the operations this transaction performed after
+// the given savepoint, leaving earlier changes in place.
+func (rm *RecoveryManager) RollbackToSavepoint(savepointID int) error {
+	return rm.undoUntil(func(record LogRecord) bool {
+		savepoint, ok := record.(*SavepointLogRecord)
+		return ok && savepoint.SavepointID() == savepointID
+	})
 }
 
 // SetInt logs an integer modification operation before it occurs.
@@ -76,75 +99,325 @@ func (rm *RecoveryManager) Recover() error {
 // writes a SetInt log record with the old value for potential rollback,
 // and returns the LSN of the log record.
 func (rm *RecoveryManager) SetInt(buf *buffer.Buffer, offset int) (int, error) {
+	rm.register()
 	oldVal := buf.Contents().GetInt(offset)
 	return WriteSetIntLogRecord(rm.logManager, rm.txNum, buf.Block(), offset, oldVal)
 }
 
+// SetLong logs an 8 byte integer modification operation before it occurs.
+// It reads the current value from the buffer at the specified offset,
+// writes a SetLong log record with the old value for potential rollback,
+// and returns the LSN of the log record.
+func (rm *RecoveryManager) SetLong(buf *buffer.Buffer, offset int) (int, error) {
+	rm.register()
+	oldVal := buf.Contents().GetLong(offset)
+	return WriteSetLongLogRecord(rm.logManager, rm.txNum, buf.Block(), offset, oldVal)
+}
+
 // SetString logs a string modification operation before it occurs.
 // It reads the current value from the buffer at the specified offset,
 // writes a SetString log record with the old value for potential rollback,
 // and returns the LSN of the log record.
 func (rm *RecoveryManager) SetString(buf *buffer.Buffer, offset int) (int, error) {
+	rm.register()
 	oldVal := buf.Contents().GetString(offset)
 	return WriteSetStringLogRecord(rm.logManager, rm.txNum, buf.Block(), offset, oldVal)
 }
 
+// SetBytes logs that length bytes at the specified offset are about to be overwritten.
+// The old bytes are split over several SetBytes log records if needed, so that each
+// record fits in a log block. It returns the LSN of the last log record.
+func (rm *RecoveryManager) SetBytes(buf *buffer.Buffer, offset int, length int) (int, error) {
+	rm.register()
+	chunkSize := max(rm.transaction.BlockSize()/4, 1)
+	contents := buf.Contents().Bytes()
+	lsn := -1
+	for start := offset; start < offset+length; start += chunkSize {
+		end := min(start+chunkSize, offset+length)
+		var err error
+		lsn, err = WriteSetBytesLogRecord(rm.logManager, rm.txNum, buf.Block(), start, contents[start:end])
+		if err != nil {
+			return 0, err
+		}
+	}
+	return lsn, nil
+}
+
+// NewBlock logs that the values written into a newly appended block are not logged one
+// by one, and returns the LSN of the log record. Undoing it marks all the block's slots
+// of the given size empty.
+func (rm *RecoveryManager) NewBlock(buf *buffer.Buffer, slotSize int) (int, error) {
+	rm.register()
+	return WriteNewBlockLogRecord(rm.logManager, rm.txNum, buf.Block(), slotSize)
+}
+
 // doRollback undoes all operations for the current transaction by scanning the log records
 // backwards. For each log record belonging to this transaction, it performs the corresponding
-// undo operation, stopping when it reaches the transaction's Start record.
+// undo operation, stopping once it passes the transaction's first record.
 func (rm *RecoveryManager) doRollback() error {
+	return rm.undoUntil(func(record LogRecord) bool {
+		return false
+	})
+}
+
+// undoUntil scans the log records backwards and undoes each record belonging to
+// this transaction until stop returns true for one of them or the transaction's
+// Start record or first record is passed. Records already undone by an earlier rollback to a
+// savepoint, as told by its CLRs, are skipped.
+func (rm *RecoveryManager) undoUntil(stop func(record LogRecord) bool) error {
 	lmIterator, err := rm.logManager.Iterator()
 	if err != nil {
 		return err
 	}
 
+	undoNext := -1
 	for lmIterator.HasNext() {
 		logBytes := lmIterator.Next()
+		lsn := lmIterator.LSN()
+		if lsn <= rm.startLSN {
+			break
+		}
 		record := CreateLogRecord(logBytes)
 
-		if record.TxNumber() == rm.txNum {
-			// If reached Start then we can stop
-			if record.Op() == LogRecordStart {
-				break
-			}
-			err := record.Undo(rm.transaction)
-			if err != nil {
-				return err
-			}
+		if record.TxNumber() != rm.txNum {
+			continue
+		}
+		// If reached Start then we can stop
+		if record.Op() == LogRecordStart || stop(record) {
+			break
+		}
+		if undoNext >= 0 && lsn > undoNext {
+			continue
+		}
+		if clr, ok := record.(*CLRLogRecord); ok {
+			undoNext = clr.UndoNextLSN()
+			continue
+		}
+		err := rm.undo(record, logBytes, lsn)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// doRecovery performs database recovery by reading the log records backward
-// and undoes any uncompleted transactions.
-// Recovery stops if it reaches the start of the log or a checkpoint record.
+// undo undoes a log record with the given bytes and LSN. Undoing an update first writes
+// a CLR for it, so that it isn't undone again if undoing is interrupted by a crash, and
+// the CLR's LSN becomes the PageLSN of the block.
+func (rm *RecoveryManager) undo(record LogRecord, logBytes []byte, lsn int) error {
+	update, ok := record.(updateRecord)
+	if !ok {
+		return record.Undo(rm.transaction)
+	}
+	buf, err := rm.transaction.Pin(update.Block())
+	if err != nil {
+		return err
+	}
+	defer rm.transaction.Unpin(update.Block())
+
+	// The block is marked dirty before the CLR is written, so that a checkpoint taken
+	// in between either finds the block in the dirty page table or comes before the CLR
+	buf.SetModified(rm.txNum, rm.logManager.LatestLSN())
+	clrLSN, err := WriteCLRLogRecord(rm.logManager, record.TxNumber(), lsn-1, logBytes)
+	if err != nil {
+		return err
+	}
+	buf.SetModified(rm.txNum, clrLSN)
+	return record.Undo(rm.transaction)
+}
+
+// analysis is what the analysis pass of recovery finds in the log
+type analysis struct {
+	// losers holds the transactions to undo, with the LSN their records come after
+	losers map[int]int
+	// undoLSN is the LSN the records of the losers come after
+	undoLSN int
+	// dirtyPages maps the blocks that may miss logged changes to the LSN of the first of them
+	dirtyPages map[blockKey]int
+}
+
+// doRecovery performs database recovery after a crash in three passes:
+//   - analysis reads the log backward to the last checkpoint, finding the unfinished
+//     transactions and rebuilding the dirty page table
+//   - redo reads the log forward from the lowest recLSN of the dirty page table and
+//     repeats the CLRs whose change didn't reach the disk
+//   - undo reads the log backward again and undoes the records of the unfinished
+//     transactions that no CLR compensates, newest first, each with a new CLR
 func (rm *RecoveryManager) doRecovery() error {
-	finishedTXs := []int{}
-	lmIterator, err := rm.logManager.Iterator()
+	result, err := rm.analyze()
+	if err != nil {
+		return err
+	}
+	err = rm.redo(result.dirtyPages)
 	if err != nil {
 		return err
 	}
+	return rm.undoLosers(result)
+}
 
+// analyze reads the log backward until the last complete checkpoint. The transactions
+// it lists and those that wrote records after it are losers unless a commit or rollback
+// record follows. The dirty page table of the checkpoint gets the blocks changed by the
+// records after it, each with the LSN of the oldest of them.
+func (rm *RecoveryManager) analyze() (*analysis, error) {
+	lmIterator, err := rm.logManager.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	finishedTXs := map[int]bool{}
+	result := &analysis{losers: map[int]int{}, dirtyPages: map[blockKey]int{}}
+	// addDirtyPage adds a block changed by the record with the given LSN to the dirty page table
+	addDirtyPage := func(blk *file.BlockID, lsn int) {
+		key := makeKey(blk)
+		if recLSN, ok := result.dirtyPages[key]; !ok || lsn < recLSN {
+			result.dirtyPages[key] = lsn
+		}
+	}
+	var checkpoint *CheckpointLogRecord
+	parts := 0
 	for lmIterator.HasNext() {
 		logBytes := lmIterator.Next()
+		lsn := lmIterator.LSN()
+		if checkpoint != nil && parts == checkpoint.NumParts() && lsn <= checkpoint.BeginLSN() {
+			break
+		}
 		record := CreateLogRecord(logBytes)
 
-		// If reached Checkpoint then it means
-		// above this logs everything is committed and we can stop
-		if record.Op() == LogRecordCheckpoint {
-			return nil
+		switch record := record.(type) {
+		case *CheckpointLogRecord:
+			// A checkpoint whose last part is missing was interrupted
+			if checkpoint == nil && record.Part() == record.NumParts()-1 {
+				checkpoint = record
+			}
+			if checkpoint != nil && record.BeginLSN() == checkpoint.BeginLSN() {
+				parts++
+				for txNum, startLSN := range record.ActiveTXs() {
+					if !finishedTXs[txNum] {
+						result.losers[txNum] = startLSN
+					}
+				}
+				for _, page := range record.DirtyPages() {
+					addDirtyPage(page.Block, page.RecLSN)
+				}
+			}
+		case *CommitLogRecord, *RollbackLogRecord:
+			finishedTXs[record.TxNumber()] = true
+		case updateRecord:
+			addDirtyPage(record.Block(), lsn)
+		case *CLRLogRecord:
+			addDirtyPage(record.block(), lsn)
+		}
+		if record.TxNumber() >= 0 && !finishedTXs[record.TxNumber()] {
+			if _, ok := result.losers[record.TxNumber()]; !ok {
+				result.losers[record.TxNumber()] = -1
+			}
+		}
+	}
+
+	result.undoLSN = 0
+	if checkpoint != nil && parts == checkpoint.NumParts() {
+		result.undoLSN = checkpoint.BeginLSN()
+		for _, startLSN := range result.losers {
+			if startLSN >= 0 {
+				result.undoLSN = min(result.undoLSN, startLSN)
+			}
+		}
+	}
+	return result, nil
+}
+
+// redo reads the log forward from the lowest recLSN of the dirty page table and repeats
+// the compensation of every CLR whose block is in the table from before the CLR and whose
+// LSN is greater than the PageLSN of its block, since its change never reached the disk.
+// Update records only hold the values to restore, and a transaction's changes are forced
+// to disk before it commits or rolls back, so CLRs are the only records redone.
+func (rm *RecoveryManager) redo(dirtyPages map[blockKey]int) error {
+	if len(dirtyPages) == 0 {
+		return nil
+	}
+	minRecLSN := -1
+	for _, recLSN := range dirtyPages {
+		if minRecLSN < 0 || recLSN < minRecLSN {
+			minRecLSN = recLSN
+		}
+	}
+
+	lmIterator, err := rm.logManager.ForwardIterator(minRecLSN - 1)
+	if err != nil {
+		return err
+	}
+	for lmIterator.HasNext() {
+		clr, ok := CreateLogRecord(lmIterator.Next()).(*CLRLogRecord)
+		if !ok {
+			continue
+		}
+		lsn := lmIterator.LSN()
+		blk := clr.block()
+		if recLSN, ok := dirtyPages[makeKey(blk)]; !ok || lsn < recLSN {
+			continue
+		}
+
+		// A file only loses blocks once the transaction that emptied them has committed
+		size, err := rm.transaction.Size(blk.Filename())
+		if err != nil {
+			return err
+		}
+		if blk.Number() >= size {
+			continue
+		}
+
+		buf, err := rm.transaction.Pin(blk)
+		if err != nil {
+			return err
+		}
+		if buf.Contents().LSN() < lsn {
+			err = clr.Redo(rm.transaction)
+			if err == nil {
+				buf.SetModified(rm.txNum, lsn)
+			}
+		}
+		rm.transaction.Unpin(blk)
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if record.Op() == LogRecordCommit || record.Op() == LogRecordRollback {
-			finishedTXs = append(finishedTXs, record.TxNumber())
+// undoLosers reads the log backward to the oldest record of the losers and undoes their
+// records. Records compensated by a CLR, as told by the UndoNextLSN of the transaction's
+// latest CLR, are skipped.
+func (rm *RecoveryManager) undoLosers(result *analysis) error {
+	lmIterator, err := rm.logManager.Iterator()
+	if err != nil {
+		return err
+	}
+	undoNext := map[int]int{}
+	for lmIterator.HasNext() {
+		logBytes := lmIterator.Next()
+		lsn := lmIterator.LSN()
+		if lsn <= result.undoLSN {
+			break
+		}
+		record := CreateLogRecord(logBytes)
+		if _, ok := result.losers[record.TxNumber()]; !ok {
+			continue
 		}
 
-		if !slices.Contains(finishedTXs, record.TxNumber()) {
-			err := record.Undo(rm.transaction)
-			if err != nil {
-				return err
+		next, compensated := undoNext[record.TxNumber()]
+		compensated = compensated && lsn > next
+		if clr, ok := record.(*CLRLogRecord); ok {
+			if !compensated {
+				undoNext[record.TxNumber()] = clr.UndoNextLSN()
 			}
+			continue
+		}
+		if compensated {
+			continue
+		}
+		err := rm.undo(record, logBytes, lsn)
+		if err != nil {
+			return err
 		}
 	}
 	return nil
@@ -0,0 +1,115 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/file"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+// ErrSnapshotClosed is returned when a block is read through a closed snapshot
+var ErrSnapshotClosed = errors.New("snapshot is closed")
+
+// Snapshot is a read-only view of the database as of the LSN it was taken at. A block read
+// through it holds the changes of the transactions that had committed by then and none of
+// the others, so it stays the same however the block changes afterwards. Reading takes no
+// locks, so it neither waits for writers nor holds them up: the block's current contents
+// are copied, and the changes made since the snapshot or by the transactions running when
+// it was taken are undone in the copy, newest first, from the old values in the log.
+//
+// Only single blocks are read so far. While a snapshot is open, checkpoints keep the log
+// records its reads undo.
+type Snapshot struct {
+	logManager    *log.Manager
+	bufferManager *buffer.Manager
+	// lsn is the LSN of the latest record the snapshot sees
+	lsn int
+	// active holds the transactions that were running when the snapshot was taken
+	active map[int]bool
+	// oldestLSN is the LSN the records of the running transactions come after
+	oldestLSN int
+	closed    bool
+}
+
+// NewSnapshot takes a snapshot of the database as of the latest record of the log.
+func NewSnapshot(lm *log.Manager, bm *buffer.Manager) *Snapshot {
+	txTablesMutex.Lock()
+	defer txTablesMutex.Unlock()
+
+	s := &Snapshot{
+		logManager:    lm,
+		bufferManager: bm,
+		lsn:           lm.LatestLSN(),
+		active:        map[int]bool{},
+	}
+	s.oldestLSN = s.lsn
+	for txNum, startLSN := range txTables[lm] {
+		s.active[txNum] = true
+		s.oldestLSN = min(s.oldestLSN, startLSN)
+	}
+	if snapshots[lm] == nil {
+		snapshots[lm] = map[*Snapshot]bool{}
+	}
+	snapshots[lm][s] = true
+	return s
+}
+
+// LSN returns the LSN of the latest log record the snapshot sees
+func (s *Snapshot) LSN() int {
+	return s.lsn
+}
+
+// ReadBlock returns a copy of the block as it was when the snapshot was taken.
+func (s *Snapshot) ReadBlock(blk *file.BlockID) (*file.Page, error) {
+	if s.closed {
+		return nil, ErrSnapshotClosed
+	}
+	buff, err := s.bufferManager.Pin(blk)
+	if err != nil {
+		return nil, err
+	}
+	// Every change in the copy is logged, since a change is logged and made under the latch
+	buff.LatchShared()
+	page := file.NewPage(len(buff.Contents().Bytes()))
+	copy(page.Bytes(), buff.Contents().Bytes())
+	buff.UnlatchShared()
+	s.bufferManager.Unpin(buff)
+
+	iter, err := s.logManager.Iterator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the log for a snapshot of %s: %w", blk, err)
+	}
+	key := makeKey(blk)
+	for iter.HasNext() {
+		logBytes := iter.Next()
+		lsn := iter.LSN()
+		if lsn <= s.oldestLSN {
+			break
+		}
+		// A CLR is skipped: if it is newer than the snapshot or of a transaction running at
+		// it, so is the record it compensates, whose undo restores the same value, and
+		// otherwise its change is one the snapshot sees
+		update, ok := CreateLogRecord(logBytes).(updateRecord)
+		if !ok || makeKey(update.Block()) != key {
+			continue
+		}
+		if lsn > s.lsn || s.active[update.TxNumber()] {
+			update.undoOnPage(page)
+		}
+	}
+	return page, nil
+}
+
+// Close releases the snapshot, letting checkpoints drop the log records its reads need.
+func (s *Snapshot) Close() {
+	txTablesMutex.Lock()
+	defer txTablesMutex.Unlock()
+
+	s.closed = true
+	delete(snapshots[s.logManager], s)
+	if len(snapshots[s.logManager]) == 0 {
+		delete(snapshots, s.logManager)
+	}
+}
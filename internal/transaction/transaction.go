@@ -1,7 +1,13 @@
 package transaction
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/yashagw/cranedb/internal/buffer"
 	"github.com/yashagw/cranedb/internal/file"
@@ -26,8 +32,44 @@ const (
 	END_OF_LOG_RECORD = -1
 )
 
+var ErrUnknownSavepoint = errors.New("unknown savepoint")
+
+// ErrIntOutOfRange is returned when an int value doesn't fit in the 4 bytes it is stored in
+var ErrIntOutOfRange = errors.New("int value out of range")
+
+// ErrNotPinned is returned when a block is read or written without being pinned by the
+// transaction, e.g. by a scan used after the transaction ended
+var ErrNotPinned = errors.New("block is not pinned")
+
+// ErrCanceled is returned by scans of a transaction whose context was canceled or timed out
+var ErrCanceled = errors.New("statement canceled")
+
+// IsolationLevel controls how long a transaction holds its shared locks.
+type IsolationLevel int
+
+const (
+	// RepeatableRead holds shared locks until the transaction ends, so a value
+	// read twice is the same both times. It also keeps phantoms out of a repeated
+	// read: a table scan holds the lock on the end of the file, which an insert
+	// needs to append a block, and a B-tree range read holds the leaves it reads
+	// up to the first key past the range, which an insert into the range needs
+	// too. This is the default.
+	RepeatableRead IsolationLevel = iota
+	// ReadCommitted releases each shared lock right after the read. Reads still
+	// never see uncommitted data, but repeating a read may see a newer committed value.
+	ReadCommitted
+)
+
+// String returns the SQL name of the isolation level.
+func (l IsolationLevel) String() string {
+	if l == ReadCommitted {
+		return "READ COMMITTED"
+	}
+	return "REPEATABLE READ"
+}
+
 type Transaction struct {
-	fileManager        *file.Manager
+	fileManager        file.BlockStore
 	logManager         *dblog.Manager
 	bufferManager      *buffer.Manager
 	recoveryManager    *RecoveryManager
@@ -35,10 +77,29 @@ type Transaction struct {
 
 	txNum      int
 	bufferList *BufferList
+	isolation  IsolationLevel
+	// blocksAccessed counts the blocks pinned by the transaction
+	blocksAccessed atomic.Int64
+
+	// savepoints holds the ids of the savepoints that can still be rolled back to, oldest first
+	savepoints    []int
+	nextSavepoint int
+	// partiallyRolledBack is set once changes were undone by RollbackToSavepoint
+	partiallyRolledBack bool
+
+	endHooks []func(allCommitted bool)
+
+	// ctx cancels the statements of the transaction, or is nil if they can't be canceled
+	ctx context.Context
+}
+
+// NewTransaction creates a new transaction with the default RepeatableRead isolation level
+func NewTransaction(fileManager file.BlockStore, logManager *dblog.Manager, bufferManager *buffer.Manager, lockTable *LockTable) *Transaction {
+	return NewTransactionWithIsolation(fileManager, logManager, bufferManager, lockTable, RepeatableRead)
 }
 
-// NewTransaction creates a new transaction
-func NewTransaction(fileManager *file.Manager, logManager *dblog.Manager, bufferManager *buffer.Manager, lockTable *LockTable) *Transaction {
+// NewTransactionWithIsolation creates a new transaction running at the given isolation level
+func NewTransactionWithIsolation(fileManager file.BlockStore, logManager *dblog.Manager, bufferManager *buffer.Manager, lockTable *LockTable, isolation IsolationLevel) *Transaction {
 	txNum := getNextTxNum()
 
 	concurrencyManager := NewConcurrencyManager(lockTable)
@@ -51,18 +112,61 @@ func NewTransaction(fileManager *file.Manager, logManager *dblog.Manager, buffer
 		concurrencyManager: concurrencyManager,
 		txNum:              txNum,
 		bufferList:         bufferList,
+		isolation:          isolation,
 	}
 	recoveryManager := NewRecoveryManager(txNum, transaction, logManager, bufferManager)
 	transaction.recoveryManager = recoveryManager
+	txStarted.Add(1)
 
 	return transaction
 }
 
+// Isolation returns the isolation level of the transaction
+func (t *Transaction) Isolation() IsolationLevel {
+	return t.isolation
+}
+
+// SetContext makes the transaction's scans stop with ErrCanceled once ctx is done.
+// A nil ctx, the default, means its statements run to completion.
+func (t *Transaction) SetContext(ctx context.Context) {
+	t.ctx = ctx
+}
+
+// Err returns an error wrapping ErrCanceled and the context's error once the
+// context given to SetContext is done, and nil otherwise.
+// Scans check it between records.
+func (t *Transaction) Err() error {
+	if t.ctx == nil {
+		return nil
+	}
+	if err := t.ctx.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+	return nil
+}
+
+// OnEnd registers fn to run when the transaction commits or rolls back, before its locks
+// are released. fn is told whether every change the transaction made was committed, which
+// is not the case after a rollback or if any changes were undone by RollbackToSavepoint.
+func (t *Transaction) OnEnd(fn func(allCommitted bool)) {
+	t.endHooks = append(t.endHooks, fn)
+}
+
+func (t *Transaction) runEndHooks(allCommitted bool) {
+	hooks := t.endHooks
+	t.endHooks = nil
+	for _, fn := range hooks {
+		fn(allCommitted)
+	}
+}
+
 func (t *Transaction) Commit() error {
 	err := t.recoveryManager.Commit()
 	if err != nil {
 		return err
 	}
+	txCommitted.Add(1)
+	t.runEndHooks(!t.partiallyRolledBack)
 	err = t.concurrencyManager.release()
 	if err != nil {
 		return err
@@ -76,6 +180,8 @@ func (t *Transaction) Rollback() error {
 	if err != nil {
 		return err
 	}
+	txRolledBack.Add(1)
+	t.runEndHooks(false)
 	err = t.concurrencyManager.release()
 	if err != nil {
 		return err
@@ -84,44 +190,129 @@ func (t *Transaction) Rollback() error {
 	return nil
 }
 
+// SetSavepoint marks the current point of the transaction and returns the savepoint id
+// that can later be passed to RollbackToSavepoint.
+func (t *Transaction) SetSavepoint() (int, error) {
+	id := t.nextSavepoint
+	err := t.recoveryManager.SetSavepoint(id)
+	if err != nil {
+		return 0, err
+	}
+	t.nextSavepoint++
+	t.savepoints = append(t.savepoints, id)
+	return id, nil
+}
+
+// RollbackToSavepoint undoes the changes made since the given savepoint without ending
+// the transaction. Locks acquired after the savepoint are kept until the transaction ends.
+// The savepoint remains valid, but savepoints set after it are discarded.
+func (t *Transaction) RollbackToSavepoint(id int) error {
+	idx := slices.Index(t.savepoints, id)
+	if idx < 0 {
+		return ErrUnknownSavepoint
+	}
+	err := t.recoveryManager.RollbackToSavepoint(id)
+	if err != nil {
+		return err
+	}
+	t.partiallyRolledBack = true
+	t.savepoints = t.savepoints[:idx+1]
+	return nil
+}
+
 func (t *Transaction) DoRecovery() error {
 	return t.recoveryManager.Recover()
 }
 
 func (t *Transaction) Pin(blk *file.BlockID) (*buffer.Buffer, error) {
+	t.blocksAccessed.Add(1)
 	return t.bufferList.Pin(blk)
 }
 
+// BlocksAccessed returns the number of times the transaction has pinned a block, whether it
+// was found in the buffer pool or read from the file. It is the measure of a statement's cost
+// that plans estimate with BlocksAccessed.
+func (t *Transaction) BlocksAccessed() int {
+	return int(t.blocksAccessed.Load())
+}
+
 func (t *Transaction) Unpin(blk *file.BlockID) {
 	t.bufferList.Unpin(blk)
 }
 
+// pinnedBuffer returns the buffer holding a block that the transaction has pinned
+func (t *Transaction) pinnedBuffer(blk *file.BlockID) (*buffer.Buffer, error) {
+	buff := t.bufferList.GetBuffer(blk)
+	if buff == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotPinned, blk)
+	}
+	return buff, nil
+}
+
 func (t *Transaction) GetInt(blk *file.BlockID, offset int) (int, error) {
-	err := t.concurrencyManager.sLock(blk)
+	buff, err := t.pinnedBuffer(blk)
 	if err != nil {
 		return 0, err
 	}
-	buff := t.bufferList.GetBuffer(blk)
+	err = t.concurrencyManager.sLock(blk)
+	if err != nil {
+		return 0, err
+	}
+	buff.LatchShared()
 	val := buff.Contents().GetInt(offset)
-	return val, nil
+	buff.UnlatchShared()
+	return val, t.endRead(blk)
+}
+
+// GetLong reads the 8 byte int at the offset of the block
+func (t *Transaction) GetLong(blk *file.BlockID, offset int) (int64, error) {
+	buff, err := t.pinnedBuffer(blk)
+	if err != nil {
+		return 0, err
+	}
+	err = t.concurrencyManager.sLock(blk)
+	if err != nil {
+		return 0, err
+	}
+	buff.LatchShared()
+	val := buff.Contents().GetLong(offset)
+	buff.UnlatchShared()
+	return val, t.endRead(blk)
 }
 
 func (t *Transaction) GetString(blk *file.BlockID, offset int) (string, error) {
-	err := t.concurrencyManager.sLock(blk)
+	buff, err := t.pinnedBuffer(blk)
 	if err != nil {
 		return "", err
 	}
-	buff := t.bufferList.GetBuffer(blk)
+	err = t.concurrencyManager.sLock(blk)
+	if err != nil {
+		return "", err
+	}
+	buff.LatchShared()
 	val := buff.Contents().GetString(offset)
-	return val, nil
+	buff.UnlatchShared()
+	return val, t.endRead(blk)
 }
 
+// SetInt stores val as a 4 byte int at the offset of the block, logging the old value
+// if log is set. A value outside the range of a 32-bit int fails with ErrIntOutOfRange
+// instead of being cut to its low bytes.
 func (t *Transaction) SetInt(blk *file.BlockID, offset int, val int, log bool) error {
-	err := t.concurrencyManager.xLock(blk)
+	if val < math.MinInt32 || val > math.MaxInt32 {
+		return fmt.Errorf("%w: %d", ErrIntOutOfRange, val)
+	}
+	buff, err := t.pinnedBuffer(blk)
 	if err != nil {
 		return err
 	}
-	buff := t.bufferList.GetBuffer(blk)
+	err = t.concurrencyManager.xLock(blk)
+	if err != nil {
+		return err
+	}
+	// The old value is read and the new one written under the same latch
+	buff.Latch()
+	defer buff.Unlatch()
 	lsn := -1
 	if log {
 		lsn, err = t.recoveryManager.SetInt(buff, offset)
@@ -135,12 +326,43 @@ func (t *Transaction) SetInt(blk *file.BlockID, offset int, val int, log bool) e
 	return nil
 }
 
+// SetLong stores val as an 8 byte int at the offset of the block, logging the old value
+// if log is set.
+func (t *Transaction) SetLong(blk *file.BlockID, offset int, val int64, log bool) error {
+	buff, err := t.pinnedBuffer(blk)
+	if err != nil {
+		return err
+	}
+	err = t.concurrencyManager.xLock(blk)
+	if err != nil {
+		return err
+	}
+	buff.Latch()
+	defer buff.Unlatch()
+	lsn := -1
+	if log {
+		lsn, err = t.recoveryManager.SetLong(buff, offset)
+		if err != nil {
+			return err
+		}
+	}
+	page := buff.Contents()
+	page.SetLong(offset, val)
+	buff.SetModified(t.txNum, lsn)
+	return nil
+}
+
 func (t *Transaction) SetString(blk *file.BlockID, offset int, val string, log bool) error {
-	err := t.concurrencyManager.xLock(blk)
+	buff, err := t.pinnedBuffer(blk)
 	if err != nil {
 		return err
 	}
-	buff := t.bufferList.GetBuffer(blk)
+	err = t.concurrencyManager.xLock(blk)
+	if err != nil {
+		return err
+	}
+	buff.Latch()
+	defer buff.Unlatch()
 	lsn := -1
 	if log {
 		lsn, err = t.recoveryManager.SetString(buff, offset)
@@ -154,13 +376,74 @@ func (t *Transaction) SetString(blk *file.BlockID, offset int, val string, log b
 	return nil
 }
 
+// SetBytes overwrites the bytes of the block at offset with val. Unlike SetString,
+// it writes no length prefix, and the bytes it overwrites don't need to hold a value.
+func (t *Transaction) SetBytes(blk *file.BlockID, offset int, val []byte, log bool) error {
+	buff, err := t.pinnedBuffer(blk)
+	if err != nil {
+		return err
+	}
+	err = t.concurrencyManager.xLock(blk)
+	if err != nil {
+		return err
+	}
+	buff.Latch()
+	defer buff.Unlatch()
+	lsn := -1
+	if log {
+		lsn, err = t.recoveryManager.SetBytes(buff, offset, len(val))
+		if err != nil {
+			return err
+		}
+	}
+	copy(buff.Contents().Bytes()[offset:], val)
+	buff.SetModified(t.txNum, lsn)
+	return nil
+}
+
+// WriteNewBlock lets write fill in the page of a block that the transaction appended
+// and has pinned, without logging each value. A single log record is written instead,
+// whose undo marks every slot of the given size empty, so the block must be laid out
+// as a record page.
+func (t *Transaction) WriteNewBlock(blk *file.BlockID, slotSize int, write func(page *file.Page)) error {
+	buff, err := t.pinnedBuffer(blk)
+	if err != nil {
+		return err
+	}
+	err = t.concurrencyManager.xLock(blk)
+	if err != nil {
+		return err
+	}
+	buff.Latch()
+	defer buff.Unlatch()
+	lsn, err := t.recoveryManager.NewBlock(buff, slotSize)
+	if err != nil {
+		return err
+	}
+	write(buff.Contents())
+	buff.SetModified(t.txNum, lsn)
+	return nil
+}
+
 func (t *Transaction) Size(filename string) (int, error) {
 	dummyBlock := file.NewBlockID(filename, END_OF_LOG_RECORD)
 	err := t.concurrencyManager.sLock(dummyBlock)
 	if err != nil {
 		return 0, err
 	}
-	return t.fileManager.GetTotalBlocks(filename)
+	size, err := t.fileManager.GetTotalBlocks(filename)
+	if err != nil {
+		return 0, err
+	}
+	return size, t.endRead(dummyBlock)
+}
+
+// endRead releases the shared lock taken for a read when running at ReadCommitted.
+func (t *Transaction) endRead(blk *file.BlockID) error {
+	if t.isolation != ReadCommitted {
+		return nil
+	}
+	return t.concurrencyManager.sUnlock(blk)
 }
 
 func (t *Transaction) Append(filename string) (*file.BlockID, error) {
@@ -172,6 +455,64 @@ func (t *Transaction) Append(filename string) (*file.BlockID, error) {
 	return t.fileManager.Append(filename)
 }
 
+// SLockFile takes a shared lock on the whole file, like a scan that reads every block, so
+// that no record can be inserted into it or deleted from it while the lock is held. It is
+// meant for a read that learns about the file's records without reading them, e.g. a count
+// taken from statistics. At ReadCommitted the locks are released right away, after waiting
+// for the writers holding them to end.
+func (t *Transaction) SLockFile(filename string) error {
+	dummyBlock := file.NewBlockID(filename, END_OF_LOG_RECORD)
+	err := t.concurrencyManager.sLock(dummyBlock)
+	if err != nil {
+		return err
+	}
+	size, err := t.fileManager.GetTotalBlocks(filename)
+	if err != nil {
+		return err
+	}
+	for i := range size {
+		blk := file.NewBlockID(filename, i)
+		err = t.concurrencyManager.sLock(blk)
+		if err != nil {
+			return err
+		}
+		err = t.endRead(blk)
+		if err != nil {
+			return err
+		}
+	}
+	return t.endRead(dummyBlock)
+}
+
+// XLockFile takes an exclusive lock on the whole file: on its end, so that no block can
+// be appended to it, and on every block it has.
+func (t *Transaction) XLockFile(filename string) error {
+	dummyBlock := file.NewBlockID(filename, END_OF_LOG_RECORD)
+	err := t.concurrencyManager.xLock(dummyBlock)
+	if err != nil {
+		return err
+	}
+	size, err := t.fileManager.GetTotalBlocks(filename)
+	if err != nil {
+		return err
+	}
+	for i := range size {
+		err = t.concurrencyManager.xLock(file.NewBlockID(filename, i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Truncate drops the blocks of the file from numBlocks on. It can't be undone, so it is
+// only meant for an OnEnd hook of a committed transaction that holds an exclusive lock on
+// the file (see XLockFile) and knows the dropped blocks hold nothing. It fails, changing
+// nothing, if one of the blocks is still pinned.
+func (t *Transaction) Truncate(filename string, numBlocks int) error {
+	return t.bufferManager.Truncate(filename, numBlocks)
+}
+
 func (t *Transaction) BlockSize() int {
 	return t.fileManager.BlockSize()
 }
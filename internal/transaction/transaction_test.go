@@ -1,6 +1,7 @@
 package transaction
 
 import (
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -66,6 +67,51 @@ func TestTransaction_BasicOperations(t *testing.T) {
 	assert.Empty(t, tx2.bufferList.buffers)
 }
 
+// errStore is the error of the operations the store is set to fail
+var errStore = errors.New("store failure")
+
+// TestTransaction_StoreErrors checks that the errors of the block store reach the callers
+// of the transaction, through the log and the buffer pool
+func TestTransaction_StoreErrors(t *testing.T) {
+	store := file.NewFaultyStore(file.NewMemoryManager(400))
+	defer store.Close()
+	logManager, err := log.NewManager(store, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(store, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	tx := NewTransaction(store, logManager, bufferManager, lockTable)
+	block, err := tx.Append("testfile")
+	require.NoError(t, err)
+
+	store.Fail(file.StoreAppend, errStore, 1)
+	_, err = tx.Append("testfile")
+	assert.ErrorIs(t, err, errStore)
+
+	store.Fail(file.StoreRead, errStore, 1)
+	_, err = tx.Pin(block)
+	assert.ErrorIs(t, err, errStore)
+
+	_, err = tx.Pin(block)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(block, 0, 42, true))
+
+	// The changed block and the log can't be written, so the commit fails
+	store.Fail(file.StoreWrite, errStore, -1)
+	assert.ErrorIs(t, tx.Commit(), errStore)
+	store.Heal(file.StoreWrite)
+	require.NoError(t, tx.Commit())
+
+	tx = NewTransaction(store, logManager, bufferManager, lockTable)
+	_, err = tx.Pin(block)
+	require.NoError(t, err)
+	val, err := tx.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 42, val)
+	require.NoError(t, tx.Commit())
+}
+
 func TestTransaction_DataOperation(t *testing.T) {
 	fileManager, err := file.NewManager("/tmp/testdb", 400)
 	assert.NoError(t, err)
@@ -105,6 +151,19 @@ func TestTransaction_DataOperation(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "world", strVal)
 
+	// Test 4: Ints that don't fit in 4 bytes are refused, not cut
+	err = tx.SetInt(block, 0, 2147483648, true)
+	assert.ErrorIs(t, err, ErrIntOutOfRange)
+	assert.EqualError(t, err, "int value out of range: 2147483648")
+	assert.ErrorIs(t, tx.SetInt(block, 0, -2147483649, true), ErrIntOutOfRange)
+	val, err = tx.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 42, val)
+	require.NoError(t, tx.SetInt(block, 0, -2147483648, true))
+	val, err = tx.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, -2147483648, val)
+
 	tx.Commit()
 }
 
@@ -223,3 +282,921 @@ func TestTransaction_ReadWriteConcurrency(t *testing.T) {
 		assert.Equal(t, 999, val, "Reader %d should have read the written value", i)
 	}
 }
+
+// TestTransaction_LockUpgrade tests a transaction that reads a block and then writes it while
+// another transaction waits to write it: the reader's shared lock is upgraded in place, so the
+// waiting writer can't slip in between the read and the write.
+func TestTransaction_LockUpgrade(t *testing.T) {
+	fileManager := file.NewMemoryManager(400)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+	newTx := func() *Transaction {
+		return NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	}
+
+	setup := newTx()
+	block, err := setup.Append("testfile")
+	require.NoError(t, err)
+	_, err = setup.Pin(block)
+	require.NoError(t, err)
+	require.NoError(t, setup.SetInt(block, 0, 100, true))
+	require.NoError(t, setup.Commit())
+
+	reader := newTx()
+	_, err = reader.Pin(block)
+	require.NoError(t, err)
+	val, err := reader.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 100, val)
+
+	// The writer waits for the reader's shared lock
+	writer := newTx()
+	_, err = writer.Pin(block)
+	require.NoError(t, err)
+	written := make(chan error, 1)
+	go func() {
+		written <- writer.SetInt(block, 0, 1, true)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The reader upgrades its lock right away instead of deadlocking or letting the writer in
+	upgraded := make(chan error, 1)
+	go func() {
+		upgraded <- reader.SetInt(block, 0, val+10, true)
+	}()
+	select {
+	case err := <-upgraded:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("upgrading the shared lock of the only reader blocked")
+	}
+	assert.True(t, lockTable.HasXLock(block))
+	select {
+	case <-written:
+		t.Fatal("the writer got in between the read and the write of the upgraded transaction")
+	default:
+	}
+	val, err = reader.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 110, val)
+
+	// Once the reader commits, the writer goes on after it
+	require.NoError(t, reader.Commit())
+	require.NoError(t, <-written)
+	require.NoError(t, writer.Commit())
+
+	check := newTx()
+	_, err = check.Pin(block)
+	require.NoError(t, err)
+	val, err = check.GetInt(block, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+
+	// With another reader, the upgrade waits for it while keeping its own shared lock
+	other := newTx()
+	_, err = other.Pin(block)
+	require.NoError(t, err)
+	_, err = other.GetInt(block, 0)
+	require.NoError(t, err)
+	go func() {
+		upgraded <- check.SetInt(block, 0, 2, true)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-upgraded:
+		t.Fatal("the upgrade should wait for the other reader")
+	default:
+	}
+	lockTable.mu.Lock()
+	assert.Equal(t, 2, lockTable.locks[makeKey(block)], "both shared locks should still be held")
+	lockTable.mu.Unlock()
+	require.NoError(t, other.Commit())
+	require.NoError(t, <-upgraded)
+	require.NoError(t, check.Commit())
+}
+
+func TestTransaction_RollbackToSavepoint(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	block1 := file.NewBlockID("testfile", 1)
+	block2 := file.NewBlockID("testfile", 2)
+
+	tx := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	_, err = tx.Pin(block1)
+	require.NoError(t, err)
+	_, err = tx.Pin(block2)
+	require.NoError(t, err)
+
+	// Change made before the savepoint
+	require.NoError(t, tx.SetInt(block1, 0, 10, true))
+
+	sp, err := tx.SetSavepoint()
+	require.NoError(t, err)
+
+	// Changes made after the savepoint, including one on a newly locked block
+	require.NoError(t, tx.SetInt(block1, 0, 20, true))
+	require.NoError(t, tx.SetString(block2, 0, "later", true))
+
+	require.NoError(t, tx.RollbackToSavepoint(sp))
+
+	val, err := tx.GetInt(block1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 10, val, "change before the savepoint should survive")
+	str, err := tx.GetString(block2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "", str, "change after the savepoint should be undone")
+
+	// Locks acquired after the savepoint are still held
+	assert.Equal(t, "X", tx.concurrencyManager.locks[makeKey(block2)])
+
+	// The savepoint can be reused, later savepoints are discarded
+	later, err := tx.SetSavepoint()
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(block1, 0, 30, true))
+	require.NoError(t, tx.RollbackToSavepoint(sp))
+	assert.ErrorIs(t, tx.RollbackToSavepoint(later), ErrUnknownSavepoint)
+	assert.ErrorIs(t, tx.RollbackToSavepoint(99), ErrUnknownSavepoint)
+
+	val, err = tx.GetInt(block1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 10, val)
+
+	// A full rollback still undoes everything
+	require.NoError(t, tx.Rollback())
+
+	tx2 := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	_, err = tx2.Pin(block1)
+	require.NoError(t, err)
+	val, err = tx2.GetInt(block1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, val)
+	require.NoError(t, tx2.Commit())
+}
+
+func TestTransaction_IsolationLevels(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	block := file.NewBlockID("testfile", 1)
+
+	setup := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	_, err = setup.Pin(block)
+	require.NoError(t, err)
+	require.NoError(t, setup.SetInt(block, 0, 1, true))
+	require.NoError(t, setup.Commit())
+
+	// readTwice reads the value, lets a concurrent writer try to change it,
+	// and reads it again. It returns both reads.
+	readTwice := func(isolation IsolationLevel, newValue int) (int, int) {
+		reader := NewTransactionWithIsolation(fileManager, logManager, bufferManager, lockTable, isolation)
+		assert.Equal(t, isolation, reader.Isolation())
+		_, err := reader.Pin(block)
+		require.NoError(t, err)
+		first, err := reader.GetInt(block, 0)
+		require.NoError(t, err)
+
+		writerDone := make(chan error, 1)
+		go func() {
+			writer := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+			if _, err := writer.Pin(block); err != nil {
+				writerDone <- err
+				return
+			}
+			if err := writer.SetInt(block, 0, newValue, true); err != nil {
+				writerDone <- err
+				return
+			}
+			writerDone <- writer.Commit()
+		}()
+
+		// Give the writer time to either commit or block on the reader's shared lock
+		select {
+		case err := <-writerDone:
+			require.NoError(t, err)
+			writerDone <- nil
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		second, err := reader.GetInt(block, 0)
+		require.NoError(t, err)
+		require.NoError(t, reader.Commit())
+		require.NoError(t, <-writerDone)
+		return first, second
+	}
+
+	// Under the default level the writer waits for the reader, so both reads agree
+	first, second := readTwice(RepeatableRead, 2)
+	assert.Equal(t, 1, first)
+	assert.Equal(t, 1, second)
+
+	// Under READ COMMITTED the writer commits between the reads
+	first, second = readTwice(ReadCommitted, 3)
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 3, second, "READ COMMITTED should allow a non-repeatable read")
+}
+
+func TestTransaction_SLockFile(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	setup := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	_, err = setup.Append("testfile")
+	require.NoError(t, err)
+	require.NoError(t, setup.Commit())
+
+	// appendAndWrite starts a writer that appends a block and writes to the existing one
+	appendAndWrite := func() chan error {
+		done := make(chan error, 1)
+		go func() {
+			writer := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+			if _, err := writer.Append("testfile"); err != nil {
+				done <- err
+				return
+			}
+			blk := file.NewBlockID("testfile", 0)
+			if _, err := writer.Pin(blk); err != nil {
+				done <- err
+				return
+			}
+			if err := writer.SetInt(blk, 0, 1, true); err != nil {
+				done <- err
+				return
+			}
+			done <- writer.Commit()
+		}()
+		return done
+	}
+
+	// Under the default level the writer waits until the reader ends
+	reader := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	require.NoError(t, reader.SLockFile("testfile"))
+	done := appendAndWrite()
+	select {
+	case err := <-done:
+		t.Fatalf("writer was not blocked by the file lock, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	require.NoError(t, reader.Commit())
+	require.NoError(t, <-done)
+
+	// Under READ COMMITTED the locks are released right away
+	reader = NewTransactionWithIsolation(fileManager, logManager, bufferManager, lockTable, ReadCommitted)
+	require.NoError(t, reader.SLockFile("testfile"))
+	select {
+	case err := <-appendAndWrite():
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer was blocked by a READ COMMITTED reader")
+	}
+	require.NoError(t, reader.Commit())
+}
+
+func TestTransaction_OnEnd(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+	block := file.NewBlockID("testfile", 1)
+
+	tests := []struct {
+		name     string
+		end      func(tx *Transaction) error
+		expected bool
+	}{
+		{"Commit", func(tx *Transaction) error { return tx.Commit() }, true},
+		{"Rollback", func(tx *Transaction) error { return tx.Rollback() }, false},
+		{"CommitAfterSavepointRollback", func(tx *Transaction) error {
+			sp, err := tx.SetSavepoint()
+			if err != nil {
+				return err
+			}
+			if err := tx.SetInt(block, 0, 2, true); err != nil {
+				return err
+			}
+			if err := tx.RollbackToSavepoint(sp); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+			_, err := tx.Pin(block)
+			require.NoError(t, err)
+			require.NoError(t, tx.SetInt(block, 0, 1, true))
+
+			calls := []bool{}
+			tx.OnEnd(func(allCommitted bool) {
+				// The hook runs while the transaction still holds its locks
+				assert.Equal(t, "X", tx.concurrencyManager.locks[makeKey(block)])
+				calls = append(calls, allCommitted)
+			})
+			require.NoError(t, tt.end(tx))
+			assert.Equal(t, []bool{tt.expected}, calls)
+		})
+	}
+}
+
+func TestTransaction_Stats(t *testing.T) {
+	fileManager, err := file.NewManager(t.TempDir(), 400)
+	require.NoError(t, err)
+	logManager, err := log.NewManager(fileManager, "test.log")
+	require.NoError(t, err)
+	bufferManager, err := buffer.NewManager(fileManager, logManager, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	before := GetStats()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			tx := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+			block := file.NewBlockID("testfile", index)
+			_, err := tx.Pin(block)
+			assert.NoError(t, err)
+			assert.NoError(t, tx.SetInt(block, 0, index, true))
+			if index%4 == 0 {
+				assert.NoError(t, tx.Rollback())
+			} else {
+				assert.NoError(t, tx.Commit())
+			}
+		}(i)
+	}
+
+	// A transaction that hasn't ended yet is counted as active
+	open := NewTransaction(fileManager, logManager, bufferManager, lockTable)
+	wg.Wait()
+
+	after := GetStats()
+	assert.Equal(t, int64(21), after.Started-before.Started)
+	assert.Equal(t, int64(15), after.Committed-before.Committed)
+	assert.Equal(t, int64(5), after.RolledBack-before.RolledBack)
+	assert.Equal(t, int64(0), after.LockAborts-before.LockAborts)
+	assert.Equal(t, int64(1), after.Active()-before.Active())
+
+	require.NoError(t, open.Commit())
+	assert.Equal(t, before.Active(), GetStats().Active())
+}
+
+// TestRecovery_CrashDuringRollback interrupts the rollback of a transaction whose changes
+// reached the disk, crashes, and checks that recovery finishes the rollback: the CLRs of
+// the interrupted rollback are redone, and the records they compensate aren't undone again.
+// A crash during recovery itself is recovered from the same way.
+func TestRecovery_CrashDuringRollback(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+
+	lm, bm := restart(t, fm)
+	lockTable := NewLockTable()
+
+	tx := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := tx.Append("testfile")
+	require.NoError(t, err)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	for i, val := range []int{1, 2, 3} {
+		require.NoError(t, tx.SetInt(blk, i*4, val, true))
+	}
+	require.NoError(t, tx.Commit())
+
+	// The first value is changed twice; all the changes reach the disk
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(blk, 0, 10, true))
+	require.NoError(t, tx.SetInt(blk, 4, 20, true))
+	require.NoError(t, tx.SetInt(blk, 0, 100, true))
+	require.NoError(t, tx.SetInt(blk, 8, 30, true))
+	require.NoError(t, bm.FlushAll(tx.txNum))
+
+	// The rollback undoes the two newest changes, then crashes. Its CLRs reach the log,
+	// but the values it restored never reach the disk.
+	undone := 0
+	err = tx.recoveryManager.undoUntil(func(record LogRecord) bool {
+		if _, ok := record.(updateRecord); ok {
+			undone++
+		}
+		return undone > 2
+	})
+	require.NoError(t, err)
+	require.NoError(t, lm.Flush(lm.LatestLSN()))
+
+	assert.Equal(t, 2, countCLRs(t, lm, tx.txNum))
+
+	// readValues reads the values of the block in a new transaction
+	readValues := func(lm *log.Manager, bm *buffer.Manager) []int {
+		reader := NewTransaction(fm, lm, bm, NewLockTable())
+		defer reader.Commit()
+		_, err := reader.Pin(blk)
+		require.NoError(t, err)
+		values := []int{}
+		for i := range 3 {
+			val, err := reader.GetInt(blk, i*4)
+			require.NoError(t, err)
+			values = append(values, val)
+		}
+		return values
+	}
+
+	// Recovery after the crash also crashes, before its changes reach the disk
+	lm, bm = restart(t, fm)
+	recovery := NewTransaction(fm, lm, bm, NewLockTable())
+	require.NoError(t, recovery.recoveryManager.doRecovery())
+	require.NoError(t, lm.Flush(lm.LatestLSN()))
+	// Only the two changes the rollback didn't get to are compensated
+	assert.Equal(t, 4, countCLRs(t, lm, tx.txNum))
+
+	// Recovering again redoes all the CLRs and has nothing left to undo
+	lm, bm = restart(t, fm)
+	recovery = NewTransaction(fm, lm, bm, NewLockTable())
+	require.NoError(t, recovery.DoRecovery())
+	assert.Equal(t, 4, countCLRs(t, lm, tx.txNum))
+	assert.Equal(t, []int{1, 2, 3}, readValues(lm, bm))
+
+	// The state survives another restart without any undo
+	lm, bm = restart(t, fm)
+	assert.Equal(t, []int{1, 2, 3}, readValues(lm, bm))
+}
+
+func TestRecovery_SetLong(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+
+	lm, bm := restart(t, fm)
+	lockTable := NewLockTable()
+
+	tx := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := tx.Append("testfile")
+	require.NoError(t, err)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetLong(blk, 0, 5000000000, true))
+	require.NoError(t, tx.Commit())
+
+	// A rollback restores all 8 bytes of the old value
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetLong(blk, 0, -7000000000, true))
+	val, err := tx.GetLong(blk, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-7000000000), val)
+	require.NoError(t, tx.Rollback())
+
+	// A change that reached the disk before a crash is undone by recovery. The first
+	// recovery crashes before its undo reaches the disk, so the second one redoes its CLR.
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetLong(blk, 8, 1<<40, true))
+	require.NoError(t, bm.FlushAll(tx.txNum))
+
+	lm, bm = restart(t, fm)
+	recovery := NewTransaction(fm, lm, bm, NewLockTable())
+	require.NoError(t, recovery.recoveryManager.doRecovery())
+	require.NoError(t, lm.Flush(lm.LatestLSN()))
+	assert.Equal(t, 1, countCLRs(t, lm, tx.txNum))
+
+	lm, bm = restart(t, fm)
+	recovery = NewTransaction(fm, lm, bm, NewLockTable())
+	require.NoError(t, recovery.DoRecovery())
+
+	reader := NewTransaction(fm, lm, bm, NewLockTable())
+	defer reader.Commit()
+	_, err = reader.Pin(blk)
+	require.NoError(t, err)
+	val, err = reader.GetLong(blk, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000000000), val)
+	val, err = reader.GetLong(blk, 8)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), val)
+}
+
+// TestRecovery_CommitIsDurable commits a transaction, crashes without flushing anything
+// else, and checks that recovery keeps its changes: Commit forces its changes and its commit
+// record to the disk before returning. The log holds only old values, so a change can't be
+// redone; a transaction whose commit record was lost would be undone instead.
+func TestRecovery_CommitIsDurable(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+
+	lm, bm := restart(t, fm)
+	lockTable := NewLockTable()
+
+	setup := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := setup.Append("testfile")
+	require.NoError(t, err)
+	otherBlk, err := setup.Append("testfile")
+	require.NoError(t, err)
+	require.NoError(t, setup.Commit())
+
+	tx := NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(blk, 0, 42, true))
+	require.NoError(t, tx.SetString(blk, 4, "committed", true))
+
+	// A transaction still running at the crash, whose change reached the disk before the
+	// commit record was written
+	loser := NewTransaction(fm, lm, bm, lockTable)
+	_, err = loser.Pin(otherBlk)
+	require.NoError(t, err)
+	require.NoError(t, loser.SetInt(otherBlk, 0, 7, true))
+	require.NoError(t, bm.FlushAll(loser.txNum))
+
+	require.NoError(t, tx.Commit())
+
+	// The crash loses the log records and pages still in memory
+	lm, bm = restart(t, fm)
+	iter, err := lm.Iterator()
+	require.NoError(t, err)
+	committed := false
+	for iter.HasNext() {
+		record := CreateLogRecord(iter.Next())
+		if record.Op() == LogRecordCommit && record.TxNumber() == tx.txNum {
+			committed = true
+		}
+	}
+	assert.True(t, committed, "the commit record must reach the disk before Commit returns")
+
+	recovery := NewTransaction(fm, lm, bm, NewLockTable())
+	require.NoError(t, recovery.DoRecovery())
+
+	reader := NewTransaction(fm, lm, bm, NewLockTable())
+	defer reader.Commit()
+	_, err = reader.Pin(blk)
+	require.NoError(t, err)
+	val, err := reader.GetInt(blk, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 42, val)
+	str, err := reader.GetString(blk, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "committed", str)
+	_, err = reader.Pin(otherBlk)
+	require.NoError(t, err)
+	val, err = reader.GetInt(otherBlk, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, val)
+}
+
+// restart opens the log and buffers over the files, as after a restart
+func restart(t *testing.T, fm *file.Manager) (*log.Manager, *buffer.Manager) {
+	lm, err := log.NewManager(fm, "test.log")
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	return lm, bm
+}
+
+// countCLRs counts the CLRs of the transaction in the log
+func countCLRs(t *testing.T, lm *log.Manager, txNum int) int {
+	iter, err := lm.Iterator()
+	require.NoError(t, err)
+	count := 0
+	for iter.HasNext() {
+		record := CreateLogRecord(iter.Next())
+		if record.Op() == LogRecordCLR && record.TxNumber() == txNum {
+			count++
+		}
+	}
+	return count
+}
+
+// TestRecovery_RedoFromCheckpoint builds a log of many blocks and checks that recovery only
+// reads the part written since the last checkpoint, that it redoes the CLRs whose change
+// didn't reach the disk, and that the PageLSN keeps it from redoing a CLR whose block was
+// changed again afterwards.
+func TestRecovery_RedoFromCheckpoint(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, bm := restart(t, fm)
+	lockTable := NewLockTable()
+
+	tx := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := tx.Append("testfile")
+	require.NoError(t, err)
+	other, err := tx.Append("testfile")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	// Committed updates fill most of the log before the checkpoint
+	for i := range 500 {
+		tx = NewTransaction(fm, lm, bm, lockTable)
+		_, err = tx.Pin(blk)
+		require.NoError(t, err)
+		for j := range 10 {
+			require.NoError(t, tx.SetInt(blk, j*4, i, true))
+		}
+		require.NoError(t, tx.Commit())
+	}
+	require.NoError(t, NewTransaction(fm, lm, bm, lockTable).DoRecovery())
+	checkpointLSN := lm.LatestLSN()
+
+	// A rolled back change to the other block, which is then changed again and committed
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(other)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(other, 0, 5, true))
+	require.NoError(t, tx.Rollback())
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(other)
+	require.NoError(t, err)
+	require.NoError(t, tx.SetInt(other, 0, 7, true))
+	require.NoError(t, tx.Commit())
+
+	// A transaction whose changes reach the disk, and whose rollback is interrupted
+	// after undoing half of them, before the values it restored reach the disk
+	tx = NewTransaction(fm, lm, bm, lockTable)
+	_, err = tx.Pin(blk)
+	require.NoError(t, err)
+	for j := range 10 {
+		require.NoError(t, tx.SetInt(blk, j*4, 1000+j, true))
+	}
+	require.NoError(t, bm.FlushAll(tx.txNum))
+	undone := 0
+	err = tx.recoveryManager.undoUntil(func(record LogRecord) bool {
+		if _, ok := record.(updateRecord); ok {
+			undone++
+		}
+		return undone > 5
+	})
+	require.NoError(t, err)
+	require.NoError(t, lm.Flush(lm.LatestLSN()))
+
+	logBlocks, err := fm.GetTotalBlocks("test.log")
+	require.NoError(t, err)
+	recentBlocks := logBlocks - checkpointLSN/fm.BlockSize()
+	assert.Greater(t, logBlocks, 50*recentBlocks)
+
+	readBefore := fm.BlocksRead("test.log")
+	lm, bm = restart(t, fm)
+	require.NoError(t, NewTransaction(fm, lm, bm, NewLockTable()).DoRecovery())
+	// Each pass reads the blocks from the checkpoint on once, and at most the block
+	// before it, where its tables may have been taken
+	assert.LessOrEqual(t, fm.BlocksRead("test.log")-readBefore, 3*(recentBlocks+1)+1)
+	assert.Equal(t, 10, countCLRs(t, lm, tx.txNum))
+
+	reader := NewTransaction(fm, lm, bm, NewLockTable())
+	defer reader.Commit()
+	_, err = reader.Pin(blk)
+	require.NoError(t, err)
+	for j := range 10 {
+		val, err := reader.GetInt(blk, j*4)
+		require.NoError(t, err)
+		assert.Equal(t, 499, val)
+	}
+	_, err = reader.Pin(other)
+	require.NoError(t, err)
+	val, err := reader.GetInt(other, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 7, val, "The rolled back change's CLR is older than the block")
+}
+
+// TestCheckpoint_RemovesLogSegments checks that a checkpoint drops the log segments before
+// the records recovery reads, but keeps those of a transaction still running.
+func TestCheckpoint_RemovesLogSegments(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, err := log.NewSegmentedManager(fm, "test.log", 4)
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	setup := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := setup.Append("testfile")
+	require.NoError(t, err)
+	other, err := setup.Append("testfile")
+	require.NoError(t, err)
+	require.NoError(t, setup.Commit())
+
+	// A transaction that keeps running while committed ones fill several segments
+	running := NewTransaction(fm, lm, bm, lockTable)
+	_, err = running.Pin(other)
+	require.NoError(t, err)
+	require.NoError(t, running.SetInt(other, 0, 7, true))
+	for i := range 100 {
+		tx := NewTransaction(fm, lm, bm, lockTable)
+		_, err = tx.Pin(blk)
+		require.NoError(t, err)
+		require.NoError(t, tx.SetInt(blk, 0, i, true))
+		require.NoError(t, tx.Commit())
+	}
+	require.NoError(t, bm.FlushAll(running.txNum))
+	require.NoError(t, Checkpoint(lm, bm))
+	size, err := fm.GetTotalBlocks("test.log")
+	require.NoError(t, err)
+	assert.Equal(t, 4, size, "The running transaction's first record is in the first segment")
+
+	// The crash leaves the running transaction to undo, from its records in the first segment
+	lm, bm = restart(t, fm)
+	require.NoError(t, NewTransaction(fm, lm, bm, NewLockTable()).DoRecovery())
+	size, err = fm.GetTotalBlocks("test.log")
+	require.NoError(t, err)
+	assert.Equal(t, 0, size, "The checkpoint after recovery needs none of the old segments")
+
+	reader := NewTransaction(fm, lm, bm, NewLockTable())
+	defer reader.Commit()
+	_, err = reader.Pin(other)
+	require.NoError(t, err)
+	val, err := reader.GetInt(other, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, val)
+	_, err = reader.Pin(blk)
+	require.NoError(t, err)
+	val, err = reader.GetInt(blk, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 99, val)
+}
+
+// TestSnapshot_ReadBlock checks that a snapshot reads a block as it was when the snapshot
+// was taken, without the changes of a transaction that was running then or of those that
+// came after, and without waiting for the lock the running transaction holds.
+func TestSnapshot_ReadBlock(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, err := log.NewSegmentedManager(fm, "test.log", 2)
+	require.NoError(t, err)
+	bm, err := buffer.NewManager(fm, lm, 10)
+	require.NoError(t, err)
+	lockTable := NewLockTable()
+
+	setup := NewTransaction(fm, lm, bm, lockTable)
+	blk, err := setup.Append("testfile")
+	require.NoError(t, err)
+	other, err := setup.Append("testfile")
+	require.NoError(t, err)
+	_, err = setup.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, setup.SetInt(blk, 0, 10, true))
+	require.NoError(t, setup.SetString(blk, 4, "committed", true))
+	require.NoError(t, setup.Commit())
+
+	// The writer has changed the block, but not committed
+	writer := NewTransaction(fm, lm, bm, lockTable)
+	_, err = writer.Pin(blk)
+	require.NoError(t, err)
+	require.NoError(t, writer.SetInt(blk, 0, 20, true))
+	require.NoError(t, writer.SetString(blk, 4, "uncommitted", true))
+
+	snapshot := NewSnapshot(lm, bm)
+	defer snapshot.Close()
+	assertBlock := func(s *Snapshot, val int, str string) {
+		page, err := s.ReadBlock(blk)
+		require.NoError(t, err)
+		assert.Equal(t, val, page.GetInt(0))
+		assert.Equal(t, str, page.GetString(4))
+	}
+	start := time.Now()
+	assertBlock(snapshot, 10, "committed")
+	assert.Less(t, time.Since(start), time.Second, "a snapshot read doesn't wait for locks")
+
+	// Neither the writer's commit nor later transactions change what the snapshot sees,
+	// even once checkpoints have dropped the log segments recovery no longer needs
+	require.NoError(t, writer.SetInt(blk, 0, 30, true))
+	require.NoError(t, writer.Commit())
+	for i := range 50 {
+		tx := NewTransaction(fm, lm, bm, lockTable)
+		_, err = tx.Pin(other)
+		require.NoError(t, err)
+		require.NoError(t, tx.SetInt(other, 0, i, true))
+		require.NoError(t, tx.Commit())
+	}
+	require.NoError(t, Checkpoint(lm, bm))
+	assertBlock(snapshot, 10, "committed")
+
+	// A later snapshot sees the writer's commit
+	later := NewSnapshot(lm, bm)
+	assertBlock(later, 30, "uncommitted")
+	later.Close()
+	_, err = later.ReadBlock(blk)
+	assert.ErrorIs(t, err, ErrSnapshotClosed)
+
+	// Once the snapshot is closed, a checkpoint drops the segments it needed
+	size, err := fm.GetTotalBlocks("test.log")
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+	snapshot.Close()
+	require.NoError(t, Checkpoint(lm, bm))
+	size, err = fm.GetTotalBlocks("test.log")
+	require.NoError(t, err)
+	assert.Equal(t, 0, size)
+}
+
+func TestCheckpoint_DirtyPageTable(t *testing.T) {
+	fm := file.NewMemoryManager(400)
+	defer fm.Close()
+	lm, bm := restart(t, fm)
+	lockTable := NewLockTable()
+
+	setup := NewTransaction(fm, lm, bm, lockTable)
+	blocks := []*file.BlockID{}
+	for range 4 {
+		blk, err := setup.Append("testfile")
+		require.NoError(t, err)
+		blocks = append(blocks, blk)
+	}
+	require.NoError(t, setup.Commit())
+	assert.Empty(t, bm.DirtyPageTable())
+
+	// setInt changes a value of a block and returns the LSN of its log record
+	setInt := func(tx *Transaction, blk *file.BlockID, val int) int {
+		_, err := tx.Pin(blk)
+		require.NoError(t, err)
+		require.NoError(t, tx.SetInt(blk, 0, val, true))
+		return lm.LatestLSN()
+	}
+
+	// The running transaction changes blocks 0 and 1, and block 0 again
+	startLSN := lm.LatestLSN()
+	running := NewTransaction(fm, lm, bm, lockTable)
+	first := setInt(running, blocks[0], 10)
+	setInt(running, blocks[0], 11)
+	savepoint, err := running.SetSavepoint()
+	require.NoError(t, err)
+	second := setInt(running, blocks[1], 20)
+	// The committed transaction's change to block 2 is on disk
+	committed := NewTransaction(fm, lm, bm, lockTable)
+	setInt(committed, blocks[2], 30)
+	require.NoError(t, committed.Commit())
+
+	// Each dirty block has the LSN of its first change since it was written to disk
+	assert.ElementsMatch(t, []buffer.DirtyPage{
+		{Block: blocks[0], RecLSN: first},
+		{Block: blocks[1], RecLSN: second},
+	}, bm.DirtyPageTable())
+
+	// Once the changes are on disk, undoing the change to block 1 dirties it again
+	require.NoError(t, bm.FlushAll(running.txNum))
+	assert.Empty(t, bm.DirtyPageTable())
+	beforeCLR := lm.LatestLSN()
+	require.NoError(t, running.RollbackToSavepoint(savepoint))
+	expected := []buffer.DirtyPage{{Block: blocks[1], RecLSN: beforeCLR}}
+	assert.Equal(t, expected, bm.DirtyPageTable())
+
+	// The checkpoint holds both tables, while the transaction keeps running
+	require.NoError(t, Checkpoint(lm, bm))
+	iter, err := lm.Iterator()
+	require.NoError(t, err)
+	checkpoint, ok := CreateLogRecord(iter.Next()).(*CheckpointLogRecord)
+	require.True(t, ok)
+	assert.Equal(t, 1, checkpoint.NumParts())
+	assert.Equal(t, map[int]int{running.txNum: startLSN}, checkpoint.ActiveTXs())
+	assert.Equal(t, expected, checkpoint.DirtyPages())
+
+	// A change after the checkpoint, then a crash before the undone change to block 1
+	// or the new one reach the disk
+	third := setInt(running, blocks[3], 40)
+	require.NoError(t, lm.Flush(lm.LatestLSN()))
+
+	// Analysis rebuilds the tables from the checkpoint and the records after it
+	lm, bm = restart(t, fm)
+	recovery := NewTransaction(fm, lm, bm, NewLockTable())
+	result, err := recovery.recoveryManager.analyze()
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{running.txNum: startLSN}, result.losers)
+	assert.Equal(t, startLSN, result.undoLSN)
+	assert.Equal(t, map[blockKey]int{
+		makeKey(blocks[1]): beforeCLR,
+		makeKey(blocks[3]): third,
+	}, result.dirtyPages)
+
+	// Redo starts before the checkpoint, to repeat the undone change to block 1
+	require.NoError(t, recovery.DoRecovery())
+	reader := NewTransaction(fm, lm, bm, NewLockTable())
+	defer reader.Commit()
+	for i, want := range []int{0, 0, 30, 0} {
+		_, err := reader.Pin(blocks[i])
+		require.NoError(t, err)
+		val, err := reader.GetInt(blocks[i], 0)
+		require.NoError(t, err)
+		assert.Equal(t, want, val)
+	}
+}
@@ -0,0 +1,40 @@
+package transaction
+
+import "sync/atomic"
+
+// The counters behind GetStats, shared by every transaction of the process
+var (
+	txStarted    atomic.Int64
+	txCommitted  atomic.Int64
+	txRolledBack atomic.Int64
+	txLockAborts atomic.Int64
+)
+
+// Stats counts the transactions of the process since it started.
+type Stats struct {
+	// Started is the number of transactions created
+	Started int64
+	// Committed is the number of transactions that committed
+	Committed int64
+	// RolledBack is the number of transactions that rolled back, including the ones
+	// rolled back after a lock abort
+	RolledBack int64
+	// LockAborts is the number of lock requests that gave up with ErrLockAbort, which is
+	// how a deadlock between transactions is broken
+	LockAborts int64
+}
+
+// Active returns the number of transactions that haven't committed or rolled back yet
+func (s Stats) Active() int64 {
+	return s.Started - s.Committed - s.RolledBack
+}
+
+// GetStats returns the current transaction counters.
+func GetStats() Stats {
+	return Stats{
+		Started:    txStarted.Load(),
+		Committed:  txCommitted.Load(),
+		RolledBack: txRolledBack.Load(),
+		LockAborts: txLockAborts.Load(),
+	}
+}
@@ -0,0 +1,100 @@
+package transaction
+
+import (
+	"sync"
+
+	"github.com/yashagw/cranedb/internal/buffer"
+	"github.com/yashagw/cranedb/internal/log"
+)
+
+// txTables holds the transaction table of each log: the transactions that have written
+// to the log and haven't finished, each with the LSN of the latest record before its first
+// one. Transactions join it right before their first record, and leave it with the record
+// that ends them, so that a checkpoint either lists a transaction or comes before all its
+// records or after its end.
+var (
+	txTablesMutex sync.Mutex
+	txTables      = map[*log.Manager]map[int]int{}
+	// snapshots holds the open snapshots of each log, whose reads undo the records after
+	// their oldestLSN
+	snapshots = map[*log.Manager]map[*Snapshot]bool{}
+)
+
+// registerTx adds the transaction to the transaction table of the log, unless it is in it
+// already, and returns the LSN its records come after.
+func registerTx(lm *log.Manager, txNum int) int {
+	txTablesMutex.Lock()
+	defer txTablesMutex.Unlock()
+
+	table, ok := txTables[lm]
+	if !ok {
+		table = map[int]int{}
+		txTables[lm] = table
+	}
+	startLSN, ok := table[txNum]
+	if !ok {
+		startLSN = lm.LatestLSN()
+		table[txNum] = startLSN
+	}
+	return startLSN
+}
+
+// finishTx writes the record that ends the transaction with write, and removes the
+// transaction from the transaction table of the log in the same step.
+func finishTx(lm *log.Manager, txNum int, write func(lm *log.Manager, txNum int) (int, error)) (int, error) {
+	txTablesMutex.Lock()
+	defer txTablesMutex.Unlock()
+
+	lsn, err := write(lm, txNum)
+	if err != nil {
+		return 0, err
+	}
+	delete(txTables[lm], txNum)
+	if len(txTables[lm]) == 0 {
+		delete(txTables, lm)
+	}
+	return lsn, nil
+}
+
+// Checkpoint writes a checkpoint holding the transaction table and the dirty page table,
+// without waiting for running transactions or writing any buffer to disk. Recovery after
+// a crash then reads the log from the oldest record of the running transactions and the
+// oldest change missing from disk on, instead of from its start, so the log segments
+// before those records are removed.
+func Checkpoint(lm *log.Manager, bm *buffer.Manager) error {
+	txTablesMutex.Lock()
+	beginLSN := lm.LatestLSN()
+	activeTXs := map[int]int{}
+	for txNum, startLSN := range txTables[lm] {
+		activeTXs[txNum] = startLSN
+	}
+	needed := beginLSN
+	for s := range snapshots[lm] {
+		needed = min(needed, s.oldestLSN)
+	}
+	txTablesMutex.Unlock()
+
+	// Taken after beginLSN: a block is marked dirty before a CLR that changes it is
+	// written, so the block of a CLR up to beginLSN is either in the table or on disk
+	dirtyPages := bm.DirtyPageTable()
+	lsn, err := WriteCheckpointLogRecord(lm, beginLSN, activeTXs, dirtyPages)
+	if err != nil {
+		return err
+	}
+	err = lm.Flush(lsn)
+	if err != nil {
+		return err
+	}
+
+	// Recovery reads the records after beginLSN, the records of the running transactions,
+	// which come after their start LSN, and the changes from the lowest recLSN on, and the
+	// open snapshots read the records after their oldest LSN
+	for _, startLSN := range activeTXs {
+		needed = min(needed, startLSN)
+	}
+	for _, page := range dirtyPages {
+		needed = min(needed, page.RecLSN-1)
+	}
+	_, err = lm.RemoveSegments(needed)
+	return err
+}
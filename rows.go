@@ -0,0 +1,140 @@
+package cranedb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/yashagw/cranedb/internal/record"
+	"github.com/yashagw/cranedb/internal/scan"
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// Rows is the result of a query. It starts before the first row; call Next to move to each
+// row in turn and Scan to read its values.
+type Rows struct {
+	tx      *transaction.Transaction
+	scan    scan.Scan
+	schema  *record.Schema
+	columns []string
+	// endTx is set if closing the rows ends the transaction, which it does unless the
+	// query ran in a transaction the caller ends
+	endTx bool
+	// onRow is true while the rows are positioned on a row
+	onRow  bool
+	closed bool
+	err    error
+}
+
+func newRows(tx *transaction.Transaction, s scan.Scan, schema *record.Schema, endTx bool) *Rows {
+	return &Rows{
+		tx:      tx,
+		scan:    s,
+		schema:  schema,
+		columns: schema.Fields(),
+		endTx:   endTx,
+	}
+}
+
+// Columns returns the names of the columns, in the order Scan reads them
+func (r *Rows) Columns() []string {
+	return append([]string{}, r.columns...)
+}
+
+// ColumnType returns the type of a column, "int", "bigint" or "string"
+func (r *Rows) ColumnType(column string) string {
+	return r.schema.Type(column)
+}
+
+// Next moves to the next row and returns true if there is one. Once there are no more
+// rows, or reading them fails, the rows are closed; Err tells the two apart.
+func (r *Rows) Next() bool {
+	r.onRow = false
+	if r.closed {
+		return false
+	}
+	hasNext, err := r.scan.Next()
+	if err != nil {
+		r.err = err
+		r.close(false)
+		return false
+	}
+	if !hasNext {
+		r.err = r.close(true)
+		return false
+	}
+	r.onRow = true
+	return true
+}
+
+// Scan copies the values of the current row into dest, one for each column.
+// An int or bigint column is read into an *int, a string column into a *string, and either into an *any.
+func (r *Rows) Scan(dest ...any) error {
+	if !r.onRow {
+		return errors.New("no current row, call Next before Scan")
+	}
+	if len(dest) != len(r.columns) {
+		return fmt.Errorf("expected %d destinations, got %d", len(r.columns), len(dest))
+	}
+	for i, column := range r.columns {
+		value, err := r.value(column)
+		if err != nil {
+			return err
+		}
+		switch d := dest[i].(type) {
+		case *any:
+			*d = value
+		case *int:
+			v, ok := value.(int)
+			if !ok {
+				return fmt.Errorf("column %s is a string, can't scan it into an *int", column)
+			}
+			*d = v
+		case *string:
+			v, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("column %s is an int, can't scan it into a *string", column)
+			}
+			*d = v
+		default:
+			return fmt.Errorf("unsupported destination %T for column %s", dest[i], column)
+		}
+	}
+	return nil
+}
+
+// value returns the value of a column of the current row, as an int or a string
+func (r *Rows) value(column string) (any, error) {
+	if r.schema.Type(column) == "int" || r.schema.Type(column) == "bigint" {
+		return r.scan.GetInt(column)
+	}
+	return r.scan.GetString(column)
+}
+
+// Err returns the error that ended the iteration, if any
+func (r *Rows) Err() error {
+	return r.err
+}
+
+// Close closes the rows and commits the query's transaction, unless it belongs to the caller.
+// Closing rows that are already closed does nothing.
+func (r *Rows) Close() error {
+	return r.close(true)
+}
+
+// close closes the scan and ends the transaction if the rows own it, committing it if
+// commit is set
+func (r *Rows) close(commit bool) error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.onRow = false
+	r.scan.Close()
+	if !r.endTx {
+		return nil
+	}
+	if commit {
+		return r.tx.Commit()
+	}
+	return r.tx.Rollback()
+}
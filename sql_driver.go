@@ -0,0 +1,383 @@
+package cranedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yashagw/cranedb/internal/transaction"
+)
+
+// DriverName is the name the database/sql driver is registered under
+const DriverName = "cranedb"
+
+// MemoryDSN is the data source name of a database kept in memory
+const MemoryDSN = ":memory:"
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+var (
+	_ driver.Driver                         = (*Driver)(nil)
+	_ driver.DriverContext                  = (*Driver)(nil)
+	_ driver.Connector                      = (*connector)(nil)
+	_ driver.Conn                           = (*conn)(nil)
+	_ driver.ConnBeginTx                    = (*conn)(nil)
+	_ driver.Stmt                           = (*stmt)(nil)
+	_ driver.Tx                             = (*tx)(nil)
+	_ driver.Rows                           = (*rows)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+)
+
+// Driver is a database/sql driver for CraneDB databases:
+//
+//	db, err := sql.Open("cranedb", "./cranedb_data")
+//
+// The data source name is the database directory, or MemoryDSN for a database kept
+// in memory. The database is opened on the first connection and closed along with
+// the sql.DB, so the directory must not be opened by anything else in the meantime.
+// Statements take "?" placeholders for int and string arguments.
+type Driver struct{}
+
+// Open opens a connection to its own instance of the database, which is closed along
+// with the connection. sql.DB doesn't use it; it shares one instance between its
+// connections through OpenConnector.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	db, err := openDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{db: db, ownsDB: true}, nil
+}
+
+// OpenConnector returns a connector whose connections share one instance of the database
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return &connector{driver: d, dsn: dsn}, nil
+}
+
+func openDSN(dsn string) (*DB, error) {
+	if dsn == MemoryDSN {
+		return OpenInMemory()
+	}
+	return Open(dsn)
+}
+
+// connector opens the database on its first connection and closes it with the sql.DB
+type connector struct {
+	driver *Driver
+	dsn    string
+
+	mu sync.Mutex
+	db *DB
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		db, err := openDSN(c.dsn)
+		if err != nil {
+			return nil, err
+		}
+		c.db = db
+	}
+	return &conn{db: c.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close closes the database, which sql.DB does when it is closed
+func (c *connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.db == nil {
+		return nil
+	}
+	err := c.db.Close()
+	c.db = nil
+	return err
+}
+
+// conn is a connection to a database. Outside a transaction every statement
+// runs in its own, like DB.Exec and DB.Query.
+type conn struct {
+	db *DB
+	// ownsDB is set if closing the connection closes the database
+	ownsDB bool
+	// tx is the transaction begun with BeginTx, or nil
+	tx *transaction.Transaction
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query, numInput: countPlaceholders(query)}, nil
+}
+
+// Close rolls back a transaction left open on the connection, and closes the database
+// if the connection has its own instance of it
+func (c *conn) Close() error {
+	var err error
+	if c.tx != nil {
+		err = c.tx.Rollback()
+		c.tx = nil
+	}
+	if c.ownsDB {
+		if closeErr := c.db.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx begins a transaction at the default REPEATABLE READ isolation level or at
+// READ COMMITTED. Read-only transactions aren't supported.
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errors.New("transaction already in progress")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("read-only transactions are not supported")
+	}
+	isolation := transaction.RepeatableRead
+	switch sql.IsolationLevel(opts.Isolation) {
+	case sql.LevelDefault, sql.LevelRepeatableRead:
+	case sql.LevelReadCommitted:
+		isolation = transaction.ReadCommitted
+	default:
+		return nil, fmt.Errorf("isolation level %s is not supported", sql.IsolationLevel(opts.Isolation))
+	}
+
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+	if c.db.closed {
+		return nil, ErrClosed
+	}
+	c.tx = c.db.newTransactionWithIsolation(isolation)
+	return &tx{conn: c}, nil
+}
+
+// tx is a transaction begun on a connection
+type tx struct {
+	conn *conn
+}
+
+func (t *tx) Commit() error {
+	return t.end((*transaction.Transaction).Commit)
+}
+
+func (t *tx) Rollback() error {
+	return t.end((*transaction.Transaction).Rollback)
+}
+
+func (t *tx) end(fn func(*transaction.Transaction) error) error {
+	if t.conn.tx == nil {
+		return errors.New("no transaction in progress")
+	}
+	dbTx := t.conn.tx
+	t.conn.tx = nil
+	return fn(dbTx)
+}
+
+// stmt is a prepared statement. It is only parsed when it runs, once its arguments
+// have been put in place of its placeholders.
+type stmt struct {
+	conn     *conn
+	query    string
+	numInput int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.numInput
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	query, err := bindArgs(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.conn
+	if c.tx == nil {
+		count, err := c.db.Exec(query)
+		if err != nil {
+			return nil, err
+		}
+		return driver.RowsAffected(count), nil
+	}
+
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+	if c.db.closed {
+		return nil, ErrClosed
+	}
+	count, err := c.db.exec(query, c.tx)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(count), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	query, err := bindArgs(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c := s.conn
+	if c.tx == nil {
+		result, err := c.db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		return &rows{rows: result}, nil
+	}
+
+	c.db.mu.RLock()
+	defer c.db.mu.RUnlock()
+	if c.db.closed {
+		return nil, ErrClosed
+	}
+	result, err := c.db.query(query, c.tx, false)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: result}, nil
+}
+
+// rows adapts Rows to driver.Rows. Ints are returned as int64 and strings as string.
+type rows struct {
+	rows *Rows
+}
+
+func (r *rows) Columns() []string {
+	return r.rows.Columns()
+}
+
+func (r *rows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	for i, column := range r.rows.columns {
+		value, err := r.rows.value(column)
+		if err != nil {
+			return err
+		}
+		if v, ok := value.(int); ok {
+			value = int64(v)
+		}
+		dest[i] = value
+	}
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns INT, BIGINT or VARCHAR
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	switch r.rows.ColumnType(r.rows.columns[index]) {
+	case "int":
+		return "INT"
+	case "bigint":
+		return "BIGINT"
+	}
+	return "VARCHAR"
+}
+
+// countPlaceholders counts the "?" placeholders of a statement, outside its string constants
+// and quoted names
+func countPlaceholders(query string) int {
+	count := 0
+	var quote rune
+	for _, ch := range query {
+		quote = nextQuote(quote, ch)
+		if ch == '?' && quote == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// nextQuote returns the quote of the string or name the character is in, given the quote
+// of the one before it, or 0 outside of them. A doubled quote closes and reopens the string.
+func nextQuote(quote rune, ch rune) rune {
+	switch {
+	case quote == 0 && (ch == '\'' || ch == '"'):
+		return ch
+	case quote == ch:
+		return 0
+	}
+	return quote
+}
+
+// bindArgs replaces the "?" placeholders of a statement with its arguments, in order,
+// written as SQL constants. Ints must fit in an INT; strings are quoted.
+func bindArgs(query string, args []driver.Value) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+
+	var sb strings.Builder
+	var quote rune
+	next := 0
+	for _, ch := range query {
+		quote = nextQuote(quote, ch)
+		if ch != '?' || quote != 0 {
+			sb.WriteRune(ch)
+			continue
+		}
+		if next == len(args) {
+			return "", fmt.Errorf("expected %d arguments, got %d", countPlaceholders(query), len(args))
+		}
+		constant, err := sqlConstant(args[next])
+		if err != nil {
+			return "", fmt.Errorf("argument %d: %w", next+1, err)
+		}
+		sb.WriteString(constant)
+		next++
+	}
+	if next != len(args) {
+		return "", fmt.Errorf("expected %d arguments, got %d", next, len(args))
+	}
+	return sb.String(), nil
+}
+
+// sqlConstant writes an argument as a SQL constant
+func sqlConstant(value driver.Value) (string, error) {
+	switch v := value.(type) {
+	case int64:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return "", fmt.Errorf("%d doesn't fit in an INT", v)
+		}
+		return strconv.FormatInt(v, 10), nil
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'", nil
+	case []byte:
+		return "'" + strings.ReplaceAll(string(v), "'", "''") + "'", nil
+	case nil:
+		return "", errors.New("NULL values are not supported")
+	default:
+		return "", fmt.Errorf("unsupported type %T", value)
+	}
+}
@@ -0,0 +1,144 @@
+package cranedb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlUsers returns the users as a map of id to name
+func sqlUsers(t *testing.T, q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}) map[int]string {
+	rows, err := q.Query("SELECT id, name FROM users")
+	require.NoError(t, err)
+	defer rows.Close()
+	users := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		require.NoError(t, rows.Scan(&id, &name))
+		users[id] = name
+	}
+	require.NoError(t, rows.Err())
+	return users
+}
+
+func TestSQLDriver(t *testing.T) {
+	db, err := sql.Open(DriverName, t.TempDir())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE users (id INT, name VARCHAR(20), age INT)")
+	require.NoError(t, err)
+
+	insert, err := db.Prepare("INSERT INTO users (id, name, age) VALUES (?, ?, ?)")
+	require.NoError(t, err)
+	for _, user := range []struct {
+		id   int
+		name string
+		age  int
+	}{{1, "Alice", 30}, {2, "Bob", 25}, {3, "O'Brien", -1}} {
+		result, err := insert.Exec(user.id, user.name, user.age)
+		require.NoError(t, err)
+		affected, err := result.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), affected)
+	}
+	require.NoError(t, insert.Close())
+	assert.Equal(t, map[int]string{1: "Alice", 2: "Bob", 3: "O'Brien"}, sqlUsers(t, db))
+
+	var name string
+	var age int64
+	require.NoError(t, db.QueryRow("SELECT name, age FROM users WHERE name = ?", "O'Brien").Scan(&name, &age))
+	assert.Equal(t, "O'Brien", name)
+	assert.Equal(t, int64(-1), age)
+	assert.ErrorIs(t, db.QueryRow("SELECT name FROM users WHERE id = ?", 9).Scan(&name), sql.ErrNoRows)
+
+	rows, err := db.Query("SELECT id, name FROM users WHERE id = 1")
+	require.NoError(t, err)
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	assert.Equal(t, "INT", types[0].DatabaseTypeName())
+	assert.Equal(t, "VARCHAR", types[1].DatabaseTypeName())
+	require.NoError(t, rows.Close())
+
+	result, err := db.Exec("UPDATE users SET age = ? WHERE id = ?", 31, 1)
+	require.NoError(t, err)
+	affected, err := result.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	require.NoError(t, db.QueryRow("SELECT age FROM users WHERE id = 1").Scan(&age))
+	assert.Equal(t, int64(31), age)
+
+	_, err = db.Exec("DELETE FROM users WHERE id = ?", 2)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]string{1: "Alice", 3: "O'Brien"}, sqlUsers(t, db))
+
+	t.Run("Transactions", func(t *testing.T) {
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		_, err = tx.Exec("INSERT INTO users (id, name, age) VALUES (?, ?, ?)", 4, "Dave", 40)
+		require.NoError(t, err)
+		assert.Equal(t, map[int]string{1: "Alice", 3: "O'Brien", 4: "Dave"}, sqlUsers(t, tx))
+		require.NoError(t, tx.Rollback())
+		assert.Equal(t, map[int]string{1: "Alice", 3: "O'Brien"}, sqlUsers(t, db))
+
+		tx, err = db.BeginTx(t.Context(), &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+		require.NoError(t, err)
+		_, err = tx.Exec("DELETE FROM users WHERE id = ?", 3)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+		assert.Equal(t, map[int]string{1: "Alice"}, sqlUsers(t, db))
+
+		_, err = db.BeginTx(t.Context(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+		assert.Error(t, err)
+		_, err = db.BeginTx(t.Context(), &sql.TxOptions{ReadOnly: true})
+		assert.Error(t, err)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := db.Exec("INSERT INTO users (id, name, age) VALUES (?, ?, ?)", 5, "Eve")
+		assert.Error(t, err, "An argument is missing")
+		_, err = db.Exec("INSERT INTO users (id, name, age) VALUES (?, ?, ?)", 5, "Eve", nil)
+		assert.Error(t, err, "NULL isn't supported")
+		_, err = db.Exec("INSERT INTO users (id, name, age) VALUES (?, ?, ?)", 5, "Eve", int64(1)<<40)
+		assert.Error(t, err, "The value doesn't fit in an INT")
+		_, err = db.Exec("SELEKT 1")
+		assert.Error(t, err)
+		assert.Equal(t, map[int]string{1: "Alice"}, sqlUsers(t, db))
+	})
+}
+
+func TestSQLDriver_InMemory(t *testing.T) {
+	db, err := sql.Open(DriverName, MemoryDSN)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Every connection of the pool sees the same database
+	db.SetMaxOpenConns(2)
+	_, err = db.Exec("CREATE TABLE users (id INT, name VARCHAR(20))")
+	require.NoError(t, err)
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	_, err = tx.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 1, "Alice")
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, map[int]string{1: "Alice"}, sqlUsers(t, db))
+}
+
+func TestBindArgs(t *testing.T) {
+	query, err := bindArgs("SELECT a FROM t WHERE b = ? AND c = '?' AND d = ?", []driver.Value{int64(-3), "it's"})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT a FROM t WHERE b = -3 AND c = '?' AND d = 'it''s'", query)
+	assert.Equal(t, 2, countPlaceholders("SELECT a FROM t WHERE b = ? AND c = 'x''?' AND d = ?"))
+	assert.Equal(t, 1, countPlaceholders(`SELECT "why?" FROM t WHERE b = ?`))
+
+	_, err = bindArgs("SELECT a FROM t WHERE b = ?", []driver.Value{int64(1), int64(2)})
+	assert.Error(t, err)
+	_, err = bindArgs("SELECT a FROM t WHERE b = ?", []driver.Value{1.5})
+	assert.Error(t, err)
+}